@@ -0,0 +1,218 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"servify/apps/server/internal/config"
+	"servify/apps/server/internal/models"
+	"servify/apps/server/internal/services"
+)
+
+var (
+	flagEvalSet       string
+	flagEvalFile      string
+	flagEvalLabel     string
+	flagEvalJudge     bool
+	flagEvalThreshold float64
+	flagEvalCompare   uint
+	flagEvalJSON      bool
+)
+
+var aiCmd = &cobra.Command{
+	Use:   "ai",
+	Short: "AI maintenance commands",
+}
+
+// evalCmd 以标准问题集评测本地 AI 回答（knowledge_docs 语义检索 + 当前激活的提示词模板）；
+// WeKnora 增强回答请通过服务端 POST /api/ai/eval/sets/:id/runs 评测
+var evalCmd = &cobra.Command{
+	Use:   "eval",
+	Short: "Run a golden question set against the configured AI service and store the report",
+	Example: `  servify ai eval --file golden.json --label "prompt v4"
+  servify ai eval --set faq --judge --compare 12`,
+	RunE: runEval,
+}
+
+func init() {
+	evalCmd.Flags().StringVar(&flagEvalSet, "set", "", "eval set name (defaults to the name in --file)")
+	evalCmd.Flags().StringVar(&flagEvalFile, "file", "", "import the eval set from a JSON file before running (replaces cases of a set with the same name)")
+	evalCmd.Flags().StringVar(&flagEvalLabel, "label", "", "run label, e.g. the prompt or KB version under test")
+	evalCmd.Flags().BoolVar(&flagEvalJudge, "judge", false, "score answers with the LLM judge (eval use case)")
+	evalCmd.Flags().Float64Var(&flagEvalThreshold, "threshold", 0, "pass threshold for case scores (default ai.eval.threshold)")
+	evalCmd.Flags().UintVar(&flagEvalCompare, "compare", 0, "compare the new run against this run id")
+	evalCmd.Flags().BoolVar(&flagEvalJSON, "json", false, "print the report as JSON")
+	aiCmd.AddCommand(evalCmd)
+	rootCmd.AddCommand(aiCmd)
+}
+
+func runEval(cmd *cobra.Command, args []string) error {
+	cfg := config.Load()
+	log := logrus.StandardLogger()
+
+	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d sslmode=disable TimeZone=UTC", cfg.Database.Host, cfg.Database.User, cfg.Database.Password, cfg.Database.Name, cfg.Database.Port)
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Warn)})
+	if err != nil {
+		return fmt.Errorf("connect database: %w", err)
+	}
+	if err := db.AutoMigrate(&models.AIEvalSet{}, &models.AIEvalCase{}, &models.AIEvalRun{}, &models.AIEvalResult{}); err != nil {
+		return fmt.Errorf("migrate eval tables: %w", err)
+	}
+
+	ai, err := evalAIService(cfg, db, log)
+	if err != nil {
+		return err
+	}
+	svc := services.NewAIEvalService(db, ai, ai, services.AIEvalConfig{
+		Threshold: cfg.AI.Eval.Threshold,
+		Timeout:   cfg.AI.Eval.Timeout,
+	}, log)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	name := flagEvalSet
+	if flagEvalFile != "" {
+		raw, err := os.ReadFile(flagEvalFile)
+		if err != nil {
+			return err
+		}
+		var req services.AIEvalSetRequest
+		if err := json.Unmarshal(raw, &req); err != nil {
+			return fmt.Errorf("parse %s: %w", flagEvalFile, err)
+		}
+		if name != "" {
+			req.Name = name
+		}
+		set, err := svc.ImportSet(ctx, &req)
+		if err != nil {
+			return err
+		}
+		name = set.Name
+		fmt.Fprintf(cmd.ErrOrStderr(), "imported eval set %q (%d cases)\n", set.Name, len(set.Cases))
+	}
+	if name == "" {
+		return fmt.Errorf("--set or --file required")
+	}
+	var set models.AIEvalSet
+	if err := db.WithContext(ctx).Where("name = ?", name).First(&set).Error; err != nil {
+		return fmt.Errorf("eval set %q: %w", name, err)
+	}
+
+	report, err := svc.Run(ctx, set.ID, services.AIEvalRunRequest{Label: flagEvalLabel, Judge: flagEvalJudge, Threshold: flagEvalThreshold})
+	if err != nil {
+		return err
+	}
+	var cmp *services.AIEvalComparison
+	if flagEvalCompare != 0 {
+		if cmp, err = svc.Compare(ctx, flagEvalCompare, report.Run.ID); err != nil {
+			return err
+		}
+	}
+
+	out := cmd.OutOrStdout()
+	if flagEvalJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(struct {
+			*services.AIEvalReport
+			Comparison *services.AIEvalComparison `json:"comparison,omitempty"`
+		}{report, cmp})
+	}
+	printEvalReport(out, report)
+	if cmp != nil {
+		printEvalComparison(out, cmp)
+	}
+	return nil
+}
+
+// evalAIService 构建与 cmd/server 一致的标准 AI 服务：模型路由、数据库中的提示词模板与 knowledge_docs 语义检索
+func evalAIService(cfg *config.Config, db *gorm.DB, log *logrus.Logger) (*services.AIService, error) {
+	ai := services.NewAIService(cfg.AI.OpenAI.APIKey, cfg.AI.OpenAI.BaseURL)
+	llm, err := llmRouter(cfg.AI, log)
+	if err != nil {
+		return nil, fmt.Errorf("invalid AI provider config: %w", err)
+	}
+	ai.SetLLMRouter(llm)
+	ai.SetDB(db)
+	ai.SetPromptTemplates(services.NewPromptTemplateService(db, promptTemplateConfig(cfg), log))
+	ai.SetMemoryConfig(services.ConversationMemoryConfig{TokenBudget: cfg.AI.Memory.TokenBudget, MaxMessages: cfg.AI.Memory.MaxMessages})
+	ai.InitializeKnowledgeBase()
+	embedder, err := services.NewEmbedder(embeddingConfig(cfg.AI))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AI embedding config: %w", err)
+	}
+	ai.SetKnowledgeSearch(services.NewKnowledgeSearchService(db, embedder, services.KnowledgeSearchConfig{
+		ChunkSize:    cfg.AI.Embedding.ChunkSize,
+		ChunkOverlap: cfg.AI.Embedding.ChunkOverlap,
+		MinScore:     cfg.AI.Embedding.MinScore,
+	}, log))
+	return ai, nil
+}
+
+func printEvalReport(w io.Writer, report *services.AIEvalReport) {
+	run := report.Run
+	fmt.Fprintf(w, "run #%d  set=%d  label=%q  status=%s\n", run.ID, run.SetID, run.Label, run.Status)
+	fmt.Fprintf(w, "prompts=%s  knowledge=%s\n", run.PromptVersions, run.KnowledgeVersion)
+	fmt.Fprintf(w, "passed %d/%d  score=%.3f  keyword=%s  pattern=%s  citation=%s  judge=%s\n",
+		run.PassedCount, run.CaseCount, run.Score,
+		evalMetric(run.KeywordScore), evalMetric(run.PatternPassRate), evalMetric(run.CitationHitRate), evalMetric(run.JudgeScore))
+	for _, r := range report.Results {
+		if r.Passed {
+			continue
+		}
+		fmt.Fprintf(w, "  FAIL case #%d  score=%.3f  %s\n", r.CaseID, r.Score, evalTruncate(r.Question, 60))
+		if r.Error != "" {
+			fmt.Fprintf(w, "       error: %s\n", r.Error)
+		}
+		if r.JudgeReason != "" {
+			fmt.Fprintf(w, "       judge: %s\n", r.JudgeReason)
+		}
+	}
+}
+
+func printEvalComparison(w io.Writer, cmp *services.AIEvalComparison) {
+	fmt.Fprintf(w, "\ncompare #%d -> #%d  score %+.3f  pass rate %+.3f  keyword %s  pattern %s  citation %s  judge %s\n",
+		cmp.Base.ID, cmp.Head.ID, cmp.ScoreDelta, cmp.PassRateDelta,
+		evalDelta(cmp.KeywordScoreDelta), evalDelta(cmp.PatternPassRateDelta), evalDelta(cmp.CitationHitRateDelta), evalDelta(cmp.JudgeScoreDelta))
+	fmt.Fprintf(w, "improved %d  regressed %d\n", cmp.Improved, cmp.Regressed)
+	for _, d := range cmp.Cases {
+		if d.Change == "regressed" {
+			fmt.Fprintf(w, "  REGRESSED case #%d  %.3f -> %.3f  %s\n", d.CaseID, d.BaseScore, d.HeadScore, evalTruncate(d.Question, 60))
+		}
+	}
+}
+
+func evalMetric(v *float64) string {
+	if v == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%.3f", *v)
+}
+
+func evalDelta(v *float64) string {
+	if v == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%+.3f", *v)
+}
+
+func evalTruncate(s string, n int) string {
+	s = strings.ReplaceAll(s, "\n", " ")
+	if r := []rune(s); len(r) > n {
+		return string(r[:n]) + "…"
+	}
+	return s
+}
@@ -0,0 +1,91 @@
+package cli
+
+import (
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"servify/apps/server/internal/config"
+	"servify/apps/server/internal/services"
+)
+
+// llmRouter（与 cmd/server 保持一致）根据 ai 配置构建模型后端路由；未配置 providers 时沿用 ai.openai（未设置 api_key 则不注册后端，使用降级回复）
+func llmRouter(ai config.AIConfig, logger *logrus.Logger) (*services.LLMRouter, error) {
+	router := services.NewLLMRouter(logger)
+	providers := ai.Providers
+	if len(providers) == 0 && ai.OpenAI.APIKey != "" {
+		providers = []config.LLMProviderConfig{{
+			Name:        services.LLMProviderOpenAI,
+			Type:        services.LLMProviderOpenAI,
+			BaseURL:     ai.OpenAI.BaseURL,
+			APIKey:      ai.OpenAI.APIKey,
+			Model:       ai.OpenAI.Model,
+			Temperature: ai.OpenAI.Temperature,
+			MaxTokens:   ai.OpenAI.MaxTokens,
+			Timeout:     ai.OpenAI.Timeout,
+		}}
+	}
+	for _, pc := range providers {
+		p, err := services.NewLLMProvider(services.LLMProviderConfig{
+			Name:        pc.Name,
+			Type:        pc.Type,
+			BaseURL:     pc.BaseURL,
+			APIKey:      pc.APIKey,
+			Model:       pc.Model,
+			Temperature: pc.Temperature,
+			MaxTokens:   pc.MaxTokens,
+			Timeout:     pc.Timeout,
+		})
+		if err != nil {
+			return nil, err
+		}
+		var breaker *services.CircuitBreakerConfig
+		if pc.MaxFailures > 0 || pc.ResetTimeout > 0 {
+			breaker = services.DefaultCircuitBreakerConfig()
+			if pc.MaxFailures > 0 {
+				breaker.MaxFailures = pc.MaxFailures
+			}
+			if pc.ResetTimeout > 0 {
+				breaker.ResetTimeout = pc.ResetTimeout
+			}
+		}
+		if err := router.AddProvider(p, breaker); err != nil {
+			return nil, err
+		}
+	}
+	for useCase, names := range ai.UseCases {
+		if err := router.SetUseCase(useCase, names); err != nil {
+			return nil, err
+		}
+	}
+	return router, nil
+}
+
+// promptTemplateConfig 提示词模板的品牌与语言取自 portal 配置（与 cmd/server 保持一致）
+func promptTemplateConfig(cfg *config.Config) services.PromptTemplateConfig {
+	return services.PromptTemplateConfig{
+		BrandName:     cfg.Portal.BrandName,
+		DefaultLocale: cfg.Portal.DefaultLocale,
+		Locales:       cfg.Portal.Locales,
+	}
+}
+
+// embeddingConfig 知识库向量化配置（与 cmd/server 保持一致）：openai 未设置 api_key 时沿用 ai.openai
+func embeddingConfig(ai config.AIConfig) services.EmbeddingConfig {
+	ec := ai.Embedding
+	out := services.EmbeddingConfig{
+		Provider:   ec.Provider,
+		BaseURL:    ec.BaseURL,
+		APIKey:     ec.APIKey,
+		Model:      ec.Model,
+		Dimensions: ec.Dimensions,
+		Timeout:    ec.Timeout,
+	}
+	if strings.EqualFold(ec.Provider, services.EmbeddingProviderOpenAI) && out.APIKey == "" {
+		out.APIKey = ai.OpenAI.APIKey
+		if out.BaseURL == "" {
+			out.BaseURL = ai.OpenAI.BaseURL
+		}
+	}
+	return out
+}
@@ -72,9 +72,23 @@ func run(cmd *cobra.Command, args []string) {
 	if db != nil {
 		wsHub.SetDB(db)
 	}
+	wsHub.SetAllowedOrigins(cfg.Security.CORS.AllowedOrigins)
 	webrtcService := services.NewWebRTCService(cfg.WebRTC.STUNServer, wsHub)
+	webrtcService.SetDB(db)
+	webrtcService.SetTURNServers(turnServers(cfg.WebRTC.TURNServers))
+	wsHub.SetWebRTCService(webrtcService)
 	// 使用新的配置结构（cfg.AI.OpenAI.*）
 	aiService := services.NewAIService(cfg.AI.OpenAI.APIKey, cfg.AI.OpenAI.BaseURL)
+	llm, err := llmRouter(cfg.AI, logrus.StandardLogger())
+	if err != nil {
+		logrus.Fatalf("Invalid AI provider config: %v", err)
+	}
+	aiService.SetLLMRouter(llm)
+	if db != nil {
+		aiService.SetDB(db)
+	}
+	aiService.SetPromptTemplates(services.NewPromptTemplateService(db, promptTemplateConfig(cfg), logrus.StandardLogger()))
+	aiService.SetMemoryConfig(services.ConversationMemoryConfig{TokenBudget: cfg.AI.Memory.TokenBudget, MaxMessages: cfg.AI.Memory.MaxMessages})
 	messageRouter := services.NewMessageRouter(aiService, wsHub, db)
 
 	// 初始化知识库
@@ -158,8 +172,9 @@ func setupRouter(cfg *config.Config, wsHub *services.WebSocketHub, webrtcService
 	api := router.Group("/api/v1")
 	{
 		// WebSocket 连接
-		wsHandler := handlers.NewWebSocketHandler(wsHub)
+		wsHandler := handlers.NewWebSocketHandler(wsHub, cfg)
 		api.GET("/ws", wsHandler.HandleWebSocket)
+		api.POST("/ws/visitor-token", wsHandler.IssueVisitorToken)
 		api.GET("/ws/stats", wsHandler.GetStats)
 
 		// WebRTC 相关
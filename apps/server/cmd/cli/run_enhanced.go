@@ -73,7 +73,11 @@ func run(cmd *cobra.Command, args []string) {
 	if db != nil {
 		wsHub.SetDB(db)
 	}
+	wsHub.SetAllowedOrigins(cfg.Security.CORS.AllowedOrigins)
 	webrtcService := services.NewWebRTCService(cfg.WebRTC.STUNServer, wsHub)
+	webrtcService.SetDB(db)
+	webrtcService.SetTURNServers(turnServers(cfg.WebRTC.TURNServers))
+	wsHub.SetWebRTCService(webrtcService)
 
 	// 初始化 WeKnora 客户端
 	var weKnoraClient weknora.WeKnoraInterface
@@ -108,6 +112,16 @@ func run(cmd *cobra.Command, args []string) {
 	// 初始化 AI 服务
 	logrus.Info("🤖 Initializing AI services...")
 	originalAIService := services.NewAIService(cfg.AI.OpenAI.APIKey, cfg.AI.OpenAI.BaseURL)
+	llm, err := llmRouter(cfg.AI, logrus.StandardLogger())
+	if err != nil {
+		logrus.Fatalf("Invalid AI provider config: %v", err)
+	}
+	originalAIService.SetLLMRouter(llm)
+	if db != nil {
+		originalAIService.SetDB(db)
+	}
+	originalAIService.SetPromptTemplates(services.NewPromptTemplateService(db, promptTemplateConfig(cfg), logrus.StandardLogger()))
+	originalAIService.SetMemoryConfig(services.ConversationMemoryConfig{TokenBudget: cfg.AI.Memory.TokenBudget, MaxMessages: cfg.AI.Memory.MaxMessages})
 	originalAIService.InitializeKnowledgeBase()
 
 	// 创建增强的 AI 服务
@@ -261,8 +275,9 @@ func setupEnhancedRouter(
 	api := router.Group("/api/v1")
 	{
 		// WebSocket 连接
-		wsHandler := handlers.NewWebSocketHandler(wsHub)
+		wsHandler := handlers.NewWebSocketHandler(wsHub, cfg)
 		api.GET("/ws", wsHandler.HandleWebSocket)
+		api.POST("/ws/visitor-token", wsHandler.IssueVisitorToken)
 		api.GET("/ws/stats", wsHandler.GetStats)
 
 		// WebRTC 相关
@@ -276,6 +291,7 @@ func setupEnhancedRouter(
 
 		// AI 相关 API
 		aiHandler := handlers.NewAIHandler(aiService)
+		aiHandler.SetTokenSecret(cfg.JWT.Secret)
 		aiAPI := api.Group("/ai")
 		{
 			aiAPI.POST("/query", aiHandler.ProcessQuery)
@@ -0,0 +1,21 @@
+package cli
+
+import (
+	"servify/apps/server/internal/config"
+	"servify/apps/server/internal/services"
+)
+
+// turnServers 将 TURN 配置转换为 WebRTC 服务参数（与 cmd/server 保持一致）
+func turnServers(list []config.TURNServerConfig) []services.TURNServer {
+	out := make([]services.TURNServer, 0, len(list))
+	for _, t := range list {
+		out = append(out, services.TURNServer{
+			URLs:          t.URLs,
+			Username:      t.Username,
+			Credential:    t.Credential,
+			SharedSecret:  t.SharedSecret,
+			CredentialTTL: t.CredentialTTL,
+		})
+	}
+	return out
+}
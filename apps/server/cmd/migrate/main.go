@@ -128,6 +128,23 @@ func main() {
 		&models.KnowledgeDoc{},
 		&models.WebRTCConnection{},
 		&models.DailyStats{},
+		&models.TicketEmail{},
+		&models.RouteRule{},
+		&models.SessionCursor{},
+		&models.RecordingConsent{},
+		&models.CallRecording{},
+		&models.CoBrowseEvent{},
+		&models.PromptTemplate{},
+		&models.AIToolInvocation{},
+		&models.KnowledgeChunk{},
+		&models.AIUsageRecord{},
+		&models.AIDraft{},
+		&models.TicketTriage{},
+		&models.ConversationSummary{},
+		&models.AIEvalSet{},
+		&models.AIEvalCase{},
+		&models.AIEvalRun{},
+		&models.AIEvalResult{},
 	)
 	if err != nil {
 		log.Fatalf("Failed to migrate database: %v", err)
@@ -141,6 +158,13 @@ func main() {
 	// 为消息表创建复合索引
 	db.Exec("CREATE INDEX IF NOT EXISTS idx_messages_session_created ON messages(session_id, created_at)")
 
+	// 为尚未编号的历史消息回填会话内序号
+	db.Exec(`UPDATE messages m SET seq = s.rn FROM (
+		SELECT id, ROW_NUMBER() OVER (PARTITION BY session_id ORDER BY created_at, id) AS rn
+		FROM messages WHERE session_id IN (SELECT id FROM sessions WHERE last_seq = 0)
+	) s WHERE m.id = s.id`)
+	db.Exec("UPDATE sessions SET last_seq = COALESCE((SELECT MAX(seq) FROM messages WHERE messages.session_id = sessions.id), 0) WHERE last_seq = 0")
+
 	// 为工单表创建复合索引
 	db.Exec("CREATE INDEX IF NOT EXISTS idx_tickets_status_created ON tickets(status, created_at)")
 	db.Exec("CREATE INDEX IF NOT EXISTS idx_tickets_agent_status ON tickets(agent_id, status)")
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"syscall"
@@ -126,6 +127,11 @@ func main() {
 		&models.KnowledgeDoc{}, &models.WebRTCConnection{}, &models.DailyStats{},
 		&models.SLAConfig{}, &models.SLAViolation{}, &models.CustomerSatisfaction{}, &models.SatisfactionSurvey{}, &models.AppIntegration{}, &models.ShiftSchedule{},
 		&models.AutomationTrigger{}, &models.AutomationRun{}, &models.Macro{},
+		&models.TicketEmail{}, &models.RouteRule{}, &models.SessionCursor{},
+		&models.RecordingConsent{}, &models.CallRecording{}, &models.CoBrowseEvent{},
+		&models.PromptTemplate{},
+		&models.AIToolInvocation{}, &models.KnowledgeChunk{}, &models.AIUsageRecord{}, &models.AIDraft{}, &models.TicketTriage{}, &models.ConversationSummary{},
+		&models.AIEvalSet{}, &models.AIEvalCase{}, &models.AIEvalRun{}, &models.AIEvalResult{},
 	); err != nil {
 		appLogger.Fatalf("Failed to migrate database: %v", err)
 	}
@@ -133,7 +139,62 @@ func main() {
 	// 初始化 AI 服务（可选 WeKnora 增强）
 	var aiService services.AIServiceInterface
 	baseAI := services.NewAIService(cfg.AI.OpenAI.APIKey, cfg.AI.OpenAI.BaseURL)
+	llm, err := llmRouter(cfg.AI, appLogger)
+	if err != nil {
+		appLogger.Fatalf("Invalid AI provider config: %v", err)
+	}
+	baseAI.SetLLMRouter(llm)
+	baseAI.SetDB(db)
+	promptService := services.NewPromptTemplateService(db, promptTemplateConfig(cfg), appLogger)
+	baseAI.SetPromptTemplates(promptService)
+	baseAI.SetMemoryConfig(services.ConversationMemoryConfig{TokenBudget: cfg.AI.Memory.TokenBudget, MaxMessages: cfg.AI.Memory.MaxMessages})
+	// 用量计费：每次模型调用记录 token 与费用，超出月度预算时降级
+	aiUsageService := services.NewAIUsageService(db, aiUsageConfig(cfg.AI.Usage), appLogger)
+	baseAI.SetUsageService(aiUsageService)
+	// 敏感信息脱敏：外发模型/检索前替换为占位符；可选对落库消息脱敏
+	if rc := cfg.AI.Redaction; rc.Enabled || rc.RedactStoredMessages {
+		redactor, err := services.NewPIIRedactor(piiRedactionConfig(rc))
+		if err != nil {
+			appLogger.Fatalf("Invalid AI redaction config: %v", err)
+		}
+		if rc.Enabled {
+			baseAI.SetRedactor(redactor)
+		}
+		if rc.RedactStoredMessages {
+			if err := redactor.RegisterMessageRedaction(db); err != nil {
+				appLogger.Fatalf("Failed to register message redaction: %v", err)
+			}
+		}
+	}
+	// 转人工策略：关键词、低置信度、负面情绪、重复提问、VIP 与工作时间加权判断
+	handoffCfg, err := handoffPolicyConfig(cfg.AI.Handoff)
+	if err != nil {
+		appLogger.Fatalf("Invalid AI handoff config: %v", err)
+	}
+	handoffPolicy, err := services.NewHandoffPolicy(handoffCfg)
+	if err != nil {
+		appLogger.Fatalf("Invalid AI handoff config: %v", err)
+	}
+	baseAI.SetHandoffPolicy(handoffPolicy)
 	baseAI.InitializeKnowledgeBase()
+	// 本地语义检索：knowledge_docs 切块向量化，启动时在后台补齐缺失或过期的索引
+	embedder, err := services.NewEmbedder(embeddingConfig(cfg.AI))
+	if err != nil {
+		appLogger.Fatalf("Invalid AI embedding config: %v", err)
+	}
+	knowledgeSearch := services.NewKnowledgeSearchService(db, embedder, services.KnowledgeSearchConfig{
+		ChunkSize:    cfg.AI.Embedding.ChunkSize,
+		ChunkOverlap: cfg.AI.Embedding.ChunkOverlap,
+		MinScore:     cfg.AI.Embedding.MinScore,
+	}, appLogger)
+	baseAI.SetKnowledgeSearch(knowledgeSearch)
+	go func() {
+		if n, err := knowledgeSearch.Sync(context.Background(), false); err != nil {
+			appLogger.Warnf("Knowledge index sync failed: %v", err)
+		} else if n > 0 {
+			appLogger.Infof("Indexed %d knowledge docs", n)
+		}
+	}()
 
 	var weKnoraClient weknora.WeKnoraInterface
 	if cfg.WeKnora.Enabled {
@@ -153,8 +214,75 @@ func main() {
 	// 初始化实时与路由服务（对齐 CLI 端点）
 	wsHub := services.NewWebSocketHub()
 	wsHub.SetDB(db)
+	wsHub.SetAllowedOrigins(cfg.Security.CORS.AllowedOrigins)
+	// 多实例部署：通过 Redis 总线在实例间转发会话消息
+	var hubBackplane services.HubBackplane
+	if cfg.WebSocket.Backplane == "redis" {
+		bp, err := services.NewRedisBackplane(services.RedisBackplaneConfig{
+			Addr:        fmt.Sprintf("%s:%d", cfg.Redis.Host, cfg.Redis.Port),
+			Password:    cfg.Redis.Password,
+			DB:          cfg.Redis.DB,
+			PoolSize:    cfg.Redis.PoolSize,
+			NodeID:      cfg.WebSocket.NodeID,
+			PresenceTTL: cfg.WebSocket.PresenceTTL,
+		})
+		if err != nil {
+			appLogger.Fatalf("Failed to init WebSocket backplane: %v", err)
+		}
+		if err := wsHub.SetBackplane(bp); err != nil {
+			appLogger.Warnf("WebSocket backplane subscribe: %v", err)
+		}
+		hubBackplane = bp
+		appLogger.Infof("WebSocket hub using redis backplane (node %s)", bp.NodeID())
+	}
 	webrtcService := services.NewWebRTCService(cfg.WebRTC.STUNServer, wsHub)
+	webrtcService.SetDB(db)
+	webrtcService.SetTURNServers(turnServers(cfg.WebRTC.TURNServers))
+	wsHub.SetWebRTCService(webrtcService)
+	coBrowseService := services.NewCoBrowseService(db, wsHub, appLogger)
+	wsHub.SetCoBrowseService(coBrowseService)
+	var recordingService *services.CallRecordingService
+	if cfg.WebRTC.Recording.Enabled {
+		recordingService = services.NewCallRecordingService(db, wsHub, recordingConfig(cfg), appLogger)
+		webrtcService.SetRecordingService(recordingService)
+	}
 	messageRouter := services.NewMessageRouter(aiService, wsHub, db)
+	routeRuleService := services.NewRouteRuleService(db, appLogger)
+	messageRouter.SetRouteRuleService(routeRuleService)
+
+	// 外部渠道适配器（按配置启用）
+	var telegramAdapter *services.TelegramAdapter
+	if tg := cfg.Channels.Telegram; tg.Enabled {
+		telegramAdapter = services.NewTelegramAdapter(services.TelegramAdapterConfig{
+			BotToken:      tg.BotToken,
+			APIBaseURL:    tg.APIBaseURL,
+			Mode:          tg.Mode,
+			WebhookURL:    tg.WebhookURL,
+			WebhookSecret: tg.WebhookSecret,
+			PollTimeout:   tg.PollTimeout,
+			UploadDir:     cfg.Upload.StoragePath,
+		})
+		messageRouter.RegisterPlatform(string(services.PlatformTelegram), telegramAdapter)
+	}
+	var wechatAdapter *services.WeChatAdapter
+	if wx := cfg.Channels.WeChat; wx.Enabled {
+		adapter, err := services.NewWeChatAdapter(services.WeChatAdapterConfig{
+			Kind:           wx.Kind,
+			AppID:          wx.AppID,
+			AppSecret:      wx.AppSecret,
+			AgentID:        wx.AgentID,
+			Token:          wx.Token,
+			EncodingAESKey: wx.EncodingAESKey,
+			APIBaseURL:     wx.APIBaseURL,
+			UploadDir:      cfg.Upload.StoragePath,
+		})
+		if err != nil {
+			appLogger.Fatalf("Failed to init WeChat adapter: %v", err)
+		}
+		wechatAdapter = adapter
+		messageRouter.RegisterPlatform(string(services.PlatformWeChat), wechatAdapter)
+	}
+
 	go wsHub.Run()
 	// 使 WebSocket 文本消息可直接触发 AI 回复
 	wsHub.SetAIService(aiService)
@@ -170,7 +298,44 @@ func main() {
 	agentService := services.NewAgentService(db, appLogger)
 	ticketService := services.NewTicketService(db, appLogger, slaService)
 	ticketService.SetAutomationService(automationService)
+	// 工单分流：创建时由模型预测分类、优先级、情绪与标签
+	if tc := cfg.AI.Triage; tc.Enabled {
+		ticketService.SetTriageService(services.NewTicketTriageService(db, baseAI, services.TicketTriageConfig{
+			Threshold:  tc.Threshold,
+			Categories: tc.Categories,
+			Tags:       tc.Tags,
+			MaxTags:    tc.MaxTags,
+			Timeout:    tc.Timeout,
+		}, appLogger))
+	}
 	sessionTransferService := services.NewSessionTransferService(db, appLogger, aiService, agentService, wsHub)
+	messageRouter.SetSessionTransferService(sessionTransferService)
+	// AI 工具调用：回答时可查询/创建客户工单、请求转人工；调用记录始终可查
+	aiToolService := services.NewAIToolService(db, ticketService, sessionTransferService, aiToolConfig(cfg.AI.Tools), appLogger)
+	if cfg.AI.Tools.Enabled {
+		baseAI.SetToolService(aiToolService)
+	}
+	// 坐席工作台：排队/分配/客户消息/工单/SLA 事件实时推送
+	agentRealtime := services.NewAgentRealtimeService(db, wsHub, appLogger)
+	agentRealtime.SetMessageRouter(messageRouter)
+	wsHub.SetAgentRealtimeService(agentRealtime)
+	messageRouter.SetAgentRealtimeService(agentRealtime)
+	agentService.SetAgentRealtimeService(agentRealtime)
+	sessionTransferService.SetAgentRealtimeService(agentRealtime)
+	ticketService.SetAgentRealtimeService(agentRealtime)
+	// 结构化摘要：转接时同步生成；auto 开启时工单解决/关闭、会话结束时异步生成
+	summaryService := services.NewSummaryService(db, baseAI, appLogger)
+	sessionTransferService.SetSummaryService(summaryService)
+	if cfg.AI.Summary.Auto {
+		ticketService.SetSummaryService(summaryService)
+		agentService.SetSummaryService(summaryService)
+	}
+	// 离线评测：以标准问题集运行当前 AI 服务，对比提示词模板与知识库版本
+	aiEvalService := services.NewAIEvalService(db, aiService, baseAI, services.AIEvalConfig{
+		Threshold: cfg.AI.Eval.Threshold,
+		Timeout:   cfg.AI.Eval.Timeout,
+	}, appLogger)
+	slaService.SetAgentRealtimeService(agentRealtime)
 	statisticsService := services.NewStatisticsService(db, appLogger)
 	satisfactionService := services.NewSatisfactionService(db, appLogger)
 	ticketService.SetSatisfactionService(satisfactionService)
@@ -180,9 +345,39 @@ func main() {
 	appIntegrationService := services.NewAppIntegrationService(db, appLogger)
 	customFieldService := services.NewCustomFieldService(db)
 	knowledgeDocService := services.NewKnowledgeDocService(db)
+	knowledgeDocService.SetIndexer(knowledgeSearch)
 	suggestionService := services.NewSuggestionService(db)
+	assistService := services.NewAssistService(db, baseAI, suggestionService, appLogger)
 	gamificationService := services.NewGamificationService(db)
 
+	// 邮件渠道（收信转工单，公开评论回发）
+	var emailListener *services.EmailListener
+	if ec := cfg.Channels.Email; ec.Enabled {
+		emailService := services.NewEmailService(db, appLogger, ticketService, services.EmailServiceConfig{
+			Address:          ec.Address,
+			FromName:         ec.FromName,
+			ReplyTokenSecret: ec.ReplyTokenSecret,
+			SMTPHost:         ec.SMTPHost,
+			SMTPPort:         ec.SMTPPort,
+			SMTPUsername:     ec.SMTPUsername,
+			SMTPPassword:     ec.SMTPPassword,
+			StoragePath:      cfg.Upload.StoragePath,
+		})
+		ticketService.SetEmailService(emailService)
+		if ec.ListenAddr != "" {
+			emailListener = services.NewEmailListener(services.EmailListenerConfig{
+				Addr:            ec.ListenAddr,
+				Protocol:        ec.ListenProtocol,
+				Hostname:        emailService.Domain(),
+				AcceptDomains:   []string{emailService.Domain()},
+				MaxMessageBytes: ec.MaxMessageSize,
+			}, emailService)
+			if err := emailListener.Start(); err != nil {
+				appLogger.Fatalf("Failed to start email listener: %v", err)
+			}
+		}
+	}
+
 	// 启动统计服务后台任务
 	go statisticsService.StartDailyStatsWorker()
 
@@ -190,6 +385,9 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	go slaService.StartSLAMonitor(ctx, 5*time.Minute)
 	defer cancel()
+	if recordingService != nil {
+		go recordingService.StartRetentionWorker(ctx, time.Hour)
+	}
 
 	// 初始化 Gin
 	if cfg.Log.Level == "debug" {
@@ -235,6 +433,7 @@ func main() {
 	ticketsAPI := api.Group("/")
 	ticketsAPI.Use(middleware.RequireResourcePermission("tickets"))
 	handlers.RegisterTicketRoutes(ticketsAPI, ticketHandler(ticketService, appLogger))
+	handlers.RegisterSummaryRoutes(ticketsAPI, handlers.NewSummaryHandler(summaryService))
 
 	sessionTransferAPI := api.Group("/")
 	sessionTransferAPI.Use(middleware.RequireResourcePermission("session_transfer"))
@@ -247,6 +446,10 @@ func main() {
 	workspaceAPI := api.Group("/")
 	workspaceAPI.Use(middleware.RequireResourcePermission("workspace"))
 	handlers.RegisterWorkspaceRoutes(workspaceAPI, workspaceHandler(workspaceService))
+	handlers.RegisterCoBrowseRoutes(workspaceAPI, handlers.NewCoBrowseHandler(coBrowseService))
+	if telegramAdapter != nil {
+		handlers.RegisterTelegramFileRoutes(workspaceAPI, handlers.NewTelegramFileHandler(telegramAdapter))
+	}
 
 	macrosAPI := api.Group("/")
 	macrosAPI.Use(middleware.RequireResourcePermission("macros"))
@@ -276,18 +479,47 @@ func main() {
 	automationAPI.Use(middleware.RequireResourcePermission("automation"))
 	handlers.RegisterAutomationRoutes(automationAPI, automationHandler(automationService))
 
+	routingAPI := api.Group("/")
+	routingAPI.Use(middleware.RequireResourcePermission("routing"))
+	handlers.RegisterRouteRuleRoutes(routingAPI, handlers.NewRouteRuleHandler(routeRuleService))
+
 	knowledgeAPI := api.Group("/")
 	knowledgeAPI.Use(middleware.RequireResourcePermission("knowledge"))
 	handlers.RegisterKnowledgeDocRoutes(knowledgeAPI, handlers.NewKnowledgeDocHandler(knowledgeDocService))
+	handlers.RegisterKnowledgeSearchRoutes(knowledgeAPI, handlers.NewKnowledgeSearchHandler(knowledgeSearch))
 
 	assistAPI := api.Group("/")
 	assistAPI.Use(middleware.RequireResourcePermission("assist"))
 	handlers.RegisterSuggestionRoutes(assistAPI, handlers.NewSuggestionHandler(suggestionService))
+	handlers.RegisterAssistRoutes(assistAPI, handlers.NewAssistHandler(assistService))
 
 	gamificationAPI := api.Group("/")
 	gamificationAPI.Use(middleware.RequireResourcePermission("gamification"))
 	handlers.RegisterGamificationRoutes(gamificationAPI, handlers.NewGamificationHandler(gamificationService))
 
+	aiPromptsAPI := api.Group("/")
+	aiPromptsAPI.Use(middleware.RequireResourcePermission("ai_prompts"))
+	previewer, _ := aiService.(services.PromptPreviewer)
+	handlers.RegisterPromptTemplateRoutes(aiPromptsAPI, handlers.NewPromptTemplateHandler(promptService, previewer))
+
+	aiToolsAPI := api.Group("/")
+	aiToolsAPI.Use(middleware.RequireResourcePermission("ai_tools"))
+	handlers.RegisterAIToolRoutes(aiToolsAPI, handlers.NewAIToolHandler(aiToolService))
+
+	aiUsageAPI := api.Group("/")
+	aiUsageAPI.Use(middleware.RequireResourcePermission("ai_usage"))
+	handlers.RegisterAIUsageRoutes(aiUsageAPI, handlers.NewAIUsageHandler(aiUsageService))
+
+	aiEvalAPI := api.Group("/")
+	aiEvalAPI.Use(middleware.RequireResourcePermission("ai_eval"))
+	handlers.RegisterAIEvalRoutes(aiEvalAPI, handlers.NewAIEvalHandler(aiEvalService))
+
+	if recordingService != nil {
+		recordingsAPI := api.Group("/")
+		recordingsAPI.Use(middleware.RequireResourcePermission("recordings"))
+		handlers.RegisterRecordingRoutes(recordingsAPI, handlers.NewRecordingHandler(recordingService))
+	}
+
 	// 公共（无需登录）API
 	public := r.Group("/public")
 	handlers.RegisterCSATSurveyRoutes(public, csatSurveyHandler(satisfactionService))
@@ -298,8 +530,9 @@ func main() {
 	v1 := r.Group("/api/v1")
 	{
 		// WebSocket
-		wsHandler := handlers.NewWebSocketHandler(wsHub)
+		wsHandler := handlers.NewWebSocketHandler(wsHub, cfg)
 		v1.GET("/ws", wsHandler.HandleWebSocket)
+		v1.POST("/ws/visitor-token", wsHandler.IssueVisitorToken)
 		v1.GET("/ws/stats", wsHandler.GetStats)
 
 		// WebRTC
@@ -311,8 +544,17 @@ func main() {
 		messageHandler := handlers.NewMessageHandler(messageRouter)
 		v1.GET("/messages/platforms", messageHandler.GetPlatformStats)
 
+		// 外部渠道回调（webhook 模式）
+		if telegramAdapter != nil && telegramAdapter.Mode() == services.TelegramModeWebhook {
+			handlers.RegisterTelegramWebhookRoutes(v1, handlers.NewTelegramWebhookHandler(telegramAdapter))
+		}
+		if wechatAdapter != nil {
+			handlers.RegisterWeChatCallbackRoutes(v1, handlers.NewWeChatCallbackHandler(wechatAdapter))
+		}
+
 		// AI API
 		aiHandler := handlers.NewAIHandler(aiService)
+		aiHandler.SetTokenSecret(cfg.JWT.Secret)
 		aiAPI := v1.Group("/ai")
 		aiAPI.POST("/query", aiHandler.ProcessQuery)
 		aiAPI.GET("/status", aiHandler.GetStatus)
@@ -373,6 +615,15 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 	appLogger.Info("Shutting down server...")
+	if err := messageRouter.Stop(); err != nil {
+		appLogger.Errorf("Failed to stop message router: %v", err)
+	}
+	if emailListener != nil {
+		_ = emailListener.Stop()
+	}
+	if hubBackplane != nil {
+		_ = hubBackplane.Close()
+	}
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 	if err := srv.Shutdown(shutdownCtx); err != nil {
@@ -422,6 +673,210 @@ func csatSurveyHandler(s *services.SatisfactionService) *handlers.CSATSurveyHand
 	return handlers.NewCSATSurveyHandler(s)
 }
 
+// turnServers 将 TURN 配置转换为 WebRTC 服务参数
+func turnServers(list []config.TURNServerConfig) []services.TURNServer {
+	out := make([]services.TURNServer, 0, len(list))
+	for _, t := range list {
+		out = append(out, services.TURNServer{
+			URLs:          t.URLs,
+			Username:      t.Username,
+			Credential:    t.Credential,
+			SharedSecret:  t.SharedSecret,
+			CredentialTTL: t.CredentialTTL,
+		})
+	}
+	return out
+}
+
+// llmRouter 根据 ai 配置构建模型后端路由；未配置 providers 时沿用 ai.openai（未设置 api_key 则不注册后端，使用降级回复）
+func llmRouter(ai config.AIConfig, logger *logrus.Logger) (*services.LLMRouter, error) {
+	router := services.NewLLMRouter(logger)
+	providers := ai.Providers
+	if len(providers) == 0 && ai.OpenAI.APIKey != "" {
+		providers = []config.LLMProviderConfig{{
+			Name:        services.LLMProviderOpenAI,
+			Type:        services.LLMProviderOpenAI,
+			BaseURL:     ai.OpenAI.BaseURL,
+			APIKey:      ai.OpenAI.APIKey,
+			Model:       ai.OpenAI.Model,
+			Temperature: ai.OpenAI.Temperature,
+			MaxTokens:   ai.OpenAI.MaxTokens,
+			Timeout:     ai.OpenAI.Timeout,
+		}}
+	}
+	for _, pc := range providers {
+		p, err := services.NewLLMProvider(services.LLMProviderConfig{
+			Name:        pc.Name,
+			Type:        pc.Type,
+			BaseURL:     pc.BaseURL,
+			APIKey:      pc.APIKey,
+			Model:       pc.Model,
+			Temperature: pc.Temperature,
+			MaxTokens:   pc.MaxTokens,
+			Timeout:     pc.Timeout,
+		})
+		if err != nil {
+			return nil, err
+		}
+		var breaker *services.CircuitBreakerConfig
+		if pc.MaxFailures > 0 || pc.ResetTimeout > 0 {
+			breaker = services.DefaultCircuitBreakerConfig()
+			if pc.MaxFailures > 0 {
+				breaker.MaxFailures = pc.MaxFailures
+			}
+			if pc.ResetTimeout > 0 {
+				breaker.ResetTimeout = pc.ResetTimeout
+			}
+		}
+		if err := router.AddProvider(p, breaker); err != nil {
+			return nil, err
+		}
+	}
+	for useCase, names := range ai.UseCases {
+		if err := router.SetUseCase(useCase, names); err != nil {
+			return nil, err
+		}
+	}
+	return router, nil
+}
+
+// promptTemplateConfig 提示词模板的品牌与语言取自 portal 配置
+func promptTemplateConfig(cfg *config.Config) services.PromptTemplateConfig {
+	return services.PromptTemplateConfig{
+		BrandName:     cfg.Portal.BrandName,
+		DefaultLocale: cfg.Portal.DefaultLocale,
+		Locales:       cfg.Portal.Locales,
+	}
+}
+
+// aiUsageConfig 价格表与月度预算
+func aiUsageConfig(uc config.AIUsageConfig) services.AIUsageConfig {
+	out := services.AIUsageConfig{
+		Tenant:            uc.Tenant,
+		Currency:          uc.Currency,
+		MonthlySoftBudget: uc.MonthlySoftBudget,
+		MonthlyHardBudget: uc.MonthlyHardBudget,
+	}
+	if len(uc.Prices) > 0 {
+		out.Prices = make(map[string]services.AIPrice, len(uc.Prices))
+		for key, p := range uc.Prices {
+			out.Prices[key] = services.AIPrice{Prompt: p.Prompt, Completion: p.Completion}
+		}
+	}
+	return out
+}
+
+// piiRedactionConfig 脱敏类型与自定义规则
+func piiRedactionConfig(rc config.AIRedactionConfig) services.PIIRedactionConfig {
+	out := services.PIIRedactionConfig{Types: rc.Types}
+	for _, c := range rc.Custom {
+		out.Custom = append(out.Custom, services.PIIPattern{Name: c.Name, Pattern: c.Pattern})
+	}
+	return out
+}
+
+// handoffPolicyConfig 转人工策略；未设置 weight 的信号沿用默认权重，工作时间按 HH:MM 解析
+func handoffPolicyConfig(hc config.AIHandoffConfig) (services.HandoffPolicyConfig, error) {
+	out := services.DefaultHandoffPolicyConfig()
+	out.Threshold = hc.Threshold
+	out.Keywords = hc.Keywords.Locales
+	out.LowConfidenceBelow = hc.LowConfidence.Below
+	out.LowConfidenceStreak = hc.LowConfidence.Streak
+	out.NegativeTerms = hc.NegativeSentiment.Locales
+	out.UnansweredRepeats = hc.Unanswered.Repeats
+	out.VIPTiers = hc.VIP.Tiers
+	out.Timezone = hc.BusinessHours.Timezone
+	for _, w := range []struct {
+		src *float64
+		dst *float64
+	}{
+		{hc.Keywords.Weight, &out.KeywordWeight},
+		{hc.LowConfidence.Weight, &out.LowConfidenceWeight},
+		{hc.NegativeSentiment.Weight, &out.NegativeWeight},
+		{hc.Unanswered.Weight, &out.UnansweredWeight},
+		{hc.VIP.Weight, &out.VIPWeight},
+		{hc.BusinessHours.Weight, &out.OffHoursWeight},
+	} {
+		if w.src != nil {
+			*w.dst = *w.src
+		}
+	}
+	if len(hc.BusinessHours.Days) == 0 {
+		return out, nil
+	}
+	for _, d := range hc.BusinessHours.Days {
+		if d < 0 || d > 6 {
+			return out, fmt.Errorf("invalid business day %d", d)
+		}
+		out.Days = append(out.Days, time.Weekday(d))
+	}
+	var err error
+	if out.StartMinute, err = clockMinute(hc.BusinessHours.Start); err != nil {
+		return out, err
+	}
+	if out.EndMinute, err = clockMinute(hc.BusinessHours.End); err != nil {
+		return out, err
+	}
+	return out, nil
+}
+
+// clockMinute 将 HH:MM 转为当天的分钟数；24:00 表示当天结束
+func clockMinute(v string) (int, error) {
+	if v == "24:00" {
+		return 24 * 60, nil
+	}
+	t, err := time.Parse("15:04", v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid clock time %q", v)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// embeddingConfig 向量化后端；openai 未单独配置密钥时沿用 ai.openai
+func embeddingConfig(ai config.AIConfig) services.EmbeddingConfig {
+	ec := ai.Embedding
+	out := services.EmbeddingConfig{
+		Provider:   ec.Provider,
+		BaseURL:    ec.BaseURL,
+		APIKey:     ec.APIKey,
+		Model:      ec.Model,
+		Dimensions: ec.Dimensions,
+		Timeout:    ec.Timeout,
+	}
+	if strings.EqualFold(ec.Provider, services.EmbeddingProviderOpenAI) && out.APIKey == "" {
+		out.APIKey = ai.OpenAI.APIKey
+		if out.BaseURL == "" {
+			out.BaseURL = ai.OpenAI.BaseURL
+		}
+	}
+	return out
+}
+
+// aiToolConfig 未配置 permissions 时使用内置的默认权限
+func aiToolConfig(tc config.AIToolsConfig) services.AIToolConfig {
+	out := services.AIToolConfig{MaxRounds: tc.MaxRounds}
+	if len(tc.Permissions) > 0 {
+		out.Permissions = make(map[string]services.AIToolPermission, len(tc.Permissions))
+		for name, p := range tc.Permissions {
+			out.Permissions[name] = services.AIToolPermission{Enabled: p.Enabled, Platforms: p.Platforms, MaxCallsPerSession: p.MaxCallsPerSession}
+		}
+	}
+	return out
+}
+
+// recordingConfig 录制目录默认位于上传存储下
+func recordingConfig(cfg *config.Config) services.RecordingConfig {
+	rc := cfg.WebRTC.Recording
+	dir := rc.Dir
+	if dir == "" {
+		dir = filepath.Join(cfg.Upload.StoragePath, "recordings")
+	}
+	return services.RecordingConfig{
+		Dir:       dir,
+		Retention: time.Duration(rc.RetentionDays) * 24 * time.Hour,
+	}
+}
+
 // helpers (copied from migrate for consistency)
 func getenvDefault(key, def string) string {
 	if v := os.Getenv(key); v != "" {
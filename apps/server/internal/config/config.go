@@ -11,6 +11,7 @@ type Config struct {
 	Server     ServerConfig     `yaml:"server"`
 	Database   DatabaseConfig   `yaml:"database"`
 	Redis      RedisConfig      `yaml:"redis"`
+	WebSocket  WebSocketConfig  `yaml:"websocket"`
 	WebRTC     WebRTCConfig     `yaml:"webrtc"`
 	AI         AIConfig         `yaml:"ai"`
 	WeKnora    WeKnoraConfig    `yaml:"weknora"`
@@ -21,6 +22,7 @@ type Config struct {
 	Security   SecurityConfig   `yaml:"security"`
 	Portal     PortalConfig     `yaml:"portal"`
 	Upload     UploadConfig     `yaml:"upload"`
+	Channels   ChannelsConfig   `yaml:"channels"`
 }
 
 type ServerConfig struct {
@@ -48,12 +50,204 @@ type RedisConfig struct {
 	MinIdleConns int    `yaml:"min_idle_conns"`
 }
 
+// WebSocketConfig 实时连接配置；多实例部署时使用 redis 总线（连接参数取自 RedisConfig）
+type WebSocketConfig struct {
+	Backplane   string        `yaml:"backplane"`    // memory（默认）, redis
+	NodeID      string        `yaml:"node_id"`      // 实例标识，为空时自动生成
+	PresenceTTL time.Duration `yaml:"presence_ttl"` // 会话在线记录过期时间
+	// 访客令牌有效期（仅约束建立连接的时间窗口，已建立的连接不受影响）
+	VisitorTokenTTL time.Duration `yaml:"visitor_token_ttl"`
+}
+
 type WebRTCConfig struct {
-	STUNServer string `yaml:"stun_server"`
+	STUNServer  string             `yaml:"stun_server"`
+	TURNServers []TURNServerConfig `yaml:"turn_servers"`
+	Recording   RecordingConfig    `yaml:"recording"`
+}
+
+// RecordingConfig 服务端通话/屏幕共享录制（仅录制客户已授权的会话）；dir 为空时使用 upload.storage_path/recordings
+type RecordingConfig struct {
+	Enabled       bool   `yaml:"enabled"`
+	Dir           string `yaml:"dir"`
+	RetentionDays int    `yaml:"retention_days"` // 保留天数，0 表示不自动删除
+}
+
+// TURNServerConfig TURN 中继；配置 shared_secret 时按 TURN REST API 为每个会话签发临时凭据，
+// 否则使用静态 username/credential
+type TURNServerConfig struct {
+	URLs          []string      `yaml:"urls"`
+	Username      string        `yaml:"username"`
+	Credential    string        `yaml:"credential"`
+	SharedSecret  string        `yaml:"shared_secret"`
+	CredentialTTL time.Duration `yaml:"credential_ttl"` // 临时凭据有效期，默认 1h
 }
 
 type AIConfig struct {
 	OpenAI OpenAIConfig `yaml:"openai"`
+	// Providers 可选的多模型后端，按声明顺序作为默认故障转移顺序；为空时仅使用 openai 配置
+	Providers []LLMProviderConfig `yaml:"providers"`
+	// UseCases 各使用场景（answer/summary/draft/triage/eval）使用的 provider 名称及顺序，未配置的场景使用默认顺序
+	UseCases map[string][]string `yaml:"use_cases"`
+	Memory   AIMemoryConfig      `yaml:"memory"`
+	Tools    AIToolsConfig       `yaml:"tools"`
+	// Embedding 本地知识库（knowledge_docs）语义检索的向量化与切块
+	Embedding AIEmbeddingConfig `yaml:"embedding"`
+	// Usage token 用量计费与月度预算
+	Usage AIUsageConfig `yaml:"usage"`
+	// Redaction 发送给模型与外部检索前的敏感信息脱敏
+	Redaction AIRedactionConfig `yaml:"redaction"`
+	// Triage 工单创建时的模型分流（分类、优先级、情绪、标签）
+	Triage AITriageConfig `yaml:"triage"`
+	// Summary 结构化摘要（问题、处理步骤、解决结果、待跟进）
+	Summary AISummaryConfig `yaml:"summary"`
+	// Handoff 转人工策略（各信号加权求和，达到阈值时转接）
+	Handoff AIHandoffConfig `yaml:"handoff"`
+	// Eval 标准问题集离线评测（servify ai eval 与 /api/ai/eval）
+	Eval AIEvalConfig `yaml:"eval"`
+}
+
+// AIEvalConfig 用例得分（各评分项平均）不低于 threshold 为通过（默认 0.7）；timeout 为单个用例回答与评审的超时（默认 60s）
+type AIEvalConfig struct {
+	Threshold float64       `yaml:"threshold"`
+	Timeout   time.Duration `yaml:"timeout"`
+}
+
+// AIHandoffConfig 命中信号的权重累加，总分不低于 threshold（默认 1.0）时转人工；未设置 weight 的信号使用内置默认权重，
+// 设为 0 的信号不参与。关键词与负面词按语言配置（zh、en、zh-CN 等），为空时使用内置词表
+type AIHandoffConfig struct {
+	Threshold         float64                   `yaml:"threshold"`
+	Keywords          AIHandoffTermsConfig      `yaml:"keywords"`
+	LowConfidence     AIHandoffConfidenceConfig `yaml:"low_confidence"`
+	NegativeSentiment AIHandoffTermsConfig      `yaml:"negative_sentiment"`
+	Unanswered        AIHandoffRepeatConfig     `yaml:"unanswered"`
+	VIP               AIHandoffVIPConfig        `yaml:"vip"`
+	BusinessHours     AIHandoffHoursConfig      `yaml:"business_hours"`
+}
+
+type AIHandoffTermsConfig struct {
+	Weight  *float64            `yaml:"weight"`
+	Locales map[string][]string `yaml:"locales"`
+}
+
+// AIHandoffConfidenceConfig AI 回答置信度连续 streak 次（默认 3）低于 below（默认 0.5）
+type AIHandoffConfidenceConfig struct {
+	Weight *float64 `yaml:"weight"`
+	Below  float64  `yaml:"below"`
+	Streak int      `yaml:"streak"`
+}
+
+// AIHandoffRepeatConfig 坐席介入前同一问题（含本次）被问到 repeats 次（默认 3）
+type AIHandoffRepeatConfig struct {
+	Weight  *float64 `yaml:"weight"`
+	Repeats int      `yaml:"repeats"`
+}
+
+// AIHandoffVIPConfig 客户等级（customers.priority）或标签属于 tiers（默认 urgent、vip）
+type AIHandoffVIPConfig struct {
+	Weight *float64 `yaml:"weight"`
+	Tiers  []string `yaml:"tiers"`
+}
+
+// AIHandoffHoursConfig 工作时间外累加 weight（通常为负值）；days 为 0-6（0 为周日），为空时不启用
+type AIHandoffHoursConfig struct {
+	Weight   *float64 `yaml:"weight"`
+	Timezone string   `yaml:"timezone"`
+	Days     []int    `yaml:"days"`
+	Start    string   `yaml:"start"` // 例如 09:00
+	End      string   `yaml:"end"`   // 例如 18:00
+}
+
+// AISummaryConfig auto 开启后工单解决/关闭、会话结束时异步生成摘要；转接与手动重新生成不受此开关影响
+type AISummaryConfig struct {
+	Auto bool `yaml:"auto"`
+}
+
+// AITriageConfig 置信度不低于 threshold 才写入工单（默认 0.7）；categories 为空时使用 technical、billing、general、complaint，
+// tags 为空时标签不受词表限制
+type AITriageConfig struct {
+	Enabled    bool          `yaml:"enabled"`
+	Threshold  float64       `yaml:"threshold"`
+	Categories []string      `yaml:"categories"`
+	Tags       []string      `yaml:"tags"`
+	MaxTags    int           `yaml:"max_tags"` // 最多写入的标签数，默认 3
+	Timeout    time.Duration `yaml:"timeout"`  // 单次预测超时，默认 10s
+}
+
+// AIRedactionConfig types 可选 phone、email、id_card、bank_card，为空时全部启用；custom 为额外的正则规则。
+// redact_stored_messages 开启后消息落库前同样脱敏（不可还原）
+type AIRedactionConfig struct {
+	Enabled              bool                 `yaml:"enabled"`
+	Types                []string             `yaml:"types"`
+	Custom               []AIRedactionPattern `yaml:"custom"`
+	RedactStoredMessages bool                 `yaml:"redact_stored_messages"`
+}
+
+type AIRedactionPattern struct {
+	Name    string `yaml:"name"`
+	Pattern string `yaml:"pattern"`
+}
+
+// AIUsageConfig 价格为每百万 token 的费用，按 "provider/model"、model、provider、default 的顺序匹配；
+// 超出软预算后面向客户的回答降级为规则回复，超出硬预算后停止全部模型调用；预算为 0 表示不限制
+type AIUsageConfig struct {
+	Tenant            string                   `yaml:"tenant"`
+	Currency          string                   `yaml:"currency"`
+	Prices            map[string]AIPriceConfig `yaml:"prices"`
+	MonthlySoftBudget float64                  `yaml:"monthly_soft_budget"`
+	MonthlyHardBudget float64                  `yaml:"monthly_hard_budget"`
+}
+
+type AIPriceConfig struct {
+	Prompt     float64 `yaml:"prompt"`
+	Completion float64 `yaml:"completion"`
+}
+
+// AIEmbeddingConfig provider 为空或 hash 时使用离线哈希向量，无需模型服务；openai（含兼容接口）、ollama 调用对应的 embeddings 接口
+type AIEmbeddingConfig struct {
+	Provider     string        `yaml:"provider"`
+	BaseURL      string        `yaml:"base_url"`
+	APIKey       string        `yaml:"api_key"`
+	Model        string        `yaml:"model"`
+	Dimensions   int           `yaml:"dimensions"` // hash 向量维度（默认 512）；openai text-embedding-3 可指定输出维度
+	Timeout      time.Duration `yaml:"timeout"`
+	ChunkSize    int           `yaml:"chunk_size"`    // 每块最多字符数，默认 500
+	ChunkOverlap int           `yaml:"chunk_overlap"` // 相邻块重叠字符数，默认 50
+	MinScore     float64       `yaml:"min_score"`     // 相似度下限，默认 0.1
+}
+
+// AIToolsConfig AI 回答时可调用的工单/转人工工具；permissions 为空时启用全部内置工具的默认权限
+type AIToolsConfig struct {
+	Enabled     bool                        `yaml:"enabled"`
+	MaxRounds   int                         `yaml:"max_rounds"` // 单次回答最多的工具调用轮数，默认 3
+	Permissions map[string]AIToolPermission `yaml:"permissions"`
+}
+
+// AIToolPermission 单个工具的权限；未在 permissions 中列出的工具不可用
+type AIToolPermission struct {
+	Enabled            bool     `yaml:"enabled"`
+	Platforms          []string `yaml:"platforms"`             // 允许的会话渠道（web、telegram 等），为空不限
+	MaxCallsPerSession int      `yaml:"max_calls_per_session"` // 每个会话的调用上限，0 不限
+}
+
+// AIMemoryConfig AI 回答携带的会话历史：超出 token_budget 的较早轮次以摘要代替
+type AIMemoryConfig struct {
+	TokenBudget int `yaml:"token_budget"` // 整个提示的 token 预算，默认 3000
+	MaxMessages int `yaml:"max_messages"` // 最多加载的历史消息数，默认 50
+}
+
+// LLMProviderConfig 单个模型后端；type 取值 openai（含兼容接口）、anthropic、ollama
+type LLMProviderConfig struct {
+	Name        string        `yaml:"name"`
+	Type        string        `yaml:"type"`
+	BaseURL     string        `yaml:"base_url"`
+	APIKey      string        `yaml:"api_key"`
+	Model       string        `yaml:"model"`
+	Temperature float64       `yaml:"temperature"`
+	MaxTokens   int           `yaml:"max_tokens"`
+	Timeout     time.Duration `yaml:"timeout"`
+	// 连续失败 max_failures 次后熔断 reset_timeout 时长，期间跳过该后端
+	MaxFailures  int           `yaml:"max_failures"`
+	ResetTimeout time.Duration `yaml:"reset_timeout"`
 }
 
 type OpenAIConfig struct {
@@ -205,6 +399,51 @@ type UploadConfig struct {
 	AutoIndex    bool     `yaml:"auto_index"`
 }
 
+// ChannelsConfig 外部渠道接入配置（Telegram、微信等）
+type ChannelsConfig struct {
+	Telegram TelegramConfig `yaml:"telegram"`
+	WeChat   WeChatConfig   `yaml:"wechat"`
+	Email    EmailConfig    `yaml:"email"`
+}
+
+// TelegramConfig Telegram Bot API 接入配置
+type TelegramConfig struct {
+	Enabled       bool          `yaml:"enabled"`
+	BotToken      string        `yaml:"bot_token"`
+	APIBaseURL    string        `yaml:"api_base_url"`   // 默认 https://api.telegram.org，可指向自建 Bot API 服务
+	Mode          string        `yaml:"mode"`           // polling, webhook
+	WebhookURL    string        `yaml:"webhook_url"`    // webhook 模式下向 Telegram 注册的公网地址（为空则不自动注册）
+	WebhookSecret string        `yaml:"webhook_secret"` // 校验 X-Telegram-Bot-Api-Secret-Token
+	PollTimeout   time.Duration `yaml:"poll_timeout"`   // getUpdates 长轮询超时
+}
+
+// WeChatConfig 微信公众号 / 企业微信回调接入配置
+type WeChatConfig struct {
+	Enabled        bool   `yaml:"enabled"`
+	Kind           string `yaml:"kind"`             // oa（公众号）, wecom（企业微信）
+	AppID          string `yaml:"app_id"`           // 企业微信填写 CorpID
+	AppSecret      string `yaml:"app_secret"`       // 企业微信填写应用 Secret
+	AgentID        int64  `yaml:"agent_id"`         // 企业微信应用 AgentId
+	Token          string `yaml:"token"`            // 回调签名 Token
+	EncodingAESKey string `yaml:"encoding_aes_key"` // 安全模式消息加解密密钥（企业微信必填）
+	APIBaseURL     string `yaml:"api_base_url"`     // 为空时按 kind 使用官方地址
+}
+
+// EmailConfig 邮件渠道配置：SMTP/LMTP 收信转工单，SMTP 发送回复
+type EmailConfig struct {
+	Enabled          bool   `yaml:"enabled"`
+	Address          string `yaml:"address"`            // 客服邮箱，例如 support@example.com
+	FromName         string `yaml:"from_name"`          // 发件人显示名
+	ReplyTokenSecret string `yaml:"reply_token_secret"` // 回复地址令牌签名密钥（support+t<id>.<sig>@domain）
+	ListenAddr       string `yaml:"listen_addr"`        // 收信监听地址，例如 :2525
+	ListenProtocol   string `yaml:"listen_protocol"`    // smtp, lmtp
+	MaxMessageSize   int64  `yaml:"max_message_size"`   // 单封邮件上限（字节）
+	SMTPHost         string `yaml:"smtp_host"`          // 发信 SMTP 服务器
+	SMTPPort         int    `yaml:"smtp_port"`
+	SMTPUsername     string `yaml:"smtp_username"`
+	SMTPPassword     string `yaml:"smtp_password"`
+}
+
 func Load() *Config {
 	var config Config
 	// Viper unmarshalling uses mapstructure tags by default; explicitly decode via our `yaml` tags
@@ -242,8 +481,17 @@ func GetDefaultConfig() *Config {
 			PoolSize:     10,
 			MinIdleConns: 5,
 		},
+		WebSocket: WebSocketConfig{
+			Backplane:       "memory",
+			PresenceTTL:     90 * time.Second,
+			VisitorTokenTTL: 30 * time.Minute,
+		},
 		WebRTC: WebRTCConfig{
 			STUNServer: "stun:stun.l.google.com:19302",
+			Recording: RecordingConfig{
+				Enabled:       false,
+				RetentionDays: 90,
+			},
 		},
 		AI: AIConfig{
 			OpenAI: OpenAIConfig{
@@ -253,6 +501,9 @@ func GetDefaultConfig() *Config {
 				MaxTokens:   1000,
 				Timeout:     30 * time.Second,
 			},
+			Memory: AIMemoryConfig{TokenBudget: 3000, MaxMessages: 50},
+			Tools:  AIToolsConfig{MaxRounds: 3},
+			Usage:  AIUsageConfig{Tenant: "default", Currency: "USD"},
 		},
 		WeKnora: WeKnoraConfig{
 			Enabled:         false,
@@ -347,5 +598,25 @@ func GetDefaultConfig() *Config {
 			AutoProcess:  true,
 			AutoIndex:    true,
 		},
+		Channels: ChannelsConfig{
+			Telegram: TelegramConfig{
+				Enabled:     false,
+				APIBaseURL:  "https://api.telegram.org",
+				Mode:        "polling",
+				PollTimeout: 30 * time.Second,
+			},
+			WeChat: WeChatConfig{
+				Enabled: false,
+				Kind:    "oa",
+			},
+			Email: EmailConfig{
+				Enabled:        false,
+				FromName:       "Servify Support",
+				ListenAddr:     ":2525",
+				ListenProtocol: "smtp",
+				MaxMessageSize: 25 << 20,
+				SMTPPort:       587,
+			},
+		},
 	}
 }
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"servify/apps/server/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// AIEvalHandler AI 回答离线评测：标准问题集、运行报告与对比
+type AIEvalHandler struct {
+	service *services.AIEvalService
+}
+
+func NewAIEvalHandler(service *services.AIEvalService) *AIEvalHandler {
+	return &AIEvalHandler{service: service}
+}
+
+// evalError 参数错误 400，不存在 404，重名或运行不可对比 409，评审模型不可用 503
+func evalError(c *gin.Context, msg string, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrAIEvalInvalid):
+		status = http.StatusBadRequest
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrAIEvalConflict):
+		status = http.StatusConflict
+	case errors.Is(err, services.ErrNoLLMProvider):
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, ErrorResponse{Error: msg, Message: err.Error()})
+}
+
+func evalID(c *gin.Context, v string) (uint, bool) {
+	id, err := strconv.ParseUint(v, 10, 32)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid id", Message: "invalid id: " + v})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func (h *AIEvalHandler) ListSets(c *gin.Context) {
+	rows, err := h.service.ListSets(c.Request.Context())
+	if err != nil {
+		evalError(c, "Failed to list eval sets", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": rows})
+}
+
+func (h *AIEvalHandler) GetSet(c *gin.Context) {
+	id, ok := evalID(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	row, err := h.service.GetSet(c.Request.Context(), id)
+	if err != nil {
+		evalError(c, "Failed to get eval set", err)
+		return
+	}
+	c.JSON(http.StatusOK, row)
+}
+
+func (h *AIEvalHandler) CreateSet(c *gin.Context) {
+	var req services.AIEvalSetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request", Message: err.Error()})
+		return
+	}
+	row, err := h.service.CreateSet(c.Request.Context(), &req)
+	if err != nil {
+		evalError(c, "Failed to create eval set", err)
+		return
+	}
+	c.JSON(http.StatusCreated, row)
+}
+
+// UpdateSet 整体替换用例；历史运行保留
+func (h *AIEvalHandler) UpdateSet(c *gin.Context) {
+	id, ok := evalID(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	var req services.AIEvalSetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request", Message: err.Error()})
+		return
+	}
+	row, err := h.service.UpdateSet(c.Request.Context(), id, &req)
+	if err != nil {
+		evalError(c, "Failed to update eval set", err)
+		return
+	}
+	c.JSON(http.StatusOK, row)
+}
+
+func (h *AIEvalHandler) DeleteSet(c *gin.Context) {
+	id, ok := evalID(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	if err := h.service.DeleteSet(c.Request.Context(), id); err != nil {
+		evalError(c, "Failed to delete eval set", err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// StartRun 后台执行问题集，立即返回运行记录（status=running），通过 GET /ai/eval/runs/:id 查看结果
+func (h *AIEvalHandler) StartRun(c *gin.Context) {
+	id, ok := evalID(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	var req services.AIEvalRunRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request", Message: err.Error()})
+			return
+		}
+	}
+	run, err := h.service.StartRun(c.Request.Context(), id, req)
+	if err != nil {
+		evalError(c, "Failed to start eval run", err)
+		return
+	}
+	h.service.ExecuteAsync(run.ID)
+	c.JSON(http.StatusAccepted, run)
+}
+
+// ListRuns 运行列表（?set_id=&limit=）
+func (h *AIEvalHandler) ListRuns(c *gin.Context) {
+	var setID uint
+	if v := c.Query("set_id"); v != "" {
+		id, ok := evalID(c, v)
+		if !ok {
+			return
+		}
+		setID = id
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	rows, err := h.service.ListRuns(c.Request.Context(), setID, limit)
+	if err != nil {
+		evalError(c, "Failed to list eval runs", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": rows})
+}
+
+func (h *AIEvalHandler) GetRun(c *gin.Context) {
+	id, ok := evalID(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	report, err := h.service.GetRun(c.Request.Context(), id)
+	if err != nil {
+		evalError(c, "Failed to get eval run", err)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// Compare 对比两次运行（?base=&head=）
+func (h *AIEvalHandler) Compare(c *gin.Context) {
+	base, ok := evalID(c, c.Query("base"))
+	if !ok {
+		return
+	}
+	head, ok := evalID(c, c.Query("head"))
+	if !ok {
+		return
+	}
+	cmp, err := h.service.Compare(c.Request.Context(), base, head)
+	if err != nil {
+		evalError(c, "Failed to compare eval runs", err)
+		return
+	}
+	c.JSON(http.StatusOK, cmp)
+}
+
+// RegisterAIEvalRoutes 注册离线评测路由
+func RegisterAIEvalRoutes(r *gin.RouterGroup, handler *AIEvalHandler) {
+	eval := r.Group("/ai/eval")
+	{
+		eval.GET("/sets", handler.ListSets)
+		eval.POST("/sets", handler.CreateSet)
+		eval.GET("/sets/:id", handler.GetSet)
+		eval.PUT("/sets/:id", handler.UpdateSet)
+		eval.DELETE("/sets/:id", handler.DeleteSet)
+		eval.POST("/sets/:id/runs", handler.StartRun)
+		eval.GET("/runs", handler.ListRuns)
+		eval.GET("/runs/compare", handler.Compare)
+		eval.GET("/runs/:id", handler.GetRun)
+	}
+}
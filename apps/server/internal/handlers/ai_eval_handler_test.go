@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"servify/apps/server/internal/models"
+	"servify/apps/server/internal/services"
+)
+
+func TestAIEvalHandler_SetsRunsCompare(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open("file:ai_eval_handler_"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.AIEvalSet{}, &models.AIEvalCase{}, &models.AIEvalRun{}, &models.AIEvalResult{}, &models.PromptTemplate{}, &models.KnowledgeDoc{}); err != nil {
+		t.Fatalf("auto migrate: %v", err)
+	}
+	svc := services.NewAIEvalService(db, stubAIForTransferHandler{}, nil, services.AIEvalConfig{}, nil)
+	r := gin.New()
+	RegisterAIEvalRoutes(r.Group("/api"), NewAIEvalHandler(svc))
+
+	w := doJSON(r, http.MethodPost, "/api/ai/eval/sets", `{"name":"smoke","cases":[{"question":"hi","keywords":["ok"]},{"question":"bye","pattern":"^nope$"}]}`)
+	var set models.AIEvalSet
+	_ = json.Unmarshal(w.Body.Bytes(), &set)
+	if w.Code != http.StatusCreated || len(set.Cases) != 2 {
+		t.Fatalf("create status=%d body=%s", w.Code, w.Body.String())
+	}
+	if w := doJSON(r, http.MethodPost, "/api/ai/eval/sets", `{"name":"smoke","cases":[{"question":"x","keywords":["y"]}]}`); w.Code != http.StatusConflict {
+		t.Fatalf("duplicate status=%d", w.Code)
+	}
+	if w := doJSON(r, http.MethodPost, "/api/ai/eval/sets", `{"name":"bad","cases":[]}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("invalid status=%d", w.Code)
+	}
+	if w := doJSON(r, http.MethodPost, "/api/ai/eval/sets/99/runs", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("missing set status=%d", w.Code)
+	}
+	if w := doJSON(r, http.MethodPost, fmt.Sprintf("/api/ai/eval/sets/%d/runs", set.ID), `{"judge":true}`); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("judge without LLM status=%d", w.Code)
+	}
+
+	// 运行在后台执行，轮询报告
+	runs := make([]uint, 0, 2)
+	for i := 0; i < 2; i++ {
+		w := doJSON(r, http.MethodPost, fmt.Sprintf("/api/ai/eval/sets/%d/runs", set.ID), `{"label":"v1"}`)
+		var run models.AIEvalRun
+		_ = json.Unmarshal(w.Body.Bytes(), &run)
+		if w.Code != http.StatusAccepted || run.Status != "running" {
+			t.Fatalf("start status=%d body=%s", w.Code, w.Body.String())
+		}
+		deadline := time.Now().Add(2 * time.Second)
+		var report services.AIEvalReport
+		for {
+			w := doJSON(r, http.MethodGet, fmt.Sprintf("/api/ai/eval/runs/%d", run.ID), "")
+			_ = json.Unmarshal(w.Body.Bytes(), &report)
+			if report.Run != nil && report.Run.Status != "running" {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("run %d did not finish: %s", run.ID, w.Body.String())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if report.Run.Status != "completed" || report.Run.PassedCount != 1 || len(report.Results) != 2 {
+			t.Fatalf("report = %+v", report)
+		}
+		runs = append(runs, run.ID)
+	}
+
+	w = doJSON(r, http.MethodGet, fmt.Sprintf("/api/ai/eval/runs?set_id=%d", set.ID), "")
+	var list struct {
+		Data []models.AIEvalRun `json:"data"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &list)
+	if w.Code != http.StatusOK || len(list.Data) != 2 || list.Data[0].ID != runs[1] {
+		t.Fatalf("list status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	w = doJSON(r, http.MethodGet, fmt.Sprintf("/api/ai/eval/runs/compare?base=%d&head=%d", runs[0], runs[1]), "")
+	var cmp services.AIEvalComparison
+	_ = json.Unmarshal(w.Body.Bytes(), &cmp)
+	if w.Code != http.StatusOK || cmp.ScoreDelta != 0 || len(cmp.Cases) != 2 || cmp.Regressed != 0 {
+		t.Fatalf("compare status=%d body=%s", w.Code, w.Body.String())
+	}
+	if w := doJSON(r, http.MethodGet, "/api/ai/eval/runs/compare?base=abc&head=1", ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("bad compare status=%d", w.Code)
+	}
+
+	if w := doJSON(r, http.MethodDelete, fmt.Sprintf("/api/ai/eval/sets/%d", set.ID), ""); w.Code != http.StatusNoContent {
+		t.Fatalf("delete status=%d", w.Code)
+	}
+	if w := doJSON(r, http.MethodGet, fmt.Sprintf("/api/ai/eval/runs/%d", runs[0]), ""); w.Code != http.StatusOK {
+		t.Fatalf("run kept after delete status=%d", w.Code)
+	}
+}
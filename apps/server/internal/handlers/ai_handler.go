@@ -15,6 +15,7 @@ import (
 	"gorm.io/gorm"
 	"servify/apps/server/internal/config"
 	svrmetrics "servify/apps/server/internal/metrics"
+	"servify/apps/server/internal/middleware"
 	"servify/apps/server/internal/services"
 	"servify/apps/server/internal/version"
 
@@ -24,8 +25,9 @@ import (
 
 // AIHandler AI 服务处理器
 type AIHandler struct {
-	aiService services.AIServiceInterface
-	logger    *logrus.Logger
+	aiService   services.AIServiceInterface
+	logger      *logrus.Logger
+	tokenSecret string // 校验访客令牌（jwt.secret）；为空时忽略请求中的 session_id
 }
 
 // NewAIHandler 创建 AI 处理器
@@ -36,10 +38,16 @@ func NewAIHandler(aiService services.AIServiceInterface) *AIHandler {
 	}
 }
 
+// SetTokenSecret 设置访客令牌密钥：查询接口公开可达，仅当请求携带绑定该会话的访客令牌时才使用 session_id
+func (h *AIHandler) SetTokenSecret(secret string) {
+	h.tokenSecret = secret
+}
+
 // QueryRequest 查询请求
 type QueryRequest struct {
 	Query     string `json:"query" binding:"required"`
 	SessionID string `json:"session_id"`
+	Stream    bool   `json:"stream"` // 为 true（或 Accept: text/event-stream）时以 SSE 流式返回
 }
 
 // QueryResponse 查询响应
@@ -66,6 +74,17 @@ func (h *AIHandler) ProcessQuery(c *gin.Context) {
 		return
 	}
 
+	// 未经访客令牌证明的 session_id 不得用于载入会话历史或调用工具
+	req.SessionID = h.visitorSessionID(c, req.SessionID)
+	if req.SessionID != "" {
+		c.Request = c.Request.WithContext(services.WithAuthenticatedSession(c.Request.Context(), req.SessionID))
+	}
+
+	if req.Stream || strings.Contains(c.GetHeader("Accept"), "text/event-stream") {
+		h.streamQuery(c, &req, start)
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
 	defer cancel()
 
@@ -112,6 +131,67 @@ func (h *AIHandler) ProcessQuery(c *gin.Context) {
 	}
 }
 
+// streamQuery 以 SSE 返回：生成过程中逐条发送 delta 事件，结束时发送 done（与非流式响应结构相同）或 error；
+// 客户端断开连接即取消生成
+// visitorSessionID 请求携带的访客令牌（Authorization: Bearer）绑定 sessionID 时返回该会话，否则返回空（不关联会话）
+func (h *AIHandler) visitorSessionID(c *gin.Context, sessionID string) string {
+	if sessionID == "" {
+		return ""
+	}
+	principal, err := middleware.ParseToken(bearerToken(c), h.tokenSecret)
+	if err != nil || !principal.Visitor || principal.SessionID != sessionID {
+		return ""
+	}
+	return sessionID
+}
+
+func (h *AIHandler) streamQuery(c *gin.Context, req *QueryRequest, start time.Time) {
+	streamer, ok := h.aiService.(services.StreamingAIService)
+	if !ok {
+		c.JSON(http.StatusNotImplemented, QueryResponse{
+			Success:   false,
+			Error:     "streaming not supported by AI service",
+			Timestamp: time.Now(),
+			Duration:  time.Since(start).String(),
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 60*time.Second)
+	defer cancel()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	index := 0
+	response, err := streamer.ProcessQueryStream(ctx, req.Query, req.SessionID, func(delta string) {
+		c.SSEvent("delta", gin.H{"index": index, "delta": delta})
+		c.Writer.Flush()
+		index++
+	})
+	if err != nil {
+		h.logger.Errorf("AI stream query failed: %v", err)
+		c.SSEvent("error", QueryResponse{
+			Success:   false,
+			Error:     "AI processing failed: " + err.Error(),
+			Timestamp: time.Now(),
+			Duration:  time.Since(start).String(),
+		})
+		c.Writer.Flush()
+		return
+	}
+	c.SSEvent("done", QueryResponse{
+		Success:   true,
+		Data:      response,
+		Timestamp: time.Now(),
+		Duration:  time.Since(start).String(),
+	})
+	c.Writer.Flush()
+}
+
 // GetStatus 获取 AI 服务状态
 func (h *AIHandler) GetStatus(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
@@ -313,13 +393,15 @@ func (h *MetricsHandler) GetMetrics(c *gin.Context) {
 		webrtcConns = h.webrtcService.GetConnectionCount()
 	}
 
-	var aiQueries, aiWeKnora, aiFallback int64
+	var aiQueries, aiWeKnora, aiFallback, aiPromptTokens, aiCompletionTokens int64
 	var aiAvgLatency float64
 	if enh, ok := h.aiService.(services.EnhancedAIServiceInterface); ok && enh.GetMetrics() != nil {
 		m := enh.GetMetrics()
 		aiQueries = m.QueryCount
 		aiWeKnora = m.WeKnoraUsageCount
 		aiFallback = m.FallbackUsageCount
+		aiPromptTokens = m.PromptTokens
+		aiCompletionTokens = m.CompletionTokens
 		aiAvgLatency = m.AverageLatency.Seconds()
 	}
 
@@ -357,6 +439,11 @@ func (h *MetricsHandler) GetMetrics(c *gin.Context) {
 	fmt.Fprintf(b, "# TYPE servify_ai_fallback_usage_total counter\n")
 	fmt.Fprintf(b, "servify_ai_fallback_usage_total %d\n\n", aiFallback)
 
+	fmt.Fprintf(b, "# HELP servify_ai_tokens_total Total LLM tokens used by AI answers\n")
+	fmt.Fprintf(b, "# TYPE servify_ai_tokens_total counter\n")
+	fmt.Fprintf(b, "servify_ai_tokens_total{type=\"prompt\"} %d\n", aiPromptTokens)
+	fmt.Fprintf(b, "servify_ai_tokens_total{type=\"completion\"} %d\n\n", aiCompletionTokens)
+
 	fmt.Fprintf(b, "# HELP servify_ai_avg_latency_seconds Average AI processing latency seconds\n")
 	fmt.Fprintf(b, "# TYPE servify_ai_avg_latency_seconds gauge\n")
 	fmt.Fprintf(b, "servify_ai_avg_latency_seconds %.3f\n\n", aiAvgLatency)
@@ -2,12 +2,17 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"servify/apps/server/internal/middleware"
 	"servify/apps/server/internal/services"
 )
 
@@ -40,3 +45,80 @@ func TestAIHandler_Status_And_Query(t *testing.T) {
 		t.Fatalf("query status code: %d, body=%s", w2.Code, w2.Body.String())
 	}
 }
+
+func TestAIHandler_QueryStream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, part := range []string{"您好", "，请问"} {
+			fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", part)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer upstream.Close()
+	r := gin.New()
+	r.POST("/api/v1/ai/query", NewAIHandler(services.NewAIService("k", upstream.URL)).ProcessQuery)
+
+	buf, _ := json.Marshal(map[string]interface{}{"query": "hi", "stream": true})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/v1/ai/query", bytes.NewReader(buf))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	body := w.Body.String()
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream") {
+		t.Fatalf("code=%d content-type=%s", w.Code, w.Header().Get("Content-Type"))
+	}
+	if strings.Count(body, "event:delta") != 2 || !strings.Contains(body, "event:done") || !strings.Contains(body, "您好，请问") {
+		t.Fatalf("unexpected stream: %s", body)
+	}
+}
+
+// sessionRecordingAI 记录查询收到的 session_id
+type sessionRecordingAI struct {
+	stubAIForTransferHandler
+	sessionID string
+}
+
+func (s *sessionRecordingAI) ProcessQuery(ctx context.Context, query string, sessionID string) (*services.AIResponse, error) {
+	s.sessionID = sessionID
+	return &services.AIResponse{Content: "ok", Confidence: 1, Source: "ai"}, nil
+}
+
+func TestAIHandler_QuerySessionRequiresVisitorToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ai := &sessionRecordingAI{}
+	h := NewAIHandler(ai)
+	h.SetTokenSecret("secret")
+	r := gin.New()
+	r.POST("/api/v1/ai/query", h.ProcessQuery)
+
+	own, _, _ := middleware.IssueVisitorToken("secret", "web_a", time.Minute)
+	forged, _, _ := middleware.IssueVisitorToken("other", "web_b", time.Minute)
+	cases := []struct {
+		name, token, want string
+	}{
+		{"no token", "", ""},
+		{"token for another session", own, ""},
+		{"token with wrong signature", forged, ""},
+		{"token for this session", own, "web_a"},
+	}
+	for _, tc := range cases {
+		session := "web_b"
+		if tc.want != "" {
+			session = tc.want
+		}
+		ai.sessionID = "unset"
+		buf, _ := json.Marshal(map[string]string{"query": "hi", "session_id": session})
+		req, _ := http.NewRequest("POST", "/api/v1/ai/query", bytes.NewReader(buf))
+		req.Header.Set("Content-Type", "application/json")
+		if tc.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK || ai.sessionID != tc.want {
+			t.Fatalf("%s: code=%d session=%q want %q", tc.name, w.Code, ai.sessionID, tc.want)
+		}
+	}
+}
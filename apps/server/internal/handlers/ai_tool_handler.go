@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"net/http"
+
+	"servify/apps/server/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AIToolHandler AI 工具调用记录查询
+type AIToolHandler struct {
+	service *services.AIToolService
+}
+
+func NewAIToolHandler(service *services.AIToolService) *AIToolHandler {
+	return &AIToolHandler{service: service}
+}
+
+// ListBySession 会话内 AI 发起的工具调用（含被拒绝与参数不合法的调用），与会话消息对照审阅
+func (h *AIToolHandler) ListBySession(c *gin.Context) {
+	rows, err := h.service.ListInvocations(c.Request.Context(), c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list AI tool calls", Message: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, rows)
+}
+
+// RegisterAIToolRoutes 注册 AI 工具调用记录路由
+func RegisterAIToolRoutes(r *gin.RouterGroup, handler *AIToolHandler) {
+	tools := r.Group("/ai/tool-calls")
+	{
+		tools.GET("/:session_id", handler.ListBySession)
+	}
+}
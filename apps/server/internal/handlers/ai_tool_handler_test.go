@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"servify/apps/server/internal/models"
+	"servify/apps/server/internal/services"
+)
+
+func TestAIToolHandler_ListBySession(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open("file:ai_tool_handler_"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.AIToolInvocation{}, &models.Session{}, &models.User{}, &models.Ticket{}); err != nil {
+		t.Fatalf("auto migrate: %v", err)
+	}
+	db.Create(&models.Session{ID: "s1", Status: "active", Platform: "web"})
+	svc := services.NewAIToolService(db, services.NewTicketService(db, nil, nil), nil, services.AIToolConfig{}, nil)
+	// 匿名会话调用工单工具：被拒绝但仍有记录
+	svc.Execute(context.Background(), "s1", services.LLMToolCall{ID: "c1", Function: services.LLMFunctionCall{Name: services.AIToolListTickets, Arguments: "{}"}})
+
+	r := gin.New()
+	RegisterAIToolRoutes(r.Group("/api"), NewAIToolHandler(svc))
+	w := doJSON(r, http.MethodGet, "/api/ai/tool-calls/s1", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", w.Code, w.Body.String())
+	}
+	var rows []models.AIToolInvocation
+	_ = json.Unmarshal(w.Body.Bytes(), &rows)
+	if len(rows) != 1 || rows[0].Status != services.AIToolStatusDenied || rows[0].CallID != "c1" {
+		t.Fatalf("rows = %+v", rows)
+	}
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"servify/apps/server/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AIUsageHandler AI 用量、费用与预算
+type AIUsageHandler struct {
+	service *services.AIUsageService
+}
+
+func NewAIUsageHandler(service *services.AIUsageService) *AIUsageHandler {
+	return &AIUsageHandler{service: service}
+}
+
+// usageQuery 解析通用过滤参数：from、to（YYYY-MM-DD）、feature、session_id、ticket_id
+func usageQuery(c *gin.Context) (services.AIUsageQuery, bool) {
+	q := services.AIUsageQuery{
+		From:      c.Query("from"),
+		To:        c.Query("to"),
+		Feature:   c.Query("feature"),
+		SessionID: c.Query("session_id"),
+	}
+	if v := c.Query("ticket_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid query parameters", Message: "invalid ticket_id"})
+			return q, false
+		}
+		tid := uint(id)
+		q.TicketID = &tid
+	}
+	q.Limit, _ = strconv.Atoi(c.Query("limit"))
+	return q, true
+}
+
+// Records 用量明细及合计，可按会话或工单查看单次对话的花费
+func (h *AIUsageHandler) Records(c *gin.Context) {
+	q, ok := usageQuery(c)
+	if !ok {
+		return
+	}
+	rows, err := h.service.ListRecords(c.Request.Context(), q)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list AI usage", Message: err.Error()})
+		return
+	}
+	var prompt, completion int
+	var cost float64
+	for _, r := range rows {
+		prompt += r.PromptTokens
+		completion += r.CompletionTokens
+		cost += r.Cost
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"data":              rows,
+		"prompt_tokens":     prompt,
+		"completion_tokens": completion,
+		"cost":              cost,
+	})
+}
+
+// Daily 日用量报表（按日、功能、模型汇总）
+func (h *AIUsageHandler) Daily(c *gin.Context) {
+	q, ok := usageQuery(c)
+	if !ok {
+		return
+	}
+	rows, err := h.service.Daily(c.Request.Context(), q)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to aggregate AI usage", Message: err.Error()})
+		return
+	}
+	if rows == nil {
+		rows = []services.AIUsageDaily{}
+	}
+	c.JSON(http.StatusOK, gin.H{"data": rows})
+}
+
+// Budget 当月费用与软/硬预算状态
+func (h *AIUsageHandler) Budget(c *gin.Context) {
+	c.JSON(http.StatusOK, h.service.Budget(c.Request.Context()))
+}
+
+// RegisterAIUsageRoutes 注册 AI 用量路由
+func RegisterAIUsageRoutes(r *gin.RouterGroup, handler *AIUsageHandler) {
+	usage := r.Group("/ai/usage")
+	{
+		usage.GET("", handler.Records)
+		usage.GET("/daily", handler.Daily)
+		usage.GET("/budget", handler.Budget)
+	}
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"servify/apps/server/internal/models"
+	"servify/apps/server/internal/services"
+)
+
+func TestAIUsageHandler_RecordsDailyBudget(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open("file:ai_usage_handler_"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.AIUsageRecord{}); err != nil {
+		t.Fatalf("auto migrate: %v", err)
+	}
+	tid := uint(9)
+	db.Create(&models.AIUsageRecord{Tenant: "default", Feature: "answer", Model: "gpt-4o-mini", SessionID: "s1", PromptTokens: 100, CompletionTokens: 20, Cost: 0.5, Day: "2026-03-01"})
+	db.Create(&models.AIUsageRecord{Tenant: "default", Feature: "summary", Model: "gpt-4o-mini", SessionID: "s1", TicketID: &tid, PromptTokens: 50, CompletionTokens: 10, Cost: 0.25, Day: "2026-03-02"})
+	db.Create(&models.AIUsageRecord{Tenant: "default", Feature: "answer", Model: "gpt-4o-mini", SessionID: "s2", PromptTokens: 10, CompletionTokens: 1, Cost: 0.1, Day: "2026-03-02"})
+	svc := services.NewAIUsageService(db, services.AIUsageConfig{MonthlySoftBudget: 100}, nil)
+
+	r := gin.New()
+	RegisterAIUsageRoutes(r.Group("/api"), NewAIUsageHandler(svc))
+
+	w := doJSON(r, http.MethodGet, "/api/ai/usage?session_id=s1", "")
+	var records struct {
+		Data         []models.AIUsageRecord `json:"data"`
+		PromptTokens int                    `json:"prompt_tokens"`
+		Cost         float64                `json:"cost"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &records)
+	if w.Code != http.StatusOK || len(records.Data) != 2 || records.PromptTokens != 150 || records.Cost != 0.75 {
+		t.Fatalf("records status=%d body=%s", w.Code, w.Body.String())
+	}
+	if w := doJSON(r, http.MethodGet, "/api/ai/usage?ticket_id=abc", ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("bad ticket_id status=%d", w.Code)
+	}
+
+	w = doJSON(r, http.MethodGet, "/api/ai/usage/daily?from=2026-03-02&feature=answer", "")
+	var daily struct {
+		Data []services.AIUsageDaily `json:"data"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &daily)
+	if w.Code != http.StatusOK || len(daily.Data) != 1 || daily.Data[0].Day != "2026-03-02" || daily.Data[0].Requests != 1 {
+		t.Fatalf("daily status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	w = doJSON(r, http.MethodGet, "/api/ai/usage/budget", "")
+	var budget services.AIBudgetStatus
+	_ = json.Unmarshal(w.Body.Bytes(), &budget)
+	if w.Code != http.StatusOK || budget.State != services.AIBudgetOK || budget.SoftBudget != 100 || budget.Currency != "USD" {
+		t.Fatalf("budget status=%d body=%s", w.Code, w.Body.String())
+	}
+}
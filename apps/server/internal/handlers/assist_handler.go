@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"servify/apps/server/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// AssistHandler 坐席 AI 辅助：回复草稿、改写与采纳反馈
+type AssistHandler struct {
+	service *services.AssistService
+}
+
+func NewAssistHandler(service *services.AssistService) *AssistHandler {
+	return &AssistHandler{service: service}
+}
+
+func currentAgentID(c *gin.Context) uint {
+	if v, ok := c.Get("user_id"); ok {
+		if id, ok := v.(uint); ok {
+			return id
+		}
+	}
+	return 0
+}
+
+// assistError 参数错误 400，工单/草稿不存在 404，重复反馈 409，模型不可用或预算用尽 503
+func assistError(c *gin.Context, msg string, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrAssistInvalid):
+		status = http.StatusBadRequest
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrAIDraftResolved):
+		status = http.StatusConflict
+	case errors.Is(err, services.ErrNoLLMProvider), errors.Is(err, services.ErrAIBudgetExceeded):
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, ErrorResponse{Error: msg, Message: err.Error()})
+}
+
+// Draft 为工单或会话生成带引用的回复草稿
+func (h *AssistHandler) Draft(c *gin.Context) {
+	var req services.AssistDraftRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request", Message: err.Error()})
+		return
+	}
+	res, err := h.service.Draft(c.Request.Context(), &req, currentAgentID(c))
+	if err != nil {
+		assistError(c, "Failed to draft reply", err)
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// Rewrite 改写坐席文本（formal、shorter、translate、fix_tone）
+func (h *AssistHandler) Rewrite(c *gin.Context) {
+	var req services.AssistRewriteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request", Message: err.Error()})
+		return
+	}
+	res, err := h.service.Rewrite(c.Request.Context(), &req, currentAgentID(c))
+	if err != nil {
+		assistError(c, "Failed to rewrite", err)
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// Feedback 记录草稿是否采纳及实际发送的文本
+func (h *AssistHandler) Feedback(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid id", Message: err.Error()})
+		return
+	}
+	var req services.AssistFeedbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request", Message: err.Error()})
+		return
+	}
+	row, err := h.service.Feedback(c.Request.Context(), uint(id), &req)
+	if err != nil {
+		assistError(c, "Failed to record draft feedback", err)
+		return
+	}
+	c.JSON(http.StatusOK, row)
+}
+
+// ListDrafts 草稿记录（?ticket_id=&session_id=&limit=）
+func (h *AssistHandler) ListDrafts(c *gin.Context) {
+	var ticketID *uint
+	if v := c.Query("ticket_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid query parameters", Message: "invalid ticket_id"})
+			return
+		}
+		tid := uint(id)
+		ticketID = &tid
+	}
+	rows, err := h.service.ListDrafts(c.Request.Context(), ticketID, c.Query("session_id"), parseIntDefault(c.Query("limit"), 50))
+	if err != nil {
+		assistError(c, "Failed to list drafts", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": rows})
+}
+
+// Stats 草稿与改写的采纳率和平均编辑距离（?from=&to=，YYYY-MM-DD，to 含当天）
+func (h *AssistHandler) Stats(c *gin.Context) {
+	var from, to *time.Time
+	if v := c.Query("from"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid query parameters", Message: "invalid from"})
+			return
+		}
+		from = &t
+	}
+	if v := c.Query("to"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid query parameters", Message: "invalid to"})
+			return
+		}
+		t = t.AddDate(0, 0, 1)
+		to = &t
+	}
+	stats, err := h.service.Stats(c.Request.Context(), from, to)
+	if err != nil {
+		assistError(c, "Failed to aggregate drafts", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": stats})
+}
+
+// RegisterAssistRoutes 注册 AI 辅助路由（与 /assist/suggest 同组）
+func RegisterAssistRoutes(r *gin.RouterGroup, handler *AssistHandler) {
+	assist := r.Group("/assist")
+	{
+		assist.POST("/draft", handler.Draft)
+		assist.POST("/rewrite", handler.Rewrite)
+		assist.GET("/drafts", handler.ListDrafts)
+		assist.GET("/drafts/stats", handler.Stats)
+		assist.POST("/drafts/:id/feedback", handler.Feedback)
+	}
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"servify/apps/server/internal/models"
+	"servify/apps/server/internal/services"
+)
+
+func TestAssistHandler_DraftRewriteFeedback(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open("file:assist_handler_"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Ticket{}, &models.TicketComment{}, &models.Message{}, &models.KnowledgeDoc{}, &models.AIDraft{}); err != nil {
+		t.Fatalf("auto migrate: %v", err)
+	}
+	db.Create(&models.Ticket{ID: 1, Title: "无法登录", Description: "登录报错", CustomerID: 7, Status: "open"})
+	db.Create(&models.AIDraft{Kind: services.AIDraftKindDraft, AgentID: 3, Text: "请清除缓存后重试 [1]", Status: services.AIDraftPending})
+	db.Create(&models.AIDraft{Kind: services.AIDraftKindRewrite, Operation: services.AssistRewriteShorter, AgentID: 3, Text: "请重试", Status: services.AIDraftPending})
+
+	// 未配置模型：草稿返回 503
+	svc := services.NewAssistService(db, services.NewAIService("", ""), services.NewSuggestionService(db), nil)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user_id", uint(3)); c.Next() })
+	RegisterAssistRoutes(r.Group("/api"), NewAssistHandler(svc))
+
+	if w := doJSON(r, http.MethodPost, "/api/assist/draft", `{"ticket_id":1}`); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("draft status=%d body=%s", w.Code, w.Body.String())
+	}
+	if w := doJSON(r, http.MethodPost, "/api/assist/rewrite", `{"text":"hi","operation":"poem"}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("unknown op status=%d body=%s", w.Code, w.Body.String())
+	}
+	if w := doJSON(r, http.MethodPost, "/api/assist/rewrite", `{"operation":"formal"}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("missing text status=%d", w.Code)
+	}
+
+	w := doJSON(r, http.MethodPost, "/api/assist/drafts/1/feedback", `{"accepted":true,"final_text":"请清除浏览器缓存后重试"}`)
+	var row models.AIDraft
+	_ = json.Unmarshal(w.Body.Bytes(), &row)
+	if w.Code != http.StatusOK || row.Status != services.AIDraftAccepted || row.EditDistance == nil || *row.EditDistance != 3 {
+		t.Fatalf("feedback status=%d body=%s", w.Code, w.Body.String())
+	}
+	if w := doJSON(r, http.MethodPost, "/api/assist/drafts/1/feedback", `{"accepted":false}`); w.Code != http.StatusConflict {
+		t.Fatalf("second feedback status=%d", w.Code)
+	}
+	if w := doJSON(r, http.MethodPost, "/api/assist/drafts/99/feedback", `{"accepted":false}`); w.Code != http.StatusNotFound {
+		t.Fatalf("missing draft status=%d", w.Code)
+	}
+	if w := doJSON(r, http.MethodPost, "/api/assist/drafts/2/feedback", `{"accepted":false}`); w.Code != http.StatusOK {
+		t.Fatalf("reject status=%d", w.Code)
+	}
+
+	w = doJSON(r, http.MethodGet, "/api/assist/drafts/stats", "")
+	var stats struct {
+		Data []services.AssistStats `json:"data"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &stats)
+	if w.Code != http.StatusOK || len(stats.Data) != 2 {
+		t.Fatalf("stats status=%d body=%s", w.Code, w.Body.String())
+	}
+	for _, s := range stats.Data {
+		if (s.Kind == services.AIDraftKindDraft && s.AcceptanceRate != 1) || (s.Kind == services.AIDraftKindRewrite && (s.Rejected != 1 || s.AcceptanceRate != 0)) {
+			t.Fatalf("stats = %+v", stats.Data)
+		}
+	}
+	if w := doJSON(r, http.MethodGet, "/api/assist/drafts/stats?from=03-01", ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("bad from status=%d", w.Code)
+	}
+
+	w = doJSON(r, http.MethodGet, "/api/assist/drafts?limit=1", "")
+	var list struct {
+		Data []models.AIDraft `json:"data"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &list)
+	if w.Code != http.StatusOK || len(list.Data) != 1 {
+		t.Fatalf("list status=%d body=%s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"servify/apps/server/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CoBrowseHandler 协同浏览控制状态与审计查询
+type CoBrowseHandler struct {
+	service *services.CoBrowseService
+}
+
+func NewCoBrowseHandler(service *services.CoBrowseService) *CoBrowseHandler {
+	return &CoBrowseHandler{service: service}
+}
+
+// GetControl 会话当前控制权持有坐席
+func (h *CoBrowseHandler) GetControl(c *gin.Context) {
+	sessionID := c.Param("id")
+	holder, err := h.service.ControlHolder(c.Request.Context(), sessionID)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if err.Error() == "session not found" {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, ErrorResponse{Error: "Failed to get control state", Message: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"session_id": sessionID, "control_holder": holder})
+}
+
+// ListEvents 会话的协同浏览审计记录
+func (h *CoBrowseHandler) ListEvents(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "200"))
+	events, err := h.service.ListEvents(c.Request.Context(), c.Param("id"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list events", Message: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, events)
+}
+
+// RegisterCoBrowseRoutes 注册协同浏览路由
+func RegisterCoBrowseRoutes(r *gin.RouterGroup, handler *CoBrowseHandler) {
+	sessions := r.Group("/cobrowse/sessions")
+	{
+		sessions.GET("/:id/control", handler.GetControl)
+		sessions.GET("/:id/events", handler.ListEvents)
+	}
+}
@@ -1,29 +1,113 @@
 package handlers
 
 import (
+	"net/http"
+	"strings"
+	"time"
+
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
-	"net/http"
+	"servify/apps/server/internal/config"
+	"servify/apps/server/internal/middleware"
 	"servify/apps/server/internal/services"
 )
 
 type WebSocketHandler struct {
-	wsHub *services.WebSocketHub
+	wsHub      *services.WebSocketHub
+	secret     string
+	visitorTTL time.Duration
 }
 
-func NewWebSocketHandler(wsHub *services.WebSocketHub) *WebSocketHandler {
-	return &WebSocketHandler{
-		wsHub: wsHub,
+func NewWebSocketHandler(wsHub *services.WebSocketHub, cfg *config.Config) *WebSocketHandler {
+	h := &WebSocketHandler{
+		wsHub:      wsHub,
+		visitorTTL: 30 * time.Minute,
+	}
+	if cfg != nil {
+		h.secret = cfg.JWT.Secret
+		if cfg.WebSocket.VisitorTokenTTL > 0 {
+			h.visitorTTL = cfg.WebSocket.VisitorTokenTTL
+		}
 	}
+	return h
 }
 
+// HandleWebSocket 鉴权后建立连接
+// 令牌通过 Authorization: Bearer 或 ?token= 传入（浏览器 WebSocket 无法自定义请求头）：
+// - 坐席/管理员使用 API 的 JWT，可通过 session_id 加入指定会话
+// - 访客使用 /ws/visitor-token 签发的令牌，只能进入令牌绑定的会话
 func (h *WebSocketHandler) HandleWebSocket(c *gin.Context) {
-	h.wsHub.HandleWebSocket(c)
+	token := c.Query("token")
+	if token == "" {
+		token = bearerToken(c)
+	}
+	principal, err := middleware.ParseToken(token, h.secret)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Unauthorized", Message: err.Error()})
+		return
+	}
+
+	sessionID := c.Query("session_id")
+	var identity services.WebSocketIdentity
+	switch {
+	case principal.Visitor:
+		if sessionID != "" && sessionID != principal.SessionID {
+			c.JSON(http.StatusForbidden, ErrorResponse{Error: "Forbidden", Message: "token is not valid for this session"})
+			return
+		}
+		identity = services.WebSocketIdentity{Role: services.WSRoleVisitor, SessionID: principal.SessionID}
+	case principal.HasRole("admin", "agent"):
+		identity = services.WebSocketIdentity{Role: services.WSRoleAgent, UserID: principal.UserID, SessionID: sessionID}
+	default:
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "Forbidden", Message: "role not allowed to connect"})
+		return
+	}
+
+	h.wsHub.HandleWebSocket(c, identity)
+}
+
+// IssueVisitorToken 为访客签发 WebSocket 令牌
+// 携带仍有效的访客令牌时为同一会话续期，否则分配新的会话
+func (h *WebSocketHandler) IssueVisitorToken(c *gin.Context) {
+	sessionID := ""
+	if token := bearerToken(c); token != "" {
+		principal, err := middleware.ParseToken(token, h.secret)
+		if err != nil || !principal.Visitor {
+			c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Unauthorized", Message: "invalid visitor token"})
+			return
+		}
+		sessionID = principal.SessionID
+	}
+	if sessionID == "" {
+		sessionID = "web_" + uuid.NewString()
+	}
+
+	token, expiresAt, err := middleware.IssueVisitorToken(h.secret, sessionID, h.visitorTTL)
+	if err != nil {
+		logrus.Errorf("Failed to issue visitor token: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to issue visitor token", Message: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"token":      token,
+		"session_id": sessionID,
+		"expires_at": expiresAt,
+	})
+}
+
+func bearerToken(c *gin.Context) string {
+	ah := c.GetHeader("Authorization")
+	if !strings.HasPrefix(strings.ToLower(ah), "bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(ah[len("Bearer "):])
 }
 
 func (h *WebSocketHandler) GetStats(c *gin.Context) {
 	stats := map[string]interface{}{
 		"connected_clients": h.wsHub.GetClientCount(),
+		"node_id":           h.wsHub.NodeID(),
 		"status":            "running",
 	}
 
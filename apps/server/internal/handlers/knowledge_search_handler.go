@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"servify/apps/server/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// KnowledgeSearchHandler 知识库语义检索与索引维护
+type KnowledgeSearchHandler struct {
+	service *services.KnowledgeSearchService
+}
+
+func NewKnowledgeSearchHandler(service *services.KnowledgeSearchService) *KnowledgeSearchHandler {
+	return &KnowledgeSearchHandler{service: service}
+}
+
+// Search 语义检索（?q=&limit=），返回命中的切块及相似度
+func (h *KnowledgeSearchHandler) Search(c *gin.Context) {
+	q := c.Query("q")
+	if q == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid query parameters", Message: "q is required"})
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "5"))
+	if limit <= 0 || limit > 50 {
+		limit = 5
+	}
+	hits, err := h.service.Search(c.Request.Context(), q, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to search knowledge docs", Message: err.Error()})
+		return
+	}
+	if hits == nil {
+		hits = []services.KnowledgeHit{}
+	}
+	c.JSON(http.StatusOK, gin.H{"data": hits})
+}
+
+// Reindex 重建索引；?force=true 时重建全部文档，否则只处理缺失或过期的索引
+func (h *KnowledgeSearchHandler) Reindex(c *gin.Context) {
+	force := c.Query("force") == "true"
+	n, err := h.service.Sync(c.Request.Context(), force)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to reindex knowledge docs", Message: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"indexed": n, "status": h.service.Status(c.Request.Context())})
+}
+
+// RegisterKnowledgeSearchRoutes 注册知识库检索路由
+func RegisterKnowledgeSearchRoutes(r *gin.RouterGroup, handler *KnowledgeSearchHandler) {
+	docs := r.Group("/knowledge-docs")
+	{
+		docs.GET("/search", handler.Search)
+		docs.POST("/reindex", handler.Reindex)
+	}
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"servify/apps/server/internal/models"
+	"servify/apps/server/internal/services"
+)
+
+func TestKnowledgeSearchHandler_ReindexAndSearch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open("file:knowledge_search_handler_"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.KnowledgeDoc{}, &models.KnowledgeChunk{}); err != nil {
+		t.Fatalf("auto migrate: %v", err)
+	}
+	now := time.Now()
+	db.Create(&models.KnowledgeDoc{Title: "退款政策", Content: "购买后七天内可申请全额退款。", CreatedAt: now, UpdatedAt: now})
+	embedder, _ := services.NewEmbedder(services.EmbeddingConfig{})
+	svc := services.NewKnowledgeSearchService(db, embedder, services.KnowledgeSearchConfig{}, nil)
+
+	r := gin.New()
+	RegisterKnowledgeSearchRoutes(r.Group("/api"), NewKnowledgeSearchHandler(svc))
+
+	if w := doJSON(r, http.MethodGet, "/api/knowledge-docs/search", ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("missing q status=%d", w.Code)
+	}
+	w := doJSON(r, http.MethodPost, "/api/knowledge-docs/reindex", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("reindex status=%d body=%s", w.Code, w.Body.String())
+	}
+	var reindex struct {
+		Indexed int `json:"indexed"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &reindex)
+	if reindex.Indexed != 1 {
+		t.Fatalf("indexed = %d", reindex.Indexed)
+	}
+
+	w = doJSON(r, http.MethodGet, "/api/knowledge-docs/search?q=%E9%80%80%E6%AC%BE&limit=3", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("search status=%d body=%s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data []services.KnowledgeHit `json:"data"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	if len(resp.Data) != 1 || resp.Data[0].Title != "退款政策" {
+		t.Fatalf("hits = %+v", resp.Data)
+	}
+}
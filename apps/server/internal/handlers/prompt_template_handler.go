@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"servify/apps/server/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PromptTemplateHandler AI 提示词模板管理与预览
+type PromptTemplateHandler struct {
+	service   *services.PromptTemplateService
+	previewer services.PromptPreviewer
+}
+
+func NewPromptTemplateHandler(service *services.PromptTemplateService, previewer services.PromptPreviewer) *PromptTemplateHandler {
+	return &PromptTemplateHandler{service: service, previewer: previewer}
+}
+
+// List 模板版本列表（?name=&locale=）
+func (h *PromptTemplateHandler) List(c *gin.Context) {
+	rows, err := h.service.List(c.Request.Context(), c.Query("name"), c.Query("locale"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list prompt templates", Message: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, rows)
+}
+
+func (h *PromptTemplateHandler) Get(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid id", Message: err.Error()})
+		return
+	}
+	row, err := h.service.Get(c.Request.Context(), uint(id))
+	if err != nil {
+		h.notFoundOr500(c, "Failed to get prompt template", err)
+		return
+	}
+	c.JSON(http.StatusOK, row)
+}
+
+// Create 保存新版本；activate=true 时立即生效
+func (h *PromptTemplateHandler) Create(c *gin.Context) {
+	var req services.PromptTemplateCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request", Message: err.Error()})
+		return
+	}
+	userID, exists := c.Get("user_id")
+	if !exists {
+		userID = uint(0)
+	}
+	row, err := h.service.Create(c.Request.Context(), &req, userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Failed to create prompt template", Message: err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, row)
+}
+
+// Activate 激活版本（同名同语言的其他版本停用），亦用于回滚
+func (h *PromptTemplateHandler) Activate(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid id", Message: err.Error()})
+		return
+	}
+	row, err := h.service.Activate(c.Request.Context(), uint(id))
+	if err != nil {
+		h.notFoundOr500(c, "Failed to activate prompt template", err)
+		return
+	}
+	c.JSON(http.StatusOK, row)
+}
+
+func (h *PromptTemplateHandler) Deactivate(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid id", Message: err.Error()})
+		return
+	}
+	row, err := h.service.Deactivate(c.Request.Context(), uint(id))
+	if err != nil {
+		h.notFoundOr500(c, "Failed to deactivate prompt template", err)
+		return
+	}
+	c.JSON(http.StatusOK, row)
+}
+
+// Preview 以示例问题渲染提示词：可指定 name/locale，或以 content 预览未保存的草稿
+func (h *PromptTemplateHandler) Preview(c *gin.Context) {
+	var req services.PromptPreviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request", Message: err.Error()})
+		return
+	}
+	if h.previewer == nil {
+		c.JSON(http.StatusNotImplemented, ErrorResponse{Error: "Preview unavailable", Message: "AI service does not support prompt preview"})
+		return
+	}
+	preview, err := h.previewer.PreviewPrompt(c.Request.Context(), req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Failed to render prompt", Message: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, preview)
+}
+
+func (h *PromptTemplateHandler) notFoundOr500(c *gin.Context, msg string, err error) {
+	status := http.StatusInternalServerError
+	if err.Error() == "prompt template not found" {
+		status = http.StatusNotFound
+	}
+	c.JSON(status, ErrorResponse{Error: msg, Message: err.Error()})
+}
+
+// RegisterPromptTemplateRoutes 注册提示词模板路由
+func RegisterPromptTemplateRoutes(r *gin.RouterGroup, handler *PromptTemplateHandler) {
+	prompts := r.Group("/ai/prompts")
+	{
+		prompts.GET("", handler.List)
+		prompts.POST("", handler.Create)
+		prompts.POST("/preview", handler.Preview)
+		prompts.GET("/:id", handler.Get)
+		prompts.POST("/:id/activate", handler.Activate)
+		prompts.POST("/:id/deactivate", handler.Deactivate)
+	}
+}
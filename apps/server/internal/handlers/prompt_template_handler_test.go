@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"servify/apps/server/internal/models"
+	"servify/apps/server/internal/services"
+)
+
+func newPromptTemplateRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open("file:prompt_handler_"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.PromptTemplate{}, &models.Message{}); err != nil {
+		t.Fatalf("auto migrate: %v", err)
+	}
+	svc := services.NewPromptTemplateService(db, services.PromptTemplateConfig{BrandName: "Acme", DefaultLocale: "zh-CN", Locales: []string{"zh-CN", "en-US"}}, nil)
+	ai := services.NewAIService("", "")
+	ai.InitializeKnowledgeBase()
+	ai.SetPromptTemplates(svc)
+
+	r := gin.New()
+	RegisterPromptTemplateRoutes(r.Group("/api"), NewPromptTemplateHandler(svc, ai))
+	return r
+}
+
+func doJSON(r *gin.Engine, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestPromptTemplateHandler_CreateActivatePreview(t *testing.T) {
+	r := newPromptTemplateRouter(t)
+
+	w := doJSON(r, http.MethodPost, "/api/ai/prompts", `{"name":"answer","locale":"en-US","content":"{{.BrandName}} bot, answer in {{.Language}}","activate":true}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create status=%d body=%s", w.Code, w.Body.String())
+	}
+	var created models.PromptTemplate
+	_ = json.Unmarshal(w.Body.Bytes(), &created)
+	if !created.Active || created.Version != 1 {
+		t.Fatalf("created = %+v", created)
+	}
+
+	if w := doJSON(r, http.MethodPost, "/api/ai/prompts", `{"name":"answer","content":"{{.Missing"}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("invalid template status=%d", w.Code)
+	}
+
+	w = doJSON(r, http.MethodPost, "/api/ai/prompts/preview", `{"query":"What is remote assistance?"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("preview status=%d body=%s", w.Code, w.Body.String())
+	}
+	var preview services.PromptPreview
+	_ = json.Unmarshal(w.Body.Bytes(), &preview)
+	if preview.Prompt.Source != "stored" || preview.Prompt.Text != "Acme bot, answer in English" || preview.Prompt.Locale != "en-US" {
+		t.Fatalf("preview prompt = %+v", preview.Prompt)
+	}
+	if n := len(preview.Messages); n != 2 || preview.Messages[n-1].Content != "What is remote assistance?" {
+		t.Fatalf("preview messages = %+v", preview.Messages)
+	}
+
+	// 预览未保存的草稿：包含检索到的知识库文档
+	w = doJSON(r, http.MethodPost, "/api/ai/prompts/preview", `{"query":"远程协助","content":"{{range .Docs}}[{{.Title}}]{{end}} {{.Language}}"}`)
+	_ = json.Unmarshal(w.Body.Bytes(), &preview)
+	if preview.Prompt.Source != "draft" || !strings.Contains(preview.Prompt.Text, "[远程协助]") || !strings.HasSuffix(preview.Prompt.Text, "中文") {
+		t.Fatalf("draft preview = %+v", preview.Prompt)
+	}
+
+	if w := doJSON(r, http.MethodPost, fmt.Sprintf("/api/ai/prompts/%d/deactivate", created.ID), ``); w.Code != http.StatusOK {
+		t.Fatalf("deactivate status=%d", w.Code)
+	}
+	if w := doJSON(r, http.MethodPost, "/api/ai/prompts/999/activate", ``); w.Code != http.StatusNotFound {
+		t.Fatalf("activate missing status=%d", w.Code)
+	}
+}
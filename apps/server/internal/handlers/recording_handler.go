@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+
+	"servify/apps/server/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RecordingHandler 通话/屏幕共享录制查询与删除
+type RecordingHandler struct {
+	service *services.CallRecordingService
+}
+
+func NewRecordingHandler(service *services.CallRecordingService) *RecordingHandler {
+	return &RecordingHandler{service: service}
+}
+
+// ListRecordings 按 session_id 或 ticket_id 查询录制
+func (h *RecordingHandler) ListRecordings(c *gin.Context) {
+	sessionID := c.Query("session_id")
+	var ticketID uint64
+	if v := c.Query("ticket_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid ticket_id", Message: err.Error()})
+			return
+		}
+		ticketID = id
+	}
+	if sessionID == "" && ticketID == 0 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "session_id or ticket_id is required"})
+		return
+	}
+	list, err := h.service.ListRecordings(c.Request.Context(), sessionID, uint(ticketID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list recordings", Message: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// GetRecording 获取录制详情
+func (h *RecordingHandler) GetRecording(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid id", Message: err.Error()})
+		return
+	}
+	rec, err := h.service.GetRecording(c.Request.Context(), uint(id))
+	if err != nil {
+		c.JSON(recordingErrorStatus(err), ErrorResponse{Error: "Failed to get recording", Message: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, rec)
+}
+
+// DownloadRecording 下载录制文件（录制完成后可用）
+func (h *RecordingHandler) DownloadRecording(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid id", Message: err.Error()})
+		return
+	}
+	rec, err := h.service.GetRecording(c.Request.Context(), uint(id))
+	if err != nil {
+		c.JSON(recordingErrorStatus(err), ErrorResponse{Error: "Failed to get recording", Message: err.Error()})
+		return
+	}
+	if rec.Status != "completed" || rec.FilePath == "" {
+		c.JSON(http.StatusConflict, ErrorResponse{Error: "Recording not available", Message: "status " + rec.Status})
+		return
+	}
+	contentType := "audio/ogg"
+	if rec.Format == "webm" {
+		contentType = "video/webm"
+	}
+	c.Header("Content-Type", contentType)
+	c.FileAttachment(rec.FilePath, fmt.Sprintf("recording_%d%s", rec.ID, filepath.Ext(rec.FilePath)))
+}
+
+// DeleteRecording 删除录制文件
+func (h *RecordingHandler) DeleteRecording(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid id", Message: err.Error()})
+		return
+	}
+	if err := h.service.DeleteRecording(c.Request.Context(), uint(id)); err != nil {
+		c.JSON(recordingErrorStatus(err), ErrorResponse{Error: "Failed to delete recording", Message: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, SuccessResponse{Message: "deleted"})
+}
+
+func recordingErrorStatus(err error) int {
+	if err.Error() == "recording not found" {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// RegisterRecordingRoutes 注册录制路由
+func RegisterRecordingRoutes(r *gin.RouterGroup, handler *RecordingHandler) {
+	recordings := r.Group("/recordings")
+	{
+		recordings.GET("", handler.ListRecordings)
+		recordings.GET("/:id", handler.GetRecording)
+		recordings.GET("/:id/file", handler.DownloadRecording)
+		recordings.DELETE("/:id", handler.DeleteRecording)
+	}
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"servify/apps/server/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RouteRuleHandler 管理消息路由规则
+type RouteRuleHandler struct {
+	service *services.RouteRuleService
+}
+
+func NewRouteRuleHandler(service *services.RouteRuleService) *RouteRuleHandler {
+	return &RouteRuleHandler{service: service}
+}
+
+// ListRules 获取路由规则（按匹配顺序）
+func (h *RouteRuleHandler) ListRules(c *gin.Context) {
+	rules, err := h.service.ListRules(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list rules", Message: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, rules)
+}
+
+// CreateRule 创建路由规则
+func (h *RouteRuleHandler) CreateRule(c *gin.Context) {
+	var req services.RouteRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request", Message: err.Error()})
+		return
+	}
+	rule, err := h.service.CreateRule(c.Request.Context(), &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Failed to create rule", Message: err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, rule)
+}
+
+// UpdateRule 更新路由规则
+func (h *RouteRuleHandler) UpdateRule(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid id", Message: err.Error()})
+		return
+	}
+	var req services.RouteRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request", Message: err.Error()})
+		return
+	}
+	rule, err := h.service.UpdateRule(c.Request.Context(), uint(id), &req)
+	if err != nil {
+		status := http.StatusBadRequest
+		if err.Error() == "rule not found" {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, ErrorResponse{Error: "Failed to update rule", Message: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, rule)
+}
+
+// DeleteRule 删除路由规则
+func (h *RouteRuleHandler) DeleteRule(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid id", Message: err.Error()})
+		return
+	}
+	if err := h.service.DeleteRule(c.Request.Context(), uint(id)); err != nil {
+		status := http.StatusInternalServerError
+		if err.Error() == "rule not found" {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, ErrorResponse{Error: "Failed to delete rule", Message: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, SuccessResponse{Message: "deleted"})
+}
+
+// DryRun 用一条消息试运行规则集，返回命中的规则与动作
+func (h *RouteRuleHandler) DryRun(c *gin.Context) {
+	var req services.RouteDryRunRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request", Message: err.Error()})
+		return
+	}
+	decision, err := h.service.DryRun(c.Request.Context(), &req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to evaluate rules", Message: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, decision)
+}
+
+// RegisterRouteRuleRoutes 注册路由规则管理路由
+func RegisterRouteRuleRoutes(r *gin.RouterGroup, handler *RouteRuleHandler) {
+	rules := r.Group("/routing/rules")
+	{
+		rules.GET("", handler.ListRules)
+		rules.POST("", handler.CreateRule)
+		rules.PUT("/:id", handler.UpdateRule)
+		rules.DELETE("/:id", handler.DeleteRule)
+		rules.POST("/dry-run", handler.DryRun)
+	}
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"servify/apps/server/internal/models"
+	"servify/apps/server/internal/services"
+)
+
+func newRouteRuleTestRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open("file:route_rule_handler_"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Session{}, &models.Customer{}, &models.RouteRule{}); err != nil {
+		t.Fatalf("automigrate: %v", err)
+	}
+	r := gin.New()
+	RegisterRouteRuleRoutes(r.Group("/api"), NewRouteRuleHandler(services.NewRouteRuleService(db, nil)))
+	return r
+}
+
+func doRouteRuleRequest(r *gin.Engine, method, path string, body interface{}) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		_ = json.NewEncoder(&buf).Encode(body)
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRouteRuleHandler_CRUDAndDryRun(t *testing.T) {
+	r := newRouteRuleTestRouter(t)
+
+	w := doRouteRuleRequest(r, http.MethodPost, "/api/routing/rules", map[string]interface{}{
+		"name":       "billing-to-human",
+		"action":     "human",
+		"priority":   10,
+		"conditions": []map[string]interface{}{{"field": "intent", "op": "eq", "value": "billing"}},
+		"params":     map[string]interface{}{"skills": []string{"billing"}},
+	})
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var rule models.RouteRule
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &rule))
+
+	w = doRouteRuleRequest(r, http.MethodPost, "/api/routing/rules", map[string]interface{}{"name": "bad", "action": "nope"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doRouteRuleRequest(r, http.MethodGet, "/api/routing/rules", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var rules []models.RouteRule
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &rules))
+	assert.Len(t, rules, 1)
+
+	w = doRouteRuleRequest(r, http.MethodPost, "/api/routing/rules/dry-run", map[string]interface{}{"platform": "web", "content": "我要申请退款"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var decision services.RouteDecision
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &decision))
+	assert.Equal(t, "human", decision.Action)
+	if assert.NotNil(t, decision.Rule) {
+		assert.Equal(t, rule.ID, decision.Rule.ID)
+	}
+	assert.Equal(t, []string{"billing"}, decision.Params.Skills)
+
+	w = doRouteRuleRequest(r, http.MethodPut, fmt.Sprintf("/api/routing/rules/%d", rule.ID), map[string]interface{}{
+		"name": "billing-to-human", "action": "manual", "active": false,
+	})
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = doRouteRuleRequest(r, http.MethodPost, "/api/routing/rules/dry-run", map[string]interface{}{"platform": "web", "content": "我要申请退款"})
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &decision))
+	assert.Equal(t, "ai", decision.Action)
+
+	w = doRouteRuleRequest(r, http.MethodPut, "/api/routing/rules/999", map[string]interface{}{"name": "x", "action": "ai"})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = doRouteRuleRequest(r, http.MethodDelete, fmt.Sprintf("/api/routing/rules/%d", rule.ID), nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doRouteRuleRequest(r, http.MethodDelete, fmt.Sprintf("/api/routing/rules/%d", rule.ID), nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
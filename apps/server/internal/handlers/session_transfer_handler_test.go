@@ -24,7 +24,7 @@ type stubAIForTransferHandler struct{}
 func (s stubAIForTransferHandler) ProcessQuery(ctx context.Context, query string, sessionID string) (*services.AIResponse, error) {
 	return &services.AIResponse{Content: "ok", Confidence: 1, Source: "ai"}, nil
 }
-func (s stubAIForTransferHandler) ShouldTransferToHuman(query string, sessionHistory []models.Message) bool {
+func (s stubAIForTransferHandler) ShouldTransferToHuman(sessionID, query string, sessionHistory []models.Message) bool {
 	return false
 }
 func (s stubAIForTransferHandler) GetSessionSummary(messages []models.Message) (string, error) {
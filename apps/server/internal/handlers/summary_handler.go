@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"servify/apps/server/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// SummaryHandler 工单与会话的结构化摘要：查看、重新生成与导出
+type SummaryHandler struct {
+	service *services.SummaryService
+}
+
+func NewSummaryHandler(service *services.SummaryService) *SummaryHandler {
+	return &SummaryHandler{service: service}
+}
+
+// summaryError 不存在 404，无可摘要内容 422，模型不可用或预算用尽 503
+func summaryError(c *gin.Context, msg string, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrSummaryEmpty):
+		status = http.StatusUnprocessableEntity
+	case errors.Is(err, services.ErrNoLLMProvider), errors.Is(err, services.ErrAIBudgetExceeded):
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, ErrorResponse{Error: msg, Message: err.Error()})
+}
+
+// parseSummaryTime 接受 RFC3339 或 YYYY-MM-DD；日期形式的 to 含当天
+func parseSummaryTime(v string, endOfDay bool) (*time.Time, error) {
+	if v == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse("2006-01-02", v)
+	if err != nil {
+		return nil, err
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
+
+// List 导出摘要（?from=&to=&ticket_id=&session_id=&trigger=&limit=&offset=），按 id 升序
+func (h *SummaryHandler) List(c *gin.Context) {
+	q := services.SummaryQuery{
+		SessionID: c.Query("session_id"),
+		Trigger:   c.Query("trigger"),
+		Limit:     parseIntDefault(c.Query("limit"), 100),
+		Offset:    parseIntDefault(c.Query("offset"), 0),
+	}
+	var err error
+	if q.From, err = parseSummaryTime(c.Query("from"), false); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid query parameters", Message: "invalid from"})
+		return
+	}
+	if q.To, err = parseSummaryTime(c.Query("to"), true); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid query parameters", Message: "invalid to"})
+		return
+	}
+	if v := c.Query("ticket_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid query parameters", Message: "invalid ticket_id"})
+			return
+		}
+		tid := uint(id)
+		q.TicketID = &tid
+	}
+	rows, total, err := h.service.List(c.Request.Context(), q)
+	if err != nil {
+		summaryError(c, "Failed to list summaries", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": rows, "total": total})
+}
+
+// GetTicketSummary 工单最新的摘要
+func (h *SummaryHandler) GetTicketSummary(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid ticket ID", Message: "ID must be a valid number"})
+		return
+	}
+	tid := uint(id)
+	rec, err := h.service.Latest(c.Request.Context(), &tid, "")
+	if err != nil {
+		summaryError(c, "Failed to get ticket summary", err)
+		return
+	}
+	c.JSON(http.StatusOK, rec)
+}
+
+// RegenerateTicketSummary 重新生成工单摘要
+func (h *SummaryHandler) RegenerateTicketSummary(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid ticket ID", Message: "ID must be a valid number"})
+		return
+	}
+	rec, err := h.service.SummarizeTicket(c.Request.Context(), uint(id), services.SummaryTriggerManual)
+	if err != nil {
+		summaryError(c, "Failed to summarize ticket", err)
+		return
+	}
+	c.JSON(http.StatusOK, rec)
+}
+
+// GetSessionSummary 会话最新的摘要
+func (h *SummaryHandler) GetSessionSummary(c *gin.Context) {
+	rec, err := h.service.Latest(c.Request.Context(), nil, c.Param("id"))
+	if err != nil {
+		summaryError(c, "Failed to get session summary", err)
+		return
+	}
+	c.JSON(http.StatusOK, rec)
+}
+
+// RegenerateSessionSummary 重新生成会话摘要
+func (h *SummaryHandler) RegenerateSessionSummary(c *gin.Context) {
+	rec, err := h.service.SummarizeSession(c.Request.Context(), c.Param("id"), services.SummaryTriggerManual)
+	if err != nil {
+		summaryError(c, "Failed to summarize session", err)
+		return
+	}
+	c.JSON(http.StatusOK, rec)
+}
+
+// RegisterSummaryRoutes 注册摘要路由
+func RegisterSummaryRoutes(r *gin.RouterGroup, handler *SummaryHandler) {
+	summaries := r.Group("/summaries")
+	{
+		summaries.GET("", handler.List)
+		summaries.GET("/tickets/:id", handler.GetTicketSummary)
+		summaries.POST("/tickets/:id", handler.RegenerateTicketSummary)
+		summaries.GET("/sessions/:id", handler.GetSessionSummary)
+		summaries.POST("/sessions/:id", handler.RegenerateSessionSummary)
+	}
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"servify/apps/server/internal/models"
+	"servify/apps/server/internal/services"
+)
+
+func TestSummaryHandler_GetListRegenerate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open("file:summary_handler_"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Ticket{}, &models.TicketComment{}, &models.Session{}, &models.Message{}, &models.ConversationSummary{}); err != nil {
+		t.Fatalf("auto migrate: %v", err)
+	}
+	tid := uint(1)
+	db.Create(&models.Ticket{ID: 1, Title: "发票抬头错误", CustomerID: 7})
+	db.Create(&models.Session{ID: "s-empty", UserID: 7})
+	db.Create(&models.ConversationSummary{TicketID: &tid, Trigger: services.SummaryTriggerResolved, Problem: "发票抬头错误", Steps: `["提交财务重开"]`, FollowUps: `[]`, Text: "问题：发票抬头错误"})
+	db.Create(&models.ConversationSummary{SessionID: "s2", Trigger: services.SummaryTriggerSessionEnd, Problem: "咨询物流", Steps: `[]`, FollowUps: `["补发快递单号"]`, Text: "问题：咨询物流"})
+
+	r := gin.New()
+	RegisterSummaryRoutes(r.Group("/api"), NewSummaryHandler(services.NewSummaryService(db, services.NewAIService("", ""), nil)))
+
+	w := doJSON(r, http.MethodGet, "/api/summaries/tickets/1", "")
+	var rec services.SummaryRecord
+	_ = json.Unmarshal(w.Body.Bytes(), &rec)
+	if w.Code != http.StatusOK || rec.Problem != "发票抬头错误" || len(rec.Steps) != 1 || rec.Trigger != services.SummaryTriggerResolved {
+		t.Fatalf("ticket summary status=%d body=%s", w.Code, w.Body.String())
+	}
+	if w := doJSON(r, http.MethodGet, "/api/summaries/tickets/2", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("missing summary status=%d", w.Code)
+	}
+	w = doJSON(r, http.MethodGet, "/api/summaries/sessions/s2", "")
+	_ = json.Unmarshal(w.Body.Bytes(), &rec)
+	if w.Code != http.StatusOK || len(rec.FollowUps) != 1 {
+		t.Fatalf("session summary status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	w = doJSON(r, http.MethodGet, "/api/summaries?trigger=session_ended&to=2999-01-01", "")
+	var list struct {
+		Data  []services.SummaryRecord `json:"data"`
+		Total int64                    `json:"total"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &list)
+	if w.Code != http.StatusOK || list.Total != 1 || list.Data[0].SessionID != "s2" {
+		t.Fatalf("list status=%d body=%s", w.Code, w.Body.String())
+	}
+	if w := doJSON(r, http.MethodGet, "/api/summaries?from=yesterday", ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("bad from status=%d", w.Code)
+	}
+
+	// 未配置模型 503；会话无消息 422
+	if w := doJSON(r, http.MethodPost, "/api/summaries/tickets/1", ""); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("regenerate status=%d body=%s", w.Code, w.Body.String())
+	}
+	if w := doJSON(r, http.MethodPost, "/api/summaries/sessions/s-empty", ""); w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("empty session status=%d body=%s", w.Code, w.Body.String())
+	}
+	if w := doJSON(r, http.MethodPost, "/api/summaries/tickets/9", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("missing ticket status=%d", w.Code)
+	}
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+
+	"servify/apps/server/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TelegramWebhookHandler 接收 Telegram Bot API 的 webhook 推送
+type TelegramWebhookHandler struct {
+	adapter *services.TelegramAdapter
+}
+
+// NewTelegramWebhookHandler 创建 Telegram webhook 处理器
+func NewTelegramWebhookHandler(adapter *services.TelegramAdapter) *TelegramWebhookHandler {
+	return &TelegramWebhookHandler{adapter: adapter}
+}
+
+// Handle 校验 secret token 并将 Update 投递给适配器
+func (h *TelegramWebhookHandler) Handle(c *gin.Context) {
+	if !h.adapter.VerifyWebhookSecret(c.GetHeader("X-Telegram-Bot-Api-Secret-Token")) {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Unauthorized", Message: "invalid secret token"})
+		return
+	}
+
+	var update services.TelegramUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid update", Message: err.Error()})
+		return
+	}
+
+	if err := h.adapter.HandleUpdate(c.Request.Context(), &update); err != nil {
+		// 返回非 2xx，Telegram 会稍后重试投递
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "Failed to handle update", Message: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// RegisterTelegramWebhookRoutes 注册 Telegram webhook 路由（无需登录，依赖 secret token 校验）
+func RegisterTelegramWebhookRoutes(r *gin.RouterGroup, handler *TelegramWebhookHandler) {
+	if r == nil || handler == nil {
+		return
+	}
+	r.POST("/channels/telegram/webhook", handler.Handle)
+}
+
+// TelegramFileHandler 代理下载 Telegram 附件：file_id 在服务端解析，bot token 不出现在附件地址中
+type TelegramFileHandler struct {
+	adapter *services.TelegramAdapter
+}
+
+// NewTelegramFileHandler 创建 Telegram 附件代理处理器
+func NewTelegramFileHandler(adapter *services.TelegramAdapter) *TelegramFileHandler {
+	return &TelegramFileHandler{adapter: adapter}
+}
+
+// Download 拉取 file_id 对应的文件并原样返回；file_id 无效 404，Bot API 不可用 502
+func (h *TelegramFileHandler) Download(c *gin.Context) {
+	file, err := h.adapter.OpenFile(c.Request.Context(), c.Param("file_id"))
+	if err != nil {
+		status := http.StatusBadGateway
+		if errors.Is(err, services.ErrTelegramFileNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, ErrorResponse{Error: "Failed to fetch telegram file", Message: err.Error()})
+		return
+	}
+	defer file.Body.Close()
+
+	c.DataFromReader(http.StatusOK, file.Size, file.ContentType, file.Body, map[string]string{
+		"Content-Disposition": mime.FormatMediaType("attachment", map[string]string{"filename": file.Name}),
+	})
+}
+
+// RegisterTelegramFileRoutes 注册附件代理下载路由（需登录），路径与 services.TelegramFileProxyPath 一致
+func RegisterTelegramFileRoutes(r *gin.RouterGroup, handler *TelegramFileHandler) {
+	if r == nil || handler == nil {
+		return
+	}
+	r.GET("/channels/telegram/files/:file_id", handler.Download)
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"servify/apps/server/internal/services"
+)
+
+func newTelegramWebhookTestRouter(adapter *services.TelegramAdapter) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	RegisterTelegramWebhookRoutes(router.Group("/api/v1"), NewTelegramWebhookHandler(adapter))
+	return router
+}
+
+func TestTelegramWebhookHandler_RejectsBadSecret(t *testing.T) {
+	adapter := services.NewTelegramAdapter(services.TelegramAdapterConfig{BotToken: "t", Mode: "webhook", WebhookSecret: "s3cret"})
+	router := newTelegramWebhookTestRouter(adapter)
+
+	req := httptest.NewRequest("POST", "/api/v1/channels/telegram/webhook", bytes.NewBufferString(`{"update_id":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Telegram-Bot-Api-Secret-Token", "wrong")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestTelegramWebhookHandler_RejectsWithoutConfiguredSecret(t *testing.T) {
+	adapter := services.NewTelegramAdapter(services.TelegramAdapterConfig{BotToken: "t", Mode: "webhook"})
+	router := newTelegramWebhookTestRouter(adapter)
+
+	req := httptest.NewRequest("POST", "/api/v1/channels/telegram/webhook", bytes.NewBufferString(`{"update_id":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestTelegramWebhookHandler_DeliversUpdate(t *testing.T) {
+	adapter := services.NewTelegramAdapter(services.TelegramAdapterConfig{BotToken: "t", Mode: "webhook", WebhookSecret: "s3cret"})
+	router := newTelegramWebhookTestRouter(adapter)
+
+	body := `{"update_id":10,"message":{"message_id":3,"chat":{"id":42,"type":"private"},"date":1700000000,"text":"你好"}}`
+	req := httptest.NewRequest("POST", "/api/v1/channels/telegram/webhook", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Telegram-Bot-Api-Secret-Token", "s3cret")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	select {
+	case msg := <-adapter.ReceiveMessage():
+		assert.Equal(t, "42", msg.UserID)
+		assert.Equal(t, "你好", msg.Content)
+	case <-time.After(time.Second):
+		t.Fatal("update was not delivered to adapter channel")
+	}
+}
+
+func TestTelegramFileHandler_ProxiesDownload(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/bott/getFile":
+			var req struct {
+				FileID string `json:"file_id"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			if req.FileID != "f1" {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"ok":false,"error_code":400,"description":"Bad Request: invalid file_id"}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"ok":true,"result":{"file_id":"f1","file_path":"documents/file_1.pdf"}}`))
+		case "/file/bott/documents/file_1.pdf":
+			_, _ = w.Write([]byte("%PDF"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer api.Close()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	adapter := services.NewTelegramAdapter(services.TelegramAdapterConfig{BotToken: "t", APIBaseURL: api.URL})
+	RegisterTelegramFileRoutes(router.Group("/api"), NewTelegramFileHandler(adapter))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", services.TelegramFileProxyPath+"f1", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "%PDF", w.Body.String())
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "file_1.pdf")
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", services.TelegramFileProxyPath+"nope", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
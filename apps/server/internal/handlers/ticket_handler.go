@@ -3,6 +3,7 @@ package handlers
 import (
 	"bytes"
 	"encoding/csv"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -13,6 +14,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
 )
 
 // TicketHandler 工单处理器
@@ -414,6 +416,42 @@ func (h *TicketHandler) AddComment(c *gin.Context) {
 	c.JSON(http.StatusCreated, comment)
 }
 
+// GetTicketTriage 获取工单的分流预测记录
+// @Summary 获取工单分流记录
+// @Description 创建工单时模型预测的分类、优先级、情绪、标签及置信度，以及实际应用到工单的字段
+// @Tags 工单
+// @Produce json
+// @Param id path int true "工单ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/tickets/{id}/triage [get]
+func (h *TicketHandler) GetTicketTriage(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid ticket ID",
+			Message: "ID must be a valid number",
+		})
+		return
+	}
+
+	rows, err := h.ticketService.ListTicketTriages(c.Request.Context(), uint(id))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, ErrorResponse{
+			Error:   "Failed to get ticket triage",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": rows})
+}
+
 // CloseTicket 关闭工单
 // @Summary 关闭工单
 // @Description 关闭指定的工单
@@ -558,6 +596,7 @@ func RegisterTicketRoutes(r *gin.RouterGroup, handler *TicketHandler) {
 		tickets.POST("/:id/assign", handler.AssignTicket)
 		tickets.POST("/:id/comments", handler.AddComment)
 		tickets.POST("/:id/close", handler.CloseTicket)
+		tickets.GET("/:id/triage", handler.GetTicketTriage)
 	}
 }
 
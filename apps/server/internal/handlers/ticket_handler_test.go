@@ -291,6 +291,39 @@ func TestTicketHandler_CustomFields_Create_Filter_Export(t *testing.T) {
 	}
 }
 
+func TestTicketHandler_GetTicketTriage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db := newTestDBForTickets(t)
+	if err := db.AutoMigrate(&models.TicketTriage{}); err != nil {
+		t.Fatalf("automigrate: %v", err)
+	}
+	logger := logrus.New()
+	logger.SetLevel(logrus.WarnLevel)
+
+	db.Create(&models.Ticket{ID: 5, Title: "重复扣款", CustomerID: 1, Category: "billing"})
+	db.Create(&models.TicketTriage{TicketID: 5, Category: "billing", CategoryConfidence: 0.9, Priority: "high", PriorityConfidence: 0.5, Threshold: 0.7, Applied: "category"})
+
+	h := NewTicketHandler(services.NewTicketService(db, logger, nil), logger)
+	r := gin.New()
+	RegisterTicketRoutes(r.Group("/api"), h)
+
+	w := doJSON(r, http.MethodGet, "/api/tickets/5/triage", "")
+	var resp struct {
+		Data []models.TicketTriage `json:"data"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != http.StatusOK || len(resp.Data) != 1 || resp.Data[0].Applied != "category" || resp.Data[0].PriorityConfidence != 0.5 {
+		t.Fatalf("triage status=%d body=%s", w.Code, w.Body.String())
+	}
+	if w := doJSON(r, http.MethodGet, "/api/tickets/6/triage", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("missing ticket status=%d", w.Code)
+	}
+	if w := doJSON(r, http.MethodGet, "/api/tickets/abc/triage", ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("bad id status=%d", w.Code)
+	}
+}
+
 func toStr(v uint) string {
 	// uint->string without fmt to keep the test dependency surface small.
 	if v == 0 {
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+
+	"servify/apps/server/internal/config"
+	"servify/apps/server/internal/services"
+)
+
+func newWebSocketTestRouter(t *testing.T) (*gin.Engine, *services.WebSocketHub) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	hub := services.NewWebSocketHub()
+	go hub.Run()
+	hub.SetAllowedOrigins([]string{"https://app.example.com"})
+	cfg := &config.Config{JWT: config.JWTConfig{Secret: "ws-secret"}}
+	h := NewWebSocketHandler(hub, cfg)
+	r := gin.New()
+	r.GET("/ws", h.HandleWebSocket)
+	r.POST("/ws/visitor-token", h.IssueVisitorToken)
+	return r, hub
+}
+
+func issueTestVisitorToken(t *testing.T, r *gin.Engine, bearer string) map[string]interface{} {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/ws/visitor-token", nil)
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var out map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &out))
+	return out
+}
+
+func TestWebSocketHandler_VisitorToken(t *testing.T) {
+	r, _ := newWebSocketTestRouter(t)
+
+	first := issueTestVisitorToken(t, r, "")
+	sessionID, _ := first["session_id"].(string)
+	assert.True(t, strings.HasPrefix(sessionID, "web_"))
+
+	// 携带有效访客令牌续期，会话不变
+	refreshed := issueTestVisitorToken(t, r, first["token"].(string))
+	assert.Equal(t, sessionID, refreshed["session_id"])
+
+	req := httptest.NewRequest(http.MethodPost, "/ws/visitor-token", nil)
+	req.Header.Set("Authorization", "Bearer not-a-token")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestWebSocketHandler_RejectsBeforeUpgrade(t *testing.T) {
+	r, _ := newWebSocketTestRouter(t)
+	visitor := issueTestVisitorToken(t, r, "")["token"].(string)
+	viewer := signTestJWT(map[string]interface{}{"sub": "3", "roles": []string{"viewer"}})
+
+	cases := []struct {
+		name string
+		path string
+		want int
+	}{
+		{"missing token", "/ws?session_id=s1", http.StatusUnauthorized},
+		{"bad token", "/ws?token=abc", http.StatusUnauthorized},
+		{"visitor on foreign session", "/ws?session_id=other&token=" + visitor, http.StatusForbidden},
+		{"role not allowed", "/ws?session_id=s1&token=" + viewer, http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			assert.Equal(t, tc.want, w.Code)
+		})
+	}
+}
+
+func TestWebSocketHandler_ConnectAgentAndVisitor(t *testing.T) {
+	r, hub := newWebSocketTestRouter(t)
+	server := httptest.NewServer(r)
+	defer server.Close()
+	base := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+
+	visitor := issueTestVisitorToken(t, r, "")
+	conn, _, err := websocket.DefaultDialer.Dial(base+"?token="+visitor["token"].(string), nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+
+	agent := signTestJWT(map[string]interface{}{"sub": "9", "roles": []string{"agent"}})
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+agent)
+	agentConn, _, err := websocket.DefaultDialer.Dial(base+"?session_id="+visitor["session_id"].(string), header)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer agentConn.Close()
+
+	assert.Eventually(t, func() bool { return hub.GetClientCount() == 2 }, time.Second, 10*time.Millisecond)
+
+	// 来源不在白名单内的浏览器握手被拒绝
+	header = http.Header{}
+	header.Set("Origin", "https://evil.example.org")
+	_, resp, err := websocket.DefaultDialer.Dial(base+"?token="+visitor["token"].(string), header)
+	assert.Error(t, err)
+	if assert.NotNil(t, resp) {
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	}
+}
+
+// signTestJWT 以测试密钥签发 API JWT
+func signTestJWT(payload map[string]interface{}) string {
+	payload["exp"] = time.Now().Add(time.Hour).Unix()
+	enc := base64.RawURLEncoding.EncodeToString
+	header, _ := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT"})
+	body, _ := json.Marshal(payload)
+	signing := enc(header) + "." + enc(body)
+	mac := hmac.New(sha256.New, []byte("ws-secret"))
+	mac.Write([]byte(signing))
+	return signing + "." + enc(mac.Sum(nil))
+}
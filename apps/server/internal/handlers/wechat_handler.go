@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+
+	"servify/apps/server/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 回调报文大小上限
+const wechatMaxCallbackBody = 1 << 20
+
+// WeChatCallbackHandler 接收微信公众号 / 企业微信的回调推送
+type WeChatCallbackHandler struct {
+	adapter *services.WeChatAdapter
+}
+
+// NewWeChatCallbackHandler 创建微信回调处理器
+func NewWeChatCallbackHandler(adapter *services.WeChatAdapter) *WeChatCallbackHandler {
+	return &WeChatCallbackHandler{adapter: adapter}
+}
+
+// Verify 服务器配置时的 URL 验证（GET），校验通过后原样回写 echostr
+func (h *WeChatCallbackHandler) Verify(c *gin.Context) {
+	echo, err := h.adapter.VerifyURL(wechatCallbackParams(c))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Unauthorized", Message: err.Error()})
+		return
+	}
+	c.String(http.StatusOK, echo)
+}
+
+// Receive 接收消息推送（POST），处理成功后回复 success
+func (h *WeChatCallbackHandler) Receive(c *gin.Context) {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, wechatMaxCallbackBody))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid body", Message: err.Error()})
+		return
+	}
+
+	if err := h.adapter.HandleCallback(c.Request.Context(), wechatCallbackParams(c), body); err != nil {
+		switch {
+		case errors.Is(err, services.ErrWeChatSignature), errors.Is(err, services.ErrWeChatReplay):
+			c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Unauthorized", Message: err.Error()})
+		case errors.Is(err, services.ErrPlatformAdapterStopped), errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+			// 返回非 2xx，微信会重试推送
+			c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "Failed to handle message", Message: err.Error()})
+		default:
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid message", Message: err.Error()})
+		}
+		return
+	}
+
+	// 回复通过客服消息接口异步发送，这里只需应答 success
+	c.String(http.StatusOK, "success")
+}
+
+func wechatCallbackParams(c *gin.Context) services.WeChatCallbackParams {
+	return services.WeChatCallbackParams{
+		Signature:    c.Query("signature"),
+		MsgSignature: c.Query("msg_signature"),
+		Timestamp:    c.Query("timestamp"),
+		Nonce:        c.Query("nonce"),
+		EncryptType:  c.Query("encrypt_type"),
+		EchoStr:      c.Query("echostr"),
+	}
+}
+
+// RegisterWeChatCallbackRoutes 注册微信回调路由（无需登录，依赖签名校验）
+func RegisterWeChatCallbackRoutes(r *gin.RouterGroup, handler *WeChatCallbackHandler) {
+	if r == nil || handler == nil {
+		return
+	}
+	r.GET("/channels/wechat/callback", handler.Verify)
+	r.POST("/channels/wechat/callback", handler.Receive)
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"servify/apps/server/internal/services"
+)
+
+func wechatTestSignature(parts ...string) string {
+	sort.Strings(parts)
+	sum := sha1.Sum([]byte(strings.Join(parts, "")))
+	return hex.EncodeToString(sum[:])
+}
+
+func newWeChatCallbackTestRouter(t *testing.T) (*gin.Engine, *services.WeChatAdapter) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	adapter, err := services.NewWeChatAdapter(services.WeChatAdapterConfig{AppID: "wx123", AppSecret: "s", Token: "tok"})
+	if err != nil {
+		t.Fatalf("new adapter: %v", err)
+	}
+	router := gin.New()
+	RegisterWeChatCallbackRoutes(router.Group("/api/v1"), NewWeChatCallbackHandler(adapter))
+	return router, adapter
+}
+
+func TestWeChatCallbackHandler_Verify(t *testing.T) {
+	router, _ := newWeChatCallbackTestRouter(t)
+
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	q := url.Values{
+		"timestamp": {ts},
+		"nonce":     {"abc"},
+		"echostr":   {"echo123"},
+		"signature": {wechatTestSignature("tok", ts, "abc")},
+	}
+	req := httptest.NewRequest("GET", "/api/v1/channels/wechat/callback?"+q.Encode(), nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "echo123", w.Body.String())
+
+	q.Set("signature", "bad")
+	req = httptest.NewRequest("GET", "/api/v1/channels/wechat/callback?"+q.Encode(), nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestWeChatCallbackHandler_Receive(t *testing.T) {
+	router, adapter := newWeChatCallbackTestRouter(t)
+
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	q := url.Values{
+		"timestamp": {ts},
+		"nonce":     {"abc"},
+		"signature": {wechatTestSignature("tok", ts, "abc")},
+		"openid":    {"openid_1"},
+	}
+	body := `<xml><ToUserName>gh_1</ToUserName><FromUserName>openid_1</FromUserName><CreateTime>1700000000</CreateTime>` +
+		`<MsgType>text</MsgType><Content>退款进度</Content><MsgId>1</MsgId></xml>`
+	req := httptest.NewRequest("POST", "/api/v1/channels/wechat/callback?"+q.Encode(), bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "success", w.Body.String())
+	select {
+	case msg := <-adapter.ReceiveMessage():
+		assert.Equal(t, "openid_1", msg.UserID)
+		assert.Equal(t, "退款进度", msg.Content)
+	case <-time.After(time.Second):
+		t.Fatal("message was not delivered to adapter channel")
+	}
+
+	// 重放同一请求
+	req = httptest.NewRequest("POST", "/api/v1/channels/wechat/callback?"+q.Encode(), bytes.NewBufferString(body))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	q.Set("nonce", "def")
+	q.Set("signature", wechatTestSignature("tok", ts, "def"))
+	req = httptest.NewRequest("POST", "/api/v1/channels/wechat/callback?"+q.Encode(), bytes.NewBufferString("<xml><bad"))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -47,10 +47,43 @@ func (h *WorkspaceHandler) GetOverview(c *gin.Context) {
 	c.JSON(http.StatusOK, overview)
 }
 
+// GetUnread 获取当前坐席各会话的未读消息数
+// @Summary 坐席会话未读数
+// @Description 按当前坐席的已读回执统计其进行中会话里未读的客户消息
+// @Tags 全渠道
+// @Produce json
+// @Success 200 {array} services.SessionUnread
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/omni/workspace/unread [get]
+func (h *WorkspaceHandler) GetUnread(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	agentID, ok := userID.(uint)
+	if !exists || !ok {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{
+			Error:   "Unauthorized",
+			Message: "User not authenticated",
+		})
+		return
+	}
+
+	rows, err := h.service.GetUnreadCounts(c.Request.Context(), agentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Failed to load unread counts",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, rows)
+}
+
 // RegisterWorkspaceRoutes 注册全渠道工作台路由
 func RegisterWorkspaceRoutes(r *gin.RouterGroup, handler *WorkspaceHandler) {
 	omni := r.Group("/omni")
 	{
 		omni.GET("/workspace", handler.GetOverview)
+		omni.GET("/workspace/unread", handler.GetUnread)
 	}
 }
@@ -127,6 +127,14 @@ func AuthMiddleware(cfg *config.Config) gin.HandlerFunc {
 			})
 			return
 		}
+		// Visitor tokens are scoped to a single WebSocket session
+		if typ, _ := claims["typ"].(string); typ == VisitorTokenType {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error":   "Unauthorized",
+				"message": "visitor token not accepted",
+			})
+			return
+		}
 		// Extract common fields
 		// sub/user_id as uint if possible, fallback to string presence
 		var uidAny interface{}
@@ -184,6 +192,9 @@ func AuthMiddleware(cfg *config.Config) gin.HandlerFunc {
 						"workspace.read",
 						"macros.read",
 						"integrations.read",
+						"recordings.read",
+						"ai_tools.read",
+						"assist.read", "assist.write",
 					)
 				}
 			}
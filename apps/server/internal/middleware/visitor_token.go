@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// VisitorTokenType 访客令牌的 typ 声明；此类令牌只能用于 WebSocket 接入，不能访问 /api
+const VisitorTokenType = "visitor"
+
+// TokenPrincipal 令牌解析后的身份信息
+type TokenPrincipal struct {
+	UserID    uint
+	Roles     []string
+	SessionID string // 仅访客令牌：令牌绑定的会话
+	Visitor   bool
+	ExpiresAt time.Time
+}
+
+// HasRole 是否拥有任一给定角色
+func (p *TokenPrincipal) HasRole(roles ...string) bool {
+	for _, have := range p.Roles {
+		for _, want := range roles {
+			if have == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ParseToken 校验 HS256 JWT 并提取身份（坐席 JWT 与访客令牌通用）
+func ParseToken(token, secret string) (*TokenPrincipal, error) {
+	if token == "" || secret == "" {
+		return nil, errors.New("invalid token or server misconfig")
+	}
+	claims, err := validateHS256JWT(token, secret, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	p := &TokenPrincipal{Roles: normalizeStringList(claims["roles"])}
+	p.UserID, _ = claimUserID(claims)
+	if exp, ok := claims["exp"].(float64); ok {
+		p.ExpiresAt = time.Unix(int64(exp), 0)
+	}
+	if typ, _ := claims["typ"].(string); typ == VisitorTokenType {
+		p.Visitor = true
+		p.SessionID, _ = claims["session_id"].(string)
+		if p.SessionID == "" {
+			return nil, errors.New("visitor token missing session")
+		}
+	}
+	return p, nil
+}
+
+// IssueVisitorToken 为访客签发绑定会话的短期令牌
+func IssueVisitorToken(secret, sessionID string, ttl time.Duration) (string, time.Time, error) {
+	if secret == "" {
+		return "", time.Time{}, errors.New("jwt secret not configured")
+	}
+	if strings.TrimSpace(sessionID) == "" {
+		return "", time.Time{}, errors.New("session id required")
+	}
+	now := time.Now()
+	exp := now.Add(ttl)
+	tok, err := signHS256JWT(map[string]interface{}{
+		"typ":        VisitorTokenType,
+		"session_id": sessionID,
+		"roles":      []string{VisitorTokenType},
+		"iat":        now.Unix(),
+		"exp":        exp.Unix(),
+	}, secret)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return tok, exp, nil
+}
+
+// signHS256JWT 生成 HS256 紧凑格式 JWT
+func signHS256JWT(payload map[string]interface{}, secret string) (string, error) {
+	headerJSON, err := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawURLEncoding.EncodeToString
+	signing := enc(headerJSON) + "." + enc(payloadJSON)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signing))
+	return signing + "." + enc(mac.Sum(nil)), nil
+}
+
+// claimUserID 从 user_id/sub 中提取数字用户 ID
+func claimUserID(claims map[string]interface{}) (uint, bool) {
+	v, ok := claims["user_id"]
+	if !ok {
+		v = claims["sub"]
+	}
+	switch t := v.(type) {
+	case float64:
+		return uint(t), true
+	case json.Number:
+		if n, err := t.Int64(); err == nil {
+			return uint(n), true
+		}
+	case string:
+		if n, err := strconv.ParseUint(t, 10, 64); err == nil {
+			return uint(n), true
+		}
+	}
+	return 0, false
+}
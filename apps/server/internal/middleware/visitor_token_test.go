@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"servify/apps/server/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestIssueVisitorToken_ParseRoundTrip(t *testing.T) {
+	tok, exp, err := IssueVisitorToken("s3cret", "web_abc", 5*time.Minute)
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	if time.Until(exp) <= 0 {
+		t.Fatalf("expiry should be in the future: %v", exp)
+	}
+
+	p, err := ParseToken(tok, "s3cret")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if !p.Visitor || p.SessionID != "web_abc" || p.UserID != 0 {
+		t.Fatalf("unexpected principal: %+v", p)
+	}
+	if p.HasRole("agent", "admin") {
+		t.Fatal("visitor must not carry agent roles")
+	}
+
+	if _, err := ParseToken(tok, "other"); err == nil {
+		t.Fatal("expected signature error with wrong secret")
+	}
+	expired, _, _ := IssueVisitorToken("s3cret", "web_abc", -time.Minute)
+	if _, err := ParseToken(expired, "s3cret"); err == nil {
+		t.Fatal("expected expired token to be rejected")
+	}
+	if _, _, err := IssueVisitorToken("s3cret", "", time.Minute); err == nil {
+		t.Fatal("expected error without session id")
+	}
+}
+
+func TestParseToken_AgentJWT(t *testing.T) {
+	tok := createTestHS256JWT(t, map[string]interface{}{
+		"sub":   "12",
+		"roles": []string{"agent"},
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}, "s3cret")
+	p, err := ParseToken(tok, "s3cret")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if p.Visitor || p.UserID != 12 || !p.HasRole("agent") {
+		t.Fatalf("unexpected principal: %+v", p)
+	}
+}
+
+func TestAuthMiddleware_RejectsVisitorToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(AuthMiddleware(&config.Config{JWT: config.JWTConfig{Secret: "s3cret"}}))
+	r.GET("/test", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tok, _, err := IssueVisitorToken("s3cret", "web_abc", time.Minute)
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.Header.Set("Authorization", "Bearer "+tok)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401", w.Code)
+	}
+}
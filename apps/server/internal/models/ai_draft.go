@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// AIDraft 坐席工作台中 AI 生成的回复草稿与改写结果；坐席反馈后记录是否采纳及最终文本与草稿的编辑距离
+type AIDraft struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	Kind         string     `gorm:"size:16;not null;index" json:"kind"` // draft, rewrite
+	Operation    string     `gorm:"size:32" json:"operation,omitempty"` // rewrite：formal, shorter, translate, fix_tone
+	TicketID     *uint      `gorm:"index" json:"ticket_id,omitempty"`
+	SessionID    string     `gorm:"size:64;index" json:"session_id,omitempty"`
+	AgentID      uint       `gorm:"index" json:"agent_id"`
+	Input        string     `gorm:"type:text" json:"input,omitempty"` // 改写原文或坐席补充要求
+	Text         string     `gorm:"type:text" json:"text"`
+	Citations    string     `gorm:"type:text" json:"-"` // JSON 数组
+	Locale       string     `gorm:"size:16" json:"locale,omitempty"`
+	Status       string     `gorm:"size:16;not null;default:'pending';index" json:"status"` // pending, accepted, rejected
+	FinalText    string     `gorm:"type:text" json:"final_text,omitempty"`
+	EditDistance *int       `json:"edit_distance,omitempty"` // 按字符计的 Levenshtein 距离
+	EditRatio    *float64   `json:"edit_ratio,omitempty"`    // 编辑距离 / 较长文本长度
+	CreatedAt    time.Time  `gorm:"index" json:"created_at"`
+	ResolvedAt   *time.Time `json:"resolved_at,omitempty"`
+}
@@ -0,0 +1,68 @@
+package models
+
+import "time"
+
+// AIEvalSet 离线评测用的标准问题集
+type AIEvalSet struct {
+	ID          uint         `gorm:"primaryKey" json:"id"`
+	Name        string       `gorm:"size:128;not null;uniqueIndex" json:"name"`
+	Description string       `gorm:"type:text" json:"description"`
+	Cases       []AIEvalCase `gorm:"foreignKey:SetID" json:"cases,omitempty"`
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+}
+
+// AIEvalCase 问题及期望：关键词命中比例、正则匹配、期望的知识库文档是否被检索引用；ExpectedAnswer 供模型评审参考
+type AIEvalCase struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	SetID          uint      `gorm:"index;not null" json:"set_id"`
+	Question       string    `gorm:"type:text;not null" json:"question"`
+	ExpectedAnswer string    `gorm:"type:text" json:"expected_answer,omitempty"`
+	Keywords       string    `gorm:"type:text" json:"keywords,omitempty"`        // 逗号分隔，不区分大小写
+	Pattern        string    `gorm:"type:text" json:"pattern,omitempty"`         // Go 正则
+	ExpectedDocIDs string    `gorm:"size:255" json:"expected_doc_ids,omitempty"` // 逗号分隔的 knowledge_docs.id
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// AIEvalRun 一次评测运行；PromptVersions 与 KnowledgeVersion 记录运行时的提示词模板与知识库版本，便于对比
+type AIEvalRun struct {
+	ID               uint       `gorm:"primaryKey" json:"id"`
+	SetID            uint       `gorm:"index;not null" json:"set_id"`
+	Label            string     `gorm:"size:128" json:"label,omitempty"`
+	Status           string     `gorm:"size:16;not null;default:'running';index" json:"status"` // running, completed, failed
+	Judge            bool       `json:"judge"`
+	Threshold        float64    `json:"threshold"`
+	PromptVersions   string     `gorm:"type:text" json:"prompt_versions"` // JSON：{"answer/zh-CN":3}，内置模板不记录
+	KnowledgeVersion string     `gorm:"size:64" json:"knowledge_version"` // 文档数@最后更新时间
+	CaseCount        int        `json:"case_count"`
+	PassedCount      int        `json:"passed_count"`
+	KeywordScore     *float64   `json:"keyword_score,omitempty"`     // 关键词平均命中率
+	PatternPassRate  *float64   `json:"pattern_pass_rate,omitempty"` // 正则通过率
+	CitationHitRate  *float64   `json:"citation_hit_rate,omitempty"` // 期望文档平均命中率
+	JudgeScore       *float64   `json:"judge_score,omitempty"`       // 模型评审平均分
+	Score            float64    `json:"score"`                       // 用例得分平均值
+	Error            string     `gorm:"type:text" json:"error,omitempty"`
+	CreatedAt        time.Time  `gorm:"index" json:"created_at"`
+	FinishedAt       *time.Time `json:"finished_at,omitempty"`
+}
+
+// AIEvalResult 单个用例的回答与各项得分；未配置的评分项为空
+type AIEvalResult struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	RunID        uint      `gorm:"index;not null" json:"run_id"`
+	CaseID       uint      `gorm:"index;not null" json:"case_id"`
+	Question     string    `gorm:"type:text" json:"question"`
+	Answer       string    `gorm:"type:text" json:"answer"`
+	CitedDocIDs  string    `gorm:"size:255" json:"cited_doc_ids,omitempty"` // 逗号分隔
+	KeywordScore *float64  `json:"keyword_score,omitempty"`
+	PatternMatch *bool     `json:"pattern_match,omitempty"`
+	CitationHit  *float64  `json:"citation_hit,omitempty"`
+	JudgeScore   *float64  `json:"judge_score,omitempty"`
+	JudgeReason  string    `gorm:"type:text" json:"judge_reason,omitempty"`
+	Score        float64   `json:"score"`
+	Passed       bool      `json:"passed"`
+	LatencyMS    int64     `json:"latency_ms"`
+	Error        string    `gorm:"type:text" json:"error,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// AIToolInvocation AI 在会话中发起的工具调用记录（含被拒绝与参数不合法的调用），按 SessionID 与会话消息一同审阅
+type AIToolInvocation struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	SessionID  string    `gorm:"size:64;not null;index:idx_ai_tool_invocations_session,priority:1" json:"session_id"`
+	CustomerID uint      `gorm:"index" json:"customer_id"`
+	Tool       string    `gorm:"size:64;not null;index" json:"tool"` // list_tickets, create_ticket, get_ticket_status, transfer_to_human
+	CallID     string    `gorm:"size:128" json:"call_id"`
+	Arguments  string    `gorm:"type:text" json:"arguments"`
+	Result     string    `gorm:"type:text" json:"result"`
+	Status     string    `gorm:"size:20;not null;index" json:"status"` // success, denied, invalid, error
+	Error      string    `gorm:"type:text" json:"error,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+	CreatedAt  time.Time `gorm:"index:idx_ai_tool_invocations_session,priority:2" json:"created_at"`
+}
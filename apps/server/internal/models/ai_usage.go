@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// AIUsageRecord 单次模型调用的 token 用量与费用；Day 为 UTC 日期（YYYY-MM-DD），便于跨数据库按日汇总。
+// 后端未返回用量时按文本长度估算并标记 Estimated，Cost 按调用时的价格表计算
+type AIUsageRecord struct {
+	ID               uint      `gorm:"primaryKey" json:"id"`
+	Tenant           string    `gorm:"size:64;index" json:"tenant"`
+	Feature          string    `gorm:"size:32;not null;index" json:"feature"` // answer, summary, draft
+	Provider         string    `gorm:"size:64" json:"provider"`
+	Model            string    `gorm:"size:128;index" json:"model"`
+	SessionID        string    `gorm:"size:64;index" json:"session_id,omitempty"`
+	TicketID         *uint     `gorm:"index" json:"ticket_id,omitempty"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	Estimated        bool      `json:"estimated"`
+	Cost             float64   `json:"cost"`
+	Day              string    `gorm:"size:10;not null;index" json:"day"`
+	CreatedAt        time.Time `gorm:"index" json:"created_at"`
+}
@@ -6,7 +6,7 @@ import "time"
 type AutomationTrigger struct {
 	ID         uint      `gorm:"primaryKey" json:"id"`
 	Name       string    `gorm:"unique;not null" json:"name"`
-	Event      string    `gorm:"not null" json:"event"`       // ticket_created, ticket_updated, sla_violation
+	Event      string    `gorm:"not null" json:"event"`       // ticket_created, ticket_updated, sla_violation, ticket_triaged
 	Conditions string    `gorm:"type:text" json:"conditions"` // JSON: [{field,op,value}]
 	Actions    string    `gorm:"type:text" json:"actions"`    // JSON: [{type,params}]
 	Active     bool      `gorm:"default:true" json:"active"`
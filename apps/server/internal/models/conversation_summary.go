@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// ConversationSummary 工单解决/关闭、会话结束或转接时生成的结构化摘要；按需重新生成时追加新记录
+type ConversationSummary struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	TicketID   *uint     `gorm:"index" json:"ticket_id,omitempty"`
+	SessionID  string    `gorm:"size:64;index" json:"session_id,omitempty"`
+	Trigger    string    `gorm:"column:triggered_by;size:32;index" json:"trigger"` // ticket_resolved, ticket_closed, session_ended, session_transferred, manual
+	Problem    string    `gorm:"type:text" json:"problem"`
+	Steps      string    `gorm:"type:text" json:"-"` // JSON 数组
+	Resolution string    `gorm:"type:text" json:"resolution"`
+	FollowUps  string    `gorm:"type:text" json:"-"` // JSON 数组
+	Text       string    `gorm:"type:text" json:"text"`
+	CreatedAt  time.Time `gorm:"index" json:"created_at"`
+}
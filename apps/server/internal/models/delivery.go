@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// BeforeCreate 为消息分配会话内单调递增的序号
+// 序号来自 sessions.last_seq：自增语句持有会话行锁直到事务提交，多实例并发写入也不会重号。
+// 会话不存在时不编号（Seq 保持 0）。
+func (m *Message) BeforeCreate(tx *gorm.DB) error {
+	if m.Seq != 0 || m.SessionID == "" {
+		return nil
+	}
+	res := tx.Exec("UPDATE sessions SET last_seq = last_seq + 1 WHERE id = ?", m.SessionID)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil
+	}
+	return tx.Raw("SELECT last_seq FROM sessions WHERE id = ?", m.SessionID).Scan(&m.Seq).Error
+}
+
+// SessionCursor 会话参与方的游标：
+// AckedSeq 为客户端已确认（ack）收到的最大序号，重连时据此补发遗漏的消息；
+// ReadSeq/ReadMessageID 为参与方已读到的位置，用于未读数与已读回执
+type SessionCursor struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	SessionID     string     `gorm:"size:100;uniqueIndex:idx_session_cursor" json:"session_id"`
+	Participant   string     `gorm:"size:64;uniqueIndex:idx_session_cursor" json:"participant"` // visitor, agent:<user_id>
+	UserID        uint       `gorm:"index" json:"user_id"`
+	AckedSeq      int64      `json:"acked_seq"`
+	ReadSeq       int64      `gorm:"not null;default:0" json:"read_seq"`
+	ReadMessageID uint       `json:"read_message_id"`
+	ReadAt        *time.Time `json:"read_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// TicketEmail 工单邮件往来记录
+// 通过 MessageID 与来信的 In-Reply-To/References 匹配，把回复归入同一工单
+type TicketEmail struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	TicketID  uint      `gorm:"index" json:"ticket_id"`
+	CommentID *uint     `gorm:"index" json:"comment_id"`
+	MessageID string    `gorm:"size:512;uniqueIndex;not null" json:"message_id"`
+	InReplyTo string    `gorm:"size:512" json:"in_reply_to"`
+	Direction string    `gorm:"index" json:"direction"` // inbound, outbound
+	FromAddr  string    `json:"from_addr"`
+	ToAddr    string    `json:"to_addr"`
+	Subject   string    `json:"subject"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// KnowledgeChunk 知识库文档切块及其向量（本地语义检索索引）
+// Embedding 为 JSON 数组；PostgreSQL 安装了 pgvector 时另有 embedding_vec 列用于库内相似度排序。
+// Model 标识向量空间，与当前配置不一致的切块在重建索引时替换
+type KnowledgeChunk struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	DocID     uint      `gorm:"not null;index" json:"doc_id"`
+	Ordinal   int       `gorm:"not null" json:"ordinal"`
+	Content   string    `gorm:"type:text;not null" json:"content"`
+	Embedding string    `gorm:"type:text" json:"-"`
+	Model     string    `gorm:"size:128;index" json:"model"`
+	CreatedAt time.Time `json:"created_at"`
+}
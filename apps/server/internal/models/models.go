@@ -70,11 +70,13 @@ type Ticket struct {
 	CustomerID  uint           `gorm:"index" json:"customer_id"`
 	AgentID     *uint          `gorm:"index" json:"agent_id"`
 	SessionID   *string        `gorm:"index" json:"session_id"`
-	Category    string         `json:"category"`                         // technical, billing, general, complaint
-	Priority    string         `gorm:"default:'normal'" json:"priority"` // low, normal, high, urgent
-	Status      string         `gorm:"default:'open'" json:"status"`     // open, assigned, in_progress, resolved, closed
-	Source      string         `json:"source"`                           // web, email, phone, chat
-	Tags        string         `json:"tags"`                             // 标签，逗号分隔
+	Category    string         `json:"category"`                           // technical, billing, general, complaint
+	Priority    string         `gorm:"default:'normal'" json:"priority"`   // low, normal, high, urgent
+	Status      string         `gorm:"default:'open'" json:"status"`       // open, assigned, in_progress, resolved, closed
+	Source      string         `json:"source"`                             // web, email, phone, chat
+	Tags        string         `json:"tags"`                               // 标签，逗号分隔
+	Sentiment   string         `json:"sentiment,omitempty"`                // 客户情绪（工单分流预测）：positive, neutral, negative, angry
+	Summary     string         `gorm:"type:text" json:"summary,omitempty"` // 最新的结构化摘要（纯文本，参与搜索）
 	DueDate     *time.Time     `json:"due_date"`
 	ResolvedAt  *time.Time     `json:"resolved_at"`
 	ClosedAt    *time.Time     `json:"closed_at"`
@@ -173,8 +175,13 @@ type Session struct {
 	Platform  string     `json:"platform"`                       // web, telegram, wechat, etc.
 	StartedAt time.Time  `json:"started_at"`
 	EndedAt   *time.Time `json:"ended_at"`
-	CreatedAt time.Time  `json:"created_at"`
-	UpdatedAt time.Time  `json:"updated_at"`
+	LastSeq   int64      `gorm:"not null;default:0" json:"last_seq"` // 最近一条消息的会话内序号
+	// 人工响应：分配时间、负责坐席首次已读时间及间隔（秒），用于首次响应指标
+	AssignedAt        *time.Time `json:"assigned_at"`
+	AgentFirstReadAt  *time.Time `json:"agent_first_read_at"`
+	FirstResponseSecs int        `gorm:"default:0" json:"first_response_secs"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
 
 	User     User      `gorm:"foreignKey:UserID" json:"user,omitempty"`
 	Agent    *User     `gorm:"foreignKey:AgentID" json:"agent,omitempty"`
@@ -185,7 +192,8 @@ type Session struct {
 // 消息模型（更新）
 type Message struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
-	SessionID string    `gorm:"index" json:"session_id"`
+	SessionID string    `gorm:"index;index:idx_messages_session_seq,priority:1" json:"session_id"`
+	Seq       int64     `gorm:"index:idx_messages_session_seq,priority:2" json:"seq"` // 会话内递增序号，见 BeforeCreate
 	UserID    uint      `gorm:"index" json:"user_id"`
 	Content   string    `gorm:"type:text" json:"content"`
 	Type      string    `json:"type"`   // text, image, file, system
@@ -198,30 +206,32 @@ type Message struct {
 
 // 会话转接记录
 type TransferRecord struct {
-	ID             uint      `gorm:"primaryKey" json:"id"`
-	SessionID      string    `gorm:"index" json:"session_id"`
-	FromAgentID    *uint     `gorm:"index" json:"from_agent_id,omitempty"`
-	ToAgentID      *uint     `gorm:"index" json:"to_agent_id,omitempty"`
-	Reason         string    `json:"reason"`
-	Notes          string    `json:"notes"`
-	SessionSummary string    `gorm:"type:text" json:"session_summary"`
-	TransferredAt  time.Time `json:"transferred_at"`
-	CreatedAt      time.Time `json:"created_at"`
+	ID              uint      `gorm:"primaryKey" json:"id"`
+	SessionID       string    `gorm:"index" json:"session_id"`
+	FromAgentID     *uint     `gorm:"index" json:"from_agent_id,omitempty"`
+	ToAgentID       *uint     `gorm:"index" json:"to_agent_id,omitempty"`
+	Reason          string    `json:"reason"`
+	Notes           string    `json:"notes"`
+	SessionSummary  string    `gorm:"type:text" json:"session_summary"`
+	HandoffDecision string    `gorm:"type:text" json:"handoff_decision,omitempty"` // AI 转人工判断（得分、阈值与命中信号，JSON），非 AI 发起时为空
+	TransferredAt   time.Time `json:"transferred_at"`
+	CreatedAt       time.Time `json:"created_at"`
 }
 
 // 会话等待队列记录
 type WaitingRecord struct {
-	ID           uint       `gorm:"primaryKey" json:"id"`
-	SessionID    string     `gorm:"index" json:"session_id"`
-	Reason       string     `json:"reason"`
-	TargetSkills string     `json:"target_skills"`
-	Priority     string     `json:"priority"`
-	Notes        string     `json:"notes"`
-	Status       string     `gorm:"default:'waiting'" json:"status"` // waiting, transferred, cancelled
-	QueuedAt     time.Time  `json:"queued_at"`
-	AssignedAt   *time.Time `json:"assigned_at,omitempty"`
-	AssignedTo   *uint      `gorm:"index" json:"assigned_to,omitempty"`
-	CreatedAt    time.Time  `json:"created_at"`
+	ID              uint       `gorm:"primaryKey" json:"id"`
+	SessionID       string     `gorm:"index" json:"session_id"`
+	Reason          string     `json:"reason"`
+	TargetSkills    string     `json:"target_skills"`
+	Priority        string     `json:"priority"`
+	Notes           string     `json:"notes"`
+	Status          string     `gorm:"default:'waiting'" json:"status"`             // waiting, transferred, cancelled
+	HandoffDecision string     `gorm:"type:text" json:"handoff_decision,omitempty"` // 入队时的 AI 转人工判断，分配客服后写入转接记录
+	QueuedAt        time.Time  `json:"queued_at"`
+	AssignedAt      *time.Time `json:"assigned_at,omitempty"`
+	AssignedTo      *uint      `gorm:"index" json:"assigned_to,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
 }
 
 // 知识库文档
@@ -237,12 +247,58 @@ type KnowledgeDoc struct {
 
 // WebRTC 连接信息
 type WebRTCConnection struct {
-	ID             string    `gorm:"primaryKey" json:"id"`
-	SessionID      string    `gorm:"index" json:"session_id"`
-	Status         string    `gorm:"default:'connecting'" json:"status"` // connecting, connected, disconnected
-	ConnectionType string    `json:"connection_type"`                    // data, video, screen
-	CreatedAt      time.Time `json:"created_at"`
-	UpdatedAt      time.Time `json:"updated_at"`
+	ID             string     `gorm:"primaryKey" json:"id"`
+	SessionID      string     `gorm:"index" json:"session_id"`
+	Status         string     `gorm:"default:'connecting'" json:"status"` // connecting, connected, disconnected, failed, closed
+	ConnectionType string     `json:"connection_type"`                    // data, audio, video, screen
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	ClosedAt       *time.Time `json:"closed_at"`
+}
+
+// 通话录制授权记录（只追加；以会话内最新一条为准）
+type RecordingConsent struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	SessionID   string    `gorm:"index;not null" json:"session_id"`
+	Participant string    `gorm:"not null" json:"participant"` // visitor, agent:<id>
+	UserID      uint      `json:"user_id"`
+	Granted     bool      `json:"granted"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// 协同浏览控制事件审计（授予/收回控制权、滚动/跳转等指令，含被拒绝的请求）
+type CoBrowseEvent struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	SessionID string    `gorm:"index;not null" json:"session_id"`
+	Actor     string    `gorm:"not null" json:"actor"` // visitor, agent:<id>
+	AgentID   uint      `json:"agent_id"`              // 发送指令的坐席，或被授予控制权的坐席
+	Command   string    `gorm:"not null" json:"command"`
+	Payload   string    `gorm:"type:text" json:"payload"`
+	Allowed   bool      `json:"allowed"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// 通话/屏幕共享录制文件（每条远端媒体轨道一个文件）
+type CallRecording struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	SessionID    string     `gorm:"index;not null" json:"session_id"`
+	TicketID     *uint      `gorm:"index" json:"ticket_id"`
+	ConnectionID string     `gorm:"index" json:"connection_id"`
+	ConsentID    uint       `json:"consent_id"`
+	Source       string     `json:"source"`     // call, screen
+	TrackKind    string     `json:"track_kind"` // audio, video
+	Codec        string     `json:"codec"`      // opus, vp8
+	Format       string     `json:"format"`     // ogg, webm
+	FilePath     string     `json:"-"`
+	SizeBytes    int64      `json:"size_bytes"`
+	Status       string     `gorm:"default:'recording'" json:"status"` // recording, completed, failed, deleted
+	StartedAt    time.Time  `json:"started_at"`
+	EndedAt      *time.Time `json:"ended_at"`
+	ExpiresAt    *time.Time `gorm:"index" json:"expires_at"` // 保留期限，到期后删除文件
+	PurgedAt     *time.Time `json:"purged_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
 }
 
 // SLA 配置
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// PromptTemplate AI 系统提示词模板
+// 按 Name + Locale 版本化：每次修改生成新版本，同一 Name + Locale 仅一个激活版本；
+// Locale 为空表示适用于任意语言。Content 为 Go text/template，可用变量见 services.PromptVars
+type PromptTemplate struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `gorm:"size:64;not null;index:idx_prompt_templates_key,priority:1" json:"name"` // answer, answer_enhanced
+	Locale    string    `gorm:"size:20;index:idx_prompt_templates_key,priority:2" json:"locale"`        // zh-CN, en-US, en
+	Version   int       `gorm:"not null" json:"version"`
+	Content   string    `gorm:"type:text;not null" json:"content"`
+	Notes     string    `gorm:"type:text" json:"notes"`
+	Active    bool      `gorm:"default:false;index" json:"active"`
+	CreatedBy uint      `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
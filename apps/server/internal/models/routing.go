@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// RouteRule 消息路由规则
+// 按 Priority 从高到低依次匹配，首条命中的规则决定消息去向
+type RouteRule struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	Name       string    `gorm:"unique;not null" json:"name"`
+	Platform   string    `gorm:"index" json:"platform"`       // 为空表示全部平台
+	Conditions string    `gorm:"type:text" json:"conditions"` // JSON: [{field,op,value}]
+	Action     string    `gorm:"not null" json:"action"`      // ai, human, manual, drop
+	Params     string    `gorm:"type:text" json:"params"`     // JSON: {skills,priority,reply}
+	Priority   int       `gorm:"default:0;index" json:"priority"`
+	Active     bool      `gorm:"default:true" json:"active"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// TicketTriage 工单创建时模型给出的分流预测（分类、优先级、情绪、标签及置信度），用于审计与准确率评估
+type TicketTriage struct {
+	ID                  uint      `gorm:"primaryKey" json:"id"`
+	TicketID            uint      `gorm:"index;not null" json:"ticket_id"`
+	SessionID           string    `gorm:"size:64;index" json:"session_id,omitempty"`
+	Category            string    `gorm:"size:32" json:"category"`
+	CategoryConfidence  float64   `json:"category_confidence"`
+	Priority            string    `gorm:"size:16" json:"priority"`
+	PriorityConfidence  float64   `json:"priority_confidence"`
+	Sentiment           string    `gorm:"size:16" json:"sentiment"`
+	SentimentConfidence float64   `json:"sentiment_confidence"`
+	Tags                string    `gorm:"type:text" json:"tags"` // JSON 数组：[{"name":"refund","confidence":0.9}]
+	Threshold           float64   `json:"threshold"`
+	Applied             string    `gorm:"size:64" json:"applied"` // 实际应用到工单的字段，逗号分隔：category,priority,sentiment,tags
+	CreatedAt           time.Time `gorm:"index" json:"created_at"`
+}
@@ -0,0 +1,317 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"servify/apps/server/internal/models"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// AgentsTopic 全体坐席订阅的频道（排队事件、未指派工单的 SLA 预警）
+const AgentsTopic = "agents"
+
+// 坐席工作台事件类型
+const (
+	AgentEventQueueEntry      = "queue-entry"      // 新会话进入等待队列
+	AgentEventQueueRemoved    = "queue-removed"    // 会话离开等待队列（已分配/取消）
+	AgentEventSessionAssigned = "session-assigned" // 会话分配给本坐席
+	AgentEventSessionReleased = "session-released" // 会话被转走
+	AgentEventSessionMessage  = "session-message"  // 本坐席会话中的新消息
+	AgentEventTicketAssigned  = "ticket-assigned"  // 工单指派给本坐席
+	AgentEventSLAWarning      = "sla-warning"      // SLA 即将/已经违约
+)
+
+// AgentChannelID 坐席个人工作台频道
+func AgentChannelID(userID uint) string {
+	return fmt.Sprintf("agent:%d", userID)
+}
+
+// isAgentChannel 是否为坐席工作台保留频道（访客/会话连接不得使用）
+func isAgentChannel(id string) bool {
+	return id == AgentsTopic || strings.HasPrefix(id, "agent:")
+}
+
+// AgentRealtimeService 坐席实时工作台
+// 坐席以 JWT 接入 /api/v1/ws 且不带 session_id 时进入个人频道 agent:<user_id> 并订阅 agents 频道；
+// 本服务向这些频道推送排队、分配、客户消息、工单与 SLA 事件，并处理坐席在工作台内的回复。
+type AgentRealtimeService struct {
+	db     *gorm.DB
+	hub    *WebSocketHub
+	logger *logrus.Logger
+
+	mu sync.RWMutex
+	// 可选：外部平台（Telegram/微信等）会话的回复通道
+	router *MessageRouter
+}
+
+// NewAgentRealtimeService 创建坐席实时工作台服务
+func NewAgentRealtimeService(db *gorm.DB, hub *WebSocketHub, logger *logrus.Logger) *AgentRealtimeService {
+	if logger == nil {
+		logger = logrus.New()
+	}
+	return &AgentRealtimeService{db: db, hub: hub, logger: logger}
+}
+
+// SetMessageRouter 注入消息路由，用于把坐席回复投递到外部平台
+func (s *AgentRealtimeService) SetMessageRouter(router *MessageRouter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.router = router
+}
+
+func (s *AgentRealtimeService) push(channel, eventType string, data map[string]interface{}) {
+	if s.hub == nil {
+		return
+	}
+	s.hub.SendToSession(channel, WebSocketMessage{Type: eventType, Data: data})
+}
+
+// assignedAgent 会话当前负责坐席（未分配或已结束时为 0）
+func (s *AgentRealtimeService) assignedAgent(sessionID string) uint {
+	if s.db == nil || sessionID == "" {
+		return 0
+	}
+	var session models.Session
+	if err := s.db.Select("id", "agent_id", "status").First(&session, "id = ?", sessionID).Error; err != nil {
+		return 0
+	}
+	if session.AgentID == nil || session.Status == "ended" {
+		return 0
+	}
+	return *session.AgentID
+}
+
+// NotifyQueueEntry 新的等待队列条目
+func (s *AgentRealtimeService) NotifyQueueEntry(record *models.WaitingRecord) {
+	if record == nil {
+		return
+	}
+	s.push(AgentsTopic, AgentEventQueueEntry, map[string]interface{}{
+		"session_id":    record.SessionID,
+		"reason":        record.Reason,
+		"target_skills": splitTags(record.TargetSkills),
+		"priority":      record.Priority,
+		"notes":         record.Notes,
+		"queued_at":     record.QueuedAt,
+	})
+}
+
+// NotifyQueueRemoved 会话离开等待队列
+func (s *AgentRealtimeService) NotifyQueueRemoved(sessionID, reason string) {
+	s.push(AgentsTopic, AgentEventQueueRemoved, map[string]interface{}{
+		"session_id": sessionID,
+		"reason":     reason,
+	})
+}
+
+// NotifySessionAssigned 会话分配给坐席；fromAgentID 非空时同时通知原坐席
+func (s *AgentRealtimeService) NotifySessionAssigned(sessionID string, agentID uint, fromAgentID *uint) {
+	data := map[string]interface{}{
+		"session_id": sessionID,
+		"agent_id":   agentID,
+	}
+	if s.db != nil {
+		var session models.Session
+		if err := s.db.Select("id", "user_id", "platform", "started_at").First(&session, "id = ?", sessionID).Error; err == nil {
+			data["platform"] = session.Platform
+			data["customer_user_id"] = session.UserID
+			data["started_at"] = session.StartedAt
+		}
+	}
+	s.push(AgentChannelID(agentID), AgentEventSessionAssigned, data)
+	if fromAgentID != nil && *fromAgentID != agentID {
+		s.push(AgentChannelID(*fromAgentID), AgentEventSessionReleased, map[string]interface{}{
+			"session_id": sessionID,
+			"agent_id":   agentID,
+		})
+	}
+	s.NotifyQueueRemoved(sessionID, "assigned")
+}
+
+// NotifySessionMessage 把会话中的新消息推送给负责该会话的坐席
+func (s *AgentRealtimeService) NotifySessionMessage(msg *models.Message) {
+	if msg == nil || s.db == nil {
+		return
+	}
+	var session models.Session
+	if err := s.db.Select("id", "agent_id", "status").First(&session, "id = ?", msg.SessionID).Error; err != nil {
+		return
+	}
+	if session.AgentID == nil || session.Status == "ended" {
+		return
+	}
+	s.push(AgentChannelID(*session.AgentID), AgentEventSessionMessage, map[string]interface{}{
+		"session_id": msg.SessionID,
+		"message_id": msg.ID,
+		"seq":        msg.Seq,
+		"content":    msg.Content,
+		"type":       msg.Type,
+		"sender":     msg.Sender,
+		"user_id":    msg.UserID,
+		"created_at": msg.CreatedAt,
+	})
+}
+
+// NotifyTicketAssigned 工单指派给坐席
+func (s *AgentRealtimeService) NotifyTicketAssigned(ticket *models.Ticket) {
+	if ticket == nil || ticket.AgentID == nil {
+		return
+	}
+	s.push(AgentChannelID(*ticket.AgentID), AgentEventTicketAssigned, map[string]interface{}{
+		"ticket_id":   ticket.ID,
+		"title":       ticket.Title,
+		"priority":    ticket.Priority,
+		"status":      ticket.Status,
+		"customer_id": ticket.CustomerID,
+		"session_id":  ticket.SessionID,
+	})
+}
+
+// NotifySLAWarning SLA 预警/违约：已指派的工单通知负责坐席，否则通知全体坐席
+func (s *AgentRealtimeService) NotifySLAWarning(ticket *models.Ticket, violationType string, deadline time.Time, violated bool) {
+	if ticket == nil {
+		return
+	}
+	channel := AgentsTopic
+	if ticket.AgentID != nil {
+		channel = AgentChannelID(*ticket.AgentID)
+	}
+	level := "warning"
+	if violated {
+		level = "violation"
+	}
+	s.push(channel, AgentEventSLAWarning, map[string]interface{}{
+		"ticket_id":      ticket.ID,
+		"title":          ticket.Title,
+		"priority":       ticket.Priority,
+		"violation_type": violationType,
+		"deadline":       deadline,
+		"level":          level,
+	})
+}
+
+// replySession 校验会话可由该坐席回复（未结束且已分配给该坐席）
+func (s *AgentRealtimeService) replySession(ctx context.Context, agentID uint, sessionID string) (*models.Session, error) {
+	var session models.Session
+	if err := s.db.WithContext(ctx).First(&session, "id = ?", sessionID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("session not found")
+		}
+		return nil, err
+	}
+	if session.Status == "ended" {
+		return nil, fmt.Errorf("session already ended")
+	}
+	if session.AgentID == nil || *session.AgentID != agentID {
+		return nil, fmt.Errorf("session not assigned to agent")
+	}
+	return &session, nil
+}
+
+// Reply 坐席在工作台内回复会话：落库（Sender=agent）后投递给客户
+func (s *AgentRealtimeService) Reply(ctx context.Context, agentID uint, sessionID, content string) (*models.Message, error) {
+	if s.db == nil {
+		return nil, fmt.Errorf("database not configured")
+	}
+	content = strings.TrimSpace(content)
+	if sessionID == "" || content == "" {
+		return nil, fmt.Errorf("session_id and content required")
+	}
+
+	session, err := s.replySession(ctx, agentID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &models.Message{
+		SessionID: sessionID,
+		UserID:    agentID,
+		Content:   content,
+		Type:      "text",
+		Sender:    "agent",
+		CreatedAt: time.Now(),
+	}
+	if err := s.db.WithContext(ctx).Create(msg).Error; err != nil {
+		return nil, fmt.Errorf("persist reply: %w", err)
+	}
+	s.NotifySessionMessage(msg)
+
+	if session.Platform == "" || session.Platform == string(PlatformWeb) {
+		if s.hub != nil {
+			s.hub.SendToSession(sessionID, WebSocketMessage{
+				Type: "text-message",
+				Data: map[string]interface{}{
+					"content":  content,
+					"sender":   "agent",
+					"agent_id": agentID,
+				},
+				Seq: msg.Seq,
+			})
+		}
+		return msg, nil
+	}
+
+	s.mu.RLock()
+	router := s.router
+	s.mu.RUnlock()
+	if router == nil {
+		return msg, fmt.Errorf("no delivery channel for platform %s", session.Platform)
+	}
+	if err := router.deliverToPlatform(session.Platform, sessionID, content); err != nil {
+		return msg, err
+	}
+	return msg, nil
+}
+
+// ReplyAttachment 坐席向外部渠道会话发送图片/文件：落库（Content 为附件地址）后经平台适配器的 AttachmentSender 发送。
+// 本地文件须位于上传目录内，由适配器校验
+func (s *AgentRealtimeService) ReplyAttachment(ctx context.Context, agentID uint, sessionID string, attachment Attachment) (*models.Message, error) {
+	if s.db == nil {
+		return nil, fmt.Errorf("database not configured")
+	}
+	attachment.URL = strings.TrimSpace(attachment.URL)
+	if sessionID == "" || attachment.URL == "" {
+		return nil, fmt.Errorf("session_id and attachment url required")
+	}
+	if attachment.Type != string(MessageTypeImage) {
+		attachment.Type = string(MessageTypeFile)
+	}
+
+	session, err := s.replySession(ctx, agentID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if session.Platform == "" || session.Platform == string(PlatformWeb) {
+		return nil, fmt.Errorf("attachments are only supported for external channels")
+	}
+	s.mu.RLock()
+	router := s.router
+	s.mu.RUnlock()
+	if router == nil {
+		return nil, fmt.Errorf("no delivery channel for platform %s", session.Platform)
+	}
+
+	msg := &models.Message{
+		SessionID: sessionID,
+		UserID:    agentID,
+		Content:   attachment.URL,
+		Type:      attachment.Type,
+		Sender:    "agent",
+		CreatedAt: time.Now(),
+	}
+	if err := s.db.WithContext(ctx).Create(msg).Error; err != nil {
+		return nil, fmt.Errorf("persist reply: %w", err)
+	}
+	s.NotifySessionMessage(msg)
+
+	if err := router.deliverAttachment(session.Platform, sessionID, attachment); err != nil {
+		return msg, err
+	}
+	return msg, nil
+}
@@ -0,0 +1,222 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"servify/apps/server/internal/models"
+)
+
+func newAgentRealtimeTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:agent_rt_"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Session{}, &models.Message{}, &models.Ticket{}, &models.SLAConfig{}, &models.SLAViolation{}); err != nil {
+		t.Fatalf("automigrate: %v", err)
+	}
+	return db
+}
+
+// newWorkspaceClient 注册一个坐席工作台连接（不经过真实 WebSocket）
+func newWorkspaceClient(hub *WebSocketHub, agentID uint) *WebSocketClient {
+	c := &WebSocketClient{
+		ID:        AgentChannelID(agentID),
+		SessionID: AgentChannelID(agentID),
+		Role:      WSRoleAgent,
+		UserID:    agentID,
+		Send:      make(chan WebSocketMessage, 16),
+		Hub:       hub,
+		workspace: true,
+		topics:    []string{AgentsTopic},
+	}
+	hub.register <- c
+	return c
+}
+
+func nextEvent(t *testing.T, c *WebSocketClient) WebSocketMessage {
+	t.Helper()
+	select {
+	case msg := <-c.Send:
+		return msg
+	case <-time.After(2 * time.Second):
+		t.Fatalf("client %s: no event received", c.ID)
+		return WebSocketMessage{}
+	}
+}
+
+func noEvent(t *testing.T, c *WebSocketClient) {
+	t.Helper()
+	select {
+	case msg := <-c.Send:
+		t.Fatalf("client %s: unexpected event %s", c.ID, msg.Type)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestAgentRealtime_QueueAndAssignmentEvents(t *testing.T) {
+	db := newAgentRealtimeTestDB(t)
+	db.Create(&models.Session{ID: "s1", UserID: 5, Status: "active", Platform: "web"})
+	hub := NewWebSocketHub()
+	go hub.Run()
+	rt := NewAgentRealtimeService(db, hub, logrus.New())
+
+	a1 := newWorkspaceClient(hub, 1)
+	a2 := newWorkspaceClient(hub, 2)
+	waitFor(t, func() bool { return hub.GetClientCount() == 2 })
+
+	rt.NotifyQueueEntry(&models.WaitingRecord{SessionID: "s1", TargetSkills: "billing,vip", Priority: "high"})
+	for _, c := range []*WebSocketClient{a1, a2} {
+		if ev := nextEvent(t, c); ev.Type != AgentEventQueueEntry {
+			t.Fatalf("agent %d got %s, want %s", c.UserID, ev.Type, AgentEventQueueEntry)
+		}
+	}
+
+	from := uint(1)
+	rt.NotifySessionAssigned("s1", 2, &from)
+	if ev := nextEvent(t, a2); ev.Type != AgentEventSessionAssigned || ev.Data.(map[string]interface{})["customer_user_id"] != uint(5) {
+		t.Fatalf("assignee event = %+v", ev)
+	}
+	if ev := nextEvent(t, a1); ev.Type != AgentEventSessionReleased {
+		t.Fatalf("previous agent event = %s, want %s", ev.Type, AgentEventSessionReleased)
+	}
+	// 分配后全体坐席收到出队通知
+	for _, c := range []*WebSocketClient{a1, a2} {
+		if ev := nextEvent(t, c); ev.Type != AgentEventQueueRemoved {
+			t.Fatalf("agent %d got %s, want %s", c.UserID, ev.Type, AgentEventQueueRemoved)
+		}
+	}
+
+	// 客户消息只推送给负责坐席
+	db.Model(&models.Session{}).Where("id = ?", "s1").Update("agent_id", 2)
+	rt.NotifySessionMessage(&models.Message{SessionID: "s1", Content: "help", Sender: "user"})
+	if ev := nextEvent(t, a2); ev.Type != AgentEventSessionMessage {
+		t.Fatalf("agent 2 got %s, want %s", ev.Type, AgentEventSessionMessage)
+	}
+	noEvent(t, a1)
+}
+
+func TestAgentRealtime_Reply(t *testing.T) {
+	db := newAgentRealtimeTestDB(t)
+	agentID := uint(7)
+	db.Create(&models.Session{ID: "s1", UserID: 5, AgentID: &agentID, Status: "active", Platform: "web"})
+	db.Create(&models.Session{ID: "s2", Status: "active", Platform: "telegram", AgentID: &agentID})
+	hub := NewWebSocketHub()
+	go hub.Run()
+	rt := NewAgentRealtimeService(db, hub, logrus.New())
+
+	workspace := newWorkspaceClient(hub, agentID)
+	visitor := &WebSocketClient{ID: "v", SessionID: "s1", Role: WSRoleVisitor, Send: make(chan WebSocketMessage, 4), Hub: hub}
+	hub.register <- visitor
+	waitFor(t, func() bool { return hub.GetClientCount() == 2 })
+
+	ctx := context.Background()
+	if _, err := rt.Reply(ctx, 8, "s1", "hi"); err == nil {
+		t.Fatal("reply from an agent not owning the session should fail")
+	}
+	if _, err := rt.Reply(ctx, agentID, "s1", "  "); err == nil {
+		t.Fatal("empty reply should fail")
+	}
+
+	msg, err := rt.Reply(ctx, agentID, "s1", "hello")
+	if err != nil {
+		t.Fatalf("reply: %v", err)
+	}
+	if msg.Sender != "agent" || msg.UserID != agentID || msg.Seq != 1 {
+		t.Fatalf("stored reply = %+v", msg)
+	}
+	if ev := nextEvent(t, visitor); ev.Type != "text-message" || ev.Seq != 1 {
+		t.Fatalf("visitor got %+v", ev)
+	}
+	if ev := nextEvent(t, workspace); ev.Type != AgentEventSessionMessage {
+		t.Fatalf("workspace got %s, want %s", ev.Type, AgentEventSessionMessage)
+	}
+
+	// 外部平台会话需要消息路由
+	if _, err := rt.Reply(ctx, agentID, "s2", "hello"); err == nil {
+		t.Fatal("reply to external platform without router should fail")
+	}
+}
+
+func TestAgentRealtime_ReplyAttachment(t *testing.T) {
+	db := newAgentRealtimeTestDB(t)
+	agentID := uint(7)
+	db.Create(&models.Session{ID: "s1", Status: "active", Platform: "web", AgentID: &agentID})
+	db.Create(&models.Session{ID: "555", Status: "active", Platform: "telegram", AgentID: &agentID})
+	db.Create(&models.Session{ID: "s3", Status: "active", Platform: "plain", AgentID: &agentID})
+	hub := NewWebSocketHub()
+	go hub.Run()
+	rt := NewAgentRealtimeService(db, hub, logrus.New())
+
+	fake, srv := newFakeTelegramAPI(nil)
+	defer srv.Close()
+	uploads := t.TempDir()
+	router := NewMessageRouter(nil, hub, db)
+	router.RegisterPlatform("telegram", NewTelegramAdapter(TelegramAdapterConfig{BotToken: "token", APIBaseURL: srv.URL, UploadDir: uploads}))
+	router.RegisterPlatform("plain", &mockPlatformAdapter{name: "plain"})
+	rt.SetMessageRouter(router)
+
+	ctx := context.Background()
+	if _, err := rt.ReplyAttachment(ctx, agentID, "s1", Attachment{Type: "image", URL: "https://cdn.example.com/a.png"}); err == nil {
+		t.Fatal("attachment to web session should fail")
+	}
+
+	msg, err := rt.ReplyAttachment(ctx, agentID, "555", Attachment{Type: "image", URL: "https://cdn.example.com/a.png"})
+	if err != nil {
+		t.Fatalf("reply attachment: %v", err)
+	}
+	if msg.Type != "image" || msg.Content != "https://cdn.example.com/a.png" || msg.Sender != "agent" {
+		t.Fatalf("stored reply = %+v", msg)
+	}
+	if calls := fake.callsOf("sendPhoto"); len(calls) != 1 || calls[0]["chat_id"] != "555" {
+		t.Fatalf("sendPhoto calls = %+v", calls)
+	}
+
+	// 上传目录之外的本地文件不得外发
+	secret := filepath.Join(t.TempDir(), "secret.txt")
+	_ = os.WriteFile(secret, []byte("x"), 0o600)
+	if _, err := rt.ReplyAttachment(ctx, agentID, "555", Attachment{URL: secret}); !errors.Is(err, ErrAttachmentOutsideUploadDir) {
+		t.Fatalf("outside upload dir err = %v", err)
+	}
+
+	if _, err := rt.ReplyAttachment(ctx, agentID, "s3", Attachment{URL: "https://cdn.example.com/a.pdf"}); err == nil || !strings.Contains(err.Error(), "does not support attachments") {
+		t.Fatalf("adapter without AttachmentSender err = %v", err)
+	}
+}
+
+func TestSLAService_WarningPushedOnce(t *testing.T) {
+	db := newAgentRealtimeTestDB(t)
+	hub := NewWebSocketHub()
+	go hub.Run()
+	svc := NewSLAService(db, logrus.New())
+	svc.SetAgentRealtimeService(NewAgentRealtimeService(db, hub, logrus.New()))
+	agents := newWorkspaceClient(hub, 1)
+	waitFor(t, func() bool { return hub.GetClientCount() == 1 })
+
+	now := time.Now()
+	db.Create(&models.SLAConfig{Name: "normal", Priority: "normal", FirstResponseTime: 60, ResolutionTime: 600, WarningThreshold: 80, Active: true})
+	ticket := &models.Ticket{ID: 1, Title: "slow", Priority: "normal", Status: "open", CreatedAt: now.Add(-50 * time.Minute)}
+	db.Create(ticket)
+
+	for i := 0; i < 2; i++ {
+		if v, err := svc.CheckSLAViolation(context.Background(), ticket); err != nil || v != nil {
+			t.Fatalf("check: violation=%v err=%v", v, err)
+		}
+	}
+	ev := nextEvent(t, agents)
+	data := ev.Data.(map[string]interface{})
+	if ev.Type != AgentEventSLAWarning || data["level"] != "warning" || data["violation_type"] != "first_response" {
+		t.Fatalf("sla event = %+v", ev)
+	}
+	noEvent(t, agents)
+}
@@ -19,6 +19,11 @@ type AgentService struct {
 	logger       *logrus.Logger
 	onlineAgents sync.Map // map[uint]*AgentInfo - 在线客服列表
 	agentQueues  sync.Map // map[uint]chan *models.Session - 客服会话队列
+
+	// 可选：坐席工作台推送
+	agentRealtime *AgentRealtimeService
+	// 可选：会话结束时生成结构化摘要
+	summaries *SummaryService
 }
 
 // NewAgentService 创建人工客服服务
@@ -38,6 +43,16 @@ func NewAgentService(db *gorm.DB, logger *logrus.Logger) *AgentService {
 	return service
 }
 
+// SetAgentRealtimeService 注入坐席工作台服务（可选）
+func (s *AgentService) SetAgentRealtimeService(svc *AgentRealtimeService) {
+	s.agentRealtime = svc
+}
+
+// SetSummaryService 注入摘要服务（可选）
+func (s *AgentService) SetSummaryService(svc *SummaryService) {
+	s.summaries = svc
+}
+
 // AgentInfo 在线客服信息
 type AgentInfo struct {
 	UserID          uint                       `json:"user_id"`
@@ -268,8 +283,10 @@ func (s *AgentService) AssignSessionToAgent(ctx context.Context, sessionID strin
 		Updates(map[string]interface{}{
 			"agent_id": agentID,
 			// 会话生命周期：active/ended；是否已分配通过 agent_id 判断
-			"status":   "active",
-			"ended_at": nil,
+			"status":              "active",
+			"ended_at":            nil,
+			"assigned_at":         time.Now(),
+			"agent_first_read_at": nil,
 		}).Error; err != nil {
 		return fmt.Errorf("failed to assign session: %w", err)
 	}
@@ -286,6 +303,9 @@ func (s *AgentService) AssignSessionToAgent(ctx context.Context, sessionID strin
 		Update("current_load", info.CurrentLoad)
 
 	s.logger.Infof("Assigned session %s to agent %d", sessionID, agentID)
+	if s.agentRealtime != nil {
+		s.agentRealtime.NotifySessionAssigned(sessionID, agentID, session.AgentID)
+	}
 
 	return nil
 }
@@ -293,13 +313,17 @@ func (s *AgentService) AssignSessionToAgent(ctx context.Context, sessionID strin
 // ReleaseSessionFromAgent 从客服释放会话
 func (s *AgentService) ReleaseSessionFromAgent(ctx context.Context, sessionID string, agentID uint) error {
 	// 更新会话状态
-	if err := s.db.Model(&models.Session{}).
+	result := s.db.Model(&models.Session{}).
 		Where("id = ? AND agent_id = ?", sessionID, agentID).
 		Updates(map[string]interface{}{
 			"status":   "ended",
 			"ended_at": time.Now(),
-		}).Error; err != nil {
-		return fmt.Errorf("failed to release session: %w", err)
+		})
+	if result.Error != nil {
+		return fmt.Errorf("failed to release session: %w", result.Error)
+	}
+	if result.RowsAffected > 0 && s.summaries != nil {
+		s.summaries.SummarizeSessionAsync(sessionID, SummaryTriggerSessionEnd)
 	}
 
 	// 更新客服负载
@@ -1,28 +1,40 @@
 package services
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
+	"math"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
-	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
+	"gorm.io/gorm"
 	"servify/apps/server/internal/models"
 )
 
 type AIService struct {
 	openAIAPIKey  string
 	openAIBaseURL string
-	client        *http.Client
+	llm           *LLMRouter
+	prompts       *PromptTemplateService
+	tools         *AIToolService // 可选：回答时可调用的工单/转人工工具
 	knowledgeBase *KnowledgeBase
+	semantic      *KnowledgeSearchService // 可选：knowledge_docs 的本地语义检索，优先于内置知识库
+	usage         *AIUsageService         // 可选：用量计费与月度预算
+	redactor      *PIIRedactor            // 可选：外发模型与检索前脱敏
+	handoff       *HandoffPolicy          // 转人工策略
+	handoffOnce   sync.Once
+
+	// 会话记忆
+	db          *gorm.DB
+	memory      ConversationMemoryConfig
+	summaries   map[string]memorySummary
+	summariesMu sync.Mutex
 }
 
 type KnowledgeBase struct {
@@ -31,15 +43,21 @@ type KnowledgeBase struct {
 }
 
 type OpenAIRequest struct {
-	Model       string    `json:"model"`
-	Messages    []Message `json:"messages"`
-	Temperature float64   `json:"temperature"`
-	MaxTokens   int       `json:"max_tokens"`
+	Model       string       `json:"model"`
+	Messages    []Message    `json:"messages"`
+	Temperature float64      `json:"temperature"`
+	MaxTokens   int          `json:"max_tokens"`
+	Stream      bool         `json:"stream,omitempty"`
+	Tools       []openAITool `json:"tools,omitempty"`
+	// StreamOptions 流式请求时要求返回用量
+	StreamOptions *openAIStreamOptions `json:"stream_options,omitempty"`
 }
 
 type Message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role       string        `json:"role"`
+	Content    string        `json:"content"`
+	ToolCalls  []LLMToolCall `json:"tool_calls,omitempty"`   // assistant 发起的工具调用
+	ToolCallID string        `json:"tool_call_id,omitempty"` // role=tool 时对应的调用 ID
 }
 
 type OpenAIResponse struct {
@@ -52,133 +70,288 @@ type OpenAIResponse struct {
 	} `json:"error"`
 }
 
+// openAIStreamChunk 流式响应（SSE）中的单个增量
+type openAIStreamChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content   string                `json:"content"`
+			ToolCalls []openAIToolCallDelta `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
 type AIResponse struct {
 	Content    string  `json:"content"`
 	Confidence float64 `json:"confidence"`
 	Source     string  `json:"source"`
+	// KnowledgeDocIDs 回答所依据的本地知识库文档（knowledge_docs.id）；内置与 WeKnora 文档不含在内
+	KnowledgeDocIDs []uint `json:"knowledge_doc_ids,omitempty"`
 }
 
+// NewAIService 创建 AI 服务；apiKey 非空时以 OpenAI 兼容接口作为唯一后端，多后端通过 SetLLMRouter 配置
 func NewAIService(apiKey, baseURL string) *AIService {
-	return &AIService{
+	s := &AIService{
 		openAIAPIKey:  apiKey,
 		openAIBaseURL: baseURL,
-		client: &http.Client{
-			Timeout:   30 * time.Second,
-			Transport: otelhttp.NewTransport(http.DefaultTransport),
-		},
+		llm:           NewLLMRouter(nil),
+		memory:        DefaultConversationMemoryConfig(),
+		handoff:       defaultHandoffPolicy(),
 		knowledgeBase: &KnowledgeBase{
 			documents: []models.KnowledgeDoc{},
 		},
 	}
+	if apiKey != "" {
+		p, _ := NewLLMProvider(LLMProviderConfig{Type: LLMProviderOpenAI, BaseURL: baseURL, APIKey: apiKey, Temperature: 0.7, MaxTokens: 1000})
+		_ = s.llm.AddProvider(p, nil)
+	}
+	return s
+}
+
+// SetLLMRouter 替换模型后端路由（多后端、按场景故障转移）
+func (s *AIService) SetLLMRouter(r *LLMRouter) {
+	s.llm = r
+}
+
+// SetPromptTemplates 设置提示词模板服务（品牌、语言与管理端维护的模板）
+func (s *AIService) SetPromptTemplates(p *PromptTemplateService) {
+	s.prompts = p
+}
+
+// SetKnowledgeSearch 启用本地语义检索
+func (s *AIService) SetKnowledgeSearch(k *KnowledgeSearchService) {
+	s.semantic = k
+}
+
+// searchKnowledge 优先使用语义检索；未启用、失败或无命中时回退到内置知识库
+func (s *AIService) searchKnowledge(ctx context.Context, query string, limit int) []models.KnowledgeDoc {
+	docs, _, _ := s.searchKnowledgeScored(ctx, query, limit)
+	return docs
+}
+
+// searchKnowledgeScored 同 searchKnowledge，另返回语义检索的最高相似度；
+// 语义检索未启用或失败时 scored 为 false（内置知识库没有可用的相关度）
+func (s *AIService) searchKnowledgeScored(ctx context.Context, query string, limit int) (docs []models.KnowledgeDoc, score float64, scored bool) {
+	if s.semantic != nil {
+		// 向量化可能调用外部 embeddings 接口
+		hits, err := s.semantic.Search(ctx, s.redactor.Mask(query), limit)
+		if err != nil {
+			logrus.Warnf("Knowledge search failed: %v", err)
+		} else {
+			scored = true
+			if len(hits) > 0 {
+				for _, h := range hits {
+					score = math.Max(score, h.Score)
+				}
+				return hitsToDocs(hits), score, true
+			}
+		}
+	}
+	return s.knowledgeBase.Search(query, limit), score, scored
+}
+
+// SetUsageService 启用用量记录与月度预算
+func (s *AIService) SetUsageService(u *AIUsageService) {
+	s.usage = u
+}
+
+// SetRedactor 启用外发脱敏：发送给模型与外部检索的文本中敏感信息替换为占位符，回复中的占位符还原为原文
+func (s *AIService) SetRedactor(r *PIIRedactor) {
+	s.redactor = r
+}
+
+// LLM 返回当前的模型后端路由
+func (s *AIService) LLM() *LLMRouter {
+	return s.llm
 }
 
 func (s *AIService) ProcessQuery(ctx context.Context, query string, sessionID string) (*AIResponse, error) {
 	// 1. 检查是否需要从知识库搜索
-	relevantDocs := s.knowledgeBase.Search(query, 3)
+	relevantDocs, score, scored := s.searchKnowledgeScored(ctx, query, 3)
 
-	// 2. 构建提示词
-	prompt := s.buildPrompt(query, relevantDocs)
+	// 2. 构建对话：系统提示 + 会话历史 + 当前问题
+	messages := s.buildChatMessages(ctx, sessionID, s.systemPrompt(ctx, PromptAnswer, sessionID, query, relevantDocs), query)
 
-	// 3. 调用 OpenAI API
-	response, err := s.callOpenAI(ctx, prompt)
+	// 3. 调用模型（可能先调用工具）
+	response, _, err := s.answer(ctx, sessionID, messages, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to call OpenAI: %w", err)
+		return nil, fmt.Errorf("failed to call LLM: %w", err)
 	}
 
 	// 4. 处理响应
 	aiResponse := &AIResponse{
-		Content:    response,
-		Confidence: 0.8, // 简单的置信度，实际项目中需要更复杂的计算
-		Source:     "ai",
+		Content:         response,
+		Confidence:      0.8, // 简单的置信度，实际项目中需要更复杂的计算
+		Source:          "ai",
+		KnowledgeDocIDs: knowledgeDocIDs(relevantDocs),
 	}
-
-	return aiResponse, nil
-}
-
-func (s *AIService) buildPrompt(query string, docs []models.KnowledgeDoc) string {
-	context := ""
-	if len(docs) > 0 {
-		context = "基于以下知识库内容回答问题：\n"
-		for _, doc := range docs {
-			context += fmt.Sprintf("- %s: %s\n", doc.Title, doc.Content)
-		}
-		context += "\n"
+	// 连续低置信度信号只使用检索相关度；固定的回答置信度不参与
+	if scored {
+		s.observeConfidence(sessionID, score)
 	}
 
-	prompt := fmt.Sprintf(`%s你是一个智能客服助手，请根据用户的问题提供准确、友好的回答。
-
-用户问题：%s
-
-请用中文回答，保持专业和友好的语气。如果无法找到相关信息，请礼貌地说明。`, context, query)
-
-	return prompt
+	return aiResponse, nil
 }
 
-func (s *AIService) callOpenAI(ctx context.Context, prompt string) (string, error) {
-	tracer := otel.Tracer("servify/ai")
-	ctx, span := tracer.Start(ctx, "AIService.callOpenAI")
-	span.SetAttributes(attribute.String("model", "gpt-3.5-turbo"))
-	defer span.End()
+// ProcessQueryStream 同 ProcessQuery，但在生成过程中通过 onDelta 推送增量文本；ctx 取消时中止生成
+func (s *AIService) ProcessQueryStream(ctx context.Context, query string, sessionID string, onDelta func(string)) (*AIResponse, error) {
+	relevantDocs, score, scored := s.searchKnowledgeScored(ctx, query, 3)
+	messages := s.buildChatMessages(ctx, sessionID, s.systemPrompt(ctx, PromptAnswer, sessionID, query, relevantDocs), query)
 
-	if s.openAIAPIKey == "" {
-		return s.getFallbackResponse(prompt), nil
+	response, _, err := s.answer(ctx, sessionID, messages, onDelta)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call LLM: %w", err)
 	}
+	if scored {
+		s.observeConfidence(sessionID, score)
+	}
+	return &AIResponse{
+		Content:         response,
+		Confidence:      0.8,
+		Source:          "ai",
+		KnowledgeDocIDs: knowledgeDocIDs(relevantDocs),
+	}, nil
+}
 
-	request := OpenAIRequest{
-		Model: "gpt-3.5-turbo",
-		Messages: []Message{
-			{
-				Role:    "user",
-				Content: prompt,
-			},
-		},
-		Temperature: 0.7,
-		MaxTokens:   1000,
+// knowledgeDocIDs 去重后的本地文档 ID，跳过没有 ID 的文档
+func knowledgeDocIDs(docs []models.KnowledgeDoc) []uint {
+	var ids []uint
+	for _, d := range docs {
+		if d.ID != 0 && !slices.Contains(ids, d.ID) {
+			ids = append(ids, d.ID)
+		}
 	}
+	return ids
+}
 
-	reqBody, err := json.Marshal(request)
+// systemPrompt 按问题语言渲染系统提示词模板
+func (s *AIService) systemPrompt(ctx context.Context, name, sessionID, query string, docs []models.KnowledgeDoc) string {
+	rendered, err := s.promptTemplates().Render(ctx, name, PromptInput{SessionID: sessionID, Query: query, Docs: docs})
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
+		logrus.Errorf("Failed to render prompt %s: %v", name, err)
+		return ""
 	}
+	return rendered.Text
+}
 
-	url := fmt.Sprintf("%s/chat/completions", s.openAIBaseURL)
-	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(reqBody))
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+func (s *AIService) promptTemplates() *PromptTemplateService {
+	if s.prompts == nil {
+		return NewPromptTemplateService(nil, PromptTemplateConfig{}, logrus.StandardLogger())
 	}
+	return s.prompts
+}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", s.openAIAPIKey))
+// PreviewPrompt 以示例问题渲染提示词（检索知识库并组装完整对话），不调用模型
+func (s *AIService) PreviewPrompt(ctx context.Context, req PromptPreviewRequest) (*PromptPreview, error) {
+	return s.previewPrompt(ctx, req, PromptAnswer, s.searchKnowledge(ctx, req.Query, 3))
+}
 
-	resp, err := s.client.Do(req)
+func (s *AIService) previewPrompt(ctx context.Context, req PromptPreviewRequest, defaultName string, docs []models.KnowledgeDoc) (*PromptPreview, error) {
+	name := req.Name
+	if name == "" {
+		name = defaultName
+	}
+	rendered, err := s.promptTemplates().Render(ctx, name, PromptInput{
+		Locale:       req.Locale,
+		SessionID:    req.SessionID,
+		Query:        req.Query,
+		CustomerTier: req.CustomerTier,
+		Docs:         docs,
+		Content:      req.Content,
+	})
 	if err != nil {
-		span.SetStatus(codes.Error, err.Error())
-		return "", fmt.Errorf("failed to send request: %w", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
+	return &PromptPreview{
+		Prompt:   rendered,
+		Messages: s.buildChatMessages(ctx, req.SessionID, rendered.Text, req.Query),
+	}, nil
+}
 
-	body, err := io.ReadAll(resp.Body)
+// callLLM 按使用场景调用模型后端；未配置任何后端时返回规则降级回复
+func (s *AIService) callLLM(ctx context.Context, useCase string, req LLMRequest) (string, error) {
+	resp, err := s.generate(ctx, useCase, req, nil)
 	if err != nil {
-		return "", fmt.Errorf("failed to read response: %w", err)
+		return "", err
 	}
+	return resp.Content, nil
+}
 
-	var openAIResp OpenAIResponse
-	if err := json.Unmarshal(body, &openAIResp); err != nil {
-		span.SetStatus(codes.Error, err.Error())
-		return "", fmt.Errorf("failed to unmarshal response: %w", err)
+// generate 调用模型后端，onDelta 非空时流式生成；返回包含工具调用的完整结果
+func (s *AIService) generate(ctx context.Context, useCase string, req LLMRequest, onDelta func(string)) (*LLMResponse, error) {
+	spanName := "AIService.callLLM"
+	if onDelta != nil {
+		spanName = "AIService.callLLMStream"
 	}
+	ctx, span := otel.Tracer("servify/ai").Start(ctx, spanName)
+	span.SetAttributes(attribute.String("use_case", useCase))
+	defer span.End()
 
-	if openAIResp.Error != nil {
-		span.SetStatus(codes.Error, openAIResp.Error.Message)
-		return "", fmt.Errorf("OpenAI API error: %s", openAIResp.Error.Message)
+	// 预算用尽：面向客户的回答降级为规则回复，其他场景直接拒绝
+	budgetOK := s.usage.allows(ctx, useCase)
+	if !budgetOK && useCase != LLMUseCaseAnswer {
+		span.SetStatus(codes.Error, ErrAIBudgetExceeded.Error())
+		return nil, ErrAIBudgetExceeded
+	}
+	if !s.llm.HasProviders() || !budgetOK {
+		fallback := s.getFallbackResponse(lastUserContent(req.Messages))
+		if onDelta != nil {
+			onDelta(fallback)
+		}
+		return &LLMResponse{Content: fallback}, nil
 	}
 
-	if len(openAIResp.Choices) == 0 {
-		span.SetStatus(codes.Error, "no response choices")
-		return "", fmt.Errorf("no response from OpenAI")
+	// 外发前脱敏，回复（含流式增量与工具参数）中的占位符还原为原文
+	vault := s.redactor.NewVault()
+	outReq := vault.RedactRequest(req)
+	span.SetAttributes(attribute.Int("pii_redacted", vault.Len()))
+	// 失败、被取消及故障转移前的尝试同样消耗 token，逐次计入用量，避免绕过预算
+	ctx = withLLMAttemptObserver(ctx, func(attempt *LLMResponse) {
+		if _, err := s.usage.Record(context.WithoutCancel(ctx), useCase, req, attempt); err != nil {
+			logrus.Warnf("Failed to record AI usage: %v", err)
+		}
+	})
+	var (
+		resp *LLMResponse
+		err  error
+	)
+	if onDelta != nil {
+		push, flush := vault.StreamRestorer(onDelta)
+		resp, err = s.llm.Stream(ctx, useCase, outReq, push)
+		if err == nil {
+			flush()
+		}
+	} else {
+		resp, err = s.llm.Complete(ctx, useCase, outReq)
 	}
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	vault.RestoreResponse(resp)
+	span.SetAttributes(attribute.String("provider", resp.Provider), attribute.String("model", resp.Model), attribute.Int("tool_calls", len(resp.ToolCalls)))
+	rec, err := s.usage.Record(ctx, useCase, req, resp)
+	if err != nil {
+		logrus.Warnf("Failed to record AI usage: %v", err)
+	} else if rec != nil {
+		// 后端未返回用量时以估算值回填，便于调用方汇总
+		resp.Usage = LLMUsage{PromptTokens: rec.PromptTokens, CompletionTokens: rec.CompletionTokens}
+		span.SetAttributes(attribute.Int("prompt_tokens", rec.PromptTokens), attribute.Int("completion_tokens", rec.CompletionTokens))
+	}
+	return resp, nil
+}
 
-	return openAIResp.Choices[0].Message.Content, nil
+// lastUserContent 最后一条用户消息（降级回复按其关键词匹配）
+func lastUserContent(messages []Message) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			return messages[i].Content
+		}
+	}
+	return ""
 }
 
 func (s *AIService) getFallbackResponse(query string) string {
@@ -253,29 +426,9 @@ func (s *AIService) InitializeKnowledgeBase() {
 	logrus.Info("Knowledge base initialized with default documents")
 }
 
-// 判断是否需要转人工客服
-func (s *AIService) ShouldTransferToHuman(query string, sessionHistory []models.Message) bool {
-	query = strings.ToLower(query)
-
-	// 关键词判断
-	humanKeywords := []string{"人工", "客服", "转人工", "manual", "human", "agent"}
-	for _, keyword := range humanKeywords {
-		if strings.Contains(query, keyword) {
-			return true
-		}
-	}
-
-	// 复杂问题判断
-	if strings.Contains(query, "投诉") || strings.Contains(query, "complaint") {
-		return true
-	}
-
-	// 会话历史判断 - 如果用户多次询问同一类问题
-	if len(sessionHistory) > 5 {
-		return true
-	}
-
-	return false
+// ShouldTransferToHuman 按转人工策略判断；sessionID 用于置信度与客户等级信号，为空时这两项不参与
+func (s *AIService) ShouldTransferToHuman(sessionID, query string, sessionHistory []models.Message) bool {
+	return s.EvaluateHandoff(context.Background(), sessionID, query, sessionHistory).Transfer
 }
 
 // 获取会话摘要
@@ -284,18 +437,10 @@ func (s *AIService) GetSessionSummary(messages []models.Message) (string, error)
 		return "空会话", nil
 	}
 
-	// 构建会话内容
-	conversation := "会话内容：\n"
-	for _, msg := range messages {
-		conversation += fmt.Sprintf("%s: %s\n", msg.Sender, msg.Content)
-	}
-
-	prompt := fmt.Sprintf("请为以下客服会话提供简洁的摘要：\n%s\n\n请用中文总结主要问题和解决方案。", conversation)
-
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer cancel()
 
-	summary, err := s.callOpenAI(ctx, prompt)
+	summary, err := s.summarize(ctx, "", messages, 0)
 	if err != nil {
 		logrus.Errorf("Failed to generate session summary: %v", err)
 		return "无法生成会话摘要", nil
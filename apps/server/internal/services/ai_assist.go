@@ -0,0 +1,515 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"servify/apps/server/internal/models"
+)
+
+// 改写操作
+const (
+	AssistRewriteFormal    = "formal"    // 更正式
+	AssistRewriteShorter   = "shorter"   // 更简短
+	AssistRewriteTranslate = "translate" // 翻译为客户语言
+	AssistRewriteFixTone   = "fix_tone"  // 修正语气
+)
+
+// 草稿类型与状态
+const (
+	AIDraftKindDraft   = "draft"
+	AIDraftKindRewrite = "rewrite"
+
+	AIDraftPending  = "pending"
+	AIDraftAccepted = "accepted"
+	AIDraftRejected = "rejected"
+)
+
+var (
+	// ErrAssistInvalid 请求缺少上下文或参数不合法
+	ErrAssistInvalid = errors.New("invalid assist request")
+	// ErrAIDraftResolved 草稿已反馈过
+	ErrAIDraftResolved = errors.New("draft feedback already recorded")
+)
+
+// rewriteInstructions 各改写操作的指令；%s 为目标语言
+var rewriteInstructions = map[string]string{
+	AssistRewriteFormal:    "将以下客服回复改写得更正式、礼貌，保持原意与事实不变，使用原文的语言。",
+	AssistRewriteShorter:   "在不丢失关键信息的前提下精简以下客服回复，使用原文的语言。",
+	AssistRewriteTranslate: "将以下客服回复翻译为%s，保持语气、格式与事实不变。",
+	AssistRewriteFixTone:   "调整以下客服回复的语气，使其体贴、友好、专业，去除生硬、指责或消极的表达，事实不变，使用原文的语言。",
+}
+
+// AssistDraftRequest 为工单或会话生成回复草稿；至少提供其一，工单关联会话时一并载入会话消息
+type AssistDraftRequest struct {
+	TicketID     *uint  `json:"ticket_id"`
+	SessionID    string `json:"session_id"`
+	Instructions string `json:"instructions"` // 坐席补充要求，如“告知预计三天内退款”
+	Locale       string `json:"locale"`       // 为空时按客户消息检测
+}
+
+// AssistRewriteRequest 改写坐席撰写的文本；ticket_id/session_id 可选，用于检测客户语言与归属用量
+type AssistRewriteRequest struct {
+	Text      string `json:"text" binding:"required"`
+	Operation string `json:"operation" binding:"required"`
+	Locale    string `json:"locale"` // translate 的目标语言
+	TicketID  *uint  `json:"ticket_id"`
+	SessionID string `json:"session_id"`
+}
+
+// AssistCitation 草稿引用的资料
+type AssistCitation struct {
+	Index int    `json:"index"` // 草稿中的 [n]
+	Type  string `json:"type"`  // knowledge_doc, ticket
+	ID    uint   `json:"id"`
+	Title string `json:"title"`
+}
+
+// AssistResult 生成结果；DraftID 用于之后反馈是否采纳
+type AssistResult struct {
+	DraftID   uint             `json:"draft_id"`
+	Text      string           `json:"text"`
+	Locale    string           `json:"locale,omitempty"`
+	Citations []AssistCitation `json:"citations"`
+	Sources   []AssistCitation `json:"sources,omitempty"` // 提供给模型的全部资料
+}
+
+// AssistFeedbackRequest 坐席对草稿的反馈；final_text 为实际发送的文本
+type AssistFeedbackRequest struct {
+	Accepted  bool   `json:"accepted"`
+	FinalText string `json:"final_text"`
+}
+
+// AssistStats 草稿采纳统计
+type AssistStats struct {
+	Kind            string   `json:"kind"`
+	Total           int64    `json:"total"`
+	Accepted        int64    `json:"accepted"`
+	Rejected        int64    `json:"rejected"`
+	Pending         int64    `json:"pending"`
+	AcceptanceRate  float64  `json:"acceptance_rate"` // accepted / (accepted + rejected)
+	AvgEditDistance *float64 `json:"avg_edit_distance,omitempty"`
+	AvgEditRatio    *float64 `json:"avg_edit_ratio,omitempty"`
+}
+
+// AssistService 坐席工作台 AI 辅助：基于对话、相似已解决工单与知识库生成带引用的回复草稿，改写坐席文本，并记录采纳情况
+type AssistService struct {
+	db          *gorm.DB
+	ai          *AIService
+	suggestions *SuggestionService
+	logger      *logrus.Logger
+}
+
+func NewAssistService(db *gorm.DB, ai *AIService, suggestions *SuggestionService, logger *logrus.Logger) *AssistService {
+	if logger == nil {
+		logger = logrus.New()
+	}
+	return &AssistService{db: db, ai: ai, suggestions: suggestions, logger: logger}
+}
+
+// assistContext 草稿所需的对话上下文
+type assistContext struct {
+	ticket     *models.Ticket
+	sessionID  string
+	transcript []string
+	customer   string // 客户最近的发言，用于检索与语言检测
+}
+
+func (c *assistContext) scope(ctx context.Context) context.Context {
+	scope := AIUsageScope{SessionID: c.sessionID}
+	if c.ticket != nil {
+		scope.TicketID = &c.ticket.ID
+	}
+	return WithAIUsageScope(ctx, scope)
+}
+
+// loadContext 载入工单描述与公开评论、会话最近的消息
+func (s *AssistService) loadContext(ctx context.Context, ticketID *uint, sessionID string) (*assistContext, error) {
+	ac := &assistContext{sessionID: sessionID}
+	var customerLines []string
+	if ticketID != nil {
+		var t models.Ticket
+		if err := s.db.WithContext(ctx).First(&t, *ticketID).Error; err != nil {
+			return nil, fmt.Errorf("failed to load ticket: %w", err)
+		}
+		ac.ticket = &t
+		if ac.sessionID == "" && t.SessionID != nil {
+			ac.sessionID = *t.SessionID
+		}
+		ac.transcript = append(ac.transcript, fmt.Sprintf("工单 #%d：%s\n%s", t.ID, t.Title, t.Description))
+		customerLines = append(customerLines, t.Title+" "+t.Description)
+		var comments []models.TicketComment
+		if err := s.db.WithContext(ctx).Where("ticket_id = ? AND type = ?", t.ID, "comment").
+			Order("created_at ASC, id ASC").Find(&comments).Error; err != nil {
+			return nil, fmt.Errorf("failed to load ticket comments: %w", err)
+		}
+		for _, cm := range comments {
+			if cm.UserID == t.CustomerID {
+				ac.transcript = append(ac.transcript, "客户: "+cm.Content)
+				customerLines = append(customerLines, cm.Content)
+			} else {
+				ac.transcript = append(ac.transcript, "坐席: "+cm.Content)
+			}
+		}
+	}
+	if ac.sessionID != "" {
+		var msgs []models.Message
+		if err := s.db.WithContext(ctx).Where("session_id = ? AND type <> ?", ac.sessionID, "system").
+			Order("created_at DESC, id DESC").Limit(30).Find(&msgs).Error; err != nil {
+			return nil, fmt.Errorf("failed to load session messages: %w", err)
+		}
+		for i := len(msgs) - 1; i >= 0; i-- {
+			m := msgs[i]
+			switch m.Sender {
+			case "user":
+				ac.transcript = append(ac.transcript, "客户: "+m.Content)
+				customerLines = append(customerLines, m.Content)
+			case "ai":
+				ac.transcript = append(ac.transcript, "AI: "+m.Content)
+			default:
+				ac.transcript = append(ac.transcript, "坐席: "+m.Content)
+			}
+		}
+	}
+	if len(ac.transcript) == 0 {
+		return nil, fmt.Errorf("%w: ticket_id or session_id with messages required", ErrAssistInvalid)
+	}
+	// 最近三条客户发言
+	if n := len(customerLines); n > 3 {
+		customerLines = customerLines[n-3:]
+	}
+	ac.customer = strings.Join(customerLines, "\n")
+	return ac, nil
+}
+
+// sources 检索知识库与相似的已解决工单，按提供给模型的顺序编号
+func (s *AssistService) sources(ctx context.Context, ac *assistContext) ([]AssistCitation, []models.KnowledgeDoc) {
+	var (
+		cites []AssistCitation
+		docs  []models.KnowledgeDoc
+		seen  = make(map[uint]bool)
+	)
+	for _, d := range s.ai.searchKnowledge(ctx, ac.customer, 3) {
+		if d.ID != 0 && seen[d.ID] {
+			continue
+		}
+		seen[d.ID] = true
+		docs = append(docs, d)
+		cites = append(cites, AssistCitation{Index: len(docs), Type: "knowledge_doc", ID: d.ID, Title: d.Title})
+	}
+	if s.suggestions == nil {
+		return cites, docs
+	}
+	sug, err := s.suggestions.Suggest(ctx, &SuggestionRequest{Query: ac.customer, TicketLimit: 10, KnowledgeDocLimit: 1})
+	if err != nil {
+		s.logger.Warnf("Assist similar tickets failed: %v", err)
+		return cites, docs
+	}
+	added := 0
+	for _, t := range sug.SimilarTickets {
+		if added >= 3 || ac.ticket != nil && t.ID == ac.ticket.ID || (t.Status != "resolved" && t.Status != "closed") {
+			continue
+		}
+		content := s.ticketResolution(ctx, t.ID)
+		if content == "" {
+			continue
+		}
+		added++
+		docs = append(docs, models.KnowledgeDoc{Title: fmt.Sprintf("工单 #%d %s", t.ID, t.Title), Content: content})
+		cites = append(cites, AssistCitation{Index: len(docs), Type: "ticket", ID: t.ID, Title: t.Title})
+	}
+	return cites, docs
+}
+
+// ticketResolution 已解决工单的问题描述及坐席最后一条公开回复
+func (s *AssistService) ticketResolution(ctx context.Context, ticketID uint) string {
+	var t models.Ticket
+	if err := s.db.WithContext(ctx).Select("id, description, customer_id").First(&t, ticketID).Error; err != nil {
+		return ""
+	}
+	var reply models.TicketComment
+	err := s.db.WithContext(ctx).Where("ticket_id = ? AND type = ? AND user_id <> ?", ticketID, "comment", t.CustomerID).
+		Order("created_at DESC, id DESC").First(&reply).Error
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("问题：%s\n处理：%s", t.Description, reply.Content)
+}
+
+var (
+	citationRe      = regexp.MustCompile(`\[(\d{1,2})\]`)
+	citationStripRe = regexp.MustCompile(` ?\[\d{1,2}\]`)
+)
+
+// parseCitations 草稿中出现的 [n] 对应的资料，按首次出现顺序
+func parseCitations(text string, sources []AssistCitation) []AssistCitation {
+	out := []AssistCitation{}
+	seen := make(map[int]bool)
+	for _, m := range citationRe.FindAllStringSubmatch(text, -1) {
+		n, _ := strconv.Atoi(m[1])
+		if n < 1 || n > len(sources) || seen[n] {
+			continue
+		}
+		seen[n] = true
+		out = append(out, sources[n-1])
+	}
+	return out
+}
+
+// stripCitations 去掉引用标记（连同前面的空格），用于计算编辑距离
+func stripCitations(text string) string {
+	return strings.TrimSpace(citationStripRe.ReplaceAllString(text, ""))
+}
+
+// Draft 生成回复草稿
+func (s *AssistService) Draft(ctx context.Context, req *AssistDraftRequest, agentID uint) (*AssistResult, error) {
+	if req == nil {
+		return nil, ErrAssistInvalid
+	}
+	if !s.ai.LLM().HasProviders() {
+		return nil, ErrNoLLMProvider
+	}
+	ac, err := s.loadContext(ctx, req.TicketID, strings.TrimSpace(req.SessionID))
+	if err != nil {
+		return nil, err
+	}
+	ctx = ac.scope(ctx)
+	sources, docs := s.sources(ctx, ac)
+
+	rendered, err := s.ai.promptTemplates().Render(ctx, PromptDraft, PromptInput{Locale: req.Locale, SessionID: ac.sessionID, Query: ac.customer, Docs: docs})
+	if err != nil {
+		return nil, err
+	}
+	user := "对话记录：\n" + strings.Join(ac.transcript, "\n")
+	if in := strings.TrimSpace(req.Instructions); in != "" {
+		user += "\n\n坐席补充要求：" + in
+	}
+	text, err := s.ai.callLLM(ctx, LLMUseCaseDraft, LLMRequest{Messages: []Message{
+		{Role: "system", Content: rendered.Text},
+		{Role: "user", Content: user},
+	}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate draft: %w", err)
+	}
+	text = strings.TrimSpace(text)
+	citations := parseCitations(text, sources)
+	raw, _ := json.Marshal(citations)
+	row := &models.AIDraft{
+		Kind:      AIDraftKindDraft,
+		SessionID: ac.sessionID,
+		AgentID:   agentID,
+		Input:     req.Instructions,
+		Text:      text,
+		Citations: string(raw),
+		Locale:    rendered.Locale,
+		Status:    AIDraftPending,
+	}
+	if ac.ticket != nil {
+		row.TicketID = &ac.ticket.ID
+	}
+	if err := s.db.WithContext(ctx).Create(row).Error; err != nil {
+		return nil, fmt.Errorf("failed to save draft: %w", err)
+	}
+	return &AssistResult{DraftID: row.ID, Text: text, Locale: rendered.Locale, Citations: citations, Sources: sources}, nil
+}
+
+// Rewrite 按操作改写坐席文本；translate 未指定语言时翻译为客户使用的语言
+func (s *AssistService) Rewrite(ctx context.Context, req *AssistRewriteRequest, agentID uint) (*AssistResult, error) {
+	if req == nil || strings.TrimSpace(req.Text) == "" {
+		return nil, fmt.Errorf("%w: text required", ErrAssistInvalid)
+	}
+	instruction, ok := rewriteInstructions[req.Operation]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown operation %q", ErrAssistInvalid, req.Operation)
+	}
+	if !s.ai.LLM().HasProviders() {
+		return nil, ErrNoLLMProvider
+	}
+	sessionID := strings.TrimSpace(req.SessionID)
+	locale := ""
+	var ac *assistContext
+	if req.TicketID != nil || sessionID != "" {
+		var err error
+		if ac, err = s.loadContext(ctx, req.TicketID, sessionID); err != nil {
+			return nil, err
+		}
+		ctx = ac.scope(ctx)
+		sessionID = ac.sessionID
+	}
+	if req.Operation == AssistRewriteTranslate {
+		customer := ""
+		if ac != nil {
+			customer = ac.customer
+		}
+		if req.Locale == "" && customer == "" {
+			return nil, fmt.Errorf("%w: locale or ticket/session required for translate", ErrAssistInvalid)
+		}
+		locale = s.ai.promptTemplates().ResolveLocale(req.Locale, customer)
+		lang := languageNames[localeLanguage(locale)]
+		if lang == "" {
+			lang = locale
+		}
+		instruction = fmt.Sprintf(instruction, lang)
+	}
+	text, err := s.ai.callLLM(ctx, LLMUseCaseDraft, LLMRequest{Messages: []Message{
+		{Role: "system", Content: "你是客服写作助手。" + instruction + "只输出改写后的文本。"},
+		{Role: "user", Content: req.Text},
+	}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to rewrite: %w", err)
+	}
+	text = strings.TrimSpace(text)
+	row := &models.AIDraft{
+		Kind:      AIDraftKindRewrite,
+		Operation: req.Operation,
+		SessionID: sessionID,
+		AgentID:   agentID,
+		Input:     req.Text,
+		Text:      text,
+		Locale:    locale,
+		Status:    AIDraftPending,
+	}
+	if ac != nil && ac.ticket != nil {
+		row.TicketID = &ac.ticket.ID
+	}
+	if err := s.db.WithContext(ctx).Create(row).Error; err != nil {
+		return nil, fmt.Errorf("failed to save draft: %w", err)
+	}
+	return &AssistResult{DraftID: row.ID, Text: text, Locale: locale, Citations: []AssistCitation{}}, nil
+}
+
+// Feedback 记录草稿是否采纳；采纳时以 final_text（为空视为原样发送）计算编辑距离
+func (s *AssistService) Feedback(ctx context.Context, id uint, req *AssistFeedbackRequest) (*models.AIDraft, error) {
+	var row models.AIDraft
+	if err := s.db.WithContext(ctx).First(&row, id).Error; err != nil {
+		return nil, fmt.Errorf("failed to load draft: %w", err)
+	}
+	if row.Status != AIDraftPending {
+		return nil, ErrAIDraftResolved
+	}
+	now := time.Now()
+	row.ResolvedAt = &now
+	row.Status = AIDraftRejected
+	if req != nil && req.Accepted {
+		row.Status = AIDraftAccepted
+		draft := stripCitations(row.Text)
+		final := strings.TrimSpace(req.FinalText)
+		if final == "" {
+			final = draft
+		}
+		dist := editDistance(draft, final)
+		ratio := 0.0
+		if n := max(len([]rune(draft)), len([]rune(final))); n > 0 {
+			ratio = float64(dist) / float64(n)
+		}
+		row.FinalText = final
+		row.EditDistance = &dist
+		row.EditRatio = &ratio
+	} else if req != nil {
+		row.FinalText = strings.TrimSpace(req.FinalText)
+	}
+	if err := s.db.WithContext(ctx).Save(&row).Error; err != nil {
+		return nil, fmt.Errorf("failed to save draft feedback: %w", err)
+	}
+	return &row, nil
+}
+
+// Stats 按类型统计采纳率与平均编辑距离；from/to 为空不限
+func (s *AssistService) Stats(ctx context.Context, from, to *time.Time) ([]AssistStats, error) {
+	var rows []struct {
+		Kind    string
+		Status  string
+		Count   int64
+		AvgDist *float64
+		AvgRat  *float64
+	}
+	tx := s.db.WithContext(ctx).Model(&models.AIDraft{})
+	if from != nil {
+		tx = tx.Where("created_at >= ?", *from)
+	}
+	if to != nil {
+		tx = tx.Where("created_at < ?", *to)
+	}
+	if err := tx.Select("kind, status, COUNT(*) AS count, AVG(edit_distance) AS avg_dist, AVG(edit_ratio) AS avg_rat").
+		Group("kind, status").Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to aggregate drafts: %w", err)
+	}
+	out := []AssistStats{{Kind: AIDraftKindDraft}, {Kind: AIDraftKindRewrite}}
+	for _, r := range rows {
+		var st *AssistStats
+		for i := range out {
+			if out[i].Kind == r.Kind {
+				st = &out[i]
+			}
+		}
+		if st == nil {
+			continue
+		}
+		st.Total += r.Count
+		switch r.Status {
+		case AIDraftAccepted:
+			st.Accepted = r.Count
+			st.AvgEditDistance, st.AvgEditRatio = r.AvgDist, r.AvgRat
+		case AIDraftRejected:
+			st.Rejected = r.Count
+		default:
+			st.Pending += r.Count
+		}
+	}
+	for i := range out {
+		if n := out[i].Accepted + out[i].Rejected; n > 0 {
+			out[i].AcceptanceRate = float64(out[i].Accepted) / float64(n)
+		}
+	}
+	return out, nil
+}
+
+// ListDrafts 工单或会话的草稿记录
+func (s *AssistService) ListDrafts(ctx context.Context, ticketID *uint, sessionID string, limit int) ([]models.AIDraft, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	tx := s.db.WithContext(ctx).Order("created_at DESC, id DESC").Limit(limit)
+	if ticketID != nil {
+		tx = tx.Where("ticket_id = ?", *ticketID)
+	}
+	if sessionID != "" {
+		tx = tx.Where("session_id = ?", sessionID)
+	}
+	var rows []models.AIDraft
+	if err := tx.Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to list drafts: %w", err)
+	}
+	return rows, nil
+}
+
+// editDistance 按字符（rune）计算 Levenshtein 距离
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+
+	"servify/apps/server/internal/models"
+)
+
+// newAssistTestService 工单 #1 为已解决的相似工单，工单 #2 关联会话 s1；模型返回 reply 并记录收到的消息
+func newAssistTestService(t *testing.T, reply string) (*AssistService, *gorm.DB, *[][]Message) {
+	t.Helper()
+	db := newTicketServiceTestDB(t)
+	if err := db.AutoMigrate(&models.AIDraft{}, &models.Message{}, &models.KnowledgeDoc{}, &models.KnowledgeChunk{}); err != nil {
+		t.Fatalf("auto migrate: %v", err)
+	}
+	sid := "s1"
+	db.Create(&models.User{ID: 7, Username: "alice", Email: "alice@example.com", Role: "customer"})
+	db.Create(&models.User{ID: 99, Username: "agent", Email: "agent@example.com", Role: "agent"})
+	db.Create(&models.Session{ID: "s1", UserID: 7, Status: "active", Platform: "web"})
+	db.Create(&models.Session{ID: "s-en", UserID: 7, Status: "active", Platform: "web"})
+	db.Create(&models.Ticket{ID: 1, Title: "退款到账时间", Description: "申请退款后多久到账", CustomerID: 7, Status: "resolved"})
+	db.Create(&models.TicketComment{TicketID: 1, UserID: 99, Content: "退款会在 3 个工作日内原路退回", Type: "comment"})
+	db.Create(&models.TicketComment{TicketID: 1, UserID: 99, Content: "内部备注：已人工加急", Type: "internal_note"})
+	db.Create(&models.Ticket{ID: 2, Title: "退款什么时候到账", Description: "上周申请的退款", CustomerID: 7, Status: "open", SessionID: &sid})
+	db.Create(&models.TicketComment{TicketID: 2, UserID: 7, Content: "我昨天又问了一次退款", Type: "comment"})
+	db.Create(&models.Message{SessionID: "s1", Content: "退款还没到账", Type: "text", Sender: "user"})
+	db.Create(&models.Message{SessionID: "s-en", Content: "Where is my refund?", Type: "text", Sender: "user"})
+
+	var requests [][]Message
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req OpenAIRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		requests = append(requests, req.Messages)
+		out, _ := json.Marshal(reply)
+		fmt.Fprintf(w, `{"choices":[{"message":{"role":"assistant","content":%s}}]}`, out)
+	}))
+	t.Cleanup(srv.Close)
+
+	hash, _ := NewEmbedder(EmbeddingConfig{})
+	search := NewKnowledgeSearchService(db, hash, KnowledgeSearchConfig{}, nil)
+	docs := NewKnowledgeDocService(db)
+	docs.SetIndexer(search)
+	_, _ = docs.Create(context.Background(), &KnowledgeDocCreateRequest{Title: "退款政策", Content: "退款审核通过后原路退回，一般 1-3 个工作日到账。"})
+
+	ai := NewAIService("sk", srv.URL)
+	ai.SetKnowledgeSearch(search)
+	return NewAssistService(db, ai, NewSuggestionService(db), nil), db, &requests
+}
+
+func TestAssistService_DraftWithCitationsAndFeedback(t *testing.T) {
+	svc, db, requests := newAssistTestService(t, "您好，退款会在 3 个工作日内原路退回 [2]，审核通过后即处理 [1]。")
+	ctx := context.Background()
+	ticketID := uint(2)
+
+	res, err := svc.Draft(ctx, &AssistDraftRequest{TicketID: &ticketID, Instructions: "语气温和"}, 99)
+	if err != nil {
+		t.Fatalf("draft: %v", err)
+	}
+	if len(res.Sources) != 2 || res.Sources[0].Type != "knowledge_doc" || res.Sources[1].Type != "ticket" || res.Sources[1].ID != 1 {
+		t.Fatalf("sources = %+v", res.Sources)
+	}
+	if len(res.Citations) != 2 || res.Citations[0].Index != 2 || res.Citations[1].Title != "退款政策" {
+		t.Fatalf("citations = %+v", res.Citations)
+	}
+	msgs := (*requests)[0]
+	system, user := msgs[0].Content, msgs[1].Content
+	if !strings.Contains(system, "[1] 退款政策") || !strings.Contains(system, "[2] 工单 #1") || !strings.Contains(system, "原路退回") || strings.Contains(system, "内部备注") {
+		t.Fatalf("system prompt = %s", system)
+	}
+	for _, want := range []string{"工单 #2", "客户: 我昨天又问了一次退款", "客户: 退款还没到账", "坐席补充要求：语气温和"} {
+		if !strings.Contains(user, want) {
+			t.Fatalf("user prompt missing %q: %s", want, user)
+		}
+	}
+
+	var row models.AIDraft
+	db.First(&row, res.DraftID)
+	if row.Kind != AIDraftKindDraft || row.TicketID == nil || *row.TicketID != 2 || row.SessionID != "s1" || row.AgentID != 99 || row.Status != AIDraftPending {
+		t.Fatalf("draft row = %+v", row)
+	}
+
+	// 采纳：编辑距离按去掉引用标记后的草稿计算
+	final := "您好，退款会在 3 个工作日内原路退回，审核通过后立即处理。"
+	got, err := svc.Feedback(ctx, res.DraftID, &AssistFeedbackRequest{Accepted: true, FinalText: final})
+	if err != nil || got.Status != AIDraftAccepted || got.EditDistance == nil || *got.EditDistance != 1 {
+		t.Fatalf("feedback = %+v %v", got, err)
+	}
+	if _, err := svc.Feedback(ctx, res.DraftID, &AssistFeedbackRequest{}); !errors.Is(err, ErrAIDraftResolved) {
+		t.Fatalf("second feedback err = %v", err)
+	}
+
+	stats, err := svc.Stats(ctx, nil, nil)
+	if err != nil || stats[0].Kind != AIDraftKindDraft || stats[0].Total != 1 || stats[0].AcceptanceRate != 1 || stats[0].AvgEditDistance == nil || *stats[0].AvgEditDistance != 1 {
+		t.Fatalf("stats = %+v %v", stats, err)
+	}
+
+	if _, err := svc.Draft(ctx, &AssistDraftRequest{}, 99); !errors.Is(err, ErrAssistInvalid) {
+		t.Fatalf("empty draft err = %v", err)
+	}
+	missing := uint(404)
+	if _, err := svc.Draft(ctx, &AssistDraftRequest{TicketID: &missing}, 99); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("missing ticket err = %v", err)
+	}
+}
+
+func TestAssistService_Rewrite(t *testing.T) {
+	svc, db, requests := newAssistTestService(t, "Your refund is on its way.")
+	ctx := context.Background()
+
+	res, err := svc.Rewrite(ctx, &AssistRewriteRequest{Text: "退款在路上了", Operation: AssistRewriteTranslate, SessionID: "s-en"}, 99)
+	if err != nil || res.Text != "Your refund is on its way." || res.Locale != "en" {
+		t.Fatalf("translate = %+v %v", res, err)
+	}
+	msgs := (*requests)[0]
+	if !strings.Contains(msgs[0].Content, "翻译为English") || msgs[1].Content != "退款在路上了" {
+		t.Fatalf("translate prompt = %+v", msgs)
+	}
+	var row models.AIDraft
+	db.First(&row, res.DraftID)
+	if row.Kind != AIDraftKindRewrite || row.Operation != AssistRewriteTranslate || row.Input != "退款在路上了" || row.SessionID != "s-en" {
+		t.Fatalf("rewrite row = %+v", row)
+	}
+
+	if _, err := svc.Rewrite(ctx, &AssistRewriteRequest{Text: "hi", Operation: "poem"}, 99); !errors.Is(err, ErrAssistInvalid) {
+		t.Fatalf("unknown op err = %v", err)
+	}
+	if _, err := svc.Rewrite(ctx, &AssistRewriteRequest{Text: "hi", Operation: AssistRewriteTranslate}, 99); !errors.Is(err, ErrAssistInvalid) {
+		t.Fatalf("translate without target err = %v", err)
+	}
+	if _, err := svc.Rewrite(ctx, &AssistRewriteRequest{Text: "你们这个问题早就说过了", Operation: AssistRewriteFixTone}, 99); err != nil {
+		t.Fatalf("fix tone: %v", err)
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"kitten", "sitting", 3},
+		{"退款到账", "退款已到账", 1},
+		{"", "abc", 3},
+		{"same", "same", 0},
+	}
+	for _, c := range cases {
+		if got := editDistance(c.a, c.b); got != c.want {
+			t.Fatalf("editDistance(%q, %q) = %d, want %d", c.a, c.b, got, c.want)
+		}
+	}
+}
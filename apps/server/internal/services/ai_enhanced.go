@@ -35,6 +35,8 @@ type AIMetrics struct {
 	SuccessCount       int64         `json:"success_count"`
 	WeKnoraUsageCount  int64         `json:"weknora_usage_count"`
 	FallbackUsageCount int64         `json:"fallback_usage_count"`
+	PromptTokens       int64         `json:"prompt_tokens"`
+	CompletionTokens   int64         `json:"completion_tokens"`
 	AverageLatency     time.Duration `json:"average_latency"`
 	WeKnoraLatency     time.Duration `json:"weknora_latency"`
 	OpenAILatency      time.Duration `json:"openai_latency"`
@@ -78,7 +80,7 @@ func (s *EnhancedAIService) ProcessQueryEnhanced(ctx context.Context, query stri
 	s.metrics.QueryCount++
 
 	// 检查是否需要转人工
-	if s.ShouldTransferToHuman(query, nil) {
+	if s.EvaluateHandoff(ctx, sessionID, query, nil).Transfer {
 		return &EnhancedAIResponse{
 			AIResponse: &AIResponse{
 				Content:    "我来为您转接人工客服，请稍等...",
@@ -99,13 +101,14 @@ func (s *EnhancedAIService) ProcessQueryEnhanced(ctx context.Context, query stri
 		strategy = "fallback"
 	}
 
-	// 构建增强 prompt
-	prompt := s.buildEnhancedPrompt(query, docs)
+	// 构建增强对话：系统提示（含检索结果）+ 会话历史 + 当前问题
+	messages := s.buildChatMessages(ctx, sessionID, s.systemPrompt(ctx, PromptAnswerEnhanced, sessionID, query, docs), query)
 
-	// 调用 OpenAI
-	response, err := s.callOpenAI(ctx, prompt)
+	// 调用模型（可能先调用工具）
+	response, usage, err := s.answer(ctx, sessionID, messages, nil)
+	s.addTokens(usage)
 	if err != nil {
-		s.logger.Errorf("OpenAI call failed: %v", err)
+		s.logger.Errorf("LLM call failed: %v", err)
 		// 使用降级响应
 		response = s.getFallbackResponse(query)
 		strategy = "fallback"
@@ -116,15 +119,20 @@ func (s *EnhancedAIService) ProcessQueryEnhanced(ctx context.Context, query stri
 	duration := time.Since(startTime)
 	s.metrics.AverageLatency = (s.metrics.AverageLatency + duration) / 2
 
+	confidence := s.calculateConfidence(docs, strategy)
+	s.observeConfidence(sessionID, confidence)
+
 	// 构建响应
 	enhancedResp := &EnhancedAIResponse{
 		AIResponse: &AIResponse{
-			Content:    response,
-			Source:     "ai",
-			Confidence: s.calculateConfidence(docs, strategy),
+			Content:         response,
+			Source:          "ai",
+			Confidence:      confidence,
+			KnowledgeDocIDs: knowledgeDocIDs(docs),
 		},
-		Strategy: strategy,
-		Duration: duration,
+		Strategy:   strategy,
+		Duration:   duration,
+		TokensUsed: usage.PromptTokens + usage.CompletionTokens,
 	}
 
 	// 如果使用了 WeKnora，添加来源信息
@@ -135,6 +143,62 @@ func (s *EnhancedAIService) ProcessQueryEnhanced(ctx context.Context, query stri
 	return enhancedResp, nil
 }
 
+// ProcessQueryStream 增强查询的流式版本：检索知识后流式生成；生成前失败时以降级回复作为唯一增量
+func (s *EnhancedAIService) ProcessQueryStream(ctx context.Context, query string, sessionID string, onDelta func(string)) (*AIResponse, error) {
+	startTime := time.Now()
+	s.metrics.QueryCount++
+
+	if s.EvaluateHandoff(ctx, sessionID, query, nil).Transfer {
+		content := "我来为您转接人工客服，请稍等..."
+		onDelta(content)
+		return &AIResponse{Content: content, Source: "system", Confidence: 1.0}, nil
+	}
+
+	docs, strategy, err := s.retrieveKnowledge(ctx, query)
+	if err != nil {
+		s.logger.Errorf("Knowledge retrieval failed: %v", err)
+		docs = []models.KnowledgeDoc{}
+		strategy = "fallback"
+	}
+
+	messages := s.buildChatMessages(ctx, sessionID, s.systemPrompt(ctx, PromptAnswerEnhanced, sessionID, query, docs), query)
+	streamed := false
+	response, usage, err := s.answer(ctx, sessionID, messages, func(delta string) {
+		streamed = true
+		onDelta(delta)
+	})
+	s.addTokens(usage)
+	if err != nil {
+		if ctx.Err() != nil || streamed {
+			// 已取消，或已向客户输出部分内容：不再拼接降级回复
+			return nil, fmt.Errorf("stream interrupted: %w", err)
+		}
+		s.logger.Errorf("LLM stream failed: %v", err)
+		response = s.getFallbackResponse(query)
+		onDelta(response)
+		strategy = "fallback"
+	} else {
+		s.metrics.SuccessCount++
+	}
+
+	duration := time.Since(startTime)
+	s.metrics.AverageLatency = (s.metrics.AverageLatency + duration) / 2
+	confidence := s.calculateConfidence(docs, strategy)
+	s.observeConfidence(sessionID, confidence)
+	return &AIResponse{
+		Content:         response,
+		Source:          "ai",
+		Confidence:      confidence,
+		KnowledgeDocIDs: knowledgeDocIDs(docs),
+	}, nil
+}
+
+// addTokens 累计模型用量指标
+func (s *EnhancedAIService) addTokens(u LLMUsage) {
+	s.metrics.PromptTokens += int64(u.PromptTokens)
+	s.metrics.CompletionTokens += int64(u.CompletionTokens)
+}
+
 // retrieveKnowledge 知识检索（WeKnora + 降级）
 func (s *EnhancedAIService) retrieveKnowledge(ctx context.Context, query string) ([]models.KnowledgeDoc, string, error) {
 	// 尝试 WeKnora 检索
@@ -156,7 +220,7 @@ func (s *EnhancedAIService) retrieveKnowledge(ctx context.Context, query string)
 	// 降级到原知识库
 	if s.fallbackEnabled {
 		s.logger.Info("Using fallback knowledge base")
-		docs := s.knowledgeBase.Search(query, 3)
+		docs := s.searchKnowledge(ctx, query, 3)
 		s.metrics.FallbackUsageCount++
 		return docs, "fallback", nil
 	}
@@ -169,7 +233,7 @@ func (s *EnhancedAIService) searchWithWeKnora(ctx context.Context, query string)
 	startTime := time.Now()
 
 	searchReq := &weknora.SearchRequest{
-		Query:           query,
+		Query:           s.redactor.Mask(query),
 		KnowledgeBaseID: s.knowledgeBaseID,
 		Limit:           5,
 		Threshold:       0.7,
@@ -203,33 +267,13 @@ func (s *EnhancedAIService) searchWithWeKnora(ctx context.Context, query string)
 	return docs, nil
 }
 
-// buildEnhancedPrompt 构建增强的提示词
-func (s *EnhancedAIService) buildEnhancedPrompt(query string, docs []models.KnowledgeDoc) string {
-	var prompt strings.Builder
-
-	prompt.WriteString("你是 Servify 智能客服助手，请根据以下知识库信息回答用户问题。\n\n")
-
-	if len(docs) > 0 {
-		prompt.WriteString("🔍 相关知识库信息：\n")
-		for i, doc := range docs {
-			prompt.WriteString(fmt.Sprintf("%d. 📄 %s\n", i+1, doc.Title))
-			prompt.WriteString(fmt.Sprintf("   📝 %s\n\n", doc.Content))
-		}
-	} else {
-		prompt.WriteString("ℹ️ 注意：当前没有找到相关的知识库信息，请基于一般常识回答。\n\n")
+// PreviewPrompt 以增强检索结果渲染提示词预览
+func (s *EnhancedAIService) PreviewPrompt(ctx context.Context, req PromptPreviewRequest) (*PromptPreview, error) {
+	docs, _, err := s.retrieveKnowledge(ctx, req.Query)
+	if err != nil {
+		docs = nil
 	}
-
-	prompt.WriteString("📋 回答要求：\n")
-	prompt.WriteString("1. ✅ 优先基于知识库信息提供准确回答\n")
-	prompt.WriteString("2. 🔍 如果知识库信息不足，请诚实说明并提供一般性建议\n")
-	prompt.WriteString("3. 😊 保持友好、专业的语气\n")
-	prompt.WriteString("4. 🆘 如果问题超出能力范围，建议转人工客服\n")
-	prompt.WriteString("5. 🎯 回答要简洁明了，避免冗长\n\n")
-
-	prompt.WriteString(fmt.Sprintf("❓ 用户问题：%s\n\n", query))
-	prompt.WriteString("💬 请用中文回答：")
-
-	return prompt.String()
+	return s.previewPrompt(ctx, req, PromptAnswerEnhanced, docs)
 }
 
 // calculateConfidence 计算置信度
@@ -315,6 +359,7 @@ func (s *EnhancedAIService) GetStatus(ctx context.Context) map[string]interface{
 		"weknora_enabled":  s.weKnoraEnabled,
 		"fallback_enabled": s.fallbackEnabled,
 		"metrics":          s.metrics,
+		"llm":              s.llm.Status(),
 	}
 
 	// 检查 WeKnora 健康状态
@@ -336,6 +381,12 @@ func (s *EnhancedAIService) GetStatus(ctx context.Context) map[string]interface{
 		"state":         s.circuitBreaker.State(),
 		"failure_count": s.circuitBreaker.FailureCount(),
 	}
+	if s.semantic != nil {
+		status["knowledge_search"] = s.semantic.Status(ctx)
+	}
+	if s.usage != nil {
+		status["budget"] = s.usage.Budget(ctx)
+	}
 
 	return status
 }
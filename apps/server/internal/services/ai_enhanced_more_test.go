@@ -32,9 +32,9 @@ func TestEnhancedAI_CalculateConfidence(t *testing.T) {
 func TestEnhancedAI_BuildEnhancedPrompt(t *testing.T) {
 	s := newEnhancedForUnit()
 	docs := []models.KnowledgeDoc{{Title: "Doc1", Content: "Content1"}}
-	p := s.buildEnhancedPrompt("你好？", docs)
-	if !strings.Contains(p, "Doc1") || !strings.Contains(p, "Content1") || !strings.Contains(p, "你好") {
-		t.Fatalf("prompt should contain docs and query, got: %s", p)
+	p := s.systemPrompt(context.Background(), PromptAnswerEnhanced, "", "你好？", docs)
+	if !strings.Contains(p, "Doc1") || !strings.Contains(p, "Content1") {
+		t.Fatalf("prompt should contain docs, got: %s", p)
 	}
 }
 
@@ -0,0 +1,698 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"servify/apps/server/internal/models"
+)
+
+var (
+	// ErrAIEvalInvalid 问题集或运行参数不合法
+	ErrAIEvalInvalid = errors.New("invalid eval request")
+	// ErrAIEvalConflict 问题集重名，或对比的运行未完成、不属于同一问题集
+	ErrAIEvalConflict = errors.New("eval conflict")
+)
+
+// AIEvalConfig 离线评测配置
+type AIEvalConfig struct {
+	Threshold float64       // 用例得分不低于该值为通过，默认 0.7
+	Timeout   time.Duration // 单个用例（回答与评审）超时，默认 60s
+}
+
+// AIEvalCaseInput 用例；keywords、pattern、expected_doc_ids 至少设置一项，或提供 expected_answer 供模型评审
+type AIEvalCaseInput struct {
+	Question       string   `json:"question"`
+	ExpectedAnswer string   `json:"expected_answer,omitempty"`
+	Keywords       []string `json:"keywords,omitempty"`
+	Pattern        string   `json:"pattern,omitempty"`
+	ExpectedDocIDs []uint   `json:"expected_doc_ids,omitempty"`
+}
+
+// AIEvalSetRequest 新建或替换问题集（用例整体替换）
+type AIEvalSetRequest struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Cases       []AIEvalCaseInput `json:"cases"`
+}
+
+// AIEvalRunRequest 运行参数；threshold 为 0 时使用配置值
+type AIEvalRunRequest struct {
+	Label     string  `json:"label"`
+	Judge     bool    `json:"judge"`
+	Threshold float64 `json:"threshold"`
+}
+
+// AIEvalReport 运行报告
+type AIEvalReport struct {
+	Run     *models.AIEvalRun     `json:"run"`
+	Results []models.AIEvalResult `json:"results"`
+}
+
+// AIEvalCaseDiff 同一用例在两次运行中的得分变化
+type AIEvalCaseDiff struct {
+	CaseID     uint    `json:"case_id"`
+	Question   string  `json:"question"`
+	BaseScore  float64 `json:"base_score"`
+	HeadScore  float64 `json:"head_score"`
+	BasePassed bool    `json:"base_passed"`
+	HeadPassed bool    `json:"head_passed"`
+	Change     string  `json:"change"` // improved, regressed, unchanged
+}
+
+// AIEvalComparison 两次运行的指标差值（head - base）；任一运行缺少某项指标时该差值为空
+type AIEvalComparison struct {
+	Base                 *models.AIEvalRun `json:"base"`
+	Head                 *models.AIEvalRun `json:"head"`
+	ScoreDelta           float64           `json:"score_delta"`
+	PassRateDelta        float64           `json:"pass_rate_delta"`
+	KeywordScoreDelta    *float64          `json:"keyword_score_delta,omitempty"`
+	PatternPassRateDelta *float64          `json:"pattern_pass_rate_delta,omitempty"`
+	CitationHitRateDelta *float64          `json:"citation_hit_rate_delta,omitempty"`
+	JudgeScoreDelta      *float64          `json:"judge_score_delta,omitempty"`
+	Improved             int               `json:"improved"`
+	Regressed            int               `json:"regressed"`
+	Cases                []AIEvalCaseDiff  `json:"cases"`
+}
+
+// AIEvalService 以标准问题集离线评测 AI 回答：关键词/正则匹配、期望知识库文档的命中率及可选的模型评审，
+// 运行时记录提示词模板与知识库版本，用于上线前对比
+type AIEvalService struct {
+	db     *gorm.DB
+	ai     AIServiceInterface
+	judge  *AIService // 模型评审（eval 场景）；为空时不支持评审
+	cfg    AIEvalConfig
+	logger *logrus.Logger
+}
+
+// NewAIEvalService 创建评测服务
+func NewAIEvalService(db *gorm.DB, ai AIServiceInterface, judge *AIService, cfg AIEvalConfig, logger *logrus.Logger) *AIEvalService {
+	if logger == nil {
+		logger = logrus.New()
+	}
+	if cfg.Threshold <= 0 {
+		cfg.Threshold = 0.7
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 60 * time.Second
+	}
+	return &AIEvalService{db: db, ai: ai, judge: judge, cfg: cfg, logger: logger}
+}
+
+// ListSets 问题集列表（不含用例）
+func (s *AIEvalService) ListSets(ctx context.Context) ([]models.AIEvalSet, error) {
+	var rows []models.AIEvalSet
+	if err := s.db.WithContext(ctx).Order("name").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// GetSet 问题集及用例
+func (s *AIEvalService) GetSet(ctx context.Context, id uint) (*models.AIEvalSet, error) {
+	var row models.AIEvalSet
+	if err := s.db.WithContext(ctx).Preload("Cases", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).First(&row, id).Error; err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
+
+// CreateSet 新建问题集
+func (s *AIEvalService) CreateSet(ctx context.Context, req *AIEvalSetRequest) (*models.AIEvalSet, error) {
+	cases, err := evalCases(req)
+	if err != nil {
+		return nil, err
+	}
+	row := &models.AIEvalSet{Name: strings.TrimSpace(req.Name), Description: req.Description, Cases: cases}
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var n int64
+		if err := tx.Model(&models.AIEvalSet{}).Where("name = ?", row.Name).Count(&n).Error; err != nil {
+			return err
+		}
+		if n > 0 {
+			return fmt.Errorf("%w: eval set %q already exists", ErrAIEvalConflict, row.Name)
+		}
+		return tx.Create(row).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return row, nil
+}
+
+// UpdateSet 修改名称与说明并整体替换用例；历史运行结果保留
+func (s *AIEvalService) UpdateSet(ctx context.Context, id uint, req *AIEvalSetRequest) (*models.AIEvalSet, error) {
+	cases, err := evalCases(req)
+	if err != nil {
+		return nil, err
+	}
+	var row models.AIEvalSet
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&row, id).Error; err != nil {
+			return err
+		}
+		name := strings.TrimSpace(req.Name)
+		var n int64
+		if err := tx.Model(&models.AIEvalSet{}).Where("name = ? AND id <> ?", name, id).Count(&n).Error; err != nil {
+			return err
+		}
+		if n > 0 {
+			return fmt.Errorf("%w: eval set %q already exists", ErrAIEvalConflict, name)
+		}
+		row.Name, row.Description = name, req.Description
+		if err := tx.Save(&row).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("set_id = ?", id).Delete(&models.AIEvalCase{}).Error; err != nil {
+			return err
+		}
+		for i := range cases {
+			cases[i].SetID = id
+		}
+		row.Cases = cases
+		return tx.Create(&row.Cases).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
+
+// ImportSet 按名称导入：不存在时新建，存在时替换用例
+func (s *AIEvalService) ImportSet(ctx context.Context, req *AIEvalSetRequest) (*models.AIEvalSet, error) {
+	if req == nil {
+		return nil, fmt.Errorf("%w: name required", ErrAIEvalInvalid)
+	}
+	var existing models.AIEvalSet
+	err := s.db.WithContext(ctx).Where("name = ?", strings.TrimSpace(req.Name)).First(&existing).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return s.CreateSet(ctx, req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.UpdateSet(ctx, existing.ID, req)
+}
+
+// DeleteSet 删除问题集及用例；历史运行结果保留
+func (s *AIEvalService) DeleteSet(ctx context.Context, id uint) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Delete(&models.AIEvalSet{}, id)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Where("set_id = ?", id).Delete(&models.AIEvalCase{}).Error
+	})
+}
+
+// evalCases 校验并转换用例
+func evalCases(req *AIEvalSetRequest) ([]models.AIEvalCase, error) {
+	if req == nil || strings.TrimSpace(req.Name) == "" {
+		return nil, fmt.Errorf("%w: name required", ErrAIEvalInvalid)
+	}
+	if len(req.Cases) == 0 {
+		return nil, fmt.Errorf("%w: at least one case required", ErrAIEvalInvalid)
+	}
+	cases := make([]models.AIEvalCase, 0, len(req.Cases))
+	for i, in := range req.Cases {
+		q := strings.TrimSpace(in.Question)
+		if q == "" {
+			return nil, fmt.Errorf("%w: case %d: question required", ErrAIEvalInvalid, i+1)
+		}
+		if in.Pattern != "" {
+			if _, err := regexp.Compile(in.Pattern); err != nil {
+				return nil, fmt.Errorf("%w: case %d: invalid pattern: %v", ErrAIEvalInvalid, i+1, err)
+			}
+		}
+		keywords := make([]string, 0, len(in.Keywords))
+		for _, k := range in.Keywords {
+			if k = strings.TrimSpace(k); k != "" {
+				if strings.Contains(k, ",") {
+					return nil, fmt.Errorf("%w: case %d: keyword %q must not contain commas", ErrAIEvalInvalid, i+1, k)
+				}
+				keywords = append(keywords, k)
+			}
+		}
+		docIDs := make([]string, 0, len(in.ExpectedDocIDs))
+		for _, id := range in.ExpectedDocIDs {
+			if id != 0 {
+				docIDs = append(docIDs, strconv.FormatUint(uint64(id), 10))
+			}
+		}
+		if len(keywords) == 0 && in.Pattern == "" && len(docIDs) == 0 && strings.TrimSpace(in.ExpectedAnswer) == "" {
+			return nil, fmt.Errorf("%w: case %d: keywords, pattern, expected_doc_ids or expected_answer required", ErrAIEvalInvalid, i+1)
+		}
+		cases = append(cases, models.AIEvalCase{
+			Question:       q,
+			ExpectedAnswer: strings.TrimSpace(in.ExpectedAnswer),
+			Keywords:       strings.Join(keywords, ","),
+			Pattern:        in.Pattern,
+			ExpectedDocIDs: strings.Join(docIDs, ","),
+		})
+	}
+	return cases, nil
+}
+
+// StartRun 创建运行记录并记录当前提示词模板与知识库版本；用例由 Execute 执行
+func (s *AIEvalService) StartRun(ctx context.Context, setID uint, req AIEvalRunRequest) (*models.AIEvalRun, error) {
+	if s.ai == nil {
+		return nil, fmt.Errorf("%w: AI service unavailable", ErrAIEvalInvalid)
+	}
+	if req.Threshold < 0 || req.Threshold > 1 {
+		return nil, fmt.Errorf("%w: threshold must be between 0 and 1", ErrAIEvalInvalid)
+	}
+	if req.Judge && (s.judge == nil || !s.judge.LLM().HasProviders()) {
+		return nil, ErrNoLLMProvider
+	}
+	var n int64
+	if err := s.db.WithContext(ctx).Model(&models.AIEvalSet{}).Where("id = ?", setID).Count(&n).Error; err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	threshold := req.Threshold
+	if threshold == 0 {
+		threshold = s.cfg.Threshold
+	}
+	run := &models.AIEvalRun{
+		SetID:            setID,
+		Label:            strings.TrimSpace(req.Label),
+		Status:           "running",
+		Judge:            req.Judge,
+		Threshold:        threshold,
+		PromptVersions:   s.promptVersions(ctx),
+		KnowledgeVersion: s.knowledgeVersion(ctx),
+	}
+	if err := s.db.WithContext(ctx).Create(run).Error; err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// Run 同步执行整个问题集（CLI 使用）
+func (s *AIEvalService) Run(ctx context.Context, setID uint, req AIEvalRunRequest) (*AIEvalReport, error) {
+	run, err := s.StartRun(ctx, setID, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Execute(ctx, run.ID); err != nil {
+		return nil, err
+	}
+	return s.GetRun(ctx, run.ID)
+}
+
+// Execute 依次执行用例并汇总；出错时运行标记为 failed
+func (s *AIEvalService) Execute(ctx context.Context, runID uint) error {
+	var run models.AIEvalRun
+	if err := s.db.WithContext(ctx).First(&run, runID).Error; err != nil {
+		return err
+	}
+	err := s.execute(ctx, &run)
+	if err != nil {
+		run.Status = "failed"
+		run.Error = err.Error()
+	} else {
+		run.Status = "completed"
+	}
+	now := time.Now()
+	run.FinishedAt = &now
+	// ctx 可能已取消，仍需写入最终状态
+	if saveErr := s.db.Save(&run).Error; saveErr != nil {
+		s.logger.Errorf("eval: save run %d failed: %v", run.ID, saveErr)
+		if err == nil {
+			err = saveErr
+		}
+	}
+	return err
+}
+
+// ExecuteAsync 后台执行运行，失败仅记录日志（结果见运行状态）
+func (s *AIEvalService) ExecuteAsync(runID uint) {
+	go func() {
+		if err := s.Execute(context.Background(), runID); err != nil {
+			s.logger.Warnf("eval: run %d failed: %v", runID, err)
+		}
+	}()
+}
+
+func (s *AIEvalService) execute(ctx context.Context, run *models.AIEvalRun) error {
+	var cases []models.AIEvalCase
+	if err := s.db.WithContext(ctx).Where("set_id = ?", run.SetID).Order("id").Find(&cases).Error; err != nil {
+		return err
+	}
+	if len(cases) == 0 {
+		return fmt.Errorf("%w: eval set %d has no cases", ErrAIEvalInvalid, run.SetID)
+	}
+	results := make([]models.AIEvalResult, 0, len(cases))
+	for _, c := range cases {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		r := s.evaluateCase(ctx, run, c)
+		if err := s.db.WithContext(ctx).Create(&r).Error; err != nil {
+			return fmt.Errorf("failed to save eval result: %w", err)
+		}
+		results = append(results, r)
+	}
+	summarizeEvalRun(run, results)
+	return nil
+}
+
+// evaluateCase 以独立的会话 ID 提问并评分；回答失败的用例记为 0 分
+func (s *AIEvalService) evaluateCase(ctx context.Context, run *models.AIEvalRun, c models.AIEvalCase) models.AIEvalResult {
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.Timeout)
+	defer cancel()
+	r := models.AIEvalResult{RunID: run.ID, CaseID: c.ID, Question: c.Question}
+	sessionID := fmt.Sprintf("eval-%d-%d", run.ID, c.ID)
+	ctx = withUsageSession(ctx, sessionID)
+
+	start := time.Now()
+	resp, err := s.answer(ctx, c.Question, sessionID)
+	r.LatencyMS = time.Since(start).Milliseconds()
+	if err != nil {
+		r.Error = err.Error()
+		return r
+	}
+	r.Answer = resp.Content
+	cited := make([]string, 0, len(resp.KnowledgeDocIDs))
+	for _, id := range resp.KnowledgeDocIDs {
+		cited = append(cited, strconv.FormatUint(uint64(id), 10))
+	}
+	r.CitedDocIDs = strings.Join(cited, ",")
+
+	var scores []float64
+	if keywords := splitEvalList(c.Keywords); len(keywords) > 0 {
+		v := keywordScore(resp.Content, keywords)
+		r.KeywordScore = &v
+		scores = append(scores, v)
+	}
+	if c.Pattern != "" {
+		re, err := regexp.Compile(c.Pattern)
+		matched := err == nil && re.MatchString(resp.Content)
+		r.PatternMatch = &matched
+		scores = append(scores, boolScore(matched))
+	}
+	if expected := splitEvalList(c.ExpectedDocIDs); len(expected) > 0 {
+		v := citationHit(expected, cited)
+		r.CitationHit = &v
+		scores = append(scores, v)
+	}
+	if run.Judge {
+		score, reason, err := s.judgeAnswer(ctx, c, resp.Content)
+		if err != nil {
+			r.Error = "judge: " + err.Error()
+		} else {
+			r.JudgeScore, r.JudgeReason = &score, reason
+			scores = append(scores, score)
+		}
+	}
+	if len(scores) == 0 {
+		if r.Error == "" {
+			r.Error = "no scoring criteria (expected_answer requires judge)"
+		}
+		return r
+	}
+	r.Score = mean(scores)
+	r.Passed = r.Score >= run.Threshold
+	return r
+}
+
+// answer 与线上回答保持一致：增强服务走 WeKnora 检索与降级流程
+func (s *AIEvalService) answer(ctx context.Context, query, sessionID string) (*AIResponse, error) {
+	if enhanced, ok := s.ai.(EnhancedAIServiceInterface); ok {
+		resp, err := enhanced.ProcessQueryEnhanced(ctx, query, sessionID)
+		if err != nil {
+			return nil, err
+		}
+		return resp.AIResponse, nil
+	}
+	return s.ai.ProcessQuery(ctx, query, sessionID)
+}
+
+const evalJudgePrompt = `你是客服回答质量评审。根据客户问题与参考答案（可能为空）评估 AI 回答的正确性、完整性与相关性，给出 0 到 1 的分数：
+1 表示完全正确且覆盖参考答案要点，0 表示错误或答非所问。只输出 JSON，不要其他内容，格式：{"score":0.8,"reason":"一句话说明"}`
+
+// judgeAnswer 模型评审（eval 场景）
+func (s *AIEvalService) judgeAnswer(ctx context.Context, c models.AIEvalCase, answer string) (float64, string, error) {
+	user := fmt.Sprintf("问题：%s\n参考答案：%s\nAI 回答：%s", c.Question, c.ExpectedAnswer, answer)
+	text, err := s.judge.callLLM(ctx, LLMUseCaseEval, LLMRequest{Messages: []Message{
+		{Role: "system", Content: evalJudgePrompt},
+		{Role: "user", Content: user},
+	}})
+	if err != nil {
+		return 0, "", err
+	}
+	start, end := strings.Index(text, "{"), strings.LastIndex(text, "}")
+	if start < 0 || end <= start {
+		return 0, "", fmt.Errorf("judge response is not JSON: %q", text)
+	}
+	var out struct {
+		Score  float64 `json:"score"`
+		Reason string  `json:"reason"`
+	}
+	if err := json.Unmarshal([]byte(text[start:end+1]), &out); err != nil {
+		return 0, "", fmt.Errorf("invalid judge response: %w", err)
+	}
+	return clampConfidence(out.Score), strings.TrimSpace(out.Reason), nil
+}
+
+// summarizeEvalRun 汇总各项指标；未配置的指标为空
+func summarizeEvalRun(run *models.AIEvalRun, results []models.AIEvalResult) {
+	var keyword, citation, judge, scores []float64
+	var patterns []float64
+	run.CaseCount, run.PassedCount = len(results), 0
+	for _, r := range results {
+		scores = append(scores, r.Score)
+		if r.Passed {
+			run.PassedCount++
+		}
+		if r.KeywordScore != nil {
+			keyword = append(keyword, *r.KeywordScore)
+		}
+		if r.PatternMatch != nil {
+			patterns = append(patterns, boolScore(*r.PatternMatch))
+		}
+		if r.CitationHit != nil {
+			citation = append(citation, *r.CitationHit)
+		}
+		if r.JudgeScore != nil {
+			judge = append(judge, *r.JudgeScore)
+		}
+	}
+	run.Score = mean(scores)
+	run.KeywordScore = meanPtr(keyword)
+	run.PatternPassRate = meanPtr(patterns)
+	run.CitationHitRate = meanPtr(citation)
+	run.JudgeScore = meanPtr(judge)
+}
+
+// promptVersions 当前激活的提示词模板版本，键为 name 或 name/locale
+func (s *AIEvalService) promptVersions(ctx context.Context) string {
+	var rows []models.PromptTemplate
+	if err := s.db.WithContext(ctx).Where("active = ?", true).Find(&rows).Error; err != nil {
+		s.logger.Warnf("eval: load prompt templates failed: %v", err)
+		return ""
+	}
+	versions := make(map[string]int, len(rows))
+	for _, r := range rows {
+		key := r.Name
+		if r.Locale != "" {
+			key += "/" + r.Locale
+		}
+		versions[key] = r.Version
+	}
+	b, _ := json.Marshal(versions)
+	return string(b)
+}
+
+// knowledgeVersion 知识库文档数与最后更新时间
+func (s *AIEvalService) knowledgeVersion(ctx context.Context) string {
+	var count int64
+	var latest models.KnowledgeDoc
+	db := s.db.WithContext(ctx)
+	if err := db.Model(&models.KnowledgeDoc{}).Count(&count).Error; err != nil {
+		s.logger.Warnf("eval: count knowledge docs failed: %v", err)
+		return ""
+	}
+	if count == 0 {
+		return "0"
+	}
+	if err := db.Order("updated_at DESC").First(&latest).Error; err != nil {
+		return strconv.FormatInt(count, 10)
+	}
+	return fmt.Sprintf("%d@%s", count, latest.UpdatedAt.UTC().Format(time.RFC3339))
+}
+
+// ListRuns 运行列表（新的在前）；setID 为 0 时不筛选
+func (s *AIEvalService) ListRuns(ctx context.Context, setID uint, limit int) ([]models.AIEvalRun, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	q := s.db.WithContext(ctx).Order("id DESC").Limit(limit)
+	if setID != 0 {
+		q = q.Where("set_id = ?", setID)
+	}
+	var rows []models.AIEvalRun
+	if err := q.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// GetRun 运行报告及各用例结果
+func (s *AIEvalService) GetRun(ctx context.Context, id uint) (*AIEvalReport, error) {
+	var run models.AIEvalRun
+	if err := s.db.WithContext(ctx).First(&run, id).Error; err != nil {
+		return nil, err
+	}
+	var results []models.AIEvalResult
+	if err := s.db.WithContext(ctx).Where("run_id = ?", id).Order("id").Find(&results).Error; err != nil {
+		return nil, err
+	}
+	return &AIEvalReport{Run: &run, Results: results}, nil
+}
+
+// Compare 对比同一问题集的两次已完成运行（如切换提示词模板或更新知识库前后）
+func (s *AIEvalService) Compare(ctx context.Context, baseID, headID uint) (*AIEvalComparison, error) {
+	base, err := s.GetRun(ctx, baseID)
+	if err != nil {
+		return nil, err
+	}
+	head, err := s.GetRun(ctx, headID)
+	if err != nil {
+		return nil, err
+	}
+	if base.Run.SetID != head.Run.SetID {
+		return nil, fmt.Errorf("%w: runs belong to different eval sets", ErrAIEvalConflict)
+	}
+	if base.Run.Status != "completed" || head.Run.Status != "completed" {
+		return nil, fmt.Errorf("%w: both runs must be completed", ErrAIEvalConflict)
+	}
+	cmp := &AIEvalComparison{
+		Base:                 base.Run,
+		Head:                 head.Run,
+		ScoreDelta:           head.Run.Score - base.Run.Score,
+		PassRateDelta:        passRate(head.Run) - passRate(base.Run),
+		KeywordScoreDelta:    deltaPtr(base.Run.KeywordScore, head.Run.KeywordScore),
+		PatternPassRateDelta: deltaPtr(base.Run.PatternPassRate, head.Run.PatternPassRate),
+		CitationHitRateDelta: deltaPtr(base.Run.CitationHitRate, head.Run.CitationHitRate),
+		JudgeScoreDelta:      deltaPtr(base.Run.JudgeScore, head.Run.JudgeScore),
+		Cases:                []AIEvalCaseDiff{},
+	}
+	baseByCase := make(map[uint]models.AIEvalResult, len(base.Results))
+	for _, r := range base.Results {
+		baseByCase[r.CaseID] = r
+	}
+	for _, h := range head.Results {
+		b, ok := baseByCase[h.CaseID]
+		if !ok {
+			continue
+		}
+		d := AIEvalCaseDiff{
+			CaseID: h.CaseID, Question: h.Question,
+			BaseScore: b.Score, HeadScore: h.Score,
+			BasePassed: b.Passed, HeadPassed: h.Passed,
+			Change: "unchanged",
+		}
+		switch {
+		case h.Passed && !b.Passed, h.Passed == b.Passed && h.Score > b.Score+1e-9:
+			d.Change = "improved"
+			cmp.Improved++
+		case !h.Passed && b.Passed, h.Passed == b.Passed && h.Score < b.Score-1e-9:
+			d.Change = "regressed"
+			cmp.Regressed++
+		}
+		cmp.Cases = append(cmp.Cases, d)
+	}
+	return cmp, nil
+}
+
+func splitEvalList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// keywordScore 回答中出现的关键词比例（不区分大小写）
+func keywordScore(answer string, keywords []string) float64 {
+	lower := strings.ToLower(answer)
+	hit := 0
+	for _, k := range keywords {
+		if strings.Contains(lower, strings.ToLower(k)) {
+			hit++
+		}
+	}
+	return float64(hit) / float64(len(keywords))
+}
+
+// citationHit 期望文档中被回答引用的比例
+func citationHit(expected, cited []string) float64 {
+	hit := 0
+	for _, id := range expected {
+		if slices.Contains(cited, id) {
+			hit++
+		}
+	}
+	return float64(hit) / float64(len(expected))
+}
+
+func boolScore(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func mean(vs []float64) float64 {
+	if len(vs) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, v := range vs {
+		sum += v
+	}
+	return sum / float64(len(vs))
+}
+
+func meanPtr(vs []float64) *float64 {
+	if len(vs) == 0 {
+		return nil
+	}
+	v := mean(vs)
+	return &v
+}
+
+func deltaPtr(base, head *float64) *float64 {
+	if base == nil || head == nil {
+		return nil
+	}
+	v := *head - *base
+	return &v
+}
+
+func passRate(run *models.AIEvalRun) float64 {
+	if run.CaseCount == 0 {
+		return 0
+	}
+	return float64(run.PassedCount) / float64(run.CaseCount)
+}
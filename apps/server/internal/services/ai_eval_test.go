@@ -0,0 +1,154 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"servify/apps/server/internal/models"
+)
+
+func newAIEvalTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:ai_eval_"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.AIEvalSet{}, &models.AIEvalCase{}, &models.AIEvalRun{}, &models.AIEvalResult{},
+		&models.PromptTemplate{}, &models.KnowledgeDoc{}, &models.Message{}); err != nil {
+		t.Fatalf("auto migrate: %v", err)
+	}
+	return db
+}
+
+func TestAIEvalService_RunAndCompare(t *testing.T) {
+	db := newAIEvalTestDB(t)
+	db.Create(&models.KnowledgeDoc{ID: 5, Title: "退货政策", Content: "支持7天无理由退货"})
+	db.Create(&models.PromptTemplate{Name: PromptAnswer, Locale: "zh-CN", Version: 2, Content: "你是 {{.BrandName}} 客服", Active: true})
+
+	invoiceAnswer := "请联系客服"
+	var judged int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req OpenAIRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		reply := invoiceAnswer
+		switch last := req.Messages[len(req.Messages)-1].Content; {
+		case req.Messages[0].Content == evalJudgePrompt:
+			judged++
+			reply = `{"score":1,"reason":"覆盖要点"}`
+		case strings.Contains(last, "退货"):
+			reply = "我们支持 7天 无理由退货"
+		}
+		out, _ := json.Marshal(reply)
+		fmt.Fprintf(w, `{"choices":[{"message":{"role":"assistant","content":%s}}]}`, out)
+	}))
+	defer srv.Close()
+
+	ai := NewAIService("sk", srv.URL)
+	ai.SetDB(db)
+	ai.knowledgeBase.AddDocument(models.KnowledgeDoc{ID: 5, Title: "退货政策", Content: "支持7天无理由退货"})
+	svc := NewAIEvalService(db, ai, ai, AIEvalConfig{}, nil)
+	ctx := context.Background()
+
+	set, err := svc.CreateSet(ctx, &AIEvalSetRequest{Name: "faq", Cases: []AIEvalCaseInput{
+		{Question: "退货", Keywords: []string{"7天", "退货"}, ExpectedDocIDs: []uint{5}},
+		{Question: "发票怎么开", Pattern: `发票`, ExpectedAnswer: "在订单详情页申请电子发票"},
+	}})
+	if err != nil {
+		t.Fatalf("create set: %v", err)
+	}
+	if _, err := svc.CreateSet(ctx, &AIEvalSetRequest{Name: "faq", Cases: []AIEvalCaseInput{{Question: "q", Keywords: []string{"a"}}}}); !errors.Is(err, ErrAIEvalConflict) {
+		t.Fatalf("duplicate name err = %v", err)
+	}
+	if _, err := svc.CreateSet(ctx, &AIEvalSetRequest{Name: "bad", Cases: []AIEvalCaseInput{{Question: "q", Pattern: "("}}}); !errors.Is(err, ErrAIEvalInvalid) {
+		t.Fatalf("invalid pattern err = %v", err)
+	}
+	if _, err := svc.CreateSet(ctx, &AIEvalSetRequest{Name: "empty", Cases: []AIEvalCaseInput{{Question: "q"}}}); !errors.Is(err, ErrAIEvalInvalid) {
+		t.Fatalf("no criteria err = %v", err)
+	}
+
+	base, err := svc.Run(ctx, set.ID, AIEvalRunRequest{Label: "v1"})
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	run := base.Run
+	if run.Status != "completed" || run.CaseCount != 2 || run.PassedCount != 1 || run.Score != 0.5 ||
+		*run.KeywordScore != 1 || *run.PatternPassRate != 0 || *run.CitationHitRate != 1 || run.JudgeScore != nil {
+		t.Fatalf("run = %+v", run)
+	}
+	if run.PromptVersions != `{"answer/zh-CN":2}` || !strings.HasPrefix(run.KnowledgeVersion, "1@") {
+		t.Fatalf("versions = %q %q", run.PromptVersions, run.KnowledgeVersion)
+	}
+	if r := base.Results[0]; !r.Passed || r.CitedDocIDs != "5" || r.Answer != "我们支持 7天 无理由退货" {
+		t.Fatalf("result[0] = %+v", r)
+	}
+	if r := base.Results[1]; r.Passed || r.PatternMatch == nil || *r.PatternMatch || r.CitationHit != nil {
+		t.Fatalf("result[1] = %+v", r)
+	}
+
+	// 修改回答后以模型评审重新运行并对比
+	invoiceAnswer = "可在订单详情页申请电子发票"
+	head, err := svc.Run(ctx, set.ID, AIEvalRunRequest{Label: "v2", Judge: true})
+	if err != nil {
+		t.Fatalf("judge run: %v", err)
+	}
+	if judged != 2 || head.Run.PassedCount != 2 || *head.Run.JudgeScore != 1 || head.Results[1].JudgeReason != "覆盖要点" {
+		t.Fatalf("judge run = %+v results = %+v", head.Run, head.Results)
+	}
+	cmp, err := svc.Compare(ctx, run.ID, head.Run.ID)
+	if err != nil {
+		t.Fatalf("compare: %v", err)
+	}
+	if cmp.ScoreDelta != 0.5 || cmp.PassRateDelta != 0.5 || *cmp.PatternPassRateDelta != 1 || cmp.JudgeScoreDelta != nil ||
+		cmp.Improved != 1 || cmp.Regressed != 0 || cmp.Cases[1].Change != "improved" || cmp.Cases[0].Change != "unchanged" {
+		t.Fatalf("compare = %+v", cmp)
+	}
+
+	// 评审需要可用的模型后端
+	noLLM := NewAIEvalService(db, ai, NewAIService("", ""), AIEvalConfig{}, nil)
+	if _, err := noLLM.StartRun(ctx, set.ID, AIEvalRunRequest{Judge: true}); !errors.Is(err, ErrNoLLMProvider) {
+		t.Fatalf("judge without provider err = %v", err)
+	}
+}
+
+func TestAIEvalService_ImportReplacesCases(t *testing.T) {
+	db := newAIEvalTestDB(t)
+	svc := NewAIEvalService(db, stubAI{reply: "ok"}, nil, AIEvalConfig{Threshold: 0.5}, nil)
+	ctx := context.Background()
+
+	first, err := svc.ImportSet(ctx, &AIEvalSetRequest{Name: "smoke", Cases: []AIEvalCaseInput{{Question: "a", Keywords: []string{"ok"}}}})
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	second, err := svc.ImportSet(ctx, &AIEvalSetRequest{Name: "smoke", Description: "v2", Cases: []AIEvalCaseInput{
+		{Question: "b", Keywords: []string{"OK", "missing"}},
+		{Question: "c", ExpectedAnswer: "需要评审"},
+	}})
+	if err != nil {
+		t.Fatalf("reimport: %v", err)
+	}
+	got, _ := svc.GetSet(ctx, first.ID)
+	if second.ID != first.ID || got.Description != "v2" || len(got.Cases) != 2 || got.Cases[0].Question != "b" {
+		t.Fatalf("set = %+v", got)
+	}
+
+	report, err := svc.Run(ctx, first.ID, AIEvalRunRequest{})
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	// 关键词命中一半即达到 0.5 的阈值；仅有参考答案而未开启评审的用例无法评分
+	if r := report.Results; !r[0].Passed || *r[0].KeywordScore != 0.5 || r[1].Passed || !strings.Contains(r[1].Error, "judge") {
+		t.Fatalf("results = %+v", r)
+	}
+	if _, err := svc.Compare(ctx, report.Run.ID, 999); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("compare missing err = %v", err)
+	}
+}
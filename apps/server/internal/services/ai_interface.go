@@ -11,7 +11,7 @@ type AIServiceInterface interface {
 	ProcessQuery(ctx context.Context, query string, sessionID string) (*AIResponse, error)
 
 	// 转人工判断
-	ShouldTransferToHuman(query string, sessionHistory []models.Message) bool
+	ShouldTransferToHuman(sessionID, query string, sessionHistory []models.Message) bool
 
 	// 会话摘要
 	GetSessionSummary(messages []models.Message) (string, error)
@@ -23,6 +23,12 @@ type AIServiceInterface interface {
 	GetStatus(ctx context.Context) map[string]interface{}
 }
 
+// StreamingAIService 支持增量输出的 AI 服务（可选实现）
+// onDelta 在生成过程中按顺序回调；ctx 取消时中止生成并返回错误
+type StreamingAIService interface {
+	ProcessQueryStream(ctx context.Context, query string, sessionID string, onDelta func(delta string)) (*AIResponse, error)
+}
+
 // EnhancedAIServiceInterface 增强 AI 服务接口（扩展功能）
 type EnhancedAIServiceInterface interface {
 	AIServiceInterface
@@ -50,13 +56,34 @@ var _ EnhancedAIServiceInterface = (*EnhancedAIService)(nil)
 
 // 为原始 AIService 实现基础接口
 func (s *AIService) GetStatus(ctx context.Context) map[string]interface{} {
-	return map[string]interface{}{
+	status := map[string]interface{}{
 		"type":           "standard",
 		"openai_enabled": s.openAIAPIKey != "",
+		"llm":            s.llm.Status(),
 		"knowledge_base": "legacy",
 		"document_count": len(s.knowledgeBase.documents),
 	}
+	if s.semantic != nil {
+		status["knowledge_base"] = "semantic"
+		status["knowledge_search"] = s.semantic.Status(ctx)
+	}
+	if s.usage != nil {
+		status["budget"] = s.usage.Budget(ctx)
+	}
+	return status
 }
 
 // 确保原始 AI 服务也实现了接口
 var _ AIServiceInterface = (*AIService)(nil)
+
+// 两种 AI 服务均支持提示词预览
+var (
+	_ PromptPreviewer = (*AIService)(nil)
+	_ PromptPreviewer = (*EnhancedAIService)(nil)
+)
+
+// 两种 AI 服务均支持流式输出
+var (
+	_ StreamingAIService = (*AIService)(nil)
+	_ StreamingAIService = (*EnhancedAIService)(nil)
+)
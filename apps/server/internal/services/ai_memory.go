@@ -0,0 +1,245 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"servify/apps/server/internal/models"
+)
+
+// ConversationMemoryConfig AI 回答时携带的会话历史；超出预算的较早轮次以摘要代替
+type ConversationMemoryConfig struct {
+	TokenBudget int // 整个提示（系统提示 + 历史 + 当前问题）的 token 预算
+	MaxMessages int // 最多加载的历史消息数
+}
+
+// DefaultConversationMemoryConfig 默认会话记忆配置
+func DefaultConversationMemoryConfig() ConversationMemoryConfig {
+	return ConversationMemoryConfig{TokenBudget: 3000, MaxMessages: 50}
+}
+
+// maxMemorySummarySessions 内存中缓存摘要的会话上限，超出后淘汰任意一个会话（之后按需重新摘要）
+const maxMemorySummarySessions = 10000
+
+// memorySummary 会话较早轮次的摘要，覆盖到 lastID（含）为止的消息
+type memorySummary struct {
+	lastID uint
+	text   string
+}
+
+// SetDB 设置数据库（用于加载会话历史）
+func (s *AIService) SetDB(db *gorm.DB) {
+	s.db = db
+}
+
+// SetMemoryConfig 设置会话记忆参数；零值字段使用默认值
+func (s *AIService) SetMemoryConfig(cfg ConversationMemoryConfig) {
+	def := DefaultConversationMemoryConfig()
+	if cfg.TokenBudget <= 0 {
+		cfg.TokenBudget = def.TokenBudget
+	}
+	if cfg.MaxMessages <= 0 {
+		cfg.MaxMessages = def.MaxMessages
+	}
+	s.memory = cfg
+}
+
+func (s *AIService) memoryConfig() ConversationMemoryConfig {
+	if s.memory.TokenBudget <= 0 {
+		return DefaultConversationMemoryConfig()
+	}
+	return s.memory
+}
+
+// estimateTokens 粗略估算 token 数：中日韩等非 ASCII 字符按 1 个计，ASCII 约 4 个字符 1 个，另加每条消息的固定开销
+func estimateTokens(text string) int {
+	ascii := 0
+	other := 0
+	for _, r := range text {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return other + (ascii+3)/4 + 4
+}
+
+func messagesTokens(msgs []models.Message) int {
+	total := 0
+	for _, m := range msgs {
+		total += estimateTokens(m.Content)
+	}
+	return total
+}
+
+// chatRole 消息发送方映射为对话角色；系统通知不进入历史
+func chatRole(sender string) string {
+	switch sender {
+	case "ai", "agent":
+		return "assistant"
+	case "system":
+		return ""
+	default:
+		return "user"
+	}
+}
+
+// buildChatMessages 组装角色分离的对话：系统提示、（摘要 +）近期历史、当前问题
+func (s *AIService) buildChatMessages(ctx context.Context, sessionID, system, query string) []Message {
+	messages := []Message{{Role: "system", Content: system}}
+	budget := s.memoryConfig().TokenBudget - estimateTokens(system) - estimateTokens(query)
+	messages = append(messages, s.conversationHistory(ctx, sessionID, query, budget)...)
+	return append(messages, Message{Role: "user", Content: query})
+}
+
+// loadHistory 按时间顺序返回会话近期消息，不含本轮问题本身（访客消息会先落库再触发 AI）
+func (s *AIService) loadHistory(ctx context.Context, sessionID, query string) []models.Message {
+	if s.db == nil || sessionID == "" {
+		return nil
+	}
+	var rows []models.Message
+	if err := s.db.WithContext(ctx).
+		Where("session_id = ?", sessionID).
+		Order("created_at DESC, id DESC").
+		Limit(s.memoryConfig().MaxMessages + 1).
+		Find(&rows).Error; err != nil {
+		logrus.Warnf("Failed to load history for session %s: %v", sessionID, err)
+		return nil
+	}
+	if len(rows) > 0 && chatRole(rows[0].Sender) == "user" && strings.TrimSpace(rows[0].Content) == strings.TrimSpace(query) {
+		rows = rows[1:]
+	}
+	if len(rows) > s.memoryConfig().MaxMessages {
+		rows = rows[:s.memoryConfig().MaxMessages]
+	}
+	history := make([]models.Message, 0, len(rows))
+	for i := len(rows) - 1; i >= 0; i-- {
+		if chatRole(rows[i].Sender) != "" && strings.TrimSpace(rows[i].Content) != "" {
+			history = append(history, rows[i])
+		}
+	}
+	return history
+}
+
+// conversationHistory 在预算内选取历史：放得下则全部携带；否则较早轮次合并为摘要，
+// 并一次性多摘要一些（近期部分只保留一半预算），使后续几轮可以复用同一摘要
+func (s *AIService) conversationHistory(ctx context.Context, sessionID, query string, budget int) []Message {
+	history := s.loadHistory(ctx, sessionID, query)
+	if len(history) == 0 || budget <= 0 {
+		return nil
+	}
+	if messagesTokens(history) <= budget {
+		return toChatMessages(history)
+	}
+	if !s.llm.HasProviders() {
+		return toChatMessages(fitRecent(history, budget))
+	}
+
+	reserve := budget / 4
+	prev, hasPrev := s.cachedSummary(sessionID)
+	if hasPrev {
+		tail := messagesAfter(history, prev.lastID)
+		if len(tail) < len(history) && messagesTokens(tail) <= budget-reserve {
+			return append([]Message{summaryMessage(prev.text)}, toChatMessages(tail)...)
+		}
+	}
+
+	recent := fitRecent(history, (budget-reserve)/2)
+	older := history[:len(history)-len(recent)]
+	prevText := ""
+	if hasPrev {
+		older = messagesAfter(older, prev.lastID)
+		prevText = prev.text
+	}
+	if len(older) == 0 {
+		return toChatMessages(fitRecent(history, budget))
+	}
+	text, err := s.summarize(withUsageSession(ctx, sessionID), prevText, older, reserve)
+	if err != nil {
+		logrus.Warnf("Failed to summarize history for session %s: %v", sessionID, err)
+		return toChatMessages(fitRecent(history, budget))
+	}
+	s.storeSummary(sessionID, memorySummary{lastID: older[len(older)-1].ID, text: text})
+	return append([]Message{summaryMessage(text)}, toChatMessages(recent)...)
+}
+
+// fitRecent 从最新消息往前取，直到超出预算
+func fitRecent(history []models.Message, budget int) []models.Message {
+	used := 0
+	start := len(history)
+	for start > 0 {
+		cost := estimateTokens(history[start-1].Content)
+		if used+cost > budget {
+			break
+		}
+		used += cost
+		start--
+	}
+	return history[start:]
+}
+
+func messagesAfter(history []models.Message, id uint) []models.Message {
+	for i, m := range history {
+		if m.ID > id {
+			return history[i:]
+		}
+	}
+	return nil
+}
+
+func toChatMessages(history []models.Message) []Message {
+	out := make([]Message, 0, len(history))
+	for _, m := range history {
+		out = append(out, Message{Role: chatRole(m.Sender), Content: m.Content})
+	}
+	return out
+}
+
+func summaryMessage(text string) Message {
+	return Message{Role: "system", Content: "此前对话摘要：" + text}
+}
+
+func (s *AIService) cachedSummary(sessionID string) (memorySummary, bool) {
+	s.summariesMu.Lock()
+	defer s.summariesMu.Unlock()
+	sum, ok := s.summaries[sessionID]
+	return sum, ok
+}
+
+func (s *AIService) storeSummary(sessionID string, sum memorySummary) {
+	s.summariesMu.Lock()
+	defer s.summariesMu.Unlock()
+	if s.summaries == nil {
+		s.summaries = make(map[string]memorySummary)
+	}
+	if _, ok := s.summaries[sessionID]; !ok && len(s.summaries) >= maxMemorySummarySessions {
+		for id := range s.summaries {
+			delete(s.summaries, id)
+			break
+		}
+	}
+	s.summaries[sessionID] = sum
+}
+
+// summarize 生成会话摘要；prev 非空时在已有摘要基础上增量合并
+func (s *AIService) summarize(ctx context.Context, prev string, messages []models.Message, maxTokens int) (string, error) {
+	conversation := "会话内容：\n"
+	for _, msg := range messages {
+		conversation += fmt.Sprintf("%s: %s\n", msg.Sender, msg.Content)
+	}
+	if prev != "" {
+		conversation = fmt.Sprintf("此前摘要：%s\n\n%s", prev, conversation)
+	}
+	prompt := fmt.Sprintf("请为以下客服会话提供简洁的摘要：\n%s\n\n请用中文总结主要问题和解决方案。", conversation)
+
+	return s.callLLM(ctx, LLMUseCaseSummary, LLMRequest{
+		Messages:  []Message{{Role: "user", Content: prompt}},
+		MaxTokens: maxTokens,
+	})
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"servify/apps/server/internal/models"
+)
+
+func newMemoryTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:memory_"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Message{}); err != nil {
+		t.Fatalf("automigrate: %v", err)
+	}
+	return db
+}
+
+func seedMessages(t *testing.T, db *gorm.DB, sessionID string, msgs [][2]string) {
+	t.Helper()
+	var existing int64
+	db.Model(&models.Message{}).Where("session_id = ?", sessionID).Count(&existing)
+	base := time.Now().Add(-time.Hour).Add(time.Duration(existing) * time.Second)
+	for i, m := range msgs {
+		row := models.Message{SessionID: sessionID, Sender: m[0], Content: m[1], Type: "text", CreatedAt: base.Add(time.Duration(i) * time.Second)}
+		if err := db.Omit("Session", "User").Create(&row).Error; err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+}
+
+// chatStandIn 记录收到的对话请求；摘要请求（以“请为以下客服会话”开头）单独计数
+type chatStandIn struct {
+	mu        sync.Mutex
+	last      []Message
+	summaries int
+}
+
+func (c *chatStandIn) server(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req OpenAIRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if len(req.Messages) == 1 && strings.HasPrefix(req.Messages[0].Content, "请为以下客服会话") {
+			c.summaries++
+			fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"客户在咨询套餐"}}]}`)
+			return
+		}
+		c.last = req.Messages
+		fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"专业版每月 99 元"}}]}`)
+	}))
+}
+
+func TestAIService_ConversationMemory_RoleSeparated(t *testing.T) {
+	db := newMemoryTestDB(t)
+	seedMessages(t, db, "s1", [][2]string{
+		{"user", "你们有哪些套餐？"},
+		{"ai", "我们有基础版和专业版。"},
+		{"system", "坐席已加入会话"},
+		{"user", "那专业版多少钱？"}, // 本轮问题：访客消息已先落库
+	})
+	stand := &chatStandIn{}
+	srv := stand.server(t)
+	defer srv.Close()
+
+	s := NewAIService("k", srv.URL)
+	s.SetDB(db)
+	if _, err := s.ProcessQuery(context.Background(), "那专业版多少钱？", "s1"); err != nil {
+		t.Fatalf("query: %v", err)
+	}
+
+	var roles []string
+	for _, m := range stand.last {
+		roles = append(roles, m.Role)
+	}
+	if strings.Join(roles, ",") != "system,user,assistant,user" {
+		t.Fatalf("roles = %v, messages = %+v", roles, stand.last)
+	}
+	if stand.last[1].Content != "你们有哪些套餐？" || stand.last[3].Content != "那专业版多少钱？" {
+		t.Fatalf("unexpected history: %+v", stand.last)
+	}
+}
+
+func TestAIService_ConversationMemory_SummarizesOlderTurns(t *testing.T) {
+	db := newMemoryTestDB(t)
+	var history [][2]string
+	for i := 0; i < 20; i++ {
+		history = append(history, [2]string{"user", fmt.Sprintf("第%d个问题：%s", i, strings.Repeat("详细描述", 10))})
+		history = append(history, [2]string{"ai", fmt.Sprintf("第%d个回答：%s", i, strings.Repeat("详细解答", 10))})
+	}
+	seedMessages(t, db, "s2", history)
+	stand := &chatStandIn{}
+	srv := stand.server(t)
+	defer srv.Close()
+
+	s := NewAIService("k", srv.URL)
+	s.SetDB(db)
+	s.SetMemoryConfig(ConversationMemoryConfig{TokenBudget: 800})
+	if _, err := s.ProcessQuery(context.Background(), "价格呢？", "s2"); err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if stand.summaries != 1 {
+		t.Fatalf("summary calls = %d", stand.summaries)
+	}
+	if len(stand.last) < 3 || stand.last[1].Role != "system" || !strings.Contains(stand.last[1].Content, "客户在咨询套餐") {
+		t.Fatalf("expected summary message after system prompt: %+v", stand.last)
+	}
+	if last := stand.last[len(stand.last)-2]; !strings.HasPrefix(last.Content, "第19个回答") {
+		t.Fatalf("most recent turn should be kept verbatim, got %+v", last)
+	}
+	total := 0
+	for _, m := range stand.last {
+		total += estimateTokens(m.Content)
+	}
+	if total > 800 {
+		t.Fatalf("prompt exceeds budget: %d tokens", total)
+	}
+
+	// 下一轮复用已有摘要
+	seedMessages(t, db, "s2", [][2]string{{"ai", "专业版每月 99 元"}, {"user", "可以开发票吗？"}})
+	if _, err := s.ProcessQuery(context.Background(), "可以开发票吗？", "s2"); err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if stand.summaries != 1 {
+		t.Fatalf("summary should be reused, calls = %d", stand.summaries)
+	}
+}
+
+func TestAIService_StoreSummaryBounded(t *testing.T) {
+	s := NewAIService("", "")
+	for i := 0; i <= maxMemorySummarySessions; i++ {
+		s.storeSummary(fmt.Sprintf("s%d", i), memorySummary{lastID: uint(i), text: "t"})
+	}
+	if n := len(s.summaries); n != maxMemorySummarySessions {
+		t.Fatalf("summaries = %d, want %d", n, maxMemorySummarySessions)
+	}
+	last := fmt.Sprintf("s%d", maxMemorySummarySessions)
+	if sum, ok := s.cachedSummary(last); !ok || sum.lastID != maxMemorySummarySessions {
+		t.Fatalf("latest summary evicted: %+v %v", sum, ok)
+	}
+	// 更新已缓存的会话不淘汰其他会话
+	s.storeSummary(last, memorySummary{lastID: 1, text: "u"})
+	if n := len(s.summaries); n != maxMemorySummarySessions {
+		t.Fatalf("summaries after update = %d", n)
+	}
+}
@@ -17,7 +17,7 @@ func TestKnowledgeBase_Search_Basic(t *testing.T) {
 
 func TestAIService_ShouldTransfer_Complaint(t *testing.T) {
 	s := NewAIService("", "")
-	if !s.ShouldTransferToHuman("我要投诉你们的服务", nil) {
+	if !s.ShouldTransferToHuman("", "我要投诉你们的服务", nil) {
 		t.Fatalf("expected complaint to transfer")
 	}
 }
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"servify/apps/server/internal/models"
 	"testing"
 )
@@ -8,9 +9,12 @@ import (
 func TestAIService_BuildPrompt_IncludesDocsAndQuery(t *testing.T) {
 	s := NewAIService("", "")
 	docs := []models.KnowledgeDoc{{Title: "Intro", Content: "Servify"}}
-	p := s.buildPrompt("什么是Servify?", docs)
-	if !contains(p, "Intro") || !contains(p, "Servify") || !contains(p, "什么是Servify?") {
-		t.Fatalf("prompt missing expected content: %s", p)
+	msgs := s.buildChatMessages(context.Background(), "", s.systemPrompt(context.Background(), PromptAnswer, "", "什么是Servify?", docs), "什么是Servify?")
+	if len(msgs) != 2 || msgs[0].Role != "system" || msgs[1].Role != "user" {
+		t.Fatalf("unexpected messages: %+v", msgs)
+	}
+	if !contains(msgs[0].Content, "Intro") || !contains(msgs[0].Content, "Servify") || msgs[1].Content != "什么是Servify?" {
+		t.Fatalf("prompt missing expected content: %+v", msgs)
 	}
 }
 
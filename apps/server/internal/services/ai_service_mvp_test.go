@@ -36,10 +36,10 @@ func TestAIService_ProcessQuery_Fallback_NoAPIKey(t *testing.T) {
 
 func TestAIService_ShouldTransferToHuman(t *testing.T) {
 	svc := NewAIService("", "")
-	if !svc.ShouldTransferToHuman("请帮我转人工客服", nil) {
+	if !svc.ShouldTransferToHuman("s1", "请帮我转人工客服", nil) {
 		t.Fatalf("expected true for human transfer keywords")
 	}
-	if svc.ShouldTransferToHuman("简单问题咨询", []models.Message{}) {
+	if svc.ShouldTransferToHuman("s1", "简单问题咨询", []models.Message{}) {
 		t.Fatalf("expected false for normal query")
 	}
 }
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"servify/apps/server/internal/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+// AI 流式回复帧：生成过程中推送 ai-response-delta，完成后推送（并落库）完整的 ai-response；
+// 被新的客户消息打断或超时时推送 ai-response-cancelled
+const (
+	WSEventAIResponseDelta     = "ai-response-delta"
+	WSEventAIResponseCancelled = "ai-response-cancelled"
+)
+
+// aiReplyTimeout 单轮 AI 回复的最长时间
+const aiReplyTimeout = 60 * time.Second
+
+// aiStream 会话内进行中的一轮 AI 生成
+type aiStream struct {
+	id       string
+	cancel   context.CancelFunc
+	reason   string
+	reasonMu sync.Mutex
+}
+
+func (st *aiStream) stop(reason string) {
+	st.reasonMu.Lock()
+	if st.reason == "" {
+		st.reason = reason
+	}
+	st.reasonMu.Unlock()
+	st.cancel()
+}
+
+func (st *aiStream) stopReason() string {
+	st.reasonMu.Lock()
+	defer st.reasonMu.Unlock()
+	return st.reason
+}
+
+// startAIStream 登记会话的新一轮 AI 生成，同时取消尚未完成的上一轮
+func (h *WebSocketHub) startAIStream(sessionID string) (context.Context, *aiStream) {
+	ctx, cancel := context.WithTimeout(context.Background(), aiReplyTimeout)
+	st := &aiStream{id: fmt.Sprintf("ai_%d", time.Now().UnixNano()), cancel: cancel}
+
+	h.aiStreamsMu.Lock()
+	if h.aiStreams == nil {
+		h.aiStreams = make(map[string]*aiStream)
+	}
+	prev := h.aiStreams[sessionID]
+	h.aiStreams[sessionID] = st
+	h.aiStreamsMu.Unlock()
+
+	if prev != nil {
+		prev.stop("superseded")
+	}
+	return ctx, st
+}
+
+// cancelAIStream 客户发来新消息时中止会话内进行中的 AI 生成
+func (h *WebSocketHub) cancelAIStream(sessionID string) {
+	h.aiStreamsMu.Lock()
+	st := h.aiStreams[sessionID]
+	delete(h.aiStreams, sessionID)
+	h.aiStreamsMu.Unlock()
+	if st != nil {
+		st.stop("superseded")
+	}
+}
+
+func (h *WebSocketHub) finishAIStream(sessionID string, st *aiStream) {
+	h.aiStreamsMu.Lock()
+	if h.aiStreams[sessionID] == st {
+		delete(h.aiStreams, sessionID)
+	}
+	h.aiStreamsMu.Unlock()
+	st.cancel()
+}
+
+// replyWithAI 为已登记的一轮生成（startAIStream）产出 AI 回复并推送到会话；支持流式的服务逐段推送增量。
+// 登记在打断前完成，本轮被打断时 ctx 已取消，不会继续生成
+func (h *WebSocketHub) replyWithAI(ctx context.Context, st *aiStream, sessionID, text string, ai AIServiceInterface) {
+	defer h.finishAIStream(sessionID, st)
+
+	var (
+		resp *AIResponse
+		err  error
+	)
+	streamer, streaming := ai.(StreamingAIService)
+	if streaming {
+		index := 0
+		resp, err = streamer.ProcessQueryStream(ctx, text, sessionID, func(delta string) {
+			if ctx.Err() != nil {
+				return
+			}
+			h.SendToSession(sessionID, WebSocketMessage{
+				Type: WSEventAIResponseDelta,
+				Data: map[string]interface{}{
+					"stream_id": st.id,
+					"index":     index,
+					"delta":     delta,
+				},
+			})
+			index++
+		})
+	} else {
+		resp, err = ai.ProcessQuery(ctx, text, sessionID)
+	}
+
+	if ctx.Err() != nil {
+		reason := st.stopReason()
+		if reason == "" {
+			reason = "timeout"
+		}
+		logrus.Infof("AI reply %s for session %s cancelled: %s", st.id, sessionID, reason)
+		h.SendToSession(sessionID, WebSocketMessage{
+			Type: WSEventAIResponseCancelled,
+			Data: map[string]interface{}{"stream_id": st.id, "reason": reason},
+		})
+		return
+	}
+	if err != nil {
+		logrus.Errorf("AI processing failed: %v", err)
+		if streaming {
+			// 客户端可能已展示部分增量，需要告知本轮结束
+			h.SendToSession(sessionID, WebSocketMessage{
+				Type: WSEventAIResponseCancelled,
+				Data: map[string]interface{}{"stream_id": st.id, "reason": "error"},
+			})
+		}
+		return
+	}
+
+	// 最终帧：完整内容落库，与非流式回复格式一致
+	h.SendPersisted(sessionID, &models.Message{Content: resp.Content, Type: "text", Sender: "ai"}, WebSocketMessage{
+		Type: "ai-response",
+		Data: map[string]interface{}{
+			"content":    resp.Content,
+			"confidence": resp.Confidence,
+			"source":     resp.Source,
+			"stream_id":  st.id,
+		},
+		SessionID: sessionID,
+		Timestamp: time.Now(),
+	})
+}
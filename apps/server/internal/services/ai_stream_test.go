@@ -0,0 +1,135 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAIService_ProcessQueryStream(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req OpenAIRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if !req.Stream {
+			t.Errorf("request should ask for a stream")
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, part := range []string{"Hel", "lo", "!"} {
+			fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", part)
+			w.(http.Flusher).Flush()
+		}
+		fmt.Fprint(w, ": keep-alive\n\ndata: [DONE]\n\n")
+	}))
+	defer srv.Close()
+
+	var deltas []string
+	resp, err := NewAIService("k", srv.URL).ProcessQueryStream(context.Background(), "hi", "s1", func(d string) {
+		deltas = append(deltas, d)
+	})
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	if resp.Content != "Hello!" || strings.Join(deltas, "|") != "Hel|lo|!" {
+		t.Fatalf("content=%q deltas=%v", resp.Content, deltas)
+	}
+}
+
+// blockingStreamAI 首轮输出一段后等待取消，之后的调用立即完成
+type blockingStreamAI struct {
+	AIService
+	calls int
+}
+
+func (a *blockingStreamAI) ProcessQueryStream(ctx context.Context, query, sessionID string, onDelta func(string)) (*AIResponse, error) {
+	a.calls++
+	onDelta("partial")
+	if a.calls == 1 {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	onDelta(" answer")
+	return &AIResponse{Content: "partial answer", Source: "ai", Confidence: 0.8}, nil
+}
+
+func TestWebSocketHub_AIStreamCancelledByNewMessage(t *testing.T) {
+	hub := NewWebSocketHub()
+	go hub.Run()
+	visitor := &WebSocketClient{ID: "v", SessionID: "s1", Role: WSRoleVisitor, Send: make(chan WebSocketMessage, 16), Hub: hub}
+	hub.register <- visitor
+	waitFor(t, func() bool { return hub.GetClientCount() == 1 })
+
+	ai := &blockingStreamAI{}
+	ctx, st := hub.startAIStream("s1")
+	go hub.replyWithAI(ctx, st, "s1", "first", ai)
+	first := nextEvent(t, visitor)
+	if first.Type != WSEventAIResponseDelta {
+		t.Fatalf("got %s, want %s", first.Type, WSEventAIResponseDelta)
+	}
+	streamID := first.Data.(map[string]interface{})["stream_id"]
+
+	hub.cancelAIStream("s1")
+	ev := nextEvent(t, visitor)
+	data := ev.Data.(map[string]interface{})
+	if ev.Type != WSEventAIResponseCancelled || data["stream_id"] != streamID || data["reason"] != "superseded" {
+		t.Fatalf("cancel frame = %+v", ev)
+	}
+
+	ctx, st = hub.startAIStream("s1")
+	hub.replyWithAI(ctx, st, "s1", "second", ai)
+	for _, want := range []string{WSEventAIResponseDelta, WSEventAIResponseDelta, "ai-response"} {
+		if ev := nextEvent(t, visitor); ev.Type != want {
+			t.Fatalf("got %s, want %s", ev.Type, want)
+		} else if want == "ai-response" && ev.Data.(map[string]interface{})["content"] != "partial answer" {
+			t.Fatalf("final frame = %+v", ev)
+		}
+	}
+}
+
+// queryStreamAI 问题为 "first" 时等待取消，其余立即完成
+type queryStreamAI struct {
+	AIService
+}
+
+func (a *queryStreamAI) ProcessQueryStream(ctx context.Context, query, sessionID string, onDelta func(string)) (*AIResponse, error) {
+	if query == "first" {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	onDelta(query)
+	return &AIResponse{Content: query, Source: "ai", Confidence: 0.8}, nil
+}
+
+func TestWebSocketClient_NewMessageSupersedesUnstartedReply(t *testing.T) {
+	hub := NewWebSocketHub()
+	go hub.Run()
+	hub.SetAIService(&queryStreamAI{})
+	visitor := &WebSocketClient{ID: "v", SessionID: "s1", Role: WSRoleVisitor, Send: make(chan WebSocketMessage, 32), Hub: hub}
+	hub.register <- visitor
+	waitFor(t, func() bool { return hub.GetClientCount() == 1 })
+
+	// 两条消息连续到达，第一轮的回复协程可能尚未开始；打断仍须生效
+	for _, text := range []string{"first", "second"} {
+		visitor.handleTextMessage(WebSocketMessage{Type: "text-message", SessionID: "s1", Data: map[string]interface{}{"content": text}})
+	}
+	var cancelled, final int
+	for final == 0 || cancelled == 0 {
+		ev := nextEvent(t, visitor)
+		data, _ := ev.Data.(map[string]interface{})
+		switch ev.Type {
+		case WSEventAIResponseCancelled:
+			if data["reason"] != "superseded" || cancelled > 0 {
+				t.Fatalf("cancel frame = %+v", ev)
+			}
+			cancelled++
+		case "ai-response":
+			if data["content"] != "second" || final > 0 {
+				t.Fatalf("final frame = %+v", ev)
+			}
+			final++
+		}
+	}
+}
@@ -0,0 +1,564 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"servify/apps/server/internal/models"
+)
+
+// AI 可调用的工具（白名单）
+const (
+	AIToolListTickets     = "list_tickets"
+	AIToolCreateTicket    = "create_ticket"
+	AIToolTicketStatus    = "get_ticket_status"
+	AIToolTransferToHuman = "transfer_to_human"
+)
+
+// 工具调用记录状态
+const (
+	AIToolStatusSuccess = "success"
+	AIToolStatusDenied  = "denied"  // 会话未鉴权、未启用、渠道不允许、超出次数或会话未关联客户
+	AIToolStatusInvalid = "invalid" // 参数校验失败
+	AIToolStatusError   = "error"   // 执行失败
+)
+
+// AIToolPermission 单个工具的启用范围
+type AIToolPermission struct {
+	Enabled            bool
+	Platforms          []string // 允许的会话渠道，为空不限
+	MaxCallsPerSession int      // 每个会话成功调用的上限，0 不限
+}
+
+// AIToolConfig 工具调用配置；Permissions 中未列出的工具不可用
+type AIToolConfig struct {
+	MaxRounds   int
+	Permissions map[string]AIToolPermission
+}
+
+// DefaultAIToolPermissions 默认权限：全部启用，每个会话最多由 AI 创建 3 张工单
+func DefaultAIToolPermissions() map[string]AIToolPermission {
+	return map[string]AIToolPermission{
+		AIToolListTickets:     {Enabled: true},
+		AIToolCreateTicket:    {Enabled: true, MaxCallsPerSession: 3},
+		AIToolTicketStatus:    {Enabled: true},
+		AIToolTransferToHuman: {Enabled: true},
+	}
+}
+
+// errToolDenied / errToolInvalid 用于区分调用记录的状态
+var (
+	errToolDenied  = errors.New("denied")
+	errToolInvalid = errors.New("invalid arguments")
+)
+
+// aiTool 工具定义、参数解析与执行；工单类工具只作用于会话所属客户
+type aiTool struct {
+	def      LLMTool
+	customer bool
+	parse    func(raw string) (interface{}, error)
+	run      func(ctx context.Context, sess *models.Session, args interface{}) (interface{}, error)
+}
+
+// AIToolService 供 AI 回答时调用的 Servify 操作：查询/创建工单、查询工单状态、请求转人工。
+// 每次调用（含被拒绝的）都记录到 ai_tool_invocations
+type AIToolService struct {
+	db        *gorm.DB
+	tickets   *TicketService
+	transfers *SessionTransferService
+	cfg       AIToolConfig
+	tools     map[string]aiTool
+	order     []string
+	logger    *logrus.Logger
+}
+
+// NewAIToolService 创建工具服务；transfers 为空时不提供转人工工具
+func NewAIToolService(db *gorm.DB, tickets *TicketService, transfers *SessionTransferService, cfg AIToolConfig, logger *logrus.Logger) *AIToolService {
+	if logger == nil {
+		logger = logrus.New()
+	}
+	if cfg.MaxRounds <= 0 {
+		cfg.MaxRounds = 3
+	}
+	if cfg.Permissions == nil {
+		cfg.Permissions = DefaultAIToolPermissions()
+	}
+	s := &AIToolService{db: db, tickets: tickets, transfers: transfers, cfg: cfg, tools: make(map[string]aiTool), logger: logger}
+	if tickets != nil {
+		s.register(s.listTicketsTool())
+		s.register(s.createTicketTool())
+		s.register(s.ticketStatusTool())
+	}
+	if transfers != nil {
+		s.register(s.transferTool())
+	}
+	return s
+}
+
+func (s *AIToolService) register(t aiTool) {
+	s.tools[t.def.Name] = t
+	s.order = append(s.order, t.def.Name)
+}
+
+type aiToolSessionKey struct{}
+
+// WithAuthenticatedSession 标记请求方已通过访客令牌或 JWT 证明可代表该会话；
+// 工具以会话客户的身份执行，未标记的会话（如仅凭 session_id 的公开请求）不提供工具
+func WithAuthenticatedSession(ctx context.Context, sessionID string) context.Context {
+	return context.WithValue(ctx, aiToolSessionKey{}, sessionID)
+}
+
+func sessionAuthenticated(ctx context.Context, sessionID string) bool {
+	id, _ := ctx.Value(aiToolSessionKey{}).(string)
+	return sessionID != "" && id == sessionID
+}
+
+// Definitions 当前会话可用的工具定义（按鉴权、权限、渠道与是否已识别客户过滤）
+func (s *AIToolService) Definitions(ctx context.Context, sessionID string) []LLMTool {
+	if s == nil || !sessionAuthenticated(ctx, sessionID) {
+		return nil
+	}
+	sess, err := s.session(ctx, sessionID)
+	if err != nil {
+		return nil
+	}
+	var defs []LLMTool
+	for _, name := range s.order {
+		t := s.tools[name]
+		if s.allowed(name, sess) != nil || (t.customer && sess.UserID == 0) {
+			continue
+		}
+		defs = append(defs, t.def)
+	}
+	return defs
+}
+
+// Execute 执行模型发起的工具调用并记录；返回交给模型的 JSON 结果，失败时为 {"error": "..."}
+func (s *AIToolService) Execute(ctx context.Context, sessionID string, call LLMToolCall) string {
+	start := time.Now()
+	rec := models.AIToolInvocation{
+		SessionID: sessionID,
+		Tool:      call.Function.Name,
+		CallID:    call.ID,
+		Arguments: call.Function.Arguments,
+		Status:    AIToolStatusSuccess,
+	}
+	result, err := s.invoke(ctx, sessionID, call, &rec)
+	var payload interface{} = result
+	if err != nil {
+		switch {
+		case errors.Is(err, errToolDenied):
+			rec.Status = AIToolStatusDenied
+		case errors.Is(err, errToolInvalid):
+			rec.Status = AIToolStatusInvalid
+		default:
+			rec.Status = AIToolStatusError
+		}
+		rec.Error = err.Error()
+		payload = map[string]string{"error": err.Error()}
+	}
+	out, _ := json.Marshal(payload)
+	rec.Result = string(out)
+	rec.DurationMs = time.Since(start).Milliseconds()
+	if err := s.db.WithContext(ctx).Create(&rec).Error; err != nil {
+		s.logger.Warnf("Failed to record AI tool invocation %s for session %s: %v", rec.Tool, sessionID, err)
+	}
+	return rec.Result
+}
+
+func (s *AIToolService) invoke(ctx context.Context, sessionID string, call LLMToolCall, rec *models.AIToolInvocation) (interface{}, error) {
+	t, ok := s.tools[call.Function.Name]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown tool %s", errToolDenied, call.Function.Name)
+	}
+	sess, err := s.session(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	rec.CustomerID = sess.UserID
+	if !sessionAuthenticated(ctx, sessionID) {
+		return nil, fmt.Errorf("%w: session not authenticated", errToolDenied)
+	}
+	if err := s.allowed(t.def.Name, sess); err != nil {
+		return nil, err
+	}
+	if t.customer && sess.UserID == 0 {
+		return nil, fmt.Errorf("%w: customer not identified", errToolDenied)
+	}
+	if limit := s.cfg.Permissions[t.def.Name].MaxCallsPerSession; limit > 0 {
+		var used int64
+		s.db.WithContext(ctx).Model(&models.AIToolInvocation{}).
+			Where("session_id = ? AND tool = ? AND status = ?", sessionID, t.def.Name, AIToolStatusSuccess).
+			Count(&used)
+		if used >= int64(limit) {
+			return nil, fmt.Errorf("%w: call limit reached for this session", errToolDenied)
+		}
+	}
+	args, err := t.parse(call.Function.Arguments)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errToolInvalid, err)
+	}
+	return t.run(ctx, sess, args)
+}
+
+// allowed 权限与渠道检查
+func (s *AIToolService) allowed(name string, sess *models.Session) error {
+	perm, ok := s.cfg.Permissions[name]
+	if !ok || !perm.Enabled {
+		return fmt.Errorf("%w: tool %s is not enabled", errToolDenied, name)
+	}
+	if len(perm.Platforms) > 0 && !containsFold(perm.Platforms, sess.Platform) {
+		return fmt.Errorf("%w: tool %s is not available on %s", errToolDenied, name, sess.Platform)
+	}
+	return nil
+}
+
+func (s *AIToolService) session(ctx context.Context, sessionID string) (*models.Session, error) {
+	var sess models.Session
+	if err := s.db.WithContext(ctx).First(&sess, "id = ?", sessionID).Error; err != nil {
+		return nil, fmt.Errorf("session not found: %w", err)
+	}
+	return &sess, nil
+}
+
+// ListInvocations 会话内的工具调用记录（按时间正序）
+func (s *AIToolService) ListInvocations(ctx context.Context, sessionID string) ([]models.AIToolInvocation, error) {
+	var rows []models.AIToolInvocation
+	if err := s.db.WithContext(ctx).Where("session_id = ?", sessionID).Order("created_at ASC, id ASC").Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to list AI tool invocations: %w", err)
+	}
+	return rows, nil
+}
+
+// decodeToolArgs 严格解析参数：不允许未声明的字段
+func decodeToolArgs(raw string, v interface{}) error {
+	if strings.TrimSpace(raw) == "" {
+		raw = "{}"
+	}
+	dec := json.NewDecoder(bytes.NewReader([]byte(raw)))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("malformed arguments: %v", err)
+	}
+	return nil
+}
+
+func containsFold(list []string, v string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func oneOf(field, v string, allowed ...string) error {
+	for _, a := range allowed {
+		if v == a {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s must be one of %s", field, strings.Join(allowed, ", "))
+}
+
+// 工单状态分组：open 指尚未解决的工单
+var aiTicketStatusGroups = map[string][]string{
+	"open":     {"open", "assigned", "in_progress"},
+	"resolved": {"resolved"},
+	"closed":   {"closed"},
+	"all":      nil,
+}
+
+type aiTicketSummary struct {
+	ID        uint      `json:"id"`
+	Title     string    `json:"title"`
+	Status    string    `json:"status"`
+	Priority  string    `json:"priority"`
+	Category  string    `json:"category"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func newAITicketSummary(t *models.Ticket) aiTicketSummary {
+	return aiTicketSummary{ID: t.ID, Title: t.Title, Status: t.Status, Priority: t.Priority, Category: t.Category, CreatedAt: t.CreatedAt, UpdatedAt: t.UpdatedAt}
+}
+
+type listTicketsArgs struct {
+	Status string `json:"status"`
+	Limit  int    `json:"limit"`
+}
+
+func (s *AIToolService) listTicketsTool() aiTool {
+	return aiTool{
+		def: LLMTool{
+			Name:        AIToolListTickets,
+			Description: "List the current customer's support tickets, most recently updated first.",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"status": map[string]interface{}{"type": "string", "enum": []string{"open", "resolved", "closed", "all"}, "description": "open = not yet resolved (default)"},
+					"limit":  map[string]interface{}{"type": "integer", "minimum": 1, "maximum": 20, "description": "default 5"},
+				},
+				"additionalProperties": false,
+			},
+		},
+		customer: true,
+		parse: func(raw string) (interface{}, error) {
+			var a listTicketsArgs
+			if err := decodeToolArgs(raw, &a); err != nil {
+				return nil, err
+			}
+			if a.Status == "" {
+				a.Status = "open"
+			}
+			if _, ok := aiTicketStatusGroups[a.Status]; !ok {
+				return nil, oneOf("status", a.Status, "open", "resolved", "closed", "all")
+			}
+			if a.Limit == 0 {
+				a.Limit = 5
+			}
+			if a.Limit < 1 || a.Limit > 20 {
+				return nil, fmt.Errorf("limit must be between 1 and 20")
+			}
+			return a, nil
+		},
+		run: func(ctx context.Context, sess *models.Session, args interface{}) (interface{}, error) {
+			a := args.(listTicketsArgs)
+			customerID := sess.UserID
+			tickets, total, err := s.tickets.ListTickets(ctx, &TicketListRequest{
+				Page:       1,
+				PageSize:   a.Limit,
+				Status:     aiTicketStatusGroups[a.Status],
+				CustomerID: &customerID,
+				SortBy:     "updated_at",
+				SortOrder:  "desc",
+			})
+			if err != nil {
+				return nil, err
+			}
+			out := make([]aiTicketSummary, 0, len(tickets))
+			for i := range tickets {
+				out = append(out, newAITicketSummary(&tickets[i]))
+			}
+			return map[string]interface{}{"tickets": out, "total": total}, nil
+		},
+	}
+}
+
+type createTicketArgs struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Category    string `json:"category"`
+	Priority    string `json:"priority"`
+}
+
+func (s *AIToolService) createTicketTool() aiTool {
+	return aiTool{
+		def: LLMTool{
+			Name:        AIToolCreateTicket,
+			Description: "Create a support ticket for the current customer when the issue needs follow-up. Confirm the details with the customer first.",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"title":       map[string]interface{}{"type": "string", "maxLength": 200},
+					"description": map[string]interface{}{"type": "string", "maxLength": 2000},
+					"category":    map[string]interface{}{"type": "string", "enum": []string{"technical", "billing", "general", "complaint"}},
+					"priority":    map[string]interface{}{"type": "string", "enum": []string{"low", "normal", "high"}},
+				},
+				"required":             []string{"title", "description"},
+				"additionalProperties": false,
+			},
+		},
+		customer: true,
+		parse: func(raw string) (interface{}, error) {
+			var a createTicketArgs
+			if err := decodeToolArgs(raw, &a); err != nil {
+				return nil, err
+			}
+			a.Title = strings.TrimSpace(a.Title)
+			a.Description = strings.TrimSpace(a.Description)
+			if a.Title == "" || utf8.RuneCountInString(a.Title) > 200 {
+				return nil, fmt.Errorf("title is required and must be at most 200 characters")
+			}
+			if a.Description == "" || utf8.RuneCountInString(a.Description) > 2000 {
+				return nil, fmt.Errorf("description is required and must be at most 2000 characters")
+			}
+			// 留空时由工单分流或默认值决定
+			if a.Category != "" {
+				if err := oneOf("category", a.Category, "technical", "billing", "general", "complaint"); err != nil {
+					return nil, err
+				}
+			}
+			// urgent 仅由坐席设置
+			if a.Priority != "" {
+				if err := oneOf("priority", a.Priority, "low", "normal", "high"); err != nil {
+					return nil, err
+				}
+			}
+			return a, nil
+		},
+		run: func(ctx context.Context, sess *models.Session, args interface{}) (interface{}, error) {
+			a := args.(createTicketArgs)
+			ticket, err := s.tickets.CreateTicket(ctx, &TicketCreateRequest{
+				Title:       a.Title,
+				Description: a.Description,
+				CustomerID:  sess.UserID,
+				Category:    a.Category,
+				Priority:    a.Priority,
+				Source:      "chat",
+				Tags:        "ai",
+				SessionID:   sess.ID,
+			})
+			if err != nil {
+				return nil, err
+			}
+			return newAITicketSummary(ticket), nil
+		},
+	}
+}
+
+type ticketStatusArgs struct {
+	TicketID uint `json:"ticket_id"`
+}
+
+func (s *AIToolService) ticketStatusTool() aiTool {
+	return aiTool{
+		def: LLMTool{
+			Name:        AIToolTicketStatus,
+			Description: "Get the status of one of the current customer's tickets by ticket id.",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"ticket_id": map[string]interface{}{"type": "integer", "minimum": 1},
+				},
+				"required":             []string{"ticket_id"},
+				"additionalProperties": false,
+			},
+		},
+		customer: true,
+		parse: func(raw string) (interface{}, error) {
+			var a ticketStatusArgs
+			if err := decodeToolArgs(raw, &a); err != nil {
+				return nil, err
+			}
+			if a.TicketID == 0 {
+				return nil, fmt.Errorf("ticket_id is required")
+			}
+			return a, nil
+		},
+		run: func(ctx context.Context, sess *models.Session, args interface{}) (interface{}, error) {
+			a := args.(ticketStatusArgs)
+			ticket, err := s.tickets.GetTicketByID(ctx, a.TicketID)
+			// 不属于该客户的工单与不存在同样处理
+			if err != nil || ticket.CustomerID != sess.UserID {
+				return nil, fmt.Errorf("ticket %d not found", a.TicketID)
+			}
+			return map[string]interface{}{
+				"ticket":         newAITicketSummary(ticket),
+				"agent_assigned": ticket.AgentID != nil,
+				"resolved_at":    ticket.ResolvedAt,
+			}, nil
+		},
+	}
+}
+
+type transferArgs struct {
+	Reason string `json:"reason"`
+}
+
+func (s *AIToolService) transferTool() aiTool {
+	return aiTool{
+		def: LLMTool{
+			Name:        AIToolTransferToHuman,
+			Description: "Hand the conversation over to a human agent when the customer asks for one or the issue cannot be solved here.",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"reason": map[string]interface{}{"type": "string", "maxLength": 500},
+				},
+				"required":             []string{"reason"},
+				"additionalProperties": false,
+			},
+		},
+		parse: func(raw string) (interface{}, error) {
+			var a transferArgs
+			if err := decodeToolArgs(raw, &a); err != nil {
+				return nil, err
+			}
+			a.Reason = strings.TrimSpace(a.Reason)
+			if a.Reason == "" || utf8.RuneCountInString(a.Reason) > 500 {
+				return nil, fmt.Errorf("reason is required and must be at most 500 characters")
+			}
+			return a, nil
+		},
+		run: func(ctx context.Context, sess *models.Session, args interface{}) (interface{}, error) {
+			a := args.(transferArgs)
+			result, err := s.transfers.TransferToHuman(ctx, &TransferRequest{SessionID: sess.ID, Reason: a.Reason, Notes: "requested by AI assistant"})
+			if err != nil {
+				return nil, err
+			}
+			return map[string]interface{}{
+				"success":        result.Success,
+				"agent_assigned": result.NewAgentID != 0,
+				"queued":         result.IsWaiting,
+			}, nil
+		},
+	}
+}
+
+// SetToolService 启用 AI 回答中的工具调用
+func (s *AIService) SetToolService(t *AIToolService) {
+	s.tools = t
+}
+
+// answer 生成面向客户的回答；会话可用工具时允许模型调用工具，并把结果交回模型继续生成。
+// onDelta 非空时流式输出，多轮输出的文本按顺序拼接为最终回答；同时返回各轮累计的 token 用量
+func (s *AIService) answer(ctx context.Context, sessionID string, messages []Message, onDelta func(string)) (string, LLMUsage, error) {
+	ctx = withUsageSession(ctx, sessionID)
+	var tools []LLMTool
+	if s.llm.HasProviders() {
+		tools = s.tools.Definitions(ctx, sessionID)
+	}
+	var (
+		full  strings.Builder
+		usage LLMUsage
+	)
+	for round := 0; ; round++ {
+		req := LLMRequest{Messages: messages}
+		// 达到轮数上限后不再提供工具，要求模型直接作答
+		if round < s.tools.maxRounds() {
+			req.Tools = tools
+		}
+		resp, err := s.generate(ctx, LLMUseCaseAnswer, req, onDelta)
+		if err != nil {
+			return "", usage, err
+		}
+		usage.PromptTokens += resp.Usage.PromptTokens
+		usage.CompletionTokens += resp.Usage.CompletionTokens
+		full.WriteString(resp.Content)
+		if len(resp.ToolCalls) == 0 || len(req.Tools) == 0 {
+			return full.String(), usage, nil
+		}
+		messages = append(messages, Message{Role: "assistant", Content: resp.Content, ToolCalls: resp.ToolCalls})
+		for _, call := range resp.ToolCalls {
+			messages = append(messages, Message{Role: "tool", ToolCallID: call.ID, Content: s.tools.Execute(ctx, sessionID, call)})
+		}
+	}
+}
+
+// maxRounds 单次回答最多的工具调用轮数
+func (s *AIToolService) maxRounds() int {
+	if s == nil {
+		return 0
+	}
+	return s.cfg.MaxRounds
+}
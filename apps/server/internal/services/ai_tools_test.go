@@ -0,0 +1,162 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"gorm.io/gorm"
+
+	"servify/apps/server/internal/models"
+)
+
+func newAIToolTestService(t *testing.T, cfg AIToolConfig) (*AIToolService, *gorm.DB) {
+	t.Helper()
+	db := newTicketServiceTestDB(t)
+	if err := db.AutoMigrate(&models.AIToolInvocation{}, &models.Message{}); err != nil {
+		t.Fatalf("auto migrate: %v", err)
+	}
+	db.Create(&models.User{ID: 7, Username: "alice", Email: "alice@example.com", Role: "customer"})
+	db.Create(&models.User{ID: 8, Username: "bob", Email: "bob@example.com", Role: "customer"})
+	db.Create(&models.Session{ID: "s-alice", UserID: 7, Status: "active", Platform: "web"})
+	db.Create(&models.Session{ID: "s-anon", Status: "active", Platform: "web"})
+	db.Create(&models.Ticket{Title: "发票抬头错误", CustomerID: 7, Status: "in_progress", Priority: "normal"})
+	db.Create(&models.Ticket{Title: "已解决的问题", CustomerID: 7, Status: "resolved", Priority: "low"})
+	db.Create(&models.Ticket{Title: "别人的工单", CustomerID: 8, Status: "open", Priority: "high"})
+	return NewAIToolService(db, NewTicketService(db, nil, nil), nil, cfg, nil), db
+}
+
+func toolCall(name, args string) LLMToolCall {
+	return LLMToolCall{ID: "call_1", Type: "function", Function: LLMFunctionCall{Name: name, Arguments: args}}
+}
+
+func TestAIToolService_ValidationAndPermissions(t *testing.T) {
+	svc, db := newAIToolTestService(t, AIToolConfig{Permissions: map[string]AIToolPermission{
+		AIToolListTickets:  {Enabled: true},
+		AIToolTicketStatus: {Enabled: true},
+		AIToolCreateTicket: {Enabled: true, MaxCallsPerSession: 1, Platforms: []string{"web"}},
+	}})
+	ctx := WithAuthenticatedSession(context.Background(), "s-alice")
+
+	out := svc.Execute(ctx, "s-alice", toolCall(AIToolListTickets, `{}`))
+	var listed struct {
+		Tickets []aiTicketSummary `json:"tickets"`
+		Total   int64             `json:"total"`
+	}
+	_ = json.Unmarshal([]byte(out), &listed)
+	if listed.Total != 1 || listed.Tickets[0].Title != "发票抬头错误" {
+		t.Fatalf("open tickets = %s", out)
+	}
+
+	cases := []struct {
+		session, tool, args, status string
+	}{
+		{"s-alice", AIToolListTickets, `{"status":"open","customer_id":8}`, AIToolStatusInvalid}, // 未声明字段
+		{"s-alice", AIToolListTickets, `{"limit":100}`, AIToolStatusInvalid},
+		{"s-alice", AIToolCreateTicket, `{"title":"x","description":"y","priority":"urgent"}`, AIToolStatusInvalid},
+		{"s-alice", AIToolTicketStatus, `{"ticket_id":3}`, AIToolStatusError}, // 他人工单
+		{"s-alice", AIToolTransferToHuman, `{"reason":"angry"}`, AIToolStatusDenied},
+		{"s-anon", AIToolListTickets, `{}`, AIToolStatusDenied},
+		{"s-alice", AIToolCreateTicket, `{"title":"无法登录","description":"提示密码错误"}`, AIToolStatusSuccess},
+		{"s-alice", AIToolCreateTicket, `{"title":"再建一张","description":"超出上限"}`, AIToolStatusDenied},
+	}
+	for _, c := range cases {
+		out := svc.Execute(WithAuthenticatedSession(context.Background(), c.session), c.session, toolCall(c.tool, c.args))
+		var rec models.AIToolInvocation
+		db.Order("id DESC").First(&rec)
+		if rec.Status != c.status || rec.Tool != c.tool || rec.Result != out {
+			t.Errorf("%s %s %s: recorded %+v", c.session, c.tool, c.args, rec)
+		}
+	}
+
+	var created models.Ticket
+	if err := db.Where("title = ?", "无法登录").First(&created).Error; err != nil || created.CustomerID != 7 || created.SessionID == nil || *created.SessionID != "s-alice" {
+		t.Fatalf("created ticket = %+v %v", created, err)
+	}
+	// 未鉴权的会话（仅凭 session_id）不能代表客户调用工具
+	for _, unauth := range []context.Context{context.Background(), WithAuthenticatedSession(context.Background(), "s-anon")} {
+		out := svc.Execute(unauth, "s-alice", toolCall(AIToolListTickets, `{}`))
+		if strings.Contains(out, "发票抬头错误") || !strings.Contains(out, "not authenticated") {
+			t.Fatalf("unauthenticated call = %s", out)
+		}
+		if defs := svc.Definitions(unauth, "s-alice"); len(defs) != 0 {
+			t.Fatalf("unauthenticated definitions = %+v", defs)
+		}
+	}
+	rows, _ := svc.ListInvocations(ctx, "s-alice")
+	if len(rows) != 10 {
+		t.Fatalf("invocations = %d", len(rows))
+	}
+
+	if defs := svc.Definitions(WithAuthenticatedSession(context.Background(), "s-anon"), "s-anon"); len(defs) != 0 {
+		t.Fatalf("anonymous session should get no ticket tools: %+v", defs)
+	}
+	if defs := svc.Definitions(ctx, "s-alice"); len(defs) != 3 {
+		t.Fatalf("definitions = %+v", defs)
+	}
+}
+
+func TestAIService_ToolCallingLoop(t *testing.T) {
+	svc, db := newAIToolTestService(t, AIToolConfig{})
+	var (
+		mu       sync.Mutex
+		requests []OpenAIRequest
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req OpenAIRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		requests = append(requests, req)
+		mu.Unlock()
+		last := req.Messages[len(req.Messages)-1]
+		if last.Role != "tool" {
+			fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"","tool_calls":[{"id":"call_a","type":"function","function":{"name":"list_tickets","arguments":"{\"status\":\"open\"}"}}]}}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"您的发票工单正在处理中"}}]}`)
+	}))
+	defer srv.Close()
+
+	ai := NewAIService("k", srv.URL)
+	ai.SetDB(db)
+	ai.SetToolService(svc)
+	resp, err := ai.ProcessQuery(WithAuthenticatedSession(context.Background(), "s-alice"), "我的工单怎么样了？", "s-alice")
+	if err != nil || resp.Content != "您的发票工单正在处理中" {
+		t.Fatalf("answer = %+v %v", resp, err)
+	}
+	if len(requests) != 2 || len(requests[0].Tools) != 3 {
+		t.Fatalf("requests = %d, tools = %+v", len(requests), requests[0].Tools)
+	}
+	msgs := requests[1].Messages
+	call, result := msgs[len(msgs)-2], msgs[len(msgs)-1]
+	if len(call.ToolCalls) != 1 || result.ToolCallID != "call_a" || !strings.Contains(result.Content, "发票抬头错误") {
+		t.Fatalf("tool round trip = %+v / %+v", call, result)
+	}
+	var rec models.AIToolInvocation
+	if err := db.Where("session_id = ? AND call_id = ?", "s-alice", "call_a").First(&rec).Error; err != nil || rec.Status != AIToolStatusSuccess || rec.CustomerID != 7 {
+		t.Fatalf("invocation = %+v %v", rec, err)
+	}
+
+	// 匿名会话不提供工单工具
+	requests = nil
+	if _, err := ai.ProcessQuery(WithAuthenticatedSession(context.Background(), "s-anon"), "你好", "s-anon"); err != nil {
+		t.Fatalf("anon query: %v", err)
+	}
+	if len(requests) != 1 || len(requests[0].Tools) != 0 {
+		t.Fatalf("anonymous requests = %+v", requests)
+	}
+
+	// 未鉴权的请求即便指定了客户会话也不提供工具
+	requests = nil
+	if _, err := ai.ProcessQuery(context.Background(), "我的工单怎么样了？", "s-alice"); err != nil {
+		t.Fatalf("unauthenticated query: %v", err)
+	}
+	if len(requests) != 1 || len(requests[0].Tools) != 0 {
+		t.Fatalf("unauthenticated requests = %+v", requests)
+	}
+}
@@ -0,0 +1,318 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"servify/apps/server/internal/models"
+)
+
+// 月度预算状态
+const (
+	AIBudgetOK           = "ok"
+	AIBudgetSoftExceeded = "soft_exceeded" // 面向客户的回答降级为规则回复，坐席侧摘要等功能照常
+	AIBudgetHardExceeded = "hard_exceeded" // 停止全部模型调用
+)
+
+// ErrAIBudgetExceeded 月度预算已用尽，模型调用被拒绝
+var ErrAIBudgetExceeded = errors.New("AI monthly budget exceeded")
+
+// AIPrice 每百万 token 的价格
+type AIPrice struct {
+	Prompt     float64 `json:"prompt"`
+	Completion float64 `json:"completion"`
+}
+
+// AIUsageConfig 用量计费配置；预算为 0 表示不限制
+type AIUsageConfig struct {
+	Tenant   string
+	Currency string
+	// Prices 按 "provider/model"、model、provider、"default" 的顺序匹配
+	Prices            map[string]AIPrice
+	MonthlySoftBudget float64
+	MonthlyHardBudget float64
+	// RefreshInterval 从库中重新汇总当月费用的间隔（多实例共享预算），默认 1 分钟
+	RefreshInterval time.Duration
+}
+
+// AIUsageScope 用量记录关联的会话与工单，通过 ctx 传递到模型调用处
+type AIUsageScope struct {
+	SessionID string
+	TicketID  *uint
+}
+
+type aiUsageScopeKey struct{}
+
+// WithAIUsageScope 为之后的模型调用标注会话与工单
+func WithAIUsageScope(ctx context.Context, scope AIUsageScope) context.Context {
+	return context.WithValue(ctx, aiUsageScopeKey{}, scope)
+}
+
+// withUsageSession 补充会话 ID，保留已标注的工单
+func withUsageSession(ctx context.Context, sessionID string) context.Context {
+	scope := aiUsageScopeFrom(ctx)
+	if scope.SessionID != "" || sessionID == "" {
+		return ctx
+	}
+	scope.SessionID = sessionID
+	return WithAIUsageScope(ctx, scope)
+}
+
+func aiUsageScopeFrom(ctx context.Context) AIUsageScope {
+	scope, _ := ctx.Value(aiUsageScopeKey{}).(AIUsageScope)
+	return scope
+}
+
+// AIUsageService 记录模型调用用量、计算费用并执行月度预算
+type AIUsageService struct {
+	db     *gorm.DB
+	cfg    AIUsageConfig
+	logger *logrus.Logger
+	now    func() time.Time
+
+	mu          sync.Mutex
+	month       string // 当前缓存的月份（YYYY-MM）
+	monthCost   float64
+	refreshedAt time.Time
+	warned      map[string]string // 已告警的预算状态 -> 月份，每月每种状态只告警一次
+}
+
+func NewAIUsageService(db *gorm.DB, cfg AIUsageConfig, logger *logrus.Logger) *AIUsageService {
+	if logger == nil {
+		logger = logrus.New()
+	}
+	if cfg.Tenant == "" {
+		cfg.Tenant = "default"
+	}
+	if cfg.Currency == "" {
+		cfg.Currency = "USD"
+	}
+	if cfg.RefreshInterval <= 0 {
+		cfg.RefreshInterval = time.Minute
+	}
+	return &AIUsageService{db: db, cfg: cfg, logger: logger, now: time.Now, warned: make(map[string]string)}
+}
+
+// Price 模型单价；未配置时为 0
+func (s *AIUsageService) Price(provider, model string) AIPrice {
+	for _, key := range []string{provider + "/" + model, model, provider, "default"} {
+		if p, ok := s.cfg.Prices[key]; ok {
+			return p
+		}
+	}
+	return AIPrice{}
+}
+
+// Record 记录一次模型调用；后端未返回用量时按请求与回复文本估算
+func (s *AIUsageService) Record(ctx context.Context, feature string, req LLMRequest, resp *LLMResponse) (*models.AIUsageRecord, error) {
+	if s == nil || resp == nil {
+		return nil, nil
+	}
+	usage := resp.Usage
+	estimated := false
+	if usage.PromptTokens == 0 && usage.CompletionTokens == 0 {
+		usage = estimateUsage(req, resp)
+		estimated = true
+	}
+	price := s.Price(resp.Provider, resp.Model)
+	now := s.now().UTC()
+	scope := aiUsageScopeFrom(ctx)
+	rec := &models.AIUsageRecord{
+		Tenant:           s.cfg.Tenant,
+		Feature:          feature,
+		Provider:         resp.Provider,
+		Model:            resp.Model,
+		SessionID:        scope.SessionID,
+		TicketID:         scope.TicketID,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		Estimated:        estimated,
+		Cost:             (float64(usage.PromptTokens)*price.Prompt + float64(usage.CompletionTokens)*price.Completion) / 1e6,
+		Day:              now.Format("2006-01-02"),
+		CreatedAt:        now,
+	}
+	if err := s.db.WithContext(ctx).Create(rec).Error; err != nil {
+		return nil, fmt.Errorf("failed to record AI usage: %w", err)
+	}
+	s.mu.Lock()
+	if s.month == now.Format("2006-01") {
+		s.monthCost += rec.Cost
+	}
+	s.mu.Unlock()
+	return rec, nil
+}
+
+// estimateUsage 按文本长度估算用量（工具参数一并计入）
+func estimateUsage(req LLMRequest, resp *LLMResponse) LLMUsage {
+	var u LLMUsage
+	for _, m := range req.Messages {
+		u.PromptTokens += estimateTokens(m.Content)
+		for _, c := range m.ToolCalls {
+			u.PromptTokens += estimateTokens(c.Function.Arguments)
+		}
+	}
+	u.CompletionTokens = estimateTokens(resp.Content)
+	for _, c := range resp.ToolCalls {
+		u.CompletionTokens += estimateTokens(c.Function.Arguments)
+	}
+	return u
+}
+
+// MonthCost 当月（UTC）已产生的费用；缓存按 RefreshInterval 从库中重新汇总
+func (s *AIUsageService) MonthCost(ctx context.Context) float64 {
+	now := s.now().UTC()
+	month := now.Format("2006-01")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if month == s.month && now.Sub(s.refreshedAt) < s.cfg.RefreshInterval {
+		return s.monthCost
+	}
+	var total float64
+	err := s.db.WithContext(ctx).Model(&models.AIUsageRecord{}).
+		Where("tenant = ? AND day >= ?", s.cfg.Tenant, month+"-01").
+		Select("COALESCE(SUM(cost), 0)").Scan(&total).Error
+	if err != nil {
+		s.logger.Warnf("Failed to sum AI usage cost: %v", err)
+		if month != s.month {
+			s.month, s.monthCost = month, 0
+		}
+		return s.monthCost
+	}
+	s.month, s.monthCost, s.refreshedAt = month, total, now
+	return total
+}
+
+// BudgetState 当月预算状态；首次超出软/硬预算时记录告警
+func (s *AIUsageService) BudgetState(ctx context.Context) string {
+	if s == nil || (s.cfg.MonthlySoftBudget <= 0 && s.cfg.MonthlyHardBudget <= 0) {
+		return AIBudgetOK
+	}
+	cost := s.MonthCost(ctx)
+	state := AIBudgetOK
+	switch {
+	case s.cfg.MonthlyHardBudget > 0 && cost >= s.cfg.MonthlyHardBudget:
+		state = AIBudgetHardExceeded
+	case s.cfg.MonthlySoftBudget > 0 && cost >= s.cfg.MonthlySoftBudget:
+		state = AIBudgetSoftExceeded
+	}
+	if state != AIBudgetOK {
+		month := s.now().UTC().Format("2006-01")
+		s.mu.Lock()
+		first := s.warned[state] != month
+		s.warned[state] = month
+		s.mu.Unlock()
+		if first {
+			s.logger.Warnf("AI monthly budget %s: %.4f %s spent in %s", state, cost, s.cfg.Currency, month)
+		}
+	}
+	return state
+}
+
+// allows 预算是否允许该场景调用模型：软预算超出时仅停止面向客户的回答
+func (s *AIUsageService) allows(ctx context.Context, useCase string) bool {
+	switch s.BudgetState(ctx) {
+	case AIBudgetHardExceeded:
+		return false
+	case AIBudgetSoftExceeded:
+		return useCase != LLMUseCaseAnswer
+	default:
+		return true
+	}
+}
+
+// AIBudgetStatus 当月预算使用情况
+type AIBudgetStatus struct {
+	Tenant     string  `json:"tenant"`
+	Month      string  `json:"month"`
+	Currency   string  `json:"currency"`
+	Cost       float64 `json:"cost"`
+	SoftBudget float64 `json:"soft_budget"`
+	HardBudget float64 `json:"hard_budget"`
+	State      string  `json:"state"`
+}
+
+// Budget 当月预算使用情况
+func (s *AIUsageService) Budget(ctx context.Context) *AIBudgetStatus {
+	state := s.BudgetState(ctx)
+	return &AIBudgetStatus{
+		Tenant:     s.cfg.Tenant,
+		Month:      s.now().UTC().Format("2006-01"),
+		Currency:   s.cfg.Currency,
+		Cost:       s.MonthCost(ctx),
+		SoftBudget: s.cfg.MonthlySoftBudget,
+		HardBudget: s.cfg.MonthlyHardBudget,
+		State:      state,
+	}
+}
+
+// AIUsageQuery 用量查询条件；From/To 为 UTC 日期（含），为空不限
+type AIUsageQuery struct {
+	From      string
+	To        string
+	Feature   string
+	SessionID string
+	TicketID  *uint
+	Limit     int
+}
+
+func (s *AIUsageService) filter(ctx context.Context, q AIUsageQuery) *gorm.DB {
+	tx := s.db.WithContext(ctx).Model(&models.AIUsageRecord{}).Where("tenant = ?", s.cfg.Tenant)
+	if q.From != "" {
+		tx = tx.Where("day >= ?", q.From)
+	}
+	if q.To != "" {
+		tx = tx.Where("day <= ?", q.To)
+	}
+	if q.Feature != "" {
+		tx = tx.Where("feature = ?", q.Feature)
+	}
+	if q.SessionID != "" {
+		tx = tx.Where("session_id = ?", q.SessionID)
+	}
+	if q.TicketID != nil {
+		tx = tx.Where("ticket_id = ?", *q.TicketID)
+	}
+	return tx
+}
+
+// ListRecords 用量明细，按时间倒序
+func (s *AIUsageService) ListRecords(ctx context.Context, q AIUsageQuery) ([]models.AIUsageRecord, error) {
+	if q.Limit <= 0 || q.Limit > 1000 {
+		q.Limit = 100
+	}
+	var rows []models.AIUsageRecord
+	if err := s.filter(ctx, q).Order("created_at DESC, id DESC").Limit(q.Limit).Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to list AI usage: %w", err)
+	}
+	return rows, nil
+}
+
+// AIUsageDaily 按日、功能与模型汇总的用量
+type AIUsageDaily struct {
+	Day              string  `json:"day"`
+	Feature          string  `json:"feature"`
+	Model            string  `json:"model"`
+	Requests         int64   `json:"requests"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	Cost             float64 `json:"cost"`
+}
+
+// Daily 日用量报表
+func (s *AIUsageService) Daily(ctx context.Context, q AIUsageQuery) ([]AIUsageDaily, error) {
+	var rows []AIUsageDaily
+	err := s.filter(ctx, q).
+		Select("day, feature, model, COUNT(*) AS requests, SUM(prompt_tokens) AS prompt_tokens, SUM(completion_tokens) AS completion_tokens, SUM(cost) AS cost").
+		Group("day, feature, model").Order("day ASC, feature ASC, model ASC").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate AI usage: %w", err)
+	}
+	return rows, nil
+}
@@ -0,0 +1,209 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"servify/apps/server/internal/models"
+)
+
+func newAIUsageTestService(t *testing.T, cfg AIUsageConfig) (*AIUsageService, *gorm.DB) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:ai_usage_"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.AIUsageRecord{}); err != nil {
+		t.Fatalf("auto migrate: %v", err)
+	}
+	svc := NewAIUsageService(db, cfg, nil)
+	svc.now = func() time.Time { return time.Date(2026, 3, 15, 10, 0, 0, 0, time.UTC) }
+	return svc, db
+}
+
+// newUsageLLMServer 每次返回 400k prompt + 100k completion token 的 OpenAI 兼容服务
+func newUsageLLMServer(t *testing.T, calls *int32) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		fmt.Fprint(w, `{"model":"gpt-4o-mini","choices":[{"message":{"role":"assistant","content":"好的"}}],"usage":{"prompt_tokens":400000,"completion_tokens":100000}}`)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestAIUsage_RecordsCostAndTokens(t *testing.T) {
+	usage, db := newAIUsageTestService(t, AIUsageConfig{Prices: map[string]AIPrice{
+		"openai/gpt-4o-mini": {Prompt: 1, Completion: 2},
+		"default":            {Prompt: 100, Completion: 100},
+	}})
+	var calls int32
+	srv := newUsageLLMServer(t, &calls)
+	base := NewAIService("sk", srv.URL)
+	base.SetUsageService(usage)
+	enh := NewEnhancedAIService(base, nil, "", nil)
+	ctx := context.Background()
+
+	resp, err := enh.ProcessQueryEnhanced(ctx, "发票怎么开", "s1")
+	if err != nil || resp.TokensUsed != 500000 {
+		t.Fatalf("resp = %+v %v", resp, err)
+	}
+	if m := enh.GetMetrics(); m.PromptTokens != 400000 || m.CompletionTokens != 100000 {
+		t.Fatalf("metrics = %+v", m)
+	}
+	tid := uint(42)
+	if _, err := base.callLLM(WithAIUsageScope(ctx, AIUsageScope{TicketID: &tid}), LLMUseCaseSummary, LLMRequest{Messages: []Message{{Role: "user", Content: "总结"}}}); err != nil {
+		t.Fatalf("summary: %v", err)
+	}
+
+	var rows []models.AIUsageRecord
+	db.Order("id").Find(&rows)
+	if len(rows) != 2 {
+		t.Fatalf("records = %d", len(rows))
+	}
+	ans := rows[0]
+	if ans.Feature != LLMUseCaseAnswer || ans.SessionID != "s1" || ans.Model != "gpt-4o-mini" || ans.Provider != "openai" || ans.Tenant != "default" || ans.Day != "2026-03-15" || ans.Estimated {
+		t.Fatalf("answer record = %+v", ans)
+	}
+	if ans.Cost < 0.5999 || ans.Cost > 0.6001 {
+		t.Fatalf("cost = %v, want 0.6", ans.Cost)
+	}
+	if rows[1].Feature != LLMUseCaseSummary || rows[1].TicketID == nil || *rows[1].TicketID != 42 {
+		t.Fatalf("summary record = %+v", rows[1])
+	}
+
+	daily, err := usage.Daily(ctx, AIUsageQuery{From: "2026-03-01", To: "2026-03-31"})
+	if err != nil || len(daily) != 2 || daily[0].Feature != LLMUseCaseAnswer || daily[0].Requests != 1 || daily[0].PromptTokens != 400000 {
+		t.Fatalf("daily = %+v %v", daily, err)
+	}
+	if out, _ := usage.Daily(ctx, AIUsageQuery{From: "2026-04-01"}); len(out) != 0 {
+		t.Fatalf("out of range daily = %+v", out)
+	}
+}
+
+func TestAIUsage_EstimatesWhenProviderOmitsUsage(t *testing.T) {
+	usage, _ := newAIUsageTestService(t, AIUsageConfig{})
+	rec, err := usage.Record(context.Background(), LLMUseCaseDraft,
+		LLMRequest{Messages: []Message{{Role: "user", Content: "please draft a reply"}}},
+		&LLMResponse{Content: "Sure, here is a draft.", Provider: "ollama", Model: "llama3"})
+	if err != nil || !rec.Estimated || rec.PromptTokens == 0 || rec.CompletionTokens == 0 || rec.Cost != 0 {
+		t.Fatalf("record = %+v %v", rec, err)
+	}
+}
+
+func TestAIUsage_Budgets(t *testing.T) {
+	usage, _ := newAIUsageTestService(t, AIUsageConfig{
+		Prices:            map[string]AIPrice{"gpt-4o-mini": {Prompt: 1, Completion: 2}},
+		MonthlySoftBudget: 1,
+		MonthlyHardBudget: 2,
+	})
+	var calls int32
+	srv := newUsageLLMServer(t, &calls)
+	s := NewAIService("sk", srv.URL)
+	s.SetUsageService(usage)
+	ctx := context.Background()
+	summary := LLMRequest{Messages: []Message{{Role: "user", Content: "总结"}}}
+
+	for i := 0; i < 2; i++ { // 1.2，超出软预算
+		if _, err := s.ProcessQuery(ctx, "你好", "s1"); err != nil {
+			t.Fatalf("query: %v", err)
+		}
+	}
+	if got := usage.Budget(ctx); got.State != AIBudgetSoftExceeded || got.Month != "2026-03" {
+		t.Fatalf("budget = %+v", got)
+	}
+	// 软预算：客户回答降级为规则回复，不再调用模型
+	resp, err := s.ProcessQuery(ctx, "你好", "s1")
+	if err != nil || resp.Content != s.getFallbackResponse("你好") || atomic.LoadInt32(&calls) != 2 {
+		t.Fatalf("soft fallback = %+v %v calls=%d", resp, err, calls)
+	}
+	// 坐席侧摘要不受软预算限制；1.8 -> 2.4 超出硬预算
+	for i := 0; i < 2; i++ {
+		if _, err := s.callLLM(ctx, LLMUseCaseSummary, summary); err != nil {
+			t.Fatalf("summary %d: %v", i, err)
+		}
+	}
+	if _, err := s.callLLM(ctx, LLMUseCaseSummary, summary); !errors.Is(err, ErrAIBudgetExceeded) {
+		t.Fatalf("hard budget err = %v", err)
+	}
+	if got := usage.Budget(ctx); got.State != AIBudgetHardExceeded || got.Cost < 2.39 {
+		t.Fatalf("budget = %+v", got)
+	}
+
+	// 次月重新计算
+	usage.now = func() time.Time { return time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC) }
+	if state := usage.BudgetState(ctx); state != AIBudgetOK {
+		t.Fatalf("next month state = %s", state)
+	}
+}
+
+// partialProvider 流式输出部分内容后失败；block 时输出后等待 ctx 取消
+type partialProvider struct {
+	name  string
+	block bool
+}
+
+func (p *partialProvider) Name() string { return p.name }
+func (p *partialProvider) Complete(context.Context, LLMRequest) (*LLMResponse, error) {
+	return nil, errors.New("upstream unavailable")
+}
+func (p *partialProvider) Stream(ctx context.Context, _ LLMRequest, onDelta func(string)) (*LLMResponse, error) {
+	onDelta("这是一段被中断的回复")
+	if p.block {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return nil, errors.New("stream reset")
+}
+
+func TestAIUsage_RecordsFailedAndCancelledAttempts(t *testing.T) {
+	usage, db := newAIUsageTestService(t, AIUsageConfig{})
+	var calls int32
+	srv := newUsageLLMServer(t, &calls)
+	okProvider, _ := NewLLMProvider(LLMProviderConfig{Name: "openai", Type: "openai", BaseURL: srv.URL})
+	router := NewLLMRouter(nil)
+	_ = router.AddProvider(&partialProvider{name: "flaky"}, nil)
+	_ = router.AddProvider(okProvider, nil)
+	_ = router.AddProvider(&partialProvider{name: "slow", block: true}, nil)
+	_ = router.SetUseCase(LLMUseCaseDraft, []string{"flaky", "openai"})
+	_ = router.SetUseCase(LLMUseCaseAnswer, []string{"slow"})
+	ai := NewAIService("", "")
+	ai.SetLLMRouter(router)
+	ai.SetUsageService(usage)
+	req := LLMRequest{Messages: []Message{{Role: "user", Content: "帮我写一封回复"}}}
+
+	// 故障转移：失败的尝试与成功的尝试各记一条
+	if _, err := ai.callLLM(context.Background(), LLMUseCaseDraft, req); err != nil {
+		t.Fatalf("draft: %v", err)
+	}
+	// 流式输出中途取消：已生成的部分照样计入
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err := ai.generate(ctx, LLMUseCaseAnswer, req, func(string) { cancel() })
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("stream err = %v", err)
+	}
+
+	var rows []models.AIUsageRecord
+	db.Order("id").Find(&rows)
+	if len(rows) != 3 {
+		t.Fatalf("records = %+v", rows)
+	}
+	if rows[0].Provider != "flaky" || rows[0].Feature != LLMUseCaseDraft || !rows[0].Estimated || rows[0].PromptTokens == 0 {
+		t.Fatalf("failed attempt = %+v", rows[0])
+	}
+	if rows[1].Provider != "openai" || rows[1].PromptTokens != 400000 {
+		t.Fatalf("successful attempt = %+v", rows[1])
+	}
+	if rows[2].Provider != "slow" || rows[2].Feature != LLMUseCaseAnswer || rows[2].PromptTokens == 0 || rows[2].CompletionTokens == 0 {
+		t.Fatalf("cancelled attempt = %+v", rows[2])
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -100,10 +101,21 @@ func (s *AutomationService) matchTrigger(ctx context.Context, trig models.Automa
 		attrs["ticket.priority"] = ticket.Priority
 		attrs["ticket.status"] = ticket.Status
 		attrs["ticket.tags"] = ticket.Tags
+		attrs["ticket.category"] = ticket.Category
+		attrs["ticket.sentiment"] = ticket.Sentiment
 	}
 	if violation, ok := evt.Payload.(*models.SLAViolation); ok {
 		attrs["violation.type"] = violation.ViolationType
 	}
+	if triage, ok := evt.Payload.(*models.TicketTriage); ok {
+		attrs["triage.category"] = triage.Category
+		attrs["triage.category_confidence"] = triage.CategoryConfidence
+		attrs["triage.priority"] = triage.Priority
+		attrs["triage.priority_confidence"] = triage.PriorityConfidence
+		attrs["triage.sentiment"] = triage.Sentiment
+		attrs["triage.sentiment_confidence"] = triage.SentimentConfidence
+		attrs["triage.applied"] = triage.Applied
+	}
 
 	for _, cond := range conds {
 		if !evaluateCondition(cond, attrs) {
@@ -149,6 +161,17 @@ func evaluateCondition(cond TriggerCondition, attrs map[string]interface{}) bool
 		return actual != expected
 	case "contains":
 		return strings.Contains(actual, expected)
+	case "gte", "lte":
+		// 数值比较（如 triage.category_confidence）
+		a, errA := strconv.ParseFloat(actual, 64)
+		e, errE := strconv.ParseFloat(expected, 64)
+		if errA != nil || errE != nil {
+			return false
+		}
+		if cond.Op == "gte" {
+			return a >= e
+		}
+		return a <= e
 	default:
 		return false
 	}
@@ -411,7 +434,7 @@ func (s *AutomationService) DeleteTrigger(ctx context.Context, id uint) error {
 
 func isSupportedEvent(event string) bool {
 	switch event {
-	case "ticket_created", "ticket_updated", "sla_violation":
+	case "ticket_created", "ticket_updated", "sla_violation", "ticket_triaged":
 		return true
 	default:
 		return false
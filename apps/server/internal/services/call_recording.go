@@ -0,0 +1,420 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"servify/apps/server/internal/models"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media"
+	"github.com/pion/webrtc/v3/pkg/media/oggwriter"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// 录制相关的会话事件（访客与负责坐席都会收到，用于展示录制状态）
+const (
+	WSEventRecordingConsent = "recording-consent"
+	WSEventRecordingStarted = "recording-started"
+	WSEventRecordingStopped = "recording-stopped"
+)
+
+// RecordingConfig 服务端录制配置
+type RecordingConfig struct {
+	Dir       string        // 录制文件目录（通常位于上传存储下）
+	Retention time.Duration // 保留时长；<=0 表示不自动删除
+}
+
+// CallRecordingService 远程协助通话/屏幕共享的服务端录制
+// 仅在客户授权（RecordingConsent）后录制；每条远端轨道写一个文件：Opus → OGG，VP8 → WebM
+type CallRecordingService struct {
+	db     *gorm.DB
+	hub    *WebSocketHub
+	cfg    RecordingConfig
+	logger *logrus.Logger
+
+	mu     sync.Mutex
+	active map[uint]*activeRecording
+}
+
+// activeRecording 正在写入的录制
+type activeRecording struct {
+	record  *models.CallRecording
+	writer  media.Writer
+	mu      sync.Mutex
+	stopped bool
+	once    sync.Once
+}
+
+func NewCallRecordingService(db *gorm.DB, hub *WebSocketHub, cfg RecordingConfig, logger *logrus.Logger) *CallRecordingService {
+	if logger == nil {
+		logger = logrus.New()
+	}
+	return &CallRecordingService{
+		db:     db,
+		hub:    hub,
+		cfg:    cfg,
+		logger: logger,
+		active: make(map[uint]*activeRecording),
+	}
+}
+
+// RecordConsent 记录参与方对录制的授权/撤回；撤回时立即停止该会话正在进行的录制
+func (s *CallRecordingService) RecordConsent(ctx context.Context, sessionID, participant string, userID uint, granted bool) (*models.RecordingConsent, error) {
+	var count int64
+	if err := s.db.WithContext(ctx).Model(&models.Session{}).Where("id = ?", sessionID).Count(&count).Error; err != nil {
+		return nil, fmt.Errorf("failed to load session: %w", err)
+	}
+	if count == 0 {
+		return nil, fmt.Errorf("session not found")
+	}
+	consent := &models.RecordingConsent{
+		SessionID:   sessionID,
+		Participant: participant,
+		UserID:      userID,
+		Granted:     granted,
+	}
+	if err := s.db.WithContext(ctx).Create(consent).Error; err != nil {
+		return nil, fmt.Errorf("failed to save recording consent: %w", err)
+	}
+	if !granted {
+		s.StopSession(sessionID)
+	}
+	s.notify(sessionID, WSEventRecordingConsent, map[string]interface{}{
+		"session_id":  sessionID,
+		"participant": participant,
+		"granted":     granted,
+		"consent_id":  consent.ID,
+	})
+	s.logger.Infof("Recording consent for session %s set to %v by %s", sessionID, granted, participant)
+	return consent, nil
+}
+
+// CurrentConsent 会话当前有效的客户授权；未授权或已撤回时返回 nil
+func (s *CallRecordingService) CurrentConsent(ctx context.Context, sessionID string) (*models.RecordingConsent, error) {
+	var consent models.RecordingConsent
+	err := s.db.WithContext(ctx).
+		Where("session_id = ? AND participant = ?", sessionID, WSRoleVisitor).
+		Order("id DESC").First(&consent).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !consent.Granted {
+		return nil, nil
+	}
+	return &consent, nil
+}
+
+// RecordTrack 在客户已授权时录制一条远端轨道，直到轨道结束、授权撤回或连接关闭；未授权返回 nil
+func (s *CallRecordingService) RecordTrack(sessionID, connectionID, source string, track *webrtc.TrackRemote) (*models.CallRecording, error) {
+	codec := track.Codec()
+	return s.record(sessionID, connectionID, source, codec.MimeType, codec.Channels, func() (*rtp.Packet, error) {
+		pkt, _, err := track.ReadRTP()
+		return pkt, err
+	})
+}
+
+// record 创建录制记录与文件，并在后台从 read 读取 RTP 包写入
+func (s *CallRecordingService) record(sessionID, connectionID, source, mimeType string, channels uint16, read func() (*rtp.Packet, error)) (*models.CallRecording, error) {
+	ctx := context.Background()
+	consent, err := s.CurrentConsent(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load recording consent: %w", err)
+	}
+	if consent == nil {
+		s.logger.Infof("Session %s has no recording consent, %s track not recorded", sessionID, mimeType)
+		return nil, nil
+	}
+
+	var kind, codec, format string
+	switch strings.ToLower(mimeType) {
+	case strings.ToLower(webrtc.MimeTypeOpus):
+		kind, codec, format = "audio", "opus", "ogg"
+	case strings.ToLower(webrtc.MimeTypeVP8):
+		kind, codec, format = "video", "vp8", "webm"
+	default:
+		return nil, fmt.Errorf("unsupported codec for recording: %s", mimeType)
+	}
+
+	var session models.Session
+	if err := s.db.Select("id", "ticket_id").First(&session, "id = ?", sessionID).Error; err != nil {
+		return nil, fmt.Errorf("failed to load session: %w", err)
+	}
+	now := time.Now()
+	rec := &models.CallRecording{
+		SessionID:    sessionID,
+		TicketID:     session.TicketID,
+		ConnectionID: connectionID,
+		ConsentID:    consent.ID,
+		Source:       source,
+		TrackKind:    kind,
+		Codec:        codec,
+		Format:       format,
+		Status:       "recording",
+		StartedAt:    now,
+	}
+	if s.cfg.Retention > 0 {
+		expires := now.Add(s.cfg.Retention)
+		rec.ExpiresAt = &expires
+	}
+	if err := s.db.Create(rec).Error; err != nil {
+		return nil, fmt.Errorf("failed to create recording: %w", err)
+	}
+
+	dir := filepath.Join(s.cfg.Dir, safePathSegment(sessionID))
+	rec.FilePath = filepath.Join(dir, fmt.Sprintf("%d_%s_%s.%s", rec.ID, source, kind, format))
+	writer, err := s.openWriter(rec, channels)
+	if err != nil {
+		s.db.Model(rec).Updates(map[string]interface{}{"status": "failed", "ended_at": now})
+		return nil, fmt.Errorf("failed to create recording file: %w", err)
+	}
+	if err := s.db.Model(rec).Update("file_path", rec.FilePath).Error; err != nil {
+		s.logger.Warnf("Failed to save recording %d path: %v", rec.ID, err)
+	}
+
+	a := &activeRecording{record: rec, writer: writer}
+	s.mu.Lock()
+	s.active[rec.ID] = a
+	s.mu.Unlock()
+
+	s.notify(sessionID, WSEventRecordingStarted, recordingEventData(rec))
+	s.logger.Infof("Recording %s %s track of session %s to %s", source, kind, sessionID, rec.FilePath)
+
+	go func() {
+		status := "completed"
+		for {
+			pkt, err := read()
+			if err != nil {
+				break // 轨道结束或连接关闭
+			}
+			a.mu.Lock()
+			if a.stopped {
+				a.mu.Unlock()
+				break
+			}
+			err = a.writer.WriteRTP(pkt)
+			a.mu.Unlock()
+			if err != nil {
+				s.logger.Errorf("Failed to write recording %d: %v", rec.ID, err)
+				status = "failed"
+				break
+			}
+		}
+		s.finish(a, status)
+	}()
+	return rec, nil
+}
+
+func (s *CallRecordingService) openWriter(rec *models.CallRecording, channels uint16) (media.Writer, error) {
+	if err := os.MkdirAll(filepath.Dir(rec.FilePath), 0o750); err != nil {
+		return nil, err
+	}
+	if rec.Format == "webm" {
+		return newWebMWriter(rec.FilePath)
+	}
+	if channels == 0 {
+		channels = 2
+	}
+	return oggwriter.New(rec.FilePath, 48000, channels)
+}
+
+// finish 关闭文件并记录大小与结束时间（只执行一次）
+func (s *CallRecordingService) finish(a *activeRecording, status string) {
+	a.once.Do(func() {
+		a.mu.Lock()
+		a.stopped = true
+		if err := a.writer.Close(); err != nil {
+			s.logger.Warnf("Failed to close recording %d: %v", a.record.ID, err)
+		}
+		a.mu.Unlock()
+
+		s.mu.Lock()
+		delete(s.active, a.record.ID)
+		s.mu.Unlock()
+
+		now := time.Now()
+		updates := map[string]interface{}{"status": status, "ended_at": now, "updated_at": now}
+		if info, err := os.Stat(a.record.FilePath); err == nil {
+			updates["size_bytes"] = info.Size()
+			a.record.SizeBytes = info.Size()
+		}
+		// 录制期间被删除的不再改回
+		if err := s.db.Model(&models.CallRecording{}).
+			Where("id = ? AND status = ?", a.record.ID, "recording").
+			Updates(updates).Error; err != nil {
+			s.logger.Warnf("Failed to finalize recording %d: %v", a.record.ID, err)
+		}
+		a.record.Status = status
+		a.record.EndedAt = &now
+		s.notify(a.record.SessionID, WSEventRecordingStopped, recordingEventData(a.record))
+	})
+}
+
+// StopSession 停止会话内所有正在进行的录制
+func (s *CallRecordingService) StopSession(sessionID string) {
+	s.mu.Lock()
+	var stopping []*activeRecording
+	for _, a := range s.active {
+		if a.record.SessionID == sessionID {
+			stopping = append(stopping, a)
+		}
+	}
+	s.mu.Unlock()
+	for _, a := range stopping {
+		s.finish(a, "completed")
+	}
+}
+
+// ListRecordings 按会话或工单查询录制
+func (s *CallRecordingService) ListRecordings(ctx context.Context, sessionID string, ticketID uint) ([]models.CallRecording, error) {
+	q := s.db.WithContext(ctx).Model(&models.CallRecording{})
+	if sessionID != "" {
+		q = q.Where("session_id = ?", sessionID)
+	}
+	if ticketID != 0 {
+		q = q.Where("ticket_id = ?", ticketID)
+	}
+	var list []models.CallRecording
+	if err := q.Order("id DESC").Find(&list).Error; err != nil {
+		return nil, fmt.Errorf("failed to list recordings: %w", err)
+	}
+	return list, nil
+}
+
+// GetRecording 获取录制详情
+func (s *CallRecordingService) GetRecording(ctx context.Context, id uint) (*models.CallRecording, error) {
+	var rec models.CallRecording
+	if err := s.db.WithContext(ctx).First(&rec, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("recording not found")
+		}
+		return nil, fmt.Errorf("failed to get recording: %w", err)
+	}
+	return &rec, nil
+}
+
+// DeleteRecording 删除录制文件并保留元数据（状态置为 deleted）
+func (s *CallRecordingService) DeleteRecording(ctx context.Context, id uint) error {
+	rec, err := s.GetRecording(ctx, id)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	a := s.active[id]
+	s.mu.Unlock()
+	if a != nil {
+		s.finish(a, "completed")
+	}
+	return s.purge(ctx, rec, time.Now())
+}
+
+// PurgeExpired 删除超过保留期限的录制文件，返回处理条数
+func (s *CallRecordingService) PurgeExpired(ctx context.Context, now time.Time) (int, error) {
+	var expired []models.CallRecording
+	if err := s.db.WithContext(ctx).
+		Where("expires_at IS NOT NULL AND expires_at <= ? AND purged_at IS NULL AND status <> ?", now, "recording").
+		Find(&expired).Error; err != nil {
+		return 0, fmt.Errorf("failed to query expired recordings: %w", err)
+	}
+	purged := 0
+	for i := range expired {
+		if err := s.purge(ctx, &expired[i], now); err != nil {
+			s.logger.Warnf("Failed to purge recording %d: %v", expired[i].ID, err)
+			continue
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+func (s *CallRecordingService) purge(ctx context.Context, rec *models.CallRecording, now time.Time) error {
+	if rec.FilePath != "" {
+		if err := os.Remove(rec.FilePath); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove recording file: %w", err)
+		}
+	}
+	return s.db.WithContext(ctx).Model(&models.CallRecording{}).Where("id = ?", rec.ID).
+		Updates(map[string]interface{}{"status": "deleted", "purged_at": now, "updated_at": now}).Error
+}
+
+// StartRetentionWorker 按保留策略定期清理过期录制
+func (s *CallRecordingService) StartRetentionWorker(ctx context.Context, interval time.Duration) {
+	if s.cfg.Retention <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if n, err := s.PurgeExpired(ctx, time.Now()); err != nil {
+				s.logger.Errorf("Recording retention error: %v", err)
+			} else if n > 0 {
+				s.logger.Infof("Purged %d expired recordings", n)
+			}
+		}
+	}
+}
+
+// notify 推送到会话（访客）与负责坐席工作台
+func (s *CallRecordingService) notify(sessionID, eventType string, data map[string]interface{}) {
+	if s.hub == nil {
+		return
+	}
+	s.hub.relayParticipantEvent(sessionID, "", eventType, data, true)
+}
+
+func recordingEventData(rec *models.CallRecording) map[string]interface{} {
+	return map[string]interface{}{
+		"session_id":   rec.SessionID,
+		"recording_id": rec.ID,
+		"source":       rec.Source,
+		"track_kind":   rec.TrackKind,
+		"status":       rec.Status,
+	}
+}
+
+var unsafePathChars = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+// safePathSegment 会话 ID 用作目录名前去除路径分隔符等字符
+func safePathSegment(s string) string {
+	s = unsafePathChars.ReplaceAllString(s, "_")
+	if s == "" || s == "." || s == ".." {
+		return "_"
+	}
+	return s
+}
+
+// handleRecordingConsent 客户通过 WebSocket 授权/撤回录制：data.granted
+func (c *WebSocketClient) handleRecordingConsent(message WebSocketMessage) {
+	if c.Role == WSRoleAgent {
+		c.sendWebRTCError("recording consent must be given by the customer")
+		return
+	}
+	svc := c.Hub.webrtc()
+	if svc == nil || svc.recording() == nil {
+		c.sendWebRTCError("recording not enabled")
+		return
+	}
+	granted := false
+	if data, ok := message.Data.(map[string]interface{}); ok {
+		granted, _ = data["granted"].(bool)
+	}
+	if _, err := svc.recording().RecordConsent(context.Background(), c.SessionID, c.participant(), c.UserID, granted); err != nil {
+		logrus.Warnf("Recording consent for session %s failed: %v", c.SessionID, err)
+		c.sendWebRTCError(err.Error())
+	}
+}
@@ -0,0 +1,170 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"servify/apps/server/internal/models"
+)
+
+func newRecordingTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:recording_"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Session{}, &models.RecordingConsent{}, &models.CallRecording{}); err != nil {
+		t.Fatalf("automigrate: %v", err)
+	}
+	return db
+}
+
+// packetSource 以通道模拟远端轨道，关闭通道即轨道结束
+func packetSource(ch chan *rtp.Packet) func() (*rtp.Packet, error) {
+	return func() (*rtp.Packet, error) {
+		pkt, ok := <-ch
+		if !ok {
+			return nil, io.EOF
+		}
+		return pkt, nil
+	}
+}
+
+func waitRecordingStatus(t *testing.T, db *gorm.DB, id uint, status string) models.CallRecording {
+	t.Helper()
+	var rec models.CallRecording
+	waitFor(t, func() bool {
+		return db.First(&rec, id).Error == nil && rec.Status == status
+	})
+	return rec
+}
+
+func TestCallRecording_RequiresConsentAndWritesOgg(t *testing.T) {
+	db := newRecordingTestDB(t)
+	ticketID := uint(42)
+	db.Create(&models.Session{ID: "s1", Status: "active", Platform: "web", TicketID: &ticketID})
+	svc := NewCallRecordingService(db, nil, RecordingConfig{Dir: t.TempDir(), Retention: 24 * time.Hour}, nil)
+	ctx := context.Background()
+
+	ch := make(chan *rtp.Packet, 8)
+	if rec, err := svc.record("s1", "c1", "call", webrtc.MimeTypeOpus, 2, packetSource(ch)); err != nil || rec != nil {
+		t.Fatalf("recording without consent: rec=%v err=%v", rec, err)
+	}
+	if _, err := svc.RecordConsent(ctx, "missing", WSRoleVisitor, 0, true); err == nil {
+		t.Fatal("consent for unknown session should fail")
+	}
+	consent, err := svc.RecordConsent(ctx, "s1", WSRoleVisitor, 0, true)
+	if err != nil {
+		t.Fatalf("consent: %v", err)
+	}
+
+	rec, err := svc.record("s1", "c1", "call", webrtc.MimeTypeOpus, 2, packetSource(ch))
+	if err != nil || rec == nil {
+		t.Fatalf("record: rec=%v err=%v", rec, err)
+	}
+	if rec.ConsentID != consent.ID || rec.TicketID == nil || *rec.TicketID != ticketID || rec.Format != "ogg" || rec.ExpiresAt == nil {
+		t.Fatalf("recording = %+v", rec)
+	}
+	for i := 0; i < 5; i++ {
+		ch <- &rtp.Packet{Header: rtp.Header{SequenceNumber: uint16(i), Timestamp: uint32(i * 960)}, Payload: []byte{0xfc, 0xff, 0xfe}}
+	}
+	close(ch)
+
+	done := waitRecordingStatus(t, db, rec.ID, "completed")
+	data, err := os.ReadFile(done.FilePath)
+	if err != nil || !bytes.HasPrefix(data, []byte("OggS")) || done.SizeBytes != int64(len(data)) || done.EndedAt == nil {
+		t.Fatalf("ogg file: size=%d err=%v rec=%+v", len(data), err, done)
+	}
+
+	// 撤回授权后立即停止录制，后续轨道不再录制
+	ch2 := make(chan *rtp.Packet)
+	live, err := svc.record("s1", "c2", "screen", webrtc.MimeTypeOpus, 2, packetSource(ch2))
+	if err != nil || live == nil {
+		t.Fatalf("second record: %v", err)
+	}
+	if _, err := svc.RecordConsent(ctx, "s1", WSRoleVisitor, 0, false); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	waitRecordingStatus(t, db, live.ID, "completed")
+	close(ch2)
+	if rec, _ := svc.record("s1", "c3", "call", webrtc.MimeTypeOpus, 2, packetSource(make(chan *rtp.Packet))); rec != nil {
+		t.Fatal("recording after revocation should not start")
+	}
+}
+
+func TestCallRecording_PurgeExpired(t *testing.T) {
+	db := newRecordingTestDB(t)
+	dir := t.TempDir()
+	svc := NewCallRecordingService(db, nil, RecordingConfig{Dir: dir, Retention: time.Hour}, nil)
+
+	past, future := time.Now().Add(-time.Minute), time.Now().Add(time.Hour)
+	oldPath, keepPath := filepath.Join(dir, "old.ogg"), filepath.Join(dir, "keep.ogg")
+	for _, p := range []string{oldPath, keepPath} {
+		if err := os.WriteFile(p, []byte("OggS"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := &models.CallRecording{SessionID: "s1", FilePath: oldPath, Status: "completed", ExpiresAt: &past}
+	keep := &models.CallRecording{SessionID: "s1", FilePath: keepPath, Status: "completed", ExpiresAt: &future}
+	db.Create(old)
+	db.Create(keep)
+
+	n, err := svc.PurgeExpired(context.Background(), time.Now())
+	if err != nil || n != 1 {
+		t.Fatalf("purge: n=%d err=%v", n, err)
+	}
+	if _, err := os.Stat(oldPath); !os.IsNotExist(err) {
+		t.Fatal("expired file should be removed")
+	}
+	if _, err := os.Stat(keepPath); err != nil {
+		t.Fatal("unexpired file should be kept")
+	}
+	db.First(old, old.ID)
+	if old.Status != "deleted" || old.PurgedAt == nil {
+		t.Fatalf("purged recording = %+v", old)
+	}
+}
+
+func TestWebMWriter_VP8(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "v.webm")
+	w, err := newWebMWriter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 640x480 关键帧 + 非关键帧；首个非关键帧在文件头之前，应被丢弃
+	keyframe := []byte{0x50, 0x00, 0x00, 0x9d, 0x01, 0x2a, 0x80, 0x02, 0xe0, 0x01, 0xAA}
+	frames := [][]byte{{0x51, 0xEE}, keyframe, {0x51, 0xBB}, {0x51, 0xCC}}
+	for i, f := range frames {
+		pkt := &rtp.Packet{
+			Header:  rtp.Header{SequenceNumber: uint16(i), Timestamp: uint32(i * 3000), Marker: true},
+			Payload: append([]byte{0x10}, f...), // VP8 描述符：分区起始
+		}
+		if err := w.WriteRTP(pkt); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	if !bytes.HasPrefix(data, []byte{0x1A, 0x45, 0xDF, 0xA3}) || !bytes.Contains(data, []byte("V_VP8")) {
+		t.Fatalf("missing webm header: % x", data)
+	}
+	if !bytes.Contains(data, append(ebmlID(mkvPixelWidthID), 0x01, 0, 0, 0, 0, 0, 0, 2, 0x02, 0x80)) {
+		t.Fatal("pixel width not written")
+	}
+	if bytes.Contains(data, []byte{0x51, 0xEE}) || !bytes.Contains(data, []byte{0x80, 0x50, 0x00, 0x00, 0x9d}) || !bytes.Contains(data, []byte{0x00, 0x51, 0xBB}) {
+		t.Fatalf("unexpected blocks: % x", data)
+	}
+}
@@ -79,7 +79,7 @@ func (cb *CircuitBreaker) Allow() bool {
 		// 检查是否可以转为半开状态
 		if time.Since(cb.lastFailTime) > cb.config.ResetTimeout {
 			cb.state = StateHalfOpenCB
-			cb.halfOpenReqs = 0
+			cb.halfOpenReqs = 1 // 本次即第一个试探请求
 			return true
 		}
 		return false
@@ -137,6 +137,16 @@ func (cb *CircuitBreaker) OnFailure() {
 	}
 }
 
+// OnCancel 请求被调用方取消，既不算成功也不算失败：释放半开状态占用的试探名额
+func (cb *CircuitBreaker) OnCancel() {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	if cb.state == StateHalfOpenCB && cb.halfOpenReqs > 0 {
+		cb.halfOpenReqs--
+	}
+}
+
 // State 获取当前状态
 func (cb *CircuitBreaker) State() CircuitBreakerState {
 	cb.mutex.RLock()
@@ -0,0 +1,318 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"strings"
+
+	"servify/apps/server/internal/models"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// CoBrowseChannelLabel 客户端为协同浏览创建的数据通道标签；该通道上的消息均为 CoBrowseCommand
+const CoBrowseChannelLabel = "cobrowse"
+
+// WSEventCoBrowse 协同浏览指令在 WebSocket 上的帧类型（数据通道不可用时的回退通道）
+const WSEventCoBrowse = "cobrowse"
+
+// 协同浏览指令类型
+const (
+	CoBrowsePointer        = "pointer"         // 指针位置（视口归一化坐标）
+	CoBrowseHighlight      = "highlight"       // 高亮页面元素
+	CoBrowseScroll         = "scroll"          // 滚动页面（需控制权）
+	CoBrowseNavigate       = "navigate"        // 跳转页面（需控制权）
+	CoBrowseRequestControl = "request-control" // 坐席申请控制权
+	CoBrowseGrantControl   = "grant-control"   // 客户授予控制权
+	CoBrowseRevokeControl  = "revoke-control"  // 客户收回 / 坐席交还控制权
+)
+
+// CoBrowseCommand 协同浏览指令
+type CoBrowseCommand struct {
+	Type     string  `json:"type"`
+	X        float64 `json:"x,omitempty"` // pointer：0~1
+	Y        float64 `json:"y,omitempty"`
+	Selector string  `json:"selector,omitempty"` // highlight
+	DeltaX   float64 `json:"dx,omitempty"`       // scroll：像素
+	DeltaY   float64 `json:"dy,omitempty"`
+	URL      string  `json:"url,omitempty"` // navigate：http(s) 绝对地址或站内路径
+}
+
+// CoBrowseService 协同浏览：坐席指令经服务端校验后下发给客户（优先数据通道，回退 WebSocket），
+// 控制权由客户授予负责坐席，控制相关事件写入审计表
+type CoBrowseService struct {
+	db     *gorm.DB
+	hub    *WebSocketHub
+	logger *logrus.Logger
+}
+
+func NewCoBrowseService(db *gorm.DB, hub *WebSocketHub, logger *logrus.Logger) *CoBrowseService {
+	if logger == nil {
+		logger = logrus.New()
+	}
+	return &CoBrowseService{db: db, hub: hub, logger: logger}
+}
+
+// Validate 校验指令参数
+func (cmd *CoBrowseCommand) Validate() error {
+	finite := func(vs ...float64) bool {
+		for _, v := range vs {
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				return false
+			}
+		}
+		return true
+	}
+	switch cmd.Type {
+	case CoBrowsePointer:
+		if !finite(cmd.X, cmd.Y) || cmd.X < 0 || cmd.X > 1 || cmd.Y < 0 || cmd.Y > 1 {
+			return fmt.Errorf("pointer position must be within 0..1")
+		}
+	case CoBrowseHighlight:
+		if s := strings.TrimSpace(cmd.Selector); s == "" || len(s) > 512 {
+			return fmt.Errorf("selector required (max 512 chars)")
+		}
+	case CoBrowseScroll:
+		if !finite(cmd.DeltaX, cmd.DeltaY) || (cmd.DeltaX == 0 && cmd.DeltaY == 0) {
+			return fmt.Errorf("scroll delta required")
+		}
+	case CoBrowseNavigate:
+		if len(cmd.URL) > 2048 {
+			return fmt.Errorf("url too long")
+		}
+		if strings.HasPrefix(cmd.URL, "/") && !strings.HasPrefix(cmd.URL, "//") {
+			return nil
+		}
+		u, err := url.Parse(cmd.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("url must be an http(s) address or a site path")
+		}
+	case CoBrowseRequestControl, CoBrowseGrantControl, CoBrowseRevokeControl:
+	default:
+		return fmt.Errorf("unknown cobrowse command: %s", cmd.Type)
+	}
+	return nil
+}
+
+// requiresControl 改变客户页面的指令需客户授予控制权
+func (cmd *CoBrowseCommand) requiresControl() bool {
+	return cmd.Type == CoBrowseScroll || cmd.Type == CoBrowseNavigate
+}
+
+// HandleAgentCommand 处理坐席发出的指令：仅负责坐席可发送；滚动/跳转需持有控制权
+func (s *CoBrowseService) HandleAgentCommand(ctx context.Context, sessionID string, agentID uint, cmd CoBrowseCommand) error {
+	if err := cmd.Validate(); err != nil {
+		return err
+	}
+	actor := AgentChannelID(agentID)
+	deny := func(reason string) error {
+		s.audit(ctx, sessionID, actor, agentID, cmd, false, reason)
+		return fmt.Errorf("%s", reason)
+	}
+
+	assigned, err := s.assignedAgent(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	if assigned == 0 || assigned != agentID {
+		return deny("session not assigned to agent")
+	}
+	switch cmd.Type {
+	case CoBrowseGrantControl:
+		return deny("control can only be granted by the customer")
+	case CoBrowseRevokeControl:
+		holder, err := s.ControlHolder(ctx, sessionID)
+		if err != nil {
+			return err
+		}
+		if holder != agentID {
+			return deny("agent does not hold control")
+		}
+	default:
+		if cmd.requiresControl() {
+			holder, err := s.ControlHolder(ctx, sessionID)
+			if err != nil {
+				return err
+			}
+			if holder != agentID {
+				return deny("control not granted by customer")
+			}
+		}
+	}
+
+	if cmd.Type != CoBrowsePointer {
+		// 指针移动频率高，不入审计
+		s.audit(ctx, sessionID, actor, agentID, cmd, true, "")
+	}
+	s.deliverToCustomer(sessionID, actor, cmd)
+	if cmd.Type == CoBrowseRevokeControl {
+		s.notifyAgent(sessionID, cmd, 0)
+	}
+	return nil
+}
+
+// HandleCustomerCommand 处理客户发出的指令：授予/收回控制权，或同步自己的指针/高亮/滚动给坐席
+func (s *CoBrowseService) HandleCustomerCommand(ctx context.Context, sessionID string, cmd CoBrowseCommand) error {
+	if err := cmd.Validate(); err != nil {
+		return err
+	}
+	switch cmd.Type {
+	case CoBrowseRequestControl, CoBrowseNavigate:
+		s.audit(ctx, sessionID, WSRoleVisitor, 0, cmd, false, "not allowed for customer")
+		return fmt.Errorf("%s not allowed for customer", cmd.Type)
+	}
+
+	assigned, err := s.assignedAgent(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	switch cmd.Type {
+	case CoBrowseGrantControl:
+		if assigned == 0 {
+			s.audit(ctx, sessionID, WSRoleVisitor, 0, cmd, false, "no assigned agent")
+			return fmt.Errorf("no assigned agent to grant control to")
+		}
+		s.audit(ctx, sessionID, WSRoleVisitor, assigned, cmd, true, "")
+	case CoBrowseRevokeControl:
+		s.audit(ctx, sessionID, WSRoleVisitor, assigned, cmd, true, "")
+	}
+	if assigned != 0 {
+		s.notifyAgent(sessionID, cmd, assigned)
+	}
+	return nil
+}
+
+// ControlHolder 当前持有控制权的坐席（0 表示无）；以最近一次有效的授予/收回为准，会话改派后原授权失效
+func (s *CoBrowseService) ControlHolder(ctx context.Context, sessionID string) (uint, error) {
+	var last models.CoBrowseEvent
+	err := s.db.WithContext(ctx).
+		Where("session_id = ? AND allowed = ? AND command IN ?", sessionID, true, []string{CoBrowseGrantControl, CoBrowseRevokeControl}).
+		Order("id DESC").First(&last).Error
+	if err == gorm.ErrRecordNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to load control state: %w", err)
+	}
+	if last.Command != CoBrowseGrantControl {
+		return 0, nil
+	}
+	assigned, err := s.assignedAgent(ctx, sessionID)
+	if err != nil || assigned != last.AgentID {
+		return 0, err
+	}
+	return last.AgentID, nil
+}
+
+// ListEvents 会话的协同浏览审计记录（时间正序）
+func (s *CoBrowseService) ListEvents(ctx context.Context, sessionID string, limit int) ([]models.CoBrowseEvent, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 200
+	}
+	var events []models.CoBrowseEvent
+	if err := s.db.WithContext(ctx).Where("session_id = ?", sessionID).
+		Order("id ASC").Limit(limit).Find(&events).Error; err != nil {
+		return nil, fmt.Errorf("failed to list cobrowse events: %w", err)
+	}
+	return events, nil
+}
+
+func (s *CoBrowseService) assignedAgent(ctx context.Context, sessionID string) (uint, error) {
+	var session models.Session
+	if err := s.db.WithContext(ctx).Select("id", "agent_id", "status").First(&session, "id = ?", sessionID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return 0, fmt.Errorf("session not found")
+		}
+		return 0, fmt.Errorf("failed to load session: %w", err)
+	}
+	if session.AgentID == nil || session.Status == "ended" {
+		return 0, nil
+	}
+	return *session.AgentID, nil
+}
+
+func (s *CoBrowseService) audit(ctx context.Context, sessionID, actor string, agentID uint, cmd CoBrowseCommand, allowed bool, reason string) {
+	payload, _ := json.Marshal(cmd)
+	event := &models.CoBrowseEvent{
+		SessionID: sessionID,
+		Actor:     actor,
+		AgentID:   agentID,
+		Command:   cmd.Type,
+		Payload:   string(payload),
+		Allowed:   allowed,
+		Reason:    reason,
+	}
+	if err := s.db.WithContext(ctx).Create(event).Error; err != nil {
+		s.logger.Warnf("Failed to audit cobrowse event for session %s: %v", sessionID, err)
+	}
+}
+
+// deliverToCustomer 优先经协同浏览数据通道下发，通道不可用时通过 WebSocket 发给会话内客户端
+func (s *CoBrowseService) deliverToCustomer(sessionID, origin string, cmd CoBrowseCommand) {
+	if svc := s.hub.webrtc(); svc != nil {
+		if err := svc.SendCoBrowseCommand(sessionID, cmd); err == nil {
+			return
+		}
+	}
+	s.hub.SendToSession(sessionID, WebSocketMessage{Type: WSEventCoBrowse, Data: cmd, Origin: origin})
+}
+
+// notifyAgent 把客户侧指令/控制权变化推送给坐席（会话连接与工作台）
+func (s *CoBrowseService) notifyAgent(sessionID string, cmd CoBrowseCommand, holder uint) {
+	data := map[string]interface{}{
+		"session_id": sessionID,
+		"command":    cmd,
+	}
+	if cmd.Type == CoBrowseGrantControl || cmd.Type == CoBrowseRevokeControl {
+		data["control_holder"] = holder
+		if cmd.Type == CoBrowseRevokeControl {
+			data["control_holder"] = uint(0)
+		}
+	}
+	s.hub.relayParticipantEvent(sessionID, WSRoleVisitor, WSEventCoBrowse, data, true)
+}
+
+// handleCoBrowse WebSocket 上的协同浏览指令；工作台连接需在 data 中附 session_id
+func (c *WebSocketClient) handleCoBrowse(message WebSocketMessage) {
+	svc := c.Hub.coBrowse()
+	if svc == nil {
+		c.sendCoBrowseError("", "cobrowse not enabled")
+		return
+	}
+	var cmd struct {
+		CoBrowseCommand
+		SessionID string `json:"session_id"`
+	}
+	if err := decodeSignal(message.Data, &cmd); err != nil {
+		c.sendCoBrowseError("", "invalid cobrowse command")
+		return
+	}
+	sessionID := c.SessionID
+	if c.workspace {
+		sessionID = cmd.SessionID
+	}
+	go func() {
+		ctx := context.Background()
+		var err error
+		if c.Role == WSRoleAgent {
+			err = svc.HandleAgentCommand(ctx, sessionID, c.UserID, cmd.CoBrowseCommand)
+		} else {
+			err = svc.HandleCustomerCommand(ctx, sessionID, cmd.CoBrowseCommand)
+		}
+		if err != nil {
+			c.sendCoBrowseError(sessionID, err.Error())
+		}
+	}()
+}
+
+func (c *WebSocketClient) sendCoBrowseError(sessionID, msg string) {
+	c.Hub.sendToClient(c, WebSocketMessage{
+		Type:      "cobrowse-error",
+		Data:      map[string]interface{}{"message": msg, "session_id": sessionID},
+		SessionID: c.SessionID,
+	})
+}
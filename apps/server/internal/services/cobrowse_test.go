@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"servify/apps/server/internal/models"
+)
+
+func TestCoBrowseCommand_Validate(t *testing.T) {
+	valid := []CoBrowseCommand{
+		{Type: CoBrowsePointer, X: 0.5, Y: 1},
+		{Type: CoBrowseHighlight, Selector: "#checkout"},
+		{Type: CoBrowseScroll, DeltaY: 120},
+		{Type: CoBrowseNavigate, URL: "/pricing"},
+		{Type: CoBrowseNavigate, URL: "https://example.com/help"},
+		{Type: CoBrowseRequestControl},
+	}
+	for _, cmd := range valid {
+		if err := cmd.Validate(); err != nil {
+			t.Errorf("%+v: %v", cmd, err)
+		}
+	}
+	invalid := []CoBrowseCommand{
+		{Type: CoBrowsePointer, X: 1.5},
+		{Type: CoBrowseHighlight},
+		{Type: CoBrowseScroll},
+		{Type: CoBrowseNavigate, URL: "javascript:alert(1)"},
+		{Type: CoBrowseNavigate, URL: "//evil.example.com"},
+		{Type: "click"},
+	}
+	for _, cmd := range invalid {
+		if err := cmd.Validate(); err == nil {
+			t.Errorf("%+v should be rejected", cmd)
+		}
+	}
+}
+
+func TestCoBrowseService_ControlPermissions(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:cobrowse_"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Session{}, &models.CoBrowseEvent{}); err != nil {
+		t.Fatalf("automigrate: %v", err)
+	}
+	agentID := uint(7)
+	db.Create(&models.Session{ID: "s1", AgentID: &agentID, Status: "active", Platform: "web"})
+
+	hub := NewWebSocketHub()
+	hub.SetDB(db)
+	hub.SetAgentRealtimeService(NewAgentRealtimeService(db, hub, logrus.New()))
+	go hub.Run()
+	svc := NewCoBrowseService(db, hub, logrus.New())
+	hub.SetCoBrowseService(svc)
+
+	workspace := newWorkspaceClient(hub, agentID)
+	visitor := &WebSocketClient{ID: "v", SessionID: "s1", Role: WSRoleVisitor, Send: make(chan WebSocketMessage, 16), Hub: hub}
+	hub.register <- visitor
+	if ev := nextEvent(t, workspace); ev.Type != WSEventPresence {
+		t.Fatalf("workspace got %s", ev.Type)
+	}
+	ctx := context.Background()
+
+	if err := svc.HandleAgentCommand(ctx, "s1", 8, CoBrowseCommand{Type: CoBrowsePointer, X: 0.1, Y: 0.2}); err == nil {
+		t.Fatal("unassigned agent must not send commands")
+	}
+	if err := svc.HandleAgentCommand(ctx, "s1", agentID, CoBrowseCommand{Type: CoBrowsePointer, X: 0.1, Y: 0.2}); err != nil {
+		t.Fatalf("pointer: %v", err)
+	}
+	if ev := nextEvent(t, visitor); ev.Type != WSEventCoBrowse || ev.Data.(CoBrowseCommand).Type != CoBrowsePointer {
+		t.Fatalf("visitor got %+v", ev)
+	}
+	if err := svc.HandleAgentCommand(ctx, "s1", agentID, CoBrowseCommand{Type: CoBrowseScroll, DeltaY: 100}); err == nil {
+		t.Fatal("scroll without granted control should fail")
+	}
+	if err := svc.HandleAgentCommand(ctx, "s1", agentID, CoBrowseCommand{Type: CoBrowseGrantControl}); err == nil {
+		t.Fatal("agent cannot grant control to itself")
+	}
+
+	if err := svc.HandleCustomerCommand(ctx, "s1", CoBrowseCommand{Type: CoBrowseGrantControl}); err != nil {
+		t.Fatalf("grant: %v", err)
+	}
+	if ev := nextEvent(t, workspace); ev.Type != WSEventCoBrowse || ev.Data.(map[string]interface{})["control_holder"] != agentID {
+		t.Fatalf("workspace got %+v", ev)
+	}
+	if err := svc.HandleAgentCommand(ctx, "s1", agentID, CoBrowseCommand{Type: CoBrowseNavigate, URL: "/pricing"}); err != nil {
+		t.Fatalf("navigate with control: %v", err)
+	}
+	if ev := nextEvent(t, visitor); ev.Data.(CoBrowseCommand).URL != "/pricing" {
+		t.Fatalf("visitor got %+v", ev)
+	}
+
+	// 会话改派后原授权失效
+	db.Model(&models.Session{}).Where("id = ?", "s1").Update("agent_id", 8)
+	if holder, _ := svc.ControlHolder(ctx, "s1"); holder != 0 {
+		t.Fatalf("control holder after reassignment = %d", holder)
+	}
+
+	events, err := svc.ListEvents(ctx, "s1", 0)
+	if err != nil {
+		t.Fatalf("events: %v", err)
+	}
+	var denied, allowed int
+	for _, e := range events {
+		if e.Command == CoBrowsePointer && e.Allowed {
+			t.Fatal("allowed pointer moves should not be audited")
+		}
+		if e.Allowed {
+			allowed++
+		} else {
+			denied++
+		}
+	}
+	if denied != 3 || allowed != 2 {
+		t.Fatalf("audit trail: allowed=%d denied=%d events=%+v", allowed, denied, events)
+	}
+}
@@ -0,0 +1,369 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"servify/apps/server/internal/models"
+)
+
+// 摘要触发来源
+const (
+	SummaryTriggerResolved    = "ticket_resolved"
+	SummaryTriggerClosed      = "ticket_closed"
+	SummaryTriggerSessionEnd  = "session_ended"
+	SummaryTriggerTransferred = "session_transferred"
+	SummaryTriggerManual      = "manual"
+)
+
+// summaryNotePrefix 摘要内部备注的前缀；生成摘要时跳过此前的摘要备注
+const summaryNotePrefix = "【AI 摘要】"
+
+// ErrSummaryEmpty 工单/会话没有可摘要的内容
+var ErrSummaryEmpty = errors.New("nothing to summarize")
+
+// StructuredSummary 结构化摘要
+type StructuredSummary struct {
+	Problem    string   `json:"problem"`
+	Steps      []string `json:"steps"`
+	Resolution string   `json:"resolution"`
+	FollowUps  []string `json:"follow_ups"`
+}
+
+// SummaryRecord 摘要记录（API 与 CRM 导出格式）
+type SummaryRecord struct {
+	ID        uint      `json:"id"`
+	TicketID  *uint     `json:"ticket_id,omitempty"`
+	SessionID string    `json:"session_id,omitempty"`
+	Trigger   string    `json:"trigger"`
+	CreatedAt time.Time `json:"created_at"`
+	Text      string    `json:"text"`
+	StructuredSummary
+}
+
+// SummaryQuery 摘要导出查询
+type SummaryQuery struct {
+	From      *time.Time
+	To        *time.Time
+	TicketID  *uint
+	SessionID string
+	Trigger   string
+	Limit     int
+	Offset    int
+}
+
+// SummaryService 生成并保存工单与会话的结构化摘要：写入 conversation_summaries，
+// 同时更新工单的 summary 字段并追加一条内部备注
+type SummaryService struct {
+	db      *gorm.DB
+	ai      *AIService
+	logger  *logrus.Logger
+	timeout time.Duration
+}
+
+// NewSummaryService 创建摘要服务
+func NewSummaryService(db *gorm.DB, ai *AIService, logger *logrus.Logger) *SummaryService {
+	if logger == nil {
+		logger = logrus.New()
+	}
+	return &SummaryService{db: db, ai: ai, logger: logger, timeout: 30 * time.Second}
+}
+
+const summaryPrompt = `请为以下客服对话生成结构化摘要，供坐席交接与 CRM 归档使用。只输出 JSON，不要其他内容，格式：
+{"problem":"客户的问题","steps":["已采取的处理步骤"],"resolution":"解决结果，尚未解决时为空字符串","follow_ups":["仍需跟进的事项"]}
+使用对话所用的语言，每项简明扼要，不要编造对话中没有的信息。`
+
+// SummarizeTicket 为工单生成摘要（含工单评论与关联会话的消息）
+func (s *SummaryService) SummarizeTicket(ctx context.Context, ticketID uint, trigger string) (*SummaryRecord, error) {
+	var ticket models.Ticket
+	if err := s.db.WithContext(ctx).First(&ticket, ticketID).Error; err != nil {
+		return nil, fmt.Errorf("ticket not found: %w", err)
+	}
+	var comments []models.TicketComment
+	if err := s.db.WithContext(ctx).Where("ticket_id = ?", ticketID).Order("created_at ASC, id ASC").Find(&comments).Error; err != nil {
+		return nil, fmt.Errorf("failed to load comments: %w", err)
+	}
+	lines := []string{fmt.Sprintf("工单 #%d：%s", ticket.ID, ticket.Title)}
+	if ticket.Description != "" {
+		lines = append(lines, "描述："+ticket.Description)
+	}
+	sessionID := ""
+	if ticket.SessionID != nil {
+		sessionID = *ticket.SessionID
+		msgs, err := s.sessionLines(ctx, sessionID)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, msgs...)
+	}
+	for _, c := range comments {
+		if strings.HasPrefix(c.Content, summaryNotePrefix) {
+			continue
+		}
+		role := "客服"
+		switch {
+		case c.Type == "system":
+			role = "系统"
+		case c.Type == "internal_note":
+			role = "内部备注"
+		case c.UserID == ticket.CustomerID:
+			role = "客户"
+		}
+		lines = append(lines, role+": "+c.Content)
+	}
+
+	ctx = WithAIUsageScope(ctx, AIUsageScope{SessionID: sessionID, TicketID: &ticket.ID})
+	summary, err := s.generate(ctx, lines)
+	if err != nil {
+		return nil, err
+	}
+	return s.save(ctx, &ticket, sessionID, trigger, summary)
+}
+
+// SummarizeSession 为会话生成摘要；会话已关联工单时同时写入最近的工单
+func (s *SummaryService) SummarizeSession(ctx context.Context, sessionID string, trigger string) (*SummaryRecord, error) {
+	if err := s.db.WithContext(ctx).Select("id").First(&models.Session{}, "id = ?", sessionID).Error; err != nil {
+		return nil, fmt.Errorf("session not found: %w", err)
+	}
+	lines, err := s.sessionLines(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return nil, ErrSummaryEmpty
+	}
+	var ticket *models.Ticket
+	var linked models.Ticket
+	if err := s.db.WithContext(ctx).Where("session_id = ?", sessionID).Order("id DESC").First(&linked).Error; err == nil {
+		ticket = &linked
+	}
+
+	scope := AIUsageScope{SessionID: sessionID}
+	if ticket != nil {
+		scope.TicketID = &ticket.ID
+	}
+	summary, err := s.generate(WithAIUsageScope(ctx, scope), lines)
+	if err != nil {
+		return nil, err
+	}
+	return s.save(ctx, ticket, sessionID, trigger, summary)
+}
+
+// SummarizeTicketAsync 后台生成工单摘要，失败仅记录日志
+func (s *SummaryService) SummarizeTicketAsync(ticketID uint, trigger string) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+		defer cancel()
+		if _, err := s.SummarizeTicket(ctx, ticketID, trigger); err != nil {
+			s.logger.Warnf("summary: ticket %d (%s) failed: %v", ticketID, trigger, err)
+		}
+	}()
+}
+
+// SummarizeSessionAsync 后台生成会话摘要，失败仅记录日志
+func (s *SummaryService) SummarizeSessionAsync(sessionID string, trigger string) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+		defer cancel()
+		if _, err := s.SummarizeSession(ctx, sessionID, trigger); err != nil && !errors.Is(err, ErrSummaryEmpty) {
+			s.logger.Warnf("summary: session %s (%s) failed: %v", sessionID, trigger, err)
+		}
+	}()
+}
+
+// sessionLines 会话中客户、AI 与坐席的消息
+func (s *SummaryService) sessionLines(ctx context.Context, sessionID string) ([]string, error) {
+	var msgs []models.Message
+	if err := s.db.WithContext(ctx).
+		Where("session_id = ? AND sender IN ?", sessionID, []string{"user", "ai", "agent"}).
+		Order("created_at ASC, id ASC").Limit(200).
+		Find(&msgs).Error; err != nil {
+		return nil, fmt.Errorf("failed to load messages: %w", err)
+	}
+	lines := make([]string, 0, len(msgs))
+	for _, m := range msgs {
+		role := "客服"
+		switch m.Sender {
+		case "user":
+			role = "客户"
+		case "ai":
+			role = "AI"
+		}
+		lines = append(lines, role+": "+m.Content)
+	}
+	return lines, nil
+}
+
+func (s *SummaryService) generate(ctx context.Context, lines []string) (*StructuredSummary, error) {
+	if s.ai == nil || !s.ai.LLM().HasProviders() {
+		return nil, ErrNoLLMProvider
+	}
+	text, err := s.ai.callLLM(ctx, LLMUseCaseSummary, LLMRequest{Messages: []Message{
+		{Role: "system", Content: summaryPrompt},
+		{Role: "user", Content: strings.Join(lines, "\n")},
+	}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate summary: %w", err)
+	}
+	start, end := strings.Index(text, "{"), strings.LastIndex(text, "}")
+	if start < 0 || end <= start {
+		return nil, fmt.Errorf("summary response is not JSON: %q", text)
+	}
+	var out StructuredSummary
+	if err := json.Unmarshal([]byte(text[start:end+1]), &out); err != nil {
+		return nil, fmt.Errorf("invalid summary response: %w", err)
+	}
+	out.Problem = strings.TrimSpace(out.Problem)
+	out.Resolution = strings.TrimSpace(out.Resolution)
+	out.Steps = compactLines(out.Steps)
+	out.FollowUps = compactLines(out.FollowUps)
+	if out.Problem == "" {
+		return nil, fmt.Errorf("summary response has no problem: %q", text)
+	}
+	return &out, nil
+}
+
+func compactLines(in []string) []string {
+	out := make([]string, 0, len(in))
+	for _, v := range in {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// renderSummary 纯文本格式，用于内部备注与检索
+func renderSummary(sum *StructuredSummary) string {
+	var b strings.Builder
+	b.WriteString("问题：" + sum.Problem)
+	if len(sum.Steps) > 0 {
+		b.WriteString("\n处理步骤：")
+		for i, step := range sum.Steps {
+			fmt.Fprintf(&b, "\n%d. %s", i+1, step)
+		}
+	}
+	resolution := sum.Resolution
+	if resolution == "" {
+		resolution = "尚未解决"
+	}
+	b.WriteString("\n解决结果：" + resolution)
+	if len(sum.FollowUps) > 0 {
+		b.WriteString("\n待跟进：")
+		for _, f := range sum.FollowUps {
+			b.WriteString("\n- " + f)
+		}
+	}
+	return b.String()
+}
+
+func (s *SummaryService) save(ctx context.Context, ticket *models.Ticket, sessionID, trigger string, sum *StructuredSummary) (*SummaryRecord, error) {
+	steps, _ := json.Marshal(sum.Steps)
+	followUps, _ := json.Marshal(sum.FollowUps)
+	row := &models.ConversationSummary{
+		SessionID:  sessionID,
+		Trigger:    trigger,
+		Problem:    sum.Problem,
+		Steps:      string(steps),
+		Resolution: sum.Resolution,
+		FollowUps:  string(followUps),
+		Text:       renderSummary(sum),
+	}
+	if ticket != nil {
+		row.TicketID = &ticket.ID
+	}
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(row).Error; err != nil {
+			return err
+		}
+		if ticket == nil {
+			return nil
+		}
+		if err := tx.Model(&models.Ticket{}).Where("id = ?", ticket.ID).UpdateColumn("summary", row.Text).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.TicketComment{TicketID: ticket.ID, Content: summaryNotePrefix + "\n" + row.Text, Type: "internal_note"}).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to save summary: %w", err)
+	}
+	return toSummaryRecord(row), nil
+}
+
+func toSummaryRecord(row *models.ConversationSummary) *SummaryRecord {
+	rec := &SummaryRecord{
+		ID:        row.ID,
+		TicketID:  row.TicketID,
+		SessionID: row.SessionID,
+		Trigger:   row.Trigger,
+		CreatedAt: row.CreatedAt,
+		Text:      row.Text,
+		StructuredSummary: StructuredSummary{
+			Problem:    row.Problem,
+			Resolution: row.Resolution,
+			Steps:      []string{},
+			FollowUps:  []string{},
+		},
+	}
+	_ = json.Unmarshal([]byte(row.Steps), &rec.Steps)
+	_ = json.Unmarshal([]byte(row.FollowUps), &rec.FollowUps)
+	return rec
+}
+
+// Latest 工单或会话最新的摘要
+func (s *SummaryService) Latest(ctx context.Context, ticketID *uint, sessionID string) (*SummaryRecord, error) {
+	q := s.db.WithContext(ctx).Order("id DESC")
+	if ticketID != nil {
+		q = q.Where("ticket_id = ?", *ticketID)
+	} else {
+		q = q.Where("session_id = ?", sessionID)
+	}
+	var row models.ConversationSummary
+	if err := q.First(&row).Error; err != nil {
+		return nil, err
+	}
+	return toSummaryRecord(&row), nil
+}
+
+// List 按时间导出摘要（供 CRM 同步），按 id 升序便于增量拉取
+func (s *SummaryService) List(ctx context.Context, q SummaryQuery) ([]SummaryRecord, int64, error) {
+	db := s.db.WithContext(ctx).Model(&models.ConversationSummary{})
+	if q.From != nil {
+		db = db.Where("created_at >= ?", *q.From)
+	}
+	if q.To != nil {
+		db = db.Where("created_at < ?", *q.To)
+	}
+	if q.TicketID != nil {
+		db = db.Where("ticket_id = ?", *q.TicketID)
+	}
+	if q.SessionID != "" {
+		db = db.Where("session_id = ?", q.SessionID)
+	}
+	if q.Trigger != "" {
+		db = db.Where("triggered_by = ?", q.Trigger)
+	}
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count summaries: %w", err)
+	}
+	if q.Limit <= 0 || q.Limit > 500 {
+		q.Limit = 100
+	}
+	var rows []models.ConversationSummary
+	if err := db.Order("id ASC").Limit(q.Limit).Offset(max(q.Offset, 0)).Find(&rows).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to list summaries: %w", err)
+	}
+	out := make([]SummaryRecord, 0, len(rows))
+	for i := range rows {
+		out = append(out, *toSummaryRecord(&rows[i]))
+	}
+	return out, total, nil
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"servify/apps/server/internal/models"
+)
+
+func TestSummaryService_TicketAndSession(t *testing.T) {
+	db := newTicketServiceTestDB(t)
+	if err := db.AutoMigrate(&models.ConversationSummary{}, &models.Message{}); err != nil {
+		t.Fatalf("auto migrate: %v", err)
+	}
+	sid := "s1"
+	db.Create(&models.User{ID: 7, Username: "alice", Email: "alice@example.com", Role: "customer"})
+	db.Create(&models.Session{ID: "s1", UserID: 7, Status: "active", Platform: "web"})
+	db.Create(&models.Session{ID: "s-empty", UserID: 7, Status: "active", Platform: "web"})
+	db.Create(&models.Message{SessionID: "s1", Content: "发票抬头开错了", Type: "text", Sender: "user"})
+	db.Create(&models.Ticket{ID: 1, Title: "发票抬头错误", Description: "需要重开发票", CustomerID: 7, Status: "in_progress", SessionID: &sid})
+	db.Create(&models.TicketComment{TicketID: 1, UserID: 7, Content: "抬头应为 ACME 公司", Type: "comment"})
+	db.Create(&models.TicketComment{TicketID: 1, UserID: 99, Content: "已提交财务重开", Type: "comment"})
+	db.Create(&models.TicketComment{TicketID: 1, UserID: 0, Content: summaryNotePrefix + "\n问题：旧摘要", Type: "internal_note"})
+
+	var prompts []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req OpenAIRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		prompts = append(prompts, req.Messages[1].Content)
+		reply := `{"problem":"发票抬头错误","steps":["核对抬头","提交财务重开"," "],"resolution":"","follow_ups":["确认客户收到新发票"]}`
+		out, _ := json.Marshal(reply)
+		fmt.Fprintf(w, `{"choices":[{"message":{"role":"assistant","content":%s}}]}`, out)
+	}))
+	defer srv.Close()
+
+	svc := NewSummaryService(db, NewAIService("sk", srv.URL), nil)
+	ctx := context.Background()
+
+	rec, err := svc.SummarizeTicket(ctx, 1, SummaryTriggerManual)
+	if err != nil {
+		t.Fatalf("summarize ticket: %v", err)
+	}
+	if rec.Problem != "发票抬头错误" || len(rec.Steps) != 2 || rec.FollowUps[0] != "确认客户收到新发票" || rec.TicketID == nil || rec.SessionID != "s1" {
+		t.Fatalf("record = %+v", rec)
+	}
+	want := "问题：发票抬头错误\n处理步骤：\n1. 核对抬头\n2. 提交财务重开\n解决结果：尚未解决\n待跟进：\n- 确认客户收到新发票"
+	if rec.Text != want {
+		t.Fatalf("text = %q", rec.Text)
+	}
+	for _, s := range []string{"工单 #1：发票抬头错误", "客户: 发票抬头开错了", "客户: 抬头应为 ACME 公司", "客服: 已提交财务重开"} {
+		if !strings.Contains(prompts[0], s) {
+			t.Fatalf("prompt missing %q: %s", s, prompts[0])
+		}
+	}
+	if strings.Contains(prompts[0], "旧摘要") {
+		t.Fatalf("previous summary note should be skipped: %s", prompts[0])
+	}
+	var ticket models.Ticket
+	db.First(&ticket, 1)
+	var notes int64
+	db.Model(&models.TicketComment{}).Where("ticket_id = 1 AND type = ? AND content LIKE ?", "internal_note", summaryNotePrefix+"%").Count(&notes)
+	if ticket.Summary != want || notes != 2 {
+		t.Fatalf("ticket summary = %q notes = %d", ticket.Summary, notes)
+	}
+
+	// 会话摘要写入关联的工单
+	rec, err = svc.SummarizeSession(ctx, "s1", SummaryTriggerSessionEnd)
+	if err != nil || rec.TicketID == nil || *rec.TicketID != 1 {
+		t.Fatalf("session summary = %+v %v", rec, err)
+	}
+	if _, err := svc.SummarizeSession(ctx, "s-empty", SummaryTriggerSessionEnd); !errors.Is(err, ErrSummaryEmpty) {
+		t.Fatalf("empty session err = %v", err)
+	}
+
+	latest, err := svc.Latest(ctx, nil, "s1")
+	if err != nil || latest.Trigger != SummaryTriggerSessionEnd {
+		t.Fatalf("latest = %+v %v", latest, err)
+	}
+	rows, total, err := svc.List(ctx, SummaryQuery{Trigger: SummaryTriggerManual})
+	if err != nil || total != 1 || rows[0].Trigger != SummaryTriggerManual || len(rows[0].Steps) != 2 {
+		t.Fatalf("list = %+v %d %v", rows, total, err)
+	}
+	future := time.Now().Add(time.Hour)
+	if _, total, _ := svc.List(ctx, SummaryQuery{From: &future}); total != 0 {
+		t.Fatalf("from filter total = %d", total)
+	}
+
+	// 工单解决时异步生成
+	tickets := NewTicketService(db, nil, nil)
+	tickets.SetSummaryService(svc)
+	status := "resolved"
+	if _, err := tickets.UpdateTicket(ctx, 1, &TicketUpdateRequest{Status: &status}, 99); err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, total, _ := svc.List(ctx, SummaryQuery{Trigger: SummaryTriggerResolved}); total == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("resolved summary not generated")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	if _, err := NewSummaryService(db, NewAIService("", ""), nil).SummarizeTicket(ctx, 1, SummaryTriggerManual); !errors.Is(err, ErrNoLLMProvider) {
+		t.Fatalf("no provider err = %v", err)
+	}
+}
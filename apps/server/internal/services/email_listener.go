@@ -0,0 +1,316 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	EmailProtocolSMTP = "smtp"
+	EmailProtocolLMTP = "lmtp"
+
+	defaultEmailMaxMessageBytes = 25 << 20
+	emailMaxRecipients          = 100
+	emailCommandTimeout         = 5 * time.Minute
+)
+
+// EmailDeliveryHandler 处理一封完整投递的邮件
+type EmailDeliveryHandler interface {
+	HandleDelivery(ctx context.Context, envelopeFrom string, recipients []string, raw []byte) error
+}
+
+// EmailListenerConfig SMTP/LMTP 监听配置
+type EmailListenerConfig struct {
+	Addr            string // 例如 :2525
+	Protocol        string // smtp（默认）或 lmtp
+	Hostname        string // 问候语中的主机名
+	AcceptDomains   []string
+	MaxMessageBytes int64
+}
+
+// EmailListener 极简 SMTP/LMTP 接收服务，仅接收发往本域的邮件（不做中继）
+// 通常部署在 MTA（Postfix 等）之后，由 MTA 负责 TLS、反垃圾与重试
+type EmailListener struct {
+	cfg     EmailListenerConfig
+	handler EmailDeliveryHandler
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+// NewEmailListener 创建邮件接收服务
+func NewEmailListener(cfg EmailListenerConfig, handler EmailDeliveryHandler) *EmailListener {
+	if cfg.Protocol != EmailProtocolLMTP {
+		cfg.Protocol = EmailProtocolSMTP
+	}
+	if cfg.Hostname == "" {
+		cfg.Hostname = "localhost"
+	}
+	if cfg.MaxMessageBytes <= 0 {
+		cfg.MaxMessageBytes = defaultEmailMaxMessageBytes
+	}
+	return &EmailListener{cfg: cfg, handler: handler, conns: make(map[net.Conn]struct{})}
+}
+
+// Start 开始监听
+func (l *EmailListener) Start() error {
+	ln, err := net.Listen("tcp", l.cfg.Addr)
+	if err != nil {
+		return fmt.Errorf("email listener: %w", err)
+	}
+	l.mu.Lock()
+	l.listener = ln
+	l.mu.Unlock()
+
+	l.wg.Add(1)
+	go l.acceptLoop(ln)
+	logrus.Infof("Email %s listener started on %s", strings.ToUpper(l.cfg.Protocol), ln.Addr())
+	return nil
+}
+
+// Addr 实际监听地址
+func (l *EmailListener) Addr() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.listener == nil {
+		return ""
+	}
+	return l.listener.Addr().String()
+}
+
+// Stop 停止监听并关闭现有连接
+func (l *EmailListener) Stop() error {
+	l.mu.Lock()
+	l.closed = true
+	if l.listener != nil {
+		_ = l.listener.Close()
+	}
+	for c := range l.conns {
+		_ = c.Close()
+	}
+	l.mu.Unlock()
+	l.wg.Wait()
+	return nil
+}
+
+func (l *EmailListener) acceptLoop(ln net.Listener) {
+	defer l.wg.Done()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			l.mu.Lock()
+			closed := l.closed
+			l.mu.Unlock()
+			if closed || errors.Is(err, net.ErrClosed) {
+				return
+			}
+			logrus.Warnf("Email listener accept error: %v", err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+
+		l.mu.Lock()
+		if l.closed {
+			l.mu.Unlock()
+			_ = conn.Close()
+			return
+		}
+		l.conns[conn] = struct{}{}
+		l.mu.Unlock()
+
+		l.wg.Add(1)
+		go func() {
+			defer l.wg.Done()
+			l.serve(conn)
+			l.mu.Lock()
+			delete(l.conns, conn)
+			l.mu.Unlock()
+		}()
+	}
+}
+
+type emailSession struct {
+	helo  bool
+	mail  bool
+	from  string
+	rcpts []string
+}
+
+func (l *EmailListener) serve(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+
+	lmtp := l.cfg.Protocol == EmailProtocolLMTP
+	greeting, helloVerb := "ESMTP", "EHLO"
+	if lmtp {
+		greeting, helloVerb = "LMTP", "LHLO"
+	}
+	_ = tp.PrintfLine("220 %s %s Servify ready", l.cfg.Hostname, greeting)
+
+	var sess emailSession
+	for {
+		_ = conn.SetDeadline(time.Now().Add(emailCommandTimeout))
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		verb = strings.ToUpper(verb)
+
+		switch verb {
+		case "HELO", "EHLO", "LHLO":
+			if lmtp != (verb == "LHLO") {
+				_ = tp.PrintfLine("500 5.5.1 use %s", helloVerb)
+				continue
+			}
+			sess = emailSession{helo: true}
+			if verb == "HELO" {
+				_ = tp.PrintfLine("250 %s", l.cfg.Hostname)
+				continue
+			}
+			_ = tp.PrintfLine("250-%s", l.cfg.Hostname)
+			_ = tp.PrintfLine("250-8BITMIME")
+			_ = tp.PrintfLine("250-ENHANCEDSTATUSCODES")
+			_ = tp.PrintfLine("250 SIZE %d", l.cfg.MaxMessageBytes)
+		case "MAIL":
+			if !sess.helo {
+				_ = tp.PrintfLine("503 5.5.1 send %s first", helloVerb)
+				continue
+			}
+			addr, ok := parsePathArg(arg, "FROM:")
+			if !ok {
+				_ = tp.PrintfLine("501 5.5.4 syntax: MAIL FROM:<address>")
+				continue
+			}
+			sess.mail, sess.from, sess.rcpts = true, addr, nil
+			_ = tp.PrintfLine("250 2.1.0 OK")
+		case "RCPT":
+			if !sess.mail {
+				_ = tp.PrintfLine("503 5.5.1 need MAIL first")
+				continue
+			}
+			addr, ok := parsePathArg(arg, "TO:")
+			if !ok || addr == "" {
+				_ = tp.PrintfLine("501 5.5.4 syntax: RCPT TO:<address>")
+				continue
+			}
+			if !l.acceptsRecipient(addr) {
+				_ = tp.PrintfLine("550 5.7.1 relaying denied")
+				continue
+			}
+			if len(sess.rcpts) >= emailMaxRecipients {
+				_ = tp.PrintfLine("452 4.5.3 too many recipients")
+				continue
+			}
+			sess.rcpts = append(sess.rcpts, addr)
+			_ = tp.PrintfLine("250 2.1.5 OK")
+		case "DATA":
+			if len(sess.rcpts) == 0 {
+				_ = tp.PrintfLine("503 5.5.1 need RCPT first")
+				continue
+			}
+			_ = tp.PrintfLine("354 end data with <CR><LF>.<CR><LF>")
+			dr := tp.DotReader()
+			raw, err := io.ReadAll(io.LimitReader(dr, l.cfg.MaxMessageBytes+1))
+			if err == nil {
+				// 超限部分读掉丢弃，保持会话同步
+				_, err = io.Copy(io.Discard, dr)
+			}
+			if err != nil {
+				return
+			}
+			reply := l.deliver(&sess, raw)
+			// LMTP 对每个收件人分别回复
+			n := 1
+			if lmtp {
+				n = len(sess.rcpts)
+			}
+			for i := 0; i < n; i++ {
+				_ = tp.PrintfLine("%s", reply)
+			}
+			sess = emailSession{helo: true}
+		case "RSET":
+			sess = emailSession{helo: sess.helo}
+			_ = tp.PrintfLine("250 2.0.0 OK")
+		case "NOOP":
+			_ = tp.PrintfLine("250 2.0.0 OK")
+		case "VRFY":
+			_ = tp.PrintfLine("252 2.5.2 cannot verify")
+		case "QUIT":
+			_ = tp.PrintfLine("221 2.0.0 bye")
+			return
+		default:
+			_ = tp.PrintfLine("502 5.5.2 command not implemented")
+		}
+	}
+}
+
+func (l *EmailListener) deliver(sess *emailSession, raw []byte) string {
+	if int64(len(raw)) > l.cfg.MaxMessageBytes {
+		return "552 5.3.4 message too large"
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	if err := l.handler.HandleDelivery(ctx, sess.from, sess.rcpts, raw); err != nil {
+		if errors.Is(err, ErrInvalidEmail) {
+			return "554 5.6.0 " + err.Error()
+		}
+		logrus.Errorf("Email delivery failed: %v", err)
+		return "451 4.3.0 temporary failure, try again later"
+	}
+	return "250 2.0.0 OK queued"
+}
+
+func (l *EmailListener) acceptsRecipient(addr string) bool {
+	if len(l.cfg.AcceptDomains) == 0 {
+		return true
+	}
+	_, domain, ok := strings.Cut(addr, "@")
+	if !ok {
+		return false
+	}
+	for _, d := range l.cfg.AcceptDomains {
+		if strings.EqualFold(domain, d) {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePathArg 解析 "FROM:<addr> SIZE=123" 形式的参数
+func parsePathArg(arg, prefix string) (string, bool) {
+	arg = strings.TrimSpace(arg)
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return "", false
+	}
+	rest := strings.TrimSpace(arg[len(prefix):])
+	if !strings.HasPrefix(rest, "<") {
+		return "", false
+	}
+	end := strings.Index(rest, ">")
+	if end < 0 {
+		return "", false
+	}
+	addr := rest[1:end]
+	if addr == "" {
+		return "", true // 空反向路径（退信）
+	}
+	if _, err := mail.ParseAddress(addr); err != nil {
+		return "", false
+	}
+	return addr, true
+}
@@ -0,0 +1,756 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"servify/apps/server/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/text/encoding/htmlindex"
+	"gorm.io/gorm"
+)
+
+const (
+	emailDirectionInbound  = "inbound"
+	emailDirectionOutbound = "outbound"
+
+	emailSendTimeout = 30 * time.Second
+	// References 头最多保留的 Message-ID 数量
+	emailMaxReferences = 10
+)
+
+// ErrInvalidEmail 邮件无法解析（投递方不应重试）
+var ErrInvalidEmail = errors.New("invalid email message")
+
+// EmailServiceConfig 邮件渠道配置
+type EmailServiceConfig struct {
+	Address          string // 客服邮箱地址，例如 support@example.com
+	FromName         string
+	ReplyTokenSecret string // 回复令牌签名密钥；为空时仅依赖 Message-ID 匹配
+	SMTPHost         string
+	SMTPPort         int
+	SMTPUsername     string
+	SMTPPassword     string
+	StoragePath      string // 附件存储根目录
+}
+
+// EmailService 邮件渠道：来信转工单/评论，公开评论通过 SMTP 回发给客户
+type EmailService struct {
+	db      *gorm.DB
+	logger  *logrus.Logger
+	tickets *TicketService
+	cfg     EmailServiceConfig
+	domain  string
+
+	// sendMail 便于测试替换
+	sendMail func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+// InboundEmail 解析后的来信
+type InboundEmail struct {
+	MessageID     string
+	InReplyTo     string
+	References    []string
+	From          *mail.Address
+	Recipients    []string
+	Subject       string
+	Text          string
+	AutoSubmitted bool
+	Attachments   []EmailAttachment
+}
+
+// EmailAttachment 来信附件
+type EmailAttachment struct {
+	FileName    string
+	ContentType string
+	Data        []byte
+}
+
+// EmailIngestResult 来信处理结果
+type EmailIngestResult struct {
+	TicketID  uint   `json:"ticket_id"`
+	CommentID *uint  `json:"comment_id,omitempty"`
+	Created   bool   `json:"created"`
+	Skipped   string `json:"skipped,omitempty"` // duplicate, auto_submitted
+	Files     int    `json:"files"`
+	// Unverified 发件人不是工单客户：邮件仅作为内部备注记录，不对客户可见且不保存附件
+	Unverified bool `json:"unverified,omitempty"`
+}
+
+// NewEmailService 创建邮件渠道服务
+func NewEmailService(db *gorm.DB, logger *logrus.Logger, tickets *TicketService, cfg EmailServiceConfig) *EmailService {
+	if logger == nil {
+		logger = logrus.New()
+	}
+	if cfg.StoragePath == "" {
+		cfg.StoragePath = "./uploads"
+	}
+	if cfg.SMTPPort == 0 {
+		cfg.SMTPPort = 25
+	}
+
+	domain := "localhost"
+	if at := strings.LastIndex(cfg.Address, "@"); at >= 0 {
+		domain = cfg.Address[at+1:]
+	}
+
+	return &EmailService{
+		db:       db,
+		logger:   logger,
+		tickets:  tickets,
+		cfg:      cfg,
+		domain:   domain,
+		sendMail: smtp.SendMail,
+	}
+}
+
+// Domain 客服邮箱域名（监听器仅接收该域名的收件人）
+func (s *EmailService) Domain() string {
+	return s.domain
+}
+
+// HandleDelivery 供 SMTP/LMTP 监听器调用
+func (s *EmailService) HandleDelivery(ctx context.Context, envelopeFrom string, recipients []string, raw []byte) error {
+	result, err := s.Ingest(ctx, raw, recipients)
+	if err != nil {
+		return err
+	}
+	s.logger.WithFields(logrus.Fields{
+		"ticket_id":  result.TicketID,
+		"created":    result.Created,
+		"skipped":    result.Skipped,
+		"unverified": result.Unverified,
+		"from":       envelopeFrom,
+	}).Info("Inbound email processed")
+	return nil
+}
+
+// Ingest 处理一封来信：匹配已有工单则追加评论，否则新建工单；附件存为 TicketFile
+func (s *EmailService) Ingest(ctx context.Context, raw []byte, recipients []string) (*EmailIngestResult, error) {
+	in, err := ParseInboundEmail(raw)
+	if err != nil {
+		return nil, err
+	}
+	in.Recipients = append(in.Recipients, recipients...)
+
+	if in.AutoSubmitted {
+		// 自动回复/退信不入库，避免与对方自动回复互相循环
+		return &EmailIngestResult{Skipped: "auto_submitted"}, nil
+	}
+
+	if in.MessageID != "" {
+		var existing models.TicketEmail
+		if err := s.db.WithContext(ctx).Where("message_id = ?", in.MessageID).First(&existing).Error; err == nil {
+			return &EmailIngestResult{TicketID: existing.TicketID, CommentID: existing.CommentID, Skipped: "duplicate"}, nil
+		}
+	} else {
+		in.MessageID = fmt.Sprintf("<%s@%s>", uuid.NewString(), s.domain)
+	}
+
+	customer, err := s.findOrCreateCustomer(ctx, in.From)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &EmailIngestResult{}
+	body := in.Text
+	if strings.TrimSpace(body) == "" && len(in.Attachments) > 0 {
+		body = "(附件)"
+	}
+
+	if ticketID := s.matchTicket(ctx, in); ticketID != 0 {
+		content, commentType := body, "comment"
+		if !s.ticketOwnedBy(ctx, ticketID, customer.ID) {
+			// 回复令牌可被转发、线程头可被伪造：非工单客户的来信只作为内部备注供客服核实
+			result.Unverified = true
+			commentType = "internal_note"
+			content = fmt.Sprintf("[未验证发件人 %s] %s", customer.Email, body)
+			if n := len(in.Attachments); n > 0 {
+				content += fmt.Sprintf("\n(%d 个附件未保存)", n)
+			}
+			s.logger.Warnf("Inbound email from %s does not match customer of ticket %d, stored as internal note", customer.Email, ticketID)
+		}
+		comment, err := s.tickets.AddComment(ctx, ticketID, customer.ID, content, commentType)
+		if err != nil {
+			return nil, err
+		}
+		result.TicketID = ticketID
+		result.CommentID = &comment.ID
+	} else {
+		title := strings.TrimSpace(in.Subject)
+		if title == "" {
+			title = "(无主题)"
+		}
+		ticket, err := s.tickets.CreateTicket(ctx, &TicketCreateRequest{
+			Title:       title,
+			Description: body,
+			CustomerID:  customer.ID,
+			Source:      "email",
+		})
+		if err != nil {
+			return nil, err
+		}
+		result.TicketID = ticket.ID
+		result.Created = true
+	}
+
+	for _, att := range in.Attachments {
+		if result.Unverified {
+			break
+		}
+		if err := s.saveAttachment(ctx, result.TicketID, customer.ID, att); err != nil {
+			s.logger.Warnf("Failed to store email attachment %q for ticket %d: %v", att.FileName, result.TicketID, err)
+			continue
+		}
+		result.Files++
+	}
+
+	record := &models.TicketEmail{
+		TicketID:  result.TicketID,
+		CommentID: result.CommentID,
+		MessageID: in.MessageID,
+		InReplyTo: in.InReplyTo,
+		Direction: emailDirectionInbound,
+		FromAddr:  in.From.Address,
+		ToAddr:    s.cfg.Address,
+		Subject:   in.Subject,
+	}
+	if err := s.db.WithContext(ctx).Create(record).Error; err != nil {
+		return nil, fmt.Errorf("failed to record inbound email: %w", err)
+	}
+
+	return result, nil
+}
+
+// matchTicket 先按回复令牌匹配，再按 In-Reply-To/References 匹配已知 Message-ID
+func (s *EmailService) matchTicket(ctx context.Context, in *InboundEmail) uint {
+	for _, rcpt := range in.Recipients {
+		if id, ok := s.parseReplyAddress(rcpt); ok && s.ticketExists(ctx, id) {
+			return id
+		}
+	}
+
+	ids := make([]string, 0, len(in.References)+1)
+	if in.InReplyTo != "" {
+		ids = append(ids, in.InReplyTo)
+	}
+	ids = append(ids, in.References...)
+	if len(ids) == 0 {
+		return 0
+	}
+
+	var thread models.TicketEmail
+	if err := s.db.WithContext(ctx).Where("message_id IN ?", ids).Order("created_at DESC").First(&thread).Error; err != nil {
+		return 0
+	}
+	if !s.ticketExists(ctx, thread.TicketID) {
+		return 0
+	}
+	return thread.TicketID
+}
+
+func (s *EmailService) ticketExists(ctx context.Context, ticketID uint) bool {
+	var count int64
+	s.db.WithContext(ctx).Model(&models.Ticket{}).Where("id = ?", ticketID).Count(&count)
+	return count > 0
+}
+
+// ticketOwnedBy 发件人是否为工单客户
+func (s *EmailService) ticketOwnedBy(ctx context.Context, ticketID, customerID uint) bool {
+	var count int64
+	s.db.WithContext(ctx).Model(&models.Ticket{}).Where("id = ? AND customer_id = ?", ticketID, customerID).Count(&count)
+	return count > 0
+}
+
+func (s *EmailService) findOrCreateCustomer(ctx context.Context, from *mail.Address) (*models.User, error) {
+	email := strings.ToLower(strings.TrimSpace(from.Address))
+
+	var user models.User
+	err := s.db.WithContext(ctx).Where("email = ?", email).First(&user).Error
+	if err == nil {
+		return &user, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("failed to lookup customer: %w", err)
+	}
+
+	name := from.Name
+	if name == "" {
+		name, _, _ = strings.Cut(email, "@")
+	}
+	user = models.User{
+		Username: email,
+		Email:    email,
+		Name:     name,
+		Role:     "customer",
+		Status:   "active",
+	}
+	if err := s.db.WithContext(ctx).Create(&user).Error; err != nil {
+		return nil, fmt.Errorf("failed to create customer: %w", err)
+	}
+	s.logger.Infof("Created customer %d from inbound email %s", user.ID, email)
+	return &user, nil
+}
+
+func (s *EmailService) saveAttachment(ctx context.Context, ticketID, userID uint, att EmailAttachment) error {
+	dir := filepath.Join(s.cfg.StoragePath, "email", strconv.FormatUint(uint64(ticketID), 10))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	name := sanitizeEmailFileName(att.FileName)
+	path := filepath.Join(dir, uuid.NewString()+"_"+name)
+	if err := os.WriteFile(path, att.Data, 0o644); err != nil {
+		return err
+	}
+
+	file := &models.TicketFile{
+		TicketID: ticketID,
+		UserID:   userID,
+		FileName: name,
+		FilePath: path,
+		FileSize: int64(len(att.Data)),
+		MimeType: att.ContentType,
+	}
+	return s.db.WithContext(ctx).Create(file).Error
+}
+
+// NotifyComment 公开评论回发给邮件客户（仅客服/管理员发表、且工单来自邮件时）
+func (s *EmailService) NotifyComment(comment *models.TicketComment) {
+	if comment == nil || comment.Type != "comment" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), emailSendTimeout)
+	defer cancel()
+
+	var author models.User
+	if err := s.db.WithContext(ctx).First(&author, comment.UserID).Error; err != nil || author.Role == "customer" {
+		return
+	}
+	var ticket models.Ticket
+	if err := s.db.WithContext(ctx).First(&ticket, comment.TicketID).Error; err != nil {
+		return
+	}
+	if ticket.Source != "email" {
+		var threads int64
+		s.db.WithContext(ctx).Model(&models.TicketEmail{}).Where("ticket_id = ?", ticket.ID).Count(&threads)
+		if threads == 0 {
+			return
+		}
+	}
+
+	if err := s.SendTicketComment(ctx, comment); err != nil {
+		s.logger.Errorf("Failed to email comment %d of ticket %d: %v", comment.ID, comment.TicketID, err)
+	}
+}
+
+// SendTicketComment 通过 SMTP 将评论发给工单客户，并带上 In-Reply-To/References 保持邮件线程
+func (s *EmailService) SendTicketComment(ctx context.Context, comment *models.TicketComment) error {
+	var ticket models.Ticket
+	if err := s.db.WithContext(ctx).Preload("Customer").First(&ticket, comment.TicketID).Error; err != nil {
+		return fmt.Errorf("ticket not found: %w", err)
+	}
+	to := ticket.Customer.Email
+	if to == "" {
+		return fmt.Errorf("customer %d has no email address", ticket.CustomerID)
+	}
+
+	var thread []models.TicketEmail
+	if err := s.db.WithContext(ctx).Where("ticket_id = ?", ticket.ID).Order("created_at ASC, id ASC").Find(&thread).Error; err != nil {
+		return fmt.Errorf("failed to load email thread: %w", err)
+	}
+
+	subject := ticket.Title
+	var refs []string
+	for _, m := range thread {
+		refs = append(refs, m.MessageID)
+		if m.Direction == emailDirectionInbound && m.Subject != "" && subject == ticket.Title {
+			subject = m.Subject
+		}
+	}
+	if len(refs) > emailMaxReferences {
+		refs = refs[len(refs)-emailMaxReferences:]
+	}
+	subject = fmt.Sprintf("Re: %s [#%d]", stripReplyPrefix(subject), ticket.ID)
+
+	messageID := fmt.Sprintf("<ticket-%d-%s@%s>", ticket.ID, uuid.NewString(), s.domain)
+	header := []struct{ key, value string }{
+		{"From", (&mail.Address{Name: s.cfg.FromName, Address: s.cfg.Address}).String()},
+		{"To", (&mail.Address{Name: ticket.Customer.Name, Address: to}).String()},
+		{"Reply-To", s.ReplyAddress(ticket.ID)},
+		{"Subject", mime.QEncoding.Encode("utf-8", subject)},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"Message-ID", messageID},
+	}
+	inReplyTo := ""
+	if len(refs) > 0 {
+		inReplyTo = refs[len(refs)-1]
+		header = append(header,
+			struct{ key, value string }{"In-Reply-To", inReplyTo},
+			struct{ key, value string }{"References", strings.Join(refs, " ")},
+		)
+	}
+	header = append(header,
+		struct{ key, value string }{"MIME-Version", "1.0"},
+		struct{ key, value string }{"Content-Type", "text/plain; charset=utf-8"},
+		struct{ key, value string }{"Content-Transfer-Encoding", "quoted-printable"},
+	)
+
+	var msg bytes.Buffer
+	for _, h := range header {
+		fmt.Fprintf(&msg, "%s: %s\r\n", h.key, h.value)
+	}
+	msg.WriteString("\r\n")
+	qp := quotedprintable.NewWriter(&msg)
+	if _, err := qp.Write([]byte(strings.ReplaceAll(comment.Content, "\n", "\r\n"))); err != nil {
+		return fmt.Errorf("failed to encode email body: %w", err)
+	}
+	if err := qp.Close(); err != nil {
+		return fmt.Errorf("failed to encode email body: %w", err)
+	}
+
+	var auth smtp.Auth
+	if s.cfg.SMTPUsername != "" {
+		auth = smtp.PlainAuth("", s.cfg.SMTPUsername, s.cfg.SMTPPassword, s.cfg.SMTPHost)
+	}
+	addr := net.JoinHostPort(s.cfg.SMTPHost, strconv.Itoa(s.cfg.SMTPPort))
+	if err := s.sendMail(addr, auth, s.cfg.Address, []string{to}, msg.Bytes()); err != nil {
+		return fmt.Errorf("smtp send failed: %w", err)
+	}
+
+	commentID := comment.ID
+	record := &models.TicketEmail{
+		TicketID:  ticket.ID,
+		CommentID: &commentID,
+		MessageID: messageID,
+		InReplyTo: inReplyTo,
+		Direction: emailDirectionOutbound,
+		FromAddr:  s.cfg.Address,
+		ToAddr:    to,
+		Subject:   subject,
+	}
+	if err := s.db.WithContext(ctx).Create(record).Error; err != nil {
+		return fmt.Errorf("failed to record outbound email: %w", err)
+	}
+	s.logger.Infof("Emailed comment %d of ticket %d to %s", comment.ID, ticket.ID, to)
+	return nil
+}
+
+// ReplyAddress 生成带回复令牌的地址，例如 support+t42.1a2b3c4d5e@example.com
+func (s *EmailService) ReplyAddress(ticketID uint) string {
+	if s.cfg.ReplyTokenSecret == "" {
+		return s.cfg.Address
+	}
+	local, domain, ok := strings.Cut(s.cfg.Address, "@")
+	if !ok {
+		return s.cfg.Address
+	}
+	return fmt.Sprintf("%s+t%d.%s@%s", local, ticketID, s.replyTokenSignature(ticketID), domain)
+}
+
+// parseReplyAddress 从收件地址中解析并校验回复令牌
+func (s *EmailService) parseReplyAddress(addr string) (uint, bool) {
+	if s.cfg.ReplyTokenSecret == "" {
+		return 0, false
+	}
+	if parsed, err := mail.ParseAddress(addr); err == nil {
+		addr = parsed.Address
+	}
+	local, _, ok := strings.Cut(addr, "@")
+	if !ok {
+		return 0, false
+	}
+	_, tag, ok := strings.Cut(local, "+")
+	if !ok || !strings.HasPrefix(tag, "t") {
+		return 0, false
+	}
+	idPart, sig, ok := strings.Cut(tag[1:], ".")
+	if !ok {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(idPart, 10, 64)
+	if err != nil || id == 0 {
+		return 0, false
+	}
+	if !hmac.Equal([]byte(strings.ToLower(sig)), []byte(s.replyTokenSignature(uint(id)))) {
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func (s *EmailService) replyTokenSignature(ticketID uint) string {
+	mac := hmac.New(sha256.New, []byte(s.cfg.ReplyTokenSecret))
+	fmt.Fprintf(mac, "ticket:%d", ticketID)
+	return hex.EncodeToString(mac.Sum(nil))[:10]
+}
+
+// ParseInboundEmail 解析 RFC 5322 邮件：优先取 text/plain 正文（去掉引用部分），收集附件
+func ParseInboundEmail(raw []byte) (*InboundEmail, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEmail, err)
+	}
+
+	dec := &mime.WordDecoder{CharsetReader: emailCharsetReader}
+	fromList, err := (&mail.AddressParser{WordDecoder: dec}).ParseList(msg.Header.Get("From"))
+	if err != nil || len(fromList) == 0 {
+		return nil, fmt.Errorf("%w: missing or invalid From header", ErrInvalidEmail)
+	}
+
+	subject, err := dec.DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		subject = msg.Header.Get("Subject")
+	}
+
+	in := &InboundEmail{
+		MessageID:     strings.TrimSpace(msg.Header.Get("Message-ID")),
+		InReplyTo:     firstMessageID(msg.Header.Get("In-Reply-To")),
+		References:    splitMessageIDs(msg.Header.Get("References")),
+		From:          fromList[0],
+		Subject:       strings.TrimSpace(subject),
+		AutoSubmitted: isAutoSubmitted(msg.Header),
+	}
+	for _, key := range []string{"To", "Cc", "Delivered-To"} {
+		if list, err := msg.Header.AddressList(key); err == nil {
+			for _, a := range list {
+				in.Recipients = append(in.Recipients, a.Address)
+			}
+		}
+	}
+
+	var text, html string
+	body := decodeTransferEncoding(msg.Header.Get("Content-Transfer-Encoding"), msg.Body)
+	if err := walkMIMEPart(msg.Header, body, &text, &html, &in.Attachments); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEmail, err)
+	}
+	if text == "" && html != "" {
+		text = htmlToText(html)
+	}
+	in.Text = stripQuotedReply(text)
+	return in, nil
+}
+
+type mimeHeader interface {
+	Get(key string) string
+}
+
+func walkMIMEPart(h mimeHeader, body io.Reader, text, html *string, attachments *[]EmailAttachment) error {
+	mediaType, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		mediaType = "text/plain"
+		params = map[string]string{}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			// multipart.Reader 已自动解码 quoted-printable
+			if err := walkMIMEPart(part.Header, decodeTransferEncoding(part.Header.Get("Content-Transfer-Encoding"), part), text, html, attachments); err != nil {
+				return err
+			}
+		}
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+
+	disposition, dparams, _ := mime.ParseMediaType(h.Get("Content-Disposition"))
+	filename := dparams["filename"]
+	if filename == "" {
+		filename = params["name"]
+	}
+	if filename != "" {
+		if decoded, err := (&mime.WordDecoder{CharsetReader: emailCharsetReader}).DecodeHeader(filename); err == nil {
+			filename = decoded
+		}
+	}
+
+	if strings.HasPrefix(mediaType, "text/") && filename == "" {
+		data = decodeCharset(params["charset"], data)
+	}
+
+	switch {
+	case disposition == "attachment" || (filename != "" && !strings.HasPrefix(mediaType, "text/")):
+		*attachments = append(*attachments, EmailAttachment{FileName: filename, ContentType: mediaType, Data: data})
+	case mediaType == "text/plain" && *text == "":
+		*text = string(data)
+	case mediaType == "text/html" && *html == "":
+		*html = string(data)
+	case filename != "":
+		*attachments = append(*attachments, EmailAttachment{FileName: filename, ContentType: mediaType, Data: data})
+	}
+	return nil
+}
+
+func decodeTransferEncoding(encoding string, r io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, &newlineStripper{r: r})
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	default:
+		return r
+	}
+}
+
+// newlineStripper 去掉 base64 正文中的换行
+type newlineStripper struct {
+	r io.Reader
+}
+
+func (n *newlineStripper) Read(p []byte) (int, error) {
+	for {
+		c, err := n.r.Read(p)
+		k := 0
+		for _, b := range p[:c] {
+			if b != '\r' && b != '\n' {
+				p[k] = b
+				k++
+			}
+		}
+		if k > 0 || err != nil {
+			return k, err
+		}
+	}
+}
+
+// emailCharsetReader 支持 GBK/GB2312/Big5 等非 UTF-8 编码
+func emailCharsetReader(charset string, input io.Reader) (io.Reader, error) {
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return nil, err
+	}
+	return enc.NewDecoder().Reader(input), nil
+}
+
+func decodeCharset(charset string, data []byte) []byte {
+	switch strings.ToLower(strings.TrimSpace(charset)) {
+	case "", "utf-8", "utf8", "us-ascii":
+		return data
+	}
+	r, err := emailCharsetReader(charset, bytes.NewReader(data))
+	if err != nil {
+		return data
+	}
+	decoded, err := io.ReadAll(r)
+	if err != nil {
+		return data
+	}
+	return decoded
+}
+
+func isAutoSubmitted(h mail.Header) bool {
+	if v := strings.ToLower(strings.TrimSpace(h.Get("Auto-Submitted"))); v != "" && v != "no" {
+		return true
+	}
+	switch strings.ToLower(strings.TrimSpace(h.Get("Precedence"))) {
+	case "bulk", "junk", "auto_reply":
+		return true
+	}
+	return h.Get("X-Autoreply") != "" || h.Get("X-Autorespond") != ""
+}
+
+var messageIDPattern = regexp.MustCompile(`<[^<>\s]+>`)
+
+func splitMessageIDs(v string) []string {
+	return messageIDPattern.FindAllString(v, -1)
+}
+
+func firstMessageID(v string) string {
+	if ids := splitMessageIDs(v); len(ids) > 0 {
+		return ids[0]
+	}
+	return strings.TrimSpace(v)
+}
+
+var (
+	replyPrefixPattern = regexp.MustCompile(`(?i)^\s*((re|fw|fwd|回复|答复|转发)\s*[:：]\s*)+`)
+	ticketTagPattern   = regexp.MustCompile(`\s*\[#\d+\]\s*$`)
+)
+
+func stripReplyPrefix(subject string) string {
+	subject = replyPrefixPattern.ReplaceAllString(subject, "")
+	// 去掉之前附加的工单号，避免重复
+	return strings.TrimSpace(ticketTagPattern.ReplaceAllString(subject, ""))
+}
+
+// 常见邮件客户端的引用分隔行
+var quotedReplyMarkers = []*regexp.Regexp{
+	regexp.MustCompile(`^On .+wrote:\s*$`),
+	regexp.MustCompile(`^在.+写道[:：]\s*$`),
+	regexp.MustCompile(`^-{2,}\s*(Original Message|原始邮件)\s*-{2,}`),
+	regexp.MustCompile(`^(From|发件人)\s*[:：].+`),
+}
+
+// stripQuotedReply 截掉回复中引用的历史内容
+func stripQuotedReply(text string) string {
+	var out []string
+	scanner := bufio.NewScanner(strings.NewReader(strings.ReplaceAll(text, "\r\n", "\n")))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+scan:
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, ">") {
+			continue
+		}
+		for _, re := range quotedReplyMarkers {
+			if re.MatchString(trimmed) {
+				break scan
+			}
+		}
+		out = append(out, line)
+	}
+	return strings.TrimSpace(strings.Join(out, "\n"))
+}
+
+var (
+	htmlBreakPattern = regexp.MustCompile(`(?i)<\s*(br|/p|/div|/li)\s*/?>`)
+	htmlTagPattern   = regexp.MustCompile(`<[^>]*>`)
+)
+
+func htmlToText(html string) string {
+	text := htmlBreakPattern.ReplaceAllString(html, "\n")
+	text = htmlTagPattern.ReplaceAllString(text, "")
+	replacer := strings.NewReplacer("&nbsp;", " ", "&lt;", "<", "&gt;", ">", "&quot;", `"`, "&#39;", "'", "&amp;", "&")
+	return strings.TrimSpace(replacer.Replace(text))
+}
+
+func sanitizeEmailFileName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "" || name == "." || name == "/" {
+		return "attachment"
+	}
+	return name
+}
@@ -0,0 +1,279 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"servify/apps/server/internal/models"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newEmailServiceTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := "file:email_service_" + t.Name() + "?mode=memory&cache=shared"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(
+		&models.User{}, &models.Agent{}, &models.Session{},
+		&models.Ticket{}, &models.TicketComment{}, &models.TicketFile{}, &models.TicketStatus{},
+		&models.TicketCustomFieldValue{}, &models.CustomField{}, &models.TicketEmail{},
+	); err != nil {
+		t.Fatalf("auto migrate: %v", err)
+	}
+	return db
+}
+
+func newEmailServiceForTest(t *testing.T, db *gorm.DB, smtpAddr string) *EmailService {
+	t.Helper()
+	host, port := "127.0.0.1", 25
+	if smtpAddr != "" {
+		h, p, _ := net.SplitHostPort(smtpAddr)
+		host = h
+		port, _ = strconv.Atoi(p)
+	}
+	return NewEmailService(db, logrus.New(), NewTicketService(db, logrus.New(), nil), EmailServiceConfig{
+		Address:          "support@example.com",
+		FromName:         "Servify Support",
+		ReplyTokenSecret: "secret",
+		SMTPHost:         host,
+		SMTPPort:         port,
+		StoragePath:      t.TempDir(),
+	})
+}
+
+// captureDelivery 本地 SMTP 替身：记录收到的邮件
+type captureDelivery struct {
+	mu   sync.Mutex
+	msgs [][]byte
+	rcpt [][]string
+}
+
+func (c *captureDelivery) HandleDelivery(ctx context.Context, from string, rcpts []string, raw []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.msgs = append(c.msgs, raw)
+	c.rcpt = append(c.rcpt, rcpts)
+	return nil
+}
+
+const emailTestAttachment = "From: Alice <alice@customer.com>\r\n" +
+	"To: support@example.com\r\n" +
+	"Subject: =?UTF-8?B?5peg5rOV55m75b2V?=\r\n" +
+	"Message-ID: <m1@customer.com>\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=\"b1\"\r\n" +
+	"\r\n" +
+	"--b1\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"=E7=99=BB=E5=BD=95=E6=97=B6=E6=8F=90=E7=A4=BA=E5=AF=86=E7=A0=81=E9=94=99=E8=AF=AF\r\n" +
+	"--b1\r\n" +
+	"Content-Type: image/png; name=\"screen.png\"\r\n" +
+	"Content-Disposition: attachment; filename=\"screen.png\"\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"iVBORw0KGgo=\r\n" +
+	"--b1--\r\n"
+
+func TestEmailListener_InboundCreatesTicketWithAttachment(t *testing.T) {
+	db := newEmailServiceTestDB(t)
+	svc := newEmailServiceForTest(t, db, "")
+
+	listener := NewEmailListener(EmailListenerConfig{Addr: "127.0.0.1:0", Hostname: "example.com", AcceptDomains: []string{"example.com"}}, svc)
+	if err := listener.Start(); err != nil {
+		t.Fatalf("start listener: %v", err)
+	}
+	defer listener.Stop()
+
+	if err := smtp.SendMail(listener.Addr(), nil, "alice@customer.com", []string{"support@example.com"}, []byte(emailTestAttachment)); err != nil {
+		t.Fatalf("smtp send: %v", err)
+	}
+	// 非本域收件人应被拒绝（不做中继）
+	if err := smtp.SendMail(listener.Addr(), nil, "alice@customer.com", []string{"someone@other.com"}, []byte(emailTestAttachment)); err == nil {
+		t.Fatal("expected relay to be denied")
+	}
+
+	var ticket models.Ticket
+	if err := db.Preload("Customer").First(&ticket).Error; err != nil {
+		t.Fatalf("ticket not created: %v", err)
+	}
+	if ticket.Title != "无法登录" || ticket.Source != "email" || ticket.Description != "登录时提示密码错误" {
+		t.Fatalf("unexpected ticket: %+v", ticket)
+	}
+	if ticket.Customer.Email != "alice@customer.com" || ticket.Customer.Name != "Alice" {
+		t.Fatalf("unexpected customer: %+v", ticket.Customer)
+	}
+
+	var files []models.TicketFile
+	db.Where("ticket_id = ?", ticket.ID).Find(&files)
+	if len(files) != 1 || files[0].FileName != "screen.png" || files[0].MimeType != "image/png" {
+		t.Fatalf("unexpected files: %+v", files)
+	}
+	data, err := os.ReadFile(files[0].FilePath)
+	if err != nil || string(data) != "\x89PNG\r\n\x1a\n" {
+		t.Fatalf("attachment content mismatch: %q err=%v", data, err)
+	}
+}
+
+func TestEmailService_ReplyThreading(t *testing.T) {
+	db := newEmailServiceTestDB(t)
+	svc := newEmailServiceForTest(t, db, "")
+	ctx := context.Background()
+
+	first, err := svc.Ingest(ctx, []byte(emailTestAttachment), nil)
+	if err != nil || !first.Created {
+		t.Fatalf("ingest first: %+v err=%v", first, err)
+	}
+
+	// 重复投递同一 Message-ID
+	dup, err := svc.Ingest(ctx, []byte(emailTestAttachment), nil)
+	if err != nil || dup.Skipped != "duplicate" || dup.TicketID != first.TicketID {
+		t.Fatalf("expected duplicate skip: %+v err=%v", dup, err)
+	}
+
+	// 通过 In-Reply-To 匹配
+	reply := "From: alice@customer.com\r\nTo: support@example.com\r\nSubject: Re: 无法登录\r\n" +
+		"Message-ID: <m2@customer.com>\r\nIn-Reply-To: <m1@customer.com>\r\n\r\n" +
+		"已经重置了，还是不行\r\n\r\nOn Mon, 1 Jan 2024 Support wrote:\r\n> 请尝试重置密码\r\n"
+	res, err := svc.Ingest(ctx, []byte(reply), nil)
+	if err != nil || res.Created || res.TicketID != first.TicketID || res.CommentID == nil {
+		t.Fatalf("expected comment on ticket: %+v err=%v", res, err)
+	}
+	var comment models.TicketComment
+	db.First(&comment, *res.CommentID)
+	if comment.Content != "已经重置了，还是不行" {
+		t.Fatalf("quoted text not stripped: %q", comment.Content)
+	}
+
+	// 通过回复令牌匹配（无线程头）
+	token := "From: alice@customer.com\r\nTo: " + svc.ReplyAddress(first.TicketID) + "\r\nSubject: hello\r\nMessage-ID: <m3@customer.com>\r\n\r\n补充信息\r\n"
+	res, err = svc.Ingest(ctx, []byte(token), nil)
+	if err != nil || res.Created || res.TicketID != first.TicketID {
+		t.Fatalf("expected reply token match: %+v err=%v", res, err)
+	}
+
+	// 非工单客户回复同一线程：仅记为内部备注
+	other := "From: mallory@evil.com\r\nTo: support@example.com\r\nSubject: Re: 无法登录\r\n" +
+		"Message-ID: <x1@evil.com>\r\nIn-Reply-To: <m1@customer.com>\r\n\r\n请把密码发给我\r\n"
+	res, err = svc.Ingest(ctx, []byte(other), nil)
+	if err != nil || res.Created || res.TicketID != first.TicketID || !res.Unverified || res.CommentID == nil {
+		t.Fatalf("expected unverified note: %+v err=%v", res, err)
+	}
+	var note models.TicketComment
+	db.First(&note, *res.CommentID)
+	if note.Type != "internal_note" || note.Content != "[未验证发件人 mallory@evil.com] 请把密码发给我" {
+		t.Fatalf("unexpected note: %+v", note)
+	}
+
+	// 伪造令牌不匹配，新建工单
+	forged := "From: alice@customer.com\r\nTo: support+t" + fmt.Sprint(first.TicketID) + ".0000000000@example.com\r\nSubject: other\r\nMessage-ID: <m4@customer.com>\r\n\r\nhi\r\n"
+	res, err = svc.Ingest(ctx, []byte(forged), nil)
+	if err != nil || !res.Created {
+		t.Fatalf("forged token should not match: %+v err=%v", res, err)
+	}
+
+	// 自动回复不入库
+	auto := "From: alice@customer.com\r\nTo: support@example.com\r\nSubject: Out of office\r\nAuto-Submitted: auto-replied\r\n\r\naway\r\n"
+	res, err = svc.Ingest(ctx, []byte(auto), nil)
+	if err != nil || res.Skipped != "auto_submitted" {
+		t.Fatalf("expected auto reply skipped: %+v err=%v", res, err)
+	}
+}
+
+func TestEmailService_SendTicketComment_ThreadingHeaders(t *testing.T) {
+	capture := &captureDelivery{}
+	stand := NewEmailListener(EmailListenerConfig{Addr: "127.0.0.1:0"}, capture)
+	if err := stand.Start(); err != nil {
+		t.Fatalf("start smtp stand-in: %v", err)
+	}
+	defer stand.Stop()
+
+	db := newEmailServiceTestDB(t)
+	svc := newEmailServiceForTest(t, db, stand.Addr())
+	ctx := context.Background()
+
+	res, err := svc.Ingest(ctx, []byte(emailTestAttachment), nil)
+	if err != nil {
+		t.Fatalf("ingest: %v", err)
+	}
+	agent := &models.User{Username: "agent1", Email: "agent1@example.com", Role: "agent"}
+	db.Create(agent)
+	comment := &models.TicketComment{TicketID: res.TicketID, UserID: agent.ID, Content: "请尝试重置密码", Type: "comment"}
+	db.Create(comment)
+
+	if err := svc.SendTicketComment(ctx, comment); err != nil {
+		t.Fatalf("send comment: %v", err)
+	}
+
+	capture.mu.Lock()
+	defer capture.mu.Unlock()
+	if len(capture.msgs) != 1 || capture.rcpt[0][0] != "alice@customer.com" {
+		t.Fatalf("unexpected deliveries: %v", capture.rcpt)
+	}
+	msg, err := mail.ReadMessage(strings.NewReader(string(capture.msgs[0])))
+	if err != nil {
+		t.Fatalf("parse sent mail: %v", err)
+	}
+	if got := msg.Header.Get("In-Reply-To"); got != "<m1@customer.com>" {
+		t.Fatalf("unexpected In-Reply-To: %q", got)
+	}
+	if got := msg.Header.Get("References"); got != "<m1@customer.com>" {
+		t.Fatalf("unexpected References: %q", got)
+	}
+	if got := msg.Header.Get("Reply-To"); got != svc.ReplyAddress(res.TicketID) {
+		t.Fatalf("unexpected Reply-To: %q", got)
+	}
+	subject, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if subject != fmt.Sprintf("Re: 无法登录 [#%d]", res.TicketID) {
+		t.Fatalf("unexpected subject: %q", subject)
+	}
+
+	// 客户回复发出的邮件，应回到同一工单
+	var sent models.TicketEmail
+	if err := db.Where("direction = ?", "outbound").First(&sent).Error; err != nil {
+		t.Fatalf("outbound not recorded: %v", err)
+	}
+	reply := "From: alice@customer.com\r\nTo: support@example.com\r\nSubject: Re\r\nMessage-ID: <m9@customer.com>\r\nIn-Reply-To: " + sent.MessageID + "\r\n\r\nthanks\r\n"
+	again, err := svc.Ingest(ctx, []byte(reply), nil)
+	if err != nil || again.TicketID != res.TicketID || again.Created {
+		t.Fatalf("reply to outbound should thread: %+v err=%v", again, err)
+	}
+}
+
+func TestParseInboundEmail_GBKAndHTML(t *testing.T) {
+	raw := "From: =?GB2312?B?1cXI/Q==?= <zhangsan@customer.com>\r\n" +
+		"To: support@example.com\r\n" +
+		"Subject: =?GB2312?B?xOO6ww==?=\r\n" +
+		"Content-Type: text/html; charset=gb2312\r\n" +
+		"Content-Transfer-Encoding: base64\r\n\r\n" +
+		"PHA+xOO6ww==\r\n"
+	in, err := ParseInboundEmail([]byte(raw))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if in.Subject != "你好" || in.From.Address != "zhangsan@customer.com" {
+		t.Fatalf("unexpected header decoding: subject=%q from=%+v", in.Subject, in.From)
+	}
+	if in.Text != "你好" {
+		t.Fatalf("unexpected body: %q", in.Text)
+	}
+
+	if _, err := ParseInboundEmail([]byte("not an email")); err == nil {
+		t.Fatal("expected parse error")
+	}
+}
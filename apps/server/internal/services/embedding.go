@@ -0,0 +1,262 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// 向量化后端类型
+const (
+	EmbeddingProviderHash   = "hash" // 离线特征哈希，无需模型服务
+	EmbeddingProviderOpenAI = "openai"
+	EmbeddingProviderOllama = "ollama"
+)
+
+// EmbeddingConfig 向量化后端配置
+type EmbeddingConfig struct {
+	Provider   string
+	BaseURL    string
+	APIKey     string
+	Model      string
+	Dimensions int // hash 向量维度；openai 可指定输出维度（0 为模型默认）
+	Timeout    time.Duration
+}
+
+// Embedder 文本向量化；Model 标识向量空间，变化后已有索引需重建
+type Embedder interface {
+	Model() string
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// NewEmbedder 按类型创建向量化后端；provider 为空时使用 hash
+func NewEmbedder(cfg EmbeddingConfig) (Embedder, error) {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	base := llmHTTPProvider{
+		cfg: LLMProviderConfig{Name: cfg.Provider, BaseURL: cfg.BaseURL, APIKey: cfg.APIKey, Model: cfg.Model, Timeout: cfg.Timeout},
+		client: &http.Client{
+			Timeout:   cfg.Timeout,
+			Transport: otelhttp.NewTransport(http.DefaultTransport),
+		},
+	}
+	switch strings.ToLower(cfg.Provider) {
+	case EmbeddingProviderHash, "":
+		dims := cfg.Dimensions
+		if dims <= 0 {
+			dims = 512
+		}
+		return &HashEmbedder{dims: dims}, nil
+	case EmbeddingProviderOpenAI:
+		if base.cfg.BaseURL == "" {
+			base.cfg.BaseURL = "https://api.openai.com/v1"
+		}
+		if base.cfg.Model == "" {
+			base.cfg.Model = "text-embedding-3-small"
+		}
+		return &OpenAIEmbedder{llmHTTPProvider: base, dimensions: cfg.Dimensions}, nil
+	case EmbeddingProviderOllama:
+		if base.cfg.BaseURL == "" {
+			base.cfg.BaseURL = "http://localhost:11434"
+		}
+		if base.cfg.Model == "" {
+			return nil, fmt.Errorf("ollama embedding requires a model")
+		}
+		return &OllamaEmbedder{base}, nil
+	default:
+		return nil, fmt.Errorf("unknown embedding provider: %s", cfg.Provider)
+	}
+}
+
+// embedBatchSize 单次请求的最大文本数
+const embedBatchSize = 64
+
+// OpenAIEmbedder OpenAI /embeddings 及兼容接口
+type OpenAIEmbedder struct {
+	llmHTTPProvider
+	dimensions int
+}
+
+func (e *OpenAIEmbedder) Model() string { return "openai:" + e.cfg.Model }
+
+func (e *OpenAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	var headers map[string]string
+	if e.cfg.APIKey != "" {
+		headers = map[string]string{"Authorization": "Bearer " + e.cfg.APIKey}
+	}
+	out := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += embedBatchSize {
+		batch := texts[start:min(start+embedBatchSize, len(texts))]
+		payload := map[string]interface{}{"model": e.cfg.Model, "input": batch}
+		if e.dimensions > 0 {
+			payload["dimensions"] = e.dimensions
+		}
+		resp, err := e.post(ctx, "/embeddings", payload, headers, false)
+		if err != nil {
+			return nil, err
+		}
+		var body struct {
+			Data []struct {
+				Index     int       `json:"index"`
+				Embedding []float32 `json:"embedding"`
+			} `json:"data"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal embeddings: %w", err)
+		}
+		if len(body.Data) != len(batch) {
+			return nil, fmt.Errorf("embedding count mismatch: got %d, want %d", len(body.Data), len(batch))
+		}
+		vecs := make([][]float32, len(batch))
+		for _, d := range body.Data {
+			if d.Index < 0 || d.Index >= len(batch) {
+				return nil, fmt.Errorf("embedding index out of range: %d", d.Index)
+			}
+			vecs[d.Index] = d.Embedding
+		}
+		out = append(out, vecs...)
+	}
+	return out, nil
+}
+
+// OllamaEmbedder 本地 Ollama /api/embed
+type OllamaEmbedder struct {
+	llmHTTPProvider
+}
+
+func (e *OllamaEmbedder) Model() string { return "ollama:" + e.cfg.Model }
+
+func (e *OllamaEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	out := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += embedBatchSize {
+		batch := texts[start:min(start+embedBatchSize, len(texts))]
+		resp, err := e.post(ctx, "/api/embed", map[string]interface{}{"model": e.cfg.Model, "input": batch}, nil, false)
+		if err != nil {
+			return nil, err
+		}
+		var body struct {
+			Embeddings [][]float32 `json:"embeddings"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal embeddings: %w", err)
+		}
+		if len(body.Embeddings) != len(batch) {
+			return nil, fmt.Errorf("embedding count mismatch: got %d, want %d", len(body.Embeddings), len(batch))
+		}
+		out = append(out, body.Embeddings...)
+	}
+	return out, nil
+}
+
+// HashEmbedder 特征哈希向量：词（CJK 为单字与二元组）哈希到固定维度并按对数词频加权，归一化后可直接做余弦相似度
+type HashEmbedder struct {
+	dims int
+}
+
+func (e *HashEmbedder) Model() string { return fmt.Sprintf("hash:%d", e.dims) }
+
+func (e *HashEmbedder) Embed(_ context.Context, texts []string) ([][]float32, error) {
+	out := make([][]float32, len(texts))
+	for i, text := range texts {
+		counts := make(map[string]int)
+		for _, tok := range searchTokens(text) {
+			counts[tok]++
+		}
+		vec := make([]float32, e.dims)
+		for tok, n := range counts {
+			h := fnv.New32a()
+			_, _ = h.Write([]byte(tok))
+			sum := h.Sum32()
+			w := float32(1 + math.Log(float64(n)))
+			if sum&(1<<31) != 0 {
+				w = -w
+			}
+			vec[int(sum%uint32(e.dims))] += w
+		}
+		out[i] = normalizeVector(vec)
+	}
+	return out, nil
+}
+
+func normalizeVector(v []float32) []float32 {
+	var norm float64
+	for _, x := range v {
+		norm += float64(x) * float64(x)
+	}
+	if norm == 0 {
+		return v
+	}
+	n := float32(math.Sqrt(norm))
+	for i := range v {
+		v[i] /= n
+	}
+	return v
+}
+
+// cosineSimilarity 维度不一致时返回 0
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
+
+// searchTokens 检索分词：字母数字按词切分并转小写；汉字、假名、谚文取单字及相邻二元组
+func searchTokens(text string) []string {
+	var (
+		tokens []string
+		word   strings.Builder
+		prev   rune // 上一个 CJK 字符，非 CJK 时为 0
+	)
+	flush := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, word.String())
+			word.Reset()
+		}
+	}
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case isCJK(r):
+			flush()
+			tokens = append(tokens, string(r))
+			if prev != 0 {
+				tokens = append(tokens, string([]rune{prev, r}))
+			}
+			prev = r
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			word.WriteRune(r)
+			prev = 0
+		default:
+			flush()
+			prev = 0
+		}
+	}
+	flush()
+	return tokens
+}
+
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r)
+}
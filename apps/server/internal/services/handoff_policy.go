@@ -0,0 +1,467 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"servify/apps/server/internal/models"
+)
+
+// 转人工信号名称（记录于 HandoffDecision 与 TransferRecord）
+const (
+	HandoffSignalKeyword           = "keyword"
+	HandoffSignalLowConfidence     = "low_confidence"
+	HandoffSignalNegativeSentiment = "negative_sentiment"
+	HandoffSignalUnanswered        = "repeated_question"
+	HandoffSignalVIP               = "vip_customer"
+	HandoffSignalOffHours          = "outside_business_hours"
+)
+
+// maxConfidenceSessions 内存中跟踪置信度的会话上限，超出后清空重新累计
+const maxConfidenceSessions = 10000
+
+// HandoffPolicyConfig 转人工策略：各信号命中时累加权重，总分不低于 Threshold 时转人工；权重为 0 的信号不参与
+type HandoffPolicyConfig struct {
+	Threshold float64 // 默认 1.0
+
+	// 关键词：按语言（zh、en 或 zh-CN 等）配置，匹配问题语言的列表；该语言未配置时检查全部列表
+	KeywordWeight float64
+	Keywords      map[string][]string
+
+	// AI 回答置信度连续 LowConfidenceStreak 次低于 LowConfidenceBelow
+	LowConfidenceWeight float64
+	LowConfidenceBelow  float64 // 默认 0.5
+	LowConfidenceStreak int     // 默认 3
+
+	// 负面情绪词，按语言配置，规则同关键词
+	NegativeWeight float64
+	NegativeTerms  map[string][]string
+
+	// 同一问题（含本次）重复提问 UnansweredRepeats 次
+	UnansweredWeight  float64
+	UnansweredRepeats int // 默认 3
+
+	// 客户等级（customers.priority）或标签命中 VIPTiers
+	VIPWeight float64
+	VIPTiers  []string // 默认 urgent、vip
+
+	// 工作时间外累加 OffHoursWeight（通常为负值，无人值守时抑制转人工）；Days 为空时不启用
+	OffHoursWeight float64
+	Timezone       string         // 默认 Local
+	Days           []time.Weekday // 工作日
+	StartMinute    int            // 当天开始时间（分钟），如 9:00 为 540
+	EndMinute      int            // 当天结束时间（分钟，不含）
+
+	Now func() time.Time // 测试用
+}
+
+// DefaultHandoffPolicyConfig 默认策略：仅明确要求人工或投诉时转接，其他信号单独命中不足以转接
+func DefaultHandoffPolicyConfig() HandoffPolicyConfig {
+	return HandoffPolicyConfig{
+		Threshold:           1.0,
+		KeywordWeight:       1.0,
+		Keywords:            defaultHandoffKeywords(),
+		LowConfidenceWeight: 0.5,
+		LowConfidenceBelow:  0.5,
+		LowConfidenceStreak: 3,
+		NegativeWeight:      0.5,
+		NegativeTerms:       defaultNegativeTerms(),
+		UnansweredWeight:    0.6,
+		UnansweredRepeats:   3,
+		VIPWeight:           0.4,
+		VIPTiers:            []string{"urgent", "vip"},
+	}
+}
+
+func defaultHandoffKeywords() map[string][]string {
+	return map[string][]string{
+		"zh": {"人工", "客服", "转人工", "投诉"},
+		"en": {"human", "agent", "manual", "real person", "complaint"},
+	}
+}
+
+func defaultNegativeTerms() map[string][]string {
+	return map[string][]string{
+		"zh": {"生气", "愤怒", "垃圾", "太差", "失望", "没用", "骗子", "退款", "气死"},
+		"en": {"angry", "terrible", "useless", "awful", "ridiculous", "frustrated", "scam", "refund", "worst"},
+	}
+}
+
+// HandoffSignal 命中的单个信号
+type HandoffSignal struct {
+	Name   string  `json:"name"`
+	Weight float64 `json:"weight"`
+	Detail string  `json:"detail,omitempty"`
+}
+
+// HandoffDecision 一次转人工判断的结果及依据
+type HandoffDecision struct {
+	Transfer  bool            `json:"transfer"`
+	Score     float64         `json:"score"`
+	Threshold float64         `json:"threshold"`
+	Signals   []HandoffSignal `json:"signals"`
+}
+
+// Reason 命中信号名称，逗号分隔；未命中时为空
+func (d *HandoffDecision) Reason() string {
+	if d == nil {
+		return ""
+	}
+	names := make([]string, 0, len(d.Signals))
+	for _, sig := range d.Signals {
+		names = append(names, sig.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+// JSON 序列化结果，用于写入转接与等待记录
+func (d *HandoffDecision) JSON() string {
+	if d == nil {
+		return ""
+	}
+	b, err := json.Marshal(d)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// HandoffEvaluator 可给出转人工判断依据的 AI 服务（可选实现）
+type HandoffEvaluator interface {
+	EvaluateHandoff(ctx context.Context, sessionID, query string, history []models.Message) *HandoffDecision
+}
+
+// HandoffPolicy 按配置的信号与权重判断是否转人工
+type HandoffPolicy struct {
+	cfg HandoffPolicyConfig
+	loc *time.Location
+
+	mu         sync.Mutex
+	confidence map[string][]float64 // 会话最近的 AI 回答置信度
+}
+
+// NewHandoffPolicy 创建转人工策略；权重按原样使用（全部为 0 时不会转人工），其余零值参数使用默认值
+func NewHandoffPolicy(cfg HandoffPolicyConfig) (*HandoffPolicy, error) {
+	def := DefaultHandoffPolicyConfig()
+	if cfg.Threshold <= 0 {
+		cfg.Threshold = def.Threshold
+	}
+	if len(cfg.Keywords) == 0 {
+		cfg.Keywords = def.Keywords
+	}
+	if cfg.LowConfidenceBelow <= 0 {
+		cfg.LowConfidenceBelow = def.LowConfidenceBelow
+	}
+	if cfg.LowConfidenceStreak <= 0 {
+		cfg.LowConfidenceStreak = def.LowConfidenceStreak
+	}
+	if len(cfg.NegativeTerms) == 0 {
+		cfg.NegativeTerms = def.NegativeTerms
+	}
+	if cfg.UnansweredRepeats <= 1 {
+		cfg.UnansweredRepeats = def.UnansweredRepeats
+	}
+	if len(cfg.VIPTiers) == 0 {
+		cfg.VIPTiers = def.VIPTiers
+	}
+	cfg.Keywords = normalizeLocaleTerms(cfg.Keywords)
+	cfg.NegativeTerms = normalizeLocaleTerms(cfg.NegativeTerms)
+	cfg.VIPTiers = normalizeTags(cfg.VIPTiers)
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+
+	loc := time.Local
+	if cfg.Timezone != "" {
+		l, err := time.LoadLocation(cfg.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid handoff timezone %q: %w", cfg.Timezone, err)
+		}
+		loc = l
+	}
+	if len(cfg.Days) > 0 && (cfg.StartMinute < 0 || cfg.EndMinute > 24*60 || cfg.StartMinute >= cfg.EndMinute) {
+		return nil, fmt.Errorf("invalid handoff business hours %d-%d", cfg.StartMinute, cfg.EndMinute)
+	}
+	return &HandoffPolicy{cfg: cfg, loc: loc, confidence: make(map[string][]float64)}, nil
+}
+
+// normalizeLocaleTerms 语言键取语言子标签（zh-CN -> zh），词条转小写并去空
+func normalizeLocaleTerms(in map[string][]string) map[string][]string {
+	out := make(map[string][]string, len(in))
+	for locale, terms := range in {
+		lang := localeLanguage(locale)
+		for _, t := range terms {
+			if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+				out[lang] = append(out[lang], t)
+			}
+		}
+	}
+	return out
+}
+
+// ObserveConfidence 记录会话中一次 AI 回答的置信度
+func (p *HandoffPolicy) ObserveConfidence(sessionID string, confidence float64) {
+	if p == nil || sessionID == "" {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.confidence[sessionID]; !ok && len(p.confidence) >= maxConfidenceSessions {
+		p.confidence = make(map[string][]float64)
+	}
+	hist := append(p.confidence[sessionID], confidence)
+	if n := p.cfg.LowConfidenceStreak; len(hist) > n {
+		hist = hist[len(hist)-n:]
+	}
+	p.confidence[sessionID] = hist
+}
+
+// lowConfidenceStreak 会话末尾连续低置信度回答的次数
+func (p *HandoffPolicy) lowConfidenceStreak(sessionID string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	hist := p.confidence[sessionID]
+	streak := 0
+	for i := len(hist) - 1; i >= 0 && hist[i] < p.cfg.LowConfidenceBelow; i-- {
+		streak++
+	}
+	return streak
+}
+
+// reset 转人工后清空会话的置信度记录
+func (p *HandoffPolicy) reset(sessionID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.confidence, sessionID)
+}
+
+// Evaluate 计算转人工得分；tier 为客户等级与标签，未知时为空
+func (p *HandoffPolicy) Evaluate(sessionID, query string, history []models.Message, tier []string) *HandoffDecision {
+	d := &HandoffDecision{Threshold: p.cfg.Threshold, Signals: []HandoffSignal{}}
+	add := func(name string, weight float64, detail string) {
+		if weight == 0 {
+			return
+		}
+		d.Signals = append(d.Signals, HandoffSignal{Name: name, Weight: weight, Detail: detail})
+		d.Score += weight
+	}
+
+	lower := strings.ToLower(query)
+	if term := matchLocaleTerms(lower, p.cfg.Keywords); term != "" {
+		add(HandoffSignalKeyword, p.cfg.KeywordWeight, term)
+	}
+	if term := matchLocaleTerms(lower, p.cfg.NegativeTerms); term != "" {
+		add(HandoffSignalNegativeSentiment, p.cfg.NegativeWeight, term)
+	}
+	if p.cfg.LowConfidenceWeight != 0 {
+		if n := p.lowConfidenceStreak(sessionID); n >= p.cfg.LowConfidenceStreak {
+			add(HandoffSignalLowConfidence, p.cfg.LowConfidenceWeight, fmt.Sprintf("%d consecutive answers below %.2f", n, p.cfg.LowConfidenceBelow))
+		}
+	}
+	if p.cfg.UnansweredWeight != 0 {
+		if n := repeatedQuestions(query, history); n >= p.cfg.UnansweredRepeats {
+			add(HandoffSignalUnanswered, p.cfg.UnansweredWeight, fmt.Sprintf("asked %d times", n))
+		}
+	}
+	if p.cfg.VIPWeight != 0 {
+		for _, t := range tier {
+			if containsFold(p.cfg.VIPTiers, t) {
+				add(HandoffSignalVIP, p.cfg.VIPWeight, t)
+				break
+			}
+		}
+	}
+	if p.cfg.OffHoursWeight != 0 && !p.inBusinessHours() {
+		add(HandoffSignalOffHours, p.cfg.OffHoursWeight, p.cfg.Now().In(p.loc).Format("Mon 15:04"))
+	}
+
+	d.Score = math.Round(d.Score*100) / 100
+	d.Transfer = d.Score >= d.Threshold
+	return d
+}
+
+// inBusinessHours 未配置工作日时视为始终在工作时间内
+func (p *HandoffPolicy) inBusinessHours() bool {
+	if len(p.cfg.Days) == 0 {
+		return true
+	}
+	now := p.cfg.Now().In(p.loc)
+	day := false
+	for _, d := range p.cfg.Days {
+		if d == now.Weekday() {
+			day = true
+			break
+		}
+	}
+	minute := now.Hour()*60 + now.Minute()
+	return day && minute >= p.cfg.StartMinute && minute < p.cfg.EndMinute
+}
+
+// matchLocaleTerms 返回首个命中的词；优先使用问题语言的词表，该语言未配置时检查全部词表
+func matchLocaleTerms(text string, terms map[string][]string) string {
+	lists := make([][]string, 0, len(terms))
+	if list, ok := terms[detectLanguage(text)]; ok {
+		lists = append(lists, list)
+	} else {
+		langs := make([]string, 0, len(terms))
+		for lang := range terms {
+			langs = append(langs, lang)
+		}
+		sort.Strings(langs)
+		for _, lang := range langs {
+			lists = append(lists, terms[lang])
+		}
+	}
+	for _, list := range lists {
+		for _, t := range list {
+			if strings.Contains(text, t) {
+				return t
+			}
+		}
+	}
+	return ""
+}
+
+// repeatedQuestions 客户在坐席介入前提出与 query 相近问题的次数（含本次）；history 顺序不限
+func repeatedQuestions(query string, history []models.Message) int {
+	msgs := append([]models.Message(nil), history...)
+	sort.SliceStable(msgs, func(i, j int) bool {
+		if !msgs[i].CreatedAt.Equal(msgs[j].CreatedAt) {
+			return msgs[i].CreatedAt.Before(msgs[j].CreatedAt)
+		}
+		return msgs[i].ID < msgs[j].ID
+	})
+	target := questionShingles(query)
+	count := 1
+	current := true // 最近一条客户消息可能就是本次问题（已落库）
+	for i := len(msgs) - 1; i >= 0; i-- {
+		m := msgs[i]
+		if m.Sender == "agent" {
+			break
+		}
+		if m.Sender != "user" {
+			continue
+		}
+		sim := shingleSimilarity(target, questionShingles(m.Content))
+		if current {
+			current = false
+			if sim == 1 {
+				continue
+			}
+		}
+		if sim >= 0.6 {
+			count++
+		}
+	}
+	return count
+}
+
+// questionShingles 去除标点后的字符二元组
+func questionShingles(text string) map[string]struct{} {
+	runes := make([]rune, 0, len(text))
+	for _, r := range strings.ToLower(text) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			runes = append(runes, r)
+		}
+	}
+	out := make(map[string]struct{})
+	if len(runes) == 1 {
+		out[string(runes)] = struct{}{}
+	}
+	for i := 0; i+1 < len(runes); i++ {
+		out[string(runes[i:i+2])] = struct{}{}
+	}
+	return out
+}
+
+// shingleSimilarity Jaccard 相似度
+func shingleSimilarity(a, b map[string]struct{}) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	inter := 0
+	for k := range a {
+		if _, ok := b[k]; ok {
+			inter++
+		}
+	}
+	return float64(inter) / float64(len(a)+len(b)-inter)
+}
+
+// SetHandoffPolicy 替换转人工策略；nil 恢复默认策略
+func (s *AIService) SetHandoffPolicy(p *HandoffPolicy) {
+	if p == nil {
+		p = defaultHandoffPolicy()
+	}
+	s.handoff = p
+}
+
+// handoffPolicy 未配置时只创建一次默认策略并保留，连续低置信度等会话状态才能累积
+func (s *AIService) handoffPolicy() *HandoffPolicy {
+	s.handoffOnce.Do(func() {
+		if s.handoff == nil {
+			s.handoff = defaultHandoffPolicy()
+		}
+	})
+	return s.handoff
+}
+
+func defaultHandoffPolicy() *HandoffPolicy {
+	p, _ := NewHandoffPolicy(DefaultHandoffPolicyConfig())
+	return p
+}
+
+// observeConfidence 记录 AI 回答置信度，供连续低置信度信号使用
+func (s *AIService) observeConfidence(sessionID string, confidence float64) {
+	s.handoffPolicy().ObserveConfidence(sessionID, confidence)
+}
+
+// EvaluateHandoff 按转人工策略判断并给出命中的信号
+func (s *AIService) EvaluateHandoff(ctx context.Context, sessionID, query string, history []models.Message) *HandoffDecision {
+	p := s.handoffPolicy()
+	d := p.Evaluate(sessionID, query, history, s.customerTierTags(ctx, sessionID))
+	entry := logrus.WithFields(logrus.Fields{"session_id": sessionID, "score": d.Score, "reason": d.Reason()})
+	if d.Transfer {
+		p.reset(sessionID)
+		entry.Info("AI handoff to human")
+	} else {
+		entry.Debug("AI handoff not triggered")
+	}
+	return d
+}
+
+// customerTierTags 会话客户的等级与标签
+func (s *AIService) customerTierTags(ctx context.Context, sessionID string) []string {
+	if s.db == nil || sessionID == "" {
+		return nil
+	}
+	var row struct {
+		Priority string
+		Tags     string
+	}
+	err := s.db.WithContext(ctx).Table("customers").
+		Select("customers.priority, customers.tags").
+		Joins("JOIN sessions ON sessions.user_id = customers.user_id").
+		Where("sessions.id = ? AND customers.deleted_at IS NULL", sessionID).
+		Limit(1).
+		Scan(&row).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		logrus.Warnf("handoff: load customer tier for session %s failed: %v", sessionID, err)
+		return nil
+	}
+	out := normalizeTags(strings.Split(row.Tags, ","))
+	if row.Priority != "" {
+		out = append(out, row.Priority)
+	}
+	return out
+}
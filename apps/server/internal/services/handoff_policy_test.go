@@ -0,0 +1,198 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"servify/apps/server/internal/models"
+)
+
+func newHandoffPolicy(t *testing.T, cfg HandoffPolicyConfig) *HandoffPolicy {
+	t.Helper()
+	p, err := NewHandoffPolicy(cfg)
+	if err != nil {
+		t.Fatalf("NewHandoffPolicy: %v", err)
+	}
+	return p
+}
+
+func TestHandoffPolicy_DefaultDoesNotTransferLongConversations(t *testing.T) {
+	p := newHandoffPolicy(t, DefaultHandoffPolicyConfig())
+	var history []models.Message
+	for i := 0; i < 10; i++ {
+		history = append(history,
+			models.Message{ID: uint(2*i + 1), SessionID: "s1", Sender: "user", Content: []string{"怎么开发票", "运费多少", "支持哪些支付方式", "多久发货", "能改地址吗"}[i%5]},
+			models.Message{ID: uint(2*i + 2), SessionID: "s1", Sender: "ai", Content: "好的"},
+		)
+	}
+	if d := p.Evaluate("s1", "可以开增值税专票吗", history, nil); d.Transfer {
+		t.Fatalf("decision = %+v", d)
+	}
+	d := p.Evaluate("s1", "Please get me a HUMAN", nil, nil)
+	if !d.Transfer || d.Reason() != HandoffSignalKeyword || d.Signals[0].Detail != "human" {
+		t.Fatalf("decision = %+v", d)
+	}
+}
+
+func TestHandoffPolicy_WeightedSignals(t *testing.T) {
+	p := newHandoffPolicy(t, HandoffPolicyConfig{
+		Threshold:           1.0,
+		KeywordWeight:       1.0,
+		Keywords:            map[string][]string{"zh-CN": {"找经理"}, "en": {"manager"}},
+		LowConfidenceWeight: 0.5,
+		LowConfidenceStreak: 2,
+		NegativeWeight:      0.5,
+		NegativeTerms:       map[string][]string{"zh": {"太慢"}},
+		UnansweredWeight:    0.5,
+		UnansweredRepeats:   3,
+		VIPWeight:           0.5,
+	})
+
+	// 仅按问题语言的词表匹配
+	if d := p.Evaluate("s1", "我要找经理", nil, nil); !d.Transfer {
+		t.Fatalf("zh keyword: %+v", d)
+	}
+	if d := p.Evaluate("s1", "manager 在吗", nil, nil); d.Transfer {
+		t.Fatalf("en keyword in zh query: %+v", d)
+	}
+
+	// 负面情绪 + VIP 达到阈值
+	d := p.Evaluate("s1", "发货太慢了", nil, []string{"Urgent"})
+	if !d.Transfer || d.Reason() != "negative_sentiment,vip_customer" || d.Score != 1.0 {
+		t.Fatalf("sentiment+vip: %+v", d)
+	}
+
+	// 连续低置信度 + 重复提问
+	p.ObserveConfidence("s2", 0.9)
+	p.ObserveConfidence("s2", 0.3)
+	if d := p.Evaluate("s2", "退货地址是哪里", nil, nil); len(d.Signals) != 0 {
+		t.Fatalf("single low answer: %+v", d)
+	}
+	p.ObserveConfidence("s2", 0.4)
+	base := time.Now()
+	history := []models.Message{
+		{ID: 5, Sender: "user", Content: "退货地址是哪里？", CreatedAt: base.Add(5 * time.Second)},
+		{ID: 4, Sender: "ai", Content: "请查看订单详情", CreatedAt: base.Add(4 * time.Second)},
+		{ID: 3, Sender: "user", Content: "退货地址是哪里", CreatedAt: base.Add(3 * time.Second)},
+		{ID: 2, Sender: "ai", Content: "您好", CreatedAt: base.Add(2 * time.Second)},
+		{ID: 1, Sender: "user", Content: "请问退货地址是哪里", CreatedAt: base.Add(1 * time.Second)},
+	}
+	d = p.Evaluate("s2", "退货地址是哪里", history, nil)
+	if !d.Transfer || d.Reason() != "low_confidence,repeated_question" {
+		t.Fatalf("confidence+repeat: %+v", d)
+	}
+
+	// 坐席回复后重新计数
+	history = append(history, models.Message{ID: 0, Sender: "agent", Content: "稍等", CreatedAt: base.Add(2500 * time.Millisecond)})
+	if n := repeatedQuestions("退货地址是哪里", history); n != 2 {
+		t.Fatalf("repeats after agent reply = %d", n)
+	}
+}
+
+func TestHandoffPolicy_BusinessHours(t *testing.T) {
+	now := time.Date(2026, 10, 17, 20, 0, 0, 0, time.UTC) // 周六
+	cfg := HandoffPolicyConfig{
+		KeywordWeight:  1.0,
+		OffHoursWeight: -1.0,
+		Timezone:       "UTC",
+		Days:           []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+		StartMinute:    9 * 60,
+		EndMinute:      18 * 60,
+		Now:            func() time.Time { return now },
+	}
+	p := newHandoffPolicy(t, cfg)
+	d := p.Evaluate("s1", "转人工", nil, nil)
+	if d.Transfer || d.Reason() != "keyword,outside_business_hours" {
+		t.Fatalf("off hours: %+v", d)
+	}
+	now = time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	if d := p.Evaluate("s1", "转人工", nil, nil); !d.Transfer {
+		t.Fatalf("business hours: %+v", d)
+	}
+
+	// 全部权重为 0 时不再转人工
+	if d := newHandoffPolicy(t, HandoffPolicyConfig{}).Evaluate("s1", "转人工", nil, nil); d.Transfer || len(d.Signals) != 0 {
+		t.Fatalf("all signals off: %+v", d)
+	}
+
+	cfg.Timezone = "Mars/Olympus"
+	if _, err := NewHandoffPolicy(cfg); err == nil {
+		t.Fatalf("expected invalid timezone error")
+	}
+}
+
+func TestAIService_EvaluateHandoff_VIPAndTransferRecord(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:handoff_"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.Customer{}, &models.Agent{}, &models.Session{}, &models.Message{}, &models.TransferRecord{}, &models.WaitingRecord{}); err != nil {
+		t.Fatalf("automigrate: %v", err)
+	}
+	db.Create(&models.User{ID: 1, Username: "u1", Email: "u1@example.com", Role: "customer"})
+	db.Create(&models.User{ID: 2, Username: "a1", Email: "a1@example.com", Role: "agent"})
+	db.Create(&models.Customer{UserID: 1, Priority: "normal", Tags: "VIP,retail"})
+	db.Create(&models.Agent{UserID: 2, Status: "offline", MaxConcurrent: 5})
+	db.Create(&models.Session{ID: "s1", UserID: 1, Status: "active", Platform: "web", StartedAt: time.Now()})
+
+	ai := NewAIService("", "")
+	ai.SetDB(db)
+	ai.SetHandoffPolicy(newHandoffPolicy(t, HandoffPolicyConfig{Threshold: 0.9, NegativeWeight: 0.5, VIPWeight: 0.5}))
+
+	d := ai.EvaluateHandoff(context.Background(), "s1", "this is useless", nil)
+	if !d.Transfer || d.Reason() != "negative_sentiment,vip_customer" {
+		t.Fatalf("decision = %+v", d)
+	}
+	if ai.ShouldTransferToHuman("", "this is useless", nil) {
+		t.Fatalf("expected no transfer without session (VIP unknown)")
+	}
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.WarnLevel)
+	agentSvc := NewAgentService(db, logger)
+	transferSvc := NewSessionTransferService(db, logger, ai, agentSvc, nil)
+	ctx := context.Background()
+
+	// 无在线客服时记入等待记录，分配后写入转接记录
+	if _, err := transferSvc.TransferToHuman(ctx, &TransferRequest{SessionID: "s1", Reason: d.Reason(), Handoff: d}); err != nil {
+		t.Fatalf("TransferToHuman: %v", err)
+	}
+	if err := agentSvc.AgentGoOnline(ctx, 2); err != nil {
+		t.Fatalf("AgentGoOnline: %v", err)
+	}
+	if err := transferSvc.ProcessWaitingQueue(ctx); err != nil {
+		t.Fatalf("ProcessWaitingQueue: %v", err)
+	}
+	var tr models.TransferRecord
+	if err := db.Where("session_id = ?", "s1").First(&tr).Error; err != nil {
+		t.Fatalf("transfer record: %v", err)
+	}
+	var stored HandoffDecision
+	if err := json.Unmarshal([]byte(tr.HandoffDecision), &stored); err != nil {
+		t.Fatalf("decode handoff decision %q: %v", tr.HandoffDecision, err)
+	}
+	if tr.Reason != "negative_sentiment,vip_customer" || !stored.Transfer || stored.Threshold != 0.9 || len(stored.Signals) != 2 || stored.Signals[1].Detail != "VIP" {
+		t.Fatalf("record = %+v, decision = %+v", tr, stored)
+	}
+}
+
+func TestAIService_DefaultHandoffPolicyKeepsConfidenceStreak(t *testing.T) {
+	for name, ai := range map[string]*AIService{"constructor": NewAIService("", ""), "zero value": {}} {
+		if d := ai.EvaluateHandoff(context.Background(), "s1", "this is useless", nil); d.Transfer {
+			t.Fatalf("%s: transfer without low-confidence streak: %+v", name, d)
+		}
+		for i := 0; i < 3; i++ {
+			ai.observeConfidence("s1", 0.2)
+		}
+		d := ai.EvaluateHandoff(context.Background(), "s1", "this is useless", nil)
+		if !d.Transfer || d.Reason() != HandoffSignalNegativeSentiment+","+HandoffSignalLowConfidence {
+			t.Fatalf("%s: decision = %+v", name, d)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// HubBackplane WebSocketHub 的跨实例消息总线
+// 每个实例把发往会话/广播的消息发布到总线，再由总线回送到持有该会话连接的实例；
+// 同时记录会话在线于哪些实例（presence），以便定向投递。
+type HubBackplane interface {
+	// NodeID 当前实例标识
+	NodeID() string
+	// Publish 发布消息；SessionID 为空表示广播到所有实例
+	Publish(ctx context.Context, msg WebSocketMessage) error
+	// Subscribe 注册本实例的消息处理函数，收到的消息应投递给本地连接
+	Subscribe(handler func(WebSocketMessage)) error
+	// ClaimSession 标记会话在本实例有连接
+	ClaimSession(ctx context.Context, sessionID string) error
+	// ReleaseSession 会话在本实例的最后一个连接断开
+	ReleaseSession(ctx context.Context, sessionID string) error
+	// SessionNodes 返回会话当前连接所在的实例
+	SessionNodes(ctx context.Context, sessionID string) ([]string, error)
+	Close() error
+}
+
+// defaultHubNodeID 生成实例标识（主机名 + 随机后缀，避免同机多进程冲突）
+func defaultHubNodeID() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "node"
+	}
+	return fmt.Sprintf("%s-%s", host, uuid.NewString()[:8])
+}
+
+// MemoryBackplane 单实例默认实现：同步回调订阅者，订阅者（WebSocketHub.deliverLocal）须保证不阻塞
+type MemoryBackplane struct {
+	nodeID string
+
+	mu       sync.RWMutex
+	handler  func(WebSocketMessage)
+	sessions map[string]time.Time
+}
+
+// NewMemoryBackplane 创建进程内总线
+func NewMemoryBackplane(nodeID string) *MemoryBackplane {
+	if nodeID == "" {
+		nodeID = defaultHubNodeID()
+	}
+	return &MemoryBackplane{nodeID: nodeID, sessions: make(map[string]time.Time)}
+}
+
+func (b *MemoryBackplane) NodeID() string { return b.nodeID }
+
+func (b *MemoryBackplane) Publish(ctx context.Context, msg WebSocketMessage) error {
+	b.mu.RLock()
+	handler := b.handler
+	b.mu.RUnlock()
+	if handler == nil {
+		return fmt.Errorf("backplane has no subscriber")
+	}
+	handler(msg)
+	return nil
+}
+
+func (b *MemoryBackplane) Subscribe(handler func(WebSocketMessage)) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handler = handler
+	return nil
+}
+
+func (b *MemoryBackplane) ClaimSession(ctx context.Context, sessionID string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.sessions[sessionID] = time.Now()
+	return nil
+}
+
+func (b *MemoryBackplane) ReleaseSession(ctx context.Context, sessionID string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.sessions, sessionID)
+	return nil
+}
+
+func (b *MemoryBackplane) SessionNodes(ctx context.Context, sessionID string) ([]string, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if _, ok := b.sessions[sessionID]; ok {
+		return []string{b.nodeID}, nil
+	}
+	return nil, nil
+}
+
+func (b *MemoryBackplane) Close() error { return nil }
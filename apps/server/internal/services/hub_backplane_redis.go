@@ -0,0 +1,534 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultRedisBackplanePrefix      = "servify:ws:"
+	defaultRedisBackplanePresenceTTL = 90 * time.Second
+	defaultRedisBackplaneTimeout     = 5 * time.Second
+	// 连接错误时命令的最大重试次数（首次重试前等待 50ms，之后逐次翻倍）
+	redisBackplaneMaxRetries = 3
+	redisMaxBulkLength       = 512 << 20
+	redisMaxArrayLength      = 1 << 20
+)
+
+// RedisBackplaneConfig Redis 总线配置
+type RedisBackplaneConfig struct {
+	Addr        string // host:port
+	Password    string
+	DB          int
+	PoolSize    int
+	NodeID      string
+	Prefix      string        // 频道/键前缀，默认 servify:ws:
+	PresenceTTL time.Duration // 会话在线记录过期时间，实例宕机后自动清理
+	Timeout     time.Duration // 连接与命令超时
+}
+
+// RedisBackplane 基于 Redis pub/sub 的跨实例总线
+// 频道：<prefix>broadcast（全体实例）与 <prefix>node:<id>（定向到某实例）
+// 在线：<prefix>session:<sid> 为集合，成员是持有该会话连接的实例 ID
+type RedisBackplane struct {
+	cfg  RedisBackplaneConfig
+	pool chan *redisConn
+
+	mu      sync.Mutex
+	local   map[string]struct{}
+	subConn *redisConn
+
+	closed    chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// NewRedisBackplane 创建 Redis 总线并校验连通性
+func NewRedisBackplane(cfg RedisBackplaneConfig) (*RedisBackplane, error) {
+	if cfg.Addr == "" {
+		return nil, fmt.Errorf("redis backplane: addr required")
+	}
+	if cfg.NodeID == "" {
+		cfg.NodeID = defaultHubNodeID()
+	}
+	if cfg.Prefix == "" {
+		cfg.Prefix = defaultRedisBackplanePrefix
+	}
+	if cfg.PresenceTTL <= 0 {
+		cfg.PresenceTTL = defaultRedisBackplanePresenceTTL
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultRedisBackplaneTimeout
+	}
+	if cfg.PoolSize <= 0 {
+		cfg.PoolSize = 10
+	}
+
+	b := &RedisBackplane{
+		cfg:    cfg,
+		pool:   make(chan *redisConn, cfg.PoolSize),
+		local:  make(map[string]struct{}),
+		closed: make(chan struct{}),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+	defer cancel()
+	if _, err := b.do(ctx, "PING"); err != nil {
+		return nil, fmt.Errorf("redis backplane: %w", err)
+	}
+
+	b.wg.Add(1)
+	go b.heartbeat()
+	return b, nil
+}
+
+func (b *RedisBackplane) NodeID() string { return b.cfg.NodeID }
+
+func (b *RedisBackplane) broadcastChannel() string { return b.cfg.Prefix + "broadcast" }
+
+func (b *RedisBackplane) nodeChannel(node string) string { return b.cfg.Prefix + "node:" + node }
+
+func (b *RedisBackplane) presenceKey(sessionID string) string {
+	return b.cfg.Prefix + "session:" + sessionID
+}
+
+// Publish 会话消息定向投递到持有连接的实例；无在线记录时退化为广播
+func (b *RedisBackplane) Publish(ctx context.Context, msg WebSocketMessage) error {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("marshal hub message: %w", err)
+	}
+
+	var nodes []string
+	if msg.SessionID != "" {
+		if nodes, err = b.SessionNodes(ctx, msg.SessionID); err != nil {
+			return err
+		}
+	}
+	if len(nodes) == 0 {
+		_, err = b.do(ctx, "PUBLISH", b.broadcastChannel(), string(payload))
+		return err
+	}
+	for _, node := range nodes {
+		if _, err := b.do(ctx, "PUBLISH", b.nodeChannel(node), string(payload)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Subscribe 订阅广播频道与本实例频道，断线自动重连
+// 等待首次订阅确认；超时返回错误，但后台仍会继续重试
+func (b *RedisBackplane) Subscribe(handler func(WebSocketMessage)) error {
+	if handler == nil {
+		return fmt.Errorf("handler required")
+	}
+	ready := make(chan struct{})
+	var once sync.Once
+	b.wg.Add(1)
+	go b.subscribeLoop(handler, func() { once.Do(func() { close(ready) }) })
+
+	select {
+	case <-ready:
+		return nil
+	case <-time.After(b.cfg.Timeout):
+		return fmt.Errorf("redis backplane: subscribe timeout")
+	}
+}
+
+func (b *RedisBackplane) subscribeLoop(handler func(WebSocketMessage), onReady func()) {
+	defer b.wg.Done()
+	const initialBackoff = 100 * time.Millisecond
+	backoff := initialBackoff
+	reconnect := false
+	for {
+		select {
+		case <-b.closed:
+			return
+		default:
+		}
+
+		subscribed := false
+		err := b.subscribeOnce(handler, func() {
+			subscribed = true
+			onReady()
+			if reconnect {
+				// 断线期间 Redis 可能已重启，立即恢复本实例的在线记录
+				logrus.Info("Redis backplane subscription restored")
+				b.refreshAll()
+			}
+		})
+		select {
+		case <-b.closed:
+			return
+		default:
+		}
+		if subscribed {
+			reconnect = true
+			backoff = initialBackoff
+		}
+		logrus.Warnf("Redis backplane subscription lost: %v", err)
+		select {
+		case <-b.closed:
+			return
+		case <-time.After(backoff):
+		}
+		if backoff < 5*time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+func (b *RedisBackplane) subscribeOnce(handler func(WebSocketMessage), onReady func()) error {
+	ctx, cancel := context.WithTimeout(context.Background(), b.cfg.Timeout)
+	conn, err := b.dial(ctx)
+	cancel()
+	if err != nil {
+		return err
+	}
+	defer conn.close()
+
+	b.mu.Lock()
+	select {
+	case <-b.closed:
+		b.mu.Unlock()
+		return net.ErrClosed
+	default:
+	}
+	b.subConn = conn
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		b.subConn = nil
+		b.mu.Unlock()
+	}()
+
+	// 订阅期间不设读超时，由 Close 关闭连接解除阻塞
+	_ = conn.conn.SetDeadline(time.Now().Add(b.cfg.Timeout))
+	if err := conn.write("SUBSCRIBE", b.broadcastChannel(), b.nodeChannel(b.cfg.NodeID)); err != nil {
+		return err
+	}
+	_ = conn.conn.SetDeadline(time.Time{})
+
+	for {
+		reply, err := conn.readReply()
+		if err != nil {
+			return err
+		}
+		parts, ok := reply.([]interface{})
+		if !ok || len(parts) != 3 {
+			continue
+		}
+		switch kind, _ := parts[0].(string); kind {
+		case "subscribe":
+			if n, _ := parts[2].(int64); n == 2 {
+				onReady()
+			}
+			continue
+		case "message":
+		default:
+			continue
+		}
+		payload, _ := parts[2].(string)
+		var msg WebSocketMessage
+		if err := json.Unmarshal([]byte(payload), &msg); err != nil {
+			logrus.Warnf("Redis backplane: invalid message: %v", err)
+			continue
+		}
+		handler(msg)
+	}
+}
+
+func (b *RedisBackplane) ClaimSession(ctx context.Context, sessionID string) error {
+	b.mu.Lock()
+	b.local[sessionID] = struct{}{}
+	b.mu.Unlock()
+	return b.refreshPresence(ctx, sessionID)
+}
+
+func (b *RedisBackplane) ReleaseSession(ctx context.Context, sessionID string) error {
+	b.mu.Lock()
+	delete(b.local, sessionID)
+	b.mu.Unlock()
+	_, err := b.do(ctx, "SREM", b.presenceKey(sessionID), b.cfg.NodeID)
+	return err
+}
+
+func (b *RedisBackplane) SessionNodes(ctx context.Context, sessionID string) ([]string, error) {
+	reply, err := b.do(ctx, "SMEMBERS", b.presenceKey(sessionID))
+	if err != nil {
+		return nil, err
+	}
+	items, _ := reply.([]interface{})
+	nodes := make([]string, 0, len(items))
+	for _, item := range items {
+		if s, ok := item.(string); ok && s != "" {
+			nodes = append(nodes, s)
+		}
+	}
+	return nodes, nil
+}
+
+func (b *RedisBackplane) refreshPresence(ctx context.Context, sessionID string) error {
+	key := b.presenceKey(sessionID)
+	if _, err := b.do(ctx, "SADD", key, b.cfg.NodeID); err != nil {
+		return err
+	}
+	_, err := b.do(ctx, "EXPIRE", key, strconv.Itoa(int(b.cfg.PresenceTTL/time.Second)))
+	return err
+}
+
+// heartbeat 定期续期本实例持有的会话在线记录
+func (b *RedisBackplane) heartbeat() {
+	defer b.wg.Done()
+	ticker := time.NewTicker(b.cfg.PresenceTTL / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.closed:
+			return
+		case <-ticker.C:
+		}
+		b.refreshAll()
+	}
+}
+
+// refreshAll 续期本实例持有的全部会话在线记录
+func (b *RedisBackplane) refreshAll() {
+	b.mu.Lock()
+	sessions := make([]string, 0, len(b.local))
+	for sid := range b.local {
+		sessions = append(sessions, sid)
+	}
+	b.mu.Unlock()
+	for _, sid := range sessions {
+		ctx, cancel := context.WithTimeout(context.Background(), b.cfg.Timeout)
+		if err := b.refreshPresence(ctx, sid); err != nil {
+			logrus.Warnf("Redis backplane: refresh presence for %s failed: %v", sid, err)
+		}
+		cancel()
+	}
+}
+
+// Close 释放本实例的在线记录并关闭连接
+func (b *RedisBackplane) Close() error {
+	b.closeOnce.Do(func() {
+		b.mu.Lock()
+		sessions := make([]string, 0, len(b.local))
+		for sid := range b.local {
+			sessions = append(sessions, sid)
+		}
+		b.mu.Unlock()
+		for _, sid := range sessions {
+			ctx, cancel := context.WithTimeout(context.Background(), b.cfg.Timeout)
+			_ = b.ReleaseSession(ctx, sid)
+			cancel()
+		}
+
+		close(b.closed)
+		b.mu.Lock()
+		if b.subConn != nil {
+			b.subConn.close()
+		}
+		b.mu.Unlock()
+		b.wg.Wait()
+
+		for {
+			select {
+			case c := <-b.pool:
+				c.close()
+			default:
+				return
+			}
+		}
+	})
+	return nil
+}
+
+// do 执行命令；连接错误（如 Redis 重启后池中的失效连接）时丢弃连接并退避重试，命令错误直接返回。
+// 除 PUBLISH 外的命令均幂等；PUBLISH 在回复丢失时重试可能重复投递，客户端按 seq 去重
+func (b *RedisBackplane) do(ctx context.Context, args ...string) (interface{}, error) {
+	backoff := 50 * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		reply, err := b.doOnce(ctx, args...)
+		var redisErr redisError
+		if err == nil || errors.As(err, &redisErr) || attempt == redisBackplaneMaxRetries {
+			return reply, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-b.closed:
+			return nil, err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// doOnce 从连接池取连接执行一次命令；网络或协议错误时丢弃该连接
+func (b *RedisBackplane) doOnce(ctx context.Context, args ...string) (interface{}, error) {
+	var conn *redisConn
+	select {
+	case conn = <-b.pool:
+	default:
+		c, err := b.dial(ctx)
+		if err != nil {
+			return nil, err
+		}
+		conn = c
+	}
+
+	deadline := time.Now().Add(b.cfg.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = conn.conn.SetDeadline(deadline)
+
+	reply, err := conn.do(args...)
+	var redisErr redisError
+	if err != nil && !errors.As(err, &redisErr) {
+		conn.close()
+		return nil, err
+	}
+	select {
+	case b.pool <- conn:
+	default:
+		conn.close()
+	}
+	return reply, err
+}
+
+func (b *RedisBackplane) dial(ctx context.Context) (*redisConn, error) {
+	d := net.Dialer{Timeout: b.cfg.Timeout}
+	nc, err := d.DialContext(ctx, "tcp", b.cfg.Addr)
+	if err != nil {
+		return nil, err
+	}
+	conn := &redisConn{conn: nc, rd: bufio.NewReader(nc)}
+	_ = nc.SetDeadline(time.Now().Add(b.cfg.Timeout))
+	if b.cfg.Password != "" {
+		if _, err := conn.do("AUTH", b.cfg.Password); err != nil {
+			conn.close()
+			return nil, err
+		}
+	}
+	if b.cfg.DB != 0 {
+		if _, err := conn.do("SELECT", strconv.Itoa(b.cfg.DB)); err != nil {
+			conn.close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// redisError Redis 返回的命令错误（连接仍可用）
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// redisConn 最小 RESP 客户端连接，仅覆盖总线所需命令
+type redisConn struct {
+	conn net.Conn
+	rd   *bufio.Reader
+}
+
+func (c *redisConn) close() { _ = c.conn.Close() }
+
+func (c *redisConn) do(args ...string) (interface{}, error) {
+	if err := c.write(args...); err != nil {
+		return nil, err
+	}
+	return c.readReply()
+}
+
+func (c *redisConn) write(args ...string) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&buf, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	_, err := c.conn.Write(buf.Bytes())
+	return err
+}
+
+// readReply 读取一条完整回复；顶层错误回复以 redisError 返回
+func (c *redisConn) readReply() (interface{}, error) {
+	v, err := c.readValue()
+	if err != nil {
+		return nil, err
+	}
+	if e, ok := v.(redisError); ok {
+		return nil, e
+	}
+	return v, nil
+}
+
+// readValue 读取一个 RESP 值。数组中的错误元素作为 redisError 值保留并继续读完，避免连接失步
+func (c *redisConn) readValue() (interface{}, error) {
+	line, err := c.rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+	if line == "" {
+		return nil, fmt.Errorf("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return redisError(line[1:]), nil
+	case ':':
+		n, err := strconv.ParseInt(line[1:], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid integer %q", line)
+		}
+		return n, nil
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n > redisMaxBulkLength {
+			return nil, fmt.Errorf("redis: invalid bulk length %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.rd, buf); err != nil {
+			return nil, err
+		}
+		if buf[n] != '\r' || buf[n+1] != '\n' {
+			return nil, fmt.Errorf("redis: bulk string not terminated by CRLF")
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n > redisMaxArrayLength {
+			return nil, fmt.Errorf("redis: invalid array length %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = c.readValue(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply %q", line)
+	}
+}
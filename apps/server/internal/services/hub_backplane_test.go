@@ -0,0 +1,416 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis 本地 Redis 替身：支持总线用到的 pub/sub 与集合命令
+type fakeRedis struct {
+	ln       net.Listener
+	password string
+
+	mu        sync.Mutex
+	sets      map[string]map[string]bool
+	subs      map[string][]*fakeRedisConn
+	published [][2]string // 发布记录（频道, 消息体），按顺序
+	conns     map[net.Conn]bool
+	accepted  int
+}
+
+type fakeRedisConn struct {
+	conn net.Conn
+	wmu  sync.Mutex
+}
+
+func (c *fakeRedisConn) writef(format string, args ...interface{}) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	fmt.Fprintf(c.conn, format, args...)
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	f := &fakeRedis{ln: ln, password: password, sets: map[string]map[string]bool{}, subs: map[string][]*fakeRedisConn{}, conns: map[net.Conn]bool{}}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			f.mu.Lock()
+			f.conns[conn] = true
+			f.accepted++
+			f.mu.Unlock()
+			go f.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return f
+}
+
+func (f *fakeRedis) serve(nc net.Conn) {
+	defer nc.Close()
+	rc := &redisConn{conn: nc, rd: bufio.NewReader(nc)}
+	c := &fakeRedisConn{conn: nc}
+	authed := f.password == ""
+	for {
+		reply, err := rc.readReply()
+		if err != nil {
+			return
+		}
+		items, _ := reply.([]interface{})
+		args := make([]string, len(items))
+		for i, it := range items {
+			args[i], _ = it.(string)
+		}
+		if len(args) == 0 {
+			continue
+		}
+		if !authed && args[0] != "AUTH" {
+			c.writef("-NOAUTH Authentication required.\r\n")
+			continue
+		}
+
+		f.mu.Lock()
+		switch args[0] {
+		case "AUTH":
+			if args[1] == f.password {
+				authed = true
+				c.writef("+OK\r\n")
+			} else {
+				c.writef("-WRONGPASS invalid password\r\n")
+			}
+		case "PING":
+			c.writef("+PONG\r\n")
+		case "SELECT":
+			c.writef("+OK\r\n")
+		case "EXPIRE":
+			c.writef(":1\r\n")
+		case "SADD":
+			if f.sets[args[1]] == nil {
+				f.sets[args[1]] = map[string]bool{}
+			}
+			f.sets[args[1]][args[2]] = true
+			c.writef(":1\r\n")
+		case "SREM":
+			delete(f.sets[args[1]], args[2])
+			c.writef(":1\r\n")
+		case "SMEMBERS":
+			members := make([]string, 0)
+			for m := range f.sets[args[1]] {
+				members = append(members, m)
+			}
+			sort.Strings(members)
+			out := fmt.Sprintf("*%d\r\n", len(members))
+			for _, m := range members {
+				out += fmt.Sprintf("$%d\r\n%s\r\n", len(m), m)
+			}
+			c.writef("%s", out)
+		case "SUBSCRIBE":
+			for i, ch := range args[1:] {
+				f.subs[ch] = append(f.subs[ch], c)
+				c.writef("*3\r\n$9\r\nsubscribe\r\n$%d\r\n%s\r\n:%d\r\n", len(ch), ch, i+1)
+			}
+		case "PUBLISH":
+			ch, payload := args[1], args[2]
+			f.published = append(f.published, [2]string{ch, payload})
+			for _, sub := range f.subs[ch] {
+				sub.writef("*3\r\n$7\r\nmessage\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n", len(ch), ch, len(payload), payload)
+			}
+			c.writef(":%d\r\n", len(f.subs[ch]))
+		default:
+			c.writef("-ERR unknown command\r\n")
+		}
+		f.mu.Unlock()
+	}
+}
+
+// restart 模拟 Redis 重启：断开所有连接并清空数据
+func (f *fakeRedis) restart() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for c := range f.conns {
+		c.Close()
+	}
+	f.conns = map[net.Conn]bool{}
+	f.sets = map[string]map[string]bool{}
+	f.subs = map[string][]*fakeRedisConn{}
+}
+
+func (f *fakeRedis) acceptedConns() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.accepted
+}
+
+// publishedChannel 最近一次发布某类型消息所用的频道
+func (f *fakeRedis) publishedChannel(msgType string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := len(f.published) - 1; i >= 0; i-- {
+		var msg WebSocketMessage
+		if json.Unmarshal([]byte(f.published[i][1]), &msg) == nil && msg.Type == msgType {
+			return f.published[i][0]
+		}
+	}
+	return ""
+}
+
+func newTestHubWithRedis(t *testing.T, addr, node string) *WebSocketHub {
+	t.Helper()
+	bp, err := NewRedisBackplane(RedisBackplaneConfig{Addr: addr, Password: "pw", NodeID: node, Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("new backplane: %v", err)
+	}
+	t.Cleanup(func() { bp.Close() })
+	hub := NewWebSocketHub()
+	if err := hub.SetBackplane(bp); err != nil {
+		t.Fatalf("set backplane: %v", err)
+	}
+	go hub.Run()
+	return hub
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("condition not met in time")
+}
+
+func TestRedisBackplane_FanOutAcrossHubs(t *testing.T) {
+	redis := newFakeRedis(t, "pw")
+	addr := redis.ln.Addr().String()
+	hubA := newTestHubWithRedis(t, addr, "node-a")
+	hubB := newTestHubWithRedis(t, addr, "node-b")
+	ctx := context.Background()
+
+	// 客户连接在 B 实例
+	client := &WebSocketClient{ID: "c1", SessionID: "s1", Send: make(chan WebSocketMessage, 4), Hub: hubB}
+	hubB.register <- client
+	waitFor(t, func() bool {
+		nodes, _ := hubA.SessionNodes(ctx, "s1")
+		return len(nodes) == 1 && nodes[0] == "node-b"
+	})
+
+	// 从 A 实例推送，定向投递到 B（B 异步发布的在线状态事件也经过总线，按消息类型区分）
+	hubA.SendToSession("s1", WebSocketMessage{Type: "ai-response", Data: map[string]interface{}{"content": "hi"}})
+	if got := redis.publishedChannel("ai-response"); got != "servify:ws:node:node-b" {
+		t.Fatalf("expected targeted publish, got %q", got)
+	}
+	for received := false; !received; {
+		select {
+		case msg := <-client.Send:
+			received = msg.Type == "ai-response" && msg.SessionID == "s1"
+		case <-time.After(2 * time.Second):
+			t.Fatal("message did not cross instances")
+		}
+	}
+
+	// 无在线记录的会话退化为广播
+	hubA.SendToSession("unknown", WebSocketMessage{Type: "ping"})
+	if got := redis.publishedChannel("ping"); got != "servify:ws:broadcast" {
+		t.Fatalf("expected broadcast publish, got %q", got)
+	}
+
+	// 断开后释放在线记录
+	hubB.unregister <- client
+	waitFor(t, func() bool {
+		nodes, _ := hubA.SessionNodes(ctx, "s1")
+		return len(nodes) == 0
+	})
+}
+
+func TestRedisBackplane_AuthFailure(t *testing.T) {
+	redis := newFakeRedis(t, "pw")
+	if _, err := NewRedisBackplane(RedisBackplaneConfig{Addr: redis.ln.Addr().String(), Password: "wrong", Timeout: time.Second}); err == nil {
+		t.Fatal("expected auth error")
+	}
+}
+
+// failingBackplane Publish 总是失败的总线
+type failingBackplane struct{ *MemoryBackplane }
+
+func (failingBackplane) Publish(context.Context, WebSocketMessage) error {
+	return errors.New("backplane down")
+}
+
+func TestWebSocketHub_PublishFallsBackToLocal(t *testing.T) {
+	hub := NewWebSocketHub()
+	if err := hub.SetBackplane(failingBackplane{NewMemoryBackplane("n1")}); err != nil {
+		t.Fatalf("set backplane: %v", err)
+	}
+	go hub.Run()
+
+	client := &WebSocketClient{ID: "c1", SessionID: "s1", Send: make(chan WebSocketMessage, 1), Hub: hub}
+	hub.register <- client
+	hub.SendToSession("s1", WebSocketMessage{Type: "ai-response"})
+	select {
+	case <-client.Send:
+	case <-time.After(time.Second):
+		t.Fatal("expected local delivery when backplane is down")
+	}
+	if hub.NodeID() != "n1" {
+		t.Fatalf("unexpected node id: %s", hub.NodeID())
+	}
+}
+
+func TestRedisBackplane_ReconnectsAfterRestart(t *testing.T) {
+	redis := newFakeRedis(t, "pw")
+	addr := redis.ln.Addr().String()
+	hubA := newTestHubWithRedis(t, addr, "node-a")
+	hubB := newTestHubWithRedis(t, addr, "node-b")
+	ctx := context.Background()
+
+	client := &WebSocketClient{ID: "c1", SessionID: "s1", Send: make(chan WebSocketMessage, 4), Hub: hubB}
+	hubB.register <- client
+	waitFor(t, func() bool {
+		nodes, _ := hubA.SessionNodes(ctx, "s1")
+		return len(nodes) == 1
+	})
+
+	// 重启后：池中失效连接重试重连，订阅自动恢复并重新登记在线记录
+	redis.restart()
+	waitFor(t, func() bool {
+		nodes, err := hubA.SessionNodes(ctx, "s1")
+		return err == nil && len(nodes) == 1 && nodes[0] == "node-b"
+	})
+	hubA.SendToSession("s1", WebSocketMessage{Type: "ai-response"})
+	select {
+	case msg := <-client.Send:
+		if msg.Type != "ai-response" {
+			t.Fatalf("unexpected message: %+v", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("message did not cross instances after restart")
+	}
+}
+
+func TestRedisBackplane_CommandErrorKeepsConnection(t *testing.T) {
+	redis := newFakeRedis(t, "")
+	bp, err := NewRedisBackplane(RedisBackplaneConfig{Addr: redis.ln.Addr().String(), NodeID: "n1", Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("new backplane: %v", err)
+	}
+	defer bp.Close()
+	ctx := context.Background()
+
+	var redisErr redisError
+	if _, err := bp.do(ctx, "BOGUS"); !errors.As(err, &redisErr) {
+		t.Fatalf("expected command error, got %v", err)
+	}
+	if reply, err := bp.do(ctx, "PING"); err != nil || reply != "PONG" {
+		t.Fatalf("ping after error: %v %v", reply, err)
+	}
+	if n := redis.acceptedConns(); n != 1 {
+		t.Fatalf("command error should not drop the connection, dialed %d times", n)
+	}
+}
+
+func TestRedisConn_ReadReply_PartialAndErrorReplies(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	rc := &redisConn{conn: client, rd: bufio.NewReader(client)}
+
+	go func() {
+		defer server.Close()
+		// 回复被拆成多段写出
+		for _, chunk := range []string{"$5\r\nhe", "l", "lo\r", "\n"} {
+			_, _ = server.Write([]byte(chunk))
+		}
+		// 数组中的错误元素不应中断读取
+		_, _ = server.Write([]byte("*3\r\n:1\r\n-ERR inner\r\n$1\r\nx\r\n"))
+		_, _ = server.Write([]byte("-WRONGTYPE bad key\r\n"))
+		_, _ = server.Write([]byte("+OK\r\n"))
+		_, _ = server.Write([]byte("$3\r\nabcXY"))
+	}()
+
+	if v, err := rc.readReply(); err != nil || v != "hello" {
+		t.Fatalf("partial bulk: %v %v", v, err)
+	}
+	v, err := rc.readReply()
+	items, _ := v.([]interface{})
+	if err != nil || len(items) != 3 || items[0] != int64(1) || items[2] != "x" {
+		t.Fatalf("array with error: %#v %v", v, err)
+	}
+	if e, ok := items[1].(redisError); !ok || string(e) != "ERR inner" {
+		t.Fatalf("nested error = %#v", items[1])
+	}
+	var redisErr redisError
+	if _, err := rc.readReply(); !errors.As(err, &redisErr) {
+		t.Fatalf("expected error reply, got %v", err)
+	}
+	// 错误回复之后连接仍然同步
+	if v, err := rc.readReply(); err != nil || v != "OK" {
+		t.Fatalf("reply after error: %v %v", v, err)
+	}
+	if _, err := rc.readReply(); err == nil || errors.As(err, &redisErr) {
+		t.Fatalf("expected protocol error for bad terminator, got %v", err)
+	}
+
+	// 连接在回复中途断开
+	server2, client2 := net.Pipe()
+	defer client2.Close()
+	go func() {
+		_, _ = server2.Write([]byte("*2\r\n$3\r\nfoo\r\n$5\r\nba"))
+		server2.Close()
+	}()
+	rc2 := &redisConn{conn: client2, rd: bufio.NewReader(client2)}
+	if _, err := rc2.readReply(); err == nil {
+		t.Fatal("expected error for truncated reply")
+	}
+}
+
+func TestWebSocketHub_DeliverLocalDoesNotBlock(t *testing.T) {
+	hub := NewWebSocketHub()
+	total := hubBroadcastBuffer + 50
+
+	// Run 未启动时发布也不阻塞
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < total; i++ {
+			hub.SendToSession("s1", WebSocketMessage{Type: "ai-response", Data: i})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("publish blocked without Run")
+	}
+
+	// 启动后积压的消息按序投递
+	client := &WebSocketClient{ID: "c1", SessionID: "s1", Send: make(chan WebSocketMessage, total), Hub: hub}
+	hub.mutex.Lock()
+	hub.clients[client.ID] = client
+	hub.mutex.Unlock()
+	go hub.Run()
+	for i := 0; i < total; i++ {
+		select {
+		case msg := <-client.Send:
+			if msg.Data != i {
+				t.Fatalf("message %d out of order: %v", i, msg.Data)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("message %d not delivered", i)
+		}
+	}
+}
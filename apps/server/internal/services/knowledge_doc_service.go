@@ -8,17 +8,34 @@ import (
 
 	"servify/apps/server/internal/models"
 
+	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 )
 
 type KnowledgeDocService struct {
 	db *gorm.DB
+	// 可选：文档增删改后同步更新检索索引
+	indexer KnowledgeIndexer
 }
 
 func NewKnowledgeDocService(db *gorm.DB) *KnowledgeDocService {
 	return &KnowledgeDocService{db: db}
 }
 
+// SetIndexer 注入检索索引（可选）；索引失败只记录日志，不影响文档保存，启动时的同步会补齐
+func (s *KnowledgeDocService) SetIndexer(indexer KnowledgeIndexer) {
+	s.indexer = indexer
+}
+
+func (s *KnowledgeDocService) reindex(ctx context.Context, doc *models.KnowledgeDoc) {
+	if s.indexer == nil {
+		return
+	}
+	if err := s.indexer.IndexDoc(ctx, doc); err != nil {
+		logrus.Warnf("Failed to index knowledge doc %d: %v", doc.ID, err)
+	}
+}
+
 type KnowledgeDocCreateRequest struct {
 	Title    string   `json:"title" binding:"required"`
 	Content  string   `json:"content" binding:"required"`
@@ -65,6 +82,7 @@ func (s *KnowledgeDocService) Create(ctx context.Context, req *KnowledgeDocCreat
 	if err := s.db.WithContext(ctx).Create(doc).Error; err != nil {
 		return nil, err
 	}
+	s.reindex(ctx, doc)
 	return doc, nil
 }
 
@@ -147,6 +165,7 @@ func (s *KnowledgeDocService) Update(ctx context.Context, id uint, req *Knowledg
 	if err := s.db.WithContext(ctx).Save(&doc).Error; err != nil {
 		return nil, err
 	}
+	s.reindex(ctx, &doc)
 	return &doc, nil
 }
 
@@ -158,6 +177,11 @@ func (s *KnowledgeDocService) Delete(ctx context.Context, id uint) error {
 	if result.RowsAffected == 0 {
 		return gorm.ErrRecordNotFound
 	}
+	if s.indexer != nil {
+		if err := s.indexer.RemoveDoc(ctx, id); err != nil {
+			logrus.Warnf("Failed to remove knowledge doc %d from index: %v", id, err)
+		}
+	}
 	return nil
 }
 
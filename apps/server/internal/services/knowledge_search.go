@@ -0,0 +1,374 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"servify/apps/server/internal/models"
+)
+
+// KnowledgeSearchConfig 切块与召回参数
+type KnowledgeSearchConfig struct {
+	ChunkSize    int     // 每块最多字符数，默认 500
+	ChunkOverlap int     // 相邻块重叠字符数，默认 50
+	MinScore     float64 // 向量相似度下限，默认 0.1
+}
+
+// KnowledgeHit 检索命中的切块
+type KnowledgeHit struct {
+	DocID    uint    `json:"doc_id"`
+	ChunkID  uint    `json:"chunk_id"`
+	Title    string  `json:"title"`
+	Category string  `json:"category"`
+	Content  string  `json:"content"`
+	Score    float64 `json:"score"`
+	Method   string  `json:"method"` // vector, bm25
+}
+
+// KnowledgeIndexer 知识库文档变更时更新检索索引
+type KnowledgeIndexer interface {
+	IndexDoc(ctx context.Context, doc *models.KnowledgeDoc) error
+	RemoveDoc(ctx context.Context, docID uint) error
+}
+
+// KnowledgeSearchService 基于 knowledge_docs 的本地语义检索：文档切块后向量化存入 knowledge_chunks，
+// PostgreSQL 有 pgvector 时在库内排序，否则在进程内计算余弦相似度；查询向量化失败时降级为 BM25
+type KnowledgeSearchService struct {
+	db       *gorm.DB
+	embedder Embedder
+	cfg      KnowledgeSearchConfig
+	pgvector bool
+	logger   *logrus.Logger
+}
+
+var _ KnowledgeIndexer = (*KnowledgeSearchService)(nil)
+
+// NewKnowledgeSearchService 创建检索服务；需在 knowledge_chunks 迁移之后调用（会尝试启用 pgvector）
+func NewKnowledgeSearchService(db *gorm.DB, embedder Embedder, cfg KnowledgeSearchConfig, logger *logrus.Logger) *KnowledgeSearchService {
+	if logger == nil {
+		logger = logrus.New()
+	}
+	if cfg.ChunkSize <= 0 {
+		cfg.ChunkSize = 500
+	}
+	if cfg.ChunkOverlap < 0 || cfg.ChunkOverlap >= cfg.ChunkSize {
+		cfg.ChunkOverlap = 0
+	} else if cfg.ChunkOverlap == 0 {
+		cfg.ChunkOverlap = min(50, cfg.ChunkSize/4)
+	}
+	if cfg.MinScore <= 0 {
+		cfg.MinScore = 0.1
+	}
+	s := &KnowledgeSearchService{db: db, embedder: embedder, cfg: cfg, logger: logger}
+	s.setupVectorColumn()
+	return s
+}
+
+// setupVectorColumn PostgreSQL 上尝试启用 pgvector 并添加向量列；不可用时使用普通表
+func (s *KnowledgeSearchService) setupVectorColumn() {
+	if s.db.Dialector.Name() != "postgres" {
+		return
+	}
+	if err := s.db.Exec("CREATE EXTENSION IF NOT EXISTS vector").Error; err != nil {
+		s.logger.Infof("pgvector unavailable, knowledge search uses in-process similarity: %v", err)
+		return
+	}
+	if err := s.db.Exec("ALTER TABLE knowledge_chunks ADD COLUMN IF NOT EXISTS embedding_vec vector").Error; err != nil {
+		s.logger.Warnf("Failed to add knowledge_chunks.embedding_vec: %v", err)
+		return
+	}
+	s.pgvector = true
+}
+
+// IndexDoc 重建单个文档的切块与向量；向量化失败时保留原索引
+func (s *KnowledgeSearchService) IndexDoc(ctx context.Context, doc *models.KnowledgeDoc) error {
+	parts := chunkText(doc.Content, s.cfg.ChunkSize, s.cfg.ChunkOverlap)
+	inputs := make([]string, len(parts))
+	for i, p := range parts {
+		// 标题参与向量化，便于按主题召回
+		inputs[i] = doc.Title + "\n" + p
+	}
+	var vecs [][]float32
+	if len(inputs) > 0 {
+		var err error
+		if vecs, err = s.embedder.Embed(ctx, inputs); err != nil {
+			return fmt.Errorf("failed to embed knowledge doc %d: %w", doc.ID, err)
+		}
+	}
+	model := s.embedder.Model()
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("doc_id = ?", doc.ID).Delete(&models.KnowledgeChunk{}).Error; err != nil {
+			return fmt.Errorf("failed to clear chunks: %w", err)
+		}
+		if len(parts) == 0 {
+			return nil
+		}
+		chunks := make([]models.KnowledgeChunk, len(parts))
+		for i, p := range parts {
+			data, _ := json.Marshal(vecs[i])
+			chunks[i] = models.KnowledgeChunk{DocID: doc.ID, Ordinal: i, Content: p, Embedding: string(data), Model: model}
+		}
+		if err := tx.Create(&chunks).Error; err != nil {
+			return fmt.Errorf("failed to save chunks: %w", err)
+		}
+		if s.pgvector {
+			// JSON 数组与 pgvector 的文本格式一致
+			if err := tx.Exec("UPDATE knowledge_chunks SET embedding_vec = embedding::vector WHERE doc_id = ?", doc.ID).Error; err != nil {
+				return fmt.Errorf("failed to store vectors: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// RemoveDoc 删除文档的索引
+func (s *KnowledgeSearchService) RemoveDoc(ctx context.Context, docID uint) error {
+	if err := s.db.WithContext(ctx).Where("doc_id = ?", docID).Delete(&models.KnowledgeChunk{}).Error; err != nil {
+		return fmt.Errorf("failed to remove chunks of doc %d: %w", docID, err)
+	}
+	return nil
+}
+
+// Sync 为缺少索引、索引早于文档更新或向量模型已变更的文档建立索引，并清理已删除文档的切块；
+// force 时重建全部文档。返回重建的文档数
+func (s *KnowledgeSearchService) Sync(ctx context.Context, force bool) (int, error) {
+	db := s.db.WithContext(ctx)
+	if err := db.Where("doc_id NOT IN (?)", db.Model(&models.KnowledgeDoc{}).Select("id")).Delete(&models.KnowledgeChunk{}).Error; err != nil {
+		return 0, fmt.Errorf("failed to clean orphan chunks: %w", err)
+	}
+	q := db.Model(&models.KnowledgeDoc{})
+	if !force {
+		q = q.Where("NOT EXISTS (SELECT 1 FROM knowledge_chunks c WHERE c.doc_id = knowledge_docs.id AND c.model = ? AND c.created_at >= knowledge_docs.updated_at)", s.embedder.Model())
+	}
+	var docs []models.KnowledgeDoc
+	if err := q.Find(&docs).Error; err != nil {
+		return 0, fmt.Errorf("failed to load knowledge docs: %w", err)
+	}
+	indexed := 0
+	for i := range docs {
+		if err := s.IndexDoc(ctx, &docs[i]); err != nil {
+			return indexed, err
+		}
+		indexed++
+	}
+	return indexed, nil
+}
+
+// Search 语义检索，按相似度降序返回至多 limit 个切块
+func (s *KnowledgeSearchService) Search(ctx context.Context, query string, limit int) ([]KnowledgeHit, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, nil
+	}
+	if limit <= 0 {
+		limit = 3
+	}
+	vecs, err := s.embedder.Embed(ctx, []string{query})
+	if err != nil || len(vecs) == 0 {
+		s.logger.Warnf("Query embedding failed, falling back to BM25: %v", err)
+		return s.searchBM25(ctx, query, limit)
+	}
+	var hits []KnowledgeHit
+	if s.pgvector {
+		hits, err = s.searchPGVector(ctx, vecs[0], limit)
+	} else {
+		hits, err = s.searchInProcess(ctx, vecs[0], limit)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.withDocs(ctx, hits)
+}
+
+func (s *KnowledgeSearchService) searchPGVector(ctx context.Context, vec []float32, limit int) ([]KnowledgeHit, error) {
+	data, _ := json.Marshal(vec)
+	var rows []struct {
+		ID      uint
+		DocID   uint
+		Content string
+		Score   float64
+	}
+	err := s.db.WithContext(ctx).Raw(
+		`SELECT id, doc_id, content, 1 - (embedding_vec <=> ?::vector) AS score FROM knowledge_chunks
+		 WHERE model = ? AND embedding_vec IS NOT NULL ORDER BY embedding_vec <=> ?::vector LIMIT ?`,
+		string(data), s.embedder.Model(), string(data), limit).Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("vector search failed: %w", err)
+	}
+	var hits []KnowledgeHit
+	for _, r := range rows {
+		if r.Score >= s.cfg.MinScore {
+			hits = append(hits, KnowledgeHit{DocID: r.DocID, ChunkID: r.ID, Content: r.Content, Score: r.Score, Method: "vector"})
+		}
+	}
+	return hits, nil
+}
+
+func (s *KnowledgeSearchService) searchInProcess(ctx context.Context, vec []float32, limit int) ([]KnowledgeHit, error) {
+	var chunks []models.KnowledgeChunk
+	if err := s.db.WithContext(ctx).Where("model = ?", s.embedder.Model()).Find(&chunks).Error; err != nil {
+		return nil, fmt.Errorf("failed to load chunks: %w", err)
+	}
+	var hits []KnowledgeHit
+	for _, c := range chunks {
+		var v []float32
+		if json.Unmarshal([]byte(c.Embedding), &v) != nil {
+			continue
+		}
+		if score := cosineSimilarity(vec, v); score >= s.cfg.MinScore {
+			hits = append(hits, KnowledgeHit{DocID: c.DocID, ChunkID: c.ID, Content: c.Content, Score: score, Method: "vector"})
+		}
+	}
+	return topHits(hits, limit), nil
+}
+
+// searchBM25 词项检索（k1=1.2, b=0.75），不依赖向量
+func (s *KnowledgeSearchService) searchBM25(ctx context.Context, query string, limit int) ([]KnowledgeHit, error) {
+	var chunks []models.KnowledgeChunk
+	if err := s.db.WithContext(ctx).Select("id", "doc_id", "content").Find(&chunks).Error; err != nil {
+		return nil, fmt.Errorf("failed to load chunks: %w", err)
+	}
+	if len(chunks) == 0 {
+		return nil, nil
+	}
+	const k1, b = 1.2, 0.75
+	terms := make(map[string]bool)
+	for _, t := range searchTokens(query) {
+		terms[t] = true
+	}
+	tfs := make([]map[string]int, len(chunks))
+	lengths := make([]int, len(chunks))
+	df := make(map[string]int)
+	total := 0
+	for i, c := range chunks {
+		tf := make(map[string]int)
+		toks := searchTokens(c.Content)
+		for _, t := range toks {
+			if terms[t] {
+				tf[t]++
+			}
+		}
+		for t := range tf {
+			df[t]++
+		}
+		tfs[i], lengths[i] = tf, len(toks)
+		total += len(toks)
+	}
+	avgLen := float64(total) / float64(len(chunks))
+	n := float64(len(chunks))
+	var hits []KnowledgeHit
+	for i, c := range chunks {
+		score := 0.0
+		for t, f := range tfs[i] {
+			idf := math.Log(1 + (n-float64(df[t])+0.5)/(float64(df[t])+0.5))
+			tf := float64(f)
+			score += idf * tf * (k1 + 1) / (tf + k1*(1-b+b*float64(lengths[i])/avgLen))
+		}
+		if score > 0 {
+			hits = append(hits, KnowledgeHit{DocID: c.DocID, ChunkID: c.ID, Content: c.Content, Score: score, Method: "bm25"})
+		}
+	}
+	return s.withDocs(ctx, topHits(hits, limit))
+}
+
+func topHits(hits []KnowledgeHit, limit int) []KnowledgeHit {
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].Score > hits[j].Score })
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits
+}
+
+// withDocs 补充文档标题与分类
+func (s *KnowledgeSearchService) withDocs(ctx context.Context, hits []KnowledgeHit) ([]KnowledgeHit, error) {
+	if len(hits) == 0 {
+		return hits, nil
+	}
+	ids := make([]uint, 0, len(hits))
+	for _, h := range hits {
+		ids = append(ids, h.DocID)
+	}
+	var docs []models.KnowledgeDoc
+	if err := s.db.WithContext(ctx).Select("id", "title", "category").Where("id IN ?", ids).Find(&docs).Error; err != nil {
+		return nil, fmt.Errorf("failed to load knowledge docs: %w", err)
+	}
+	byID := make(map[uint]models.KnowledgeDoc, len(docs))
+	for _, d := range docs {
+		byID[d.ID] = d
+	}
+	for i := range hits {
+		d := byID[hits[i].DocID]
+		hits[i].Title, hits[i].Category = d.Title, d.Category
+	}
+	return hits, nil
+}
+
+// Status 索引状态
+func (s *KnowledgeSearchService) Status(ctx context.Context) map[string]interface{} {
+	var chunks, docs int64
+	s.db.WithContext(ctx).Model(&models.KnowledgeChunk{}).Where("model = ?", s.embedder.Model()).Count(&chunks)
+	s.db.WithContext(ctx).Model(&models.KnowledgeChunk{}).Where("model = ?", s.embedder.Model()).Distinct("doc_id").Count(&docs)
+	return map[string]interface{}{
+		"model":    s.embedder.Model(),
+		"pgvector": s.pgvector,
+		"docs":     docs,
+		"chunks":   chunks,
+	}
+}
+
+// hitsToDocs 命中切块转为提示词使用的文档（内容为切块文本）
+func hitsToDocs(hits []KnowledgeHit) []models.KnowledgeDoc {
+	docs := make([]models.KnowledgeDoc, 0, len(hits))
+	for _, h := range hits {
+		docs = append(docs, models.KnowledgeDoc{ID: h.DocID, Title: h.Title, Category: h.Category, Content: h.Content})
+	}
+	return docs
+}
+
+// chunkText 按字符数切块，尽量在句末或换行处断开；相邻块重叠 overlap 个字符
+func chunkText(text string, size, overlap int) []string {
+	runes := []rune(strings.TrimSpace(text))
+	if len(runes) == 0 {
+		return nil
+	}
+	var chunks []string
+	for start := 0; start < len(runes); {
+		end := min(start+size, len(runes))
+		if end < len(runes) {
+			// 断点不早于块长的一半
+			for i := end; i > start+size/2; i-- {
+				if isChunkBoundary(runes[i-1]) {
+					end = i
+					break
+				}
+			}
+		}
+		if part := strings.TrimSpace(string(runes[start:end])); part != "" {
+			chunks = append(chunks, part)
+		}
+		if end == len(runes) {
+			break
+		}
+		next := end - overlap
+		if next <= start {
+			next = end
+		}
+		start = next
+	}
+	return chunks
+}
+
+func isChunkBoundary(r rune) bool {
+	switch r {
+	case '\n', '。', '！', '？', '；', '.', '!', '?', ';':
+		return true
+	}
+	return false
+}
@@ -0,0 +1,177 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"servify/apps/server/internal/models"
+)
+
+func newKnowledgeSearchTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:knowledge_search_"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.KnowledgeDoc{}, &models.KnowledgeChunk{}); err != nil {
+		t.Fatalf("automigrate: %v", err)
+	}
+	return db
+}
+
+// flakyEmbedder 委托给哈希向量，fail 为 true 时返回错误
+type flakyEmbedder struct {
+	Embedder
+	fail bool
+}
+
+func (e *flakyEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if e.fail {
+		return nil, errors.New("embedding service down")
+	}
+	return e.Embedder.Embed(ctx, texts)
+}
+
+func TestChunkText(t *testing.T) {
+	text := strings.Repeat("远程协助需要客户授权。", 30) // 300 字
+	chunks := chunkText(text, 100, 10)
+	if len(chunks) < 3 {
+		t.Fatalf("chunks = %d", len(chunks))
+	}
+	for _, c := range chunks {
+		if n := len([]rune(c)); n > 100 {
+			t.Fatalf("chunk too long: %d", n)
+		}
+		if !strings.HasSuffix(c, "。") {
+			t.Fatalf("chunk should end at sentence boundary: %q", c)
+		}
+	}
+	if got := chunkText("  短文本 ", 100, 10); len(got) != 1 || got[0] != "短文本" {
+		t.Fatalf("short text = %q", got)
+	}
+}
+
+func TestKnowledgeSearch_IndexesOnDocCRUD(t *testing.T) {
+	db := newKnowledgeSearchTestDB(t)
+	hash, _ := NewEmbedder(EmbeddingConfig{})
+	search := NewKnowledgeSearchService(db, hash, KnowledgeSearchConfig{}, nil)
+	docs := NewKnowledgeDocService(db)
+	docs.SetIndexer(search)
+	ctx := context.Background()
+
+	refund, _ := docs.Create(ctx, &KnowledgeDocCreateRequest{Title: "退款政策", Content: "购买后七天内可申请全额退款，退款将在三个工作日内原路退回。"})
+	_, _ = docs.Create(ctx, &KnowledgeDocCreateRequest{Title: "Remote assistance", Content: "Agents can view and control your screen after you grant permission."})
+
+	hits, err := search.Search(ctx, "怎么申请退款？", 3)
+	if err != nil || len(hits) == 0 || hits[0].DocID != refund.ID || hits[0].Title != "退款政策" || hits[0].Method != "vector" {
+		t.Fatalf("refund hits = %+v %v", hits, err)
+	}
+	hits, _ = search.Search(ctx, "screen control permission", 3)
+	if len(hits) == 0 || hits[0].Title != "Remote assistance" {
+		t.Fatalf("english hits = %+v", hits)
+	}
+
+	// 更新后旧内容不再命中
+	newContent := "订阅可随时取消，取消后当期费用不予退还。"
+	newTitle := "取消订阅"
+	if _, err := docs.Update(ctx, refund.ID, &KnowledgeDocUpdateRequest{Title: &newTitle, Content: &newContent}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	hits, _ = search.Search(ctx, "取消订阅", 3)
+	if len(hits) == 0 || hits[0].DocID != refund.ID || !strings.Contains(hits[0].Content, "随时取消") {
+		t.Fatalf("updated hits = %+v", hits)
+	}
+
+	if err := docs.Delete(ctx, refund.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	var left int64
+	db.Model(&models.KnowledgeChunk{}).Where("doc_id = ?", refund.ID).Count(&left)
+	if left != 0 {
+		t.Fatalf("chunks of deleted doc = %d", left)
+	}
+}
+
+func TestKnowledgeSearch_SyncAndBM25Fallback(t *testing.T) {
+	db := newKnowledgeSearchTestDB(t)
+	hash, _ := NewEmbedder(EmbeddingConfig{Dimensions: 256})
+	emb := &flakyEmbedder{Embedder: hash}
+	search := NewKnowledgeSearchService(db, emb, KnowledgeSearchConfig{}, nil)
+	ctx := context.Background()
+
+	// 直接写入的文档（未经 KnowledgeDocService）由 Sync 补齐索引
+	now := time.Now()
+	db.Create(&models.KnowledgeDoc{Title: "发票", Content: "电子发票在订单完成后自动开具，可在账户中心下载。", CreatedAt: now, UpdatedAt: now})
+	db.Create(&models.KnowledgeDoc{Title: "密码", Content: "忘记密码时可通过绑定的邮箱重置。", CreatedAt: now, UpdatedAt: now})
+	db.Create(&models.KnowledgeChunk{DocID: 999, Content: "orphan", Model: hash.Model()})
+	if n, err := search.Sync(ctx, false); err != nil || n != 2 {
+		t.Fatalf("sync = %d %v", n, err)
+	}
+	if n, _ := search.Sync(ctx, false); n != 0 {
+		t.Fatalf("second sync should be a no-op, indexed %d", n)
+	}
+	var orphans int64
+	db.Model(&models.KnowledgeChunk{}).Where("doc_id = ?", 999).Count(&orphans)
+	if orphans != 0 {
+		t.Fatal("orphan chunks should be removed")
+	}
+
+	// 查询向量化失败时降级为 BM25
+	emb.fail = true
+	hits, err := search.Search(ctx, "发票在哪下载", 3)
+	if err != nil || len(hits) == 0 || hits[0].Title != "发票" || hits[0].Method != "bm25" {
+		t.Fatalf("bm25 hits = %+v %v", hits, err)
+	}
+}
+
+func TestOpenAIEmbedder(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Model string   `json:"model"`
+			Input []string `json:"input"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if r.URL.Path != "/embeddings" || req.Model != "text-embedding-3-small" || r.Header.Get("Authorization") != "Bearer sk" {
+			t.Errorf("unexpected request %s %+v", r.URL.Path, req)
+		}
+		// 乱序返回，按 index 还原
+		fmt.Fprint(w, `{"data":[{"index":1,"embedding":[0,1]},{"index":0,"embedding":[1,0]}]}`)
+	}))
+	defer srv.Close()
+
+	e, err := NewEmbedder(EmbeddingConfig{Provider: EmbeddingProviderOpenAI, BaseURL: srv.URL, APIKey: "sk"})
+	if err != nil {
+		t.Fatalf("new embedder: %v", err)
+	}
+	vecs, err := e.Embed(context.Background(), []string{"a", "b"})
+	if err != nil || len(vecs) != 2 || vecs[0][0] != 1 || vecs[1][1] != 1 || e.Model() != "openai:text-embedding-3-small" {
+		t.Fatalf("vecs = %v %v", vecs, err)
+	}
+}
+
+func TestAIService_UsesKnowledgeSearch(t *testing.T) {
+	db := newKnowledgeSearchTestDB(t)
+	hash, _ := NewEmbedder(EmbeddingConfig{})
+	search := NewKnowledgeSearchService(db, hash, KnowledgeSearchConfig{}, nil)
+	docs := NewKnowledgeDocService(db)
+	docs.SetIndexer(search)
+	_, _ = docs.Create(context.Background(), &KnowledgeDocCreateRequest{Title: "营业时间", Content: "人工客服工作日 9:00-18:00 在线。"})
+
+	s := NewAIService("", "")
+	s.InitializeKnowledgeBase()
+	s.SetKnowledgeSearch(search)
+	preview, err := s.PreviewPrompt(context.Background(), PromptPreviewRequest{Query: "人工客服几点在线"})
+	if err != nil || !strings.Contains(preview.Prompt.Text, "9:00-18:00") {
+		t.Fatalf("prompt should include semantic hit: %+v %v", preview, err)
+	}
+}
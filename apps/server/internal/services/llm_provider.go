@@ -0,0 +1,809 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// LLM 后端类型
+const (
+	LLMProviderOpenAI    = "openai" // OpenAI 及兼容 chat/completions 的接口（Azure 网关、vLLM、DeepSeek 等）
+	LLMProviderAnthropic = "anthropic"
+	LLMProviderOllama    = "ollama"
+)
+
+// anthropicVersion Messages API 版本头
+const anthropicVersion = "2023-06-01"
+
+// LLMProviderConfig 模型后端配置；Model/Temperature/MaxTokens 为该后端的默认生成参数
+type LLMProviderConfig struct {
+	Name        string
+	Type        string
+	BaseURL     string
+	APIKey      string
+	Model       string
+	Temperature float64
+	MaxTokens   int
+	Timeout     time.Duration
+}
+
+// LLMRequest 一次生成请求；零值字段使用后端默认值
+type LLMRequest struct {
+	Messages    []Message
+	Model       string
+	Temperature float64
+	MaxTokens   int
+	Tools       []LLMTool // 允许模型调用的工具；为空时不启用工具调用
+}
+
+// LLMTool 工具定义；Parameters 为参数的 JSON Schema
+type LLMTool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Parameters  map[string]interface{} `json:"parameters"`
+}
+
+// LLMToolCall 模型发起的一次工具调用；各后端统一转换为 OpenAI 的格式（Arguments 为 JSON 字符串）
+type LLMToolCall struct {
+	ID       string          `json:"id"`
+	Type     string          `json:"type"`
+	Function LLMFunctionCall `json:"function"`
+}
+
+// LLMFunctionCall 工具名与参数
+type LLMFunctionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// toolArguments 工具参数转为 JSON 对象；缺失或非法时为 {}
+func toolArguments(args string) json.RawMessage {
+	if strings.TrimSpace(args) == "" || !json.Valid([]byte(args)) {
+		return json.RawMessage("{}")
+	}
+	return json.RawMessage(args)
+}
+
+// LLMUsage token 用量（后端未返回时为 0）
+type LLMUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+// LLMResponse 生成结果及实际使用的后端与模型
+type LLMResponse struct {
+	Content   string        `json:"content"`
+	ToolCalls []LLMToolCall `json:"tool_calls,omitempty"` // 非空时模型在等待工具结果
+	Provider  string        `json:"provider"`
+	Model     string        `json:"model"`
+	Usage     LLMUsage      `json:"usage"`
+}
+
+// LLMProvider 模型后端抽象；Stream 在生成过程中通过 onDelta 推送增量并返回完整结果
+type LLMProvider interface {
+	Name() string
+	Complete(ctx context.Context, req LLMRequest) (*LLMResponse, error)
+	Stream(ctx context.Context, req LLMRequest, onDelta func(string)) (*LLMResponse, error)
+}
+
+// NewLLMProvider 按类型创建后端
+func NewLLMProvider(cfg LLMProviderConfig) (LLMProvider, error) {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	base := llmHTTPProvider{
+		cfg: cfg,
+		client: &http.Client{
+			Timeout:   cfg.Timeout,
+			Transport: otelhttp.NewTransport(http.DefaultTransport),
+		},
+	}
+	switch strings.ToLower(cfg.Type) {
+	case LLMProviderOpenAI, "":
+		if base.cfg.Name == "" {
+			base.cfg.Name = LLMProviderOpenAI
+		}
+		if base.cfg.BaseURL == "" {
+			base.cfg.BaseURL = "https://api.openai.com/v1"
+		}
+		if base.cfg.Model == "" {
+			base.cfg.Model = "gpt-3.5-turbo"
+		}
+		return &OpenAICompatibleProvider{base}, nil
+	case LLMProviderAnthropic:
+		if base.cfg.Name == "" {
+			base.cfg.Name = LLMProviderAnthropic
+		}
+		if base.cfg.BaseURL == "" {
+			base.cfg.BaseURL = "https://api.anthropic.com"
+		}
+		if base.cfg.Model == "" {
+			return nil, fmt.Errorf("anthropic provider %q requires a model", base.cfg.Name)
+		}
+		return &AnthropicProvider{base}, nil
+	case LLMProviderOllama:
+		if base.cfg.Name == "" {
+			base.cfg.Name = LLMProviderOllama
+		}
+		if base.cfg.BaseURL == "" {
+			base.cfg.BaseURL = "http://localhost:11434"
+		}
+		if base.cfg.Model == "" {
+			return nil, fmt.Errorf("ollama provider %q requires a model", base.cfg.Name)
+		}
+		return &OllamaProvider{base}, nil
+	default:
+		return nil, fmt.Errorf("unknown LLM provider type: %s", cfg.Type)
+	}
+}
+
+// llmHTTPProvider 各 HTTP 后端共用的请求与参数处理
+type llmHTTPProvider struct {
+	cfg    LLMProviderConfig
+	client *http.Client
+}
+
+func (p *llmHTTPProvider) Name() string { return p.cfg.Name }
+
+// options 合并请求参数与后端默认值
+func (p *llmHTTPProvider) options(req LLMRequest) (model string, temperature float64, maxTokens int) {
+	model, temperature, maxTokens = req.Model, req.Temperature, req.MaxTokens
+	if model == "" {
+		model = p.cfg.Model
+	}
+	if temperature == 0 {
+		temperature = p.cfg.Temperature
+	}
+	if maxTokens == 0 {
+		maxTokens = p.cfg.MaxTokens
+	}
+	return model, temperature, maxTokens
+}
+
+// post 发送 JSON 请求；非 2xx 响应转为错误。stream 请求不受 client 超时限制，由 ctx 控制时长
+func (p *llmHTTPProvider) post(ctx context.Context, path string, payload interface{}, headers map[string]string, stream bool) (*http.Response, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	url := strings.TrimRight(p.cfg.BaseURL, "/") + path
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if stream {
+		req.Header.Set("Accept", "text/event-stream")
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	client := p.client
+	if stream {
+		c := *p.client
+		c.Timeout = 0
+		client = &c
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		if msg := llmErrorMessage(data); msg != "" {
+			return nil, fmt.Errorf("%s API error: %s", p.cfg.Name, msg)
+		}
+		return nil, fmt.Errorf("%s API error: %s", p.cfg.Name, resp.Status)
+	}
+	return resp, nil
+}
+
+// llmErrorMessage 提取错误信息：兼容 {"error":{"message":..}} 与 {"error":".."} 两种格式
+func llmErrorMessage(body []byte) string {
+	var payload struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if json.Unmarshal(body, &payload) != nil || len(payload.Error) == 0 || string(payload.Error) == "null" {
+		return ""
+	}
+	var text string
+	if json.Unmarshal(payload.Error, &text) == nil {
+		return text
+	}
+	var obj struct {
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(payload.Error, &obj) == nil {
+		return obj.Message
+	}
+	return ""
+}
+
+// scanLines 逐行读取流式响应；fn 返回 true 时停止
+func scanLines(r io.Reader, fn func(line string) (bool, error)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		stop, err := fn(line)
+		if err != nil {
+			return err
+		}
+		if stop {
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read stream: %w", err)
+	}
+	return nil
+}
+
+// sseData 返回 SSE data 行的内容；注释、event: 等其他行返回 false
+func sseData(line string) (string, bool) {
+	if !strings.HasPrefix(line, "data:") {
+		return "", false
+	}
+	return strings.TrimSpace(strings.TrimPrefix(line, "data:")), true
+}
+
+// streamResult 流结束后的统一收尾：被取消或既无内容也无工具调用时返回错误
+func streamResult(ctx context.Context, name string, full *strings.Builder, resp *LLMResponse) (*LLMResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if full.Len() == 0 && len(resp.ToolCalls) == 0 {
+		return nil, fmt.Errorf("no response from %s", name)
+	}
+	resp.Content = full.String()
+	return resp, nil
+}
+
+// OpenAICompatibleProvider OpenAI chat/completions 协议
+type OpenAICompatibleProvider struct {
+	llmHTTPProvider
+}
+
+type openAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+type openAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type openAITool struct {
+	Type     string  `json:"type"`
+	Function LLMTool `json:"function"`
+}
+
+// openAIToolCallDelta 流式响应中按 index 分片下发的工具调用
+type openAIToolCallDelta struct {
+	Index    int             `json:"index"`
+	ID       string          `json:"id"`
+	Function LLMFunctionCall `json:"function"`
+}
+
+func openAITools(tools []LLMTool) []openAITool {
+	if len(tools) == 0 {
+		return nil
+	}
+	out := make([]openAITool, 0, len(tools))
+	for _, t := range tools {
+		out = append(out, openAITool{Type: "function", Function: t})
+	}
+	return out
+}
+
+// mergeToolCallDelta 按 index 拼接工具调用分片
+func mergeToolCallDelta(calls []LLMToolCall, d openAIToolCallDelta) []LLMToolCall {
+	for len(calls) <= d.Index {
+		calls = append(calls, LLMToolCall{Type: "function"})
+	}
+	c := &calls[d.Index]
+	if d.ID != "" {
+		c.ID = d.ID
+	}
+	if d.Function.Name != "" {
+		c.Function.Name = d.Function.Name
+	}
+	c.Function.Arguments += d.Function.Arguments
+	return calls
+}
+
+func (p *OpenAICompatibleProvider) headers() map[string]string {
+	if p.cfg.APIKey == "" {
+		return nil
+	}
+	return map[string]string{"Authorization": "Bearer " + p.cfg.APIKey}
+}
+
+func (p *OpenAICompatibleProvider) request(req LLMRequest, stream bool) OpenAIRequest {
+	model, temperature, maxTokens := p.options(req)
+	out := OpenAIRequest{
+		Model:       model,
+		Messages:    req.Messages,
+		Temperature: temperature,
+		MaxTokens:   maxTokens,
+		Stream:      stream,
+		Tools:       openAITools(req.Tools),
+	}
+	if stream {
+		// 流式响应默认不含用量，需显式请求在最后一个分片中返回
+		out.StreamOptions = &openAIStreamOptions{IncludeUsage: true}
+	}
+	return out
+}
+
+func (p *OpenAICompatibleProvider) Complete(ctx context.Context, req LLMRequest) (*LLMResponse, error) {
+	payload := p.request(req, false)
+	resp, err := p.post(ctx, "/chat/completions", payload, p.headers(), false)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var out struct {
+		OpenAIResponse
+		Model string      `json:"model"`
+		Usage openAIUsage `json:"usage"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	if out.Error != nil {
+		return nil, fmt.Errorf("%s API error: %s", p.cfg.Name, out.Error.Message)
+	}
+	if len(out.Choices) == 0 {
+		return nil, fmt.Errorf("no response from %s", p.cfg.Name)
+	}
+	model := out.Model
+	if model == "" {
+		model = payload.Model
+	}
+	return &LLMResponse{
+		Content:   out.Choices[0].Message.Content,
+		ToolCalls: out.Choices[0].Message.ToolCalls,
+		Provider:  p.cfg.Name,
+		Model:     model,
+		Usage:     LLMUsage{PromptTokens: out.Usage.PromptTokens, CompletionTokens: out.Usage.CompletionTokens},
+	}, nil
+}
+
+func (p *OpenAICompatibleProvider) Stream(ctx context.Context, req LLMRequest, onDelta func(string)) (*LLMResponse, error) {
+	payload := p.request(req, true)
+	resp, err := p.post(ctx, "/chat/completions", payload, p.headers(), true)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	result := &LLMResponse{Provider: p.cfg.Name, Model: payload.Model}
+	var full strings.Builder
+	err = scanLines(resp.Body, func(line string) (bool, error) {
+		data, ok := sseData(line)
+		if !ok {
+			return false, nil
+		}
+		if data == "[DONE]" {
+			return true, nil
+		}
+		var chunk struct {
+			openAIStreamChunk
+			Usage *openAIUsage `json:"usage"`
+		}
+		if json.Unmarshal([]byte(data), &chunk) != nil {
+			return false, nil
+		}
+		if chunk.Error != nil {
+			return false, fmt.Errorf("%s API error: %s", p.cfg.Name, chunk.Error.Message)
+		}
+		if chunk.Usage != nil {
+			result.Usage = LLMUsage{PromptTokens: chunk.Usage.PromptTokens, CompletionTokens: chunk.Usage.CompletionTokens}
+		}
+		for _, choice := range chunk.Choices {
+			if choice.Delta.Content != "" {
+				full.WriteString(choice.Delta.Content)
+				onDelta(choice.Delta.Content)
+			}
+			for _, d := range choice.Delta.ToolCalls {
+				result.ToolCalls = mergeToolCallDelta(result.ToolCalls, d)
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return streamResult(ctx, p.cfg.Name, &full, result)
+}
+
+// AnthropicProvider Anthropic Messages API（/v1/messages）
+type AnthropicProvider struct {
+	llmHTTPProvider
+}
+
+type anthropicRequest struct {
+	Model       string             `json:"model"`
+	System      string             `json:"system,omitempty"`
+	Messages    []anthropicMessage `json:"messages"`
+	MaxTokens   int                `json:"max_tokens"`
+	Temperature float64            `json:"temperature"`
+	Stream      bool               `json:"stream,omitempty"`
+	Tools       []anthropicTool    `json:"tools,omitempty"`
+}
+
+// anthropicMessage Content 为纯文本，或包含工具调用/结果时的内容块列表
+type anthropicMessage struct {
+	Role    string      `json:"role"`
+	Content interface{} `json:"content"`
+}
+
+type anthropicBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Content   string          `json:"content,omitempty"`
+}
+
+type anthropicTool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	InputSchema map[string]interface{} `json:"input_schema"`
+}
+
+type anthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+func (p *AnthropicProvider) headers() map[string]string {
+	return map[string]string{
+		"x-api-key":         p.cfg.APIKey,
+		"anthropic-version": anthropicVersion,
+	}
+}
+
+// request system 角色消息合并为顶层 system 字段；max_tokens 为必填项。
+// 工具调用转为 tool_use 内容块，工具结果转为 user 消息中的 tool_result 块（连续结果合并为一条）
+func (p *AnthropicProvider) request(req LLMRequest, stream bool) anthropicRequest {
+	model, temperature, maxTokens := p.options(req)
+	if maxTokens <= 0 {
+		maxTokens = 1024
+	}
+	out := anthropicRequest{Model: model, MaxTokens: maxTokens, Temperature: temperature, Stream: stream}
+	for _, t := range req.Tools {
+		out.Tools = append(out.Tools, anthropicTool{Name: t.Name, Description: t.Description, InputSchema: t.Parameters})
+	}
+	var system []string
+	for _, m := range req.Messages {
+		switch {
+		case m.Role == "system":
+			system = append(system, m.Content)
+		case m.Role == "tool":
+			block := anthropicBlock{Type: "tool_result", ToolUseID: m.ToolCallID, Content: m.Content}
+			if n := len(out.Messages); n > 0 && out.Messages[n-1].Role == "user" {
+				if blocks, ok := out.Messages[n-1].Content.([]anthropicBlock); ok {
+					out.Messages[n-1].Content = append(blocks, block)
+					continue
+				}
+			}
+			out.Messages = append(out.Messages, anthropicMessage{Role: "user", Content: []anthropicBlock{block}})
+		case len(m.ToolCalls) > 0:
+			var blocks []anthropicBlock
+			if m.Content != "" {
+				blocks = append(blocks, anthropicBlock{Type: "text", Text: m.Content})
+			}
+			for _, call := range m.ToolCalls {
+				blocks = append(blocks, anthropicBlock{Type: "tool_use", ID: call.ID, Name: call.Function.Name, Input: toolArguments(call.Function.Arguments)})
+			}
+			out.Messages = append(out.Messages, anthropicMessage{Role: "assistant", Content: blocks})
+		default:
+			out.Messages = append(out.Messages, anthropicMessage{Role: m.Role, Content: m.Content})
+		}
+	}
+	out.System = strings.Join(system, "\n\n")
+	return out
+}
+
+// anthropicToolCall tool_use 内容块转为统一的工具调用
+func anthropicToolCall(id, name string, input json.RawMessage) LLMToolCall {
+	args := string(input)
+	if strings.TrimSpace(args) == "" {
+		args = "{}"
+	}
+	return LLMToolCall{ID: id, Type: "function", Function: LLMFunctionCall{Name: name, Arguments: args}}
+}
+
+func (p *AnthropicProvider) Complete(ctx context.Context, req LLMRequest) (*LLMResponse, error) {
+	payload := p.request(req, false)
+	resp, err := p.post(ctx, "/v1/messages", payload, p.headers(), false)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var out struct {
+		Model   string `json:"model"`
+		Content []struct {
+			Type  string          `json:"type"`
+			Text  string          `json:"text"`
+			ID    string          `json:"id"`
+			Name  string          `json:"name"`
+			Input json.RawMessage `json:"input"`
+		} `json:"content"`
+		Usage anthropicUsage `json:"usage"`
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	if out.Error != nil {
+		return nil, fmt.Errorf("%s API error: %s", p.cfg.Name, out.Error.Message)
+	}
+	var text strings.Builder
+	var calls []LLMToolCall
+	for _, block := range out.Content {
+		switch block.Type {
+		case "text":
+			text.WriteString(block.Text)
+		case "tool_use":
+			calls = append(calls, anthropicToolCall(block.ID, block.Name, block.Input))
+		}
+	}
+	if text.Len() == 0 && len(calls) == 0 {
+		return nil, fmt.Errorf("no response from %s", p.cfg.Name)
+	}
+	model := out.Model
+	if model == "" {
+		model = payload.Model
+	}
+	return &LLMResponse{
+		Content:   text.String(),
+		ToolCalls: calls,
+		Provider:  p.cfg.Name,
+		Model:     model,
+		Usage:     LLMUsage{PromptTokens: out.Usage.InputTokens, CompletionTokens: out.Usage.OutputTokens},
+	}, nil
+}
+
+func (p *AnthropicProvider) Stream(ctx context.Context, req LLMRequest, onDelta func(string)) (*LLMResponse, error) {
+	payload := p.request(req, true)
+	resp, err := p.post(ctx, "/v1/messages", payload, p.headers(), true)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	result := &LLMResponse{Provider: p.cfg.Name, Model: payload.Model}
+	var full strings.Builder
+	toolBlocks := map[int]int{}              // 内容块 index -> ToolCalls 下标
+	toolInputs := map[int]*strings.Builder{} // 内容块 index -> 分片拼接的参数
+	err = scanLines(resp.Body, func(line string) (bool, error) {
+		data, ok := sseData(line)
+		if !ok {
+			return false, nil
+		}
+		var ev struct {
+			Type    string `json:"type"`
+			Index   int    `json:"index"`
+			Message struct {
+				Usage anthropicUsage `json:"usage"`
+			} `json:"message"`
+			ContentBlock struct {
+				Type string `json:"type"`
+				ID   string `json:"id"`
+				Name string `json:"name"`
+			} `json:"content_block"`
+			Delta struct {
+				Type        string `json:"type"`
+				Text        string `json:"text"`
+				PartialJSON string `json:"partial_json"`
+			} `json:"delta"`
+			Usage anthropicUsage `json:"usage"`
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if json.Unmarshal([]byte(data), &ev) != nil {
+			return false, nil
+		}
+		switch ev.Type {
+		case "message_start":
+			result.Usage.PromptTokens = ev.Message.Usage.InputTokens
+		case "content_block_start":
+			if ev.ContentBlock.Type == "tool_use" {
+				toolBlocks[ev.Index] = len(result.ToolCalls)
+				toolInputs[ev.Index] = &strings.Builder{}
+				result.ToolCalls = append(result.ToolCalls, anthropicToolCall(ev.ContentBlock.ID, ev.ContentBlock.Name, nil))
+			}
+		case "content_block_delta":
+			switch ev.Delta.Type {
+			case "text_delta":
+				if ev.Delta.Text != "" {
+					full.WriteString(ev.Delta.Text)
+					onDelta(ev.Delta.Text)
+				}
+			case "input_json_delta":
+				if b, ok := toolInputs[ev.Index]; ok {
+					b.WriteString(ev.Delta.PartialJSON)
+				}
+			}
+		case "content_block_stop":
+			if i, ok := toolBlocks[ev.Index]; ok && toolInputs[ev.Index].Len() > 0 {
+				result.ToolCalls[i].Function.Arguments = toolInputs[ev.Index].String()
+			}
+		case "message_delta":
+			result.Usage.CompletionTokens = ev.Usage.OutputTokens
+		case "message_stop":
+			return true, nil
+		case "error":
+			msg := "stream error"
+			if ev.Error != nil {
+				msg = ev.Error.Message
+			}
+			return false, fmt.Errorf("%s API error: %s", p.cfg.Name, msg)
+		}
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return streamResult(ctx, p.cfg.Name, &full, result)
+}
+
+// OllamaProvider 本地 Ollama（/api/chat，流式响应为 NDJSON）
+type OllamaProvider struct {
+	llmHTTPProvider
+}
+
+type ollamaRequest struct {
+	Model    string                 `json:"model"`
+	Messages []ollamaMessage        `json:"messages"`
+	Stream   bool                   `json:"stream"`
+	Options  map[string]interface{} `json:"options,omitempty"`
+	Tools    []openAITool           `json:"tools,omitempty"`
+}
+
+// ollamaMessage 工具参数为 JSON 对象，且调用没有 ID（按顺序对应工具结果）
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+}
+
+type ollamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+type ollamaChunk struct {
+	Model           string        `json:"model"`
+	Message         ollamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+	Error           string        `json:"error"`
+}
+
+// ollamaToolCalls 补齐调用 ID，offset 为本次响应中已有的调用数
+func ollamaToolCalls(calls []ollamaToolCall, offset int) []LLMToolCall {
+	var out []LLMToolCall
+	for i, c := range calls {
+		out = append(out, LLMToolCall{
+			ID:       fmt.Sprintf("call_%d", offset+i),
+			Type:     "function",
+			Function: LLMFunctionCall{Name: c.Function.Name, Arguments: string(toolArguments(string(c.Function.Arguments)))},
+		})
+	}
+	return out
+}
+
+func (p *OllamaProvider) request(req LLMRequest, stream bool) ollamaRequest {
+	model, temperature, maxTokens := p.options(req)
+	options := map[string]interface{}{}
+	if temperature > 0 {
+		options["temperature"] = temperature
+	}
+	if maxTokens > 0 {
+		options["num_predict"] = maxTokens
+	}
+	messages := make([]ollamaMessage, 0, len(req.Messages))
+	for _, m := range req.Messages {
+		om := ollamaMessage{Role: m.Role, Content: m.Content}
+		for _, call := range m.ToolCalls {
+			var tc ollamaToolCall
+			tc.Function.Name = call.Function.Name
+			tc.Function.Arguments = toolArguments(call.Function.Arguments)
+			om.ToolCalls = append(om.ToolCalls, tc)
+		}
+		messages = append(messages, om)
+	}
+	return ollamaRequest{Model: model, Messages: messages, Stream: stream, Options: options, Tools: openAITools(req.Tools)}
+}
+
+func (p *OllamaProvider) Complete(ctx context.Context, req LLMRequest) (*LLMResponse, error) {
+	payload := p.request(req, false)
+	resp, err := p.post(ctx, "/api/chat", payload, nil, false)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var out ollamaChunk
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	if out.Error != "" {
+		return nil, fmt.Errorf("%s API error: %s", p.cfg.Name, out.Error)
+	}
+	if out.Message.Content == "" && len(out.Message.ToolCalls) == 0 {
+		return nil, fmt.Errorf("no response from %s", p.cfg.Name)
+	}
+	return &LLMResponse{
+		Content:   out.Message.Content,
+		ToolCalls: ollamaToolCalls(out.Message.ToolCalls, 0),
+		Provider:  p.cfg.Name,
+		Model:     payload.Model,
+		Usage:     LLMUsage{PromptTokens: out.PromptEvalCount, CompletionTokens: out.EvalCount},
+	}, nil
+}
+
+func (p *OllamaProvider) Stream(ctx context.Context, req LLMRequest, onDelta func(string)) (*LLMResponse, error) {
+	payload := p.request(req, true)
+	resp, err := p.post(ctx, "/api/chat", payload, nil, true)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	result := &LLMResponse{Provider: p.cfg.Name, Model: payload.Model}
+	var full strings.Builder
+	err = scanLines(resp.Body, func(line string) (bool, error) {
+		var chunk ollamaChunk
+		if json.Unmarshal([]byte(line), &chunk) != nil {
+			return false, nil
+		}
+		if chunk.Error != "" {
+			return false, fmt.Errorf("%s API error: %s", p.cfg.Name, chunk.Error)
+		}
+		if chunk.Message.Content != "" {
+			full.WriteString(chunk.Message.Content)
+			onDelta(chunk.Message.Content)
+		}
+		if len(chunk.Message.ToolCalls) > 0 {
+			result.ToolCalls = append(result.ToolCalls, ollamaToolCalls(chunk.Message.ToolCalls, len(result.ToolCalls))...)
+		}
+		if chunk.Done {
+			result.Usage = LLMUsage{PromptTokens: chunk.PromptEvalCount, CompletionTokens: chunk.EvalCount}
+			return true, nil
+		}
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return streamResult(ctx, p.cfg.Name, &full, result)
+}
@@ -0,0 +1,337 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestProvider(t *testing.T, cfg LLMProviderConfig) LLMProvider {
+	t.Helper()
+	p, err := NewLLMProvider(cfg)
+	if err != nil {
+		t.Fatalf("new provider: %v", err)
+	}
+	return p
+}
+
+func TestOpenAICompatibleProvider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" || r.Header.Get("Authorization") != "Bearer sk-test" {
+			t.Errorf("unexpected request %s auth=%q", r.URL.Path, r.Header.Get("Authorization"))
+		}
+		var req OpenAIRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if req.Model != "gpt-4o-mini" || req.Temperature != 0.2 || req.MaxTokens != 256 {
+			t.Errorf("options not applied: %+v", req)
+		}
+		if req.Stream {
+			if req.StreamOptions == nil || !req.StreamOptions.IncludeUsage {
+				t.Errorf("stream should request usage: %+v", req.StreamOptions)
+			}
+			fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"He\"}}]}\n\ndata: {\"choices\":[{\"delta\":{\"content\":\"y\"}}]}\n\ndata: {\"choices\":[],\"usage\":{\"prompt_tokens\":5,\"completion_tokens\":2}}\n\ndata: [DONE]\n\n")
+			return
+		}
+		fmt.Fprint(w, `{"model":"gpt-4o-mini","choices":[{"message":{"role":"assistant","content":"Hey"}}],"usage":{"prompt_tokens":5,"completion_tokens":1}}`)
+	}))
+	defer srv.Close()
+
+	p := newTestProvider(t, LLMProviderConfig{Type: LLMProviderOpenAI, BaseURL: srv.URL + "/v1", APIKey: "sk-test", Model: "gpt-4o-mini", Temperature: 0.2, MaxTokens: 256})
+	req := LLMRequest{Messages: []Message{{Role: "user", Content: "hi"}}}
+	resp, err := p.Complete(context.Background(), req)
+	if err != nil || resp.Content != "Hey" || resp.Usage.PromptTokens != 5 || resp.Provider != "openai" {
+		t.Fatalf("complete: %+v %v", resp, err)
+	}
+	var deltas []string
+	resp, err = p.Stream(context.Background(), req, func(d string) { deltas = append(deltas, d) })
+	if err != nil || resp.Content != "Hey" || strings.Join(deltas, "|") != "He|y" || resp.Usage.CompletionTokens != 2 {
+		t.Fatalf("stream: %+v %v %v", resp, deltas, err)
+	}
+}
+
+func TestAnthropicProvider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" || r.Header.Get("x-api-key") != "ak" || r.Header.Get("anthropic-version") == "" {
+			t.Errorf("unexpected request %s headers=%v", r.URL.Path, r.Header)
+		}
+		var req anthropicRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if req.System != "be brief" || len(req.Messages) != 1 || req.Messages[0].Role != "user" || req.MaxTokens != 1024 {
+			t.Errorf("request not mapped: %+v", req)
+		}
+		if req.Stream {
+			for _, ev := range []string{
+				`{"type":"message_start","message":{"usage":{"input_tokens":7}}}`,
+				`{"type":"content_block_delta","delta":{"type":"text_delta","text":"Bon"}}`,
+				`{"type":"content_block_delta","delta":{"type":"text_delta","text":"jour"}}`,
+				`{"type":"message_delta","usage":{"output_tokens":2}}`,
+				`{"type":"message_stop"}`,
+			} {
+				fmt.Fprintf(w, "event: x\ndata: %s\n\n", ev)
+			}
+			return
+		}
+		fmt.Fprint(w, `{"model":"claude-test","content":[{"type":"text","text":"Bonjour"}],"usage":{"input_tokens":7,"output_tokens":2}}`)
+	}))
+	defer srv.Close()
+
+	p := newTestProvider(t, LLMProviderConfig{Type: LLMProviderAnthropic, BaseURL: srv.URL, APIKey: "ak", Model: "claude-test"})
+	req := LLMRequest{Messages: []Message{{Role: "system", Content: "be brief"}, {Role: "user", Content: "hi"}}}
+	resp, err := p.Complete(context.Background(), req)
+	if err != nil || resp.Content != "Bonjour" || resp.Usage.CompletionTokens != 2 {
+		t.Fatalf("complete: %+v %v", resp, err)
+	}
+	var deltas []string
+	resp, err = p.Stream(context.Background(), req, func(d string) { deltas = append(deltas, d) })
+	if err != nil || resp.Content != "Bonjour" || len(deltas) != 2 || resp.Usage.PromptTokens != 7 || resp.Usage.CompletionTokens != 2 {
+		t.Fatalf("stream: %+v %v %v", resp, deltas, err)
+	}
+}
+
+func TestOllamaProvider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		var req ollamaRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if req.Model != "llama3" || req.Options["num_predict"] != float64(64) {
+			t.Errorf("request not mapped: %+v", req)
+		}
+		if req.Stream {
+			fmt.Fprintln(w, `{"message":{"role":"assistant","content":"Hal"},"done":false}`)
+			fmt.Fprintln(w, `{"message":{"role":"assistant","content":"lo"},"done":false}`)
+			fmt.Fprintln(w, `{"message":{"role":"assistant","content":""},"done":true,"prompt_eval_count":3,"eval_count":2}`)
+			return
+		}
+		fmt.Fprint(w, `{"message":{"role":"assistant","content":"Hallo"},"done":true,"prompt_eval_count":3,"eval_count":2}`)
+	}))
+	defer srv.Close()
+
+	p := newTestProvider(t, LLMProviderConfig{Type: LLMProviderOllama, BaseURL: srv.URL, Model: "llama3", MaxTokens: 64})
+	req := LLMRequest{Messages: []Message{{Role: "user", Content: "hi"}}}
+	resp, err := p.Complete(context.Background(), req)
+	if err != nil || resp.Content != "Hallo" || resp.Usage.PromptTokens != 3 {
+		t.Fatalf("complete: %+v %v", resp, err)
+	}
+	var deltas []string
+	resp, err = p.Stream(context.Background(), req, func(d string) { deltas = append(deltas, d) })
+	if err != nil || resp.Content != "Hallo" || strings.Join(deltas, "|") != "Hal|lo" || resp.Usage.CompletionTokens != 2 {
+		t.Fatalf("stream: %+v %v %v", resp, deltas, err)
+	}
+}
+
+// 工具调用的一轮往返：assistant 的 tool_calls + tool 结果
+var toolRoundTrip = []Message{
+	{Role: "user", Content: "my tickets?"},
+	{Role: "assistant", ToolCalls: []LLMToolCall{{ID: "call_1", Type: "function", Function: LLMFunctionCall{Name: "list_tickets", Arguments: `{"status":"open"}`}}}},
+	{Role: "tool", ToolCallID: "call_1", Content: `{"total":1}`},
+}
+
+func TestOpenAICompatibleProvider_StreamToolCalls(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req OpenAIRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if len(req.Tools) != 1 || req.Tools[0].Type != "function" || req.Tools[0].Function.Name != "list_tickets" {
+			t.Errorf("tools not sent: %+v", req.Tools)
+		}
+		for _, ev := range []string{
+			`{"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_9","type":"function","function":{"name":"list_tickets","arguments":""}}]}}]}`,
+			`{"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"status\":"}}]}}]}`,
+			`{"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"open\"}"}}]}}]}`,
+		} {
+			fmt.Fprintf(w, "data: %s\n\n", ev)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer srv.Close()
+
+	p := newTestProvider(t, LLMProviderConfig{Type: LLMProviderOpenAI, BaseURL: srv.URL, APIKey: "k"})
+	req := LLMRequest{Messages: []Message{{Role: "user", Content: "hi"}}, Tools: []LLMTool{{Name: "list_tickets", Parameters: map[string]interface{}{"type": "object"}}}}
+	resp, err := p.Stream(context.Background(), req, func(string) {})
+	if err != nil || len(resp.ToolCalls) != 1 || resp.ToolCalls[0].ID != "call_9" || resp.ToolCalls[0].Function.Arguments != `{"status":"open"}` {
+		t.Fatalf("stream tool calls: %+v %v", resp, err)
+	}
+}
+
+func TestAnthropicProvider_ToolUse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var raw struct {
+			Tools    []anthropicTool `json:"tools"`
+			Messages []struct {
+				Role    string          `json:"role"`
+				Content json.RawMessage `json:"content"`
+			} `json:"messages"`
+			Stream bool `json:"stream"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&raw)
+		if len(raw.Tools) != 1 || raw.Tools[0].InputSchema["type"] != "object" || len(raw.Messages) != 3 {
+			t.Errorf("request not mapped: %+v", raw)
+		} else if !strings.Contains(string(raw.Messages[1].Content), `"type":"tool_use"`) || raw.Messages[2].Role != "user" || !strings.Contains(string(raw.Messages[2].Content), `"tool_use_id":"call_1"`) {
+			t.Errorf("tool blocks not mapped: %s / %s", raw.Messages[1].Content, raw.Messages[2].Content)
+		}
+		if raw.Stream {
+			for _, ev := range []string{
+				`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+				`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Checking"}}`,
+				`{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_2","name":"get_ticket_status","input":{}}}`,
+				`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"ticket_id\":"}}`,
+				`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"12}"}}`,
+				`{"type":"content_block_stop","index":1}`,
+				`{"type":"message_stop"}`,
+			} {
+				fmt.Fprintf(w, "data: %s\n\n", ev)
+			}
+			return
+		}
+		fmt.Fprint(w, `{"content":[{"type":"tool_use","id":"toolu_1","name":"get_ticket_status","input":{"ticket_id":12}}]}`)
+	}))
+	defer srv.Close()
+
+	p := newTestProvider(t, LLMProviderConfig{Type: LLMProviderAnthropic, BaseURL: srv.URL, Model: "claude-test"})
+	req := LLMRequest{Messages: toolRoundTrip, Tools: []LLMTool{{Name: "get_ticket_status", Parameters: map[string]interface{}{"type": "object"}}}}
+	resp, err := p.Complete(context.Background(), req)
+	if err != nil || len(resp.ToolCalls) != 1 || resp.ToolCalls[0].ID != "toolu_1" || resp.ToolCalls[0].Function.Arguments != `{"ticket_id":12}` {
+		t.Fatalf("complete: %+v %v", resp, err)
+	}
+	resp, err = p.Stream(context.Background(), req, func(string) {})
+	if err != nil || resp.Content != "Checking" || len(resp.ToolCalls) != 1 || resp.ToolCalls[0].Function.Arguments != `{"ticket_id":12}` {
+		t.Fatalf("stream: %+v %v", resp, err)
+	}
+}
+
+func TestNewLLMProvider_Invalid(t *testing.T) {
+	if _, err := NewLLMProvider(LLMProviderConfig{Type: "bard"}); err == nil {
+		t.Fatal("unknown type should be rejected")
+	}
+	if _, err := NewLLMProvider(LLMProviderConfig{Type: LLMProviderOllama}); err == nil {
+		t.Fatal("ollama without model should be rejected")
+	}
+}
+
+func TestLLMRouter_FailoverAndCircuitBreaker(t *testing.T) {
+	var primaryCalls int
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primaryCalls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, `{"error":{"message":"overloaded"}}`)
+	}))
+	defer primary.Close()
+	local := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"message":{"role":"assistant","content":"from local"},"done":true}`)
+	}))
+	defer local.Close()
+
+	router := NewLLMRouter(nil)
+	_ = router.AddProvider(newTestProvider(t, LLMProviderConfig{Name: "primary", Type: LLMProviderOpenAI, BaseURL: primary.URL, APIKey: "k"}),
+		&CircuitBreakerConfig{MaxFailures: 2, ResetTimeout: time.Hour, HalfOpenMaxReqs: 1})
+	_ = router.AddProvider(newTestProvider(t, LLMProviderConfig{Name: "local", Type: LLMProviderOllama, BaseURL: local.URL, Model: "llama3"}), nil)
+	if err := router.SetUseCase(LLMUseCaseSummary, []string{"local"}); err != nil {
+		t.Fatalf("use case: %v", err)
+	}
+	if err := router.SetUseCase(LLMUseCaseDraft, []string{"missing"}); err == nil {
+		t.Fatal("unknown provider in use case should be rejected")
+	}
+
+	req := LLMRequest{Messages: []Message{{Role: "user", Content: "hi"}}}
+	for i := 0; i < 3; i++ {
+		resp, err := router.Complete(context.Background(), LLMUseCaseAnswer, req)
+		if err != nil || resp.Provider != "local" || resp.Content != "from local" {
+			t.Fatalf("call %d: %+v %v", i, resp, err)
+		}
+	}
+	if primaryCalls != 2 {
+		t.Fatalf("open circuit should skip primary, calls=%d", primaryCalls)
+	}
+
+	if _, err := router.Complete(context.Background(), LLMUseCaseSummary, req); err != nil || primaryCalls != 2 {
+		t.Fatalf("summary should only use local: %v calls=%d", err, primaryCalls)
+	}
+}
+
+func TestLLMRouter_StreamNoFailoverAfterPartialOutput(t *testing.T) {
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"par\"}}]}\n\ndata: {\"error\":{\"message\":\"boom\"}}\n\n")
+	}))
+	defer broken.Close()
+	var backupCalls int
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		backupCalls++
+		fmt.Fprintln(w, `{"message":{"content":"ok"},"done":true}`)
+	}))
+	defer backup.Close()
+
+	router := NewLLMRouter(nil)
+	_ = router.AddProvider(newTestProvider(t, LLMProviderConfig{Name: "a", BaseURL: broken.URL, APIKey: "k"}), nil)
+	_ = router.AddProvider(newTestProvider(t, LLMProviderConfig{Name: "b", Type: LLMProviderOllama, BaseURL: backup.URL, Model: "m"}), nil)
+
+	var deltas []string
+	if _, err := router.Stream(context.Background(), LLMUseCaseAnswer, LLMRequest{}, func(d string) { deltas = append(deltas, d) }); err == nil {
+		t.Fatal("expected error after partial output")
+	}
+	if backupCalls != 0 || strings.Join(deltas, "") != "par" {
+		t.Fatalf("must not fail over after streaming: backup=%d deltas=%v", backupCalls, deltas)
+	}
+}
+
+func TestAIService_UsesLLMRouter(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"content":[{"type":"text","text":"routed"}]}`)
+	}))
+	defer srv.Close()
+
+	router := NewLLMRouter(nil)
+	_ = router.AddProvider(newTestProvider(t, LLMProviderConfig{Type: LLMProviderAnthropic, BaseURL: srv.URL, Model: "claude-test"}), nil)
+	s := NewAIService("", "")
+	s.SetLLMRouter(router)
+
+	resp, err := s.ProcessQuery(context.Background(), "hello", "s1")
+	if err != nil || resp.Content != "routed" {
+		t.Fatalf("query: %+v %v", resp, err)
+	}
+}
+
+// blockingProvider 阻塞直至 ctx 取消，模拟客户端断开
+type blockingProvider struct{ calls int }
+
+func (p *blockingProvider) Name() string { return "slow" }
+func (p *blockingProvider) Complete(ctx context.Context, _ LLMRequest) (*LLMResponse, error) {
+	p.calls++
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+func (p *blockingProvider) Stream(ctx context.Context, req LLMRequest, _ func(string)) (*LLMResponse, error) {
+	return p.Complete(ctx, req)
+}
+
+func TestLLMRouter_CancelledHalfOpenProbeReleasesSlot(t *testing.T) {
+	p := &blockingProvider{}
+	router := NewLLMRouter(nil)
+	_ = router.AddProvider(p, &CircuitBreakerConfig{MaxFailures: 1, ResetTimeout: time.Millisecond, HalfOpenMaxReqs: 1})
+	b := router.backends["slow"].breaker
+	b.OnFailure()
+	time.Sleep(2 * time.Millisecond)
+
+	req := LLMRequest{Messages: []Message{{Role: "user", Content: "hi"}}}
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+		_, err := router.Complete(ctx, LLMUseCaseAnswer, req)
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("probe %d: err = %v", i, err)
+		}
+		// 取消的试探不计入失败，名额释放后下一个请求仍可试探
+		if !b.IsHalfOpen() || b.FailureCount() != 1 {
+			t.Fatalf("probe %d: state=%s failures=%d", i, b.State(), b.FailureCount())
+		}
+	}
+	if p.calls != 3 {
+		t.Fatalf("provider calls = %d, want 3", p.calls)
+	}
+}
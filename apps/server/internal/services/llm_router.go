@@ -0,0 +1,182 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// LLM 使用场景：各场景可配置不同的后端及故障转移顺序
+const (
+	LLMUseCaseAnswer  = "answer"  // 面向客户的回答
+	LLMUseCaseSummary = "summary" // 会话摘要
+	LLMUseCaseDraft   = "draft"   // 坐席回复草稿
+	LLMUseCaseTriage  = "triage"  // 工单分流
+	LLMUseCaseEval    = "eval"    // 离线评测中的模型评审
+)
+
+// ErrNoLLMProvider 场景下没有可用（已配置且未熔断）的后端
+var ErrNoLLMProvider = errors.New("no LLM provider available")
+
+type llmBackend struct {
+	provider LLMProvider
+	breaker  *CircuitBreaker
+}
+
+// LLMRouter 按使用场景选择后端，失败时按顺序切换；每个后端由独立的熔断器保护
+type LLMRouter struct {
+	backends map[string]*llmBackend
+	order    []string            // 默认顺序（注册顺序）
+	useCases map[string][]string // 场景 -> 后端顺序
+	logger   *logrus.Logger
+}
+
+// NewLLMRouter 创建路由器
+func NewLLMRouter(logger *logrus.Logger) *LLMRouter {
+	if logger == nil {
+		logger = logrus.New()
+	}
+	return &LLMRouter{
+		backends: make(map[string]*llmBackend),
+		useCases: make(map[string][]string),
+		logger:   logger,
+	}
+}
+
+// AddProvider 注册后端；breakerCfg 为空时使用默认熔断配置
+func (r *LLMRouter) AddProvider(p LLMProvider, breakerCfg *CircuitBreakerConfig) error {
+	name := p.Name()
+	if _, exists := r.backends[name]; exists {
+		return fmt.Errorf("duplicate LLM provider: %s", name)
+	}
+	if breakerCfg == nil {
+		breakerCfg = DefaultCircuitBreakerConfig()
+	}
+	r.backends[name] = &llmBackend{provider: p, breaker: NewCircuitBreakerWithConfig(breakerCfg)}
+	r.order = append(r.order, name)
+	return nil
+}
+
+// SetUseCase 设置场景使用的后端及顺序
+func (r *LLMRouter) SetUseCase(useCase string, providers []string) error {
+	for _, name := range providers {
+		if _, ok := r.backends[name]; !ok {
+			return fmt.Errorf("use case %s references unknown LLM provider: %s", useCase, name)
+		}
+	}
+	r.useCases[useCase] = append([]string(nil), providers...)
+	return nil
+}
+
+// HasProviders 是否至少注册了一个后端
+func (r *LLMRouter) HasProviders() bool {
+	return r != nil && len(r.backends) > 0
+}
+
+func (r *LLMRouter) chain(useCase string) []string {
+	if names, ok := r.useCases[useCase]; ok && len(names) > 0 {
+		return names
+	}
+	return r.order
+}
+
+type llmAttemptKey struct{}
+
+// withLLMAttemptObserver 路由在每次失败或被取消的后端尝试后回调 fn；resp 为该次尝试已生成的内容（可能为部分结果），用于计量
+func withLLMAttemptObserver(ctx context.Context, fn func(resp *LLMResponse)) context.Context {
+	return context.WithValue(ctx, llmAttemptKey{}, fn)
+}
+
+// Complete 按场景顺序调用后端直至成功
+func (r *LLMRouter) Complete(ctx context.Context, useCase string, req LLMRequest) (*LLMResponse, error) {
+	return r.run(ctx, useCase, func(p LLMProvider) (*LLMResponse, bool, error) {
+		resp, err := p.Complete(ctx, req)
+		return resp, false, err
+	})
+}
+
+// Stream 流式版本；已向调用方输出增量后不再切换后端，避免客户看到重复内容
+func (r *LLMRouter) Stream(ctx context.Context, useCase string, req LLMRequest, onDelta func(string)) (*LLMResponse, error) {
+	return r.run(ctx, useCase, func(p LLMProvider) (*LLMResponse, bool, error) {
+		var streamed strings.Builder
+		resp, err := p.Stream(ctx, req, func(delta string) {
+			streamed.WriteString(delta)
+			onDelta(delta)
+		})
+		if err != nil && resp == nil && streamed.Len() > 0 {
+			resp = &LLMResponse{Provider: p.Name(), Content: streamed.String()}
+		}
+		return resp, streamed.Len() > 0, err
+	})
+}
+
+// run 依次尝试后端：跳过熔断中的后端；ctx 取消时立即返回，不计入失败并释放半开试探名额
+func (r *LLMRouter) run(ctx context.Context, useCase string, call func(LLMProvider) (*LLMResponse, bool, error)) (*LLMResponse, error) {
+	if r == nil {
+		return nil, ErrNoLLMProvider
+	}
+	var errs []error
+	for _, name := range r.chain(useCase) {
+		b := r.backends[name]
+		if !b.breaker.Allow() {
+			errs = append(errs, fmt.Errorf("%s: circuit open", name))
+			continue
+		}
+		resp, partial, err := call(b.provider)
+		if err == nil {
+			b.breaker.OnSuccess()
+			return resp, nil
+		}
+		observeAttempt(ctx, name, resp)
+		if ctx.Err() != nil {
+			b.breaker.OnCancel()
+			return nil, ctx.Err()
+		}
+		b.breaker.OnFailure()
+		r.logger.Warnf("LLM provider %s failed for %s: %v", name, useCase, err)
+		errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		if partial {
+			return nil, errors.Join(errs...)
+		}
+	}
+	if len(errs) == 0 {
+		return nil, ErrNoLLMProvider
+	}
+	return nil, fmt.Errorf("all LLM providers failed: %w", errors.Join(errs...))
+}
+
+// observeAttempt 上报失败的尝试；请求已发出即可能计费，无输出时也按提示词计入
+func observeAttempt(ctx context.Context, name string, resp *LLMResponse) {
+	fn, ok := ctx.Value(llmAttemptKey{}).(func(*LLMResponse))
+	if !ok {
+		return
+	}
+	if resp == nil {
+		resp = &LLMResponse{Provider: name}
+	}
+	fn(resp)
+}
+
+// Status 各后端的熔断状态与场景配置
+func (r *LLMRouter) Status() map[string]interface{} {
+	if r == nil {
+		return map[string]interface{}{"providers": []interface{}{}}
+	}
+	providers := make([]map[string]interface{}, 0, len(r.order))
+	for _, name := range r.order {
+		b := r.backends[name]
+		providers = append(providers, map[string]interface{}{
+			"name":          name,
+			"state":         b.breaker.State().String(),
+			"failure_count": b.breaker.FailureCount(),
+		})
+	}
+	useCases := make(map[string][]string, len(r.useCases))
+	for k, v := range r.useCases {
+		useCases[k] = v
+	}
+	return map[string]interface{}{"providers": providers, "use_cases": useCases}
+}
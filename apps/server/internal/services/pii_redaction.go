@@ -0,0 +1,301 @@
+package services
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// 内置敏感信息类型
+const (
+	PIIPhone    = "phone"
+	PIIEmail    = "email"
+	PIIIDCard   = "id_card"   // 中国居民身份证（18 位，校验码校验）
+	PIIBankCard = "bank_card" // 13-19 位银行卡号（Luhn 校验）
+)
+
+// PIIPattern 自定义脱敏规则；Name 用作占位符前缀
+type PIIPattern struct {
+	Name    string
+	Pattern string
+}
+
+// PIIRedactionConfig 外发 AI/RAG 前的脱敏配置；Types 为空时启用全部内置类型
+type PIIRedactionConfig struct {
+	Types  []string
+	Custom []PIIPattern
+}
+
+type piiRule struct {
+	name    string
+	re      *regexp.Regexp
+	numeric bool              // 数字类规则：前后紧邻数字时不视为命中
+	valid   func(string) bool // 可选的二次校验
+}
+
+// PIIRedactor 按规则把敏感信息替换为可还原的占位符（如 [PHONE_1]）
+type PIIRedactor struct {
+	rules []piiRule
+}
+
+// NewPIIRedactor 编译脱敏规则；内置类型按 身份证、银行卡、手机号、邮箱 的顺序匹配，自定义规则最后
+func NewPIIRedactor(cfg PIIRedactionConfig) (*PIIRedactor, error) {
+	types := cfg.Types
+	if len(types) == 0 {
+		types = []string{PIIIDCard, PIIBankCard, PIIPhone, PIIEmail}
+	}
+	enabled := make(map[string]bool, len(types))
+	for _, t := range types {
+		switch t {
+		case PIIPhone, PIIEmail, PIIIDCard, PIIBankCard:
+			enabled[t] = true
+		default:
+			return nil, fmt.Errorf("unknown PII type: %s", t)
+		}
+	}
+	r := &PIIRedactor{}
+	if enabled[PIIIDCard] {
+		r.rules = append(r.rules, piiRule{name: PIIIDCard, numeric: true, valid: validIDCard,
+			re: regexp.MustCompile(`[1-9]\d{5}(?:18|19|20)\d{2}(?:0[1-9]|1[0-2])(?:0[1-9]|[12]\d|3[01])\d{3}[\dXx]`)})
+	}
+	if enabled[PIIBankCard] {
+		r.rules = append(r.rules, piiRule{name: PIIBankCard, numeric: true, valid: luhnValid,
+			re: regexp.MustCompile(`\d{4}(?:[ -]?\d{4}){2}[ -]?\d{1,7}`)})
+	}
+	if enabled[PIIPhone] {
+		r.rules = append(r.rules, piiRule{name: PIIPhone, numeric: true,
+			re: regexp.MustCompile(`(?:\+?86[ -]?)?1[3-9]\d[ -]?\d{4}[ -]?\d{4}|\+\d{1,3}[ -]?\d{2,4}[ -]?\d{3,4}[ -]?\d{3,4}`)})
+	}
+	if enabled[PIIEmail] {
+		r.rules = append(r.rules, piiRule{name: PIIEmail,
+			re: regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)})
+	}
+	for _, c := range cfg.Custom {
+		if c.Name == "" {
+			return nil, fmt.Errorf("custom PII pattern requires a name")
+		}
+		re, err := regexp.Compile(c.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PII pattern %s: %w", c.Name, err)
+		}
+		r.rules = append(r.rules, piiRule{name: c.Name, re: re})
+	}
+	return r, nil
+}
+
+// NewVault 创建一次调用内使用的占位符映射；r 为 nil 时返回 nil（不脱敏）
+func (r *PIIRedactor) NewVault() *PIIVault {
+	if r == nil {
+		return nil
+	}
+	return &PIIVault{redactor: r, byValue: make(map[string]string), counts: make(map[string]int)}
+}
+
+// Mask 不可逆脱敏：替换为不带编号的占位符（如 [PHONE]），用于落库
+func (r *PIIRedactor) Mask(text string) string {
+	if r == nil {
+		return text
+	}
+	for _, rule := range r.rules {
+		text = rule.replace(text, func(string) string { return "[" + strings.ToUpper(rule.name) + "]" })
+	}
+	return text
+}
+
+// replace 替换规则命中的片段；数字类规则跳过前后紧邻数字或未通过校验的命中
+func (rule piiRule) replace(text string, repl func(string) string) string {
+	matches := rule.re.FindAllStringIndex(text, -1)
+	if len(matches) == 0 {
+		return text
+	}
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		value := text[m[0]:m[1]]
+		if rule.numeric && (m[0] > 0 && isASCIIDigit(text[m[0]-1]) || m[1] < len(text) && isASCIIDigit(text[m[1]])) {
+			continue
+		}
+		if rule.valid != nil && !rule.valid(value) {
+			continue
+		}
+		b.WriteString(text[last:m[0]])
+		b.WriteString(repl(value))
+		last = m[1]
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// PIIVault 占位符与原文的映射：同一原文在一次调用内始终对应同一占位符，回复中的占位符据此还原
+type PIIVault struct {
+	redactor *PIIRedactor
+	byValue  map[string]string // 原文 -> 占位符
+	pairs    []string          // 占位符, 原文, ...（还原用）
+	counts   map[string]int
+}
+
+// Redact 替换文本中的敏感信息
+func (v *PIIVault) Redact(text string) string {
+	if v == nil {
+		return text
+	}
+	for _, rule := range v.redactor.rules {
+		text = rule.replace(text, func(value string) string {
+			if ph, ok := v.byValue[value]; ok {
+				return ph
+			}
+			v.counts[rule.name]++
+			ph := fmt.Sprintf("[%s_%d]", strings.ToUpper(rule.name), v.counts[rule.name])
+			v.byValue[value] = ph
+			v.pairs = append(v.pairs, ph, value)
+			return ph
+		})
+	}
+	return text
+}
+
+// Len 已替换的不同敏感值数量
+func (v *PIIVault) Len() int {
+	if v == nil {
+		return 0
+	}
+	return len(v.byValue)
+}
+
+// Restore 把占位符还原为原文
+func (v *PIIVault) Restore(text string) string {
+	if v == nil || len(v.pairs) == 0 {
+		return text
+	}
+	return strings.NewReplacer(v.pairs...).Replace(text)
+}
+
+// RedactRequest 返回消息与工具调用参数均已脱敏的请求副本
+func (v *PIIVault) RedactRequest(req LLMRequest) LLMRequest {
+	if v == nil {
+		return req
+	}
+	msgs := make([]Message, len(req.Messages))
+	for i, m := range req.Messages {
+		m.Content = v.Redact(m.Content)
+		if len(m.ToolCalls) > 0 {
+			calls := make([]LLMToolCall, len(m.ToolCalls))
+			for j, c := range m.ToolCalls {
+				c.Function.Arguments = v.Redact(c.Function.Arguments)
+				calls[j] = c
+			}
+			m.ToolCalls = calls
+		}
+		msgs[i] = m
+	}
+	req.Messages = msgs
+	return req
+}
+
+// RestoreResponse 还原回复文本与工具调用参数（工具按原文执行）
+func (v *PIIVault) RestoreResponse(resp *LLMResponse) {
+	if v == nil || resp == nil {
+		return
+	}
+	resp.Content = v.Restore(resp.Content)
+	for i := range resp.ToolCalls {
+		resp.ToolCalls[i].Function.Arguments = v.Restore(resp.ToolCalls[i].Function.Arguments)
+	}
+}
+
+// maxPlaceholderLen 流式还原时最多暂存的未闭合占位符长度
+const maxPlaceholderLen = 48
+
+// StreamRestorer 包装增量回调：占位符可能被拆分到多个增量中，未闭合的 "[..." 暂存到下一个增量；
+// 生成结束后调用 flush 输出剩余内容
+func (v *PIIVault) StreamRestorer(onDelta func(string)) (func(string), func()) {
+	if v == nil || onDelta == nil {
+		return onDelta, func() {}
+	}
+	var pending string
+	emit := func(s string) {
+		if s != "" {
+			onDelta(v.Restore(s))
+		}
+	}
+	push := func(delta string) {
+		pending += delta
+		cut := len(pending)
+		if i := strings.LastIndexByte(pending, '['); i >= 0 && !strings.Contains(pending[i:], "]") && len(pending)-i < maxPlaceholderLen {
+			cut = i
+		}
+		emit(pending[:cut])
+		pending = pending[cut:]
+	}
+	flush := func() {
+		emit(pending)
+		pending = ""
+	}
+	return push, flush
+}
+
+// RegisterMessageRedaction 写入 messages 表前对 Content 做不可逆脱敏（合规要求不落库原文时启用）
+func (r *PIIRedactor) RegisterMessageRedaction(db *gorm.DB) error {
+	return db.Callback().Create().Before("gorm:create").Register("servify:redact_message_content", func(tx *gorm.DB) {
+		if tx.Statement.Schema == nil || tx.Statement.Schema.Table != "messages" {
+			return
+		}
+		field := tx.Statement.Schema.LookUpField("Content")
+		if field == nil {
+			return
+		}
+		ctx := tx.Statement.Context
+		mask := func(rv reflect.Value) {
+			if v, zero := field.ValueOf(ctx, rv); !zero {
+				if s, ok := v.(string); ok {
+					_ = field.Set(ctx, rv, r.Mask(s))
+				}
+			}
+		}
+		switch rv := tx.Statement.ReflectValue; rv.Kind() {
+		case reflect.Slice, reflect.Array:
+			for i := 0; i < rv.Len(); i++ {
+				mask(reflect.Indirect(rv.Index(i)))
+			}
+		case reflect.Struct:
+			mask(rv)
+		}
+	})
+}
+
+func isASCIIDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+// luhnValid 银行卡号 Luhn 校验（忽略空格与连字符）
+func luhnValid(s string) bool {
+	digits := strings.NewReplacer(" ", "", "-", "").Replace(s)
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+	sum := 0
+	for i := 0; i < len(digits); i++ {
+		d := int(digits[len(digits)-1-i] - '0')
+		if i%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+// validIDCard 18 位身份证校验码（GB 11643）
+func validIDCard(s string) bool {
+	weights := []int{7, 9, 10, 5, 8, 4, 2, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2}
+	sum := 0
+	for i, w := range weights {
+		sum += int(s[i]-'0') * w
+	}
+	return "10X98765432"[sum%11] == strings.ToUpper(s[17:])[0]
+}
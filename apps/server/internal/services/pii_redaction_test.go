@@ -0,0 +1,131 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"servify/apps/server/internal/models"
+)
+
+func newTestRedactor(t *testing.T, cfg PIIRedactionConfig) *PIIRedactor {
+	t.Helper()
+	r, err := NewPIIRedactor(cfg)
+	if err != nil {
+		t.Fatalf("new redactor: %v", err)
+	}
+	return r
+}
+
+func TestPIIVault_RedactAndRestore(t *testing.T) {
+	r := newTestRedactor(t, PIIRedactionConfig{Custom: []PIIPattern{{Name: "order_no", Pattern: `SO\d{6}`}}})
+	text := "手机 13812345678，邮箱 alice@example.com，身份证 11010519491231002X，卡号 4111 1111 1111 1111，订单 SO123456，再打 138-1234-5678 或 13812345678"
+	v := r.NewVault()
+	out := v.Redact(text)
+	for _, raw := range []string{"13812345678", "alice@example.com", "11010519491231002X", "4111 1111 1111 1111", "SO123456", "138-1234-5678"} {
+		if strings.Contains(out, raw) {
+			t.Fatalf("%q not redacted: %s", raw, out)
+		}
+	}
+	for _, ph := range []string{"[PHONE_1]", "[PHONE_2]", "[EMAIL_1]", "[ID_CARD_1]", "[BANK_CARD_1]", "[ORDER_NO_1]"} {
+		if !strings.Contains(out, ph) {
+			t.Fatalf("missing %s: %s", ph, out)
+		}
+	}
+	// 同一原文复用占位符
+	if strings.Count(out, "[PHONE_1]") != 2 || v.Len() != 6 {
+		t.Fatalf("placeholders = %s (%d)", out, v.Len())
+	}
+	if got := v.Restore(out); got != text {
+		t.Fatalf("restore = %s", got)
+	}
+
+	// 未通过校验或嵌在更长数字串中的不替换
+	for _, keep := range []string{"卡号 4111 1111 1111 1112", "单号 2024013812345678901", "身份证 110105194912310021"} {
+		if got := r.NewVault().Redact(keep); got != keep {
+			t.Fatalf("should keep %q, got %q", keep, got)
+		}
+	}
+	if got := r.Mask("call 13812345678"); got != "call [PHONE]" {
+		t.Fatalf("mask = %s", got)
+	}
+	if _, err := NewPIIRedactor(PIIRedactionConfig{Types: []string{"ssn"}}); err == nil {
+		t.Fatal("unknown type should fail")
+	}
+}
+
+func TestPIIVault_StreamRestorer(t *testing.T) {
+	v := newTestRedactor(t, PIIRedactionConfig{}).NewVault()
+	v.Redact("13812345678")
+	var got []string
+	push, flush := v.StreamRestorer(func(d string) { got = append(got, d) })
+	for _, d := range []string{"已记录 [PHO", "NE_1", "]，[注意", "] 末尾 ["} {
+		push(d)
+	}
+	flush()
+	if strings.Join(got, "") != "已记录 13812345678，[注意] 末尾 [" {
+		t.Fatalf("deltas = %q", got)
+	}
+}
+
+func TestAIService_RedactsOutboundAndRestoresAnswer(t *testing.T) {
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req OpenAIRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		raw, _ := json.Marshal(req.Messages)
+		bodies = append(bodies, string(raw))
+		if req.Stream {
+			fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"已发送至 [EMA\"}}]}\n\ndata: {\"choices\":[{\"delta\":{\"content\":\"IL_1]\"}}]}\n\ndata: [DONE]\n\n")
+			return
+		}
+		fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"我们会致电 [PHONE_1]"}}]}`)
+	}))
+	defer srv.Close()
+
+	s := NewAIService("sk", srv.URL)
+	s.SetRedactor(newTestRedactor(t, PIIRedactionConfig{}))
+	ctx := context.Background()
+
+	resp, err := s.ProcessQuery(ctx, "请打我电话 13812345678", "")
+	if err != nil || resp.Content != "我们会致电 13812345678" {
+		t.Fatalf("answer = %+v %v", resp, err)
+	}
+	var deltas strings.Builder
+	resp, err = s.ProcessQueryStream(ctx, "发到 bob@example.com", "", func(d string) { deltas.WriteString(d) })
+	if err != nil || resp.Content != "已发送至 bob@example.com" || deltas.String() != resp.Content {
+		t.Fatalf("stream = %+v %q %v", resp, deltas.String(), err)
+	}
+	for _, b := range bodies {
+		if strings.Contains(b, "13812345678") || strings.Contains(b, "bob@example.com") {
+			t.Fatalf("raw PII sent to provider: %s", b)
+		}
+	}
+}
+
+func TestPIIRedactor_RegisterMessageRedaction(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:pii_redaction_"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Message{}); err != nil {
+		t.Fatalf("auto migrate: %v", err)
+	}
+	if err := newTestRedactor(t, PIIRedactionConfig{Types: []string{PIIPhone}}).RegisterMessageRedaction(db); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	db.Create(&models.Message{SessionID: "s1", Content: "我的电话 13812345678", Sender: "user"})
+	db.Create([]models.Message{{SessionID: "s1", Content: "备用 13900001111", Sender: "user"}})
+	var rows []models.Message
+	db.Order("id").Find(&rows)
+	if len(rows) != 2 || rows[0].Content != "我的电话 [PHONE]" || rows[1].Content != "备用 [PHONE]" {
+		t.Fatalf("stored = %+v", rows)
+	}
+}
@@ -0,0 +1,505 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"servify/apps/server/internal/models"
+)
+
+// 提示词模板名称
+const (
+	PromptAnswer         = "answer"          // 标准 AI 回答
+	PromptAnswerEnhanced = "answer_enhanced" // 增强（WeKnora 检索）回答
+	PromptDraft          = "draft"           // 坐席回复草稿（资料带编号供引用）
+)
+
+// PromptTemplateConfig 品牌与语言设置（取自 portal 配置）
+type PromptTemplateConfig struct {
+	BrandName     string
+	DefaultLocale string
+	Locales       []string // 允许的语言；为空表示不限制
+}
+
+// PromptDoc 模板中的检索文档
+type PromptDoc struct {
+	Title   string
+	Content string
+}
+
+// PromptVars 模板可用变量：{{.BrandName}} {{.Locale}} {{.Language}} {{.CustomerTier}} {{range .Docs}}{{.Title}} {{.Content}}{{end}}
+type PromptVars struct {
+	BrandName    string
+	Locale       string
+	Language     string // 回答语言名称，如 中文、English
+	CustomerTier string // 客户等级（customers.priority），未知时为空
+	Docs         []PromptDoc
+}
+
+// PromptInput 渲染输入；Locale 为空时按问题内容检测
+type PromptInput struct {
+	Locale       string
+	SessionID    string
+	Query        string
+	CustomerTier string
+	Docs         []models.KnowledgeDoc
+	Content      string // 非空时使用该内容代替已存模板（预览草稿）
+}
+
+// RenderedPrompt 渲染结果及所用模板
+type RenderedPrompt struct {
+	Text       string `json:"text"`
+	Locale     string `json:"locale"`
+	Source     string `json:"source"` // stored, builtin, draft
+	TemplateID uint   `json:"template_id,omitempty"`
+	Version    int    `json:"version,omitempty"`
+}
+
+// PromptTemplateCreateRequest 新建模板版本
+type PromptTemplateCreateRequest struct {
+	Name     string `json:"name" binding:"required"`
+	Locale   string `json:"locale"`
+	Content  string `json:"content" binding:"required"`
+	Notes    string `json:"notes"`
+	Activate bool   `json:"activate"`
+}
+
+// PromptTemplateService 管理版本化的提示词模板并按语言渲染；db 为空时仅使用内置模板
+type PromptTemplateService struct {
+	db     *gorm.DB
+	cfg    PromptTemplateConfig
+	logger *logrus.Logger
+}
+
+// NewPromptTemplateService 创建提示词模板服务
+func NewPromptTemplateService(db *gorm.DB, cfg PromptTemplateConfig, logger *logrus.Logger) *PromptTemplateService {
+	if logger == nil {
+		logger = logrus.New()
+	}
+	if cfg.BrandName == "" {
+		cfg.BrandName = "Servify"
+	}
+	if cfg.DefaultLocale == "" {
+		cfg.DefaultLocale = "zh-CN"
+	}
+	return &PromptTemplateService{db: db, cfg: cfg, logger: logger}
+}
+
+// builtinPrompts 内置模板：中文模板用于 zh，其余语言使用英文模板并要求以 {{.Language}} 作答
+var builtinPrompts = map[string]map[string]string{
+	PromptAnswer: {
+		"zh": `{{if .Docs}}基于以下知识库内容回答问题：
+{{range .Docs}}- {{.Title}}: {{.Content}}
+{{end}}
+{{end}}你是 {{.BrandName}} 的智能客服助手，请根据用户的问题并结合此前的对话提供准确、友好的回答。{{if .CustomerTier}}当前客户等级：{{.CustomerTier}}。{{end}}
+
+请用{{.Language}}回答，保持专业和友好的语气。如果无法找到相关信息，请礼貌地说明。`,
+		"en": `{{if .Docs}}Answer using the following knowledge base content:
+{{range .Docs}}- {{.Title}}: {{.Content}}
+{{end}}
+{{end}}You are the customer support assistant for {{.BrandName}}. Use the user's question and the earlier conversation to give an accurate, friendly answer.{{if .CustomerTier}} Customer tier: {{.CustomerTier}}.{{end}}
+
+Reply in {{.Language}} with a professional, friendly tone. If you cannot find the relevant information, say so politely.`,
+	},
+	PromptAnswerEnhanced: {
+		"zh": `你是 {{.BrandName}} 智能客服助手，请根据以下知识库信息回答用户问题。
+
+{{if .Docs}}🔍 相关知识库信息：
+{{range $i, $d := .Docs}}{{inc $i}}. 📄 {{$d.Title}}
+   📝 {{$d.Content}}
+
+{{end}}{{else}}ℹ️ 注意：当前没有找到相关的知识库信息，请基于一般常识回答。
+
+{{end}}{{if .CustomerTier}}👤 客户等级：{{.CustomerTier}}
+
+{{end}}📋 回答要求：
+1. ✅ 优先基于知识库信息提供准确回答
+2. 🔍 如果知识库信息不足，请诚实说明并提供一般性建议
+3. 😊 保持友好、专业的语气
+4. 🆘 如果问题超出能力范围，建议转人工客服
+5. 🎯 回答要简洁明了，避免冗长
+6. 💬 结合此前的对话理解追问，请用{{.Language}}回答
+`,
+		"en": `You are the {{.BrandName}} support assistant. Answer the user's question based on the knowledge base information below.
+
+{{if .Docs}}Relevant knowledge base information:
+{{range $i, $d := .Docs}}{{inc $i}}. {{$d.Title}}
+   {{$d.Content}}
+
+{{end}}{{else}}Note: no relevant knowledge base information was found; answer from general knowledge.
+
+{{end}}{{if .CustomerTier}}Customer tier: {{.CustomerTier}}
+
+{{end}}Guidelines:
+1. Prefer the knowledge base information for accurate answers
+2. If the information is insufficient, say so honestly and offer general advice
+3. Keep a friendly, professional tone
+4. If the question is beyond your scope, suggest transferring to a human agent
+5. Be concise
+6. Use the earlier conversation to understand follow-up questions, and reply in {{.Language}}
+`,
+	},
+	PromptDraft: {
+		"zh": `你是 {{.BrandName}} 的客服坐席助手，请为坐席起草一条发给客户的回复。
+{{if .Docs}}
+可参考以下资料（知识库文档与已解决的相似工单），使用其中的信息时在句末标注对应编号，如 [1]：
+{{range $i, $d := .Docs}}[{{inc $i}}] {{$d.Title}}
+{{$d.Content}}
+
+{{end}}{{end}}{{if .CustomerTier}}客户等级：{{.CustomerTier}}
+{{end}}
+要求：
+1. 针对对话中客户最近的问题作答，不要编造资料中没有的政策、价格或承诺
+2. 资料不足时，说明需要向客户确认的信息
+3. 语气专业、友好，用{{.Language}}撰写
+4. 只输出回复正文`,
+		"en": `You are the agent assistant for {{.BrandName}} support. Draft a reply the agent can send to the customer.
+{{if .Docs}}
+Reference material (knowledge base articles and similar resolved tickets). When you use information from an item, cite its number at the end of the sentence, e.g. [1]:
+{{range $i, $d := .Docs}}[{{inc $i}}] {{$d.Title}}
+{{$d.Content}}
+
+{{end}}{{end}}{{if .CustomerTier}}Customer tier: {{.CustomerTier}}
+{{end}}
+Guidelines:
+1. Address the customer's latest question in the conversation; do not invent policies, prices or commitments not found in the material
+2. If the material is insufficient, state what needs to be confirmed with the customer
+3. Keep a professional, friendly tone and write in {{.Language}}
+4. Output only the reply text`,
+	},
+}
+
+var promptFuncs = template.FuncMap{"inc": func(i int) int { return i + 1 }}
+
+// languageNames 回答语言名称（按语言子标签）
+var languageNames = map[string]string{
+	"zh": "中文",
+	"en": "English",
+	"ja": "日本語",
+	"ko": "한국어",
+	"es": "Español",
+	"fr": "Français",
+	"de": "Deutsch",
+	"pt": "Português",
+	"ru": "Русский",
+}
+
+func localeLanguage(locale string) string {
+	lang, _, _ := strings.Cut(strings.ReplaceAll(locale, "_", "-"), "-")
+	return strings.ToLower(lang)
+}
+
+// detectLanguage 按文字类型粗略判断问题语言；无法判断时返回空
+func detectLanguage(text string) string {
+	var han, kana, hangul, latin int
+	for _, r := range text {
+		switch {
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+			kana++
+		case unicode.Is(unicode.Hangul, r):
+			hangul++
+		case unicode.Is(unicode.Han, r):
+			han++
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		}
+	}
+	switch {
+	case kana > 0:
+		return "ja"
+	case hangul > 0:
+		return "ko"
+	case han > 0:
+		return "zh"
+	case latin > 0:
+		return "en"
+	}
+	return ""
+}
+
+// ResolveLocale 选择回答语言：显式指定 > 问题内容检测 > 默认语言，结果限定在 portal.locales 内
+func (s *PromptTemplateService) ResolveLocale(preferred, query string) string {
+	for _, candidate := range []string{preferred, detectLanguage(query)} {
+		if candidate == "" {
+			continue
+		}
+		if locale, ok := s.allowedLocale(candidate); ok {
+			return locale
+		}
+	}
+	return s.cfg.DefaultLocale
+}
+
+// allowedLocale 精确匹配优先，其次按语言子标签匹配（en -> en-US）
+func (s *PromptTemplateService) allowedLocale(candidate string) (string, bool) {
+	if len(s.cfg.Locales) == 0 {
+		return candidate, true
+	}
+	for _, l := range s.cfg.Locales {
+		if strings.EqualFold(l, candidate) {
+			return l, true
+		}
+	}
+	lang := localeLanguage(candidate)
+	for _, l := range s.cfg.Locales {
+		if localeLanguage(l) == lang {
+			return l, true
+		}
+	}
+	return "", false
+}
+
+// Render 渲染指定名称的系统提示词
+func (s *PromptTemplateService) Render(ctx context.Context, name string, in PromptInput) (*RenderedPrompt, error) {
+	locale := s.ResolveLocale(in.Locale, in.Query)
+	vars := PromptVars{
+		BrandName:    s.cfg.BrandName,
+		Locale:       locale,
+		Language:     languageNames[localeLanguage(locale)],
+		CustomerTier: in.CustomerTier,
+	}
+	if vars.Language == "" {
+		vars.Language = locale
+	}
+	if vars.CustomerTier == "" {
+		vars.CustomerTier = s.customerTier(ctx, in.SessionID)
+	}
+	for _, d := range in.Docs {
+		vars.Docs = append(vars.Docs, PromptDoc{Title: d.Title, Content: d.Content})
+	}
+
+	if in.Content != "" {
+		text, err := executePrompt(in.Content, vars)
+		if err != nil {
+			return nil, err
+		}
+		return &RenderedPrompt{Text: text, Locale: locale, Source: "draft"}, nil
+	}
+
+	if tpl := s.activeTemplate(ctx, name, locale); tpl != nil {
+		text, err := executePrompt(tpl.Content, vars)
+		if err == nil {
+			return &RenderedPrompt{Text: text, Locale: locale, Source: "stored", TemplateID: tpl.ID, Version: tpl.Version}, nil
+		}
+		s.logger.Warnf("prompt template %s v%d failed to render, using builtin: %v", tpl.Name, tpl.Version, err)
+	}
+
+	builtin, ok := builtinPrompts[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown prompt template: %s", name)
+	}
+	content, ok := builtin[localeLanguage(locale)]
+	if !ok {
+		content = builtin["en"]
+	}
+	text, err := executePrompt(content, vars)
+	if err != nil {
+		return nil, err
+	}
+	return &RenderedPrompt{Text: text, Locale: locale, Source: "builtin"}, nil
+}
+
+func executePrompt(content string, vars PromptVars) (string, error) {
+	tpl, err := template.New("prompt").Funcs(promptFuncs).Parse(content)
+	if err != nil {
+		return "", fmt.Errorf("invalid template: %w", err)
+	}
+	var b strings.Builder
+	if err := tpl.Execute(&b, vars); err != nil {
+		return "", fmt.Errorf("render template: %w", err)
+	}
+	return b.String(), nil
+}
+
+// activeTemplate 激活版本查找顺序：精确语言 > 同语言子标签 > 通用（locale 为空）
+func (s *PromptTemplateService) activeTemplate(ctx context.Context, name, locale string) *models.PromptTemplate {
+	if s.db == nil {
+		return nil
+	}
+	var rows []models.PromptTemplate
+	if err := s.db.WithContext(ctx).Where("name = ? AND active = ?", name, true).Find(&rows).Error; err != nil {
+		s.logger.Warnf("load prompt templates: %v", err)
+		return nil
+	}
+	var byLang, generic *models.PromptTemplate
+	for i := range rows {
+		row := &rows[i]
+		switch {
+		case strings.EqualFold(row.Locale, locale):
+			return row
+		case row.Locale == "":
+			generic = row
+		case byLang == nil && localeLanguage(row.Locale) == localeLanguage(locale):
+			byLang = row
+		}
+	}
+	if byLang != nil {
+		return byLang
+	}
+	return generic
+}
+
+// customerTier 会话客户的等级（customers.priority）
+func (s *PromptTemplateService) customerTier(ctx context.Context, sessionID string) string {
+	if s.db == nil || sessionID == "" {
+		return ""
+	}
+	var tier string
+	err := s.db.WithContext(ctx).Table("customers").
+		Select("customers.priority").
+		Joins("JOIN sessions ON sessions.user_id = customers.user_id").
+		Where("sessions.id = ? AND customers.deleted_at IS NULL", sessionID).
+		Limit(1).
+		Scan(&tier).Error
+	if err != nil {
+		return ""
+	}
+	return tier
+}
+
+// List 模板版本列表，可按名称与语言筛选
+func (s *PromptTemplateService) List(ctx context.Context, name, locale string) ([]models.PromptTemplate, error) {
+	if s.db == nil {
+		return nil, errors.New("prompt template storage unavailable")
+	}
+	q := s.db.WithContext(ctx).Model(&models.PromptTemplate{})
+	if name != "" {
+		q = q.Where("name = ?", name)
+	}
+	if locale != "" {
+		q = q.Where("locale = ?", locale)
+	}
+	var rows []models.PromptTemplate
+	if err := q.Order("name, locale, version DESC").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// Get 获取单个模板版本
+func (s *PromptTemplateService) Get(ctx context.Context, id uint) (*models.PromptTemplate, error) {
+	if s.db == nil {
+		return nil, errors.New("prompt template storage unavailable")
+	}
+	var row models.PromptTemplate
+	if err := s.db.WithContext(ctx).First(&row, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("prompt template not found")
+		}
+		return nil, err
+	}
+	return &row, nil
+}
+
+// Create 保存新版本（版本号自增）；模板须能以示例变量渲染
+func (s *PromptTemplateService) Create(ctx context.Context, req *PromptTemplateCreateRequest, userID uint) (*models.PromptTemplate, error) {
+	if s.db == nil {
+		return nil, errors.New("prompt template storage unavailable")
+	}
+	if req == nil || strings.TrimSpace(req.Name) == "" || strings.TrimSpace(req.Content) == "" {
+		return nil, errors.New("name and content required")
+	}
+	sample := PromptVars{BrandName: s.cfg.BrandName, Locale: req.Locale, Language: "English", CustomerTier: "normal", Docs: []PromptDoc{{Title: "t", Content: "c"}}}
+	if _, err := executePrompt(req.Content, sample); err != nil {
+		return nil, err
+	}
+
+	row := &models.PromptTemplate{
+		Name:      strings.TrimSpace(req.Name),
+		Locale:    strings.TrimSpace(req.Locale),
+		Content:   req.Content,
+		Notes:     req.Notes,
+		CreatedBy: userID,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var latest int
+		if err := tx.Model(&models.PromptTemplate{}).
+			Where("name = ? AND locale = ?", row.Name, row.Locale).
+			Select("COALESCE(MAX(version), 0)").Scan(&latest).Error; err != nil {
+			return err
+		}
+		row.Version = latest + 1
+		if err := tx.Create(row).Error; err != nil {
+			return err
+		}
+		if req.Activate {
+			return activatePrompt(tx, row)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to save prompt template: %w", err)
+	}
+	return row, nil
+}
+
+// Activate 激活指定版本（同名同语言的其他版本自动停用），也用于回滚
+func (s *PromptTemplateService) Activate(ctx context.Context, id uint) (*models.PromptTemplate, error) {
+	row, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return activatePrompt(tx, row)
+	}); err != nil {
+		return nil, fmt.Errorf("failed to activate prompt template: %w", err)
+	}
+	return row, nil
+}
+
+// Deactivate 停用版本；无激活版本时回退到内置模板
+func (s *PromptTemplateService) Deactivate(ctx context.Context, id uint) (*models.PromptTemplate, error) {
+	row, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	row.Active = false
+	row.UpdatedAt = time.Now()
+	if err := s.db.WithContext(ctx).Model(row).Updates(map[string]interface{}{"active": false, "updated_at": row.UpdatedAt}).Error; err != nil {
+		return nil, err
+	}
+	return row, nil
+}
+
+func activatePrompt(tx *gorm.DB, row *models.PromptTemplate) error {
+	now := time.Now()
+	if err := tx.Model(&models.PromptTemplate{}).
+		Where("name = ? AND locale = ? AND id <> ?", row.Name, row.Locale, row.ID).
+		Updates(map[string]interface{}{"active": false, "updated_at": now}).Error; err != nil {
+		return err
+	}
+	row.Active = true
+	row.UpdatedAt = now
+	return tx.Model(row).Updates(map[string]interface{}{"active": true, "updated_at": now}).Error
+}
+
+// PromptPreviewRequest 管理端预览：以示例问题渲染提示词；Content 非空时预览未保存的草稿
+type PromptPreviewRequest struct {
+	Name         string `json:"name"`
+	Locale       string `json:"locale"`
+	Content      string `json:"content"`
+	Query        string `json:"query" binding:"required"`
+	SessionID    string `json:"session_id"`
+	CustomerTier string `json:"customer_tier"`
+}
+
+// PromptPreview 预览结果：渲染后的系统提示及实际发送给模型的完整对话
+type PromptPreview struct {
+	Prompt   *RenderedPrompt `json:"prompt"`
+	Messages []Message       `json:"messages"`
+}
+
+// PromptPreviewer 支持提示词预览的 AI 服务
+type PromptPreviewer interface {
+	PreviewPrompt(ctx context.Context, req PromptPreviewRequest) (*PromptPreview, error)
+}
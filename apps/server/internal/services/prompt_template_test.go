@@ -0,0 +1,115 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"servify/apps/server/internal/models"
+)
+
+func newPromptTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:prompt_"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.PromptTemplate{}, &models.Session{}, &models.Customer{}); err != nil {
+		t.Fatalf("automigrate: %v", err)
+	}
+	return db
+}
+
+func TestPromptTemplateService_ResolveLocale(t *testing.T) {
+	svc := NewPromptTemplateService(nil, PromptTemplateConfig{DefaultLocale: "zh-CN", Locales: []string{"zh-CN", "en-US"}}, nil)
+	cases := []struct{ preferred, query, want string }{
+		{"", "How much is the pro plan?", "en-US"},
+		{"", "专业版多少钱？", "zh-CN"},
+		{"", "プロプランはいくらですか", "zh-CN"}, // ja 不在允许列表
+		{"en", "专业版多少钱？", "en-US"},
+		{"", "123", "zh-CN"},
+	}
+	for _, c := range cases {
+		if got := svc.ResolveLocale(c.preferred, c.query); got != c.want {
+			t.Errorf("ResolveLocale(%q, %q) = %s, want %s", c.preferred, c.query, got, c.want)
+		}
+	}
+}
+
+func TestPromptTemplateService_BuiltinFollowsLanguage(t *testing.T) {
+	svc := NewPromptTemplateService(nil, PromptTemplateConfig{BrandName: "Acme"}, nil)
+	docs := []models.KnowledgeDoc{{Title: "Pricing", Content: "Pro is $20"}}
+
+	en, err := svc.Render(context.Background(), PromptAnswer, PromptInput{Query: "How much is Pro?", Docs: docs})
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	if en.Source != "builtin" || !strings.Contains(en.Text, "Reply in English") || !strings.Contains(en.Text, "Acme") || !strings.Contains(en.Text, "Pro is $20") {
+		t.Fatalf("english prompt = %+v", en)
+	}
+	if strings.Contains(en.Text, "中文") {
+		t.Fatalf("english prompt should not ask for Chinese: %s", en.Text)
+	}
+
+	ja, _ := svc.Render(context.Background(), PromptAnswerEnhanced, PromptInput{Query: "料金はいくらですか"})
+	if ja.Locale != "ja" || !strings.Contains(ja.Text, "reply in 日本語") {
+		t.Fatalf("japanese prompt = %+v", ja)
+	}
+}
+
+func TestPromptTemplateService_VersionsAndActivation(t *testing.T) {
+	db := newPromptTestDB(t)
+	svc := NewPromptTemplateService(db, PromptTemplateConfig{BrandName: "Acme", Locales: []string{"zh-CN", "en-US"}}, nil)
+	ctx := context.Background()
+
+	if _, err := svc.Create(ctx, &PromptTemplateCreateRequest{Name: PromptAnswer, Locale: "en-US", Content: "{{.Nope}}"}, 1); err == nil {
+		t.Fatal("template with unknown variable should be rejected")
+	}
+	v1, err := svc.Create(ctx, &PromptTemplateCreateRequest{Name: PromptAnswer, Locale: "en-US", Content: "v1 {{.BrandName}} tier={{.CustomerTier}}", Activate: true}, 1)
+	if err != nil {
+		t.Fatalf("create v1: %v", err)
+	}
+	v2, err := svc.Create(ctx, &PromptTemplateCreateRequest{Name: PromptAnswer, Locale: "en-US", Content: "v2 {{.Language}}", Activate: true}, 1)
+	if err != nil || v2.Version != 2 {
+		t.Fatalf("create v2: %+v %v", v2, err)
+	}
+
+	// 客户等级取自会话所属客户
+	db.Create(&models.Session{ID: "s1", UserID: 42, Status: "active", Platform: "web"})
+	db.Create(&models.Customer{UserID: 42, Priority: "vip"})
+
+	got, err := svc.Render(ctx, PromptAnswer, PromptInput{Query: "hello", SessionID: "s1"})
+	if err != nil || got.Text != "v2 English" || got.TemplateID != v2.ID {
+		t.Fatalf("active v2 = %+v %v", got, err)
+	}
+
+	// 回滚到 v1
+	if _, err := svc.Activate(ctx, v1.ID); err != nil {
+		t.Fatalf("activate: %v", err)
+	}
+	got, _ = svc.Render(ctx, PromptAnswer, PromptInput{Query: "hello", SessionID: "s1"})
+	if got.Text != "v1 Acme tier=vip" || got.Version != 1 {
+		t.Fatalf("after rollback = %+v", got)
+	}
+
+	// 中文问题不受英文模板影响
+	zh, _ := svc.Render(ctx, PromptAnswer, PromptInput{Query: "你好"})
+	if zh.Source != "builtin" || zh.Locale != "zh-CN" {
+		t.Fatalf("zh prompt = %+v", zh)
+	}
+
+	if _, err := svc.Deactivate(ctx, v1.ID); err != nil {
+		t.Fatalf("deactivate: %v", err)
+	}
+	got, _ = svc.Render(ctx, PromptAnswer, PromptInput{Query: "hello"})
+	if got.Source != "builtin" {
+		t.Fatalf("without active version should use builtin, got %+v", got)
+	}
+	rows, _ := svc.List(ctx, PromptAnswer, "en-US")
+	if len(rows) != 2 || rows[0].Version != 2 {
+		t.Fatalf("versions = %+v", rows)
+	}
+}
@@ -0,0 +1,280 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"servify/apps/server/internal/models"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// 会话参与方之间转发的状态事件（访客 ⇄ 负责坐席）
+const (
+	WSEventTyping   = "typing"   // 正在输入，不落库
+	WSEventRead     = "read"     // 已读到某条消息，按参与方持久化
+	WSEventPresence = "presence" // 参与方上线/离线
+)
+
+// presenceKey 参与方在线记录的键（与会话频道一起登记到总线）
+func presenceKey(sessionID, participant string) string {
+	return sessionID + "|" + participant
+}
+
+func parsePresenceKey(key string) (sessionID, participant string, ok bool) {
+	i := strings.LastIndex(key, "|")
+	if i <= 0 || i == len(key)-1 {
+		return "", "", false
+	}
+	return key[:i], key[i+1:], true
+}
+
+// participantRole 由参与方标识解析角色与用户 ID
+func participantRole(participant string) (string, uint) {
+	if strings.HasPrefix(participant, "agent:") {
+		id, _ := strconv.ParseUint(strings.TrimPrefix(participant, "agent:"), 10, 64)
+		return WSRoleAgent, uint(id)
+	}
+	return WSRoleVisitor, 0
+}
+
+// relayParticipantEvent 把 origin 参与方的状态事件发给会话内其他连接；toAgent 时同时推送到负责坐席的工作台
+func (h *WebSocketHub) relayParticipantEvent(sessionID, origin, eventType string, data map[string]interface{}, toAgent bool) {
+	h.SendToSession(sessionID, WebSocketMessage{Type: eventType, Data: data, Origin: origin})
+	if !toAgent {
+		return
+	}
+	h.mutex.RLock()
+	rt := h.agentRealtime
+	h.mutex.RUnlock()
+	if rt == nil {
+		return
+	}
+	if agentID := rt.assignedAgent(sessionID); agentID != 0 {
+		rt.push(AgentChannelID(agentID), eventType, data)
+	}
+}
+
+// sendToClient 仅向单个连接发送（连接已注销时丢弃）
+func (h *WebSocketHub) sendToClient(c *WebSocketClient, message WebSocketMessage) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	if _, ok := h.clients[c.ID]; !ok {
+		return
+	}
+	select {
+	case c.Send <- message:
+	default:
+	}
+}
+
+// onPresenceChanged 本实例上某参与方的首个连接建立/最后一个连接断开
+func (h *WebSocketHub) onPresenceChanged(key string, online bool) {
+	sessionID, participant, ok := parsePresenceKey(key)
+	if !ok {
+		return
+	}
+	if !online {
+		// 其他实例上仍有该参与方的连接时不广播离线
+		if nodes, err := h.SessionNodes(context.Background(), key); err == nil && len(nodes) > 0 {
+			return
+		}
+	}
+	role, userID := participantRole(participant)
+	h.relayParticipantEvent(sessionID, participant, WSEventPresence, map[string]interface{}{
+		"session_id":  sessionID,
+		"participant": participant,
+		"role":        role,
+		"user_id":     userID,
+		"online":      online,
+	}, role == WSRoleVisitor)
+}
+
+// sendPresenceSnapshot 新连接建立后告知对方参与方当前是否在线
+func (c *WebSocketClient) sendPresenceSnapshot() {
+	var counterparts []string
+	if c.Role == WSRoleAgent {
+		counterparts = []string{WSRoleVisitor}
+	} else {
+		c.Hub.mutex.RLock()
+		rt := c.Hub.agentRealtime
+		c.Hub.mutex.RUnlock()
+		if rt == nil {
+			return
+		}
+		agentID := rt.assignedAgent(c.SessionID)
+		if agentID == 0 {
+			return
+		}
+		counterparts = []string{AgentChannelID(agentID)}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, participant := range counterparts {
+		nodes, err := c.Hub.SessionNodes(ctx, presenceKey(c.SessionID, participant))
+		if err != nil {
+			continue
+		}
+		role, userID := participantRole(participant)
+		c.Hub.sendToClient(c, WebSocketMessage{
+			Type:      WSEventPresence,
+			SessionID: c.SessionID,
+			Data: map[string]interface{}{
+				"session_id":  c.SessionID,
+				"participant": participant,
+				"role":        role,
+				"user_id":     userID,
+				"online":      len(nodes) > 0,
+			},
+		})
+	}
+}
+
+// handleTyping 转发“正在输入”状态
+func (c *WebSocketClient) handleTyping(sessionID string, message WebSocketMessage) {
+	typing := true
+	if data, ok := message.Data.(map[string]interface{}); ok {
+		if v, ok := data["typing"].(bool); ok {
+			typing = v
+		}
+	}
+	c.Hub.relayParticipantEvent(sessionID, c.participant(), WSEventTyping, map[string]interface{}{
+		"session_id": sessionID,
+		"sender":     c.sender(),
+		"user_id":    c.UserID,
+		"typing":     typing,
+	}, c.Role != WSRoleAgent)
+}
+
+// handleRead 记录参与方已读位置（data.message_id）并通知对方
+func (c *WebSocketClient) handleRead(sessionID string, message WebSocketMessage) error {
+	var messageID uint
+	if data, ok := message.Data.(map[string]interface{}); ok {
+		if f, ok := data["message_id"].(float64); ok && f > 0 {
+			messageID = uint(f)
+		}
+	}
+	if messageID == 0 {
+		return fmt.Errorf("message_id required")
+	}
+	c.Hub.mutex.RLock()
+	db := c.Hub.db
+	c.Hub.mutex.RUnlock()
+	if db == nil {
+		return nil
+	}
+
+	cursor, advanced, err := markSessionRead(db, sessionID, c.participant(), c.UserID, messageID)
+	if err != nil {
+		return err
+	}
+	if !advanced {
+		return nil
+	}
+	if c.Role == WSRoleAgent {
+		recordFirstResponse(db, sessionID, c.UserID, *cursor.ReadAt)
+	}
+	c.Hub.relayParticipantEvent(sessionID, c.participant(), WSEventRead, map[string]interface{}{
+		"session_id": sessionID,
+		"reader":     c.sender(),
+		"user_id":    c.UserID,
+		"message_id": cursor.ReadMessageID,
+		"seq":        cursor.ReadSeq,
+		"read_at":    cursor.ReadAt,
+	}, true)
+	return nil
+}
+
+// markSessionRead 推进参与方的已读位置（只增不减），返回游标及是否有推进
+func markSessionRead(db *gorm.DB, sessionID, participant string, userID, messageID uint) (*models.SessionCursor, bool, error) {
+	var msg models.Message
+	if err := db.Select("id", "seq").Where("id = ? AND session_id = ?", messageID, sessionID).First(&msg).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, false, fmt.Errorf("message not found in session")
+		}
+		return nil, false, err
+	}
+
+	now := time.Now()
+	cursor := &models.SessionCursor{
+		SessionID:     sessionID,
+		Participant:   participant,
+		UserID:        userID,
+		ReadSeq:       msg.Seq,
+		ReadMessageID: msg.ID,
+		ReadAt:        &now,
+		UpdatedAt:     now,
+	}
+	advance := func() (bool, error) {
+		res := db.Model(&models.SessionCursor{}).
+			Where("session_id = ? AND participant = ? AND (read_seq < ? OR read_at IS NULL)", sessionID, participant, msg.Seq).
+			Updates(map[string]interface{}{
+				"read_seq":        msg.Seq,
+				"read_message_id": msg.ID,
+				"read_at":         now,
+				"updated_at":      now,
+			})
+		return res.RowsAffected > 0, res.Error
+	}
+
+	if ok, err := advance(); err != nil || ok {
+		return cursor, ok, err
+	}
+	var count int64
+	if err := db.Model(&models.SessionCursor{}).Where("session_id = ? AND participant = ?", sessionID, participant).Count(&count).Error; err != nil {
+		return nil, false, err
+	}
+	if count > 0 {
+		return cursor, false, nil // 已读位置不落后
+	}
+	if err := db.Create(cursor).Error; err != nil {
+		// 并发创建冲突时退回更新
+		ok, err := advance()
+		return cursor, ok, err
+	}
+	return cursor, true, nil
+}
+
+// recordFirstResponse 负责坐席首次读到会话消息时记录首次响应时长，并刷新该坐席的平均响应时间
+func recordFirstResponse(db *gorm.DB, sessionID string, agentID uint, readAt time.Time) {
+	var session models.Session
+	if err := db.Select("id", "agent_id", "started_at", "assigned_at", "agent_first_read_at").
+		First(&session, "id = ?", sessionID).Error; err != nil {
+		return
+	}
+	if session.AgentID == nil || *session.AgentID != agentID || session.AgentFirstReadAt != nil {
+		return
+	}
+	from := session.StartedAt
+	if session.AssignedAt != nil {
+		from = *session.AssignedAt
+	}
+	secs := int(readAt.Sub(from).Seconds())
+	if secs < 0 {
+		secs = 0
+	}
+
+	res := db.Model(&models.Session{}).
+		Where("id = ? AND agent_first_read_at IS NULL", sessionID).
+		Updates(map[string]interface{}{"agent_first_read_at": readAt, "first_response_secs": secs})
+	if res.Error != nil || res.RowsAffected == 0 {
+		return
+	}
+
+	var avg sql.NullFloat64
+	if err := db.Model(&models.Session{}).
+		Where("agent_id = ? AND agent_first_read_at IS NOT NULL", agentID).
+		Select("AVG(first_response_secs)").Row().Scan(&avg); err != nil || !avg.Valid {
+		return
+	}
+	if err := db.Model(&models.Agent{}).Where("user_id = ?", agentID).
+		Update("avg_response_time", int(avg.Float64+0.5)).Error; err != nil {
+		logrus.Warnf("Failed to update avg response time for agent %d: %v", agentID, err)
+	}
+}
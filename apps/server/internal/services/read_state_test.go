@@ -0,0 +1,126 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"servify/apps/server/internal/models"
+)
+
+func newReadStateTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:read_state_"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Session{}, &models.Message{}, &models.SessionCursor{}, &models.Agent{}); err != nil {
+		t.Fatalf("automigrate: %v", err)
+	}
+	return db
+}
+
+func TestMarkSessionRead_UnreadAndFirstResponse(t *testing.T) {
+	db := newReadStateTestDB(t)
+	agentID := uint(7)
+	assignedAt := time.Now().Add(-2 * time.Minute)
+	db.Create(&models.Session{ID: "s1", AgentID: &agentID, Status: "active", Platform: "web", StartedAt: assignedAt.Add(-time.Hour), AssignedAt: &assignedAt})
+	db.Create(&models.Session{ID: "s2", Status: "active"})
+	db.Create(&models.Agent{UserID: agentID})
+	var msgs []*models.Message
+	for _, sender := range []string{"user", "user", "agent", "user"} {
+		m := &models.Message{SessionID: "s1", Content: "x", Sender: sender}
+		db.Create(m)
+		msgs = append(msgs, m)
+	}
+	other := &models.Message{SessionID: "s2", Content: "y", Sender: "user"}
+	db.Create(other)
+
+	participant := AgentChannelID(agentID)
+	if _, _, err := markSessionRead(db, "s1", participant, agentID, other.ID); err == nil {
+		t.Fatal("message from another session should be rejected")
+	}
+	cursor, advanced, err := markSessionRead(db, "s1", participant, agentID, msgs[1].ID)
+	if err != nil || !advanced || cursor.ReadSeq != 2 {
+		t.Fatalf("mark read: cursor=%+v advanced=%v err=%v", cursor, advanced, err)
+	}
+	if _, advanced, _ := markSessionRead(db, "s1", participant, agentID, msgs[0].ID); advanced {
+		t.Fatal("read position must not move backwards")
+	}
+
+	recordFirstResponse(db, "s1", agentID, *cursor.ReadAt)
+	var sess models.Session
+	db.First(&sess, "id = ?", "s1")
+	if sess.AgentFirstReadAt == nil || sess.FirstResponseSecs < 119 || sess.FirstResponseSecs > 121 {
+		t.Fatalf("first response = %v / %ds", sess.AgentFirstReadAt, sess.FirstResponseSecs)
+	}
+	var agent models.Agent
+	db.First(&agent, "user_id = ?", agentID)
+	if agent.AvgResponseTime != sess.FirstResponseSecs {
+		t.Fatalf("agent avg response = %d, want %d", agent.AvgResponseTime, sess.FirstResponseSecs)
+	}
+
+	unread, err := NewWorkspaceService(db, nil).GetUnreadCounts(context.Background(), agentID)
+	if err != nil {
+		t.Fatalf("unread: %v", err)
+	}
+	if len(unread) != 1 || unread[0].SessionID != "s1" || unread[0].Unread != 1 || unread[0].ReadSeq != 2 {
+		t.Fatalf("unread = %+v", unread)
+	}
+}
+
+func TestWebSocketHub_TypingReadAndPresenceRelay(t *testing.T) {
+	db := newReadStateTestDB(t)
+	agentID := uint(7)
+	db.Create(&models.Session{ID: "s1", AgentID: &agentID, Status: "active", Platform: "web"})
+	reply := &models.Message{SessionID: "s1", Content: "hello", Sender: "agent"}
+	db.Create(reply)
+
+	hub := NewWebSocketHub()
+	hub.SetDB(db)
+	hub.SetAgentRealtimeService(NewAgentRealtimeService(db, hub, logrus.New()))
+	go hub.Run()
+
+	workspace := newWorkspaceClient(hub, agentID)
+	visitor := &WebSocketClient{ID: "v", SessionID: "s1", Role: WSRoleVisitor, Send: make(chan WebSocketMessage, 16), Hub: hub}
+	hub.register <- visitor
+
+	expect := func(c *WebSocketClient, eventType string) map[string]interface{} {
+		t.Helper()
+		ev := nextEvent(t, c)
+		if ev.Type != eventType {
+			t.Fatalf("client %s got %s, want %s", c.ID, ev.Type, eventType)
+		}
+		return ev.Data.(map[string]interface{})
+	}
+
+	if data := expect(workspace, WSEventPresence); data["online"] != true || data["role"] != WSRoleVisitor {
+		t.Fatalf("presence = %+v", data)
+	}
+
+	visitor.handleTyping("s1", WebSocketMessage{Data: map[string]interface{}{"typing": true}})
+	if data := expect(workspace, WSEventTyping); data["sender"] != "user" || data["typing"] != true {
+		t.Fatalf("typing = %+v", data)
+	}
+
+	if err := visitor.handleRead("s1", WebSocketMessage{Data: map[string]interface{}{"message_id": float64(reply.ID)}}); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if data := expect(workspace, WSEventRead); data["reader"] != "user" || data["seq"] != int64(1) {
+		t.Fatalf("read = %+v", data)
+	}
+	noEvent(t, visitor) // 自己发起的状态事件不回显
+	var cursor models.SessionCursor
+	if err := db.First(&cursor, "session_id = ? AND participant = ?", "s1", WSRoleVisitor).Error; err != nil || cursor.ReadMessageID != reply.ID {
+		t.Fatalf("visitor cursor = %+v err=%v", cursor, err)
+	}
+
+	hub.unregister <- visitor
+	if data := expect(workspace, WSEventPresence); data["online"] != false {
+		t.Fatalf("presence = %+v", data)
+	}
+}
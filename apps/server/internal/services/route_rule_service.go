@@ -0,0 +1,350 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"servify/apps/server/internal/models"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// 路由动作
+const (
+	RouteActionAI     = "ai"     // AI 自动回复（默认）
+	RouteActionHuman  = "human"  // 转人工队列（可指定技能/优先级）
+	RouteActionManual = "manual" // 不经 AI，仅落库等待人工处理
+	RouteActionDrop   = "drop"   // 丢弃（垃圾消息），不落库不回复
+)
+
+// RouteActionParams 路由动作参数
+type RouteActionParams struct {
+	Skills   []string `json:"skills,omitempty"`
+	Priority string   `json:"priority,omitempty"`
+	Reply    string   `json:"reply,omitempty"` // 命中后回复给客户的提示语
+}
+
+// RouteRuleRequest 创建/更新路由规则的请求
+type RouteRuleRequest struct {
+	Name       string             `json:"name" binding:"required"`
+	Platform   string             `json:"platform"`
+	Conditions []TriggerCondition `json:"conditions"`
+	Action     string             `json:"action" binding:"required"`
+	Params     RouteActionParams  `json:"params"`
+	Priority   int                `json:"priority"`
+	Active     *bool              `json:"active"`
+}
+
+// RouteDecision 路由决策结果
+type RouteDecision struct {
+	Action     string                 `json:"action"`
+	Params     RouteActionParams      `json:"params"`
+	Rule       *models.RouteRule      `json:"rule,omitempty"` // 为空表示未命中任何规则，走默认动作
+	Attributes map[string]interface{} `json:"attributes"`
+}
+
+// RouteDryRunRequest 路由规则试运行请求
+type RouteDryRunRequest struct {
+	Platform  string                 `json:"platform" binding:"required"`
+	SessionID string                 `json:"session_id"`
+	Content   string                 `json:"content"`
+	Type      string                 `json:"type"`
+	Metadata  map[string]interface{} `json:"metadata"`
+}
+
+// RouteRuleService 管理消息路由规则并对消息做路由决策
+type RouteRuleService struct {
+	db     *gorm.DB
+	logger *logrus.Logger
+}
+
+// NewRouteRuleService 创建路由规则服务
+func NewRouteRuleService(db *gorm.DB, logger *logrus.Logger) *RouteRuleService {
+	if logger == nil {
+		logger = logrus.New()
+	}
+	return &RouteRuleService{db: db, logger: logger}
+}
+
+// ListRules 返回全部规则（按匹配顺序）
+func (s *RouteRuleService) ListRules(ctx context.Context) ([]models.RouteRule, error) {
+	var rules []models.RouteRule
+	if err := s.db.WithContext(ctx).Order("priority DESC, id ASC").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// CreateRule 新建规则
+func (s *RouteRuleService) CreateRule(ctx context.Context, req *RouteRuleRequest) (*models.RouteRule, error) {
+	rule := &models.RouteRule{CreatedAt: time.Now()}
+	if err := s.applyRequest(rule, req); err != nil {
+		return nil, err
+	}
+	active := rule.Active
+	if err := s.db.WithContext(ctx).Create(rule).Error; err != nil {
+		return nil, err
+	}
+	// Active 带默认值，false 需要显式写入
+	if !active {
+		if err := s.db.WithContext(ctx).Model(rule).Update("active", false).Error; err != nil {
+			return nil, err
+		}
+		rule.Active = false
+	}
+	return rule, nil
+}
+
+// UpdateRule 整体替换规则内容
+func (s *RouteRuleService) UpdateRule(ctx context.Context, id uint, req *RouteRuleRequest) (*models.RouteRule, error) {
+	var rule models.RouteRule
+	if err := s.db.WithContext(ctx).First(&rule, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("rule not found")
+		}
+		return nil, err
+	}
+	if err := s.applyRequest(&rule, req); err != nil {
+		return nil, err
+	}
+	if err := s.db.WithContext(ctx).Save(&rule).Error; err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// DeleteRule 删除规则
+func (s *RouteRuleService) DeleteRule(ctx context.Context, id uint) error {
+	result := s.db.WithContext(ctx).Delete(&models.RouteRule{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("rule not found")
+	}
+	return nil
+}
+
+func (s *RouteRuleService) applyRequest(rule *models.RouteRule, req *RouteRuleRequest) error {
+	if req == nil {
+		return fmt.Errorf("request required")
+	}
+	if !isSupportedRouteAction(req.Action) {
+		return fmt.Errorf("unsupported action: %s", req.Action)
+	}
+	for _, cond := range req.Conditions {
+		if err := validateRouteCondition(cond); err != nil {
+			return err
+		}
+	}
+
+	condJSON, err := json.Marshal(req.Conditions)
+	if err != nil {
+		return fmt.Errorf("invalid conditions: %w", err)
+	}
+	paramsJSON, err := json.Marshal(req.Params)
+	if err != nil {
+		return fmt.Errorf("invalid params: %w", err)
+	}
+
+	active := true
+	if req.Active != nil {
+		active = *req.Active
+	}
+
+	rule.Name = req.Name
+	rule.Platform = strings.TrimSpace(req.Platform)
+	rule.Conditions = string(condJSON)
+	rule.Action = req.Action
+	rule.Params = string(paramsJSON)
+	rule.Priority = req.Priority
+	rule.Active = active
+	rule.UpdatedAt = time.Now()
+	return nil
+}
+
+// Evaluate 对消息做路由决策；未命中任何规则时返回默认的 AI 动作
+func (s *RouteRuleService) Evaluate(ctx context.Context, platformID string, message UnifiedMessage) (*RouteDecision, error) {
+	attrs := s.buildAttributes(ctx, platformID, message)
+	decision := &RouteDecision{Action: RouteActionAI, Attributes: attrs}
+	if s.db == nil {
+		return decision, nil
+	}
+
+	var rules []models.RouteRule
+	if err := s.db.WithContext(ctx).
+		Where("active = ? AND (platform = '' OR platform IS NULL OR platform = ?)", true, platformID).
+		Order("priority DESC, id ASC").
+		Find(&rules).Error; err != nil {
+		return decision, fmt.Errorf("load route rules: %w", err)
+	}
+
+	for i := range rules {
+		rule := rules[i]
+		conds := []TriggerCondition{}
+		if rule.Conditions != "" {
+			if err := json.Unmarshal([]byte(rule.Conditions), &conds); err != nil {
+				s.logger.Warnf("routing: invalid conditions for %s: %v", rule.Name, err)
+				continue
+			}
+		}
+		matched := true
+		for _, cond := range conds {
+			if !matchRouteCondition(cond, attrs) {
+				matched = false
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+
+		var params RouteActionParams
+		if rule.Params != "" {
+			if err := json.Unmarshal([]byte(rule.Params), &params); err != nil {
+				s.logger.Warnf("routing: invalid params for %s: %v", rule.Name, err)
+			}
+		}
+		decision.Action = rule.Action
+		decision.Params = params
+		decision.Rule = &rule
+		return decision, nil
+	}
+	return decision, nil
+}
+
+// DryRun 用给定消息试运行规则集，不产生任何副作用
+func (s *RouteRuleService) DryRun(ctx context.Context, req *RouteDryRunRequest) (*RouteDecision, error) {
+	if req == nil {
+		return nil, fmt.Errorf("request required")
+	}
+	msgType := MessageType(req.Type)
+	if msgType == "" {
+		msgType = MessageTypeText
+	}
+	return s.Evaluate(ctx, req.Platform, UnifiedMessage{
+		PlatformID: req.Platform,
+		UserID:     req.SessionID,
+		Content:    req.Content,
+		Type:       msgType,
+		Timestamp:  time.Now(),
+		Metadata:   req.Metadata,
+	})
+}
+
+// buildAttributes 提取可用于条件匹配的字段
+func (s *RouteRuleService) buildAttributes(ctx context.Context, platformID string, message UnifiedMessage) map[string]interface{} {
+	attrs := map[string]interface{}{
+		"platform":        platformID,
+		"message.content": message.Content,
+		"message.type":    string(message.Type),
+		"intent":          classifyIntent(message.Content).Label,
+	}
+	for k, v := range message.Metadata {
+		attrs["metadata."+k] = v
+	}
+
+	if s.db == nil || message.UserID == "" {
+		return attrs
+	}
+	var session models.Session
+	if err := s.db.WithContext(ctx).Select("id", "user_id").First(&session, "id = ?", message.UserID).Error; err != nil || session.UserID == 0 {
+		return attrs
+	}
+	var customer models.Customer
+	if err := s.db.WithContext(ctx).Where("user_id = ?", session.UserID).First(&customer).Error; err == nil {
+		attrs["customer.priority"] = customer.Priority
+		attrs["customer.tags"] = customer.Tags
+		attrs["customer.company"] = customer.Company
+	}
+	return attrs
+}
+
+func isSupportedRouteAction(action string) bool {
+	switch action {
+	case RouteActionAI, RouteActionHuman, RouteActionManual, RouteActionDrop:
+		return true
+	default:
+		return false
+	}
+}
+
+func validateRouteCondition(cond TriggerCondition) error {
+	if strings.TrimSpace(cond.Field) == "" {
+		return fmt.Errorf("condition field required")
+	}
+	switch cond.Op {
+	case "eq", "neq", "contains", "contains_any", "in":
+		return nil
+	case "regex":
+		if _, err := regexp.Compile(fmt.Sprintf("%v", cond.Value)); err != nil {
+			return fmt.Errorf("invalid regex for %s: %w", cond.Field, err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported condition op: %s", cond.Op)
+	}
+}
+
+// matchRouteCondition 在 evaluateCondition 基础上支持关键词列表、集合与正则
+func matchRouteCondition(cond TriggerCondition, attrs map[string]interface{}) bool {
+	switch cond.Op {
+	case "contains_any", "in", "regex":
+	default:
+		return evaluateCondition(cond, attrs)
+	}
+
+	val, ok := attrs[cond.Field]
+	if !ok {
+		return false
+	}
+	actual := fmt.Sprintf("%v", val)
+
+	switch cond.Op {
+	case "contains_any":
+		lower := strings.ToLower(actual)
+		for _, kw := range conditionValues(cond.Value) {
+			if strings.Contains(lower, strings.ToLower(kw)) {
+				return true
+			}
+		}
+		return false
+	case "in":
+		for _, v := range conditionValues(cond.Value) {
+			if strings.EqualFold(actual, v) {
+				return true
+			}
+		}
+		return false
+	default:
+		re, err := regexp.Compile(fmt.Sprintf("%v", cond.Value))
+		return err == nil && re.MatchString(actual)
+	}
+}
+
+// conditionValues 条件值支持 JSON 数组或逗号分隔字符串
+func conditionValues(v interface{}) []string {
+	var out []string
+	switch vv := v.(type) {
+	case []interface{}:
+		for _, item := range vv {
+			out = append(out, fmt.Sprintf("%v", item))
+		}
+	case []string:
+		out = append(out, vv...)
+	default:
+		out = strings.Split(fmt.Sprintf("%v", vv), ",")
+	}
+	values := out[:0]
+	for _, s := range out {
+		if s = strings.TrimSpace(s); s != "" {
+			values = append(values, s)
+		}
+	}
+	return values
+}
@@ -0,0 +1,228 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"servify/apps/server/internal/models"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newRouteRuleTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := "file:route_rules_" + t.Name() + "?mode=memory&cache=shared"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(
+		&models.User{}, &models.Customer{}, &models.Session{}, &models.Message{},
+		&models.TransferRecord{}, &models.WaitingRecord{}, &models.RouteRule{},
+	); err != nil {
+		t.Fatalf("auto migrate: %v", err)
+	}
+	return db
+}
+
+func TestRouteRuleService_EvaluateOrderAndConditions(t *testing.T) {
+	db := newRouteRuleTestDB(t)
+	svc := NewRouteRuleService(db, logrus.New())
+	ctx := context.Background()
+
+	inactive := false
+	rules := []RouteRuleRequest{
+		{Name: "spam", Action: RouteActionDrop, Priority: 100, Conditions: []TriggerCondition{
+			{Field: "message.content", Op: "regex", Value: `(?i)https?://\S+\.(xyz|top)`},
+		}},
+		{Name: "vip", Action: RouteActionHuman, Priority: 50,
+			Conditions: []TriggerCondition{{Field: "customer.priority", Op: "in", Value: []interface{}{"high", "urgent"}}},
+			Params:     RouteActionParams{Skills: []string{"vip"}, Priority: "high"}},
+		{Name: "complaint", Action: RouteActionHuman, Priority: 10,
+			Conditions: []TriggerCondition{{Field: "intent", Op: "eq", Value: "complaint"}},
+			Params:     RouteActionParams{Skills: []string{"complaint"}}},
+		{Name: "refund-keywords", Action: RouteActionHuman, Priority: 10, Conditions: []TriggerCondition{
+			{Field: "message.content", Op: "contains_any", Value: "退款, Refund"},
+		}},
+		{Name: "wechat-manual", Platform: string(PlatformWeChat), Action: RouteActionManual},
+		{Name: "disabled", Action: RouteActionDrop, Priority: 1000, Active: &inactive},
+	}
+	for i := range rules {
+		if _, err := svc.CreateRule(ctx, &rules[i]); err != nil {
+			t.Fatalf("create rule %s: %v", rules[i].Name, err)
+		}
+	}
+
+	// VIP 客户：会话关联用户 -> 客户档案
+	user := &models.User{Username: "vip", Email: "vip@example.com"}
+	db.Create(user)
+	db.Create(&models.Customer{UserID: user.ID, Priority: "urgent"})
+	db.Create(&models.Session{ID: "vip-session", UserID: user.ID, Platform: "web"})
+
+	cases := []struct {
+		name     string
+		platform string
+		msg      UnifiedMessage
+		rule     string
+		action   string
+	}{
+		{"spam wins by priority", "web", UnifiedMessage{UserID: "vip-session", Content: "cheap http://x.xyz"}, "spam", RouteActionDrop},
+		{"vip customer", "web", UnifiedMessage{UserID: "vip-session", Content: "你好"}, "vip", RouteActionHuman},
+		{"intent", "telegram", UnifiedMessage{UserID: "s1", Content: "我要投诉你们"}, "complaint", RouteActionHuman},
+		{"keywords case-insensitive", "telegram", UnifiedMessage{UserID: "s1", Content: "REFUND please"}, "refund-keywords", RouteActionHuman},
+		{"platform scoped", "wechat", UnifiedMessage{UserID: "s2", Content: "在吗"}, "wechat-manual", RouteActionManual},
+		{"default to ai", "telegram", UnifiedMessage{UserID: "s3", Content: "在吗"}, "", RouteActionAI},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			d, err := svc.Evaluate(ctx, tc.platform, tc.msg)
+			if err != nil {
+				t.Fatalf("evaluate: %v", err)
+			}
+			if d.Action != tc.action {
+				t.Fatalf("action = %s, want %s", d.Action, tc.action)
+			}
+			got := ""
+			if d.Rule != nil {
+				got = d.Rule.Name
+			}
+			if got != tc.rule {
+				t.Fatalf("rule = %q, want %q", got, tc.rule)
+			}
+		})
+	}
+
+	d, _ := svc.Evaluate(ctx, "web", UnifiedMessage{UserID: "vip-session", Content: "hi"})
+	if len(d.Params.Skills) != 1 || d.Params.Skills[0] != "vip" || d.Params.Priority != "high" {
+		t.Fatalf("unexpected params: %+v", d.Params)
+	}
+}
+
+func TestRouteRuleService_ValidationAndDryRun(t *testing.T) {
+	db := newRouteRuleTestDB(t)
+	svc := NewRouteRuleService(db, logrus.New())
+	ctx := context.Background()
+
+	if _, err := svc.CreateRule(ctx, &RouteRuleRequest{Name: "bad", Action: "escalate"}); err == nil {
+		t.Fatal("expected unsupported action error")
+	}
+	if _, err := svc.CreateRule(ctx, &RouteRuleRequest{Name: "bad", Action: RouteActionDrop,
+		Conditions: []TriggerCondition{{Field: "message.content", Op: "regex", Value: "("}}}); err == nil {
+		t.Fatal("expected invalid regex error")
+	}
+
+	rule, err := svc.CreateRule(ctx, &RouteRuleRequest{Name: "tier", Action: RouteActionHuman,
+		Conditions: []TriggerCondition{{Field: "metadata.tier", Op: "eq", Value: "gold"}}})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	d, err := svc.DryRun(ctx, &RouteDryRunRequest{Platform: "telegram", Content: "hello", Metadata: map[string]interface{}{"tier": "gold"}})
+	if err != nil || d.Rule == nil || d.Rule.ID != rule.ID {
+		t.Fatalf("dry run should match tier rule: %+v err=%v", d, err)
+	}
+
+	// 更新后不再命中
+	if _, err := svc.UpdateRule(ctx, rule.ID, &RouteRuleRequest{Name: "tier", Action: RouteActionHuman,
+		Conditions: []TriggerCondition{{Field: "metadata.tier", Op: "eq", Value: "platinum"}}}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	d, _ = svc.DryRun(ctx, &RouteDryRunRequest{Platform: "telegram", Content: "hello", Metadata: map[string]interface{}{"tier": "gold"}})
+	if d.Rule != nil || d.Action != RouteActionAI {
+		t.Fatalf("expected default decision after update: %+v", d)
+	}
+
+	if err := svc.DeleteRule(ctx, rule.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if err := svc.DeleteRule(ctx, rule.ID); err == nil {
+		t.Fatal("expected not found on second delete")
+	}
+}
+
+// recordingAdapter 记录发送内容的平台适配器
+type recordingAdapter struct {
+	mu   sync.Mutex
+	sent []string
+}
+
+func (a *recordingAdapter) SendMessage(chatID, message string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.sent = append(a.sent, message)
+	return nil
+}
+func (a *recordingAdapter) ReceiveMessage() <-chan UnifiedMessage { return nil }
+func (a *recordingAdapter) GetPlatformType() PlatformType         { return PlatformTelegram }
+func (a *recordingAdapter) Start() error                          { return nil }
+func (a *recordingAdapter) Stop() error                           { return nil }
+
+func TestMessageRouter_RouteMessage_AppliesRules(t *testing.T) {
+	db := newRouteRuleTestDB(t)
+	ctx := context.Background()
+	rules := NewRouteRuleService(db, logrus.New())
+	hub := NewWebSocketHub()
+	go hub.Run()
+
+	r := NewMessageRouter(stubAI{reply: "ai"}, hub, db)
+	r.SetRouteRuleService(rules)
+	r.SetSessionTransferService(NewSessionTransferService(db, logrus.New(), stubAI{}, NewAgentService(db, logrus.New()), hub))
+	adapter := &recordingAdapter{}
+	r.RegisterPlatform(string(PlatformTelegram), adapter)
+
+	mustCreate := func(req RouteRuleRequest) {
+		if _, err := rules.CreateRule(ctx, &req); err != nil {
+			t.Fatalf("create rule: %v", err)
+		}
+	}
+	mustCreate(RouteRuleRequest{Name: "spam", Action: RouteActionDrop, Conditions: []TriggerCondition{{Field: "message.content", Op: "contains", Value: "加微信"}}})
+	mustCreate(RouteRuleRequest{Name: "human", Action: RouteActionHuman, Conditions: []TriggerCondition{{Field: "message.content", Op: "contains", Value: "人工"}},
+		Params: RouteActionParams{Skills: []string{"billing"}, Reply: "已为您转人工"}})
+
+	// 垃圾消息：不落库、不回复
+	if err := r.routeMessage(string(PlatformTelegram), UnifiedMessage{UserID: "tg-1", Content: "加微信领红包", Type: MessageTypeText, Timestamp: time.Now()}); err != nil {
+		t.Fatalf("route spam: %v", err)
+	}
+	var count int64
+	db.Model(&models.Message{}).Count(&count)
+	if count != 0 || len(adapter.sent) != 0 {
+		t.Fatalf("spam should be dropped: messages=%d sent=%v", count, adapter.sent)
+	}
+
+	// 转人工：进入等待队列（带技能），不调用 AI
+	if err := r.routeMessage(string(PlatformTelegram), UnifiedMessage{UserID: "tg-1", Content: "转人工", Type: MessageTypeText, Timestamp: time.Now()}); err != nil {
+		t.Fatalf("route human: %v", err)
+	}
+	var waiting models.WaitingRecord
+	if err := db.Where("session_id = ?", "tg-1").First(&waiting).Error; err != nil {
+		t.Fatalf("expected waiting record: %v", err)
+	}
+	if waiting.TargetSkills != "billing" || waiting.Reason != "routing_rule:human" {
+		t.Fatalf("unexpected waiting record: %+v", waiting)
+	}
+	if len(adapter.sent) != 1 || adapter.sent[0] != "已为您转人工" {
+		t.Fatalf("unexpected replies: %v", adapter.sent)
+	}
+
+	// 未命中规则：默认 AI 回复
+	if err := r.routeMessage(string(PlatformTelegram), UnifiedMessage{UserID: "tg-2", Content: "你好", Type: MessageTypeText, Timestamp: time.Now()}); err != nil {
+		t.Fatalf("route ai: %v", err)
+	}
+	if len(adapter.sent) != 2 || adapter.sent[1] != "ai:你好" {
+		t.Fatalf("expected AI reply: %v", adapter.sent)
+	}
+
+	// 会话已由人工接管：不再自动回复
+	agentID := uint(7)
+	db.Model(&models.Session{}).Where("id = ?", "tg-2").Update("agent_id", agentID)
+	if err := r.routeMessage(string(PlatformTelegram), UnifiedMessage{UserID: "tg-2", Content: "还在吗", Type: MessageTypeText, Timestamp: time.Now()}); err != nil {
+		t.Fatalf("route assigned: %v", err)
+	}
+	if len(adapter.sent) != 2 {
+		t.Fatalf("assigned session should not get AI reply: %v", adapter.sent)
+	}
+}
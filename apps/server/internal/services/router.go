@@ -17,6 +17,12 @@ type MessageRouter struct {
 	wsHub     *WebSocketHub
 	db        *gorm.DB
 	mutex     sync.RWMutex
+	// 可选：路由规则（未设置时所有消息走 AI）
+	rules *RouteRuleService
+	// 可选：用于执行“转人工”路由动作
+	transferService *SessionTransferService
+	// 可选：向坐席工作台推送已分配会话中的客户消息
+	agentRealtime *AgentRealtimeService
 }
 
 type PlatformAdapter interface {
@@ -27,6 +33,11 @@ type PlatformAdapter interface {
 	Stop() error
 }
 
+// AttachmentSender 可选扩展：支持发送图片/文件的平台适配器
+type AttachmentSender interface {
+	SendAttachment(chatID string, attachment Attachment) error
+}
+
 type PlatformType string
 
 const (
@@ -59,17 +70,11 @@ const (
 )
 
 type Attachment struct {
-	Type string `json:"type"`
-	URL  string `json:"url"`
-	Name string `json:"name"`
-	Size int64  `json:"size"`
-}
-
-type RouteRule struct {
-	Platform  PlatformType `json:"platform"`
-	Condition string       `json:"condition"`
-	Action    string       `json:"action"`
-	Priority  int          `json:"priority"`
+	Type   string `json:"type"`
+	URL    string `json:"url"`
+	FileID string `json:"file_id,omitempty"` // 平台侧文件标识（如 Telegram file_id），下载经服务端代理
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
 }
 
 func NewMessageRouter(aiService AIServiceInterface, wsHub *WebSocketHub, db *gorm.DB) *MessageRouter {
@@ -81,6 +86,27 @@ func NewMessageRouter(aiService AIServiceInterface, wsHub *WebSocketHub, db *gor
 	}
 }
 
+// SetRouteRuleService 注入路由规则服务（可选）
+func (r *MessageRouter) SetRouteRuleService(rules *RouteRuleService) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.rules = rules
+}
+
+// SetSessionTransferService 注入会话转接服务（可选）
+func (r *MessageRouter) SetSessionTransferService(svc *SessionTransferService) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.transferService = svc
+}
+
+// SetAgentRealtimeService 注入坐席工作台服务（可选）
+func (r *MessageRouter) SetAgentRealtimeService(svc *AgentRealtimeService) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.agentRealtime = svc
+}
+
 func (r *MessageRouter) RegisterPlatform(platformID string, adapter PlatformAdapter) {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
@@ -147,21 +173,170 @@ func (r *MessageRouter) routeMessage(platformID string, message UnifiedMessage)
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	// 1. 保存消息到数据库
-	if err := r.persistMessage(message); err != nil {
+	// 1. 按路由规则决定消息去向
+	decision := r.decide(ctx, platformID, message)
+	if decision.Action == RouteActionDrop {
+		logrus.WithFields(logrus.Fields{
+			"platform": platformID,
+			"user_id":  message.UserID,
+			"rule":     decision.Rule.Name,
+		}).Info("Message dropped by routing rule")
+		return nil
+	}
+
+	// 2. 保存消息到数据库
+	record, err := r.persistMessage(message)
+	if err != nil {
 		logrus.Warnf("Failed to persist message: %v", err)
 		// 不影响消息处理流程，继续执行
 	}
 
-	// 2. 如果是 Web 平台，直接通过 WebSocket 处理
+	// 3. 会话已由人工接管时不再自动回复（避免“人机抢答”），改为推送给负责坐席
+	if r.sessionAssigned(message.UserID) {
+		r.mutex.RLock()
+		rt := r.agentRealtime
+		r.mutex.RUnlock()
+		if rt != nil && record != nil {
+			rt.NotifySessionMessage(record)
+		}
+		return nil
+	}
+
+	switch decision.Action {
+	case RouteActionHuman:
+		return r.handleHumanRoute(ctx, platformID, message, decision)
+	case RouteActionManual:
+		return nil
+	default:
+		return r.handleAIRoute(ctx, platformID, message)
+	}
+}
+
+// decide 计算路由决策；规则服务不可用时退回 AI
+func (r *MessageRouter) decide(ctx context.Context, platformID string, message UnifiedMessage) *RouteDecision {
+	r.mutex.RLock()
+	rules := r.rules
+	r.mutex.RUnlock()
+	if rules == nil {
+		return &RouteDecision{Action: RouteActionAI}
+	}
+	decision, err := rules.Evaluate(ctx, platformID, message)
+	if err != nil {
+		logrus.Warnf("Failed to evaluate route rules: %v", err)
+	}
+	if decision.Rule != nil {
+		logrus.Debugf("Message from %s matched route rule %s (%s)", platformID, decision.Rule.Name, decision.Action)
+	}
+	return decision
+}
+
+// handleAIRoute AI 自动回复，按平台选择回复通道
+func (r *MessageRouter) handleAIRoute(ctx context.Context, platformID string, message UnifiedMessage) error {
 	if platformID == string(PlatformWeb) {
 		return r.handleWebMessage(ctx, message)
 	}
-
-	// 3. 其他平台的消息处理
 	return r.handleExternalPlatformMessage(ctx, platformID, message)
 }
 
+// handleHumanRoute 跳过 AI，将会话转入人工队列
+func (r *MessageRouter) handleHumanRoute(ctx context.Context, platformID string, message UnifiedMessage, decision *RouteDecision) error {
+	r.mutex.RLock()
+	transferSvc := r.transferService
+	r.mutex.RUnlock()
+	if transferSvc == nil || r.db == nil {
+		logrus.Warnf("Route to human requested for %s but transfer service not configured", message.UserID)
+		return nil
+	}
+
+	reason := "routing_rule"
+	if decision.Rule != nil {
+		reason = "routing_rule:" + decision.Rule.Name
+	}
+	result, err := transferSvc.TransferToHuman(ctx, &TransferRequest{
+		SessionID:    message.UserID,
+		Reason:       reason,
+		TargetSkills: decision.Params.Skills,
+		Priority:     decision.Params.Priority,
+	})
+	if err != nil {
+		return fmt.Errorf("transfer to human: %w", err)
+	}
+
+	reply := decision.Params.Reply
+	if reply == "" && platformID == string(PlatformWeb) {
+		return nil // 转接服务已通过 WebSocket 通知访客
+	}
+	if reply == "" {
+		reply = "正在为您转接人工客服，请稍等..."
+		if result.IsWaiting {
+			reply = "正在为您转接人工客服，当前暂无可用客服，已进入等待队列。"
+		}
+	}
+	return r.sendSystemReply(platformID, message.UserID, reply)
+}
+
+// sendSystemReply 向客户发送系统提示
+func (r *MessageRouter) sendSystemReply(platformID, sessionID, content string) error {
+	if platformID == string(PlatformWeb) {
+		r.wsHub.SendToSession(sessionID, WebSocketMessage{
+			Type: "ai-response",
+			Data: map[string]interface{}{
+				"content":    content,
+				"confidence": 1.0,
+				"source":     "system",
+			},
+			SessionID: sessionID,
+			Timestamp: time.Now(),
+		})
+		return nil
+	}
+	return r.deliverToPlatform(platformID, sessionID, content)
+}
+
+// deliverToPlatform 通过外部平台适配器发送文本（chatID 即会话标识）
+func (r *MessageRouter) deliverToPlatform(platformID, chatID, content string) error {
+	r.mutex.RLock()
+	adapter, exists := r.platforms[platformID]
+	r.mutex.RUnlock()
+	if !exists {
+		return fmt.Errorf("platform adapter not found: %s", platformID)
+	}
+	if err := adapter.SendMessage(chatID, content); err != nil {
+		return fmt.Errorf("failed to send message to platform %s: %w", platformID, err)
+	}
+	return nil
+}
+
+// deliverAttachment 通过外部平台适配器发送图片/文件，适配器需实现 AttachmentSender
+func (r *MessageRouter) deliverAttachment(platformID, chatID string, attachment Attachment) error {
+	r.mutex.RLock()
+	adapter, exists := r.platforms[platformID]
+	r.mutex.RUnlock()
+	if !exists {
+		return fmt.Errorf("platform adapter not found: %s", platformID)
+	}
+	sender, ok := adapter.(AttachmentSender)
+	if !ok {
+		return fmt.Errorf("platform %s does not support attachments", platformID)
+	}
+	if err := sender.SendAttachment(chatID, attachment); err != nil {
+		return fmt.Errorf("failed to send attachment to platform %s: %w", platformID, err)
+	}
+	return nil
+}
+
+// sessionAssigned 会话是否已分配人工客服
+func (r *MessageRouter) sessionAssigned(sessionID string) bool {
+	if r.db == nil || sessionID == "" {
+		return false
+	}
+	var sess models.Session
+	if err := r.db.Select("id", "agent_id", "status").First(&sess, "id = ?", sessionID).Error; err != nil {
+		return false
+	}
+	return sess.AgentID != nil && sess.Status != "ended"
+}
+
 func (r *MessageRouter) handleWebMessage(ctx context.Context, message UnifiedMessage) error {
 	// AI 处理消息
 	aiResponse, err := r.aiService.ProcessQuery(ctx, message.Content, message.UserID)
@@ -182,7 +357,7 @@ func (r *MessageRouter) handleWebMessage(ctx context.Context, message UnifiedMes
 		Timestamp: time.Now(),
 	}
 
-	r.wsHub.SendToSession(message.UserID, response)
+	r.wsHub.SendPersisted(message.UserID, &models.Message{Content: aiResponse.Content, Type: "text", Sender: "ai"}, response)
 	return nil
 }
 
@@ -240,7 +415,7 @@ func (r *MessageRouter) GetPlatformStats() map[string]interface{} {
 }
 
 // persistMessage 消息持久化
-func (r *MessageRouter) persistMessage(message UnifiedMessage) error {
+func (r *MessageRouter) persistMessage(message UnifiedMessage) (*models.Message, error) {
 	// 如果未配置数据库，回退为日志
 	if r.db == nil {
 		logrus.WithFields(logrus.Fields{
@@ -250,7 +425,7 @@ func (r *MessageRouter) persistMessage(message UnifiedMessage) error {
 			"type":        message.Type,
 			"timestamp":   message.Timestamp,
 		}).Info("Message persisted (log-only)")
-		return nil
+		return nil, nil
 	}
 
 	// 确保会话存在（以 message.UserID 作为会话标识；为空则创建新会话）
@@ -273,10 +448,10 @@ func (r *MessageRouter) persistMessage(message UnifiedMessage) error {
 	}
 
 	if err := r.db.Create(m).Error; err != nil {
-		return fmt.Errorf("persist message: %w", err)
+		return nil, fmt.Errorf("persist message: %w", err)
 	}
 	logrus.WithField("id", m.ID).Debug("Message stored")
-	return nil
+	return m, nil
 }
 
 // ensureSession 确保会话记录存在
@@ -304,229 +479,3 @@ func (r *MessageRouter) ensureSession(sessionID string, platform string) error {
 	}
 	return nil
 }
-
-// Telegram 适配器示例
-type TelegramAdapter struct {
-	botToken string
-	chatID   string
-	msgChan  chan UnifiedMessage
-	stopChan chan struct{}
-}
-
-func NewTelegramAdapter(botToken, chatID string) *TelegramAdapter {
-	return &TelegramAdapter{
-		botToken: botToken,
-		chatID:   chatID,
-		msgChan:  make(chan UnifiedMessage, 100),
-		stopChan: make(chan struct{}),
-	}
-}
-
-func (t *TelegramAdapter) SendMessage(chatID, message string) error {
-	// 实现 Telegram 消息发送
-	logrus.Infof("Sending Telegram message to %s: %s", chatID, message)
-
-	// 实际的 Telegram API 调用实现
-	// 这里需要使用 Telegram Bot API
-	// POST https://api.telegram.org/bot{token}/sendMessage
-	// 参数: chat_id, text
-
-	// 示例实现框架（需要安装 telegram-bot-api 库）
-	/*
-		url := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", t.botToken)
-		payload := map[string]interface{}{
-			"chat_id": chatID,
-			"text":    message,
-		}
-
-		// 发送 HTTP POST 请求
-		if err := t.sendHTTPRequest(url, payload); err != nil {
-			return fmt.Errorf("telegram API call failed: %w", err)
-		}
-	*/
-
-	logrus.Debug("Telegram message sent successfully (stub implementation)")
-	return nil
-}
-
-func (t *TelegramAdapter) ReceiveMessage() <-chan UnifiedMessage {
-	return t.msgChan
-}
-
-func (t *TelegramAdapter) GetPlatformType() PlatformType {
-	return PlatformTelegram
-}
-
-func (t *TelegramAdapter) Start() error {
-	logrus.Info("Starting Telegram adapter")
-
-	// 实现 Telegram webhook 或 polling
-	// 这里实现长轮询获取消息的框架
-
-	go func() {
-		ticker := time.NewTicker(1 * time.Second)
-		defer ticker.Stop()
-
-		for {
-			select {
-			case <-t.stopChan:
-				return
-			case <-ticker.C:
-				// 模拟从 Telegram API 获取消息
-				// 实际实现需要调用 getUpdates API
-				/*
-					url := fmt.Sprintf("https://api.telegram.org/bot%s/getUpdates", t.botToken)
-					updates, err := t.getUpdates(url)
-					if err != nil {
-						logrus.Errorf("Failed to get Telegram updates: %v", err)
-						continue
-					}
-
-					for _, update := range updates {
-						message := UnifiedMessage{
-							ID:          fmt.Sprintf("tg_%d", update.MessageID),
-							PlatformID:  "telegram",
-							UserID:      update.From.ID,
-							Content:     update.Text,
-							Type:        MessageTypeText,
-							Timestamp:   time.Now(),
-						}
-
-						select {
-						case t.msgChan <- message:
-						default:
-							logrus.Warn("Message channel full, dropping message")
-						}
-					}
-				*/
-			}
-		}
-	}()
-
-	logrus.Info("Telegram polling started")
-	return nil
-}
-
-func (t *TelegramAdapter) Stop() error {
-	logrus.Info("Stopping Telegram adapter")
-	close(t.stopChan)
-	return nil
-}
-
-// 微信适配器示例
-type WeChatAdapter struct {
-	appID     string
-	appSecret string
-	msgChan   chan UnifiedMessage
-	stopChan  chan struct{}
-}
-
-func NewWeChatAdapter(appID, appSecret string) *WeChatAdapter {
-	return &WeChatAdapter{
-		appID:     appID,
-		appSecret: appSecret,
-		msgChan:   make(chan UnifiedMessage, 100),
-		stopChan:  make(chan struct{}),
-	}
-}
-
-func (w *WeChatAdapter) SendMessage(chatID, message string) error {
-	// 实现微信消息发送
-	logrus.Infof("Sending WeChat message to %s: %s", chatID, message)
-
-	// 实际的微信 API 调用实现
-	// 这里需要使用微信公众号/企业微信 API
-	// 需要先获取 access_token，然后发送消息
-
-	// 示例实现框架
-	/*
-		// 1. 获取 access_token
-		accessToken, err := w.getAccessToken()
-		if err != nil {
-			return fmt.Errorf("failed to get WeChat access token: %w", err)
-		}
-
-		// 2. 发送消息
-		url := fmt.Sprintf("https://api.weixin.qq.com/cgi-bin/message/custom/send?access_token=%s", accessToken)
-		payload := map[string]interface{}{
-			"touser":  chatID,
-			"msgtype": "text",
-			"text": map[string]string{
-				"content": message,
-			},
-		}
-
-		if err := w.sendHTTPRequest(url, payload); err != nil {
-			return fmt.Errorf("WeChat API call failed: %w", err)
-		}
-	*/
-
-	logrus.Debug("WeChat message sent successfully (stub implementation)")
-	return nil
-}
-
-func (w *WeChatAdapter) ReceiveMessage() <-chan UnifiedMessage {
-	return w.msgChan
-}
-
-func (w *WeChatAdapter) GetPlatformType() PlatformType {
-	return PlatformWeChat
-}
-
-func (w *WeChatAdapter) Start() error {
-	logrus.Info("Starting WeChat adapter")
-
-	// 实现微信消息接收
-	// 这里可以通过 webhook 或 主动查询的方式
-
-	go func() {
-		ticker := time.NewTicker(5 * time.Second)
-		defer ticker.Stop()
-
-		for {
-			select {
-			case <-w.stopChan:
-				return
-			case <-ticker.C:
-				// 模拟从微信服务器获取消息
-				// 实际实现需要处理微信的消息推送或主动查询
-				/*
-					// 如果使用 webhook 模式，则在 HTTP 服务器中处理
-					// 如果使用轮询模式，则在这里实现查询逻辑
-
-					messages, err := w.getMessages()
-					if err != nil {
-						logrus.Errorf("Failed to get WeChat messages: %v", err)
-						continue
-					}
-
-					for _, msg := range messages {
-						message := UnifiedMessage{
-							ID:          fmt.Sprintf("wx_%s", msg.MsgID),
-							PlatformID:  "wechat",
-							UserID:      msg.FromUserName,
-							Content:     msg.Content,
-							Type:        MessageTypeText,
-							Timestamp:   time.Now(),
-						}
-
-						select {
-						case w.msgChan <- message:
-						default:
-							logrus.Warn("Message channel full, dropping WeChat message")
-						}
-					}
-				*/
-			}
-		}
-	}()
-
-	logrus.Info("WeChat message receiver started")
-	return nil
-}
-
-func (w *WeChatAdapter) Stop() error {
-	logrus.Info("Stopping WeChat adapter")
-	close(w.stopChan)
-	return nil
-}
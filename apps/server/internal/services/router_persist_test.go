@@ -13,7 +13,7 @@ type stubAI2 struct{ reply string }
 func (s stubAI2) ProcessQuery(ctx context.Context, query string, sessionID string) (*AIResponse, error) {
 	return &AIResponse{Content: s.reply, Confidence: 0.9, Source: "test"}, nil
 }
-func (s stubAI2) ShouldTransferToHuman(query string, _ []models.Message) bool { return false }
+func (s stubAI2) ShouldTransferToHuman(_, query string, _ []models.Message) bool { return false }
 
 // Implement the full AIServiceInterface
 func (s stubAI2) GetSessionSummary(_ []models.Message) (string, error) { return "", nil }
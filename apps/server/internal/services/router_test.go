@@ -13,7 +13,7 @@ type stubAI struct{ reply string }
 func (s stubAI) ProcessQuery(ctx context.Context, query string, sessionID string) (*AIResponse, error) {
 	return &AIResponse{Content: s.reply + ":" + query, Confidence: 0.9, Source: "test"}, nil
 }
-func (s stubAI) ShouldTransferToHuman(query string, _ []models.Message) bool { return false }
+func (s stubAI) ShouldTransferToHuman(_, query string, _ []models.Message) bool { return false }
 func (s stubAI) GetSessionSummary(_ []models.Message) (string, error)        { return "", nil }
 func (s stubAI) InitializeKnowledgeBase()                                    {}
 func (s stubAI) GetStatus(ctx context.Context) map[string]interface{} {
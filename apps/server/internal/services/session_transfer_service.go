@@ -19,6 +19,10 @@ type SessionTransferService struct {
 	aiService    AIServiceInterface
 	agentService *AgentService
 	wsHub        *WebSocketHub
+	// 可选：坐席工作台推送（排队/分配事件）
+	agentRealtime *AgentRealtimeService
+	// 可选：转接时生成并保存结构化摘要
+	summaries *SummaryService
 }
 
 // NewSessionTransferService 创建会话转接服务
@@ -42,6 +46,16 @@ func NewSessionTransferService(
 	}
 }
 
+// SetSummaryService 注入摘要服务（可选）；设置后转接记录使用结构化摘要
+func (s *SessionTransferService) SetSummaryService(svc *SummaryService) {
+	s.summaries = svc
+}
+
+// SetAgentRealtimeService 注入坐席工作台服务（可选）
+func (s *SessionTransferService) SetAgentRealtimeService(svc *AgentRealtimeService) {
+	s.agentRealtime = svc
+}
+
 // TransferRequest 转接请求
 type TransferRequest struct {
 	SessionID    string   `json:"session_id" binding:"required"`
@@ -49,6 +63,8 @@ type TransferRequest struct {
 	TargetSkills []string `json:"target_skills"`
 	Priority     string   `json:"priority"`
 	Notes        string   `json:"notes"`
+	// Handoff AI 转人工判断依据，记录到转接/等待记录
+	Handoff *HandoffDecision `json:"-"`
 }
 
 // TransferToHuman 转接到人工客服
@@ -87,7 +103,7 @@ func (s *SessionTransferService) TransferToHuman(ctx context.Context, req *Trans
 	}
 
 	// 执行转接
-	return s.executeTransfer(ctx, &session, agent.UserID, req.Reason, req.Notes)
+	return s.executeTransfer(ctx, &session, agent.UserID, req.Reason, req.Notes, req.Handoff.JSON())
 }
 
 // TransferToAgent 转接到指定客服
@@ -110,11 +126,11 @@ func (s *SessionTransferService) TransferToAgent(ctx context.Context, sessionID
 	}
 
 	// 执行转接
-	return s.executeTransfer(ctx, &session, targetAgentID, reason, "")
+	return s.executeTransfer(ctx, &session, targetAgentID, reason, "", "")
 }
 
-// executeTransfer 执行转接
-func (s *SessionTransferService) executeTransfer(ctx context.Context, session *models.Session, targetAgentID uint, reason, notes string) (*TransferResult, error) {
+// executeTransfer 执行转接；handoff 为 AI 转人工判断（JSON），非 AI 发起时为空
+func (s *SessionTransferService) executeTransfer(ctx context.Context, session *models.Session, targetAgentID uint, reason, notes, handoff string) (*TransferResult, error) {
 	if session.Status == "ended" {
 		return nil, fmt.Errorf("session already ended")
 	}
@@ -131,7 +147,7 @@ func (s *SessionTransferService) executeTransfer(ctx context.Context, session *m
 	transferAt := time.Now()
 
 	// 生成会话摘要（在事务外，避免长事务）
-	summary, err := s.generateSessionSummary(session)
+	summary, err := s.generateSessionSummary(ctx, session)
 	if err != nil {
 		s.logger.Warnf("Failed to generate session summary: %v", err)
 		summary = "无法生成会话摘要"
@@ -141,13 +157,14 @@ func (s *SessionTransferService) executeTransfer(ctx context.Context, session *m
 
 	// 创建转接记录
 	transferRecord := &models.TransferRecord{
-		SessionID:      session.ID,
-		FromAgentID:    fromAgentID,
-		ToAgentID:      &targetAgentID,
-		Reason:         reason,
-		Notes:          notes,
-		SessionSummary: summary,
-		TransferredAt:  transferAt,
+		SessionID:       session.ID,
+		FromAgentID:     fromAgentID,
+		ToAgentID:       &targetAgentID,
+		Reason:          reason,
+		Notes:           notes,
+		SessionSummary:  summary,
+		HandoffDecision: handoff,
+		TransferredAt:   transferAt,
 	}
 
 	// 原子化：会话指派 + 工时负载 + 记录/消息
@@ -156,9 +173,11 @@ func (s *SessionTransferService) executeTransfer(ctx context.Context, session *m
 		if err := tx.Model(&models.Session{}).
 			Where("id = ?", session.ID).
 			Updates(map[string]interface{}{
-				"agent_id": targetAgentID,
-				"status":   "active",
-				"ended_at": nil,
+				"agent_id":            targetAgentID,
+				"status":              "active",
+				"ended_at":            nil,
+				"assigned_at":         transferAt,
+				"agent_first_read_at": nil,
 			}).Error; err != nil {
 			return fmt.Errorf("update session: %w", err)
 		}
@@ -244,6 +263,9 @@ func (s *SessionTransferService) executeTransfer(ctx context.Context, session *m
 
 	// 发送实时通知
 	s.notifyTransfer(session.ID, targetAgentID, transferMessageContent)
+	if s.agentRealtime != nil {
+		s.agentRealtime.NotifySessionAssigned(session.ID, targetAgentID, fromAgentID)
+	}
 
 	s.logger.Infof("Successfully transferred session %s to agent %d", session.ID, targetAgentID)
 
@@ -283,13 +305,14 @@ func (s *SessionTransferService) addToWaitingQueue(ctx context.Context, session
 
 	// 创建等待记录
 	waitingRecord := &models.WaitingRecord{
-		SessionID:    session.ID,
-		Reason:       req.Reason,
-		TargetSkills: strings.Join(req.TargetSkills, ","),
-		Priority:     req.Priority,
-		Notes:        req.Notes,
-		Status:       "waiting",
-		QueuedAt:     time.Now(),
+		SessionID:       session.ID,
+		Reason:          req.Reason,
+		TargetSkills:    strings.Join(req.TargetSkills, ","),
+		Priority:        req.Priority,
+		Notes:           req.Notes,
+		Status:          "waiting",
+		QueuedAt:        time.Now(),
+		HandoffDecision: req.Handoff.JSON(),
 	}
 
 	if err := s.db.Create(waitingRecord).Error; err != nil {
@@ -309,6 +332,9 @@ func (s *SessionTransferService) addToWaitingQueue(ctx context.Context, session
 
 	// 发送实时通知
 	s.notifyWaiting(session.ID, waitingMessage.Content)
+	if s.agentRealtime != nil {
+		s.agentRealtime.NotifyQueueEntry(waitingRecord)
+	}
 
 	s.logger.Infof("Added session %s to waiting queue", session.ID)
 
@@ -351,7 +377,7 @@ func (s *SessionTransferService) ProcessWaitingQueue(ctx context.Context) error
 		}
 
 		// 执行转接
-		result, err := s.executeTransfer(ctx, &session, agent.UserID, record.Reason, record.Notes)
+		result, err := s.executeTransfer(ctx, &session, agent.UserID, record.Reason, record.Notes, record.HandoffDecision)
 		if err != nil {
 			s.logger.Errorf("Failed to transfer waiting session %s: %v", record.SessionID, err)
 			continue
@@ -374,7 +400,7 @@ func (s *SessionTransferService) ProcessWaitingQueue(ctx context.Context) error
 }
 
 // generateSessionSummary 生成会话摘要
-func (s *SessionTransferService) generateSessionSummary(session *models.Session) (string, error) {
+func (s *SessionTransferService) generateSessionSummary(ctx context.Context, session *models.Session) (string, error) {
 	// 获取会话消息
 	var messages []models.Message
 	if err := s.db.Where("session_id = ?", session.ID).
@@ -392,6 +418,15 @@ func (s *SessionTransferService) generateSessionSummary(session *models.Session)
 		return fmt.Sprintf("用户%s的简短会话，共%d条消息", userLabel, len(messages)), nil
 	}
 
+	// 结构化摘要同时保存到摘要记录与关联工单
+	if s.summaries != nil {
+		rec, err := s.summaries.SummarizeSession(ctx, session.ID, SummaryTriggerTransferred)
+		if err == nil {
+			return rec.Text, nil
+		}
+		s.logger.Warnf("Structured summary for session %s failed, falling back: %v", session.ID, err)
+	}
+
 	// 使用 AI 服务生成摘要
 	return s.aiService.GetSessionSummary(messages)
 }
@@ -483,7 +518,8 @@ func (s *SessionTransferService) CancelWaitingRecord(ctx context.Context, sessio
 	}
 
 	now := time.Now()
-	return s.db.Transaction(func(tx *gorm.DB) error {
+	cancelled := false
+	err := s.db.Transaction(func(tx *gorm.DB) error {
 		var wr models.WaitingRecord
 		if err := tx.Where("session_id = ? AND status = ?", sessionID, "waiting").First(&wr).Error; err != nil {
 			if err == gorm.ErrRecordNotFound {
@@ -510,8 +546,13 @@ func (s *SessionTransferService) CancelWaitingRecord(ctx context.Context, sessio
 			CreatedAt: now,
 		}
 		_ = tx.Create(msg).Error
+		cancelled = true
 		return nil
 	})
+	if err == nil && cancelled && s.agentRealtime != nil {
+		s.agentRealtime.NotifyQueueRemoved(sessionID, reason)
+	}
+	return err
 }
 
 // AutoTransferCheck 自动转接检查
@@ -534,7 +575,7 @@ func (s *SessionTransferService) AutoTransferCheck(ctx context.Context, sessionI
 	query := queryBuilder.String()
 
 	// 使用 AI 服务判断是否需要转人工
-	return s.aiService.ShouldTransferToHuman(query, messages)
+	return s.aiService.ShouldTransferToHuman(sessionID, query, messages)
 }
 
 type TransferResult struct {
@@ -18,7 +18,7 @@ type stubAIForTransfer struct{}
 func (s stubAIForTransfer) ProcessQuery(ctx context.Context, query string, sessionID string) (*AIResponse, error) {
 	return &AIResponse{Content: "ok", Confidence: 1, Source: "ai"}, nil
 }
-func (s stubAIForTransfer) ShouldTransferToHuman(query string, sessionHistory []models.Message) bool {
+func (s stubAIForTransfer) ShouldTransferToHuman(sessionID, query string, sessionHistory []models.Message) bool {
 	return false
 }
 func (s stubAIForTransfer) GetSessionSummary(messages []models.Message) (string, error) {
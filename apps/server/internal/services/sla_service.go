@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"servify/apps/server/internal/models"
@@ -21,6 +22,8 @@ type SLAService struct {
 	logger     *logrus.Logger
 	tracer     trace.Tracer
 	automation *AutomationService
+	realtime   *AgentRealtimeService
+	warned     sync.Map // ticketID:type -> deadline，避免重复预警
 }
 
 // NewSLAService 创建SLA服务
@@ -41,6 +44,11 @@ func (s *SLAService) SetAutomationService(automation *AutomationService) {
 	s.automation = automation
 }
 
+// SetAgentRealtimeService 注入坐席工作台服务，用于推送 SLA 预警/违约
+func (s *SLAService) SetAgentRealtimeService(realtime *AgentRealtimeService) {
+	s.realtime = realtime
+}
+
 // SLAConfigCreateRequest 创建SLA配置请求
 type SLAConfigCreateRequest struct {
 	Name              string   `json:"name" binding:"required"`
@@ -458,6 +466,7 @@ func (s *SLAService) CheckSLAViolation(ctx context.Context, ticket *models.Ticke
 	now := time.Now()
 	violation := s.detectViolation(ticket, slaConfig, now)
 	if violation == nil {
+		s.checkSLAWarning(ticket, slaConfig, now)
 		return nil, nil // 没有违约
 	}
 
@@ -483,6 +492,10 @@ func (s *SLAService) CheckSLAViolation(ctx context.Context, ticket *models.Ticke
 	s.logger.Warnf("SLA violation detected: ticket=%d, type=%s, deadline=%s",
 		ticket.ID, violation.ViolationType, violation.Deadline.Format(time.RFC3339))
 
+	if s.realtime != nil {
+		s.realtime.NotifySLAWarning(ticket, violation.ViolationType, violation.Deadline, true)
+	}
+
 	// 触发自动化
 	if s.automation != nil {
 		go s.automation.HandleEvent(context.Background(), AutomationEvent{
@@ -537,6 +550,41 @@ func (s *SLAService) detectViolation(ticket *models.Ticket, slaConfig *models.SL
 	return nil
 }
 
+// checkSLAWarning 已用时间达到预警阈值（尚未违约）时向坐席推送预警，每个截止时间只推送一次
+func (s *SLAService) checkSLAWarning(ticket *models.Ticket, slaConfig *models.SLAConfig, now time.Time) {
+	if s.realtime == nil {
+		return
+	}
+	createdAt := ticket.CreatedAt
+	if createdAt.IsZero() {
+		return
+	}
+	threshold := slaConfig.WarningThreshold
+	if threshold <= 0 {
+		threshold = 80
+	}
+
+	violationType, window := "resolution", slaConfig.ResolutionTime
+	if ticket.AgentID == nil {
+		violationType, window = "first_response", slaConfig.FirstResponseTime
+	}
+	if window <= 0 {
+		return
+	}
+	total := time.Duration(window) * time.Minute
+	deadline := createdAt.Add(total)
+	if now.Sub(createdAt) < total*time.Duration(threshold)/100 || now.After(deadline) {
+		return
+	}
+
+	key := fmt.Sprintf("%d:%s", ticket.ID, violationType)
+	if prev, ok := s.warned.Load(key); ok && prev.(time.Time).Equal(deadline) {
+		return
+	}
+	s.warned.Store(key, deadline)
+	s.realtime.NotifySLAWarning(ticket, violationType, deadline, false)
+}
+
 // CreateSLAViolation 创建SLA违约记录
 func (s *SLAService) CreateSLAViolation(ctx context.Context, violation *models.SLAViolation) error {
 	ctx, span := s.tracer.Start(ctx, "sla.create_violation")
@@ -2,6 +2,7 @@ package services
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"time"
 
@@ -322,12 +323,21 @@ func (s *StatisticsService) UpdateDailyStats(ctx context.Context, date time.Time
 		Count(&resolvedTickets)
 	dailyStats.ResolvedTickets = int(resolvedTickets)
 
-	// 计算平均响应时间
-	var avgResponseTime float64
-	s.db.Model(&models.Agent{}).
-		Select("AVG(avg_response_time)").
-		Row().Scan(&avgResponseTime)
-	dailyStats.AvgResponseTime = int(avgResponseTime)
+	// 计算平均响应时间：优先取当天坐席首次已读的首次响应时长，无数据时退回坐席档案均值
+	var firstResponse sql.NullFloat64
+	s.db.Model(&models.Session{}).
+		Where("agent_first_read_at >= ? AND agent_first_read_at < ?", date, nextDay).
+		Select("AVG(first_response_secs)").
+		Row().Scan(&firstResponse)
+	if firstResponse.Valid {
+		dailyStats.AvgResponseTime = int(firstResponse.Float64 + 0.5)
+	} else {
+		var avgResponseTime float64
+		s.db.Model(&models.Agent{}).
+			Select("AVG(avg_response_time)").
+			Row().Scan(&avgResponseTime)
+		dailyStats.AvgResponseTime = int(avgResponseTime)
+	}
 
 	// 计算平均解决时间
 	var avgResolutionTime float64
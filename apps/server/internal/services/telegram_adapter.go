@@ -0,0 +1,667 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+const (
+	TelegramModePolling = "polling"
+	TelegramModeWebhook = "webhook"
+
+	defaultTelegramAPIBaseURL  = "https://api.telegram.org"
+	defaultTelegramPollTimeout = 30 * time.Second
+	telegramSendTimeout        = 15 * time.Second
+	// Telegram 单条文本消息上限 4096 字符
+	telegramMaxTextLength = 4096
+
+	// TelegramFileProxyPath 附件代理下载路径前缀（handlers.RegisterTelegramFileRoutes），
+	// Bot API 的文件下载地址包含 bot token，不直接写入附件 URL
+	TelegramFileProxyPath = "/api/channels/telegram/files/"
+)
+
+var (
+	// ErrPlatformAdapterStopped 适配器已停止，无法继续投递消息
+	ErrPlatformAdapterStopped = errors.New("platform adapter stopped")
+	// ErrTelegramFileNotFound file_id 无效或文件已不可下载
+	ErrTelegramFileNotFound = errors.New("telegram file not found")
+)
+
+// TelegramAdapterConfig Telegram 适配器配置
+type TelegramAdapterConfig struct {
+	BotToken      string
+	APIBaseURL    string        // 默认 https://api.telegram.org；测试时可指向本地 HTTP 替身
+	Mode          string        // polling（默认）或 webhook
+	WebhookURL    string        // webhook 模式下启动时调用 setWebhook 注册（为空则跳过注册）
+	WebhookSecret string        // 校验 X-Telegram-Bot-Api-Secret-Token
+	PollTimeout   time.Duration // getUpdates 长轮询超时
+	UploadDir     string        // 允许以 multipart 上传的本地文件目录（upload.storage_path）；为空时拒绝发送本地文件
+	HTTPClient    *http.Client
+}
+
+// TelegramAdapter 基于 Telegram Bot API 的平台适配器（支持长轮询与 webhook 两种接收方式）
+type TelegramAdapter struct {
+	botToken      string
+	apiBaseURL    string
+	mode          string
+	webhookURL    string
+	webhookSecret string
+	pollTimeout   time.Duration
+	uploadDir     string
+	client        *http.Client
+
+	msgChan  chan UnifiedMessage
+	stopChan chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+	offset   int64
+}
+
+// TelegramUpdate Bot API Update 对象（仅包含本适配器关心的字段）
+type TelegramUpdate struct {
+	UpdateID      int64            `json:"update_id"`
+	Message       *TelegramMessage `json:"message,omitempty"`
+	EditedMessage *TelegramMessage `json:"edited_message,omitempty"`
+}
+
+// TelegramMessage Bot API Message 对象
+type TelegramMessage struct {
+	MessageID int64               `json:"message_id"`
+	From      *TelegramUser       `json:"from,omitempty"`
+	Chat      TelegramChat        `json:"chat"`
+	Date      int64               `json:"date"`
+	Text      string              `json:"text,omitempty"`
+	Caption   string              `json:"caption,omitempty"`
+	Photo     []TelegramPhotoSize `json:"photo,omitempty"`
+	Document  *TelegramDocument   `json:"document,omitempty"`
+}
+
+// TelegramUser Bot API User 对象
+type TelegramUser struct {
+	ID           int64  `json:"id"`
+	IsBot        bool   `json:"is_bot"`
+	FirstName    string `json:"first_name"`
+	LastName     string `json:"last_name,omitempty"`
+	Username     string `json:"username,omitempty"`
+	LanguageCode string `json:"language_code,omitempty"`
+}
+
+// TelegramChat Bot API Chat 对象
+type TelegramChat struct {
+	ID       int64  `json:"id"`
+	Type     string `json:"type"`
+	Title    string `json:"title,omitempty"`
+	Username string `json:"username,omitempty"`
+}
+
+// TelegramPhotoSize 图片的某一尺寸
+type TelegramPhotoSize struct {
+	FileID       string `json:"file_id"`
+	FileUniqueID string `json:"file_unique_id"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+	FileSize     int64  `json:"file_size,omitempty"`
+}
+
+// TelegramDocument 通用文件
+type TelegramDocument struct {
+	FileID       string `json:"file_id"`
+	FileUniqueID string `json:"file_unique_id"`
+	FileName     string `json:"file_name,omitempty"`
+	MimeType     string `json:"mime_type,omitempty"`
+	FileSize     int64  `json:"file_size,omitempty"`
+}
+
+type telegramFile struct {
+	FileID   string `json:"file_id"`
+	FilePath string `json:"file_path"`
+	FileSize int64  `json:"file_size"`
+}
+
+// TelegramFileContent 代理下载的文件内容，调用方负责关闭 Body
+type TelegramFileContent struct {
+	Body        io.ReadCloser
+	Name        string
+	ContentType string
+	Size        int64 // 未知时为 -1
+}
+
+// TelegramAPIError Bot API 返回 ok=false
+type TelegramAPIError struct {
+	Method      string
+	Code        int
+	Description string
+}
+
+func (e *TelegramAPIError) Error() string {
+	return fmt.Sprintf("telegram %s failed: %s (code %d)", e.Method, e.Description, e.Code)
+}
+
+type telegramAPIResponse struct {
+	OK          bool            `json:"ok"`
+	Result      json.RawMessage `json:"result"`
+	Description string          `json:"description"`
+	ErrorCode   int             `json:"error_code"`
+}
+
+// NewTelegramAdapter 创建 Telegram 适配器
+func NewTelegramAdapter(cfg TelegramAdapterConfig) *TelegramAdapter {
+	baseURL := strings.TrimRight(cfg.APIBaseURL, "/")
+	if baseURL == "" {
+		baseURL = defaultTelegramAPIBaseURL
+	}
+	mode := strings.ToLower(strings.TrimSpace(cfg.Mode))
+	if mode != TelegramModeWebhook {
+		mode = TelegramModePolling
+	}
+	pollTimeout := cfg.PollTimeout
+	if pollTimeout <= 0 {
+		pollTimeout = defaultTelegramPollTimeout
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)}
+	}
+
+	return &TelegramAdapter{
+		botToken:      cfg.BotToken,
+		apiBaseURL:    baseURL,
+		mode:          mode,
+		webhookURL:    cfg.WebhookURL,
+		webhookSecret: cfg.WebhookSecret,
+		pollTimeout:   pollTimeout,
+		uploadDir:     cfg.UploadDir,
+		client:        client,
+		msgChan:       make(chan UnifiedMessage, 100),
+		stopChan:      make(chan struct{}),
+	}
+}
+
+// Mode 返回当前接收模式（polling / webhook）
+func (t *TelegramAdapter) Mode() string {
+	return t.mode
+}
+
+func (t *TelegramAdapter) SendMessage(chatID, message string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), telegramSendTimeout)
+	defer cancel()
+
+	for _, chunk := range splitTelegramText(message) {
+		payload := map[string]interface{}{
+			"chat_id": chatID,
+			"text":    chunk,
+		}
+		if err := t.call(ctx, "sendMessage", payload, nil); err != nil {
+			return err
+		}
+	}
+	logrus.Debugf("Telegram message sent to %s", chatID)
+	return nil
+}
+
+// SendAttachment 发送图片或文件。attachment.URL 可以是公网 URL、Telegram file_id 或上传目录内的本地文件路径（本地文件以 multipart 上传）。
+func (t *TelegramAdapter) SendAttachment(chatID string, attachment Attachment) error {
+	ctx, cancel := context.WithTimeout(context.Background(), telegramSendTimeout)
+	defer cancel()
+
+	method, field := "sendDocument", "document"
+	if attachment.Type == string(MessageTypeImage) {
+		method, field = "sendPhoto", "photo"
+	}
+
+	path, local, err := localAttachmentPath(t.uploadDir, attachment.URL)
+	if err != nil {
+		return err
+	}
+	if local {
+		return t.callMultipart(ctx, method, map[string]string{"chat_id": chatID}, field, path, attachment.Name)
+	}
+
+	payload := map[string]interface{}{
+		"chat_id": chatID,
+		field:     attachment.URL,
+	}
+	return t.call(ctx, method, payload, nil)
+}
+
+func (t *TelegramAdapter) ReceiveMessage() <-chan UnifiedMessage {
+	return t.msgChan
+}
+
+func (t *TelegramAdapter) GetPlatformType() PlatformType {
+	return PlatformTelegram
+}
+
+func (t *TelegramAdapter) Start() error {
+	if t.botToken == "" {
+		return fmt.Errorf("telegram bot token is required")
+	}
+
+	if t.mode == TelegramModeWebhook {
+		// webhook 路由公开可达，未配置 secret 时无法区分伪造请求
+		if t.webhookSecret == "" {
+			return fmt.Errorf("telegram webhook secret is required in webhook mode")
+		}
+		if t.webhookURL != "" {
+			ctx, cancel := context.WithTimeout(context.Background(), telegramSendTimeout)
+			defer cancel()
+			payload := map[string]interface{}{
+				"url":             t.webhookURL,
+				"allowed_updates": []string{"message", "edited_message"},
+				"secret_token":    t.webhookSecret,
+			}
+			if err := t.call(ctx, "setWebhook", payload, nil); err != nil {
+				return fmt.Errorf("register telegram webhook: %w", err)
+			}
+		}
+		logrus.Info("Telegram adapter started in webhook mode")
+		return nil
+	}
+
+	t.wg.Add(1)
+	go t.pollLoop()
+
+	logrus.Info("Telegram polling started")
+	return nil
+}
+
+func (t *TelegramAdapter) Stop() error {
+	t.stopOnce.Do(func() {
+		logrus.Info("Stopping Telegram adapter")
+		close(t.stopChan)
+	})
+	t.wg.Wait()
+	return nil
+}
+
+// VerifyWebhookSecret 校验 webhook 请求头中的 secret token（未配置 secret 时拒绝所有请求）
+func (t *TelegramAdapter) VerifyWebhookSecret(token string) bool {
+	if t.webhookSecret == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(t.webhookSecret)) == 1
+}
+
+// HandleUpdate 处理一条 Update（webhook 推送或轮询获取），转换后投递到消息通道
+func (t *TelegramAdapter) HandleUpdate(ctx context.Context, update *TelegramUpdate) error {
+	if update == nil {
+		return nil
+	}
+
+	msg := update.Message
+	edited := false
+	if msg == nil && update.EditedMessage != nil {
+		msg = update.EditedMessage
+		edited = true
+	}
+	if msg == nil {
+		return nil
+	}
+	if msg.From != nil && msg.From.IsBot {
+		return nil
+	}
+
+	unified := t.toUnifiedMessage(msg)
+	unified.Metadata["update_id"] = update.UpdateID
+	if edited {
+		unified.Metadata["edited"] = true
+	}
+
+	select {
+	case t.msgChan <- unified:
+		return nil
+	case <-t.stopChan:
+		return ErrPlatformAdapterStopped
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (t *TelegramAdapter) pollLoop() {
+	defer t.wg.Done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-t.stopChan
+		cancel()
+	}()
+
+	backoff := time.Second
+	for {
+		select {
+		case <-t.stopChan:
+			return
+		default:
+		}
+
+		updates, err := t.getUpdates(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logrus.Errorf("Failed to get Telegram updates: %v", err)
+			select {
+			case <-t.stopChan:
+				return
+			case <-time.After(backoff):
+			}
+			if backoff < 30*time.Second {
+				backoff *= 2
+			}
+			continue
+		}
+		backoff = time.Second
+
+		for i := range updates {
+			if err := t.HandleUpdate(ctx, &updates[i]); err != nil {
+				if errors.Is(err, ErrPlatformAdapterStopped) || ctx.Err() != nil {
+					return
+				}
+				logrus.Warnf("Failed to handle Telegram update %d: %v", updates[i].UpdateID, err)
+			}
+			if updates[i].UpdateID >= t.offset {
+				t.offset = updates[i].UpdateID + 1
+			}
+		}
+	}
+}
+
+func (t *TelegramAdapter) getUpdates(ctx context.Context) ([]TelegramUpdate, error) {
+	// HTTP 请求超时需要大于长轮询超时
+	reqCtx, cancel := context.WithTimeout(ctx, t.pollTimeout+10*time.Second)
+	defer cancel()
+
+	payload := map[string]interface{}{
+		"offset":          t.offset,
+		"timeout":         int(t.pollTimeout / time.Second),
+		"allowed_updates": []string{"message", "edited_message"},
+	}
+	var updates []TelegramUpdate
+	if err := t.call(reqCtx, "getUpdates", payload, &updates); err != nil {
+		return nil, err
+	}
+	return updates, nil
+}
+
+func (t *TelegramAdapter) toUnifiedMessage(msg *TelegramMessage) UnifiedMessage {
+	content := msg.Text
+	if content == "" {
+		content = msg.Caption
+	}
+
+	unified := UnifiedMessage{
+		ID:         fmt.Sprintf("tg_%d_%d", msg.Chat.ID, msg.MessageID),
+		PlatformID: string(PlatformTelegram),
+		// 以 chat_id 作为会话标识，回复时直接发送到该 chat
+		UserID:    strconv.FormatInt(msg.Chat.ID, 10),
+		Content:   content,
+		Type:      MessageTypeText,
+		Timestamp: time.Unix(msg.Date, 0),
+		Metadata: map[string]interface{}{
+			"chat_id":    msg.Chat.ID,
+			"chat_type":  msg.Chat.Type,
+			"message_id": msg.MessageID,
+		},
+	}
+	if msg.Date == 0 {
+		unified.Timestamp = time.Now()
+	}
+	if msg.From != nil {
+		unified.Metadata["from_id"] = msg.From.ID
+		unified.Metadata["username"] = msg.From.Username
+		unified.Metadata["first_name"] = msg.From.FirstName
+		if msg.From.LanguageCode != "" {
+			unified.Metadata["language_code"] = msg.From.LanguageCode
+		}
+	}
+
+	if len(msg.Photo) > 0 {
+		// Telegram 按尺寸从小到大返回，取最大的一张
+		photo := msg.Photo[len(msg.Photo)-1]
+		unified.Type = MessageTypeImage
+		unified.Attachments = append(unified.Attachments, Attachment{
+			Type:   string(MessageTypeImage),
+			URL:    telegramFileURL(photo.FileID),
+			FileID: photo.FileID,
+			Name:   photo.FileUniqueID + ".jpg",
+			Size:   photo.FileSize,
+		})
+	}
+	if msg.Document != nil {
+		if unified.Type == MessageTypeText {
+			unified.Type = MessageTypeFile
+		}
+		name := msg.Document.FileName
+		if name == "" {
+			name = msg.Document.FileUniqueID
+		}
+		unified.Attachments = append(unified.Attachments, Attachment{
+			Type:   string(MessageTypeFile),
+			URL:    telegramFileURL(msg.Document.FileID),
+			FileID: msg.Document.FileID,
+			Name:   name,
+			Size:   msg.Document.FileSize,
+		})
+	}
+
+	return unified
+}
+
+// telegramFileURL 附件的代理下载地址（不含 bot token）
+func telegramFileURL(fileID string) string {
+	if fileID == "" {
+		return ""
+	}
+	return TelegramFileProxyPath + url.PathEscape(fileID)
+}
+
+// OpenFile 通过 getFile 解析 file_id 并在服务端拉取文件内容；下载地址包含 bot token，仅在服务端使用
+func (t *TelegramAdapter) OpenFile(ctx context.Context, fileID string) (*TelegramFileContent, error) {
+	if fileID == "" {
+		return nil, ErrTelegramFileNotFound
+	}
+	var file telegramFile
+	if err := t.call(ctx, "getFile", map[string]interface{}{"file_id": fileID}, &file); err != nil {
+		var apiErr *TelegramAPIError
+		if errors.As(err, &apiErr) && apiErr.Code == http.StatusBadRequest {
+			return nil, fmt.Errorf("%w: %s", ErrTelegramFileNotFound, apiErr.Description)
+		}
+		return nil, err
+	}
+	if file.FilePath == "" {
+		return nil, ErrTelegramFileNotFound
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/file/bot%s/%s", t.apiBaseURL, t.botToken, file.FilePath), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create telegram file request: %w", err)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("telegram file download failed: %w", redactURLError(err))
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, ErrTelegramFileNotFound
+		}
+		return nil, fmt.Errorf("telegram file download failed: status %d", resp.StatusCode)
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return &TelegramFileContent{Body: resp.Body, Name: filepath.Base(file.FilePath), ContentType: contentType, Size: resp.ContentLength}, nil
+}
+
+func (t *TelegramAdapter) methodURL(method string) string {
+	return fmt.Sprintf("%s/bot%s/%s", t.apiBaseURL, t.botToken, method)
+}
+
+func (t *TelegramAdapter) call(ctx context.Context, method string, payload interface{}, out interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal telegram %s request: %w", method, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.methodURL(method), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create telegram %s request: %w", method, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return t.do(req, method, out)
+}
+
+func (t *TelegramAdapter) callMultipart(ctx context.Context, method string, fields map[string]string, fileField, filePath, fileName string) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to open attachment: %w", err)
+	}
+	defer f.Close()
+
+	if fileName == "" {
+		fileName = filepath.Base(filePath)
+	}
+
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	for k, v := range fields {
+		if err := w.WriteField(k, v); err != nil {
+			return fmt.Errorf("failed to write multipart field: %w", err)
+		}
+	}
+	part, err := w.CreateFormFile(fileField, fileName)
+	if err != nil {
+		return fmt.Errorf("failed to create multipart file: %w", err)
+	}
+	if _, err := io.Copy(part, f); err != nil {
+		return fmt.Errorf("failed to copy attachment: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to close multipart writer: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.methodURL(method), &buf)
+	if err != nil {
+		return fmt.Errorf("failed to create telegram %s request: %w", method, err)
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+
+	return t.do(req, method, nil)
+}
+
+func (t *TelegramAdapter) do(req *http.Request, method string, out interface{}) error {
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("telegram %s request failed: %w", method, redactURLError(err))
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read telegram %s response: %w", method, err)
+	}
+
+	var apiResp telegramAPIResponse
+	if err := json.Unmarshal(body, &apiResp); err != nil {
+		return fmt.Errorf("failed to decode telegram %s response (status %d): %w", method, resp.StatusCode, err)
+	}
+	if !apiResp.OK {
+		return &TelegramAPIError{Method: method, Code: apiResp.ErrorCode, Description: apiResp.Description}
+	}
+	if out != nil && len(apiResp.Result) > 0 {
+		if err := json.Unmarshal(apiResp.Result, out); err != nil {
+			return fmt.Errorf("failed to decode telegram %s result: %w", method, err)
+		}
+	}
+	return nil
+}
+
+// splitTelegramText 将超长文本按 Telegram 上限切分
+func splitTelegramText(text string) []string {
+	runes := []rune(text)
+	if len(runes) <= telegramMaxTextLength {
+		return []string{text}
+	}
+	var chunks []string
+	for len(runes) > 0 {
+		n := telegramMaxTextLength
+		if len(runes) < n {
+			n = len(runes)
+		}
+		chunks = append(chunks, string(runes[:n]))
+		runes = runes[n:]
+	}
+	return chunks
+}
+
+// redactURLError 去掉 *url.Error 中的请求地址（Bot API 地址包含 bot token），避免写入日志或返回给调用方
+func redactURLError(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+	return err
+}
+
+func isLocalFile(path string) bool {
+	if path == "" || strings.Contains(path, "://") {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// ErrAttachmentOutsideUploadDir 本地附件不在上传目录内，拒绝发送以免外发服务器上的任意文件
+var ErrAttachmentOutsideUploadDir = errors.New("attachment path outside upload directory")
+
+// localAttachmentPath 判断附件是否为本地文件；本地文件解析符号链接后须位于 uploadDir 内，返回解析后的路径
+func localAttachmentPath(uploadDir, path string) (string, bool, error) {
+	if !isLocalFile(path) {
+		return "", false, nil
+	}
+	if uploadDir == "" {
+		return "", true, ErrAttachmentOutsideUploadDir
+	}
+	root, err := resolveRealPath(uploadDir)
+	if err != nil {
+		return "", true, fmt.Errorf("resolve upload directory: %w", err)
+	}
+	file, err := resolveRealPath(path)
+	if err != nil {
+		return "", true, fmt.Errorf("resolve attachment path: %w", err)
+	}
+	rel, err := filepath.Rel(root, file)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", true, ErrAttachmentOutsideUploadDir
+	}
+	return file, true, nil
+}
+
+func resolveRealPath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(abs)
+}
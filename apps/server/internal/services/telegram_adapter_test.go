@@ -0,0 +1,342 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeTelegramAPI 模拟 api.telegram.org 的本地替身
+type fakeTelegramAPI struct {
+	mu       sync.Mutex
+	calls    map[string][]map[string]interface{}
+	updates  []TelegramUpdate
+	served   bool
+	lastForm map[string]string
+}
+
+func newFakeTelegramAPI(updates []TelegramUpdate) (*fakeTelegramAPI, *httptest.Server) {
+	f := &fakeTelegramAPI{calls: map[string][]map[string]interface{}{}, updates: updates}
+	srv := httptest.NewServer(http.HandlerFunc(f.serve))
+	return f, srv
+}
+
+func (f *fakeTelegramAPI) serve(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) == 4 && parts[0] == "file" && parts[1] == "bottoken" {
+		// 文件下载：/file/bot<token>/<file_path>
+		w.Header().Set("Content-Type", "application/pdf")
+		_, _ = w.Write([]byte("content of " + parts[3]))
+		return
+	}
+	if len(parts) != 2 || parts[0] != "bottoken" {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"ok":false,"error_code":404,"description":"Not Found"}`))
+		return
+	}
+	method := parts[1]
+
+	payload := map[string]interface{}{}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+		_ = r.ParseMultipartForm(1 << 20)
+		form := map[string]string{}
+		for k, v := range r.MultipartForm.Value {
+			form[k] = v[0]
+		}
+		for k, v := range r.MultipartForm.File {
+			form[k] = v[0].Filename
+		}
+		f.mu.Lock()
+		f.lastForm = form
+		f.mu.Unlock()
+	} else {
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+	}
+
+	f.mu.Lock()
+	f.calls[method] = append(f.calls[method], payload)
+	f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	switch method {
+	case "getUpdates":
+		f.mu.Lock()
+		var result []TelegramUpdate
+		if !f.served {
+			result = f.updates
+			f.served = true
+		}
+		f.mu.Unlock()
+		if result == nil {
+			// 模拟长轮询空返回
+			time.Sleep(20 * time.Millisecond)
+			result = []TelegramUpdate{}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "result": result})
+	case "getFile":
+		fileID, _ := payload["file_id"].(string)
+		if fileID == "missing" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"ok":false,"error_code":400,"description":"Bad Request: invalid file_id"}`))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"ok":     true,
+			"result": map[string]interface{}{"file_id": fileID, "file_path": "files/" + fileID},
+		})
+	case "sendMessage", "sendPhoto", "sendDocument", "setWebhook":
+		_, _ = w.Write([]byte(`{"ok":true,"result":true}`))
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"ok":false,"error_code":400,"description":"unknown method"}`))
+	}
+}
+
+func (f *fakeTelegramAPI) callsOf(method string) []map[string]interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]map[string]interface{}(nil), f.calls[method]...)
+}
+
+func TestTelegramAdapter_Polling_MapsPhotoToAttachment(t *testing.T) {
+	fake, srv := newFakeTelegramAPI([]TelegramUpdate{{
+		UpdateID: 41,
+		Message: &TelegramMessage{
+			MessageID: 7,
+			From:      &TelegramUser{ID: 1001, FirstName: "Ann", Username: "ann"},
+			Chat:      TelegramChat{ID: 555, Type: "private"},
+			Date:      1700000000,
+			Caption:   "see screenshot",
+			Photo: []TelegramPhotoSize{
+				{FileID: "small", FileUniqueID: "u1", Width: 90, Height: 90},
+				{FileID: "large", FileUniqueID: "u2", Width: 800, Height: 600, FileSize: 2048},
+			},
+		},
+	}})
+	defer srv.Close()
+
+	a := NewTelegramAdapter(TelegramAdapterConfig{BotToken: "token", APIBaseURL: srv.URL, PollTimeout: time.Second})
+	if err := a.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer a.Stop()
+
+	select {
+	case msg := <-a.ReceiveMessage():
+		if msg.UserID != "555" || msg.PlatformID != "telegram" {
+			t.Fatalf("unexpected routing fields: %+v", msg)
+		}
+		if msg.Type != MessageTypeImage || msg.Content != "see screenshot" {
+			t.Fatalf("unexpected content/type: %+v", msg)
+		}
+		if len(msg.Attachments) != 1 {
+			t.Fatalf("expected 1 attachment, got %d", len(msg.Attachments))
+		}
+		att := msg.Attachments[0]
+		// 附件地址指向服务端代理，不包含 bot token，也不在接收时调用 getFile
+		if att.URL != TelegramFileProxyPath+"large" || att.FileID != "large" || att.Size != 2048 {
+			t.Fatalf("unexpected attachment: %+v", att)
+		}
+		if len(fake.callsOf("getFile")) != 0 {
+			t.Fatal("getFile should not be called when receiving")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no message received from polling")
+	}
+
+	// 下一次轮询应携带 offset = update_id + 1
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		calls := fake.callsOf("getUpdates")
+		if len(calls) >= 2 {
+			if off, _ := calls[1]["offset"].(float64); off != 42 {
+				t.Fatalf("expected offset 42, got %v", calls[1]["offset"])
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("adapter did not poll again")
+}
+
+func TestTelegramAdapter_SendMessageAndAttachments(t *testing.T) {
+	fake, srv := newFakeTelegramAPI(nil)
+	defer srv.Close()
+
+	uploads := t.TempDir()
+	a := NewTelegramAdapter(TelegramAdapterConfig{BotToken: "token", APIBaseURL: srv.URL, UploadDir: uploads})
+
+	if err := a.SendMessage("555", "hello"); err != nil {
+		t.Fatalf("send message: %v", err)
+	}
+	calls := fake.callsOf("sendMessage")
+	if len(calls) != 1 || calls[0]["chat_id"] != "555" || calls[0]["text"] != "hello" {
+		t.Fatalf("unexpected sendMessage calls: %+v", calls)
+	}
+
+	if err := a.SendAttachment("555", Attachment{Type: "image", URL: "https://cdn.example.com/a.png"}); err != nil {
+		t.Fatalf("send photo: %v", err)
+	}
+	if calls := fake.callsOf("sendPhoto"); len(calls) != 1 || calls[0]["photo"] != "https://cdn.example.com/a.png" {
+		t.Fatalf("unexpected sendPhoto calls: %+v", calls)
+	}
+
+	local := filepath.Join(uploads, "report.pdf")
+	if err := os.WriteFile(local, []byte("%PDF-1.4"), 0o600); err != nil {
+		t.Fatalf("write temp file: %v", err)
+	}
+	if err := a.SendAttachment("555", Attachment{Type: "file", URL: local, Name: "report.pdf"}); err != nil {
+		t.Fatalf("send document: %v", err)
+	}
+	fake.mu.Lock()
+	form := fake.lastForm
+	fake.mu.Unlock()
+	if form["chat_id"] != "555" || form["document"] != "report.pdf" {
+		t.Fatalf("unexpected multipart form: %+v", form)
+	}
+
+	// 上传目录之外的文件（含指向目录外的符号链接）拒绝上传
+	outside := filepath.Join(t.TempDir(), "passwd")
+	if err := os.WriteFile(outside, []byte("root"), 0o600); err != nil {
+		t.Fatalf("write temp file: %v", err)
+	}
+	link := filepath.Join(uploads, "link")
+	if err := os.Symlink(outside, link); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+	for _, p := range []string{outside, link, filepath.Join(uploads, "..", filepath.Base(filepath.Dir(outside)), "passwd")} {
+		if err := a.SendAttachment("555", Attachment{Type: "file", URL: p}); !errors.Is(err, ErrAttachmentOutsideUploadDir) {
+			t.Fatalf("send %s: err = %v", p, err)
+		}
+	}
+	if err := NewTelegramAdapter(TelegramAdapterConfig{BotToken: "token", APIBaseURL: srv.URL}).SendAttachment("555", Attachment{URL: local}); !errors.Is(err, ErrAttachmentOutsideUploadDir) {
+		t.Fatalf("no upload dir: err = %v", err)
+	}
+	if n := len(fake.callsOf("sendDocument")); n != 1 {
+		t.Fatalf("sendDocument calls = %d, want 1", n)
+	}
+}
+
+func TestTelegramAdapter_OpenFile(t *testing.T) {
+	_, srv := newFakeTelegramAPI(nil)
+	defer srv.Close()
+
+	a := NewTelegramAdapter(TelegramAdapterConfig{BotToken: "token", APIBaseURL: srv.URL})
+	file, err := a.OpenFile(context.Background(), "doc1")
+	if err != nil {
+		t.Fatalf("open file: %v", err)
+	}
+	defer file.Body.Close()
+	body, _ := io.ReadAll(file.Body)
+	if string(body) != "content of doc1" || file.Name != "doc1" || file.ContentType != "application/pdf" {
+		t.Fatalf("unexpected file: %+v body=%q", file, body)
+	}
+
+	if _, err := a.OpenFile(context.Background(), "missing"); !errors.Is(err, ErrTelegramFileNotFound) {
+		t.Fatalf("invalid file_id err = %v", err)
+	}
+
+	// 网络错误中不得带出包含 bot token 的请求地址
+	srv.Close()
+	if _, err := a.OpenFile(context.Background(), "doc1"); err == nil || strings.Contains(err.Error(), "token") {
+		t.Fatalf("network error = %v", err)
+	}
+}
+
+func TestTelegramAdapter_APIErrorSurfaced(t *testing.T) {
+	_, srv := newFakeTelegramAPI(nil)
+	defer srv.Close()
+
+	a := NewTelegramAdapter(TelegramAdapterConfig{BotToken: "wrong", APIBaseURL: srv.URL})
+	err := a.SendMessage("1", "hi")
+	if err == nil || !strings.Contains(err.Error(), "Not Found") {
+		t.Fatalf("expected API error, got %v", err)
+	}
+}
+
+func TestTelegramAdapter_WebhookModeRequiresSecret(t *testing.T) {
+	fake, srv := newFakeTelegramAPI(nil)
+	defer srv.Close()
+
+	a := NewTelegramAdapter(TelegramAdapterConfig{
+		BotToken:   "token",
+		APIBaseURL: srv.URL,
+		Mode:       "webhook",
+		WebhookURL: "https://example.com/api/v1/channels/telegram/webhook",
+	})
+	if err := a.Start(); err == nil {
+		a.Stop()
+		t.Fatal("webhook mode without secret should not start")
+	}
+	if len(fake.callsOf("setWebhook")) != 0 {
+		t.Fatal("webhook must not be registered without secret")
+	}
+	// 即便路由已注册，未配置 secret 时拒绝所有请求
+	if a.VerifyWebhookSecret("") || a.VerifyWebhookSecret("anything") {
+		t.Fatal("empty secret must reject every request")
+	}
+}
+
+func TestTelegramAdapter_WebhookMode(t *testing.T) {
+	fake, srv := newFakeTelegramAPI(nil)
+	defer srv.Close()
+
+	a := NewTelegramAdapter(TelegramAdapterConfig{
+		BotToken:      "token",
+		APIBaseURL:    srv.URL,
+		Mode:          "webhook",
+		WebhookURL:    "https://example.com/api/v1/channels/telegram/webhook",
+		WebhookSecret: "s3cret",
+	})
+	if err := a.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer a.Stop()
+
+	hooks := fake.callsOf("setWebhook")
+	if len(hooks) != 1 || hooks[0]["secret_token"] != "s3cret" {
+		t.Fatalf("expected setWebhook with secret, got %+v", hooks)
+	}
+	if len(fake.callsOf("getUpdates")) != 0 {
+		t.Fatal("webhook mode must not poll")
+	}
+
+	if a.VerifyWebhookSecret("nope") || !a.VerifyWebhookSecret("s3cret") {
+		t.Fatal("secret verification mismatch")
+	}
+
+	err := a.HandleUpdate(context.Background(), &TelegramUpdate{
+		UpdateID: 1,
+		Message: &TelegramMessage{
+			MessageID: 2,
+			Chat:      TelegramChat{ID: -100, Type: "group"},
+			Document:  &TelegramDocument{FileID: "doc1", FileName: "log.txt", FileSize: 12},
+		},
+	})
+	if err != nil {
+		t.Fatalf("handle update: %v", err)
+	}
+	msg := <-a.ReceiveMessage()
+	if msg.Type != MessageTypeFile || len(msg.Attachments) != 1 || msg.Attachments[0].Name != "log.txt" {
+		t.Fatalf("unexpected document mapping: %+v", msg)
+	}
+
+	// 机器人自身发送的消息应被忽略
+	_ = a.HandleUpdate(context.Background(), &TelegramUpdate{
+		Message: &TelegramMessage{From: &TelegramUser{ID: 9, IsBot: true}, Chat: TelegramChat{ID: 1}, Text: "echo"},
+	})
+	select {
+	case m := <-a.ReceiveMessage():
+		t.Fatalf("bot message should be dropped, got %+v", m)
+	default:
+	}
+}
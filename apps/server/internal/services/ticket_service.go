@@ -23,6 +23,10 @@ type TicketService struct {
 	slaService   *SLAService
 	automation   *AutomationService
 	satisfaction *SatisfactionService
+	email        *EmailService
+	realtime     *AgentRealtimeService
+	triage       *TicketTriageService
+	summaries    *SummaryService
 }
 
 // NewTicketService 创建工单服务
@@ -48,6 +52,26 @@ func (s *TicketService) SetSatisfactionService(satisfaction *SatisfactionService
 	s.satisfaction = satisfaction
 }
 
+// SetEmailService 注入邮件渠道服务（公开评论回发给邮件客户）
+func (s *TicketService) SetEmailService(email *EmailService) {
+	s.email = email
+}
+
+// SetAgentRealtimeService 注入坐席工作台服务（指派时实时通知坐席）
+func (s *TicketService) SetAgentRealtimeService(realtime *AgentRealtimeService) {
+	s.realtime = realtime
+}
+
+// SetTriageService 注入工单分流服务（创建后异步预测分类、优先级、情绪与标签）
+func (s *TicketService) SetTriageService(triage *TicketTriageService) {
+	s.triage = triage
+}
+
+// SetSummaryService 注入摘要服务（工单解决或关闭时生成结构化摘要）
+func (s *TicketService) SetSummaryService(summaries *SummaryService) {
+	s.summaries = summaries
+}
+
 // TicketCreateRequest 创建工单请求
 type TicketCreateRequest struct {
 	Title        string                 `json:"title" binding:"required"`
@@ -118,6 +142,9 @@ func (s *TicketService) CreateTicket(ctx context.Context, req *TicketCreateReque
 		return nil, fmt.Errorf("customer not found: %w", err)
 	}
 
+	// 模型分流在创建后异步执行，需保留请求原本是否指定了分类与优先级
+	triageReq := *req
+
 	// 设置默认值
 	if req.Category == "" {
 		req.Category = "general"
@@ -179,6 +206,10 @@ func (s *TicketService) CreateTicket(ctx context.Context, req *TicketCreateReque
 
 	s.logger.Infof("Created ticket %d for customer %d", ticket.ID, req.CustomerID)
 
+	if s.triage != nil {
+		go s.triageTicket(ticket.ID, &triageReq)
+	}
+
 	createdTicket, err := s.GetTicketByID(ctx, ticket.ID)
 	if err != nil {
 		return nil, err
@@ -190,6 +221,24 @@ func (s *TicketService) CreateTicket(ctx context.Context, req *TicketCreateReque
 	return createdTicket, nil
 }
 
+// triageTicket 模型分流（不阻塞建单），结果以更新写入工单；优先级变化时重新检查 SLA
+func (s *TicketService) triageTicket(ticketID uint, req *TicketCreateRequest) {
+	ctx := context.Background()
+	row, err := s.triage.triage(ctx, ticketID, req)
+	if err != nil {
+		s.logger.Warnf("triage: ticket %d skipped: %v", ticketID, err)
+		return
+	}
+	if strings.Contains(row.Applied, "priority") {
+		if ticket, err := s.GetTicketByID(ctx, ticketID); err == nil {
+			s.evaluateTicketSLA(ctx, ticket, false, false)
+		}
+	}
+	if s.automation != nil {
+		s.automation.HandleEvent(ctx, AutomationEvent{Type: "ticket_triaged", TicketID: ticketID, Payload: row})
+	}
+}
+
 // GetTicketByID 根据ID获取工单
 func (s *TicketService) GetTicketByID(ctx context.Context, ticketID uint) (*models.Ticket, error) {
 	var ticket models.Ticket
@@ -215,6 +264,18 @@ func (s *TicketService) GetTicketByID(ctx context.Context, ticketID uint) (*mode
 	return &ticket, nil
 }
 
+// ListTicketTriages 工单的分流预测记录（新的在前）
+func (s *TicketService) ListTicketTriages(ctx context.Context, ticketID uint) ([]models.TicketTriage, error) {
+	if err := s.db.WithContext(ctx).Select("id").First(&models.Ticket{}, ticketID).Error; err != nil {
+		return nil, fmt.Errorf("ticket not found: %w", err)
+	}
+	var rows []models.TicketTriage
+	if err := s.db.WithContext(ctx).Where("ticket_id = ?", ticketID).Order("id DESC").Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to list triages: %w", err)
+	}
+	return rows, nil
+}
+
 // UpdateTicket 更新工单
 func (s *TicketService) UpdateTicket(ctx context.Context, ticketID uint, req *TicketUpdateRequest, userID uint) (*models.Ticket, error) {
 	// 获取原工单
@@ -304,6 +365,9 @@ func (s *TicketService) UpdateTicket(ctx context.Context, ticketID uint, req *Ti
 
 	// 根据状态/指派变更触发 SLA 处理
 	s.evaluateTicketSLA(ctx, updatedTicket, statusChanged, agentChanged)
+	if statusChanged {
+		s.summarizeOnStatus(updatedTicket)
+	}
 
 	return updatedTicket, nil
 }
@@ -357,8 +421,8 @@ func (s *TicketService) ListTickets(ctx context.Context, req *TicketListRequest)
 	// 搜索条件
 	if req.Search != "" {
 		searchTerm := "%" + req.Search + "%"
-		query = query.Where("title ILIKE ? OR description ILIKE ? OR tags ILIKE ?",
-			searchTerm, searchTerm, searchTerm)
+		query = query.Where("title ILIKE ? OR description ILIKE ? OR tags ILIKE ? OR summary ILIKE ?",
+			searchTerm, searchTerm, searchTerm, searchTerm)
 	}
 
 	// 获取总数
@@ -464,6 +528,9 @@ func (s *TicketService) AssignTicket(ctx context.Context, ticketID uint, agentID
 			s.resolveTicketSLAViolations(ctx, updatedTicket.ID, []string{"first_response"})
 		}
 		s.evaluateTicketSLA(ctx, updatedTicket, fromStatus != toStatus, true)
+		if s.realtime != nil {
+			s.realtime.NotifyTicketAssigned(updatedTicket)
+		}
 	} else {
 		s.logger.Warnf("Failed to fetch ticket %d after assignment for SLA evaluation: %v", ticketID, err)
 	}
@@ -622,6 +689,11 @@ func (s *TicketService) AddComment(ctx context.Context, ticketID uint, userID ui
 
 	s.logger.Infof("Added comment to ticket %d by user %d", ticketID, userID)
 
+	if s.email != nil && commentType == "comment" {
+		notify := *comment
+		go s.email.NotifyComment(&notify)
+	}
+
 	return comment, nil
 }
 
@@ -662,6 +734,9 @@ func (s *TicketService) CloseTicket(ctx context.Context, ticketID uint, userID u
 
 	s.logger.Infof("Closed ticket %d by user %d", ticketID, userID)
 
+	ticket.Status = "closed"
+	s.summarizeOnStatus(ticket)
+
 	// 触发 CSAT 调查
 	if s.satisfaction != nil {
 		if _, err := s.satisfaction.ScheduleSurvey(ctx, ticket); err != nil {
@@ -800,6 +875,19 @@ func (s *TicketService) evaluateTicketSLA(ctx context.Context, ticket *models.Ti
 	}
 }
 
+// summarizeOnStatus 工单解决时异步生成摘要；未经解决直接关闭（尚无摘要）时同样生成
+func (s *TicketService) summarizeOnStatus(ticket *models.Ticket) {
+	if s.summaries == nil {
+		return
+	}
+	switch {
+	case ticket.Status == "resolved":
+		s.summaries.SummarizeTicketAsync(ticket.ID, SummaryTriggerResolved)
+	case ticket.Status == "closed" && ticket.Summary == "":
+		s.summaries.SummarizeTicketAsync(ticket.ID, SummaryTriggerClosed)
+	}
+}
+
 // resolveTicketSLAViolations 包装方法
 func (s *TicketService) resolveTicketSLAViolations(ctx context.Context, ticketID uint, types []string) {
 	if s.slaService == nil {
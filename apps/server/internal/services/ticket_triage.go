@@ -0,0 +1,251 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"servify/apps/server/internal/models"
+)
+
+// 工单分流可预测的优先级与情绪；urgent 仅由坐席设置，与 create_ticket 工具一致
+var (
+	triagePriorities = []string{"low", "normal", "high"}
+	triageSentiments = []string{"positive", "neutral", "negative", "angry"}
+)
+
+// TicketTriageConfig 工单分流配置
+type TicketTriageConfig struct {
+	Threshold  float64       // 置信度不低于该值才写入工单，默认 0.7
+	Categories []string      // 可选分类，默认 technical、billing、general、complaint
+	Tags       []string      // 标签词表；为空时不限制
+	MaxTags    int           // 最多写入的标签数，默认 3
+	Timeout    time.Duration // 单次预测超时，默认 10s
+}
+
+// TriageLabel 单项预测及置信度（0-1）
+type TriageLabel struct {
+	Value      string  `json:"value"`
+	Confidence float64 `json:"confidence"`
+}
+
+// TriageTag 预测的标签
+type TriageTag struct {
+	Name       string  `json:"name"`
+	Confidence float64 `json:"confidence"`
+}
+
+// TriagePrediction 模型给出的分流结果
+type TriagePrediction struct {
+	Category  TriageLabel `json:"category"`
+	Priority  TriageLabel `json:"priority"`
+	Sentiment TriageLabel `json:"sentiment"`
+	Tags      []TriageTag `json:"tags"`
+}
+
+// TicketTriageService 在工单创建后调用模型预测分类、优先级、情绪与标签
+type TicketTriageService struct {
+	db     *gorm.DB
+	ai     *AIService
+	cfg    TicketTriageConfig
+	logger *logrus.Logger
+}
+
+// NewTicketTriageService 创建工单分流服务
+func NewTicketTriageService(db *gorm.DB, ai *AIService, cfg TicketTriageConfig, logger *logrus.Logger) *TicketTriageService {
+	if logger == nil {
+		logger = logrus.New()
+	}
+	if cfg.Threshold <= 0 {
+		cfg.Threshold = 0.7
+	}
+	if len(cfg.Categories) == 0 {
+		cfg.Categories = []string{"technical", "billing", "general", "complaint"}
+	}
+	cfg.Tags = normalizeTags(cfg.Tags)
+	if cfg.MaxTags <= 0 {
+		cfg.MaxTags = 3
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	return &TicketTriageService{db: db, ai: ai, cfg: cfg, logger: logger}
+}
+
+func (s *TicketTriageService) systemPrompt() string {
+	var b strings.Builder
+	b.WriteString("你是客服工单分流助手。根据工单标题、描述与对话记录判断：\n")
+	fmt.Fprintf(&b, "- category：取值 %s\n", strings.Join(s.cfg.Categories, "、"))
+	fmt.Fprintf(&b, "- priority：取值 %s（影响业务或资金、客户强烈不满时为 high）\n", strings.Join(triagePriorities, "、"))
+	fmt.Fprintf(&b, "- sentiment：客户情绪，取值 %s\n", strings.Join(triageSentiments, "、"))
+	if len(s.cfg.Tags) > 0 {
+		fmt.Fprintf(&b, "- tags：最多 %d 个，只能从 %s 中选择\n", s.cfg.MaxTags, strings.Join(s.cfg.Tags, "、"))
+	} else {
+		fmt.Fprintf(&b, "- tags：最多 %d 个简短的英文小写标签，如 refund、login\n", s.cfg.MaxTags)
+	}
+	b.WriteString("每项给出 0 到 1 的置信度。只输出 JSON，不要其他内容，格式：\n")
+	b.WriteString(`{"category":{"value":"billing","confidence":0.9},"priority":{"value":"normal","confidence":0.6},"sentiment":{"value":"negative","confidence":0.8},"tags":[{"name":"refund","confidence":0.85}]}`)
+	return b.String()
+}
+
+// Predict 预测工单的分类、优先级、情绪与标签；sessionID 非空时带上会话最近的消息
+func (s *TicketTriageService) Predict(ctx context.Context, title, description, sessionID string) (*TriagePrediction, error) {
+	if s.ai == nil || !s.ai.LLM().HasProviders() {
+		return nil, ErrNoLLMProvider
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.Timeout)
+	defer cancel()
+	if sessionID != "" {
+		ctx = withUsageSession(ctx, sessionID)
+	}
+
+	user := fmt.Sprintf("标题：%s\n描述：%s", title, description)
+	if transcript := s.transcript(ctx, sessionID); transcript != "" {
+		user += "\n\n对话记录：\n" + transcript
+	}
+	text, err := s.ai.callLLM(ctx, LLMUseCaseTriage, LLMRequest{Messages: []Message{
+		{Role: "system", Content: s.systemPrompt()},
+		{Role: "user", Content: user},
+	}})
+	if err != nil {
+		return nil, fmt.Errorf("triage request failed: %w", err)
+	}
+	return s.parse(text)
+}
+
+// transcript 会话最近 20 条客户与坐席消息
+func (s *TicketTriageService) transcript(ctx context.Context, sessionID string) string {
+	if sessionID == "" || s.db == nil {
+		return ""
+	}
+	var msgs []models.Message
+	if err := s.db.WithContext(ctx).
+		Where("session_id = ? AND sender IN ?", sessionID, []string{"user", "agent", "ai"}).
+		Order("created_at DESC, id DESC").Limit(20).
+		Find(&msgs).Error; err != nil {
+		s.logger.Warnf("triage: load messages for session %s failed: %v", sessionID, err)
+		return ""
+	}
+	lines := make([]string, 0, len(msgs))
+	for i := len(msgs) - 1; i >= 0; i-- {
+		role := "客服"
+		if msgs[i].Sender == "user" {
+			role = "客户"
+		}
+		lines = append(lines, role+": "+msgs[i].Content)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// parse 解析模型输出；取值不在候选范围内的项置信度记为 0
+func (s *TicketTriageService) parse(text string) (*TriagePrediction, error) {
+	start, end := strings.Index(text, "{"), strings.LastIndex(text, "}")
+	if start < 0 || end <= start {
+		return nil, fmt.Errorf("triage response is not JSON: %q", text)
+	}
+	var p TriagePrediction
+	if err := json.Unmarshal([]byte(text[start:end+1]), &p); err != nil {
+		return nil, fmt.Errorf("invalid triage response: %w", err)
+	}
+	p.Category = normalizeTriageLabel(p.Category, s.cfg.Categories)
+	p.Priority = normalizeTriageLabel(p.Priority, triagePriorities)
+	p.Sentiment = normalizeTriageLabel(p.Sentiment, triageSentiments)
+
+	tags := make([]TriageTag, 0, len(p.Tags))
+	seen := make(map[string]bool)
+	for _, t := range p.Tags {
+		name := strings.ToLower(strings.TrimSpace(t.Name))
+		if name == "" || seen[name] || (len(s.cfg.Tags) > 0 && !containsFold(s.cfg.Tags, name)) {
+			continue
+		}
+		seen[name] = true
+		tags = append(tags, TriageTag{Name: name, Confidence: clampConfidence(t.Confidence)})
+	}
+	p.Tags = tags
+	return &p, nil
+}
+
+func normalizeTriageLabel(l TriageLabel, allowed []string) TriageLabel {
+	l.Value = strings.ToLower(strings.TrimSpace(l.Value))
+	if !containsFold(allowed, l.Value) {
+		return TriageLabel{}
+	}
+	l.Confidence = clampConfidence(l.Confidence)
+	return l
+}
+
+func clampConfidence(v float64) float64 {
+	return max(0, min(1, v))
+}
+
+// triage 预测并在同一事务中把达到阈值的结果更新到工单、保存预测记录：分类与优先级仅在创建请求未指定
+// 且仍为默认值时填充（坐席已修改的不覆盖），标签与工单当前标签合并；预测失败时工单保持不变
+func (s *TicketTriageService) triage(ctx context.Context, ticketID uint, req *TicketCreateRequest) (*models.TicketTriage, error) {
+	p, err := s.Predict(ctx, req.Title, req.Description, req.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	thr := s.cfg.Threshold
+	tags, _ := json.Marshal(p.Tags)
+	row := &models.TicketTriage{
+		TicketID:            ticketID,
+		SessionID:           req.SessionID,
+		Category:            p.Category.Value,
+		CategoryConfidence:  p.Category.Confidence,
+		Priority:            p.Priority.Value,
+		PriorityConfidence:  p.Priority.Confidence,
+		Sentiment:           p.Sentiment.Value,
+		SentimentConfidence: p.Sentiment.Confidence,
+		Tags:                string(tags),
+		Threshold:           thr,
+	}
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var ticket models.Ticket
+		if err := tx.First(&ticket, ticketID).Error; err != nil {
+			return fmt.Errorf("ticket not found: %w", err)
+		}
+		updates := map[string]interface{}{}
+		var applied []string
+		if req.Category == "" && ticket.Category == "general" && p.Category.Value != "" && p.Category.Confidence >= thr {
+			updates["category"] = p.Category.Value
+			applied = append(applied, "category")
+		}
+		if req.Priority == "" && ticket.Priority == "normal" && p.Priority.Value != "" && p.Priority.Confidence >= thr {
+			updates["priority"] = p.Priority.Value
+			applied = append(applied, "priority")
+		}
+		if p.Sentiment.Value != "" && p.Sentiment.Confidence >= thr {
+			updates["sentiment"] = p.Sentiment.Value
+			applied = append(applied, "sentiment")
+		}
+		var predicted []string
+		for _, t := range p.Tags {
+			if t.Confidence >= thr && len(predicted) < s.cfg.MaxTags {
+				predicted = append(predicted, t.Name)
+			}
+		}
+		if len(predicted) > 0 {
+			updates["tags"] = strings.Join(normalizeTags(append(splitTags(ticket.Tags), predicted...)), ",")
+			applied = append(applied, "tags")
+		}
+		if len(updates) > 0 {
+			if err := tx.Model(&ticket).Updates(updates).Error; err != nil {
+				return fmt.Errorf("failed to apply triage: %w", err)
+			}
+		}
+		row.Applied = strings.Join(applied, ",")
+		if err := tx.Create(row).Error; err != nil {
+			return fmt.Errorf("failed to save triage: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return row, nil
+}
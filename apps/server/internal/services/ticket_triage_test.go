@@ -0,0 +1,145 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"servify/apps/server/internal/models"
+)
+
+func TestTicketService_CreateTicketWithTriage(t *testing.T) {
+	db := newTicketServiceTestDB(t)
+	if err := db.AutoMigrate(&models.TicketTriage{}, &models.Message{}, &models.AutomationTrigger{}, &models.AutomationRun{}); err != nil {
+		t.Fatalf("auto migrate: %v", err)
+	}
+	db.Create(&models.User{ID: 7, Username: "alice", Email: "alice@example.com", Role: "customer"})
+	db.Create(&models.Session{ID: "s1", UserID: 7, Status: "active", Platform: "web"})
+	db.Create(&models.Message{SessionID: "s1", Content: "扣了两次钱，赶紧退给我！", Type: "text", Sender: "user"})
+
+	reply := `好的：{"category":{"value":"Billing","confidence":0.92},"priority":{"value":"high","confidence":0.55},` +
+		`"sentiment":{"value":"angry","confidence":0.9},"tags":[{"name":"refund","confidence":0.8},{"name":"login","confidence":0.3},{"name":"double-charge","confidence":0.95}]}`
+	var (
+		mu      sync.Mutex
+		prompts []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req OpenAIRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		prompts = append(prompts, req.Messages[1].Content)
+		out, _ := json.Marshal(reply)
+		mu.Unlock()
+		fmt.Fprintf(w, `{"choices":[{"message":{"role":"assistant","content":%s}}]}`, out)
+	}))
+	defer srv.Close()
+
+	automation := NewAutomationService(db, nil)
+	_, _ = automation.CreateTrigger(context.Background(), &AutomationTriggerRequest{
+		Name:       "愤怒客户",
+		Event:      "ticket_triaged",
+		Conditions: []TriggerCondition{{Field: "triage.sentiment", Op: "eq", Value: "angry"}, {Field: "triage.sentiment_confidence", Op: "gte", Value: 0.8}},
+		Actions:    []TriggerAction{{Type: "add_tag", Params: map[string]interface{}{"tag": "escalate"}}},
+	})
+	svc := NewTicketService(db, nil, nil)
+	svc.SetAutomationService(automation)
+	svc.SetTriageService(NewTicketTriageService(db, NewAIService("sk", srv.URL), TicketTriageConfig{Tags: []string{"refund", "login"}}, nil))
+	ctx := context.Background()
+
+	ticket, err := svc.CreateTicket(ctx, &TicketCreateRequest{Title: "重复扣款", Description: "订单被扣款两次", CustomerID: 7, Tags: "vip", SessionID: "s1"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	// 建单不等待模型：先以默认值创建，分流结果随后以更新写入
+	if ticket.Category != "general" || ticket.Priority != "normal" || ticket.Sentiment != "" || ticket.Tags != "vip" {
+		t.Fatalf("created ticket = %+v", ticket)
+	}
+	rows := waitTicketTriages(t, svc, ticket.ID)
+	if r := rows[0]; r.Category != "billing" || r.Priority != "high" || r.PriorityConfidence != 0.55 || r.Applied != "category,sentiment,tags" || r.SessionID != "s1" || r.Threshold != 0.7 ||
+		!strings.Contains(r.Tags, `"login"`) || strings.Contains(r.Tags, "double-charge") {
+		t.Fatalf("triage row = %+v", r)
+	}
+	// 分类达到阈值写入；优先级置信度不足保持默认值；词表外的标签被丢弃
+	var got models.Ticket
+	db.First(&got, ticket.ID)
+	if got.Category != "billing" || got.Priority != "normal" || got.Sentiment != "angry" ||
+		!strings.Contains(got.Tags, "refund") || !strings.Contains(got.Tags, "vip") || strings.Contains(got.Tags, "login") {
+		t.Fatalf("triaged ticket = %+v", got)
+	}
+	mu.Lock()
+	prompt := prompts[0]
+	mu.Unlock()
+	if !strings.Contains(prompt, "标题：重复扣款") || !strings.Contains(prompt, "客户: 扣了两次钱，赶紧退给我！") {
+		t.Fatalf("prompt = %s", prompt)
+	}
+
+	// ticket_triaged 事件异步触发自动化
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		var got models.Ticket
+		db.First(&got, ticket.ID)
+		if strings.Contains(got.Tags, "escalate") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("automation not triggered, tags = %q", got.Tags)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	// 请求已指定的分类不被覆盖
+	ticket, err = svc.CreateTicket(ctx, &TicketCreateRequest{Title: "扣款问题", CustomerID: 7, Category: "technical"})
+	if err != nil {
+		t.Fatalf("create explicit: %v", err)
+	}
+	if rows := waitTicketTriages(t, svc, ticket.ID); rows[0].Applied != "sentiment,tags" {
+		t.Fatalf("explicit category triage = %+v", rows[0])
+	}
+	var explicit models.Ticket
+	db.First(&explicit, ticket.ID)
+	if explicit.Category != "technical" {
+		t.Fatalf("explicit category = %+v", explicit)
+	}
+
+	// 模型输出无法解析时工单保持不变，不记录预测
+	mu.Lock()
+	reply = "抱歉，我无法判断"
+	mu.Unlock()
+	ticket, err = svc.CreateTicket(ctx, &TicketCreateRequest{Title: "其他", CustomerID: 7})
+	if err != nil {
+		t.Fatalf("create fallback: %v", err)
+	}
+	svc.triageTicket(ticket.ID, &TicketCreateRequest{Title: "其他", CustomerID: 7})
+	var fallback models.Ticket
+	db.First(&fallback, ticket.ID)
+	if fallback.Category != "general" || fallback.Sentiment != "" {
+		t.Fatalf("fallback = %+v", fallback)
+	}
+	if rows, _ := svc.ListTicketTriages(ctx, ticket.ID); len(rows) != 0 {
+		t.Fatalf("unexpected triage rows: %+v", rows)
+	}
+	if _, err := svc.ListTicketTriages(ctx, 999); err == nil {
+		t.Fatal("missing ticket should fail")
+	}
+}
+
+func waitTicketTriages(t *testing.T, svc *TicketService, ticketID uint) []models.TicketTriage {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		rows, err := svc.ListTicketTriages(context.Background(), ticketID)
+		if err == nil && len(rows) > 0 {
+			return rows
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("ticket %d not triaged: %v", ticketID, err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
@@ -0,0 +1,246 @@
+package services
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs"
+	"github.com/pion/webrtc/v3/pkg/media/samplebuilder"
+)
+
+// Matroska/EBML 元素 ID（仅录制所需的子集）
+const (
+	ebmlHeaderID         = 0x1A45DFA3
+	ebmlVersionID        = 0x4286
+	ebmlReadVersionID    = 0x42F7
+	ebmlMaxIDLengthID    = 0x42F2
+	ebmlMaxSizeLengthID  = 0x42F3
+	ebmlDocTypeID        = 0x4282
+	ebmlDocTypeVerID     = 0x4287
+	ebmlDocTypeReadVerID = 0x4285
+	mkvSegmentID         = 0x18538067
+	mkvInfoID            = 0x1549A966
+	mkvTimecodeScaleID   = 0x2AD7B1
+	mkvMuxingAppID       = 0x4D80
+	mkvWritingAppID      = 0x5741
+	mkvTracksID          = 0x1654AE6B
+	mkvTrackEntryID      = 0xAE
+	mkvTrackNumberID     = 0xD7
+	mkvTrackUIDID        = 0x73C5
+	mkvTrackTypeID       = 0x83
+	mkvCodecIDID         = 0x86
+	mkvVideoID           = 0xE0
+	mkvPixelWidthID      = 0xB0
+	mkvPixelHeightID     = 0xBA
+	mkvClusterID         = 0x1F43B675
+	mkvTimecodeID        = 0xE7
+	mkvSimpleBlockID     = 0xA3
+)
+
+const (
+	vp8ClockRate      = 90000
+	webmClusterMillis = 5000 // 关键帧处切分 Cluster 的最短间隔
+)
+
+// webmUnknownSize 未知长度（直播式写入，与浏览器 MediaRecorder 输出一致）
+var webmUnknownSize = []byte{0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}
+
+// webmWriter 把 VP8 RTP 流封装为 WebM 文件；实现 media.Writer
+// 首个关键帧到达后才写文件头（需要从关键帧读取分辨率），之前的帧丢弃
+type webmWriter struct {
+	out     *bufio.Writer
+	closer  io.Closer
+	builder *samplebuilder.SampleBuilder
+
+	started   bool
+	lastTS    uint32
+	elapsed   int64 // 自首帧起的 RTP 时钟刻度
+	clusterMS int64
+	inCluster bool
+}
+
+func newWebMWriter(path string) (*webmWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return newWebMWriterWith(f), nil
+}
+
+func newWebMWriterWith(w io.WriteCloser) *webmWriter {
+	return &webmWriter{
+		out:     bufio.NewWriter(w),
+		closer:  w,
+		builder: samplebuilder.New(128, &codecs.VP8Packet{}, vp8ClockRate),
+	}
+}
+
+// WriteRTP 按 RTP 包重组 VP8 帧后写入
+func (w *webmWriter) WriteRTP(packet *rtp.Packet) error {
+	if w.closer == nil {
+		return fmt.Errorf("webm writer closed")
+	}
+	w.builder.Push(packet)
+	for sample := w.builder.Pop(); sample != nil; sample = w.builder.Pop() {
+		if err := w.writeFrame(sample.Data, sample.PacketTimestamp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close 刷新缓冲并关闭文件（可重复调用）
+func (w *webmWriter) Close() error {
+	if w.closer == nil {
+		return nil
+	}
+	flushErr := w.out.Flush()
+	closeErr := w.closer.Close()
+	w.closer = nil
+	if flushErr != nil {
+		return flushErr
+	}
+	return closeErr
+}
+
+func (w *webmWriter) writeFrame(frame []byte, timestamp uint32) error {
+	if len(frame) == 0 {
+		return nil
+	}
+	keyframe := frame[0]&0x01 == 0
+	if !w.started {
+		if !keyframe {
+			return nil
+		}
+		width, height, ok := vp8Dimensions(frame)
+		if !ok {
+			return nil
+		}
+		if err := w.writeHeader(width, height); err != nil {
+			return err
+		}
+		w.started = true
+		w.lastTS = timestamp
+	}
+	// 按有符号差值累加，容忍 RTP 时间戳回绕与轻微乱序
+	w.elapsed += int64(int32(timestamp - w.lastTS))
+	w.lastTS = timestamp
+	ms := w.elapsed * 1000 / vp8ClockRate
+
+	rel := ms - w.clusterMS
+	if !w.inCluster || rel < 0 || rel > 0x7FFF || (keyframe && rel >= webmClusterMillis) {
+		if _, err := w.out.Write(ebmlID(mkvClusterID)); err != nil {
+			return err
+		}
+		if _, err := w.out.Write(webmUnknownSize); err != nil {
+			return err
+		}
+		if _, err := w.out.Write(ebmlUint(mkvTimecodeID, uint64(max(ms, 0)))); err != nil {
+			return err
+		}
+		w.clusterMS = max(ms, 0)
+		w.inCluster = true
+		rel = ms - w.clusterMS
+	}
+
+	block := make([]byte, 4, 4+len(frame))
+	block[0] = 0x81 // 轨道号 1（EBML 变长整数）
+	binary.BigEndian.PutUint16(block[1:3], uint16(int16(rel)))
+	if keyframe {
+		block[3] = 0x80
+	}
+	block = append(block, frame...)
+	_, err := w.out.Write(ebmlElement(mkvSimpleBlockID, block))
+	return err
+}
+
+func (w *webmWriter) writeHeader(width, height uint16) error {
+	header := ebmlElement(ebmlHeaderID, concatBytes(
+		ebmlUint(ebmlVersionID, 1),
+		ebmlUint(ebmlReadVersionID, 1),
+		ebmlUint(ebmlMaxIDLengthID, 4),
+		ebmlUint(ebmlMaxSizeLengthID, 8),
+		ebmlString(ebmlDocTypeID, "webm"),
+		ebmlUint(ebmlDocTypeVerID, 2),
+		ebmlUint(ebmlDocTypeReadVerID, 2),
+	))
+	info := ebmlElement(mkvInfoID, concatBytes(
+		ebmlUint(mkvTimecodeScaleID, 1000000), // 1ms
+		ebmlString(mkvMuxingAppID, "servify"),
+		ebmlString(mkvWritingAppID, "servify"),
+	))
+	tracks := ebmlElement(mkvTracksID, ebmlElement(mkvTrackEntryID, concatBytes(
+		ebmlUint(mkvTrackNumberID, 1),
+		ebmlUint(mkvTrackUIDID, 1),
+		ebmlUint(mkvTrackTypeID, 1), // video
+		ebmlString(mkvCodecIDID, "V_VP8"),
+		ebmlElement(mkvVideoID, concatBytes(
+			ebmlUint(mkvPixelWidthID, uint64(width)),
+			ebmlUint(mkvPixelHeightID, uint64(height)),
+		)),
+	)))
+	_, err := w.out.Write(concatBytes(header, ebmlID(mkvSegmentID), webmUnknownSize, info, tracks))
+	return err
+}
+
+// vp8Dimensions 从 VP8 关键帧头读取分辨率（RFC 6386 9.1）
+func vp8Dimensions(frame []byte) (uint16, uint16, bool) {
+	if len(frame) < 10 || frame[3] != 0x9d || frame[4] != 0x01 || frame[5] != 0x2a {
+		return 0, 0, false
+	}
+	width := binary.LittleEndian.Uint16(frame[6:8]) & 0x3FFF
+	height := binary.LittleEndian.Uint16(frame[8:10]) & 0x3FFF
+	return width, height, true
+}
+
+// ebmlID 元素 ID 已含长度标记位，按最短字节数大端写出
+func ebmlID(id uint32) []byte {
+	switch {
+	case id >= 1<<24:
+		return []byte{byte(id >> 24), byte(id >> 16), byte(id >> 8), byte(id)}
+	case id >= 1<<16:
+		return []byte{byte(id >> 16), byte(id >> 8), byte(id)}
+	case id >= 1<<8:
+		return []byte{byte(id >> 8), byte(id)}
+	default:
+		return []byte{byte(id)}
+	}
+}
+
+// ebmlElement 元素：ID + 8 字节长度 + 内容
+func ebmlElement(id uint32, payload []byte) []byte {
+	size := make([]byte, 8)
+	binary.BigEndian.PutUint64(size, uint64(len(payload)))
+	size[0] = 0x01
+	return concatBytes(ebmlID(id), size, payload)
+}
+
+func ebmlUint(id uint32, v uint64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, v)
+	i := 0
+	for i < 7 && buf[i] == 0 {
+		i++
+	}
+	return ebmlElement(id, buf[i:])
+}
+
+func ebmlString(id uint32, s string) []byte {
+	return ebmlElement(id, []byte(s))
+}
+
+func concatBytes(parts ...[]byte) []byte {
+	n := 0
+	for _, p := range parts {
+		n += len(p)
+	}
+	out := make([]byte, 0, n)
+	for _, p := range parts {
+		out = append(out, p...)
+	}
+	return out
+}
@@ -1,13 +1,22 @@
 package services
 
 import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
+	"servify/apps/server/internal/models"
+
+	"github.com/pion/rtcp"
 	"github.com/pion/webrtc/v3"
 	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
 )
 
 type WebRTCService struct {
@@ -15,7 +24,23 @@ type WebRTCService struct {
 	connections map[string]*WebRTCConnection
 	mutex       sync.RWMutex
 	stunServer  string
+	turnServers []TURNServer
 	wsHub       *WebSocketHub
+	// 可选：持久化连接状态（models.WebRTCConnection）
+	db *gorm.DB
+	// 可选：客户授权后录制远端音视频轨道
+	recorder *CallRecordingService
+}
+
+// TURNServer TURN 中继配置
+// SharedSecret 非空时按 TURN REST API（coturn use-auth-secret）为每个会话签发临时凭据，
+// 否则使用静态 Username/Credential
+type TURNServer struct {
+	URLs          []string
+	Username      string
+	Credential    string
+	SharedSecret  string
+	CredentialTTL time.Duration // 临时凭据有效期，默认 1h
 }
 
 type WebRTCConnection struct {
@@ -23,7 +48,9 @@ type WebRTCConnection struct {
 	SessionID      string
 	PeerConnection *webrtc.PeerConnection
 	DataChannel    *webrtc.DataChannel
+	CoBrowse       *webrtc.DataChannel // 协同浏览数据通道（标签 cobrowse）
 	Status         string
+	Type           string // data, audio, video, screen
 	CreatedAt      time.Time
 }
 
@@ -34,8 +61,12 @@ type WebRTCSignal struct {
 }
 
 func NewWebRTCService(stunServer string, wsHub *WebSocketHub) *WebRTCService {
-	// 创建 WebRTC API
-	api := webrtc.NewAPI()
+	// 创建 WebRTC API（注册默认编解码器，才能接收音视频轨道）
+	m := &webrtc.MediaEngine{}
+	if err := m.RegisterDefaultCodecs(); err != nil {
+		logrus.Warnf("Failed to register WebRTC codecs: %v", err)
+	}
+	api := webrtc.NewAPI(webrtc.WithMediaEngine(m))
 
 	return &WebRTCService{
 		api:         api,
@@ -45,13 +76,75 @@ func NewWebRTCService(stunServer string, wsHub *WebSocketHub) *WebRTCService {
 	}
 }
 
+// SetDB 注入数据库，用于持久化连接状态
+func (s *WebRTCService) SetDB(db *gorm.DB) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.db = db
+}
+
+// SetRecordingService 启用服务端录制（仅录制客户已授权的会话）
+func (s *WebRTCService) SetRecordingService(recorder *CallRecordingService) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.recorder = recorder
+}
+
+func (s *WebRTCService) recording() *CallRecordingService {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.recorder
+}
+
+// SetTURNServers 配置 TURN 中继（与 STUN 一起下发给服务端与客户端的 PeerConnection）
+func (s *WebRTCService) SetTURNServers(servers []TURNServer) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.turnServers = servers
+}
+
+// ICEServers 会话可用的 ICE 服务器（TURN 临时凭据按会话签发）
+func (s *WebRTCService) ICEServers(sessionID string) []webrtc.ICEServer {
+	s.mutex.RLock()
+	turn := s.turnServers
+	s.mutex.RUnlock()
+
+	var servers []webrtc.ICEServer
+	if s.stunServer != "" {
+		servers = append(servers, webrtc.ICEServer{URLs: []string{s.stunServer}})
+	}
+	for _, t := range turn {
+		if len(t.URLs) == 0 {
+			continue
+		}
+		server := webrtc.ICEServer{
+			URLs:           t.URLs,
+			Username:       t.Username,
+			Credential:     t.Credential,
+			CredentialType: webrtc.ICECredentialTypePassword,
+		}
+		if t.SharedSecret != "" {
+			server.Username, server.Credential = turnRESTCredential(t.SharedSecret, sessionID, t.CredentialTTL, time.Now())
+		}
+		servers = append(servers, server)
+	}
+	return servers
+}
+
+// turnRESTCredential 按 TURN REST API 生成临时凭据：username=<过期时间戳>:<会话>，password=base64(HMAC-SHA1(secret, username))
+func turnRESTCredential(secret, sessionID string, ttl time.Duration, now time.Time) (string, string) {
+	if ttl <= 0 {
+		ttl = time.Hour
+	}
+	username := fmt.Sprintf("%d:%s", now.Add(ttl).Unix(), sessionID)
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write([]byte(username))
+	return username, base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
 func (s *WebRTCService) CreatePeerConnection(sessionID string) (*WebRTCConnection, error) {
 	config := webrtc.Configuration{
-		ICEServers: []webrtc.ICEServer{
-			{
-				URLs: []string{s.stunServer},
-			},
-		},
+		ICEServers: s.ICEServers(sessionID),
 	}
 
 	peerConnection, err := s.api.NewPeerConnection(config)
@@ -65,7 +158,8 @@ func (s *WebRTCService) CreatePeerConnection(sessionID string) (*WebRTCConnectio
 		ID:             connectionID,
 		SessionID:      sessionID,
 		PeerConnection: peerConnection,
-		Status:         "created",
+		Status:         "connecting",
+		Type:           "data",
 		CreatedAt:      time.Now(),
 	}
 
@@ -73,6 +167,12 @@ func (s *WebRTCService) CreatePeerConnection(sessionID string) (*WebRTCConnectio
 	peerConnection.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
 		logrus.Infof("WebRTC connection %s state changed to %s", connectionID, state.String())
 		conn.Status = state.String()
+		s.saveStatus(connectionID, state.String())
+		if state == webrtc.PeerConnectionStateFailed || state == webrtc.PeerConnectionStateClosed {
+			s.mutex.Lock()
+			delete(s.connections, connectionID)
+			s.mutex.Unlock()
+		}
 
 		// 通知客户端状态变化
 		s.wsHub.SendToSession(sessionID, WebSocketMessage{
@@ -107,9 +207,18 @@ func (s *WebRTCService) CreatePeerConnection(sessionID string) (*WebRTCConnectio
 		})
 	})
 
+	// 远端媒体轨道：按授权录制
+	peerConnection.OnTrack(func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		s.onTrack(conn, track)
+	})
+
 	// 处理数据通道
 	peerConnection.OnDataChannel(func(dc *webrtc.DataChannel) {
 		logrus.Infof("New data channel for connection %s: %s", connectionID, dc.Label())
+		if dc.Label() == CoBrowseChannelLabel {
+			s.setCoBrowseChannel(conn, dc)
+			return
+		}
 		conn.DataChannel = dc
 
 		dc.OnOpen(func() {
@@ -141,15 +250,30 @@ func (s *WebRTCService) CreatePeerConnection(sessionID string) (*WebRTCConnectio
 	return conn, nil
 }
 
+// HandleOffer 为会话建立服务端 PeerConnection 并返回 answer；同一会话的旧连接会先关闭（每会话一条）
 func (s *WebRTCService) HandleOffer(sessionID string, offer webrtc.SessionDescription) (*webrtc.SessionDescription, error) {
+	return s.HandleOfferAs(sessionID, "", offer)
+}
+
+// HandleOfferAs 同 HandleOffer，connType 非空时覆盖由 SDP 推断的连接类型（如屏幕共享为 screen）
+func (s *WebRTCService) HandleOfferAs(sessionID, connType string, offer webrtc.SessionDescription) (*webrtc.SessionDescription, error) {
+	if err := s.CloseConnection(sessionID); err != nil {
+		logrus.Warnf("Failed to close previous WebRTC connection for session %s: %v", sessionID, err)
+	}
 	conn, err := s.CreatePeerConnection(sessionID)
 	if err != nil {
 		return nil, err
 	}
+	conn.Type = mediaType(offer.SDP)
+	if connType != "" {
+		conn.Type = connType
+	}
+	s.persistConnection(conn)
 
 	// 设置远程描述
 	err = conn.PeerConnection.SetRemoteDescription(offer)
 	if err != nil {
+		_ = s.CloseConnection(sessionID)
 		return nil, fmt.Errorf("failed to set remote description: %w", err)
 	}
 
@@ -204,22 +328,103 @@ func (s *WebRTCService) HandleICECandidate(sessionID string, candidate webrtc.IC
 
 func (s *WebRTCService) CloseConnection(sessionID string) error {
 	s.mutex.Lock()
-	defer s.mutex.Unlock()
-
+	var closing []*WebRTCConnection
 	for id, conn := range s.connections {
 		if conn.SessionID == sessionID {
-			err := conn.PeerConnection.Close()
-			if err != nil {
-				logrus.Errorf("Failed to close peer connection %s: %v", id, err)
-			}
+			closing = append(closing, conn)
 			delete(s.connections, id)
-			logrus.Infof("Closed WebRTC connection %s", id)
 		}
 	}
+	s.mutex.Unlock()
+
+	// 在锁外关闭：Close 会同步触发状态回调
+	for _, conn := range closing {
+		if err := conn.PeerConnection.Close(); err != nil {
+			logrus.Errorf("Failed to close peer connection %s: %v", conn.ID, err)
+		}
+		s.saveStatus(conn.ID, webrtc.PeerConnectionStateClosed.String())
+		logrus.Infof("Closed WebRTC connection %s", conn.ID)
+	}
 
 	return nil
 }
 
+// persistConnection 记录新建的连接
+func (s *WebRTCService) persistConnection(conn *WebRTCConnection) {
+	s.mutex.RLock()
+	db := s.db
+	s.mutex.RUnlock()
+	if db == nil {
+		return
+	}
+	record := &models.WebRTCConnection{
+		ID:             conn.ID,
+		SessionID:      conn.SessionID,
+		Status:         conn.Status,
+		ConnectionType: conn.Type,
+		CreatedAt:      conn.CreatedAt,
+		UpdatedAt:      conn.CreatedAt,
+	}
+	if err := db.Create(record).Error; err != nil {
+		logrus.Warnf("Failed to persist WebRTC connection %s: %v", conn.ID, err)
+	}
+}
+
+// saveStatus 持久化连接状态；closed/failed 时记录结束时间
+func (s *WebRTCService) saveStatus(connectionID, status string) {
+	s.mutex.RLock()
+	db := s.db
+	s.mutex.RUnlock()
+	if db == nil {
+		return
+	}
+	now := time.Now()
+	updates := map[string]interface{}{"status": status, "updated_at": now}
+	if status == webrtc.PeerConnectionStateClosed.String() || status == webrtc.PeerConnectionStateFailed.String() {
+		updates["closed_at"] = now
+	}
+	if err := db.Model(&models.WebRTCConnection{}).
+		Where("id = ? AND closed_at IS NULL", connectionID).
+		Updates(updates).Error; err != nil {
+		logrus.Warnf("Failed to save WebRTC connection %s status: %v", connectionID, err)
+	}
+}
+
+// onTrack 录制远端轨道；视频轨道开始录制后请求关键帧，使文件从可解码的画面开始
+func (s *WebRTCService) onTrack(conn *WebRTCConnection, track *webrtc.TrackRemote) {
+	recorder := s.recording()
+	if recorder == nil {
+		return
+	}
+	source := "call"
+	if conn.Type == "screen" {
+		source = "screen"
+	}
+	rec, err := recorder.RecordTrack(conn.SessionID, conn.ID, source, track)
+	if err != nil {
+		logrus.Warnf("Failed to record track of connection %s: %v", conn.ID, err)
+		return
+	}
+	if rec != nil && track.Kind() == webrtc.RTPCodecTypeVideo {
+		pli := []rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: uint32(track.SSRC())}}
+		if err := conn.PeerConnection.WriteRTCP(pli); err != nil {
+			logrus.Debugf("Failed to request keyframe on connection %s: %v", conn.ID, err)
+		}
+	}
+}
+
+// mediaType 由 offer 中的媒体行判断连接类型
+func mediaType(sdp string) string {
+	switch {
+	case strings.Contains(sdp, "\nm=video"):
+		return "video"
+	case strings.Contains(sdp, "\nm=audio"):
+		return "audio"
+	default:
+		return "data"
+	}
+}
+
 func (s *WebRTCService) getConnectionBySessionID(sessionID string) (*WebRTCConnection, error) {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
@@ -283,6 +488,48 @@ func (s *WebRTCService) SendDataChannelMessage(sessionID, message string) error
 	return nil
 }
 
+// setCoBrowseChannel 协同浏览通道上的消息均按 CoBrowseCommand 解析（客户侧指令）
+func (s *WebRTCService) setCoBrowseChannel(conn *WebRTCConnection, dc *webrtc.DataChannel) {
+	s.mutex.Lock()
+	conn.CoBrowse = dc
+	s.mutex.Unlock()
+
+	dc.OnMessage(func(msg webrtc.DataChannelMessage) {
+		cb := s.wsHub.coBrowse()
+		if cb == nil {
+			return
+		}
+		var cmd CoBrowseCommand
+		err := json.Unmarshal(msg.Data, &cmd)
+		if err == nil {
+			err = cb.HandleCustomerCommand(context.Background(), conn.SessionID, cmd)
+		}
+		if err != nil {
+			reply, _ := json.Marshal(map[string]string{"type": "error", "message": err.Error()})
+			_ = dc.SendText(string(reply))
+		}
+	})
+}
+
+// SendCoBrowseCommand 经协同浏览数据通道向客户下发指令
+func (s *WebRTCService) SendCoBrowseCommand(sessionID string, cmd CoBrowseCommand) error {
+	conn, err := s.getConnectionBySessionID(sessionID)
+	if err != nil {
+		return err
+	}
+	s.mutex.RLock()
+	dc := conn.CoBrowse
+	s.mutex.RUnlock()
+	if dc == nil || dc.ReadyState() != webrtc.DataChannelStateOpen {
+		return fmt.Errorf("cobrowse channel not available for session %s", sessionID)
+	}
+	payload, err := json.Marshal(cmd)
+	if err != nil {
+		return err
+	}
+	return dc.SendText(string(payload))
+}
+
 func (s *WebRTCService) GetConnectionCount() int {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
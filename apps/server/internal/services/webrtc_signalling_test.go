@@ -0,0 +1,142 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"servify/apps/server/internal/models"
+)
+
+func TestWebRTCService_ICEServersWithTURN(t *testing.T) {
+	s := NewWebRTCService("stun:stun.example.com:3478", nil)
+	s.SetTURNServers([]TURNServer{
+		{URLs: []string{"turn:static.example.com:3478"}, Username: "u", Credential: "p"},
+		{URLs: []string{"turn:rest.example.com:3478"}, SharedSecret: "secret", CredentialTTL: time.Minute},
+		{}, // 未配置地址的条目被忽略
+	})
+
+	servers := s.ICEServers("s1")
+	if len(servers) != 3 {
+		t.Fatalf("ice servers = %+v", servers)
+	}
+	if servers[0].URLs[0] != "stun:stun.example.com:3478" || servers[0].Username != "" {
+		t.Fatalf("stun server = %+v", servers[0])
+	}
+	if servers[1].Username != "u" || servers[1].Credential != "p" {
+		t.Fatalf("static turn = %+v", servers[1])
+	}
+
+	rest := servers[2]
+	parts := strings.SplitN(rest.Username, ":", 2)
+	if len(parts) != 2 || parts[1] != "s1" {
+		t.Fatalf("rest username = %q", rest.Username)
+	}
+	mac := hmac.New(sha1.New, []byte("secret"))
+	mac.Write([]byte(rest.Username))
+	if rest.Credential != base64.StdEncoding.EncodeToString(mac.Sum(nil)) {
+		t.Fatalf("rest credential mismatch")
+	}
+}
+
+func TestWebSocketHub_WebRTCOfferAnsweredByServer(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:webrtc_"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.WebRTCConnection{}); err != nil {
+		t.Fatalf("automigrate: %v", err)
+	}
+
+	hub := NewWebSocketHub()
+	go hub.Run()
+	svc := NewWebRTCService("", hub)
+	svc.SetDB(db)
+	hub.SetWebRTCService(svc)
+
+	client := &WebSocketClient{ID: "c1", SessionID: "s1", Role: WSRoleVisitor, Send: make(chan WebSocketMessage, 16), Hub: hub}
+	hub.register <- client
+	waitFor(t, func() bool { return hub.GetClientCount() == 1 })
+
+	// 浏览器侧：带数据通道的 offer
+	peer, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Skipf("peer connection unavailable: %v", err)
+	}
+	defer peer.Close()
+	if _, err := peer.CreateDataChannel("chat", nil); err != nil {
+		t.Fatalf("data channel: %v", err)
+	}
+	offer, err := peer.CreateOffer(nil)
+	if err != nil {
+		t.Fatalf("create offer: %v", err)
+	}
+	if err := peer.SetLocalDescription(offer); err != nil {
+		t.Fatalf("set local: %v", err)
+	}
+
+	client.handleWebRTCOffer(WebSocketMessage{Type: "webrtc-offer", Data: map[string]interface{}{"type": "offer", "sdp": offer.SDP}})
+
+	var answer webrtc.SessionDescription
+	deadline := time.After(3 * time.Second)
+	for answer.SDP == "" {
+		select {
+		case msg := <-client.Send:
+			switch msg.Type {
+			case "webrtc-answer":
+				if err := decodeSignal(msg.Data, &answer); err != nil {
+					t.Fatalf("decode answer: %v", err)
+				}
+			case "webrtc-error":
+				t.Fatalf("signalling error: %v", msg.Data)
+			}
+		case <-deadline:
+			t.Fatal("no answer received")
+		}
+	}
+	if answer.Type != webrtc.SDPTypeAnswer {
+		t.Fatalf("answer type = %s", answer.Type)
+	}
+	if err := peer.SetRemoteDescription(answer); err != nil {
+		t.Fatalf("apply answer: %v", err)
+	}
+
+	var rows []models.WebRTCConnection
+	db.Find(&rows, "session_id = ?", "s1")
+	if len(rows) != 1 || rows[0].ConnectionType != "data" || rows[0].ClosedAt != nil {
+		t.Fatalf("persisted connections = %+v", rows)
+	}
+
+	// 客户端候选被服务端接收；无效候选返回错误帧
+	client.handleWebRTCCandidate(WebSocketMessage{Data: map[string]interface{}{"candidate": map[string]interface{}{"candidate": "not-a-candidate"}}})
+	select {
+	case msg := <-client.Send:
+		for msg.Type == "webrtc-candidate" || msg.Type == "webrtc-state-change" {
+			msg = <-client.Send
+		}
+		if msg.Type != "webrtc-error" {
+			t.Fatalf("expected webrtc-error, got %s", msg.Type)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("invalid candidate should produce an error frame")
+	}
+
+	// 重新协商：旧连接关闭并记录
+	if err := svc.CloseConnection("s1"); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	db.First(&rows[0], "id = ?", rows[0].ID)
+	if rows[0].Status != "closed" || rows[0].ClosedAt == nil {
+		t.Fatalf("closed connection = %+v", rows[0])
+	}
+	if svc.GetConnectionCount() != 0 {
+		t.Fatalf("connection count = %d", svc.GetConnectionCount())
+	}
+}
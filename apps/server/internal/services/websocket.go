@@ -5,12 +5,16 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"github.com/pion/webrtc/v3"
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 	"servify/apps/server/internal/models"
@@ -20,15 +24,56 @@ type WebSocketMessage struct {
 	Type      string      `json:"type"`
 	Data      interface{} `json:"data"`
 	SessionID string      `json:"session_id"`
+	Seq       int64       `json:"seq,omitempty"` // 已落库消息的会话内序号；为 0 表示不可补发的实时事件
 	Timestamp time.Time   `json:"timestamp"`
+	// Origin 事件发起的参与方（visitor / agent:<id>）；该参与方在本会话的连接不会收到回显
+	Origin string `json:"origin,omitempty"`
+}
+
+// WebSocket 连接角色
+const (
+	WSRoleVisitor = "visitor" // 访客（凭会话绑定的访客令牌接入）
+	WSRoleAgent   = "agent"   // 坐席/管理员（凭 JWT 接入）
+)
+
+const (
+	// wsCloseSlowConsumer 发送缓冲溢出时的关闭码，客户端应携带 resume_from 重连补齐
+	wsCloseSlowConsumer = 4008
+	// wsReplayBatch 重连补发时每批读取的消息数
+	wsReplayBatch = 200
+	// wsMaxMessageSize 单帧上限（需容纳 WebRTC SDP）
+	wsMaxMessageSize = 64 << 10
+	// hubBroadcastBuffer 本地投递通道容量
+	hubBroadcastBuffer = 256
+	// hubPendingLimit 投递通道已满时暂存的消息上限，超出后丢弃最旧的消息
+	hubPendingLimit = 10000
+)
+
+// WebSocketIdentity 接入方身份，由 handler 鉴权后传入
+type WebSocketIdentity struct {
+	Role      string
+	UserID    uint
+	SessionID string
 }
 
 type WebSocketClient struct {
 	ID        string
 	SessionID string
+	Role      string
+	UserID    uint
 	Conn      *websocket.Conn
 	Send      chan WebSocketMessage
 	Hub       *WebSocketHub
+
+	// workspace 为坐席工作台连接（SessionID 为 agent:<user_id>），额外订阅 topics 中的频道
+	workspace bool
+	topics    []string
+
+	// 可靠投递：resume 为 true 时从 resumeFrom 之后补发，否则按已保存的 ack 游标补发
+	resume     bool
+	resumeFrom int64
+	ackedSeq   int64 // 客户端已确认的最大序号（原子访问）
+	closeCode  int   // 非 0 时以该关闭码断开（由 Hub 在关闭 Send 前设置）
 }
 
 type WebSocketHub struct {
@@ -43,20 +88,170 @@ type WebSocketHub struct {
 	transferService *SessionTransferService
 	// 可选：用于将文本消息落库（如未设置则仅记录日志）
 	db *gorm.DB
+	// 可选：坐席工作台（推送会话消息、处理坐席回复）
+	agentRealtime *AgentRealtimeService
+	// 可选：服务端 WebRTC（未设置时信令在会话内点对点转发）
+	webrtcService *WebRTCService
+	// 可选：协同浏览指令校验与下发
+	cobrowse *CoBrowseService
+	// 各会话进行中的 AI 回复（新客户消息到达时取消）
+	aiStreams   map[string]*aiStream
+	aiStreamsMu sync.Mutex
+	// 跨实例总线（默认进程内实现）；sessionClients 记录本实例各会话的连接数
+	backplane      HubBackplane
+	sessionClients map[string]int
+	// broadcast 已满时按序暂存的本地投递，由 Run 补入（见 deliverLocal）
+	pendingMu sync.Mutex
+	pending   []WebSocketMessage
+	// 允许的浏览器来源（为空或含 "*" 时不限制）
+	allowedOrigins []string
+	upgrader       websocket.Upgrader
 }
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true // 生产环境需要验证源
-	},
+func NewWebSocketHub() *WebSocketHub {
+	h := &WebSocketHub{
+		clients:        make(map[string]*WebSocketClient),
+		broadcast:      make(chan WebSocketMessage, hubBroadcastBuffer),
+		register:       make(chan *WebSocketClient),
+		unregister:     make(chan *WebSocketClient),
+		sessionClients: make(map[string]int),
+		aiStreams:      make(map[string]*aiStream),
+	}
+	h.upgrader = websocket.Upgrader{CheckOrigin: h.checkOrigin}
+	h.backplane = NewMemoryBackplane("")
+	_ = h.backplane.Subscribe(h.deliverLocal)
+	return h
 }
 
-func NewWebSocketHub() *WebSocketHub {
-	return &WebSocketHub{
-		clients:    make(map[string]*WebSocketClient),
-		broadcast:  make(chan WebSocketMessage),
-		register:   make(chan *WebSocketClient),
-		unregister: make(chan *WebSocketClient),
+// SetAllowedOrigins 设置允许建立 WebSocket 的来源（通常取 security.cors.allowed_origins）
+func (h *WebSocketHub) SetAllowedOrigins(origins []string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.allowedOrigins = append([]string(nil), origins...)
+}
+
+// checkOrigin 校验握手请求的 Origin：非浏览器客户端（无 Origin）与同源请求直接放行
+func (h *WebSocketHub) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	h.mutex.RLock()
+	allowed := h.allowedOrigins
+	h.mutex.RUnlock()
+	if len(allowed) == 0 {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	origin = strings.TrimRight(origin, "/")
+	for _, o := range allowed {
+		o = strings.TrimRight(strings.TrimSpace(o), "/")
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetBackplane 替换跨实例总线（如 Redis），应在 Run 之前调用
+func (h *WebSocketHub) SetBackplane(b HubBackplane) error {
+	if b == nil {
+		return fmt.Errorf("backplane required")
+	}
+	if err := b.Subscribe(h.deliverLocal); err != nil {
+		return err
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.backplane = b
+	return nil
+}
+
+// NodeID 当前实例标识
+func (h *WebSocketHub) NodeID() string {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return h.backplane.NodeID()
+}
+
+// SessionNodes 查询会话连接所在的实例
+func (h *WebSocketHub) SessionNodes(ctx context.Context, sessionID string) ([]string, error) {
+	h.mutex.RLock()
+	b := h.backplane
+	h.mutex.RUnlock()
+	return b.SessionNodes(ctx, sessionID)
+}
+
+// deliverLocal 投递给本实例的连接（由总线回调，也可能经 Run 内部路径调用），从不阻塞：
+// 通道已满（Run 未启动或处理落后）时按序暂存，由 Run 处理完通道内的消息后补入
+func (h *WebSocketHub) deliverLocal(message WebSocketMessage) {
+	h.pendingMu.Lock()
+	defer h.pendingMu.Unlock()
+	if len(h.pending) == 0 {
+		select {
+		case h.broadcast <- message:
+			return
+		default:
+		}
+	}
+	if len(h.pending) >= hubPendingLimit {
+		logrus.Warnf("Hub local queue full (%d), dropping oldest message for session %s", len(h.pending), h.pending[0].SessionID)
+		h.pending = h.pending[1:]
+	}
+	h.pending = append(h.pending, message)
+}
+
+// flushPending 将暂存的消息按序补入投递通道（仅由 Run 调用）
+func (h *WebSocketHub) flushPending() {
+	h.pendingMu.Lock()
+	defer h.pendingMu.Unlock()
+	for len(h.pending) > 0 {
+		select {
+		case h.broadcast <- h.pending[0]:
+			h.pending = h.pending[1:]
+		default:
+			return
+		}
+	}
+	h.pending = nil
+}
+
+// publish 经总线投递；总线不可用时至少保证本实例送达
+func (h *WebSocketHub) publish(message WebSocketMessage) {
+	h.mutex.RLock()
+	b := h.backplane
+	h.mutex.RUnlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := b.Publish(ctx, message); err != nil {
+		logrus.Warnf("Hub backplane publish failed, delivering locally: %v", err)
+		h.deliverLocal(message)
+	}
+}
+
+// updatePresence 会话在本实例的首个连接建立/最后一个连接断开时更新在线记录
+func (h *WebSocketHub) updatePresence(sessionID string, claim bool) {
+	h.mutex.RLock()
+	b := h.backplane
+	h.mutex.RUnlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var err error
+	if claim {
+		err = b.ClaimSession(ctx, sessionID)
+	} else {
+		err = b.ReleaseSession(ctx, sessionID)
+	}
+	if err != nil {
+		logrus.Warnf("Hub presence update for session %s failed: %v", sessionID, err)
 	}
 }
 
@@ -74,6 +269,39 @@ func (h *WebSocketHub) SetSessionTransferService(svc *SessionTransferService) {
 	h.transferService = svc
 }
 
+// SetAgentRealtimeService 为 WebSocketHub 注入坐席工作台服务（可选）
+func (h *WebSocketHub) SetAgentRealtimeService(svc *AgentRealtimeService) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.agentRealtime = svc
+}
+
+// SetWebRTCService 为 WebSocketHub 注入 WebRTC 服务，offer/answer/candidate 由服务端处理
+func (h *WebSocketHub) SetWebRTCService(svc *WebRTCService) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.webrtcService = svc
+}
+
+func (h *WebSocketHub) webrtc() *WebRTCService {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return h.webrtcService
+}
+
+// SetCoBrowseService 为 WebSocketHub 注入协同浏览服务（WebSocket 与数据通道上的指令共用）
+func (h *WebSocketHub) SetCoBrowseService(svc *CoBrowseService) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.cobrowse = svc
+}
+
+func (h *WebSocketHub) coBrowse() *CoBrowseService {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return h.cobrowse
+}
+
 // SetDB 为 WebSocketHub 注入可选的数据库实例，用于持久化消息
 func (h *WebSocketHub) SetDB(db *gorm.DB) {
 	h.mutex.Lock()
@@ -85,58 +313,157 @@ func (h *WebSocketHub) Run() {
 	for {
 		select {
 		case client := <-h.register:
+			var claimed []string
 			h.mutex.Lock()
 			h.clients[client.ID] = client
+			for _, ch := range client.channels() {
+				if h.sessionClients[ch]++; h.sessionClients[ch] == 1 {
+					claimed = append(claimed, ch)
+				}
+			}
 			h.mutex.Unlock()
+			for _, ch := range claimed {
+				go h.claimChannel(ch, true)
+			}
 			logrus.Infof("Client %s connected", client.ID)
 
 		case client := <-h.unregister:
-			h.mutex.Lock()
-			if _, ok := h.clients[client.ID]; ok {
-				delete(h.clients, client.ID)
-				close(client.Send)
-				logrus.Infof("Client %s disconnected", client.ID)
-			}
-			h.mutex.Unlock()
+			h.removeClient(client, 0)
 
 		case message := <-h.broadcast:
+			var slow []*WebSocketClient
 			h.mutex.RLock()
 			for _, client := range h.clients {
-				if message.SessionID == "" || client.SessionID == message.SessionID {
+				if message.Origin != "" && client.SessionID == message.SessionID && client.participant() == message.Origin {
+					continue
+				}
+				if message.SessionID == "" || client.listens(message.SessionID) {
 					select {
 					case client.Send <- message:
 					default:
-						close(client.Send)
-						delete(h.clients, client.ID)
+						slow = append(slow, client)
 					}
 				}
 			}
 			h.mutex.RUnlock()
+			// 缓冲已满的连接不再静默丢消息：断开并提示客户端按 ack 位置重连补发
+			for _, client := range slow {
+				logrus.Warnf("Client %s send buffer full (session %s, acked seq %d); disconnecting for resume",
+					client.ID, client.SessionID, atomic.LoadInt64(&client.ackedSeq))
+				h.removeClient(client, wsCloseSlowConsumer)
+			}
+			h.flushPending()
+		}
+	}
+}
+
+// removeClient 注销连接并关闭其发送通道；closeCode 非 0 时 writePump 以该关闭码断开
+func (h *WebSocketHub) removeClient(client *WebSocketClient, closeCode int) {
+	var released []string
+	h.mutex.Lock()
+	if _, ok := h.clients[client.ID]; ok {
+		delete(h.clients, client.ID)
+		client.closeCode = closeCode
+		close(client.Send)
+		for _, ch := range client.channels() {
+			if h.sessionClients[ch]--; h.sessionClients[ch] <= 0 {
+				delete(h.sessionClients, ch)
+				released = append(released, ch)
+			}
 		}
+		logrus.Infof("Client %s disconnected", client.ID)
 	}
+	h.mutex.Unlock()
+	for _, ch := range released {
+		go h.claimChannel(ch, false)
+	}
+}
+
+// claimChannel 更新总线上的在线记录；参与方键变化时广播 presence 事件
+func (h *WebSocketHub) claimChannel(key string, claim bool) {
+	h.updatePresence(key, claim)
+	h.onPresenceChanged(key, claim)
 }
 
-func (h *WebSocketHub) HandleWebSocket(c *gin.Context) {
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+// channels 连接登记在线的全部键（会话 + 额外订阅 + 参与方）
+func (c *WebSocketClient) channels() []string {
+	chs := append([]string{c.SessionID}, c.topics...)
+	if !c.workspace {
+		chs = append(chs, presenceKey(c.SessionID, c.participant()))
+	}
+	return chs
+}
+
+func (c *WebSocketClient) listens(channel string) bool {
+	if c.SessionID == channel {
+		return true
+	}
+	for _, t := range c.topics {
+		if t == channel {
+			return true
+		}
+	}
+	return false
+}
+
+// HandleWebSocket 升级连接并注册客户端；调用方须已完成鉴权并给出身份
+// 坐席不指定会话时进入个人工作台频道（见 AgentRealtimeService）。
+// 可选 resume_from=<seq>：补发该序号之后的消息；缺省时按该参与方最近一次 ack 的位置补发
+func (h *WebSocketHub) HandleWebSocket(c *gin.Context, identity WebSocketIdentity) {
+	workspace := identity.Role == WSRoleAgent && identity.SessionID == ""
+	switch {
+	case workspace && identity.UserID == 0:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Bad Request", "message": "agent user id required for workspace channel"})
+		return
+	case workspace:
+		identity.SessionID = AgentChannelID(identity.UserID)
+	case identity.SessionID == "":
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Bad Request", "message": "session_id is required"})
+		return
+	case isAgentChannel(identity.SessionID):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden", "message": "reserved session id"})
+		return
+	}
+	resume, resumeFrom := false, int64(0)
+	if v := c.Query("resume_from"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Bad Request", "message": "invalid resume_from"})
+			return
+		}
+		resume, resumeFrom = true, n
+	}
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		logrus.Error("WebSocket upgrade failed:", err)
 		return
 	}
 
-	sessionID := c.Query("session_id")
-	if sessionID == "" {
-		sessionID = fmt.Sprintf("session_%d", time.Now().UnixNano())
+	role := identity.Role
+	if role == "" {
+		role = WSRoleVisitor
 	}
-
 	client := &WebSocketClient{
 		ID:        fmt.Sprintf("client_%d", time.Now().UnixNano()),
-		SessionID: sessionID,
+		SessionID: identity.SessionID,
+		Role:      role,
+		UserID:    identity.UserID,
 		Conn:      conn,
 		Send:      make(chan WebSocketMessage, 256),
 		Hub:       h,
+
+		workspace:  workspace,
+		resume:     resume,
+		resumeFrom: resumeFrom,
+	}
+	if workspace {
+		client.topics = []string{AgentsTopic}
 	}
 
 	h.register <- client
+	if !workspace {
+		go client.sendPresenceSnapshot()
+	}
 
 	go client.writePump()
 	go client.readPump()
@@ -148,7 +475,7 @@ func (c *WebSocketClient) readPump() {
 		c.Conn.Close()
 	}()
 
-	c.Conn.SetReadLimit(512)
+	c.Conn.SetReadLimit(wsMaxMessageSize)
 	c.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
 	c.Conn.SetPongHandler(func(string) error {
 		c.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
@@ -173,16 +500,35 @@ func (c *WebSocketClient) readPump() {
 		message.SessionID = c.SessionID
 		message.Timestamp = time.Now()
 
+		if c.workspace {
+			c.handleWorkspaceMessage(message)
+			continue
+		}
+
 		// 处理不同类型的消息
 		switch message.Type {
 		case "text-message":
 			c.handleTextMessage(message)
+		case "ack":
+			c.handleAck(message)
+		case WSEventTyping:
+			c.handleTyping(c.SessionID, message)
+		case WSEventRead:
+			if err := c.handleRead(c.SessionID, message); err != nil {
+				logrus.Warnf("Read receipt for session %s failed: %v", c.SessionID, err)
+			}
 		case "webrtc-offer":
 			c.handleWebRTCOffer(message)
 		case "webrtc-answer":
 			c.handleWebRTCAnswer(message)
 		case "webrtc-candidate":
 			c.handleWebRTCCandidate(message)
+		case "webrtc-ice-servers":
+			c.handleWebRTCICEServers()
+		case WSEventRecordingConsent:
+			c.handleRecordingConsent(message)
+		case WSEventCoBrowse:
+			c.handleCoBrowse(message)
 		default:
 			logrus.Warnf("Unknown message type: %s", message.Type)
 		}
@@ -196,14 +542,24 @@ func (c *WebSocketClient) writePump() {
 		c.Conn.Close()
 	}()
 
+	// 先补发断线期间遗漏的消息；此前已排队的实时消息按序号去重
+	replayed := c.replayMissed()
+
 	for {
 		select {
 		case message, ok := <-c.Send:
 			c.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
 			if !ok {
-				c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
+				closeMsg := []byte{}
+				if c.closeCode != 0 {
+					closeMsg = websocket.FormatCloseMessage(c.closeCode, "send buffer overflow, reconnect with resume_from")
+				}
+				c.Conn.WriteMessage(websocket.CloseMessage, closeMsg)
 				return
 			}
+			if message.Seq > 0 && message.Seq <= replayed {
+				continue
+			}
 
 			if err := c.Conn.WriteJSON(message); err != nil {
 				logrus.Error("WriteJSON error:", err)
@@ -221,65 +577,182 @@ func (c *WebSocketClient) writePump() {
 
 func (c *WebSocketClient) handleTextMessage(message WebSocketMessage) {
 	// 保存消息到数据库
-	if err := c.persistTextMessage(message); err != nil {
+	record, err := c.persistTextMessage(message)
+	if err != nil {
 		logrus.Warnf("Failed to persist text message: %v", err)
 		// 不影响消息处理流程，继续执行
+	} else if record != nil {
+		message.Seq = record.Seq
+	}
+	if data, ok := message.Data.(map[string]interface{}); ok {
+		data["sender"] = c.sender()
+	}
+	c.Hub.mutex.RLock()
+	rt := c.Hub.agentRealtime
+	c.Hub.mutex.RUnlock()
+	if rt != nil && record != nil {
+		go rt.NotifySessionMessage(record)
 	}
 
-	// 转发给 AI 服务处理
-	go c.processMessageWithAI(message)
+	// 访客消息转发给 AI 服务处理；坐席回复不触发 AI。
+	// 在读循环中同步登记本轮生成（同时打断上一轮），保证打断与启动按消息顺序生效
+	if c.Role != WSRoleAgent {
+		ctx, st := c.Hub.startAIStream(c.SessionID)
+		// 访客连接由绑定会话的令牌鉴权，可代表该会话调用工具
+		go c.processMessageWithAI(WithAuthenticatedSession(ctx, c.SessionID), st, message)
+	}
 
 	// 广播消息
-	c.Hub.broadcast <- message
+	c.Hub.publish(message)
 }
 
 func (c *WebSocketClient) handleWebRTCOffer(message WebSocketMessage) {
-	// 处理 WebRTC offer
-	// 集成 WebRTC 服务处理
 	logrus.Infof("Received WebRTC offer from session %s", c.SessionID)
+	svc := c.Hub.webrtc()
+	if svc == nil {
+		// 未接入服务端 WebRTC：转发给同一会话的其他客户端（点对点协商）
+		c.Hub.publish(message)
+		return
+	}
 
-	// 这里应该调用 WebRTC 服务来处理 offer
-	// 并将 answer 返回给客户端
-	/*
-		if webrtcService != nil {
-			answer, err := webrtcService.HandleOffer(c.SessionID, message.Data)
-			if err != nil {
-				logrus.Errorf("Failed to handle WebRTC offer: %v", err)
-				return
-			}
-
-			// 发送 answer 回客户端
-			response := WebSocketMessage{
-				Type:      "webrtc-answer",
-				Data:      answer,
-				SessionID: c.SessionID,
-				Timestamp: time.Now(),
-			}
-			c.Send <- response
-		}
-	*/
-
-	// 当前实现：简单转发给同一会话的其他客户端
-	c.Hub.broadcast <- message
+	var offer webrtc.SessionDescription
+	if err := decodeSignal(message.Data, &offer); err != nil || offer.SDP == "" {
+		c.sendWebRTCError("invalid offer")
+		return
+	}
+	offer.Type = webrtc.SDPTypeOffer
+	// 可选 data.connection_type：屏幕共享等无法从 SDP 区分的类型
+	var meta struct {
+		ConnectionType string `json:"connection_type"`
+	}
+	_ = decodeSignal(message.Data, &meta)
+	answer, err := svc.HandleOfferAs(c.SessionID, meta.ConnectionType, offer)
+	if err != nil {
+		logrus.Errorf("Failed to handle WebRTC offer for session %s: %v", c.SessionID, err)
+		c.sendWebRTCError(err.Error())
+		return
+	}
+	c.Hub.sendToClient(c, WebSocketMessage{
+		Type:      "webrtc-answer",
+		Data:      answer,
+		SessionID: c.SessionID,
+		Timestamp: time.Now(),
+	})
 }
 
 func (c *WebSocketClient) handleWebRTCAnswer(message WebSocketMessage) {
-	// 处理 WebRTC answer
 	logrus.Infof("Received WebRTC answer from session %s", c.SessionID)
+	svc := c.Hub.webrtc()
+	if svc == nil {
+		c.Hub.publish(message)
+		return
+	}
+
+	var answer webrtc.SessionDescription
+	if err := decodeSignal(message.Data, &answer); err != nil || answer.SDP == "" {
+		c.sendWebRTCError("invalid answer")
+		return
+	}
+	answer.Type = webrtc.SDPTypeAnswer
+	if err := svc.HandleAnswer(c.SessionID, answer); err != nil {
+		logrus.Warnf("Failed to apply WebRTC answer for session %s: %v", c.SessionID, err)
+		c.sendWebRTCError(err.Error())
+	}
 }
 
+// handleWebRTCCandidate 客户端 trickle ICE：data 为 RTCIceCandidateInit，或 {"candidate": RTCIceCandidateInit}
 func (c *WebSocketClient) handleWebRTCCandidate(message WebSocketMessage) {
-	// 处理 ICE candidate
-	logrus.Infof("Received ICE candidate from session %s", c.SessionID)
+	svc := c.Hub.webrtc()
+	if svc == nil {
+		c.Hub.publish(message)
+		return
+	}
+
+	var wrapped struct {
+		Candidate json.RawMessage `json:"candidate"`
+	}
+	var candidate webrtc.ICECandidateInit
+	if err := decodeSignal(message.Data, &wrapped); err == nil && len(wrapped.Candidate) > 0 && wrapped.Candidate[0] == '{' {
+		err = json.Unmarshal(wrapped.Candidate, &candidate)
+		if err != nil {
+			c.sendWebRTCError("invalid candidate")
+			return
+		}
+	} else if err := decodeSignal(message.Data, &candidate); err != nil {
+		c.sendWebRTCError("invalid candidate")
+		return
+	}
+	if candidate.Candidate == "" {
+		return // 候选收集结束
+	}
+	if err := svc.HandleICECandidate(c.SessionID, candidate); err != nil {
+		logrus.Warnf("Failed to add ICE candidate for session %s: %v", c.SessionID, err)
+		c.sendWebRTCError(err.Error())
+	}
+}
+
+// handleWebRTCICEServers 下发本会话可用的 STUN/TURN 服务器（含 TURN 凭据）
+func (c *WebSocketClient) handleWebRTCICEServers() {
+	svc := c.Hub.webrtc()
+	if svc == nil {
+		c.sendWebRTCError("webrtc not configured")
+		return
+	}
+	c.Hub.sendToClient(c, WebSocketMessage{
+		Type:      "webrtc-ice-servers",
+		Data:      map[string]interface{}{"ice_servers": svc.ICEServers(c.SessionID)},
+		SessionID: c.SessionID,
+		Timestamp: time.Now(),
+	})
+}
+
+func (c *WebSocketClient) sendWebRTCError(msg string) {
+	c.Hub.sendToClient(c, WebSocketMessage{
+		Type:      "webrtc-error",
+		Data:      map[string]interface{}{"message": msg},
+		SessionID: c.SessionID,
+		Timestamp: time.Now(),
+	})
+}
+
+// decodeSignal 将信令帧中的 data 解码为具体结构
+func decodeSignal(data interface{}, out interface{}) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, out)
 }
 
 func (h *WebSocketHub) SendToSession(sessionID string, message WebSocketMessage) {
-	h.broadcast <- WebSocketMessage{
+	h.publish(WebSocketMessage{
 		Type:      message.Type,
 		Data:      message.Data,
 		SessionID: sessionID,
+		Seq:       message.Seq,
 		Timestamp: time.Now(),
+		Origin:    message.Origin,
+	})
+}
+
+// SendPersisted 将服务端产生的回复（AI/系统）落库后推送到会话；
+// 落库得到的序号随帧下发，客户端断线重连后可据此补发。未配置数据库时仅推送。
+func (h *WebSocketHub) SendPersisted(sessionID string, record *models.Message, message WebSocketMessage) {
+	h.mutex.RLock()
+	db := h.db
+	h.mutex.RUnlock()
+	if db != nil && record != nil {
+		record.SessionID = sessionID
+		if record.CreatedAt.IsZero() {
+			record.CreatedAt = time.Now()
+		}
+		if err := db.Create(record).Error; err != nil {
+			logrus.Warnf("Failed to persist %s message for session %s: %v", record.Sender, sessionID, err)
+		} else {
+			message.Seq = record.Seq
+		}
 	}
+	h.SendToSession(sessionID, message)
 }
 
 func (h *WebSocketHub) GetClientCount() int {
@@ -288,8 +761,8 @@ func (h *WebSocketHub) GetClientCount() int {
 	return len(h.clients)
 }
 
-// persistTextMessage 持久化文本消息
-func (c *WebSocketClient) persistTextMessage(message WebSocketMessage) error {
+// persistTextMessage 持久化文本消息，返回落库记录（未配置数据库时为 nil）
+func (c *WebSocketClient) persistTextMessage(message WebSocketMessage) (*models.Message, error) {
 	// 当前简单实现：记录到日志
 	// 生产环境中应该保存到数据库中的 messages 表
 	logrus.WithFields(logrus.Fields{
@@ -305,7 +778,7 @@ func (c *WebSocketClient) persistTextMessage(message WebSocketMessage) error {
 	db := hub.db
 	hub.mutex.RUnlock()
 	if db == nil {
-		return nil
+		return nil, nil
 	}
 
 	// 确保会话存在（以 SessionID 作为主键），若不存在则创建
@@ -322,10 +795,10 @@ func (c *WebSocketClient) persistTextMessage(message WebSocketMessage) error {
 				UpdatedAt: now,
 			}
 			if err := db.Create(&sess).Error; err != nil {
-				return fmt.Errorf("create session: %w", err)
+				return nil, fmt.Errorf("create session: %w", err)
 			}
 		} else {
-			return err
+			return nil, err
 		}
 	}
 
@@ -342,25 +815,236 @@ func (c *WebSocketClient) persistTextMessage(message WebSocketMessage) error {
 		// 其他格式不处理
 	}
 
-	// 插入消息记录
+	// 插入消息记录：坐席消息记坐席用户；访客消息归属会话的客户用户（匿名访客为 0）
+	userID := sess.UserID
+	if c.Role == WSRoleAgent {
+		userID = c.UserID
+	}
 	m := &models.Message{
 		SessionID: c.SessionID,
-		UserID:    0,
+		UserID:    userID,
 		Content:   content,
 		Type:      "text",
-		Sender:    "user",
+		Sender:    c.sender(),
 		CreatedAt: time.Now(),
 	}
 	if err := db.Create(m).Error; err != nil {
-		return fmt.Errorf("persist message: %w", err)
+		return nil, fmt.Errorf("persist message: %w", err)
+	}
+	return m, nil
+}
+
+// handleWorkspaceMessage 处理坐席工作台连接上的指令
+func (c *WebSocketClient) handleWorkspaceMessage(message WebSocketMessage) {
+	switch message.Type {
+	case "agent-reply":
+		c.Hub.mutex.RLock()
+		rt := c.Hub.agentRealtime
+		c.Hub.mutex.RUnlock()
+		data, _ := message.Data.(map[string]interface{})
+		sessionID, _ := data["session_id"].(string)
+		content, _ := data["content"].(string)
+		if rt == nil {
+			c.sendWorkspaceError(sessionID, "agent workspace not configured")
+			return
+		}
+		// 携带 attachment（type/url/name）时发送图片或文件，否则发送文本
+		var attachment *Attachment
+		if raw, ok := data["attachment"].(map[string]interface{}); ok {
+			attachment = &Attachment{}
+			attachment.Type, _ = raw["type"].(string)
+			attachment.URL, _ = raw["url"].(string)
+			attachment.Name, _ = raw["name"].(string)
+		}
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			var err error
+			if attachment != nil {
+				_, err = rt.ReplyAttachment(ctx, c.UserID, sessionID, *attachment)
+			} else {
+				_, err = rt.Reply(ctx, c.UserID, sessionID, content)
+			}
+			if err != nil {
+				logrus.Warnf("Agent %d reply to session %s failed: %v", c.UserID, sessionID, err)
+				c.sendWorkspaceError(sessionID, err.Error())
+			}
+		}()
+	case WSEventTyping, WSEventRead:
+		// 工作台内对所负责会话的输入状态/已读回执
+		data, _ := message.Data.(map[string]interface{})
+		sessionID, _ := data["session_id"].(string)
+		c.Hub.mutex.RLock()
+		rt := c.Hub.agentRealtime
+		c.Hub.mutex.RUnlock()
+		go func() {
+			if rt == nil || sessionID == "" || rt.assignedAgent(sessionID) != c.UserID {
+				c.sendWorkspaceError(sessionID, "session not assigned to agent")
+				return
+			}
+			if message.Type == WSEventTyping {
+				c.handleTyping(sessionID, message)
+				return
+			}
+			if err := c.handleRead(sessionID, message); err != nil {
+				c.sendWorkspaceError(sessionID, err.Error())
+			}
+		}()
+	case WSEventCoBrowse:
+		c.handleCoBrowse(message)
+	case "ack":
+		// 工作台事件为实时推送，不需要确认
+	default:
+		logrus.Warnf("Unknown workspace message type: %s", message.Type)
+	}
+}
+
+func (c *WebSocketClient) sendWorkspaceError(sessionID, msg string) {
+	c.Hub.SendToSession(c.SessionID, WebSocketMessage{
+		Type: "error",
+		Data: map[string]interface{}{"message": msg, "session_id": sessionID},
+	})
+}
+
+// sender 消息记录中的发送方
+func (c *WebSocketClient) sender() string {
+	if c.Role == WSRoleAgent {
+		return "agent"
+	}
+	return "user"
+}
+
+// participant 投递游标的参与方标识
+func (c *WebSocketClient) participant() string {
+	if c.Role == WSRoleAgent {
+		return fmt.Sprintf("agent:%d", c.UserID)
+	}
+	return WSRoleVisitor
+}
+
+// handleAck 记录客户端确认收到的最大序号，供下次重连时补发
+func (c *WebSocketClient) handleAck(message WebSocketMessage) {
+	var seq int64
+	switch v := message.Data.(type) {
+	case map[string]interface{}:
+		if f, ok := v["seq"].(float64); ok {
+			seq = int64(f)
+		}
+	case float64:
+		seq = int64(v)
+	}
+	if seq <= atomic.LoadInt64(&c.ackedSeq) {
+		return
+	}
+	atomic.StoreInt64(&c.ackedSeq, seq)
+
+	c.Hub.mutex.RLock()
+	db := c.Hub.db
+	c.Hub.mutex.RUnlock()
+	if db == nil {
+		return
+	}
+	if err := saveSessionCursor(db, c.SessionID, c.participant(), c.UserID, seq); err != nil {
+		logrus.Warnf("Failed to save ack cursor for session %s: %v", c.SessionID, err)
+	}
+}
+
+// saveSessionCursor 推进投递游标（只增不减；多个标签页并发确认时取最大值）
+func saveSessionCursor(db *gorm.DB, sessionID, participant string, userID uint, seq int64) error {
+	now := time.Now()
+	res := db.Model(&models.SessionCursor{}).
+		Where("session_id = ? AND participant = ?", sessionID, participant).
+		Updates(map[string]interface{}{
+			"acked_seq":  gorm.Expr("CASE WHEN acked_seq < ? THEN ? ELSE acked_seq END", seq, seq),
+			"updated_at": now,
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected > 0 {
+		return nil
+	}
+	cursor := &models.SessionCursor{SessionID: sessionID, Participant: participant, UserID: userID, AckedSeq: seq, UpdatedAt: now}
+	if err := db.Create(cursor).Error; err != nil {
+		// 并发创建冲突时退回更新
+		return db.Model(&models.SessionCursor{}).
+			Where("session_id = ? AND participant = ? AND acked_seq < ?", sessionID, participant, seq).
+			Updates(map[string]interface{}{"acked_seq": seq, "updated_at": now}).Error
 	}
 	return nil
 }
 
+// replayMissed 直接向连接补发遗漏的历史消息，返回已补发到的最大序号
+func (c *WebSocketClient) replayMissed() int64 {
+	c.Hub.mutex.RLock()
+	db := c.Hub.db
+	c.Hub.mutex.RUnlock()
+	if db == nil || c.workspace {
+		return 0
+	}
+
+	from := c.resumeFrom
+	if !c.resume {
+		var cursor models.SessionCursor
+		if err := db.Where("session_id = ? AND participant = ?", c.SessionID, c.participant()).First(&cursor).Error; err != nil {
+			return 0
+		}
+		from = cursor.AckedSeq
+	}
+
+	last := from
+	for {
+		var batch []models.Message
+		if err := db.Where("session_id = ? AND seq > ?", c.SessionID, last).
+			Order("seq ASC").Limit(wsReplayBatch).Find(&batch).Error; err != nil {
+			logrus.Warnf("Replay for session %s failed: %v", c.SessionID, err)
+			return last
+		}
+		for _, m := range batch {
+			c.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err := c.Conn.WriteJSON(replayFrame(m)); err != nil {
+				return last
+			}
+			last = m.Seq
+		}
+		if len(batch) < wsReplayBatch {
+			if last > from {
+				logrus.Infof("Replayed messages %d..%d to client %s", from+1, last, c.ID)
+			}
+			return last
+		}
+	}
+}
+
+// replayFrame 将历史消息还原为实时推送时的帧格式
+func replayFrame(m models.Message) WebSocketMessage {
+	frameType := "text-message"
+	switch m.Sender {
+	case "ai":
+		frameType = "ai-response"
+	case "system":
+		frameType = "system-message"
+	}
+	return WebSocketMessage{
+		Type: frameType,
+		Data: map[string]interface{}{
+			"content": m.Content,
+			"sender":  m.Sender,
+			"replay":  true,
+		},
+		SessionID: m.SessionID,
+		Seq:       m.Seq,
+		Timestamp: m.CreatedAt,
+	}
+}
+
 // processMessageWithAI 使用 AI 处理消息
-func (c *WebSocketClient) processMessageWithAI(message WebSocketMessage) {
-	// 若未注入AI服务，直接返回
+// processMessageWithAI 处理已登记为 st 的一轮 AI 回复；未进入 AI 回复的分支同样释放登记
+func (c *WebSocketClient) processMessageWithAI(ctx context.Context, st *aiStream, message WebSocketMessage) {
 	h := c.Hub
+	defer h.finishAIStream(c.SessionID, st)
+
+	// 若未注入AI服务，直接返回
 	h.mutex.RLock()
 	ai := h.aiService
 	transferSvc := h.transferService
@@ -408,17 +1092,31 @@ func (c *WebSocketClient) processMessageWithAI(message WebSocketMessage) {
 		if db != nil {
 			_ = db.Where("session_id = ?", c.SessionID).
 				Order("created_at DESC").
-				Limit(6).
+				Limit(20).
 				Find(&history).Error
 		}
-		if ai.ShouldTransferToHuman(content, history) {
+		// 支持策略评估的 AI 服务记录命中的信号，随转接记录保存
+		var decision *HandoffDecision
+		transfer := false
+		if ev, ok := ai.(HandoffEvaluator); ok {
+			decision = ev.EvaluateHandoff(context.Background(), c.SessionID, content, history)
+			transfer = decision.Transfer
+		} else {
+			transfer = ai.ShouldTransferToHuman(c.SessionID, content, history)
+		}
+		if transfer {
+			reason := "user_request"
+			if decision != nil {
+				reason = decision.Reason()
+			}
 			go func(sessionID string) {
 				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 				defer cancel()
 
 				result, err := transferSvc.TransferToHuman(ctx, &TransferRequest{
 					SessionID: sessionID,
-					Reason:    "user_request",
+					Reason:    reason,
+					Handoff:   decision,
 				})
 				if err != nil {
 					c.Hub.SendToSession(sessionID, WebSocketMessage{
@@ -455,25 +1153,6 @@ func (c *WebSocketClient) processMessageWithAI(message WebSocketMessage) {
 		}
 	}
 
-	// 异步调用AI
-	go func(sessionID string, text string) {
-		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
-		defer cancel()
-		resp, err := ai.ProcessQuery(ctx, text, sessionID)
-		if err != nil {
-			logrus.Errorf("AI processing failed: %v", err)
-			return
-		}
-		// 推送AI回复
-		c.Hub.SendToSession(sessionID, WebSocketMessage{
-			Type: "ai-response",
-			Data: map[string]interface{}{
-				"content":    resp.Content,
-				"confidence": resp.Confidence,
-				"source":     resp.Source,
-			},
-			SessionID: sessionID,
-			Timestamp: time.Now(),
-		})
-	}(c.SessionID, content)
+	// 调用AI（流式服务逐段推送增量）
+	c.Hub.replyWithAI(ctx, st, c.SessionID, content, ai)
 }
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"servify/apps/server/internal/models"
+)
+
+func TestWebSocketHub_CheckOrigin(t *testing.T) {
+	hub := NewWebSocketHub()
+
+	req := httptest.NewRequest("GET", "http://chat.example.com/api/v1/ws", nil)
+	req.Header.Set("Origin", "https://evil.example.org")
+	if !hub.checkOrigin(req) {
+		t.Fatal("no allow-list configured: any origin should pass")
+	}
+
+	hub.SetAllowedOrigins([]string{"https://app.example.com/"})
+	if hub.checkOrigin(req) {
+		t.Fatal("origin outside allow-list should be rejected")
+	}
+	req.Header.Set("Origin", "https://APP.example.com")
+	if !hub.checkOrigin(req) {
+		t.Fatal("allow-listed origin should pass")
+	}
+	req.Header.Set("Origin", "http://chat.example.com")
+	if !hub.checkOrigin(req) {
+		t.Fatal("same-host origin should pass")
+	}
+	req.Header.Del("Origin")
+	if !hub.checkOrigin(req) {
+		t.Fatal("non-browser client without Origin should pass")
+	}
+
+	hub.SetAllowedOrigins([]string{"*"})
+	req.Header.Set("Origin", "https://evil.example.org")
+	if !hub.checkOrigin(req) {
+		t.Fatal("wildcard should allow any origin")
+	}
+}
+
+func TestWebSocketClient_PersistTextMessage_SenderByRole(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:ws_auth_"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Session{}, &models.Message{}); err != nil {
+		t.Fatalf("automigrate: %v", err)
+	}
+	if err := db.Create(&models.Session{ID: "s1", UserID: 42, Status: "active", Platform: "web"}).Error; err != nil {
+		t.Fatalf("seed session: %v", err)
+	}
+	hub := NewWebSocketHub()
+	hub.SetDB(db)
+
+	visitor := &WebSocketClient{ID: "v", SessionID: "s1", Role: WSRoleVisitor, Hub: hub}
+	agent := &WebSocketClient{ID: "a", SessionID: "s1", Role: WSRoleAgent, UserID: 7, Hub: hub}
+	if _, err := visitor.persistTextMessage(WebSocketMessage{Type: "text-message", Data: map[string]interface{}{"content": "hi"}}); err != nil {
+		t.Fatalf("persist visitor: %v", err)
+	}
+	if _, err := agent.persistTextMessage(WebSocketMessage{Type: "text-message", Data: "hello"}); err != nil {
+		t.Fatalf("persist agent: %v", err)
+	}
+
+	var msgs []models.Message
+	if err := db.Order("id").Find(&msgs, "session_id = ?", "s1").Error; err != nil {
+		t.Fatalf("load messages: %v", err)
+	}
+	if len(msgs) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(msgs))
+	}
+	if msgs[0].Sender != "user" || msgs[0].UserID != 42 {
+		t.Fatalf("visitor message: sender=%s user=%d", msgs[0].Sender, msgs[0].UserID)
+	}
+	if msgs[1].Sender != "agent" || msgs[1].UserID != 7 {
+		t.Fatalf("agent message: sender=%s user=%d", msgs[1].Sender, msgs[1].UserID)
+	}
+}
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"servify/apps/server/internal/models"
+)
+
+func newDeliveryTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:ws_delivery_"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Session{}, &models.Message{}, &models.SessionCursor{}); err != nil {
+		t.Fatalf("automigrate: %v", err)
+	}
+	return db
+}
+
+func TestMessage_SeqPerSession(t *testing.T) {
+	db := newDeliveryTestDB(t)
+	for _, id := range []string{"s1", "s2"} {
+		if err := db.Create(&models.Session{ID: id, Status: "active"}).Error; err != nil {
+			t.Fatalf("seed session: %v", err)
+		}
+	}
+
+	var got []int64
+	for _, sid := range []string{"s1", "s1", "s2", "s1", "missing"} {
+		m := &models.Message{SessionID: sid, Content: "x", Sender: "user"}
+		if err := db.Create(m).Error; err != nil {
+			t.Fatalf("create message: %v", err)
+		}
+		got = append(got, m.Seq)
+	}
+	want := []int64{1, 2, 1, 3, 0}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("seq = %v, want %v", got, want)
+		}
+	}
+	var sess models.Session
+	db.First(&sess, "id = ?", "s1")
+	if sess.LastSeq != 3 {
+		t.Fatalf("last_seq = %d, want 3", sess.LastSeq)
+	}
+}
+
+func TestWebSocketHub_SlowConsumerIsDisconnected(t *testing.T) {
+	hub := NewWebSocketHub()
+	go hub.Run()
+
+	client := &WebSocketClient{ID: "c1", SessionID: "s1", Send: make(chan WebSocketMessage, 1), Hub: hub}
+	hub.register <- client
+	hub.SendToSession("s1", WebSocketMessage{Type: "ai-response", Seq: 1})
+	hub.SendToSession("s1", WebSocketMessage{Type: "ai-response", Seq: 2})
+
+	waitFor(t, func() bool { return hub.GetClientCount() == 0 })
+	if client.closeCode != wsCloseSlowConsumer {
+		t.Fatalf("close code = %d, want %d", client.closeCode, wsCloseSlowConsumer)
+	}
+	if msg, ok := <-client.Send; !ok || msg.Seq != 1 {
+		t.Fatalf("buffered message should still be delivered, got %+v ok=%v", msg, ok)
+	}
+	if _, ok := <-client.Send; ok {
+		t.Fatal("send channel should be closed")
+	}
+	hub.mutex.RLock()
+	defer hub.mutex.RUnlock()
+	if _, ok := hub.sessionClients["s1"]; ok {
+		t.Fatal("session client count should be released")
+	}
+}
+
+func TestWebSocketHub_ResumeAndAck(t *testing.T) {
+	if !canBindLocal() {
+		t.Skip("local TCP bind not permitted in this environment")
+	}
+	db := newDeliveryTestDB(t)
+	db.Create(&models.Session{ID: "s1", Status: "active"})
+	for _, content := range []string{"m1", "m2", "m3"} {
+		db.Create(&models.Message{SessionID: "s1", Content: content, Sender: "agent"})
+	}
+
+	hub := NewWebSocketHub()
+	hub.SetDB(db)
+	go hub.Run()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/ws", func(c *gin.Context) {
+		hub.HandleWebSocket(c, WebSocketIdentity{Role: WSRoleVisitor, SessionID: "s1"})
+	})
+	server := httptest.NewServer(router)
+	defer server.Close()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+
+	readSeq := func(conn *websocket.Conn) int64 {
+		t.Helper()
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		var msg WebSocketMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		return msg.Seq
+	}
+
+	// 显式 resume_from：补发之后的消息
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL+"?resume_from=1", nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	if s2, s3 := readSeq(conn), readSeq(conn); s2 != 2 || s3 != 3 {
+		t.Fatalf("replayed seq %d,%d; want 2,3", s2, s3)
+	}
+	if err := conn.WriteJSON(map[string]interface{}{"type": "ack", "data": map[string]interface{}{"seq": 3}}); err != nil {
+		t.Fatalf("ack: %v", err)
+	}
+	waitFor(t, func() bool {
+		var cursor models.SessionCursor
+		return db.First(&cursor, "session_id = ? AND participant = ?", "s1", WSRoleVisitor).Error == nil && cursor.AckedSeq == 3
+	})
+
+	// 实时推送的服务端回复带序号
+	hub.SendPersisted("s1", &models.Message{Content: "ai", Type: "text", Sender: "ai"}, WebSocketMessage{Type: "ai-response"})
+	if seq := readSeq(conn); seq != 4 {
+		t.Fatalf("live seq = %d, want 4", seq)
+	}
+	conn.Close()
+	waitFor(t, func() bool { return hub.GetClientCount() == 0 })
+
+	// 未带 resume_from：按已保存的 ack 游标补发（3 之后只有 4）
+	conn, _, err = websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("redial: %v", err)
+	}
+	defer conn.Close()
+	if seq := readSeq(conn); seq != 4 {
+		t.Fatalf("resumed seq = %d, want 4", seq)
+	}
+}
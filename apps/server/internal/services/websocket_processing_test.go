@@ -11,7 +11,8 @@ func TestProcessMessageWithAI_NoAI(t *testing.T) {
 	c := &WebSocketClient{ID: "c", SessionID: "s", Hub: hub}
 	msg := WebSocketMessage{Type: "text-message", Data: map[string]interface{}{"content": "hi"}, Timestamp: time.Now()}
 	// should return early with no panic
-	c.processMessageWithAI(msg)
+	ctx, st := hub.startAIStream("s")
+	c.processMessageWithAI(ctx, st, msg)
 }
 
 func TestProcessMessageWithAI_UnsupportedType(t *testing.T) {
@@ -22,5 +23,6 @@ func TestProcessMessageWithAI_UnsupportedType(t *testing.T) {
 	c := &WebSocketClient{ID: "c", SessionID: "s", Hub: hub}
 	// unsupported data type should be handled gracefully
 	msg := WebSocketMessage{Type: "text-message", Data: 12345, Timestamp: time.Now()}
-	c.processMessageWithAI(msg)
+	ctx, st := hub.startAIStream("s")
+	c.processMessageWithAI(ctx, st, msg)
 }
@@ -205,7 +205,9 @@ func TestWebSocketHub_HandleWebSocketUpgrade(t *testing.T) {
 	// 设置Gin路由
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
-	router.GET("/ws", hub.HandleWebSocket)
+	router.GET("/ws", func(c *gin.Context) {
+		hub.HandleWebSocket(c, WebSocketIdentity{Role: WSRoleVisitor, SessionID: c.Query("session_id")})
+	})
 
 	// 创建测试服务器
 	// 某些受限环境不允许绑定本地端口，先做一次探测
@@ -394,6 +396,7 @@ func TestWebSocketHub_SetDB(t *testing.T) {
 
 func TestWebSocketHub_handleWebRTCAnswer(t *testing.T) {
 	hub := NewWebSocketHub()
+	go hub.Run()
 	hub.SetAIService(&stubAI{})
 
 	// Create a test client
@@ -419,6 +422,7 @@ func TestWebSocketHub_handleWebRTCAnswer(t *testing.T) {
 
 func TestWebSocketHub_handleWebRTCCandidate(t *testing.T) {
 	hub := NewWebSocketHub()
+	go hub.Run()
 
 	// Create a test client
 	client := &WebSocketClient{
@@ -0,0 +1,754 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+const (
+	WeChatKindOfficialAccount = "oa"    // 微信公众号
+	WeChatKindWork            = "wecom" // 企业微信自建应用
+
+	defaultWeChatAPIBaseURL = "https://api.weixin.qq.com"
+	defaultWeComAPIBaseURL  = "https://qyapi.weixin.qq.com"
+	wechatSendTimeout       = 10 * time.Second
+	// access_token 有效期 7200 秒，提前 5 分钟刷新
+	wechatTokenRefreshMargin = 5 * time.Minute
+	// 微信 5 秒内未收到响应会重试推送（最多 3 次），按 MsgId 去重
+	wechatDedupTTL = 5 * time.Minute
+	// 回调 timestamp 与本机时间相差超过该值视为过期；窗口内同一 nonce 只接受一次
+	wechatCallbackMaxSkew = 5 * time.Minute
+	// 客服消息文本上限 2048 字节
+	wechatMaxTextBytes = 2048
+)
+
+var (
+	// ErrWeChatSignature 回调签名校验失败
+	ErrWeChatSignature = errors.New("wechat signature mismatch")
+	// ErrWeChatReplay 回调已过期或 nonce 重复（疑似重放）
+	ErrWeChatReplay = errors.New("wechat callback expired or replayed")
+)
+
+// WeChatAdapterConfig 微信公众号 / 企业微信适配器配置
+type WeChatAdapterConfig struct {
+	Kind           string // oa（默认）或 wecom
+	AppID          string // 公众号 AppID；企业微信为 CorpID
+	AppSecret      string // 公众号 AppSecret；企业微信为应用 Secret
+	AgentID        int64  // 企业微信应用 AgentId
+	Token          string // 回调 Token，用于签名校验
+	EncodingAESKey string // 43 位消息加解密密钥；为空表示明文模式（仅公众号支持）
+	APIBaseURL     string // 默认按 Kind 选择官方地址；测试时可指向本地 HTTP 替身
+	UploadDir      string // 允许上传为临时素材的本地文件目录（upload.storage_path）；为空时拒绝发送本地文件
+	HTTPClient     *http.Client
+}
+
+// WeChatAdapter 基于回调推送接收消息、通过客服消息接口回复的微信适配器
+type WeChatAdapter struct {
+	kind       string
+	appID      string
+	appSecret  string
+	agentID    int64
+	token      string
+	aesKey     []byte
+	apiBaseURL string
+	uploadDir  string
+	client     *http.Client
+
+	tokenMu        sync.Mutex
+	accessToken    string
+	tokenExpiresAt time.Time
+
+	seenMu sync.Mutex
+	seen   map[string]time.Time
+	nonces map[string]time.Time // nonce -> 过期时间
+
+	msgChan  chan UnifiedMessage
+	stopChan chan struct{}
+	stopOnce sync.Once
+}
+
+// WeChatCallbackParams 回调 URL 上的查询参数
+type WeChatCallbackParams struct {
+	Signature    string // 公众号明文/兼容模式签名
+	MsgSignature string // 密文签名
+	Timestamp    string
+	Nonce        string
+	EncryptType  string // 公众号安全模式为 aes
+	EchoStr      string // URL 验证时的回显字符串
+}
+
+// WeChatMessage 回调推送的消息 XML（公众号与企业微信字段基本一致）
+type WeChatMessage struct {
+	XMLName      xml.Name `xml:"xml"`
+	ToUserName   string   `xml:"ToUserName"`
+	FromUserName string   `xml:"FromUserName"`
+	CreateTime   int64    `xml:"CreateTime"`
+	MsgType      string   `xml:"MsgType"`
+	Content      string   `xml:"Content"`
+	MsgID        int64    `xml:"MsgId"`
+	PicURL       string   `xml:"PicUrl"`
+	MediaID      string   `xml:"MediaId"`
+	Format       string   `xml:"Format"`
+	Recognition  string   `xml:"Recognition"`
+	ThumbMediaID string   `xml:"ThumbMediaId"`
+	Title        string   `xml:"Title"`
+	Description  string   `xml:"Description"`
+	URL          string   `xml:"Url"`
+	LocationX    float64  `xml:"Location_X"`
+	LocationY    float64  `xml:"Location_Y"`
+	Label        string   `xml:"Label"`
+	Event        string   `xml:"Event"`
+	EventKey     string   `xml:"EventKey"`
+	AgentID      int64    `xml:"AgentID"`
+}
+
+type wechatEncryptedEnvelope struct {
+	XMLName    xml.Name `xml:"xml"`
+	ToUserName string   `xml:"ToUserName"`
+	AgentID    string   `xml:"AgentID"`
+	Encrypt    string   `xml:"Encrypt"`
+}
+
+type wechatAPIResponse struct {
+	ErrCode     int    `json:"errcode"`
+	ErrMsg      string `json:"errmsg"`
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+	MediaID     string `json:"media_id"`
+}
+
+// NewWeChatAdapter 创建微信适配器；EncodingAESKey 非法时返回错误
+func NewWeChatAdapter(cfg WeChatAdapterConfig) (*WeChatAdapter, error) {
+	kind := strings.ToLower(strings.TrimSpace(cfg.Kind))
+	if kind != WeChatKindWork {
+		kind = WeChatKindOfficialAccount
+	}
+
+	baseURL := strings.TrimRight(cfg.APIBaseURL, "/")
+	if baseURL == "" {
+		baseURL = defaultWeChatAPIBaseURL
+		if kind == WeChatKindWork {
+			baseURL = defaultWeComAPIBaseURL
+		}
+	}
+
+	var aesKey []byte
+	if cfg.EncodingAESKey != "" {
+		key, err := base64.StdEncoding.DecodeString(cfg.EncodingAESKey + "=")
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("invalid wechat encoding_aes_key: must be 43 base64 characters")
+		}
+		aesKey = key
+	} else if kind == WeChatKindWork {
+		return nil, fmt.Errorf("wecom callback requires encoding_aes_key")
+	}
+
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)}
+	}
+
+	return &WeChatAdapter{
+		kind:       kind,
+		appID:      cfg.AppID,
+		appSecret:  cfg.AppSecret,
+		agentID:    cfg.AgentID,
+		token:      cfg.Token,
+		aesKey:     aesKey,
+		apiBaseURL: baseURL,
+		uploadDir:  cfg.UploadDir,
+		client:     client,
+		seen:       make(map[string]time.Time),
+		nonces:     make(map[string]time.Time),
+		msgChan:    make(chan UnifiedMessage, 100),
+		stopChan:   make(chan struct{}),
+	}, nil
+}
+
+// Kind 返回接入类型（oa / wecom）
+func (w *WeChatAdapter) Kind() string {
+	return w.kind
+}
+
+func (w *WeChatAdapter) SendMessage(chatID, message string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), wechatSendTimeout)
+	defer cancel()
+
+	for _, chunk := range splitWeChatText(message) {
+		payload := w.messagePayload(chatID, "text", map[string]interface{}{"content": chunk})
+		if err := w.postJSON(ctx, w.sendPath(), payload, nil); err != nil {
+			return err
+		}
+	}
+	logrus.Debugf("WeChat message sent to %s", chatID)
+	return nil
+}
+
+// SendAttachment 发送图片或文件。上传目录内的本地文件先上传为临时素材再发送；远程 URL 以文本链接形式发送。
+func (w *WeChatAdapter) SendAttachment(chatID string, attachment Attachment) error {
+	path, local, err := localAttachmentPath(w.uploadDir, attachment.URL)
+	if err != nil {
+		return err
+	}
+	if !local {
+		text := attachment.URL
+		if attachment.Name != "" {
+			text = attachment.Name + "\n" + attachment.URL
+		}
+		return w.SendMessage(chatID, text)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), wechatSendTimeout)
+	defer cancel()
+
+	msgType := "file"
+	if attachment.Type == string(MessageTypeImage) {
+		msgType = "image"
+	} else if w.kind == WeChatKindOfficialAccount {
+		// 公众号客服消息不支持文件类型
+		return fmt.Errorf("wechat official account cannot send file attachments")
+	}
+
+	mediaID, err := w.uploadMedia(ctx, msgType, path, attachment.Name)
+	if err != nil {
+		return err
+	}
+	payload := w.messagePayload(chatID, msgType, map[string]interface{}{"media_id": mediaID})
+	return w.postJSON(ctx, w.sendPath(), payload, nil)
+}
+
+func (w *WeChatAdapter) ReceiveMessage() <-chan UnifiedMessage {
+	return w.msgChan
+}
+
+func (w *WeChatAdapter) GetPlatformType() PlatformType {
+	return PlatformWeChat
+}
+
+// Start 微信通过回调推送消息，无需后台轮询；这里只校验配置
+func (w *WeChatAdapter) Start() error {
+	if w.appID == "" || w.appSecret == "" {
+		return fmt.Errorf("wechat app_id and app_secret are required")
+	}
+	if w.token == "" {
+		return fmt.Errorf("wechat callback token is required")
+	}
+	logrus.Infof("WeChat adapter started (%s)", w.kind)
+	return nil
+}
+
+func (w *WeChatAdapter) Stop() error {
+	w.stopOnce.Do(func() {
+		logrus.Info("Stopping WeChat adapter")
+		close(w.stopChan)
+	})
+	return nil
+}
+
+// VerifyURL 处理服务器配置时的 URL 验证请求，返回需要原样回写的 echostr
+func (w *WeChatAdapter) VerifyURL(params WeChatCallbackParams) (string, error) {
+	if w.kind == WeChatKindWork {
+		// 企业微信：echostr 为密文，需校验 msg_signature 后解密
+		if !w.checkSignature(params.MsgSignature, params.Timestamp, params.Nonce, params.EchoStr) {
+			return "", ErrWeChatSignature
+		}
+		if err := w.checkReplay(params.Timestamp, params.Nonce); err != nil {
+			return "", err
+		}
+		plain, err := w.decrypt(params.EchoStr)
+		if err != nil {
+			return "", err
+		}
+		return string(plain), nil
+	}
+
+	if !w.checkSignature(params.Signature, params.Timestamp, params.Nonce) {
+		return "", ErrWeChatSignature
+	}
+	if err := w.checkReplay(params.Timestamp, params.Nonce); err != nil {
+		return "", err
+	}
+	return params.EchoStr, nil
+}
+
+// HandleCallback 校验签名、解密并解析回调报文，转换后投递到消息通道
+func (w *WeChatAdapter) HandleCallback(ctx context.Context, params WeChatCallbackParams, body []byte) error {
+	raw, err := w.openCallback(params, body)
+	if err != nil {
+		return err
+	}
+
+	var msg WeChatMessage
+	if err := xml.Unmarshal(raw, &msg); err != nil {
+		return fmt.Errorf("parse wechat message: %w", err)
+	}
+
+	unified, ok := w.toUnifiedMessage(&msg)
+	if !ok {
+		logrus.Debugf("Ignoring WeChat %s message (event=%s)", msg.MsgType, msg.Event)
+		return nil
+	}
+	if w.isDuplicate(unified.ID) {
+		return nil
+	}
+
+	select {
+	case w.msgChan <- unified:
+		return nil
+	case <-w.stopChan:
+		return ErrPlatformAdapterStopped
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// openCallback 返回明文 XML；安全模式下校验 msg_signature 并解密
+func (w *WeChatAdapter) openCallback(params WeChatCallbackParams, body []byte) ([]byte, error) {
+	encrypted := w.kind == WeChatKindWork || strings.EqualFold(params.EncryptType, "aes")
+
+	if w.kind == WeChatKindOfficialAccount {
+		// 公众号所有模式都会带上 signature
+		if !w.checkSignature(params.Signature, params.Timestamp, params.Nonce) {
+			return nil, ErrWeChatSignature
+		}
+	}
+	if !encrypted {
+		if err := w.checkReplay(params.Timestamp, params.Nonce); err != nil {
+			return nil, err
+		}
+		return body, nil
+	}
+
+	var envelope wechatEncryptedEnvelope
+	if err := xml.Unmarshal(body, &envelope); err != nil {
+		return nil, fmt.Errorf("parse wechat envelope: %w", err)
+	}
+	if envelope.Encrypt == "" {
+		return nil, fmt.Errorf("parse wechat envelope: missing Encrypt")
+	}
+	if !w.checkSignature(params.MsgSignature, params.Timestamp, params.Nonce, envelope.Encrypt) {
+		return nil, ErrWeChatSignature
+	}
+	if err := w.checkReplay(params.Timestamp, params.Nonce); err != nil {
+		return nil, err
+	}
+	return w.decrypt(envelope.Encrypt)
+}
+
+// checkReplay 签名通过后校验 timestamp 是否在允许窗口内，并登记 nonce；窗口内重复的 nonce 视为重放
+func (w *WeChatAdapter) checkReplay(timestamp, nonce string) error {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || nonce == "" {
+		return fmt.Errorf("%w: missing timestamp or nonce", ErrWeChatReplay)
+	}
+	at := time.Unix(ts, 0)
+	now := time.Now()
+	if skew := now.Sub(at); skew > wechatCallbackMaxSkew || skew < -wechatCallbackMaxSkew {
+		return fmt.Errorf("%w: timestamp out of range", ErrWeChatReplay)
+	}
+
+	w.seenMu.Lock()
+	defer w.seenMu.Unlock()
+	for k, exp := range w.nonces {
+		if now.After(exp) {
+			delete(w.nonces, k)
+		}
+	}
+	if _, ok := w.nonces[nonce]; ok {
+		return fmt.Errorf("%w: nonce reused", ErrWeChatReplay)
+	}
+	// 超过 at+窗口 后该 timestamp 本身已过期，无需再保留 nonce
+	w.nonces[nonce] = at.Add(wechatCallbackMaxSkew)
+	return nil
+}
+
+func (w *WeChatAdapter) checkSignature(signature string, parts ...string) bool {
+	if signature == "" {
+		return false
+	}
+	expected := wechatSignature(append([]string{w.token}, parts...)...)
+	return subtle.ConstantTimeCompare([]byte(strings.ToLower(signature)), []byte(expected)) == 1
+}
+
+// wechatSignature 字典序排序后拼接取 SHA1
+func wechatSignature(parts ...string) string {
+	sorted := append([]string(nil), parts...)
+	sort.Strings(sorted)
+	sum := sha1.Sum([]byte(strings.Join(sorted, "")))
+	return hex.EncodeToString(sum[:])
+}
+
+// decrypt AES-256-CBC 解密：random(16) + msg_len(4) + msg + receiveid
+func (w *WeChatAdapter) decrypt(encoded string) ([]byte, error) {
+	if len(w.aesKey) == 0 {
+		return nil, fmt.Errorf("wechat encoding_aes_key not configured")
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("decode wechat ciphertext: %w", err)
+	}
+	if len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("invalid wechat ciphertext length")
+	}
+
+	block, err := aes.NewCipher(w.aesKey)
+	if err != nil {
+		return nil, fmt.Errorf("init wechat cipher: %w", err)
+	}
+	plain := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, w.aesKey[:aes.BlockSize]).CryptBlocks(plain, ciphertext)
+
+	// PKCS#7，块大小 32
+	pad := int(plain[len(plain)-1])
+	if pad < 1 || pad > 32 || pad > len(plain) {
+		return nil, fmt.Errorf("invalid wechat padding")
+	}
+	plain = plain[:len(plain)-pad]
+	if len(plain) < 20 {
+		return nil, fmt.Errorf("invalid wechat plaintext")
+	}
+
+	content := plain[16:]
+	msgLen := int(binary.BigEndian.Uint32(content[:4]))
+	if msgLen > len(content)-4 {
+		return nil, fmt.Errorf("invalid wechat message length")
+	}
+	msg := content[4 : 4+msgLen]
+	receiveID := string(content[4+msgLen:])
+	if w.appID != "" && receiveID != w.appID {
+		return nil, fmt.Errorf("wechat receive id mismatch: %s", receiveID)
+	}
+	return msg, nil
+}
+
+func (w *WeChatAdapter) toUnifiedMessage(msg *WeChatMessage) (UnifiedMessage, bool) {
+	unified := UnifiedMessage{
+		ID:         fmt.Sprintf("wx_%d", msg.MsgID),
+		PlatformID: string(PlatformWeChat),
+		// 以 OpenID / 企业微信 UserID 作为会话标识，回复时直接发送给该用户
+		UserID:    msg.FromUserName,
+		Content:   msg.Content,
+		Type:      MessageTypeText,
+		Timestamp: time.Unix(msg.CreateTime, 0),
+		Metadata: map[string]interface{}{
+			"kind":     w.kind,
+			"to_user":  msg.ToUserName,
+			"msg_type": msg.MsgType,
+			"msg_id":   msg.MsgID,
+		},
+	}
+	if msg.CreateTime == 0 {
+		unified.Timestamp = time.Now()
+	}
+	if msg.MsgID == 0 {
+		unified.ID = fmt.Sprintf("wx_%s_%d", msg.FromUserName, msg.CreateTime)
+	}
+	if msg.AgentID != 0 {
+		unified.Metadata["agent_id"] = msg.AgentID
+	}
+	if msg.MediaID != "" {
+		unified.Metadata["media_id"] = msg.MediaID
+	}
+
+	switch msg.MsgType {
+	case "text":
+	case "image":
+		unified.Type = MessageTypeImage
+		unified.Attachments = []Attachment{{
+			Type: string(MessageTypeImage),
+			URL:  msg.PicURL,
+			Name: msg.MediaID + ".jpg",
+		}}
+	case "voice":
+		unified.Type = MessageTypeAudio
+		// 开启语音识别时带有识别结果
+		unified.Content = msg.Recognition
+		unified.Attachments = []Attachment{{
+			Type: string(MessageTypeAudio),
+			URL:  w.mediaURL(msg.MediaID),
+			Name: msg.MediaID + "." + strings.ToLower(msg.Format),
+		}}
+	case "video", "shortvideo":
+		unified.Type = MessageTypeVideo
+		unified.Attachments = []Attachment{{
+			Type: string(MessageTypeVideo),
+			URL:  w.mediaURL(msg.MediaID),
+			Name: msg.MediaID + ".mp4",
+		}}
+	case "file":
+		unified.Type = MessageTypeFile
+		unified.Attachments = []Attachment{{
+			Type: string(MessageTypeFile),
+			URL:  w.mediaURL(msg.MediaID),
+			Name: msg.Title,
+		}}
+	case "link":
+		unified.Content = strings.TrimSpace(msg.Title + "\n" + msg.Description + "\n" + msg.URL)
+	case "location":
+		unified.Content = fmt.Sprintf("%s (%.6f, %.6f)", msg.Label, msg.LocationX, msg.LocationY)
+	default:
+		// event 等非用户消息不进入路由
+		return unified, false
+	}
+	return unified, true
+}
+
+// mediaURL 临时素材下载地址，下载时需附加 access_token 参数
+func (w *WeChatAdapter) mediaURL(mediaID string) string {
+	if mediaID == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/cgi-bin/media/get?media_id=%s", w.apiBaseURL, url.QueryEscape(mediaID))
+}
+
+func (w *WeChatAdapter) isDuplicate(id string) bool {
+	w.seenMu.Lock()
+	defer w.seenMu.Unlock()
+
+	now := time.Now()
+	for k, at := range w.seen {
+		if now.Sub(at) > wechatDedupTTL {
+			delete(w.seen, k)
+		}
+	}
+	if _, ok := w.seen[id]; ok {
+		return true
+	}
+	w.seen[id] = now
+	return false
+}
+
+func (w *WeChatAdapter) sendPath() string {
+	if w.kind == WeChatKindWork {
+		return "/cgi-bin/message/send"
+	}
+	return "/cgi-bin/message/custom/send"
+}
+
+func (w *WeChatAdapter) messagePayload(toUser, msgType string, body map[string]interface{}) map[string]interface{} {
+	payload := map[string]interface{}{
+		"touser":  toUser,
+		"msgtype": msgType,
+		msgType:   body,
+	}
+	if w.kind == WeChatKindWork {
+		payload["agentid"] = w.agentID
+	}
+	return payload
+}
+
+// AccessToken 返回缓存的 access_token，过期前自动刷新
+func (w *WeChatAdapter) AccessToken(ctx context.Context) (string, error) {
+	return w.getAccessToken(ctx, false)
+}
+
+func (w *WeChatAdapter) getAccessToken(ctx context.Context, forceRefresh bool) (string, error) {
+	w.tokenMu.Lock()
+	defer w.tokenMu.Unlock()
+
+	if !forceRefresh && w.accessToken != "" && time.Now().Before(w.tokenExpiresAt) {
+		return w.accessToken, nil
+	}
+
+	query := url.Values{}
+	endpoint := "/cgi-bin/token"
+	if w.kind == WeChatKindWork {
+		endpoint = "/cgi-bin/gettoken"
+		query.Set("corpid", w.appID)
+		query.Set("corpsecret", w.appSecret)
+	} else {
+		query.Set("grant_type", "client_credential")
+		query.Set("appid", w.appID)
+		query.Set("secret", w.appSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, w.apiBaseURL+endpoint+"?"+query.Encode(), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create wechat token request: %w", err)
+	}
+	var resp wechatAPIResponse
+	if err := w.do(req, &resp); err != nil {
+		return "", fmt.Errorf("fetch wechat access token: %w", err)
+	}
+	if resp.AccessToken == "" {
+		return "", fmt.Errorf("fetch wechat access token: empty token")
+	}
+
+	ttl := time.Duration(resp.ExpiresIn) * time.Second
+	if ttl > 2*wechatTokenRefreshMargin {
+		ttl -= wechatTokenRefreshMargin
+	} else {
+		ttl /= 2
+	}
+	w.accessToken = resp.AccessToken
+	w.tokenExpiresAt = time.Now().Add(ttl)
+	logrus.Debugf("WeChat access token refreshed, expires in %s", ttl)
+	return w.accessToken, nil
+}
+
+// withAccessToken 调用需要 access_token 的接口；token 失效时强制刷新并重试一次
+func (w *WeChatAdapter) withAccessToken(ctx context.Context, call func(token string) error) error {
+	token, err := w.getAccessToken(ctx, false)
+	if err != nil {
+		return err
+	}
+	err = call(token)
+	var apiErr *wechatAPIError
+	if errors.As(err, &apiErr) && apiErr.tokenInvalid() {
+		if token, err = w.getAccessToken(ctx, true); err != nil {
+			return err
+		}
+		err = call(token)
+	}
+	return err
+}
+
+func (w *WeChatAdapter) postJSON(ctx context.Context, path string, payload interface{}, out *wechatAPIResponse) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal wechat request: %w", err)
+	}
+	return w.withAccessToken(ctx, func(token string) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.apiBaseURL+path+"?access_token="+url.QueryEscape(token), bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("failed to create wechat request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return w.do(req, out)
+	})
+}
+
+func (w *WeChatAdapter) uploadMedia(ctx context.Context, mediaType, path, name string) (string, error) {
+	if name == "" {
+		name = filepath.Base(path)
+	}
+
+	var mediaID string
+	err := w.withAccessToken(ctx, func(token string) error {
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("open wechat media: %w", err)
+		}
+		defer f.Close()
+
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		part, err := mw.CreateFormFile("media", name)
+		if err != nil {
+			return fmt.Errorf("failed to build wechat upload: %w", err)
+		}
+		if _, err := io.Copy(part, f); err != nil {
+			return fmt.Errorf("failed to build wechat upload: %w", err)
+		}
+		if err := mw.Close(); err != nil {
+			return fmt.Errorf("failed to build wechat upload: %w", err)
+		}
+
+		query := url.Values{"access_token": {token}, "type": {mediaType}}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.apiBaseURL+"/cgi-bin/media/upload?"+query.Encode(), &buf)
+		if err != nil {
+			return fmt.Errorf("failed to create wechat upload request: %w", err)
+		}
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+
+		var resp wechatAPIResponse
+		if err := w.do(req, &resp); err != nil {
+			return err
+		}
+		mediaID = resp.MediaID
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("upload wechat media: %w", err)
+	}
+	return mediaID, nil
+}
+
+// wechatAPIError 微信接口返回的业务错误
+type wechatAPIError struct {
+	Code    int
+	Message string
+}
+
+func (e *wechatAPIError) Error() string {
+	return fmt.Sprintf("wechat api error %d: %s", e.Code, e.Message)
+}
+
+// tokenInvalid access_token 无效或过期（40001 / 40014 / 42001）
+func (e *wechatAPIError) tokenInvalid() bool {
+	return e.Code == 40001 || e.Code == 40014 || e.Code == 42001
+}
+
+func (w *WeChatAdapter) do(req *http.Request, out *wechatAPIResponse) error {
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("wechat request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read wechat response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("wechat api returned status %d", resp.StatusCode)
+	}
+
+	var apiResp wechatAPIResponse
+	if err := json.Unmarshal(respBody, &apiResp); err != nil {
+		return fmt.Errorf("failed to decode wechat response: %w", err)
+	}
+	if apiResp.ErrCode != 0 {
+		return &wechatAPIError{Code: apiResp.ErrCode, Message: apiResp.ErrMsg}
+	}
+	if out != nil {
+		*out = apiResp
+	}
+	return nil
+}
+
+// splitWeChatText 按字节上限切分文本，保证不截断 UTF-8 字符
+func splitWeChatText(text string) []string {
+	if len(text) <= wechatMaxTextBytes {
+		return []string{text}
+	}
+	var chunks []string
+	for len(text) > wechatMaxTextBytes {
+		cut := wechatMaxTextBytes
+		for cut > 0 && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+		chunks = append(chunks, text[:cut])
+		text = text[cut:]
+	}
+	if text != "" {
+		chunks = append(chunks, text)
+	}
+	return chunks
+}
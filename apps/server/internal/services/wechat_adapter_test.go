@@ -0,0 +1,303 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testWeChatAESKey = "abcdefghijklmnopqrstuvwxyz0123456789ABCDEFG"
+
+// wechatEncryptForTest 按微信加密方案生成密文（与 decrypt 对称）
+func wechatEncryptForTest(t *testing.T, key []byte, msg, receiveID string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	buf.WriteString("0123456789abcdef")
+	_ = binary.Write(&buf, binary.BigEndian, uint32(len(msg)))
+	buf.WriteString(msg)
+	buf.WriteString(receiveID)
+	pad := 32 - buf.Len()%32
+	buf.Write(bytes.Repeat([]byte{byte(pad)}, pad))
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatalf("cipher: %v", err)
+	}
+	out := make([]byte, buf.Len())
+	cipher.NewCBCEncrypter(block, key[:aes.BlockSize]).CryptBlocks(out, buf.Bytes())
+	return base64.StdEncoding.EncodeToString(out)
+}
+
+func TestWeChatAdapter_PlainCallback_OfficialAccount(t *testing.T) {
+	a, err := NewWeChatAdapter(WeChatAdapterConfig{AppID: "wx123", AppSecret: "s", Token: "tok"})
+	if err != nil {
+		t.Fatalf("new adapter: %v", err)
+	}
+
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	params := WeChatCallbackParams{Timestamp: ts, Nonce: "n1", EchoStr: "hello"}
+	if _, err := a.VerifyURL(params); !errors.Is(err, ErrWeChatSignature) {
+		t.Fatalf("expected signature error, got %v", err)
+	}
+	params.Signature = wechatSignature("tok", params.Timestamp, params.Nonce)
+	echo, err := a.VerifyURL(params)
+	if err != nil || echo != "hello" {
+		t.Fatalf("verify url: echo=%q err=%v", echo, err)
+	}
+
+	body := `<xml><ToUserName><![CDATA[gh_1]]></ToUserName><FromUserName><![CDATA[openid_1]]></FromUserName>` +
+		`<CreateTime>1700000000</CreateTime><MsgType><![CDATA[text]]></MsgType><Content><![CDATA[你好]]></Content><MsgId>9001</MsgId></xml>`
+	signed := func(timestamp, nonce string) WeChatCallbackParams {
+		return WeChatCallbackParams{Timestamp: timestamp, Nonce: nonce, Signature: wechatSignature("tok", timestamp, nonce)}
+	}
+	if err := a.HandleCallback(context.Background(), signed(ts, "c1"), []byte(body)); err != nil {
+		t.Fatalf("handle callback: %v", err)
+	}
+	msg := <-a.ReceiveMessage()
+	if msg.UserID != "openid_1" || msg.Content != "你好" || msg.ID != "wx_9001" {
+		t.Fatalf("unexpected message: %+v", msg)
+	}
+
+	// 原样重放同一请求（nonce 重复）或使用过期 timestamp 均拒绝
+	if err := a.HandleCallback(context.Background(), signed(ts, "c1"), []byte(body)); !errors.Is(err, ErrWeChatReplay) {
+		t.Fatalf("expected replay error, got %v", err)
+	}
+	stale := strconv.FormatInt(time.Now().Add(-10*time.Minute).Unix(), 10)
+	if err := a.HandleCallback(context.Background(), signed(stale, "c9"), []byte(body)); !errors.Is(err, ErrWeChatReplay) {
+		t.Fatalf("expected stale timestamp error, got %v", err)
+	}
+	if _, err := a.VerifyURL(signed(stale, "c9")); !errors.Is(err, ErrWeChatReplay) {
+		t.Fatalf("expected stale verify error, got %v", err)
+	}
+
+	// 微信重试推送同一 MsgId 时应去重
+	if err := a.HandleCallback(context.Background(), signed(ts, "c2"), []byte(body)); err != nil {
+		t.Fatalf("handle retry: %v", err)
+	}
+	select {
+	case m := <-a.ReceiveMessage():
+		t.Fatalf("duplicate message delivered: %+v", m)
+	default:
+	}
+
+	// 事件推送不进入路由
+	event := `<xml><FromUserName>openid_1</FromUserName><CreateTime>1700000001</CreateTime><MsgType>event</MsgType><Event>subscribe</Event></xml>`
+	if err := a.HandleCallback(context.Background(), signed(ts, "c3"), []byte(event)); err != nil {
+		t.Fatalf("handle event: %v", err)
+	}
+	select {
+	case m := <-a.ReceiveMessage():
+		t.Fatalf("event should be ignored, got %+v", m)
+	default:
+	}
+}
+
+func TestWeChatAdapter_EncryptedCallback_WeCom(t *testing.T) {
+	a, err := NewWeChatAdapter(WeChatAdapterConfig{Kind: "wecom", AppID: "corp1", AppSecret: "s", AgentID: 1000002, Token: "tok", EncodingAESKey: testWeChatAESKey})
+	if err != nil {
+		t.Fatalf("new adapter: %v", err)
+	}
+
+	// URL 验证：echostr 为密文
+	echo := wechatEncryptForTest(t, a.aesKey, "echo-plain", "corp1")
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	params := WeChatCallbackParams{Timestamp: ts, Nonce: "n2", EchoStr: echo}
+	params.MsgSignature = wechatSignature("tok", params.Timestamp, params.Nonce, echo)
+	plain, err := a.VerifyURL(params)
+	if err != nil || plain != "echo-plain" {
+		t.Fatalf("verify url: plain=%q err=%v", plain, err)
+	}
+
+	inner := `<xml><ToUserName>corp1</ToUserName><FromUserName>zhangsan</FromUserName><CreateTime>1700000000</CreateTime>` +
+		`<MsgType>image</MsgType><PicUrl>https://wx.example.com/p.jpg</PicUrl><MediaId>m1</MediaId><MsgId>42</MsgId><AgentID>1000002</AgentID></xml>`
+	encrypted := wechatEncryptForTest(t, a.aesKey, inner, "corp1")
+	body := `<xml><ToUserName><![CDATA[corp1]]></ToUserName><AgentID><![CDATA[1000002]]></AgentID><Encrypt><![CDATA[` + encrypted + `]]></Encrypt></xml>`
+	params = WeChatCallbackParams{Timestamp: ts, Nonce: "n3"}
+	params.MsgSignature = wechatSignature("tok", params.Timestamp, params.Nonce, encrypted)
+
+	if err := a.HandleCallback(context.Background(), params, []byte(body)); err != nil {
+		t.Fatalf("handle callback: %v", err)
+	}
+	msg := <-a.ReceiveMessage()
+	if msg.UserID != "zhangsan" || msg.Type != MessageTypeImage || len(msg.Attachments) != 1 || msg.Attachments[0].URL != "https://wx.example.com/p.jpg" {
+		t.Fatalf("unexpected message: %+v", msg)
+	}
+
+	// 篡改签名
+	params.MsgSignature = "deadbeef"
+	if err := a.HandleCallback(context.Background(), params, []byte(body)); !errors.Is(err, ErrWeChatSignature) {
+		t.Fatalf("expected signature error, got %v", err)
+	}
+
+	// receiveid 不匹配
+	other := wechatEncryptForTest(t, a.aesKey, inner, "corp2")
+	if _, err := a.decrypt(other); err == nil {
+		t.Fatal("expected receive id mismatch")
+	}
+}
+
+func TestNewWeChatAdapter_InvalidConfig(t *testing.T) {
+	if _, err := NewWeChatAdapter(WeChatAdapterConfig{EncodingAESKey: "short"}); err == nil {
+		t.Fatal("expected invalid aes key error")
+	}
+	if _, err := NewWeChatAdapter(WeChatAdapterConfig{Kind: "wecom"}); err == nil {
+		t.Fatal("wecom without aes key should fail")
+	}
+}
+
+// fakeWeChatAPI 模拟 access_token 与客服消息接口
+type fakeWeChatAPI struct {
+	mu          sync.Mutex
+	tokenCalls  int
+	validToken  string
+	sent        []map[string]interface{}
+	expireFirst bool
+}
+
+func (f *fakeWeChatAPI) serve(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.URL.Path {
+	case "/cgi-bin/token", "/cgi-bin/gettoken":
+		f.tokenCalls++
+		f.validToken = "token-" + strings.Repeat("x", f.tokenCalls)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"access_token": f.validToken, "expires_in": 7200})
+	case "/cgi-bin/message/custom/send", "/cgi-bin/message/send":
+		token := r.URL.Query().Get("access_token")
+		if f.expireFirst {
+			// 模拟 token 在服务端提前失效
+			f.expireFirst = false
+			_, _ = w.Write([]byte(`{"errcode":42001,"errmsg":"access_token expired"}`))
+			return
+		}
+		if token != f.validToken {
+			_, _ = w.Write([]byte(`{"errcode":40001,"errmsg":"invalid credential"}`))
+			return
+		}
+		var payload map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		f.sent = append(f.sent, payload)
+		_, _ = w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestWeChatAdapter_SendMessage_CachesAndRefreshesToken(t *testing.T) {
+	fake := &fakeWeChatAPI{}
+	srv := httptest.NewServer(http.HandlerFunc(fake.serve))
+	defer srv.Close()
+
+	a, err := NewWeChatAdapter(WeChatAdapterConfig{AppID: "wx123", AppSecret: "s", Token: "tok", APIBaseURL: srv.URL})
+	if err != nil {
+		t.Fatalf("new adapter: %v", err)
+	}
+
+	if err := a.SendMessage("openid_1", "first"); err != nil {
+		t.Fatalf("send 1: %v", err)
+	}
+	if err := a.SendMessage("openid_1", "second"); err != nil {
+		t.Fatalf("send 2: %v", err)
+	}
+	fake.mu.Lock()
+	if fake.tokenCalls != 1 {
+		t.Fatalf("expected cached token (1 fetch), got %d", fake.tokenCalls)
+	}
+	fake.expireFirst = true
+	fake.mu.Unlock()
+
+	if err := a.SendMessage("openid_1", "third"); err != nil {
+		t.Fatalf("send after expiry: %v", err)
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if fake.tokenCalls != 2 {
+		t.Fatalf("expected token refresh after 42001, got %d fetches", fake.tokenCalls)
+	}
+	if len(fake.sent) != 3 {
+		t.Fatalf("expected 3 messages sent, got %d", len(fake.sent))
+	}
+	last := fake.sent[2]
+	if last["touser"] != "openid_1" || last["msgtype"] != "text" {
+		t.Fatalf("unexpected payload: %+v", last)
+	}
+	if text, _ := last["text"].(map[string]interface{}); text["content"] != "third" {
+		t.Fatalf("unexpected text: %+v", last)
+	}
+}
+
+func TestWeChatAdapter_SendAttachment_RejectsFilesOutsideUploadDir(t *testing.T) {
+	fake := &fakeWeChatAPI{}
+	srv := httptest.NewServer(http.HandlerFunc(fake.serve))
+	defer srv.Close()
+
+	a, err := NewWeChatAdapter(WeChatAdapterConfig{AppID: "wx123", AppSecret: "s", Token: "tok", APIBaseURL: srv.URL, UploadDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("new adapter: %v", err)
+	}
+	outside := filepath.Join(t.TempDir(), "id_rsa")
+	if err := os.WriteFile(outside, []byte("key"), 0o600); err != nil {
+		t.Fatalf("write temp file: %v", err)
+	}
+	if err := a.SendAttachment("openid_1", Attachment{Type: "image", URL: outside}); !errors.Is(err, ErrAttachmentOutsideUploadDir) {
+		t.Fatalf("expected upload dir error, got %v", err)
+	}
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if fake.tokenCalls != 0 || len(fake.sent) != 0 {
+		t.Fatalf("nothing should be sent: token=%d sent=%d", fake.tokenCalls, len(fake.sent))
+	}
+}
+
+func TestWeChatAdapter_WeComSendIncludesAgentID(t *testing.T) {
+	fake := &fakeWeChatAPI{}
+	srv := httptest.NewServer(http.HandlerFunc(fake.serve))
+	defer srv.Close()
+
+	a, err := NewWeChatAdapter(WeChatAdapterConfig{Kind: "wecom", AppID: "corp1", AppSecret: "s", AgentID: 1000002, Token: "tok", EncodingAESKey: testWeChatAESKey, APIBaseURL: srv.URL})
+	if err != nil {
+		t.Fatalf("new adapter: %v", err)
+	}
+	if err := a.SendMessage("zhangsan", "hi"); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if len(fake.sent) != 1 || fake.sent[0]["agentid"] != float64(1000002) {
+		t.Fatalf("unexpected payload: %+v", fake.sent)
+	}
+}
+
+func TestSplitWeChatText(t *testing.T) {
+	text := strings.Repeat("中", 1000) // 3000 字节
+	chunks := splitWeChatText(text)
+	if len(chunks) != 2 {
+		t.Fatalf("expected 2 chunks, got %d", len(chunks))
+	}
+	if strings.Join(chunks, "") != text {
+		t.Fatal("chunks do not reassemble to original text")
+	}
+	for _, c := range chunks {
+		if len(c) > wechatMaxTextBytes {
+			t.Fatalf("chunk exceeds limit: %d", len(c))
+		}
+	}
+}
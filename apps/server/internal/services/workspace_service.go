@@ -129,3 +129,30 @@ func (s *WorkspaceService) getAvgResponseTime() float64 {
 	_ = s.db.Model(&models.Agent{}).Select("AVG(avg_response_time)").Row().Scan(&avg)
 	return avg
 }
+
+// SessionUnread 坐席所负责会话的未读情况
+type SessionUnread struct {
+	SessionID string     `json:"session_id"`
+	Platform  string     `json:"platform"`
+	LastSeq   int64      `json:"last_seq"`
+	ReadSeq   int64      `json:"read_seq"`
+	ReadAt    *time.Time `json:"read_at"`
+	Unread    int64      `json:"unread"`
+}
+
+// GetUnreadCounts 统计坐席进行中会话里尚未读到的客户消息数（基于该坐席的已读游标）
+func (s *WorkspaceService) GetUnreadCounts(ctx context.Context, agentID uint) ([]SessionUnread, error) {
+	participant := AgentChannelID(agentID)
+	var rows []SessionUnread
+	if err := s.db.WithContext(ctx).Table("sessions").
+		Select(`sessions.id AS session_id, COALESCE(sessions.platform, 'unknown') AS platform, sessions.last_seq,
+				COALESCE(c.read_seq, 0) AS read_seq, c.read_at,
+				(SELECT COUNT(*) FROM messages m WHERE m.session_id = sessions.id AND m.sender = 'user' AND m.seq > COALESCE(c.read_seq, 0)) AS unread`).
+		Joins("LEFT JOIN session_cursors c ON c.session_id = sessions.id AND c.participant = ?", participant).
+		Where("sessions.agent_id = ? AND sessions.status = ?", agentID, "active").
+		Order("unread DESC, sessions.started_at DESC").
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("count unread messages: %w", err)
+	}
+	return rows, nil
+}